@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/kahook/internal/config"
+)
+
+const configUsage = "usage: kahook config schema | kahook config show [--config path] | kahook config diff old.yaml new.yaml"
+
+// runConfig implements `kahook config <command>`: schema prints the JSON
+// Schema of the config file so editors and CI can validate config.yaml, and
+// show prints the effective configuration, after defaults and environment
+// overrides, with secrets redacted, and diff lists the settings that differ
+// between two config files, also redacted. It returns the process exit code.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, configUsage)
+		return 2
+	}
+	switch args[0] {
+	case "schema":
+		if len(args) != 1 {
+			fmt.Fprintln(stderr, configUsage)
+			return 2
+		}
+		schema, err := config.Schema()
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		fmt.Fprintf(stdout, "%s\n", schema)
+		return 0
+	case "show":
+		return runConfigShow(args[1:], stdout, stderr)
+	case "diff":
+		return runConfigDiff(args[1:], stdout, stderr)
+	default:
+		fmt.Fprintln(stderr, configUsage)
+		return 2
+	}
+}
+
+func runConfigShow(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("config show", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("config", getConfigPath(), "config file (default: CONFIG_PATH or the usual locations)")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	out, err := yaml.Marshal(cfg.Redacted())
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	_, _ = stdout.Write(out)
+	return 0
+}
+
+// runConfigDiff prints one line per setting that differs between two config
+// files, each loaded with the same environment overrides the server applies,
+// so a change can be reviewed before it is rolled out.
+func runConfigDiff(args []string, stdout, stderr io.Writer) int {
+	if len(args) != 2 {
+		fmt.Fprintln(stderr, configUsage)
+		return 2
+	}
+	old, err := config.Load(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	cfg, err := config.Load(args[1])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	changes := config.Diff(old, cfg)
+	if len(changes) == 0 {
+		fmt.Fprintln(stdout, "no changes")
+		return 0
+	}
+	for _, c := range changes {
+		fmt.Fprintln(stdout, c)
+	}
+	return 0
+}
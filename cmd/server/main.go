@@ -2,19 +2,45 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
+	"slices"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/clockcheck"
 	"github.com/kahook/internal/config"
+	"github.com/kahook/internal/drift"
+	"github.com/kahook/internal/filesink"
+	"github.com/kahook/internal/geoip"
+	"github.com/kahook/internal/ids"
+	"github.com/kahook/internal/jsonschema"
 	"github.com/kahook/internal/kafka"
+	"github.com/kahook/internal/keyexpr"
+	"github.com/kahook/internal/lag"
+	"github.com/kahook/internal/leader"
+	"github.com/kahook/internal/nats"
+	"github.com/kahook/internal/otlp"
+	"github.com/kahook/internal/proxyproto"
+	"github.com/kahook/internal/pulsar"
+	"github.com/kahook/internal/ratelimit"
+	"github.com/kahook/internal/redact"
+	"github.com/kahook/internal/redis"
 	"github.com/kahook/internal/server"
+	"github.com/kahook/internal/spool"
+	"github.com/kahook/internal/transform"
+	"github.com/kahook/internal/upcast"
 	"github.com/kahook/internal/version"
 )
 
@@ -23,6 +49,15 @@ func main() {
 		fmt.Println(version.String())
 		os.Exit(0)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfig(os.Args[2:], os.Stdout, os.Stderr))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "spool" {
+		os.Exit(runSpool(os.Args[2:], os.Stdout, os.Stderr))
+	}
 
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -42,45 +77,375 @@ func main() {
 		logger.Fatal("failed to load config", zap.Error(err))
 	}
 
+	// Scrub every configured credential from anything logged from here on,
+	// including errors from clients that quote their connection settings.
+	// The scrubbed secrets follow config reloads.
+	scrubber := redact.NewScrubber(cfg.Secrets())
+	logger = logger.WithOptions(zap.WrapCore(scrubber.Core))
+
+	if o := cfg.Tracing.OTLP; o.Logs {
+		// Failed exports are reported through the logger as it is so far,
+		// so they cannot feed back into the exporter.
+		logs, err := otlp.NewLogs(otlp.Config{
+			Endpoint:       o.Endpoint,
+			Headers:        o.Headers,
+			ServiceName:    o.ServiceName,
+			ServiceVersion: version.Version,
+			Logger:         logger,
+		})
+		if err != nil {
+			logger.Fatal("invalid otlp config", zap.Error(err))
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := logs.Shutdown(ctx); err != nil {
+				logger.Warn("failed to flush logs", zap.Error(err))
+			}
+		}()
+		logger = logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(c, scrubber.Core(logs.Core(c)))
+		}))
+		logger.Info("otlp log export enabled", zap.String("endpoint", redact.URL(o.Endpoint)))
+	}
+
 	logger.Info("configuration loaded",
+		zap.String("profile", cfg.Profile),
+		zap.String("backend", cfg.Backend),
+		zap.Bool("hardened", cfg.Hardened),
 		zap.Int("port", cfg.Server.Port),
 		zap.Strings("kafka_brokers", cfg.Kafka.Brokers),
+		zap.String("kafka_client_id", cfg.Kafka.ClientID),
+		zap.String("kafka_client_rack", cfg.Kafka.ClientRack),
 	)
 
-	producer, err := kafka.NewProducer(kafka.ProducerConfig{
-		ConfigMap: cfg.KafkaConfigMap(),
-		Logger:    logger,
-	})
+	// Connection lifecycle events of the Kafka producers, logged as they
+	// happen and counted in /metrics.
+	var brokerEvents *kafka.BrokerEvents
+	var brokerEventCounts func() map[string]int64
+	var brokers func() (int, bool)
+	var delivery server.DeliverySemantics
+	if slices.Contains(cfg.Backends(), config.BackendKafka) {
+		brokerEvents = &kafka.BrokerEvents{}
+		brokerEventCounts = brokerEvents.Snapshot
+		brokers = brokerEvents.Brokers
+		delivery = server.DeliverySemantics{
+			Mode:      cfg.Kafka.ProducerMode(),
+			Semantics: cfg.Kafka.DeliverySemantics(),
+		}
+	}
+
+	// now is the server's clock, shared by everything that reads the time
+	// on its behalf.
+	now := time.Now
+	spill := newSpillSpool(cfg, logger, now)
+
+	var client kafka.Client
+	connect := kafka.ConnectConfig{
+		Connect: func() (kafka.Client, error) { return connectProducer(cfg, logger, brokerEvents, spill) },
+		Logger:  logger.With(zap.String("backend", cfg.Backend)),
+	}
+	switch {
+	case cfg.Startup.Lazy():
+		// Serve straight away and keep trying to create the producer; until
+		// it exists webhooks get 503 and /ready fails.
+		logger.Info("lazy producer startup enabled", zap.String("backend", cfg.Backend))
+		client = kafka.NewLazy(connect)
+	case cfg.Startup.RetryTimeout > 0:
+		retryCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Startup.RetryTimeout)*time.Second)
+		client, err = kafka.Connect(retryCtx, connect)
+		cancel()
+		if err != nil {
+			logger.Fatal("failed to create producer", zap.String("backend", cfg.Backend), zap.Error(err))
+		}
+	default:
+		client, err = newProducer(cfg, logger, brokerEvents, spill)
+		if err != nil {
+			logger.Fatal("failed to create producer", zap.String("backend", cfg.Backend), zap.Error(err))
+		}
+	}
+	// A config reload may replace the producer while it serves.
+	producer := kafka.NewSwappable(client)
+	// While the brokers cannot be reached, webhooks may be spooled to the
+	// spill directory and produced once they are back.
+	var sink server.KafkaProducer = producer
+	outages := newOutageSpool(cfg, spill, producer, logger)
+	if outages != nil {
+		sink = outages
+	}
+	defer sink.Close()
+
+	runPreflight(cfg, logger)
+
+	reloadable, err := newReloadable(cfg, logger, now)
 	if err != nil {
-		logger.Fatal("failed to create kafka producer", zap.Error(err))
+		logger.Fatal("invalid config", zap.Error(err))
 	}
-	defer producer.Close()
 
-	logger.Info("kafka producer created",
-		zap.Strings("brokers", cfg.Kafka.Brokers),
-	)
+	var metricsAuth *auth.BearerAuth
+	if len(cfg.Auth.MetricsTokens) > 0 {
+		metricsAuth = auth.NewBearerAuth(cfg.Auth.MetricsTokens)
+		logger.Info("metrics tokens enabled", zap.Int("tokens", len(cfg.Auth.MetricsTokens)))
+	}
+
+	var responseSigner server.ResponseSigner
+	if rs := cfg.Server.ResponseSigning; rs.Enabled() {
+		signer, err := rs.Signer()
+		if err != nil {
+			logger.Fatal("invalid response signing key", zap.Error(err))
+		}
+		responseSigner = signer
+		logger.Info("response signing enabled",
+			zap.String("alg", signer.Algorithm()),
+			zap.String("kid", signer.KeyID()),
+		)
+	}
 
-	// Build the user map for basic auth.
-	users := make(map[string]string)
-	for _, u := range cfg.Auth.Users {
-		users[u.Username] = u.Password
+	exempt := cfg.Limits.Exempt
+	exemptNetworks, err := exempt.Networks()
+	if err != nil {
+		logger.Fatal("invalid rate limit exemptions", zap.Error(err))
+	}
+	exemptRoutes := make([]string, len(exempt.Routes))
+	for i, r := range exempt.Routes {
+		exemptRoutes[i] = strings.Trim(r, "/")
+	}
+	if len(exempt.Principals)+len(exempt.CIDRs)+len(exempt.Routes) > 0 {
+		logger.Info("rate limit exemptions configured",
+			zap.Strings("principals", exempt.Principals),
+			zap.Strings("cidrs", exempt.CIDRs),
+			zap.Strings("routes", exempt.Routes),
+		)
 	}
 
-	authenticator := auth.NewMultiAuth(users, cfg.Auth.Tokens)
+	probes := cfg.Server.Probes
+	probeBypass, err := probes.BypassNetworks()
+	if err != nil {
+		logger.Fatal("invalid probe bypass networks", zap.Error(err))
+	}
+	if probes.Auth {
+		logger.Info("probe auth enabled", zap.Strings("bypass_cidrs", probes.BypassCIDRs))
+	}
 
-	if authenticator.HasAuth() {
-		if len(users) > 0 {
-			logger.Info("basic auth enabled", zap.Int("users", len(users)))
+	clientIP := cfg.Server.ClientIP
+	trustedProxies, err := clientIP.TrustedNetworks()
+	if err != nil {
+		logger.Fatal("invalid client IP trusted proxies", zap.Error(err))
+	}
+
+	priority := cfg.Limits.Priority
+	priorityNetworks, err := priority.TrustedNetworks()
+	if err != nil {
+		logger.Fatal("invalid priority trusted networks", zap.Error(err))
+	}
+	if priority.MaxInFlight > 0 {
+		logger.Info("priority load shedding enabled",
+			zap.Int("max_in_flight", priority.MaxInFlight),
+			zap.Float64("shed_low_at", priority.ShedLowAt),
+			zap.Float64("shed_normal_at", priority.ShedNormalAt),
+		)
+	}
+
+	budget := cfg.Limits.ErrorBudget
+	if budget.FailureRatio > 0 || len(budget.Topics) > 0 {
+		logger.Info("produce error budgets enabled",
+			zap.Float64("failure_ratio", budget.FailureRatio),
+			zap.Int("topic_overrides", len(budget.Topics)),
+		)
+	}
+
+	if cfg.Usage.Enabled() {
+		logger.Info("usage reports enabled",
+			zap.Int("interval", cfg.Usage.Interval),
+			zap.String("topic", cfg.Usage.Topic),
+			zap.String("instance", cfg.Usage.Instance),
+		)
+	}
+
+	if q := cfg.Quarantine; q.Topic != "" {
+		logger.Info("quarantine enabled",
+			zap.String("topic", q.Topic),
+			zap.Strings("violations", q.Violations),
+		)
+	}
+
+	if d := cfg.DeadLetter; d.Enabled() {
+		logger.Info("dead letter enabled",
+			zap.String("topic", d.Topic),
+			zap.Int("retries", d.Retries),
+			zap.Int("backoff_ms", d.BackoffMs),
+		)
+	}
+
+	if a := cfg.Audit; a.Topic != "" {
+		logger.Info("audit log enabled", zap.String("topic", a.Topic))
+	}
+	if r := cfg.Receipts; r.Topic != "" {
+		logger.Info("delivery receipts enabled", zap.String("topic", r.Topic))
+	}
+	var idempotencyStore server.IdempotencyStore
+	if i := cfg.Idempotency; i.Window > 0 {
+		store := "memory"
+		if i.Redis.URL != "" {
+			client, err := redis.New(redis.Config{URL: i.Redis.URL, KeyPrefix: i.Redis.KeyPrefix})
+			if err != nil {
+				logger.Fatal("failed to create idempotency store", zap.Error(err))
+			}
+			defer client.Close()
+			if err := client.Ping(context.Background()); err != nil {
+				logger.Warn("idempotency store is not reachable; webhooks are handled without their keys until it is",
+					zap.String("url", redact.URL(i.Redis.URL)), zap.Error(err))
+			}
+			idempotencyStore, store = client, "redis"
 		}
-		if len(cfg.Auth.Tokens) > 0 {
-			logger.Info("bearer auth enabled", zap.Int("tokens", len(cfg.Auth.Tokens)))
+		logger.Info("idempotent replay enabled", zap.Int("window_seconds", i.Window), zap.String("store", store))
+	}
+
+	var spans server.SpanExporter
+	if o := cfg.Tracing.OTLP; o.Enabled() {
+		exporter, err := otlp.New(otlp.Config{
+			Endpoint:       o.Endpoint,
+			Headers:        o.Headers,
+			ServiceName:    o.ServiceName,
+			ServiceVersion: version.Version,
+			Logger:         logger,
+		})
+		if err != nil {
+			logger.Fatal("invalid otlp config", zap.Error(err))
 		}
-	} else {
-		logger.Warn("no authentication configured")
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := exporter.Shutdown(ctx); err != nil {
+				logger.Warn("failed to flush spans", zap.Error(err))
+			}
+		}()
+		spans = exporter
+		logger.Info("otlp span export enabled",
+			zap.String("endpoint", redact.URL(o.Endpoint)),
+			zap.Float64("sample_ratio", o.SampleRatio),
+		)
+	}
+
+	var proxyProtocol *proxyproto.Config
+	if pp := cfg.Server.ProxyProtocol; pp.Enabled {
+		trusted, err := proxyproto.ParseCIDRs(pp.TrustedCIDRs)
+		if err != nil {
+			logger.Fatal("invalid proxy protocol config", zap.Error(err))
+		}
+		proxyProtocol = &proxyproto.Config{Trusted: trusted, Required: pp.Required}
+		logger.Info("proxy protocol enabled",
+			zap.Strings("trusted_cidrs", pp.TrustedCIDRs),
+			zap.Bool("required", pp.Required),
+		)
+	}
+
+	var countries server.CountryResolver
+	if db := cfg.GeoIP.Database; db != "" {
+		r, err := geoip.Open(db)
+		if err != nil {
+			logger.Fatal("failed to open geoip database", zap.Error(err))
+		}
+		countries = r
+		logger.Info("geoip enabled",
+			zap.String("database", db),
+			zap.String("header", cfg.GeoIP.Header),
+			zap.Int("country_policies", len(cfg.CountryPolicies())),
+		)
+	}
+
+	newID, err := ids.New(cfg.Server.IDScheme)
+	if err != nil {
+		logger.Fatal("invalid id scheme", zap.Error(err))
+	}
+
+	if dir := cfg.Record.Dir; dir != "" {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			logger.Fatal("failed to create fixture directory", zap.Error(err))
+		}
+	}
+
+	var verifier server.Verifier
+	if cfg.Admin.Verify.Enabled {
+		vcfg := kafka.VerifierConfig{
+			ConfigMap: cfg.KafkaConfigMap(),
+			Topic:     cfg.Admin.Verify.Topic,
+			Logger:    logger,
+		}
+		var v interface {
+			server.Verifier
+			Close()
+		}
+		if cfg.Kafka.Client == config.KafkaClientNative {
+			v, err = kafka.NewNativeVerifier(vcfg)
+		} else {
+			v, err = kafka.NewVerifier(vcfg)
+		}
+		if err != nil {
+			logger.Fatal("failed to create verifier", zap.Error(err))
+		}
+		defer v.Close()
+		verifier = v
+		logger.Info("end-to-end verification enabled", zap.String("topic", cfg.Admin.Verify.Topic))
 	}
 
-	if len(cfg.Server.AllowedTopics) > 0 {
-		logger.Info("topic allowlist enabled", zap.Strings("allowed_topics", cfg.Server.AllowedTopics))
+	var tail server.LiveTail
+	if t := cfg.Admin.Tail; t.Enabled {
+		tail = server.LiveTail{MaxSubscribers: t.MaxSubscribers, MaxBodyBytes: t.MaxBodyBytes}
+		logger.Info("live tail enabled",
+			zap.Int("max_subscribers", t.MaxSubscribers),
+			zap.Int("max_body_bytes", t.MaxBodyBytes),
+		)
+	}
+
+	clock, closeClock := newClockChecker(cfg, logger)
+	defer closeClock()
+	var clockOffset func() (time.Duration, bool)
+	if clock != nil {
+		clockOffset = clock.Offset
+	}
+
+	consumerLag, closeConsumerLag := newLagMonitor(cfg, logger)
+	defer closeConsumerLag()
+
+	driftChecker := newDriftChecker(cfg, logger)
+	var configDrift func() (bool, bool)
+	if driftChecker != nil {
+		configDrift = driftChecker.Drifted
+	}
+
+	coordinator := newCoordinator(cfg, logger)
+	var isLeader func() bool
+	if coordinator != nil {
+		isLeader = coordinator.IsLeader
+	}
+
+	reloads := &reloader{
+		path:       getConfigPath(),
+		producer:   producer,
+		scrubber:   scrubber,
+		events:     brokerEvents,
+		spill:      spill,
+		logger:     logger,
+		now:        now,
+		cfg:        cfg,
+		reloadable: reloadable,
+	}
+
+	replayer := newReplayer(cfg, spill, producer, logger)
+
+	var adminAPI server.AdminAPI
+	if a := cfg.Admin.Listener; a.Enabled() {
+		adminAPI = server.AdminAPI{Addr: a.Addr(), EffectiveConfig: reloads.effectiveConfig}
+		if replayer != nil {
+			adminAPI.Replay = replayControl{replayer}
+		}
+		if len(a.Tokens) > 0 {
+			adminAPI.Auth = auth.NewBearerAuth(a.Tokens)
+		}
+		if len(a.ReadOnlyTokens) > 0 {
+			adminAPI.ReadOnlyAuth = auth.NewBearerAuth(a.ReadOnlyTokens)
+		}
 	}
 
 	srv := server.NewServer(server.ServerConfig{
@@ -88,12 +453,222 @@ func main() {
 		ReadTimeout:   time.Duration(cfg.Server.ReadTimeout) * time.Second,
 		WriteTimeout:  time.Duration(cfg.Server.WriteTimeout) * time.Second,
 		IdleTimeout:   time.Duration(cfg.Server.IdleTimeout) * time.Second,
-		Producer:      producer,
-		Auth:          authenticator,
+		Producer:      sink,
+		Auth:          reloadable.Auth,
+		MetricsAuth:   metricsAuth,
 		Logger:        logger,
-		AllowedTopics: cfg.Server.AllowedTopics,
+		AllowedTopics: reloadable.AllowedTopics,
+		StrictRoutes:  cfg.Server.StrictRoutes,
+		DevProfile:    cfg.Profile == config.ProfileDev,
+
+		RequestRate:        reloadable.RequestRate,
+		TopicBandwidth:     reloadable.TopicBandwidth,
+		PrincipalBandwidth: reloadable.PrincipalBandwidth,
+		RateLimitExempt: server.RateLimitExemptions{
+			Principals: exempt.Principals,
+			Networks:   exemptNetworks,
+			Topics:     exemptRoutes,
+		},
+		Priority: server.PriorityAdmission{
+			MaxInFlight:       priority.MaxInFlight,
+			ShedLowAt:         priority.ShedLowAt,
+			ShedNormalAt:      priority.ShedNormalAt,
+			Header:            priority.Header,
+			TrustedPrincipals: priority.TrustedPrincipals,
+			TrustedNetworks:   priorityNetworks,
+		},
+		ErrorBudget: server.ErrorBudget{
+			FailureRatio: budget.FailureRatio,
+			TopicRatios:  budget.Topics,
+			MinRequests:  budget.MinRequests,
+			Window:       time.Duration(budget.Window) * time.Second,
+			Duration:     time.Duration(budget.Duration) * time.Second,
+			Throttle:     ratelimit.Limit{Rate: budget.Throttle.RequestsPerSecond, Burst: float64(budget.Throttle.Burst)},
+		},
+		ConsumerLag: consumerLag,
+
+		Usage: server.UsageReports{
+			Interval:     time.Duration(cfg.Usage.Interval) * time.Second,
+			Topic:        cfg.Usage.Topic,
+			Instance:     cfg.Usage.Instance,
+			TenantHeader: cfg.Usage.Header,
+		},
+		Tail: tail,
+
+		Topics:        reloadable.Topics,
+		RoutePaths:    reloadable.RoutePaths,
+		RouteHeaders:  reloadable.RouteHeaders,
+		AliasedTopics: reloadable.AliasedTopics,
+
+		Host:          cfg.Server.Host,
+		AddressFamily: cfg.Server.AddressFamily,
+		ProxyProtocol: proxyProtocol,
+
+		MaxConnectionAge: time.Duration(cfg.Server.MaxConnectionAge) * time.Second,
+
+		ReadHeaderTimeout:        time.Duration(cfg.Server.ReadHeaderTimeout) * time.Second,
+		MinBodyRate:              cfg.Server.MinBodyRate,
+		MaxRequestsPerConnection: cfg.Server.MaxRequestsPerConnection,
+		HTTPMaxHeaderBytes:       cfg.Server.MaxHeaderBytes,
+		MaxConnections:           cfg.Server.MaxConnections,
+		DisableHTTP2:             cfg.Server.DisableHTTP2,
+		DisableKeepAlives:        cfg.Server.DisableKeepAlives,
+
+		Batch: server.BatchIngest{
+			Enabled:    cfg.Server.Batch.Enabled,
+			MaxRecords: cfg.Server.Batch.MaxRecords,
+			MaxBytes:   cfg.Server.Batch.MaxBodyBytes,
+		},
+
+		ProduceQueue: server.ProduceQueue{
+			Depth:   cfg.Server.ProduceQueue.Depth,
+			Workers: cfg.Server.ProduceQueue.Workers,
+		},
+		Overload: server.OverloadThresholds{
+			QueueSaturation: cfg.Server.Readiness.QueueSaturation,
+			ErrorRate:       cfg.Server.Readiness.ErrorRate,
+			MinRequests:     int64(cfg.Server.Readiness.MinRequests),
+			SustainFor:      time.Duration(cfg.Server.Readiness.Sustain) * time.Second,
+		},
+
+		LatencySLO: server.LatencySLO{
+			Threshold: time.Duration(cfg.SLO.ProduceLatencyMs) * time.Millisecond,
+			Target:    cfg.SLO.Target,
+		},
+
+		IsLeader: isLeader,
+		Delivery: delivery,
+
+		Now:          now,
+		ClockOffset:  clockOffset,
+		ConfigDrift:  configDrift,
+		BrokerEvents: brokerEventCounts,
+		Brokers:      brokers,
+		ReloadStatus: reloads.status,
+		Spool:        spoolStats(spill, outages),
+
+		GeoIP:         countries,
+		CountryHeader: cfg.GeoIP.Header,
+
+		ScannerPaths: cfg.Server.ScannerPaths,
+
+		RecordDir:     cfg.Record.Dir,
+		RecordSecrets: cfg.Secrets(),
+
+		AuthRealm:     cfg.Auth.Realm,
+		AuthChallenge: cfg.Auth.Challenge,
+
+		CredentialDormancy: time.Duration(cfg.Auth.DormantAfter) * time.Second,
+
+		TLSCertFile:       cfg.Server.TLS.CertFile,
+		TLSKeyFile:        cfg.Server.TLS.KeyFile,
+		HSTS:              cfg.Server.TLS.Offloaded,
+		TerseErrors:       cfg.Hardened,
+		StrictContentType: cfg.Hardened,
+
+		MaxHeaderBytes:       cfg.Limits.MaxHeaderBytes,
+		MaxDecompressedBytes: cfg.Limits.MaxDecompressedBytes,
+		MaxBodyBytes:         cfg.Server.MaxBodyBytes,
+		Quarantine: server.Quarantine{
+			Topic:      cfg.Quarantine.Topic,
+			Violations: cfg.Quarantine.Violations,
+		},
+		DeadLetter: server.DeadLetter{
+			Topic:   cfg.DeadLetter.Topic,
+			Retries: cfg.DeadLetter.Retries,
+			Backoff: time.Duration(cfg.DeadLetter.BackoffMs) * time.Millisecond,
+		},
+		Audit: server.AuditLog{
+			Topic:  cfg.Audit.Topic,
+			Buffer: cfg.Audit.Buffer,
+		},
+		Receipts: server.Receipts{
+			Topic:  cfg.Receipts.Topic,
+			Buffer: cfg.Receipts.Buffer,
+		},
+		Idempotency: server.Idempotency{
+			Window:          time.Duration(cfg.Idempotency.Window) * time.Second,
+			Header:          cfg.Idempotency.Header,
+			MaxEntries:      cfg.Idempotency.MaxEntries,
+			HashBodies:      cfg.Idempotency.HashBodies,
+			DuplicateStatus: cfg.Idempotency.DuplicateStatus,
+			Store:           idempotencyStore,
+		},
+		Load: server.LoadSignal{
+			TargetInFlight: cfg.LoadSignal.TargetInFlight,
+			TargetLatency:  time.Duration(cfg.LoadSignal.TargetLatencyMs) * time.Millisecond,
+		},
+		AccessLog: server.AccessLog{
+			Topic:         cfg.AccessLog.Topic,
+			SampleRatio:   cfg.AccessLog.SampleRatio,
+			BatchSize:     cfg.AccessLog.BatchSize,
+			FlushInterval: time.Duration(cfg.AccessLog.FlushMs) * time.Millisecond,
+			Buffer:        cfg.AccessLog.Buffer,
+			Replace:       cfg.AccessLog.Replace,
+		},
+		RequestLog: server.RequestLog{
+			Format:      cfg.Server.Logging.Format,
+			Query:       cfg.Server.Logging.HasField(config.LogFieldQuery),
+			UserAgent:   cfg.Server.Logging.HasField(config.LogFieldUserAgent),
+			Principal:   cfg.Server.Logging.HasField(config.LogFieldPrincipal),
+			Headers:     cfg.Server.Logging.Headers,
+			SampleRatio: cfg.Server.Logging.SampleRatio,
+		},
+		TraceHeaders: server.TraceHeaders(cfg.Tracing.Headers),
+		ClientIP:     server.ClientIP{Header: clientIP.Header, TrustedProxies: trustedProxies},
+		Probes:       server.ProbeAccess{Auth: probes.Auth, BypassNetworks: probeBypass},
+
+		Spans:           spans,
+		SpanSampleRatio: cfg.Tracing.OTLP.SampleRatio,
+
+		AdminAPI: adminAPI,
+
+		ResponseSigner: responseSigner,
+
+		Verifier:      verifier,
+		VerifyTimeout: time.Duration(cfg.Admin.Verify.Timeout) * time.Second,
+
+		NewID: newID,
 	})
 
+	if replayer != nil && cfg.Kafka.Drain.Replay == config.ReplayBeforeServing && !replayBeforeServing(replayer, logger) {
+		return
+	}
+
+	leaderCtx, stopLeader := context.WithCancel(context.Background())
+	var leaderWG sync.WaitGroup
+	if coordinator != nil {
+		leaderWG.Add(1)
+		go func() {
+			defer leaderWG.Done()
+			coordinator.Run(leaderCtx)
+		}()
+	}
+
+	checkCtx, stopChecks := context.WithCancel(context.Background())
+	defer stopChecks()
+	if clock != nil {
+		go clock.Run(checkCtx)
+	}
+	if driftChecker != nil {
+		go driftChecker.Run(checkCtx)
+	}
+	if consumerLag != nil {
+		go consumerLag.Run(checkCtx)
+	}
+	if replayer != nil && cfg.Kafka.Drain.Replay == config.ReplayBackground {
+		go func() {
+			if err := replayer.Run(checkCtx); err != nil && !errors.Is(err, context.Canceled) {
+				logger.Error("spill replay failed", zap.Error(err))
+			}
+		}()
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	reloads.srv = srv
+	go reloads.run(checkCtx, hup)
+
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
 
@@ -113,9 +688,554 @@ func main() {
 		logger.Error("server shutdown error", zap.Error(err))
 	}
 
+	// Release leadership so another replica can take over immediately.
+	stopLeader()
+	leaderWG.Wait()
+
 	logger.Info("server stopped gracefully")
 }
 
+// newCoordinator builds the leader election coordinator, or returns nil when
+// leader election is disabled.
+func newCoordinator(cfg *config.Config, logger *zap.Logger) *leader.Coordinator {
+	le := cfg.LeaderElection
+	if !le.Enabled {
+		return nil
+	}
+	lock, err := leader.NewInClusterLeaseLock(leader.LeaseConfig{
+		Name:      le.LeaseName,
+		Namespace: le.Namespace,
+		Identity:  le.Identity,
+		Duration:  time.Duration(le.LeaseDuration) * time.Second,
+	})
+	if err != nil {
+		logger.Fatal("failed to set up leader election", zap.Error(err))
+	}
+	logger.Info("leader election enabled",
+		zap.String("lease", le.LeaseName),
+		zap.String("identity", le.Identity),
+	)
+	return leader.New(leader.Config{
+		Lock:          lock,
+		RenewDeadline: time.Duration(le.RenewDeadline) * time.Second,
+		RetryPeriod:   time.Duration(le.RetryPeriod) * time.Second,
+		Logger:        logger,
+	})
+}
+
+// newClockChecker builds the clock skew checker and a function that releases
+// its sources, or returns nil when no reference clock is configured.
+func newClockChecker(cfg *config.Config, logger *zap.Logger) (*clockcheck.Checker, func()) {
+	c := cfg.Clock
+	if !c.Enabled() {
+		return nil, func() {}
+	}
+	var sources []clockcheck.Source
+	closeSources := func() {}
+	if c.NTPServer != "" {
+		sources = append(sources, clockcheck.NTP{Server: c.NTPServer})
+	}
+	if c.KafkaTopic != "" {
+		bcfg := kafka.BrokerClockConfig{
+			ConfigMap: cfg.KafkaConfigMap(),
+			Topic:     c.KafkaTopic,
+			Logger:    logger,
+		}
+		var broker interface {
+			clockcheck.Source
+			Close()
+		}
+		var err error
+		if cfg.Kafka.Client == config.KafkaClientNative {
+			broker, err = kafka.NewNativeBrokerClock(bcfg)
+		} else {
+			broker, err = kafka.NewBrokerClock(bcfg)
+		}
+		if err != nil {
+			logger.Fatal("failed to create broker clock producer", zap.Error(err))
+		}
+		sources = append(sources, broker)
+		closeSources = broker.Close
+	}
+	logger.Info("clock skew checks enabled",
+		zap.String("ntp_server", c.NTPServer),
+		zap.String("kafka_topic", c.KafkaTopic),
+		zap.Int("max_skew_ms", c.MaxSkewMs),
+		zap.Int("interval", c.Interval),
+	)
+	return clockcheck.New(clockcheck.Config{
+		Sources:  sources,
+		MaxSkew:  time.Duration(c.MaxSkewMs) * time.Millisecond,
+		Interval: time.Duration(c.Interval) * time.Second,
+		Logger:   logger,
+	}), closeSources
+}
+
+// newLagMonitor builds the consumer lag monitor and a function that closes
+// its Kafka client, or returns nil when no consumer lag is watched.
+func newLagMonitor(cfg *config.Config, logger *zap.Logger) (*lag.Monitor, func()) {
+	c := cfg.Limits.ConsumerLag
+	if !c.Enabled() {
+		return nil, func() {}
+	}
+	var reader interface {
+		lag.Source
+		Close()
+	}
+	var err error
+	if cfg.Kafka.Client == config.KafkaClientNative {
+		reader, err = kafka.NewNativeLagReader(cfg.KafkaConfigMap())
+	} else {
+		reader, err = kafka.NewLagReader(cfg.KafkaConfigMap())
+	}
+	if err != nil {
+		logger.Fatal("failed to create consumer lag client", zap.Error(err))
+	}
+	var thresholds []lag.Threshold
+	for topic, groups := range c.Topics {
+		for _, g := range groups {
+			thresholds = append(thresholds, lag.Threshold{Topic: topic, Group: g.Group, MaxLag: g.MaxLag, ResumeLag: g.ResumeLag})
+			logger.Info("consumer lag admission enabled",
+				zap.String("topic", topic),
+				zap.String("group", g.Group),
+				zap.Int64("max_lag", g.MaxLag),
+			)
+		}
+	}
+	return lag.New(lag.Config{
+		Source:     reader,
+		Thresholds: thresholds,
+		Interval:   time.Duration(c.Interval) * time.Second,
+		Logger:     logger,
+	}), reader.Close
+}
+
+// newDriftChecker builds the config drift checker, or returns nil when no
+// reference config is configured. The running config is the config file as
+// written, without environment overrides, which differ by deployment.
+func newDriftChecker(cfg *config.Config, logger *zap.Logger) *drift.Checker {
+	d := cfg.Drift
+	if !d.Enabled() {
+		return nil
+	}
+	running, err := config.LoadFile(getConfigPath())
+	if err != nil {
+		logger.Fatal("failed to read config file for drift checks", zap.Error(err))
+	}
+	source := redact.URL(d.URL)
+	logger.Info("config drift checks enabled",
+		zap.String("source", source),
+		zap.Int("interval", d.Interval),
+		zap.String("config_hash", running.Hash()),
+	)
+	return drift.New(drift.Config{
+		Source: drift.HTTP{URL: d.URL, Token: d.Token, Label: source},
+		Compare: func(data []byte) (string, []string, error) {
+			reference, err := config.Parse(data)
+			if err != nil {
+				return "", nil, err
+			}
+			var changes []string
+			for _, c := range config.Diff(reference, running) {
+				changes = append(changes, c.String())
+			}
+			return reference.Hash(), changes, nil
+		},
+		Hash:     running.Hash(),
+		Interval: time.Duration(d.Interval) * time.Second,
+		Logger:   logger,
+	})
+}
+
 func getConfigPath() string {
 	return os.Getenv("CONFIG_PATH")
 }
+
+// newProducer builds one producer per backend in use and routes each topic to
+// its backend: the topic's override if set, the default backend otherwise.
+func newProducer(cfg *config.Config, logger *zap.Logger, events *kafka.BrokerEvents, spill *spool.Spool) (server.KafkaProducer, error) {
+	backends := make(map[string]kafka.Client)
+	closeAll := func() {
+		for _, b := range backends {
+			b.Close()
+		}
+	}
+
+	for _, name := range cfg.Backends() {
+		b, err := newBackend(cfg, name, logger, events, spill)
+		if err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%s backend: %w", name, err)
+		}
+		backends[name] = b
+	}
+
+	def := backends[cfg.DefaultBackend()]
+	routes := make(map[string]kafka.Client)
+	for topic, t := range cfg.Topics {
+		if t.Backend != "" && t.Backend != cfg.DefaultBackend() {
+			routes[topic] = backends[t.Backend]
+		}
+	}
+	if len(routes) == 0 {
+		return def, nil
+	}
+	return kafka.NewTopicRouter(def, routes), nil
+}
+
+// connectProducer creates the producer and checks that a broker answers, so
+// startup modes that retry until Kafka is up also retry while it is
+// reachable but not yet serving.
+func connectProducer(cfg *config.Config, logger *zap.Logger, events *kafka.BrokerEvents, spill *spool.Spool) (kafka.Client, error) {
+	p, err := newProducer(cfg, logger, events, spill)
+	if err != nil {
+		return nil, err
+	}
+	if !p.IsConnected() {
+		p.Close()
+		return nil, errors.New("producer created but no broker answered")
+	}
+	return p, nil
+}
+
+// newBackend creates the producer for a single backend.
+func newBackend(cfg *config.Config, name string, logger *zap.Logger, events *kafka.BrokerEvents, spill *spool.Spool) (kafka.Client, error) {
+	switch name {
+	case config.BackendPulsar:
+		producer, err := pulsar.NewProducer(pulsar.ProducerConfig{
+			ServiceURL:    cfg.Pulsar.ServiceURL,
+			Tenant:        cfg.Pulsar.Tenant,
+			Namespace:     cfg.Pulsar.Namespace,
+			NonPersistent: cfg.Pulsar.NonPersistent,
+			Token:         cfg.Pulsar.Token,
+			HealthTopic:   cfg.Pulsar.HealthTopic,
+			Logger:        logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("pulsar producer created",
+			zap.String("service_url", cfg.Pulsar.ServiceURL),
+			zap.String("tenant", cfg.Pulsar.Tenant),
+			zap.String("namespace", cfg.Pulsar.Namespace),
+		)
+		return producer, nil
+	case config.BackendNATS:
+		producer, err := nats.NewProducer(nats.ProducerConfig{
+			URL:           cfg.NATS.URL,
+			SubjectPrefix: cfg.NATS.SubjectPrefix,
+			Username:      cfg.NATS.Username,
+			Password:      cfg.NATS.Password,
+			Token:         cfg.NATS.Token,
+			TLS:           cfg.NATS.TLS,
+			Logger:        logger,
+		})
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("nats jetstream producer created",
+			zap.String("subject_prefix", cfg.NATS.SubjectPrefix),
+		)
+		return producer, nil
+	case config.BackendFile:
+		producer, err := filesink.NewProducer(cfg.File.Path)
+		if err != nil {
+			return nil, err
+		}
+		logger.Info("file sink producer created", zap.String("path", cfg.File.Path))
+		return producer, nil
+	case config.BackendDevNull:
+		logger.Info("devnull producer created; messages will be discarded")
+		return filesink.NewWriterProducer(io.Discard), nil
+	default:
+		return newKafkaProducer(cfg, logger, events, spill)
+	}
+}
+
+// newSpillSpool opens the directory where producers spill the messages
+// they could not deliver before shutting down, pruning expired segments
+// against now. It returns nil when no spill directory is configured.
+func newSpillSpool(cfg *config.Config, logger *zap.Logger, now func() time.Time) *spool.Spool {
+	d := cfg.Kafka.Drain
+	if d.SpillDir == "" {
+		return nil
+	}
+	sc, err := d.Spool()
+	if err != nil {
+		logger.Fatal("invalid spill spool settings", zap.Error(err))
+	}
+	sc.Now = now
+	sp, err := spool.New(sc)
+	if err != nil {
+		logger.Fatal("failed to open spill directory", zap.String("dir", d.SpillDir), zap.Error(err))
+	}
+	if n, err := sp.Prune(); err != nil {
+		logger.Warn("failed to prune spill directory", zap.String("dir", d.SpillDir), zap.Error(err))
+	} else if n > 0 {
+		logger.Info("expired spill files removed", zap.String("dir", d.SpillDir), zap.Int("files", n))
+	}
+	logger.Info("drain spill directory enabled",
+		zap.String("dir", d.SpillDir),
+		zap.Bool("encrypted", sp.Encrypted()),
+		zap.Int64("max_bytes", d.SpillMaxBytes),
+		zap.Int("max_age_seconds", d.SpillMaxAge),
+	)
+	return sp
+}
+
+// spoolStats reports the spill directory, and the outage spool when there
+// is one, in /metrics. It returns nil without a spill directory.
+func spoolStats(sp *spool.Spool, outages *spool.Fallback) func() (server.SpoolStats, bool) {
+	if sp == nil {
+		return nil
+	}
+	return func() (server.SpoolStats, bool) {
+		st, err := sp.Stats()
+		if err != nil {
+			return server.SpoolStats{}, false
+		}
+		out := server.SpoolStats{Segments: st.Segments, Bytes: st.Bytes}
+		if !st.Oldest.IsZero() {
+			out.OldestAgeSeconds = time.Since(st.Oldest).Seconds()
+		}
+		if outages != nil {
+			o := outages.Stats()
+			out.Outage = &server.SpoolOutageStats{
+				Spooling:         o.Spooling,
+				PendingSegments:  o.Pending,
+				MessagesSpooled:  o.Spooled,
+				MessagesReplayed: o.Replayed,
+			}
+		}
+		return out, true
+	}
+}
+
+// newOutageSpool wraps producer so webhooks are spooled to the spill
+// directory while the brokers are down, or returns nil when that is off.
+func newOutageSpool(cfg *config.Config, spill *spool.Spool, producer server.KafkaProducer, logger *zap.Logger) *spool.Fallback {
+	if spill == nil || !cfg.Kafka.Drain.SpoolOutages {
+		return nil
+	}
+	logger.Info("outage spool enabled", zap.String("dir", spill.Dir()))
+	return spool.NewFallback(spool.FallbackConfig{Spool: spill, Producer: producer, Logger: logger})
+}
+
+// newReplayer builds the replay of the segments left in the spill directory,
+// or returns nil when replay is off.
+func newReplayer(cfg *config.Config, spill *spool.Spool, producer server.KafkaProducer, logger *zap.Logger) *spool.Replayer {
+	if spill == nil || !cfg.Kafka.Drain.Replays() {
+		return nil
+	}
+	return spool.NewReplayer(spool.ReplayConfig{
+		Spool:    spill,
+		Producer: producer,
+		Logger:   logger,
+	})
+}
+
+// replayBeforeServing replays the spill directory before the server starts
+// listening. It reports false if a shutdown signal interrupted it.
+func replayBeforeServing(r *spool.Replayer, logger *zap.Logger) bool {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := r.Run(ctx); err != nil {
+		if ctx.Err() != nil {
+			logger.Info("shutdown signal received during spill replay")
+			return false
+		}
+		logger.Fatal("spill replay failed", zap.Error(err))
+	}
+	return true
+}
+
+// replayControl lets the admin API pause and resume the spill replay.
+type replayControl struct {
+	*spool.Replayer
+}
+
+func (c replayControl) Status() server.ReplayStatus {
+	return server.ReplayStatus(c.Replayer.Status())
+}
+
+// newKafkaProducer builds the Kafka producer stack: a pool for regular topics
+// and, when any topic requires strict ordering, a dedicated ordering-safe
+// producer that serializes sends per key.
+func newKafkaProducer(cfg *config.Config, logger *zap.Logger, events *kafka.BrokerEvents, spill *spool.Spool) (kafka.Client, error) {
+	poolSize := cfg.Kafka.Pool.Size
+	if poolSize < 1 {
+		poolSize = 1
+	}
+	roundRobin := cfg.RoundRobinTopics()
+	flushTimeout := time.Duration(cfg.Kafka.Drain.FlushTimeout) * time.Second
+	transactionTimeout := time.Duration(cfg.Kafka.Transactional.Timeout) * time.Second
+	native := cfg.Kafka.Client == config.KafkaClientNative
+	pool, err := kafka.NewPool(kafka.PoolConfig{
+		ProducerConfig: kafka.ProducerConfig{
+			ConfigMap:        cfg.KafkaConfigMap(),
+			Logger:           logger,
+			RoundRobinTopics: roundRobin,
+			Events:           events,
+			FlushTimeout:     flushTimeout,
+			Spill:            spill,
+
+			TransactionMaxMessages: cfg.Kafka.Transactional.MaxMessages,
+			TransactionTimeout:     transactionTimeout,
+		},
+		Size:     poolSize,
+		Strategy: cfg.Kafka.Pool.Strategy,
+		Native:   native,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("kafka producer created",
+		zap.Strings("brokers", cfg.Kafka.Brokers),
+		zap.Bool("native_client", native),
+		zap.Int("pool_size", pool.Size()),
+		zap.String("pool_strategy", pool.Strategy()),
+		zap.String("producer_mode", cfg.Kafka.ProducerMode()),
+	)
+	if len(roundRobin) > 0 {
+		logger.Info("round-robin partitioning enabled", zap.Strings("topics", roundRobin))
+	}
+
+	strict := cfg.StrictOrderingTopics()
+	if len(strict) == 0 {
+		return pool, nil
+	}
+
+	orderedConfig := kafka.ProducerConfig{
+		ConfigMap:        cfg.OrderedKafkaConfigMap(),
+		Logger:           logger,
+		RoundRobinTopics: roundRobin,
+		Events:           events,
+		FlushTimeout:     flushTimeout,
+		Spill:            spill,
+
+		TransactionMaxMessages: cfg.Kafka.Transactional.MaxMessages,
+		TransactionTimeout:     transactionTimeout,
+	}
+	var ordered kafka.Client
+	if native {
+		ordered, err = kafka.NewNativeProducer(orderedConfig)
+	} else {
+		ordered, err = kafka.NewProducer(orderedConfig)
+	}
+	if err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("strict ordering producer: %w", err)
+	}
+	serialized := kafka.NewSerialized(ordered)
+
+	routes := make(map[string]kafka.Client, len(strict))
+	for _, topic := range strict {
+		routes[topic] = serialized
+	}
+
+	logger.Info("strict ordering enabled",
+		zap.Strings("topics", strict),
+		zap.String("mode", cfg.Kafka.StrictOrdering),
+	)
+	return kafka.NewTopicRouter(pool, routes), nil
+}
+
+// newByteLimiter builds a bandwidth limiter from config, or returns nil when
+// neither the default nor any override sets a rate.
+func newByteLimiter(def config.ByteRate, overrides map[string]config.ByteRate, now func() time.Time) *ratelimit.Limiter {
+	toLimit := func(r config.ByteRate) ratelimit.Limit {
+		return ratelimit.Limit{Rate: float64(r.BytesPerSecond), Burst: float64(r.BurstBytes)}
+	}
+
+	o := make(map[string]ratelimit.Limit, len(overrides))
+	for k, v := range overrides {
+		o[k] = toLimit(v)
+	}
+
+	l := ratelimit.NewLimiter(toLimit(def), o).WithClock(now)
+	if !l.Enabled() {
+		return nil
+	}
+	return l
+}
+
+// newRequestLimiter builds a request rate limiter from config, or returns nil
+// when no rate is set.
+func newRequestLimiter(def config.RequestRate, overrides map[string]config.RequestRate, now func() time.Time) *ratelimit.Limiter {
+	toLimit := func(r config.RequestRate) ratelimit.Limit {
+		return ratelimit.Limit{Rate: r.RequestsPerSecond, Burst: float64(r.Burst)}
+	}
+
+	o := make(map[string]ratelimit.Limit, len(overrides))
+	for k, v := range overrides {
+		o[k] = toLimit(v)
+	}
+
+	l := ratelimit.NewLimiter(toLimit(def), o).WithClock(now)
+	if !l.Enabled() {
+		return nil
+	}
+	return l
+}
+
+// topicOptions converts per-topic config and route country policies into the
+// server's representation.
+func topicOptions(cfg *config.Config, upcasters map[string]*upcast.Upcaster, schemas map[string]*jsonschema.Schema, keys map[string]*keyexpr.Extractor, transforms map[string]*transform.Pipeline, networks map[string][]netip.Prefix, now func() time.Time) map[string]server.TopicOptions {
+	opts := make(map[string]server.TopicOptions, len(cfg.Topics))
+	for name, t := range cfg.Topics {
+		o := server.TopicOptions{
+			Payload:   server.PayloadMode(t.Payload),
+			Priority:  server.Priority(t.Priority),
+			Response:  server.ResponseFormat(t.Response),
+			Signature: t.Signature.Verifier(now),
+
+			KeepCompressed: t.Compression == config.CompressionKeep,
+			MaxBodyBytes:   t.MaxBodyBytes,
+		}
+		if t.KeyHash.Enabled() {
+			o.KeyHash = server.NewKeyHasher([]byte(t.KeyHash.Pepper))
+		}
+		o.KeyRequired = t.Key.Required
+		if t.CloudEvents.Enabled() {
+			o.CloudEvents = server.CloudEvents{
+				Mode:       server.CloudEventsMode(t.CloudEvents.Mode),
+				Source:     t.CloudEvents.Source,
+				Type:       t.CloudEvents.Type,
+				TypeHeader: t.CloudEvents.TypeHeader,
+			}
+		}
+		opts[name] = o
+	}
+	for name, p := range cfg.CountryPolicies() {
+		o := opts[name]
+		o.Countries = server.CountryPolicy{Allow: p.Allow, Deny: p.Deny}
+		opts[name] = o
+	}
+	for name, nets := range networks {
+		o := opts[name]
+		o.Networks = nets
+		opts[name] = o
+	}
+	for name, up := range upcasters {
+		o := opts[name]
+		o.Upcast = up
+		opts[name] = o
+	}
+	for name, schema := range schemas {
+		o := opts[name]
+		o.Schema = schema
+		opts[name] = o
+	}
+	for name, key := range keys {
+		o := opts[name]
+		o.Key = key
+		opts[name] = o
+	}
+	for name, p := range transforms {
+		o := opts[name]
+		o.Transform = p
+		opts[name] = o
+	}
+	return opts
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/config"
+	"github.com/kahook/internal/kafka"
+	"github.com/kahook/internal/redact"
+	"github.com/kahook/internal/server"
+	"github.com/kahook/internal/spool"
+)
+
+// newReloadable builds the settings a running server can swap on reload:
+// credentials, topics and routes with their options, and rate limits. Its
+// limiters, signature verifiers, and JWT validation read the time from now,
+// the server's clock.
+func newReloadable(cfg *config.Config, logger *zap.Logger, now func() time.Time) (server.Reloadable, error) {
+	users := make(map[string]string)
+	for _, u := range cfg.Auth.Users {
+		users[u.Username] = u.Password
+	}
+	authenticator := auth.NewMultiAuth(users, cfg.Auth.Tokens)
+	if j := cfg.Auth.JWT; j.Enabled() {
+		authenticator = authenticator.WithJWT(auth.NewJWTAuth(auth.JWTConfig{
+			JWKSURL:     j.JWKSURL,
+			Issuer:      j.Issuer,
+			Audience:    j.Audience,
+			Leeway:      time.Duration(j.Leeway) * time.Second,
+			Refresh:     time.Duration(j.RefreshInterval) * time.Second,
+			ScopePrefix: j.ScopePrefix,
+			Logger:      logger,
+			Now:         now,
+		}))
+	}
+	if len(cfg.Auth.Scopes) > 0 || cfg.Auth.DenyUnlisted {
+		authenticator = authenticator.WithScopes(cfg.Auth.Scopes, cfg.Auth.DenyUnlisted)
+		logger.Info("topic scopes enabled", zap.Int("principals", len(cfg.Auth.Scopes)), zap.Bool("deny_unlisted", cfg.Auth.DenyUnlisted))
+	}
+	if authenticator.HasAuth() {
+		if len(users) > 0 {
+			logger.Info("basic auth enabled", zap.Int("users", len(users)))
+		}
+		if len(cfg.Auth.Tokens) > 0 {
+			logger.Info("bearer auth enabled", zap.Int("tokens", len(cfg.Auth.Tokens)))
+		}
+		if j := cfg.Auth.JWT; j.Enabled() {
+			logger.Info("jwt auth enabled", zap.String("jwks_url", j.JWKSURL), zap.String("issuer", j.Issuer))
+		}
+	} else {
+		logger.Warn("no authentication configured")
+	}
+
+	if len(cfg.Server.AllowedTopics) > 0 {
+		logger.Info("topic allowlist enabled", zap.Strings("allowed_topics", cfg.Server.AllowedTopics))
+	}
+	if len(cfg.Routes) > 0 {
+		logger.Info("routes configured", zap.Int("routes", len(cfg.Routes)))
+	}
+
+	rr := cfg.Limits.Requests
+	requestRate := server.RequestRates{
+		Global:    newRequestLimiter(rr.Global, nil, now),
+		Topic:     newRequestLimiter(rr.PerTopic, rr.Topics, now),
+		Principal: newRequestLimiter(rr.PerPrincipal, rr.Principals, now),
+	}
+	if requestRate != (server.RequestRates{}) {
+		logger.Info("request rate limits enabled",
+			zap.Bool("global", requestRate.Global != nil),
+			zap.Bool("per_topic", requestRate.Topic != nil),
+			zap.Bool("per_principal", requestRate.Principal != nil),
+		)
+	}
+
+	bw := cfg.Limits.Bandwidth
+	topicBandwidth := newByteLimiter(bw.PerTopic, bw.Topics, now)
+	principalBandwidth := newByteLimiter(bw.PerPrincipal, bw.Principals, now)
+	if topicBandwidth != nil || principalBandwidth != nil {
+		logger.Info("bandwidth limits enabled",
+			zap.Bool("per_topic", topicBandwidth != nil),
+			zap.Bool("per_principal", principalBandwidth != nil),
+		)
+	}
+
+	upcasters, err := cfg.Upcasters()
+	if err != nil {
+		return server.Reloadable{}, fmt.Errorf("invalid upcast config: %w", err)
+	}
+	for topic := range upcasters {
+		logger.Info("payload upcasting enabled", zap.String("topic", topic))
+	}
+
+	schemas, err := cfg.PayloadSchemas()
+	if err != nil {
+		return server.Reloadable{}, fmt.Errorf("invalid payload schema: %w", err)
+	}
+	for topic := range schemas {
+		logger.Info("payload schema validation enabled", zap.String("topic", topic), zap.String("schema", cfg.Topics[topic].Schema))
+	}
+
+	keys, err := cfg.KeyExtractors()
+	if err != nil {
+		return server.Reloadable{}, fmt.Errorf("invalid key rule: %w", err)
+	}
+
+	transforms, err := cfg.Transforms()
+	if err != nil {
+		return server.Reloadable{}, fmt.Errorf("invalid transforms config: %w", err)
+	}
+	for topic := range transforms {
+		logger.Info("payload transforms enabled", zap.String("topic", topic))
+	}
+
+	networks, err := cfg.RouteNetworks()
+	if err != nil {
+		return server.Reloadable{}, fmt.Errorf("invalid route allowed networks: %w", err)
+	}
+
+	return server.Reloadable{
+		Auth:               authenticator,
+		AllowedTopics:      cfg.Server.AllowedTopics,
+		RequestRate:        requestRate,
+		TopicBandwidth:     topicBandwidth,
+		PrincipalBandwidth: principalBandwidth,
+		Topics:             topicOptions(cfg, upcasters, schemas, keys, transforms, networks, now),
+		RoutePaths:         cfg.RoutePaths(),
+		RouteHeaders:       cfg.RouteHeaders(),
+		AliasedTopics:      cfg.AliasedTopics(),
+	}, nil
+}
+
+// reloader reloads the config file into a running server, on SIGHUP and,
+// when watching, whenever the file's contents change.
+type reloader struct {
+	path     string
+	srv      *server.Server
+	producer *kafka.Swappable
+	scrubber *redact.Scrubber
+	events   *kafka.BrokerEvents
+	spill    *spool.Spool // opened at startup; spill settings need a restart
+	logger   *zap.Logger
+	now      func() time.Time // the server's clock
+
+	mu         sync.Mutex // guards cfg and outcomes, which the admin API and /health read
+	cfg        *config.Config
+	reloadable server.Reloadable
+	sum        [sha256.Size]byte
+	outcomes   server.ReloadStatus
+}
+
+// status reports the reloads applied and failed since startup.
+func (r *reloader) status() server.ReloadStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.outcomes
+}
+
+// failed logs and counts a reload that left the running config in place.
+func (r *reloader) failed(err error, fields ...zap.Field) {
+	r.logger.Error("config reload failed; keeping the running config", append(fields, zap.Error(err))...)
+	now := r.now().UTC()
+	r.mu.Lock()
+	r.outcomes.Failures++
+	r.outcomes.LastFailure, r.outcomes.LastError = &now, err.Error()
+	r.mu.Unlock()
+}
+
+// running returns the config being served.
+func (r *reloader) running() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// effectiveConfig renders the running config, with secrets redacted, as
+// the document its YAML describes.
+func (r *reloader) effectiveConfig() (any, error) {
+	out, err := yaml.Marshal(r.running().Redacted())
+	if err != nil {
+		return nil, err
+	}
+	var doc map[string]any
+	if err := yaml.Unmarshal(out, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// run reloads on every signal from hup and, when the running config
+// watches its file, on every change to it, until ctx is done.
+func (r *reloader) run(ctx context.Context, hup <-chan os.Signal) {
+	r.sum, _ = r.checksum()
+	var poll <-chan time.Time
+	if r.cfg.Reload.Watch {
+		ticker := time.NewTicker(time.Duration(r.cfg.Reload.WatchInterval()) * time.Second)
+		defer ticker.Stop()
+		poll = ticker.C
+		r.logger.Info("watching config file for changes",
+			zap.String("path", r.path),
+			zap.Int("interval", r.cfg.Reload.WatchInterval()),
+		)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			r.logger.Info("reload signal received")
+			r.reload()
+		case <-poll:
+			sum, err := r.checksum()
+			if err != nil || sum == r.sum {
+				continue
+			}
+			r.logger.Info("config file changed", zap.String("path", r.path))
+			r.reload()
+		}
+	}
+}
+
+// checksum hashes the config file's contents.
+func (r *reloader) checksum() ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
+
+// reload loads the config file and applies it. A config that does not
+// load, or whose producer cannot be built, is logged and leaves the running
+// one in place.
+func (r *reloader) reload() {
+	if sum, err := r.checksum(); err == nil {
+		r.sum = sum
+	}
+	next, err := config.Load(r.path)
+	if err != nil {
+		r.failed(err)
+		return
+	}
+	plan := config.PlanReload(r.cfg, next)
+	if len(plan.Changes) == 0 {
+		r.logger.Info("config unchanged")
+		return
+	}
+	for _, c := range plan.Changes {
+		r.logger.Info("config changed", zap.String("change", c.String()))
+	}
+
+	// Until the old producer is closed, its credentials may still be logged.
+	secrets := r.cfg.Secrets()
+	r.scrubber.Set(append(secrets, next.Secrets()...))
+	defer r.scrubber.Set(next.Secrets())
+
+	reloadable, err := newReloadable(next, r.logger, r.now)
+	if err != nil {
+		r.failed(err)
+		return
+	}
+	// Unchanged limits keep their limiters, and with them the tokens each
+	// key has spent.
+	if reflect.DeepEqual(next.Limits.Requests, r.cfg.Limits.Requests) {
+		reloadable.RequestRate = r.reloadable.RequestRate
+	}
+	if reflect.DeepEqual(next.Limits.Bandwidth, r.cfg.Limits.Bandwidth) {
+		reloadable.TopicBandwidth = r.reloadable.TopicBandwidth
+		reloadable.PrincipalBandwidth = r.reloadable.PrincipalBandwidth
+	}
+
+	var producer server.KafkaProducer
+	if plan.RebuildProducer {
+		producer, err = newProducer(next, r.logger, r.events, r.spill)
+		if err != nil {
+			r.failed(err, zap.String("backend", next.Backend))
+			return
+		}
+	}
+
+	r.srv.Reload(reloadable)
+	if producer != nil {
+		r.producer.Swap(producer)
+		r.logger.Info("producer rebuilt", zap.String("backend", next.Backend))
+	}
+	for _, c := range plan.Restart {
+		r.logger.Warn("config change takes effect on restart", zap.String("change", c.String()))
+	}
+	now := r.now().UTC()
+	r.mu.Lock()
+	r.cfg, r.reloadable = next, reloadable
+	r.outcomes.Reloads++
+	r.outcomes.LastReload = &now
+	r.mu.Unlock()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/kahook/internal/config"
+	"github.com/kahook/internal/kafka"
+	"github.com/kahook/internal/redact"
+	"github.com/kahook/internal/server"
+	"github.com/kahook/internal/signature"
+)
+
+// loadConfig writes data to a config file and loads it.
+func loadConfig(t *testing.T, data string) *config.Config {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, data)
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	return cfg
+}
+
+func TestNewReloadable_StripeUsesServerClock(t *testing.T) {
+	cfg := loadConfig(t, "topics:\n  payments:\n    signature:\n      scheme: stripe\n      secret: whsec_test\n      tolerance: 60\n")
+	now := time.Unix(1_700_000_000, 0)
+	reloadable, err := newReloadable(cfg, zap.NewNop(), func() time.Time { return now })
+	if err != nil {
+		t.Fatalf("newReloadable() error = %v", err)
+	}
+	verifier := reloadable.Topics["payments"].Signature
+	if verifier == nil {
+		t.Fatal("payments has no signature verifier")
+	}
+
+	body := []byte(`{"id":"evt_1"}`)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte(ts + "." + string(body)))
+	h := http.Header{"Stripe-Signature": {"t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))}}
+
+	if err := verifier.Verify(h, body); err != nil {
+		t.Fatalf("Verify() at the signing time error = %v", err)
+	}
+	now = now.Add(61 * time.Second)
+	if err := verifier.Verify(h, body); !errors.Is(err, signature.ErrExpired) {
+		t.Errorf("Verify() past the tolerance error = %v, want %v", err, signature.ErrExpired)
+	}
+}
+
+// reloadConfig is a file-backend config with one Basic user, a per-topic
+// request rate, and a per-topic bandwidth limit.
+func reloadConfig(sink, password string, rps int) string {
+	return fmt.Sprintf(`backend: file
+file:
+  path: %s
+auth:
+  type: basic
+  users:
+    - username: alice
+      password: %s
+limits:
+  requests:
+    per_topic:
+      requests_per_second: %d
+  bandwidth:
+    per_topic:
+      bytes_per_second: 1000
+`, sink, password, rps)
+}
+
+// startupProducer stands in for the producer built at startup. Its Close
+// runs onClose, while the reloader is swapping it out.
+type startupProducer struct {
+	closed  int
+	onClose func()
+}
+
+func (p *startupProducer) Produce(context.Context, string, []byte, []byte, map[string]string) error {
+	return nil
+}
+func (p *startupProducer) IsConnected() bool { return true }
+func (p *startupProducer) Close() {
+	p.closed++
+	if p.onClose != nil {
+		p.onClose()
+	}
+}
+
+// newTestReloader starts a reloader on a config file holding data, wired
+// as main wires it, with its logs scrubbed and recorded.
+func newTestReloader(t *testing.T, data string) (*reloader, *startupProducer, *observer.ObservedLogs) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, data)
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	scrubber := redact.NewScrubber(cfg.Secrets())
+	core, logs := observer.New(zap.InfoLevel)
+	logger := zap.New(scrubber.Core(core))
+	now := time.Now
+	reloadable, err := newReloadable(cfg, logger, now)
+	if err != nil {
+		t.Fatalf("newReloadable() error = %v", err)
+	}
+	startup := &startupProducer{}
+	producer := kafka.NewSwappable(startup)
+	t.Cleanup(producer.Close)
+	srv := server.NewServer(server.ServerConfig{
+		Producer: producer,
+		Auth:     reloadable.Auth,
+		Logger:   logger,
+		Now:      now,
+	})
+	srv.Reload(reloadable)
+
+	return &reloader{
+		path:       path,
+		srv:        srv,
+		producer:   producer,
+		scrubber:   scrubber,
+		logger:     logger,
+		now:        now,
+		cfg:        cfg,
+		reloadable: reloadable,
+	}, startup, logs
+}
+
+func writeConfig(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloader_FailedLoadKeepsConfig(t *testing.T) {
+	sink := filepath.Join(t.TempDir(), "sink.jsonl")
+	r, startup, _ := newTestReloader(t, reloadConfig(sink, "first-secret", 10))
+	running := r.running()
+
+	writeConfig(t, r.path, "backend: carrier-pigeon\n")
+	r.reload()
+
+	if r.running() != running {
+		t.Error("a config that does not load replaced the running one")
+	}
+	status := r.status()
+	if status.Failures != 1 || status.Reloads != 0 || status.LastError == "" {
+		t.Errorf("status = %+v, want one failure with its error and no reloads", status)
+	}
+	if startup.closed != 0 {
+		t.Error("a failed reload closed the running producer")
+	}
+	req, _ := http.NewRequest(http.MethodPost, "/orders", nil)
+	req.SetBasicAuth("alice", "first-secret")
+	if !r.reloadable.Auth.Authenticate(req) {
+		t.Error("the running credentials stopped working after a failed reload")
+	}
+}
+
+func TestReloader_KeepsUnchangedLimiters(t *testing.T) {
+	sink := filepath.Join(t.TempDir(), "sink.jsonl")
+	r, _, _ := newTestReloader(t, reloadConfig(sink, "first-secret", 10))
+	requests, topicBandwidth := r.reloadable.RequestRate, r.reloadable.TopicBandwidth
+
+	writeConfig(t, r.path, reloadConfig(sink, "second-secret", 10))
+	r.reload()
+	if r.status().Reloads != 1 {
+		t.Fatalf("status = %+v, want one reload", r.status())
+	}
+	if r.reloadable.RequestRate != requests {
+		t.Error("unchanged request limits got new limiters")
+	}
+	if r.reloadable.TopicBandwidth != topicBandwidth {
+		t.Error("unchanged bandwidth limits got new limiters")
+	}
+
+	writeConfig(t, r.path, reloadConfig(sink, "second-secret", 20))
+	r.reload()
+	if r.reloadable.RequestRate == requests {
+		t.Error("changed request limits kept the old limiters")
+	}
+	if r.reloadable.TopicBandwidth != topicBandwidth {
+		t.Error("unchanged bandwidth limits got new limiters")
+	}
+}
+
+func TestReloader_SwapsProducerOnlyWhenPlanned(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.jsonl"), filepath.Join(dir, "second.jsonl")
+	r, startup, _ := newTestReloader(t, reloadConfig(first, "first-secret", 10))
+
+	writeConfig(t, r.path, reloadConfig(first, "second-secret", 10))
+	r.reload()
+	if startup.closed != 0 {
+		t.Fatal("a reload that only changed credentials rebuilt the producer")
+	}
+
+	writeConfig(t, r.path, reloadConfig(second, "second-secret", 10))
+	r.reload()
+	if startup.closed != 1 {
+		t.Fatalf("startup producer closed %d times after file.path changed, want 1", startup.closed)
+	}
+	if err := r.producer.Produce(context.Background(), "orders", nil, []byte(`{}`), nil); err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+	if data, _ := os.ReadFile(second); len(data) == 0 {
+		t.Error("rebuilt producer did not write to the new file.path")
+	}
+}
+
+func TestReloader_ScrubsOldAndNewSecretsDuringSwap(t *testing.T) {
+	dir := t.TempDir()
+	r, startup, logs := newTestReloader(t, reloadConfig(filepath.Join(dir, "first.jsonl"), "first-secret", 10))
+	startup.onClose = func() {
+		r.logger.Info("closing producer for first-secret, replaced for second-secret")
+	}
+
+	writeConfig(t, r.path, reloadConfig(filepath.Join(dir, "second.jsonl"), "second-secret", 10))
+	r.reload()
+	if startup.closed != 1 {
+		t.Fatalf("startup producer closed %d times, want 1", startup.closed)
+	}
+	closing := logs.FilterMessageSnippet("closing producer").All()
+	if len(closing) != 1 {
+		t.Fatalf("logged %d closing entries, want 1", len(closing))
+	}
+	if msg := closing[0].Message; strings.Contains(msg, "first-secret") || strings.Contains(msg, "second-secret") {
+		t.Errorf("message logged during the swap = %q, want both secrets scrubbed", msg)
+	}
+
+	r.logger.Info("after first-secret and second-secret")
+	after := logs.FilterMessageSnippet("after").All()
+	if msg := after[0].Message; !strings.Contains(msg, "first-secret") || strings.Contains(msg, "second-secret") {
+		t.Errorf("message logged after the reload = %q, want only the new secret scrubbed", msg)
+	}
+}
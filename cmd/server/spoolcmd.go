@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/kahook/internal/config"
+	"github.com/kahook/internal/spool"
+)
+
+const spoolUsage = "usage: kahook spool cat [--config path] file..."
+
+// runSpool implements `kahook spool cat`, which writes spilled segments to
+// stdout decrypted with the configured key, in the file sink format, so they
+// can be inspected or produced again. It returns the process exit code.
+func runSpool(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "cat" {
+		fmt.Fprintln(stderr, spoolUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("spool cat", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("config", getConfigPath(), "config file (default: CONFIG_PATH or the usual locations)")
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(stderr, spoolUsage)
+		return 2
+	}
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	sc, err := cfg.Kafka.Drain.Spool()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	// Reading never writes, so the directory and limits do not matter.
+	sp, err := spool.New(spool.Config{Dir: ".", Key: sc.Key})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	for _, name := range fs.Args() {
+		if err := catSegment(sp, name, stdout); err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", name, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+func catSegment(sp *spool.Spool, name string, w io.Writer) error {
+	r, err := sp.Open(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	_, err = io.Copy(w, r)
+	return err
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/config"
+	"github.com/kahook/internal/kafka"
+)
+
+// preflightTimeout bounds the topic permission check.
+const preflightTimeout = 15 * time.Second
+
+// runValidate implements `kahook validate [--config path] [--probe]`. It
+// loads and validates the configuration and, with --probe, checks that the
+// Kafka principal can write to every configured topic. It returns the process
+// exit code.
+func runValidate(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	path := fs.String("config", getConfigPath(), "config file (default: CONFIG_PATH or the usual locations)")
+	probe := fs.Bool("probe", false, "connect to Kafka and check write permission on configured topics")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.Load(*path)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "config OK (backends: %v)\n", cfg.Backends())
+
+	if !*probe {
+		return 0
+	}
+	if !slices.Contains(cfg.Backends(), config.BackendKafka) {
+		fmt.Fprintln(stdout, "probe skipped: kafka backend not in use")
+		return 0
+	}
+
+	topics := cfg.KafkaTopics()
+	if len(topics) == 0 {
+		fmt.Fprintln(stdout, "probe skipped: no topics configured (set server.allowed_topics)")
+		return 0
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	perms, err := checkWritePermissions(ctx, cfg, topics)
+	if err != nil {
+		fmt.Fprintf(stderr, "probe failed: %v\n", err)
+		return 1
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "TOPIC\tSTATUS\tREASON")
+	for _, p := range perms {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", p.Topic, p.Status, p.Reason)
+	}
+	_ = tw.Flush()
+
+	if len(unwritable(perms)) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkWritePermissions runs the write permission check with the
+// configured Kafka client.
+func checkWritePermissions(ctx context.Context, cfg *config.Config, topics []string) ([]kafka.TopicPermission, error) {
+	if cfg.Kafka.Client == config.KafkaClientNative {
+		return kafka.CheckNativeWritePermissions(ctx, cfg.KafkaConfigMap(), topics)
+	}
+	return kafka.CheckWritePermissions(ctx, cfg.KafkaConfigMap(), topics)
+}
+
+// unwritable returns the topics the check found denied or missing. Topics
+// whose status is unknown are not included: the broker could not answer, which
+// is not evidence of a problem.
+func unwritable(perms []kafka.TopicPermission) []kafka.TopicPermission {
+	var out []kafka.TopicPermission
+	for _, p := range perms {
+		if p.Status == kafka.PermissionDenied || p.Status == kafka.PermissionMissing {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// runPreflight performs the startup permission check selected by
+// kafka.preflight, logging every topic the principal cannot write to. In
+// "fail" mode any such topic, or a check that cannot run, stops startup.
+func runPreflight(cfg *config.Config, logger *zap.Logger) {
+	mode := cfg.Kafka.Preflight
+	if mode == "" || mode == "off" || !slices.Contains(cfg.Backends(), config.BackendKafka) {
+		return
+	}
+
+	topics := cfg.KafkaTopics()
+	if len(topics) == 0 {
+		logger.Warn("kafka preflight skipped: no topics configured")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), preflightTimeout)
+	defer cancel()
+
+	perms, err := checkWritePermissions(ctx, cfg, topics)
+	if err != nil {
+		if mode == "fail" {
+			logger.Fatal("kafka preflight failed", zap.Error(err))
+		}
+		logger.Warn("kafka preflight failed", zap.Error(err))
+		return
+	}
+
+	bad := unwritable(perms)
+	for _, p := range bad {
+		logger.Warn("topic not writable",
+			zap.String("topic", p.Topic),
+			zap.String("status", p.Status),
+			zap.String("reason", p.Reason),
+		)
+	}
+	if len(bad) > 0 && mode == "fail" {
+		logger.Fatal("kafka preflight found unwritable topics", zap.Int("count", len(bad)))
+	}
+	logger.Info("kafka preflight complete",
+		zap.Int("topics", len(perms)),
+		zap.Int("unwritable", len(bad)),
+	)
+}
@@ -0,0 +1,16 @@
+// Package integration holds end-to-end tests that run kahook against a real
+// Kafka broker. They are excluded from the default build and only run with
+// the integration tag:
+//
+//	go test -tags integration ./integration/...
+//
+// TestMain starts a Redpanda container with testcontainers, so Docker must be
+// available. KAHOOK_TEST_BROKERS overrides that with an existing cluster:
+//
+//	make compose-up
+//	KAHOOK_TEST_BROKERS=localhost:9092 go test -tags integration ./integration/...
+//
+// KAHOOK_TEST_CONFIG may point at a kahook config file; its Kafka settings
+// (security, SASL, profile) are then used instead of plain PLAINTEXT, which
+// lets deployments check their own config against their own cluster.
+package integration
@@ -0,0 +1,134 @@
+//go:build integration && cgo
+
+package integration
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	ckafka "github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/config"
+	"github.com/kahook/internal/kafka"
+	"github.com/kahook/internal/server"
+)
+
+// kafkaConfigMap returns the producer settings for the test broker, taken
+// from KAHOOK_TEST_CONFIG when set. The broker TestMain chose always wins
+// for the bootstrap servers.
+func kafkaConfigMap(t *testing.T) map[string]any {
+	t.Helper()
+
+	cfg, err := config.Load(os.Getenv("KAHOOK_TEST_CONFIG"))
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	cm := cfg.KafkaConfigMap()
+	cm["bootstrap.servers"] = brokers
+	return cm
+}
+
+func newKahook(t *testing.T, cm map[string]any) *httptest.Server {
+	t.Helper()
+
+	producer, err := kafka.NewProducer(kafka.ProducerConfig{ConfigMap: cm, Logger: zap.NewNop()})
+	if err != nil {
+		t.Fatalf("create producer: %v", err)
+	}
+	t.Cleanup(producer.Close)
+
+	srv := server.NewServer(server.ServerConfig{
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+	})
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// consume reads one message from topic, starting at the earliest offset.
+func consume(t *testing.T, cm map[string]any, topic string) *ckafka.Message {
+	t.Helper()
+
+	ccm := ckafka.ConfigMap{
+		"group.id":          "kahook-it-" + topic,
+		"auto.offset.reset": "earliest",
+	}
+	for _, k := range []string{"bootstrap.servers", "security.protocol", "sasl.mechanism", "sasl.username", "sasl.password"} {
+		if v, ok := cm[k]; ok {
+			ccm[k] = v
+		}
+	}
+
+	c, err := ckafka.NewConsumer(&ccm)
+	if err != nil {
+		t.Fatalf("create consumer: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Subscribe(topic, nil); err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	msg, err := c.ReadMessage(30 * time.Second)
+	if err != nil {
+		t.Fatalf("read message from %s: %v", topic, err)
+	}
+	return msg
+}
+
+func TestWebhookReachesKafka(t *testing.T) {
+	cm := kafkaConfigMap(t)
+	ts := newKahook(t, cm)
+
+	// Relies on topic auto-creation, which the test broker enables.
+	topic := fmt.Sprintf("kahook-it-%d", time.Now().UnixNano())
+
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/"+topic, strings.NewReader(`{"event":"it"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Key", "order-42")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", resp.StatusCode)
+	}
+
+	msg := consume(t, cm, topic)
+	if string(msg.Key) != "order-42" {
+		t.Errorf("key = %q, want order-42", msg.Key)
+	}
+	if string(msg.Value) != `{"event":"it"}` {
+		t.Errorf("value = %q", msg.Value)
+	}
+}
+
+func TestReadyWithBroker(t *testing.T) {
+	ts := newKahook(t, kafkaConfigMap(t))
+
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		resp, err := http.Get(ts.URL + "/ready")
+		if err != nil {
+			t.Fatalf("GET /ready: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("/ready = %d after 15s, want 200", resp.StatusCode)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
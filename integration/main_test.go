@@ -0,0 +1,51 @@
+//go:build integration && cgo
+
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/redpanda"
+)
+
+// redpandaImage is the broker started when KAHOOK_TEST_BROKERS is unset.
+const redpandaImage = "docker.redpanda.com/redpandadata/redpanda:v23.3.3"
+
+// brokers is the bootstrap address of the broker under test.
+var brokers string
+
+// TestMain starts a Redpanda container for the tests to run against,
+// unless KAHOOK_TEST_BROKERS points them at an existing cluster.
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+func run(m *testing.M) int {
+	if brokers = os.Getenv("KAHOOK_TEST_BROKERS"); brokers != "" {
+		return m.Run()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	// The tests rely on topic auto-creation.
+	container, err := redpanda.Run(ctx, redpandaImage, redpanda.WithAutoCreateTopics())
+	defer func() {
+		if err := testcontainers.TerminateContainer(container); err != nil {
+			fmt.Fprintf(os.Stderr, "terminate redpanda: %v\n", err)
+		}
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "start redpanda: %v\n", err)
+		return 1
+	}
+	if brokers, err = container.KafkaSeedBroker(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "redpanda address: %v\n", err)
+		return 1
+	}
+	return m.Run()
+}
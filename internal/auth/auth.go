@@ -1,8 +1,12 @@
 package auth
 
 import (
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 )
 
@@ -80,12 +84,50 @@ func (a *BearerAuth) Authenticate(r *http.Request) bool {
 	return matched == 1
 }
 
+// Identify authenticates r like Authenticate and returns the token's
+// fingerprint as the principal.
+func (a *BearerAuth) Identify(r *http.Request) (string, bool) {
+	if !a.Authenticate(r) {
+		return "", false
+	}
+	_, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return TokenFingerprint(token), true
+}
+
+// Credentials returns the principal of every configured token.
+func (a *BearerAuth) Credentials() []Credential {
+	creds := make([]Credential, 0, len(a.tokens))
+	for _, t := range a.tokens {
+		creds = append(creds, Credential{Principal: TokenFingerprint(t), Scheme: SchemeBearer})
+	}
+	return creds
+}
+
+// Authentication schemes a Credential can use.
+const (
+	SchemeBasic  = "basic"
+	SchemeBearer = "bearer"
+)
+
+// Credential is a configured credential, identified by the principal it
+// authenticates as (see MultiAuth.Identify) rather than by its secret.
+type Credential struct {
+	Principal string
+	Scheme    string
+}
+
 // MultiAuth auto-detects the authentication scheme from the incoming
-// Authorization header and delegates to BasicAuth or BearerAuth accordingly.
-// If no users and no tokens are configured it allows all requests (like NoneAuth).
+// Authorization header and delegates to BasicAuth, BearerAuth, or JWTAuth
+// accordingly; a bearer token shaped like a JWT goes to JWTAuth when one is
+// configured. If no scheme is configured it allows all requests (like
+// NoneAuth).
 type MultiAuth struct {
 	basic  *BasicAuth  // nil when no users configured
 	bearer *BearerAuth // nil when no tokens configured
+	jwt    *JWTAuth    // nil when JWTs are not accepted
+
+	scopes       map[string]Scope // by principal; see WithScopes
+	denyUnlisted bool             // see WithScopes
 }
 
 // NewMultiAuth creates an auto-detecting authenticator.
@@ -101,43 +143,145 @@ func NewMultiAuth(users map[string]string, tokens []string) *MultiAuth {
 	return m
 }
 
+// WithToken returns a copy of m that also accepts token.
+func (m *MultiAuth) WithToken(token string) *MultiAuth {
+	var tokens []string
+	if m.bearer != nil {
+		tokens = m.bearer.tokens
+	}
+	c := *m
+	c.bearer = NewBearerAuth(append(slices.Clip(tokens), token))
+	return &c
+}
+
+// WithJWT returns a copy of m that also accepts JWTs verified by j.
+func (m *MultiAuth) WithJWT(j *JWTAuth) *MultiAuth {
+	c := *m
+	c.jwt = j
+	return &c
+}
+
+// WithoutToken returns a copy of m that no longer accepts the token with
+// the given fingerprint, and whether m accepted it.
+func (m *MultiAuth) WithoutToken(fingerprint string) (*MultiAuth, bool) {
+	if m.bearer == nil {
+		return m, false
+	}
+	var kept []string
+	for _, t := range m.bearer.tokens {
+		if TokenFingerprint(t) != fingerprint {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == len(m.bearer.tokens) {
+		return m, false
+	}
+	c := *m
+	c.bearer = nil
+	if len(kept) > 0 {
+		c.bearer = NewBearerAuth(kept)
+	}
+	return &c, true
+}
+
 // HasAuth returns true if at least one auth scheme is configured.
 func (m *MultiAuth) HasAuth() bool {
-	return m.basic != nil || m.bearer != nil
+	return m.basic != nil || m.bearer != nil || m.jwt != nil
+}
+
+// Schemes returns the configured schemes, in the order basic, bearer, jwt;
+// none when every request is allowed.
+func (m *MultiAuth) Schemes() []string {
+	var schemes []string
+	if m.basic != nil {
+		schemes = append(schemes, SchemeBasic)
+	}
+	if m.bearer != nil {
+		schemes = append(schemes, SchemeBearer)
+	}
+	if m.jwt != nil {
+		schemes = append(schemes, SchemeJWT)
+	}
+	return schemes
+}
+
+// Credentials returns every configured user and token, sorted by principal.
+func (m *MultiAuth) Credentials() []Credential {
+	var creds []Credential
+	if m.basic != nil {
+		for username := range m.basic.users {
+			creds = append(creds, Credential{Principal: username, Scheme: SchemeBasic})
+		}
+	}
+	if m.bearer != nil {
+		creds = append(creds, m.bearer.Credentials()...)
+	}
+	sort.Slice(creds, func(i, j int) bool { return creds[i].Principal < creds[j].Principal })
+	return creds
 }
 
 // Authenticate inspects the Authorization header scheme and delegates.
 // - No auth configured → allow everything.
 // - "Basic ..." → delegate to BasicAuth (if configured).
-// - "Bearer ..." → delegate to BearerAuth (if configured).
+// - "Bearer ..." → delegate to JWTAuth or BearerAuth (if configured).
 // - Missing/unrecognised header → reject when any auth is configured.
 func (m *MultiAuth) Authenticate(r *http.Request) bool {
+	_, ok := m.Identify(r)
+	return ok
+}
+
+// Identify authenticates r like Authenticate and additionally returns the
+// principal the request authenticated as: the username for Basic, a token
+// fingerprint for Bearer, or "jwt:" and the subject for a JWT (see
+// JWTSubject). The principal is empty when no auth is configured.
+func (m *MultiAuth) Identify(r *http.Request) (string, bool) {
+	principal, _, ok := m.identify(r)
+	return principal, ok
+}
+
+// identify is Identify, also returning the scopes a JWT carries.
+func (m *MultiAuth) identify(r *http.Request) (string, Scope, bool) {
 	if !m.HasAuth() {
-		return true
+		return "", Scope{}, true
 	}
 
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return false
+		return "", Scope{}, false
 	}
 
 	parts := strings.SplitN(authHeader, " ", 2)
 	if len(parts) != 2 {
-		return false
+		return "", Scope{}, false
 	}
 
 	switch strings.ToLower(parts[0]) {
 	case "basic":
-		if m.basic != nil {
-			return m.basic.Authenticate(r)
+		if m.basic != nil && m.basic.Authenticate(r) {
+			username, _, _ := r.BasicAuth()
+			return username, Scope{}, true
 		}
-		return false
+		return "", Scope{}, false
 	case "bearer":
-		if m.bearer != nil {
-			return m.bearer.Authenticate(r)
+		if m.jwt != nil && isJWT(parts[1]) {
+			c, err := m.jwt.verify(parts[1])
+			if err != nil {
+				return "", Scope{}, false
+			}
+			return jwtPrincipalPrefix + c.Subject, m.jwt.scope(c), true
 		}
-		return false
+		if m.bearer != nil && m.bearer.Authenticate(r) {
+			return TokenFingerprint(parts[1]), Scope{}, true
+		}
+		return "", Scope{}, false
 	default:
-		return false
+		return "", Scope{}, false
 	}
 }
+
+// TokenFingerprint returns a short, non-reversible identifier for a bearer
+// token, safe to use in logs, metrics, and rate-limit keys.
+func TokenFingerprint(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return "token:" + hex.EncodeToString(sum[:4])
+}
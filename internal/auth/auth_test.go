@@ -3,6 +3,7 @@ package auth
 import (
 	"context"
 	"net/http"
+	"reflect"
 	"testing"
 )
 
@@ -268,3 +269,114 @@ func TestMultiAuth_Both(t *testing.T) {
 		t.Error("Should reject request with no Authorization header")
 	}
 }
+
+func TestMultiAuth_Identify(t *testing.T) {
+	m := NewMultiAuth(map[string]string{"alice": "pw"}, []string{"tok"})
+
+	req := newRequest("POST", "/test")
+	req.SetBasicAuth("alice", "pw")
+	if p, ok := m.Identify(req); !ok || p != "alice" {
+		t.Errorf("basic Identify = (%q, %v), want (alice, true)", p, ok)
+	}
+
+	req = newRequest("POST", "/test")
+	req.Header.Set("Authorization", "Bearer tok")
+	p, ok := m.Identify(req)
+	if !ok || p != TokenFingerprint("tok") {
+		t.Errorf("bearer Identify = (%q, %v), want (%q, true)", p, ok, TokenFingerprint("tok"))
+	}
+
+	req = newRequest("POST", "/test")
+	req.Header.Set("Authorization", "Bearer wrong")
+	if p, ok := m.Identify(req); ok || p != "" {
+		t.Errorf("invalid token Identify = (%q, %v), want (\"\", false)", p, ok)
+	}
+}
+
+func TestMultiAuth_Credentials(t *testing.T) {
+	m := NewMultiAuth(map[string]string{"bob": "pw", "alice": "pw"}, []string{"tok"})
+
+	got := m.Credentials()
+	want := []Credential{
+		{Principal: "alice", Scheme: SchemeBasic},
+		{Principal: "bob", Scheme: SchemeBasic},
+		{Principal: TokenFingerprint("tok"), Scheme: SchemeBearer},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Credentials() = %v, want %v", got, want)
+	}
+	if creds := NewMultiAuth(nil, nil).Credentials(); len(creds) != 0 {
+		t.Errorf("Credentials() without auth = %v, want none", creds)
+	}
+}
+
+func TestMultiAuth_Schemes(t *testing.T) {
+	for _, tc := range []struct {
+		users  map[string]string
+		tokens []string
+		want   []string
+	}{
+		{nil, nil, nil},
+		{map[string]string{"alice": "pw"}, nil, []string{SchemeBasic}},
+		{nil, []string{"tok"}, []string{SchemeBearer}},
+		{map[string]string{"alice": "pw"}, []string{"tok"}, []string{SchemeBasic, SchemeBearer}},
+	} {
+		if got := NewMultiAuth(tc.users, tc.tokens).Schemes(); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Schemes() = %v, want %v", got, tc.want)
+		}
+	}
+}
+
+func TestBearerAuth_Identify(t *testing.T) {
+	a := NewBearerAuth([]string{"tok"})
+
+	req := newRequest("GET", "/metrics")
+	req.Header.Set("Authorization", "Bearer tok")
+	if p, ok := a.Identify(req); !ok || p != TokenFingerprint("tok") {
+		t.Errorf("Identify = (%q, %v), want (%q, true)", p, ok, TokenFingerprint("tok"))
+	}
+
+	req.Header.Set("Authorization", "Bearer nope")
+	if _, ok := a.Identify(req); ok {
+		t.Error("Identify accepted an unknown token")
+	}
+}
+
+func TestTokenFingerprint_Stable(t *testing.T) {
+	if TokenFingerprint("abc") != TokenFingerprint("abc") {
+		t.Error("fingerprint should be deterministic")
+	}
+	if TokenFingerprint("abc") == TokenFingerprint("abd") {
+		t.Error("different tokens should have different fingerprints")
+	}
+}
+
+func TestMultiAuth_WithToken(t *testing.T) {
+	m := NewMultiAuth(map[string]string{"alice": "pw"}, []string{"old"})
+	bearer := func(a *MultiAuth, token string) bool {
+		req := newRequest("POST", "/test")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return a.Authenticate(req)
+	}
+
+	rotated := m.WithToken("new")
+	if !bearer(rotated, "old") || !bearer(rotated, "new") {
+		t.Error("WithToken should accept the added token alongside the others")
+	}
+	if bearer(m, "new") {
+		t.Error("WithToken changed the original")
+	}
+
+	rotated, ok := rotated.WithoutToken(TokenFingerprint("old"))
+	if !ok || bearer(rotated, "old") || !bearer(rotated, "new") {
+		t.Errorf("WithoutToken(old) = %v, want only the new token accepted", ok)
+	}
+	if _, ok := rotated.WithoutToken(TokenFingerprint("old")); ok {
+		t.Error("WithoutToken removed an unknown token")
+	}
+
+	basicOnly, _ := rotated.WithoutToken(TokenFingerprint("new"))
+	if !reflect.DeepEqual(basicOnly.Schemes(), []string{SchemeBasic}) {
+		t.Errorf("Schemes() = %v after removing every token, want basic only", basicOnly.Schemes())
+	}
+}
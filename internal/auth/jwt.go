@@ -0,0 +1,350 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/jws"
+)
+
+// SchemeJWT is the scheme of requests authenticated by a JWT bearer token.
+const SchemeJWT = "jwt"
+
+// jwtPrincipalPrefix starts the principal of a JWT-authenticated request,
+// so a subject never collides with a username or token fingerprint.
+const jwtPrincipalPrefix = "jwt:"
+
+const (
+	// defaultJWKSRefresh is how long fetched keys are used before the key
+	// set is fetched again.
+	defaultJWKSRefresh = time.Hour
+	// jwksRetry is the least time between two fetches of the key set, so a
+	// token with an unknown kid, or an unreachable JWKS URL, cannot make
+	// every request fetch it.
+	jwksRetry = 30 * time.Second
+	// jwksTimeout bounds a fetch of the key set.
+	jwksTimeout = 10 * time.Second
+	// maxJWKSBytes is the largest key set read.
+	maxJWKSBytes = 1 << 20
+)
+
+// jwtAlgorithms are the signing algorithms JWTAuth accepts. Tokens must be
+// signed with a key pair; "none" and HMAC algorithms are always refused.
+var jwtAlgorithms = map[string]bool{"RS256": true, "ES256": true}
+
+// Errors returned by JWTAuth.Verify.
+var (
+	ErrTokenMalformed = errors.New("malformed JWT")
+	ErrTokenKey       = errors.New("JWT is not signed by a known key")
+	ErrTokenExpired   = errors.New("JWT has expired")
+	ErrTokenClaims    = errors.New("JWT claims are not accepted")
+)
+
+// JWTConfig configures a JWTAuth.
+type JWTConfig struct {
+	// JWKSURL is where the key set tokens are verified with is fetched.
+	JWKSURL string
+	// Issuer must equal the iss claim, and Audience include a value of the
+	// aud claim. Without them no token is accepted.
+	Issuer   string
+	Audience []string
+	// Leeway is the clock skew allowed when checking exp and nbf.
+	Leeway time.Duration
+	// Refresh is how long fetched keys are used before the key set is
+	// fetched again; zero means an hour. A token signed by a key not in the
+	// set also fetches it again, at most every 30 seconds.
+	Refresh time.Duration
+	// ScopePrefix, if set, makes the token's scopes (the space-separated
+	// scope claim, or the scp array) that start with it name the topics the
+	// token may publish to, as patterns for NewScope. A token with none may
+	// publish to no topic.
+	ScopePrefix string
+
+	Client *http.Client // nil means a client with a 10 second timeout
+	Logger *zap.Logger  // nil means no logging
+	Now    func() time.Time
+}
+
+// JWTAuth validates bearer tokens that are JWTs signed with RS256 or ES256,
+// against keys fetched from a JWKS URL. A token is accepted when its
+// signature verifies, it has not expired, and its iss and aud claims match
+// those configured; it authenticates as its sub claim.
+//
+// Keys are fetched when first needed and again once stale, rather than by a
+// background loop, so a JWTAuth replaced by a reload needs no stopping. One
+// fetch runs at a time, without holding the lock: tokens signed by a cached
+// key are verified with it meanwhile, and only those that need the fetched
+// set wait for it. If a fetch fails the keys already fetched are kept.
+type JWTAuth struct {
+	cfg JWTConfig
+
+	mu         sync.Mutex
+	keys       map[string]crypto.PublicKey
+	fetched    time.Time     // when keys were fetched
+	attempted  time.Time     // when the last fetch started
+	refreshing chan struct{} // closed when the fetch in flight ends; nil if none
+}
+
+// NewJWTAuth returns a JWTAuth for cfg.
+func NewJWTAuth(cfg JWTConfig) *JWTAuth {
+	if cfg.Refresh <= 0 {
+		cfg.Refresh = defaultJWKSRefresh
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: jwksTimeout}
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	return &JWTAuth{cfg: cfg}
+}
+
+func (a *JWTAuth) Authenticate(r *http.Request) bool {
+	_, ok := a.Identify(r)
+	return ok
+}
+
+// Identify authenticates r like Authenticate and returns the principal for
+// the token's subject (see JWTSubject).
+func (a *JWTAuth) Identify(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || strings.ToLower(scheme) != "bearer" {
+		return "", false
+	}
+	subject, err := a.Verify(token)
+	if err != nil {
+		return "", false
+	}
+	return jwtPrincipalPrefix + subject, true
+}
+
+// JWTSubject returns the subject of a principal a JWT authenticated as.
+func JWTSubject(principal string) (string, bool) {
+	return strings.CutPrefix(principal, jwtPrincipalPrefix)
+}
+
+// isJWT reports whether a bearer token is shaped like a JWT, rather than
+// being an opaque token.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// jwtHeader is the part of a JOSE header JWTAuth reads.
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwtClaims are the registered claims JWTAuth checks. Times are NumericDate
+// values: seconds since the epoch, possibly fractional.
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	Scope     string          `json:"scope"`
+	Scopes    []string        `json:"scp"`
+}
+
+// audiences returns the aud claim, which is a string or an array of them.
+func (c jwtClaims) audiences() []string {
+	var one string
+	if json.Unmarshal(c.Audience, &one) == nil {
+		return []string{one}
+	}
+	var many []string
+	_ = json.Unmarshal(c.Audience, &many)
+	return many
+}
+
+// Verify checks a JWT and returns its subject.
+func (a *JWTAuth) Verify(token string) (string, error) {
+	c, err := a.verify(token)
+	if err != nil {
+		return "", err
+	}
+	return c.Subject, nil
+}
+
+// verify checks a JWT and returns its claims.
+func (a *JWTAuth) verify(token string) (jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, ErrTokenMalformed
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return jwtClaims{}, ErrTokenMalformed
+	}
+	var h jwtHeader
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return jwtClaims{}, ErrTokenMalformed
+	}
+	if !jwtAlgorithms[h.Algorithm] {
+		return jwtClaims{}, fmt.Errorf("%w: algorithm %q is not accepted", ErrTokenMalformed, h.Algorithm)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return jwtClaims{}, ErrTokenMalformed
+	}
+
+	// A JWT is a JWS whose payload is the claims, so it verifies as the
+	// detached signature of its decoded payload.
+	verified := false
+	for _, key := range a.signingKeys(h.KeyID) {
+		if _, err := jws.Verify(parts[0]+".."+parts[2], payload, key); err == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return jwtClaims{}, ErrTokenKey
+	}
+
+	var c jwtClaims
+	if err := json.Unmarshal(payload, &c); err != nil {
+		return jwtClaims{}, ErrTokenMalformed
+	}
+	if err := a.checkClaims(c); err != nil {
+		return jwtClaims{}, err
+	}
+	return c, nil
+}
+
+// scope returns the topics a token with claims c may publish to:
+// unrestricted unless ScopePrefix is set.
+func (a *JWTAuth) scope(c jwtClaims) Scope {
+	if a.cfg.ScopePrefix == "" {
+		return Scope{}
+	}
+	var patterns []string
+	for _, s := range append(strings.Fields(c.Scope), c.Scopes...) {
+		if topic, ok := strings.CutPrefix(s, a.cfg.ScopePrefix); ok && topic != "" {
+			patterns = append(patterns, topic)
+		}
+	}
+	return NewScope(patterns)
+}
+
+// checkClaims checks a verified token's claims.
+func (a *JWTAuth) checkClaims(c jwtClaims) error {
+	now := a.cfg.Now()
+	if c.ExpiresAt == nil {
+		return fmt.Errorf("%w: no exp claim", ErrTokenClaims)
+	}
+	if now.After(numericDate(*c.ExpiresAt).Add(a.cfg.Leeway)) {
+		return ErrTokenExpired
+	}
+	if c.NotBefore != nil && now.Add(a.cfg.Leeway).Before(numericDate(*c.NotBefore)) {
+		return fmt.Errorf("%w: not valid before %s", ErrTokenClaims, numericDate(*c.NotBefore).UTC().Format(time.RFC3339))
+	}
+	if a.cfg.Issuer == "" || c.Issuer != a.cfg.Issuer {
+		return fmt.Errorf("%w: issuer %q", ErrTokenClaims, c.Issuer)
+	}
+	if !slices.ContainsFunc(c.audiences(), func(aud string) bool {
+		return slices.Contains(a.cfg.Audience, aud)
+	}) {
+		return fmt.Errorf("%w: audience does not match", ErrTokenClaims)
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("%w: no sub claim", ErrTokenClaims)
+	}
+	return nil
+}
+
+func numericDate(seconds float64) time.Time {
+	whole, frac := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(frac*float64(time.Second)))
+}
+
+// signingKeys returns the keys a token with kid may be signed by: that key,
+// or every key when the token names none. The key set is fetched again if
+// it is stale or lacks kid; the caller waits for that only when it has no
+// key to try meanwhile.
+func (a *JWTAuth) signingKeys(kid string) []crypto.PublicKey {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := a.cfg.Now()
+	_, known := a.keys[kid]
+	stale := a.keys == nil || now.Sub(a.fetched) >= a.cfg.Refresh
+	if (stale || kid != "" && !known) && a.refreshing == nil && (a.attempted.IsZero() || now.Sub(a.attempted) >= jwksRetry) {
+		a.attempted = now
+		a.refreshing = make(chan struct{})
+		go a.refresh(now, a.refreshing)
+	}
+	if wait := a.refreshing; wait != nil && (a.keys == nil || kid != "" && !known) {
+		a.mu.Unlock()
+		<-wait
+		a.mu.Lock()
+	}
+
+	if kid != "" {
+		if key, ok := a.keys[kid]; ok {
+			return []crypto.PublicKey{key}
+		}
+		return nil
+	}
+	keys := make([]crypto.PublicKey, 0, len(a.keys))
+	for _, key := range a.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// refresh fetches the key set, started at now, and closes done once the
+// keys are replaced or the fetch has failed.
+func (a *JWTAuth) refresh(now time.Time, done chan struct{}) {
+	keys, err := a.fetch()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err != nil {
+		a.cfg.Logger.Warn("failed to fetch JWKS; using the keys already fetched",
+			zap.String("url", a.cfg.JWKSURL), zap.Int("keys", len(a.keys)), zap.Error(err))
+	} else {
+		a.keys, a.fetched = keys, now
+	}
+	a.refreshing = nil
+	close(done)
+}
+
+// fetch fetches and parses the key set.
+func (a *JWTAuth) fetch() (map[string]crypto.PublicKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, a.cfg.JWKSURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := a.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS URL returned %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+	if err != nil {
+		return nil, err
+	}
+	return jws.ParseJWKS(body)
+}
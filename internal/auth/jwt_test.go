@@ -0,0 +1,283 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kahook/internal/jws"
+)
+
+// issuer serves a JWKS and signs tokens with its keys.
+type issuer struct {
+	t       *testing.T
+	signers map[string]*jws.Signer // by kid
+	mu      sync.Mutex
+	served  []string      // kids in the served key set
+	stall   chan struct{} // if set, fetches wait until it is closed
+	fetches atomic.Int32
+	srv     *httptest.Server
+}
+
+func newIssuer(t *testing.T) *issuer {
+	t.Helper()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	is := &issuer{t: t, signers: map[string]*jws.Signer{}, served: []string{"rsa", "ec"}}
+	for kid, key := range map[string]crypto.Signer{"rsa": rsaKey, "ec": ecKey, "other": mustRSA(t)} {
+		der, _ := x509.MarshalPKCS8PrivateKey(key)
+		s, err := jws.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), kid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		is.signers[kid] = s
+	}
+	is.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		is.fetches.Add(1)
+		is.mu.Lock()
+		stall := is.stall
+		is.mu.Unlock()
+		if stall != nil {
+			<-stall
+		}
+		is.mu.Lock()
+		defer is.mu.Unlock()
+		var keys []map[string]string
+		for _, kid := range is.served {
+			k, _ := jws.JWK(is.signers[kid].Public())
+			k["kid"] = kid
+			keys = append(keys, k)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	}))
+	t.Cleanup(is.srv.Close)
+	return is
+}
+
+func mustRSA(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// token returns a JWT with claims signed by the key kid.
+func (is *issuer) token(kid string, claims map[string]any) string {
+	is.t.Helper()
+	payload, _ := json.Marshal(claims)
+	sig, err := is.signers[kid].Sign(payload)
+	if err != nil {
+		is.t.Fatal(err)
+	}
+	header, signature, _ := strings.Cut(sig, "..")
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + signature
+}
+
+var jwtNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss": "https://idp.example.com",
+		"aud": []string{"other", "kahook"},
+		"sub": "svc-orders",
+		"exp": jwtNow.Add(time.Hour).Unix(),
+	}
+}
+
+func (is *issuer) auth() *JWTAuth {
+	return NewJWTAuth(JWTConfig{
+		JWKSURL:  is.srv.URL,
+		Issuer:   "https://idp.example.com",
+		Audience: []string{"kahook"},
+		Leeway:   time.Minute,
+		Now:      func() time.Time { return jwtNow },
+	})
+}
+
+func TestJWTAuth_Verify(t *testing.T) {
+	is := newIssuer(t)
+	a := is.auth()
+	with := func(name string, v any) map[string]any {
+		c := validClaims()
+		if v == nil {
+			delete(c, name)
+		} else {
+			c[name] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"RS256", is.token("rsa", validClaims()), nil},
+		{"ES256", is.token("ec", validClaims()), nil},
+		{"single audience", is.token("rsa", with("aud", "kahook")), nil},
+		{"expired within leeway", is.token("rsa", with("exp", jwtNow.Add(-30*time.Second).Unix())), nil},
+		{"expired", is.token("rsa", with("exp", jwtNow.Add(-2*time.Minute).Unix())), ErrTokenExpired},
+		{"no exp", is.token("rsa", with("exp", nil)), ErrTokenClaims},
+		{"not yet valid", is.token("rsa", with("nbf", jwtNow.Add(time.Hour).Unix())), ErrTokenClaims},
+		{"wrong issuer", is.token("rsa", with("iss", "https://evil.example.com")), ErrTokenClaims},
+		{"wrong audience", is.token("rsa", with("aud", "someone-else")), ErrTokenClaims},
+		{"no subject", is.token("rsa", with("sub", nil)), ErrTokenClaims},
+		{"unknown key", is.token("other", validClaims()), ErrTokenKey},
+		{"not a JWT", "abc.def", ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		sub, err := a.Verify(tt.token)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr == nil && sub != "svc-orders" {
+			t.Errorf("%s: Verify() subject = %q, want svc-orders", tt.name, sub)
+		}
+	}
+}
+
+func TestJWTAuth_RejectsUnsignedAndTampered(t *testing.T) {
+	is := newIssuer(t)
+	a := is.auth()
+	enc := base64.RawURLEncoding.EncodeToString
+
+	claims, _ := json.Marshal(validClaims())
+	none := enc([]byte(`{"alg":"none"}`)) + "." + enc(claims) + "."
+	if _, err := a.Verify(none); err == nil {
+		t.Error("Verify() accepted an unsigned token")
+	}
+
+	parts := strings.Split(is.token("rsa", validClaims()), ".")
+	forged := validClaims()
+	forged["sub"] = "admin"
+	body, _ := json.Marshal(forged)
+	if _, err := a.Verify(parts[0] + "." + enc(body) + "." + parts[2]); !errors.Is(err, ErrTokenKey) {
+		t.Errorf("Verify() of a tampered token error = %v, want ErrTokenKey", err)
+	}
+}
+
+func TestJWTAuth_RefreshesKeys(t *testing.T) {
+	is := newIssuer(t)
+	now := jwtNow
+	a := NewJWTAuth(JWTConfig{JWKSURL: is.srv.URL, Issuer: "https://idp.example.com", Audience: []string{"kahook"}, Refresh: 10 * time.Minute, Now: func() time.Time { return now }})
+
+	for i := 0; i < 3; i++ {
+		if _, err := a.Verify(is.token("rsa", validClaims())); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := is.fetches.Load(); n != 1 {
+		t.Errorf("fetched the key set %d times for one kid, want once", n)
+	}
+
+	// A key added to the set is fetched when a token uses it, but an unknown
+	// kid does not fetch again until the retry interval has passed.
+	is.mu.Lock()
+	is.served = append(is.served, "other")
+	is.mu.Unlock()
+	if _, err := a.Verify(is.token("other", validClaims())); !errors.Is(err, ErrTokenKey) {
+		t.Errorf("Verify() with a new kid right after a fetch = %v, want ErrTokenKey", err)
+	}
+	now = now.Add(jwksRetry)
+	if _, err := a.Verify(is.token("other", validClaims())); err != nil {
+		t.Errorf("Verify() with a new kid after the retry interval: %v", err)
+	}
+
+	// Keys are kept when the JWKS URL fails.
+	is.srv.Close()
+	now = now.Add(20 * time.Minute)
+	if _, err := a.Verify(is.token("rsa", validClaims())); err != nil {
+		t.Errorf("Verify() after a failed refresh: %v", err)
+	}
+}
+
+func TestJWTAuth_VerifiesWhileRefreshing(t *testing.T) {
+	is := newIssuer(t)
+	var mu sync.Mutex
+	now := jwtNow
+	a := NewJWTAuth(JWTConfig{JWKSURL: is.srv.URL, Issuer: "https://idp.example.com", Audience: []string{"kahook"}, Refresh: 10 * time.Minute, Now: func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	}})
+	if _, err := a.Verify(is.token("rsa", validClaims())); err != nil {
+		t.Fatal(err)
+	}
+
+	// The keys go stale and the JWKS URL hangs: tokens signed by a cached
+	// key are still verified, without waiting for the fetch.
+	stall := make(chan struct{})
+	is.mu.Lock()
+	is.stall = stall
+	is.mu.Unlock()
+	t.Cleanup(func() { close(stall) })
+	mu.Lock()
+	now = now.Add(20 * time.Minute)
+	mu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.Verify(is.token("rsa", validClaims()))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Verify() during a refresh: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Verify() waited for the key set fetch")
+	}
+}
+
+func TestMultiAuth_JWT(t *testing.T) {
+	is := newIssuer(t)
+	m := NewMultiAuth(nil, []string{"static"}).WithJWT(is.auth())
+	identify := func(token string) (string, bool) {
+		req := newRequest("POST", "/test")
+		req.Header.Set("Authorization", "Bearer "+token)
+		return m.Identify(req)
+	}
+
+	p, ok := identify(is.token("ec", validClaims()))
+	if !ok || p != "jwt:svc-orders" {
+		t.Errorf("JWT Identify = (%q, %v), want (jwt:svc-orders, true)", p, ok)
+	}
+	if sub, ok := JWTSubject(p); !ok || sub != "svc-orders" {
+		t.Errorf("JWTSubject(%q) = (%q, %v)", p, sub, ok)
+	}
+	if p, ok := identify("static"); !ok || p != TokenFingerprint("static") {
+		t.Errorf("opaque token Identify = (%q, %v), want its fingerprint", p, ok)
+	}
+	if _, ok := identify(is.token("other", validClaims())); ok {
+		t.Error("Identify accepted a JWT signed by an unknown key")
+	}
+	if got := m.Schemes(); len(got) != 2 || got[1] != SchemeJWT {
+		t.Errorf("Schemes() = %v, want bearer and jwt", got)
+	}
+	if _, ok := JWTSubject(TokenFingerprint("static")); ok {
+		t.Error("JWTSubject accepted a token fingerprint")
+	}
+
+	rotated, _ := m.WithToken("new").WithoutToken(TokenFingerprint("static"))
+	if !rotated.HasAuth() || rotated.jwt == nil {
+		t.Error("token rotation dropped JWT authentication")
+	}
+}
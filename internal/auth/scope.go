@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Scope is the set of topics a principal may publish to, as topic names
+// and prefixes ending in "*"; "*" alone is every topic. The zero Scope is
+// unrestricted.
+type Scope struct {
+	restricted bool
+	topics     map[string]bool
+	prefixes   []string
+}
+
+// NewScope returns the Scope of patterns. An empty list allows no topic.
+func NewScope(patterns []string) Scope {
+	s := Scope{restricted: true, topics: make(map[string]bool, len(patterns))}
+	for _, p := range patterns {
+		if p == "*" {
+			return Scope{}
+		}
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			s.prefixes = append(s.prefixes, prefix)
+			continue
+		}
+		s.topics[p] = true
+	}
+	return s
+}
+
+// Restricted reports whether s limits the topics published to.
+func (s Scope) Restricted() bool {
+	return s.restricted
+}
+
+// Allows reports whether topic is in s.
+func (s Scope) Allows(topic string) bool {
+	if !s.restricted || s.topics[topic] {
+		return true
+	}
+	for _, p := range s.prefixes {
+		if strings.HasPrefix(topic, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithScopes returns a copy of m that restricts each principal in scopes to
+// its topic patterns (see NewScope). Principals not listed are
+// unrestricted, unless they authenticated with a JWT that carries scopes,
+// or denyUnlisted is set, in which case they may publish to no topic.
+func (m *MultiAuth) WithScopes(scopes map[string][]string, denyUnlisted bool) *MultiAuth {
+	c := *m
+	c.scopes = make(map[string]Scope, len(scopes))
+	for principal, patterns := range scopes {
+		c.scopes[principal] = NewScope(patterns)
+	}
+	c.denyUnlisted = denyUnlisted
+	return &c
+}
+
+// Authorize authenticates r like Identify and returns the Scope of topics
+// its principal may publish to: the one configured for the principal, or
+// for a JWT without one, that of the token's scope claim when JWTAuth reads
+// scopes. Other principals are unrestricted, or allowed no topic when m
+// denies unlisted principals.
+func (m *MultiAuth) Authorize(r *http.Request) (string, Scope, bool) {
+	principal, scope, ok := m.identify(r)
+	if !ok {
+		return "", Scope{}, false
+	}
+	if s, listed := m.scopes[principal]; listed {
+		return principal, s, true
+	}
+	if m.denyUnlisted && !scope.Restricted() {
+		return principal, NewScope(nil), true
+	}
+	return principal, scope, true
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestScope_Allows(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		topic    string
+		want     bool
+	}{
+		{[]string{"orders"}, "orders", true},
+		{[]string{"orders"}, "orders.eu", false},
+		{[]string{"billing.*"}, "billing.invoices", true},
+		{[]string{"billing.*"}, "billingx", false},
+		{[]string{"orders", "*"}, "anything", true},
+		{nil, "orders", false},
+	}
+	for _, tt := range tests {
+		if got := NewScope(tt.patterns).Allows(tt.topic); got != tt.want {
+			t.Errorf("NewScope(%q).Allows(%q) = %v, want %v", tt.patterns, tt.topic, got, tt.want)
+		}
+	}
+	if (Scope{}).Restricted() || !(Scope{}).Allows("orders") {
+		t.Error("the zero Scope should allow every topic")
+	}
+}
+
+func TestMultiAuth_Authorize(t *testing.T) {
+	is := newIssuer(t)
+	j := is.auth()
+	j.cfg.ScopePrefix = "publish:"
+	m := NewMultiAuth(map[string]string{"alice": "pw", "bob": "pw"}, []string{"tok"}).
+		WithJWT(j).
+		WithScopes(map[string][]string{
+			"alice":                 {"orders"},
+			TokenFingerprint("tok"): {"telemetry.*"},
+			"jwt:svc-pinned":        {"audit"},
+		}, false)
+	authorize := func(header string) Scope {
+		t.Helper()
+		req := newRequest("POST", "/test")
+		req.Header.Set("Authorization", header)
+		_, s, ok := m.Authorize(req)
+		if !ok {
+			t.Fatalf("Authorize(%s) rejected valid credentials", header)
+		}
+		return s
+	}
+	basic := func(user string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":pw"))
+	}
+	jwt := func(sub, scope string) string {
+		c := validClaims()
+		c["sub"], c["scope"] = sub, scope
+		return "Bearer " + is.token("rsa", c)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		allowed []string
+		denied  []string
+	}{
+		{"listed user", basic("alice"), []string{"orders"}, []string{"billing"}},
+		{"unlisted user", basic("bob"), []string{"orders", "billing"}, nil},
+		{"listed token", "Bearer tok", []string{"telemetry.cpu"}, []string{"orders"}},
+		{"jwt scopes", jwt("svc-orders", "openid publish:orders publish:billing.*"), []string{"orders", "billing.eu"}, []string{"audit"}},
+		{"jwt without scopes", jwt("svc-orders", "openid"), nil, []string{"orders"}},
+		{"listed jwt subject", jwt("svc-pinned", "publish:orders"), []string{"audit"}, []string{"orders"}},
+	}
+	for _, tt := range tests {
+		s := authorize(tt.header)
+		for _, topic := range tt.allowed {
+			if !s.Allows(topic) {
+				t.Errorf("%s: %q denied, want allowed", tt.name, topic)
+			}
+		}
+		for _, topic := range tt.denied {
+			if s.Allows(topic) {
+				t.Errorf("%s: %q allowed, want denied", tt.name, topic)
+			}
+		}
+	}
+
+	// Denying unlisted principals leaves listed ones and JWT scopes alone.
+	closed := m.WithScopes(map[string][]string{"alice": {"orders"}}, true)
+	for _, tt := range []struct {
+		header string
+		topic  string
+		want   bool
+	}{
+		{basic("alice"), "orders", true},
+		{basic("bob"), "orders", false},
+		{"Bearer tok", "telemetry.cpu", false},
+		{jwt("svc-orders", "publish:orders"), "orders", true},
+	} {
+		req := newRequest("POST", "/test")
+		req.Header.Set("Authorization", tt.header)
+		if _, s, ok := closed.Authorize(req); !ok || s.Allows(tt.topic) != tt.want {
+			t.Errorf("deny unlisted: Authorize(%s).Allows(%q) = %v, want %v", tt.header, tt.topic, s.Allows(tt.topic), tt.want)
+		}
+	}
+
+	// Scopes survive token rotation.
+	rotated := m.WithToken("new")
+	req := newRequest("POST", "/test")
+	req.SetBasicAuth("alice", "pw")
+	if _, s, _ := rotated.Authorize(req); s.Allows("billing") {
+		t.Error("WithToken dropped the configured scopes")
+	}
+}
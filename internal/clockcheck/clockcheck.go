@@ -0,0 +1,107 @@
+// Package clockcheck compares the local clock with reference clocks, an NTP
+// server or the Kafka brokers, and warns when they drift apart. Signature
+// timestamp checks and the event times stamped on messages silently go
+// wrong on a node whose clock is off, so kahook checks at startup and
+// periodically rather than trusting the host's time sync.
+package clockcheck
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Source reads a reference clock.
+type Source interface {
+	// Name identifies the source in logs, e.g. "ntp" or "kafka".
+	Name() string
+	// Offset returns how far the reference clock is ahead of the local
+	// clock; negative when the local clock is ahead.
+	Offset(ctx context.Context) (time.Duration, error)
+}
+
+// Config configures a Checker.
+type Config struct {
+	// Sources are checked in order; the first that answers sets the
+	// reported offset, the others are only logged.
+	Sources []Source
+	// MaxSkew is the largest offset, either way, that is not warned about.
+	MaxSkew time.Duration
+	// Interval between checks after the startup check; zero checks once.
+	Interval time.Duration
+	// Timeout bounds each source's check; zero means 10s.
+	Timeout time.Duration
+	Logger  *zap.Logger
+}
+
+// Checker periodically measures the local clock's offset.
+type Checker struct {
+	cfg      Config
+	offset   atomic.Int64 // nanoseconds
+	measured atomic.Bool
+}
+
+// New returns a Checker; call Run to start checking.
+func New(cfg Config) *Checker {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Checker{cfg: cfg}
+}
+
+// Offset returns the latest offset measured by the first source that
+// answered, and false if no check has succeeded yet.
+func (c *Checker) Offset() (time.Duration, bool) {
+	return time.Duration(c.offset.Load()), c.measured.Load()
+}
+
+// Run checks immediately, then every Interval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	c.Check(ctx)
+	if c.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check(ctx)
+		}
+	}
+}
+
+// Check queries every source once, logging each offset and warning about
+// any over MaxSkew.
+func (c *Checker) Check(ctx context.Context) {
+	recorded := false
+	for _, src := range c.cfg.Sources {
+		checkCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+		offset, err := src.Offset(checkCtx)
+		cancel()
+		if err != nil {
+			c.cfg.Logger.Warn("clock check failed", zap.String("source", src.Name()), zap.Error(err))
+			continue
+		}
+
+		if !recorded {
+			c.offset.Store(int64(offset))
+			c.measured.Store(true)
+			recorded = true
+		}
+		fields := []zap.Field{
+			zap.String("source", src.Name()),
+			zap.Duration("offset", offset),
+			zap.Duration("max_skew", c.cfg.MaxSkew),
+		}
+		if offset > c.cfg.MaxSkew || offset < -c.cfg.MaxSkew {
+			c.cfg.Logger.Warn("local clock is skewed; signature timestamps and event times may be wrong", fields...)
+			continue
+		}
+		c.cfg.Logger.Debug("clock check", fields...)
+	}
+}
@@ -0,0 +1,77 @@
+package clockcheck
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fakeSource struct {
+	name   string
+	offset time.Duration
+	err    error
+}
+
+func (f fakeSource) Name() string { return f.name }
+
+func (f fakeSource) Offset(context.Context) (time.Duration, error) { return f.offset, f.err }
+
+func TestChecker_Check(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	c := New(Config{
+		Sources: []Source{
+			fakeSource{name: "ntp", err: errors.New("unreachable")},
+			fakeSource{name: "kafka", offset: -3 * time.Second},
+			fakeSource{name: "other", offset: 10 * time.Millisecond},
+		},
+		MaxSkew: time.Second,
+		Logger:  zap.New(core),
+	})
+
+	if _, ok := c.Offset(); ok {
+		t.Fatal("Offset reported a measurement before any check")
+	}
+	c.Check(context.Background())
+
+	// The first source that answers sets the offset.
+	if offset, ok := c.Offset(); !ok || offset != -3*time.Second {
+		t.Errorf("Offset() = %v, %v; want -3s, true", offset, ok)
+	}
+	if n := logs.FilterMessage("clock check failed").FilterField(zap.String("source", "ntp")).Len(); n != 1 {
+		t.Errorf("logged %d failures for the ntp source, want 1", n)
+	}
+	skewed := logs.FilterLevelExact(zapcore.WarnLevel).FilterMessageSnippet("skewed")
+	if skewed.Len() != 1 || skewed.FilterField(zap.String("source", "kafka")).Len() != 1 {
+		t.Errorf("skew warnings = %v, want one for the kafka source", skewed.All())
+	}
+}
+
+func TestChecker_RunStopsWithContext(t *testing.T) {
+	c := New(Config{
+		Sources:  []Source{fakeSource{name: "ntp"}},
+		MaxSkew:  time.Second,
+		Interval: time.Millisecond,
+		Logger:   zap.NewNop(),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after its context was canceled")
+	}
+	if _, ok := c.Offset(); !ok {
+		t.Error("Run did not check the clock")
+	}
+}
@@ -0,0 +1,106 @@
+package clockcheck
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// ntpEpochOffset is the number of seconds from the NTP epoch (1900) to the
+// Unix epoch (1970).
+const ntpEpochOffset = 2208988800
+
+// NTP is a Source that queries an NTP server with a single SNTP (RFC 4330)
+// request. Server is a host, or host:port when not on port 123.
+type NTP struct {
+	Server string
+}
+
+// Name returns "ntp".
+func (n NTP) Name() string { return "ntp" }
+
+// Offset sends one request and computes the clock offset from the server's
+// receive and transmit timestamps, correcting for the round trip.
+func (n NTP) Offset(ctx context.Context) (time.Duration, error) {
+	addr := n.Server
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "123")
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// Version 4, client mode. The transmit timestamp is random rather than
+	// the local time, as RFC 4330 allows, and only identifies the reply.
+	req := make([]byte, 48)
+	req[0] = 4<<3 | 3
+	if _, err := rand.Read(req[40:]); err != nil {
+		return 0, err
+	}
+
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	resp := make([]byte, 48)
+	for {
+		n, err := conn.Read(resp)
+		if err != nil {
+			return 0, err
+		}
+		// Ignore stray datagrams that do not answer this request.
+		if n >= 48 && string(resp[24:32]) == string(req[40:48]) {
+			break
+		}
+	}
+	received := time.Now()
+
+	return ntpOffset(resp, sent, received)
+}
+
+// ntpOffset validates a server reply and returns ((T2-T1) + (T3-T4)) / 2,
+// where T1 and T4 are the local send and receive times and T2 and T3 the
+// server's receive and transmit times.
+func ntpOffset(resp []byte, sent, received time.Time) (time.Duration, error) {
+	if mode := resp[0] & 0x7; mode != 4 {
+		return 0, fmt.Errorf("ntp: reply has mode %d, want 4 (server)", mode)
+	}
+	if resp[0]>>6 == 3 {
+		return 0, errors.New("ntp: server clock is not synchronized")
+	}
+	if stratum := resp[1]; stratum == 0 {
+		return 0, fmt.Errorf("ntp: server sent kiss code %q", resp[12:16])
+	}
+	serverReceive := ntpTime(resp[32:40])
+	serverTransmit := ntpTime(resp[40:48])
+	if serverReceive.IsZero() || serverTransmit.IsZero() {
+		return 0, errors.New("ntp: reply has no timestamps")
+	}
+	return (serverReceive.Sub(sent) + serverTransmit.Sub(received)) / 2, nil
+}
+
+// ntpTime decodes a 64-bit NTP timestamp, or returns the zero time for an
+// unset one. Seconds with the high bit clear are taken to be in era 1,
+// which starts in 2036.
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b))
+	frac := int64(binary.BigEndian.Uint32(b[4:]))
+	if secs == 0 && frac == 0 {
+		return time.Time{}
+	}
+	if secs < 1<<31 {
+		secs += 1 << 32
+	}
+	return time.Unix(secs-ntpEpochOffset, (frac*1e9)>>32)
+}
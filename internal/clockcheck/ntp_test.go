@@ -0,0 +1,116 @@
+package clockcheck
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func putNTPTime(b []byte, t time.Time) {
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+ntpEpochOffset))
+	binary.BigEndian.PutUint32(b[4:], uint32((int64(t.Nanosecond())<<32)/1e9))
+}
+
+// fakeNTPServer answers SNTP requests with its clock set skew ahead of the
+// local one. reply may modify each reply before it is sent.
+func fakeNTPServer(t *testing.T, skew time.Duration, reply func([]byte)) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 48)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if n < 48 {
+				continue
+			}
+			resp := make([]byte, 48)
+			resp[0] = 4<<3 | 4 // version 4, server mode
+			resp[1] = 2        // stratum
+			copy(resp[24:32], buf[40:48])
+			now := time.Now().Add(skew)
+			putNTPTime(resp[32:40], now)
+			putNTPTime(resp[40:48], now)
+			if reply != nil {
+				reply(resp)
+			}
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestNTP_Offset(t *testing.T) {
+	for _, skew := range []time.Duration{0, 3 * time.Second, -90 * time.Second} {
+		addr := fakeNTPServer(t, skew, nil)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		offset, err := NTP{Server: addr}.Offset(ctx)
+		cancel()
+		if err != nil {
+			t.Fatalf("skew %v: %v", skew, err)
+		}
+		if d := offset - skew; d < -50*time.Millisecond || d > 50*time.Millisecond {
+			t.Errorf("skew %v: offset = %v", skew, offset)
+		}
+	}
+}
+
+func TestNTP_RejectsBadReplies(t *testing.T) {
+	tests := []struct {
+		name  string
+		reply func([]byte)
+		want  string
+	}{
+		{"kiss of death", func(b []byte) { b[1] = 0; copy(b[12:16], "RATE") }, "RATE"},
+		{"unsynchronized", func(b []byte) { b[0] |= 3 << 6 }, "not synchronized"},
+		{"client mode", func(b []byte) { b[0] = 4<<3 | 3 }, "mode 3"},
+		{"no timestamps", func(b []byte) { clear(b[32:48]) }, "no timestamps"},
+	}
+	for _, tt := range tests {
+		addr := fakeNTPServer(t, 0, tt.reply)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		_, err := NTP{Server: addr}.Offset(ctx)
+		cancel()
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNTP_TimesOut(t *testing.T) {
+	// A server that never answers.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := (NTP{Server: conn.LocalAddr().String()}).Offset(ctx); err == nil {
+		t.Error("Offset returned without a reply")
+	}
+}
+
+func TestNTPTime_Eras(t *testing.T) {
+	b := make([]byte, 8)
+	for _, want := range []time.Time{
+		time.Date(2026, 10, 16, 12, 0, 0, 500_000_000, time.UTC),
+		time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC), // era 1
+	} {
+		putNTPTime(b, want)
+		if got := ntpTime(b); got.Sub(want).Abs() > time.Microsecond {
+			t.Errorf("ntpTime = %v, want %v", got.UTC(), want)
+		}
+	}
+}
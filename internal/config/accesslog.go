@@ -0,0 +1,46 @@
+package config
+
+import "fmt"
+
+// AccessLogConfig produces a JSON record of every HTTP request (method,
+// path, status, duration, sizes, remote address, and request ID) to Topic,
+// so access logs reach the log pipeline through Kafka rather than stdout.
+// Records are batched, up to BatchSize (default 100) to a message as
+// newline-delimited JSON, and flushed at least every FlushMs milliseconds
+// (default 1000). SampleRatio keeps that fraction of successful requests,
+// zero meaning all; 4xx and 5xx responses are always kept. Buffer bounds
+// the records waiting to be produced (default 8192). Replace stops logging
+// requests to stdout. An empty Topic disables it.
+type AccessLogConfig struct {
+	Topic       string  `yaml:"topic"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+	BatchSize   int     `yaml:"batch_size"`
+	FlushMs     int     `yaml:"flush_ms"`
+	Buffer      int     `yaml:"buffer"`
+	Replace     bool    `yaml:"replace"`
+}
+
+func validateAccessLog(a AccessLogConfig) error {
+	if a.Topic == "" {
+		if a.Replace {
+			return fmt.Errorf("access_log.replace requires access_log.topic")
+		}
+		return nil
+	}
+	if !validRouteName.MatchString(a.Topic) {
+		return fmt.Errorf("access_log.topic: %q must match [a-zA-Z0-9._-] and be 1-249 characters", a.Topic)
+	}
+	if a.SampleRatio < 0 || a.SampleRatio > 1 {
+		return fmt.Errorf("access_log.sample_ratio must be between 0 and 1, got %g", a.SampleRatio)
+	}
+	if a.BatchSize < 0 {
+		return fmt.Errorf("access_log.batch_size must not be negative, got %d", a.BatchSize)
+	}
+	if a.FlushMs < 0 {
+		return fmt.Errorf("access_log.flush_ms must not be negative, got %d", a.FlushMs)
+	}
+	if a.Buffer < 0 {
+		return fmt.Errorf("access_log.buffer must not be negative, got %d", a.Buffer)
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateAccessLog(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     AccessLogConfig
+		wantErr string
+	}{
+		{"disabled", AccessLogConfig{}, ""},
+		{"sampled", AccessLogConfig{Topic: "kahook.access", SampleRatio: 0.1, BatchSize: 500, FlushMs: 2000, Replace: true}, ""},
+		{"replace without topic", AccessLogConfig{Replace: true}, "requires access_log.topic"},
+		{"bad topic", AccessLogConfig{Topic: "access log"}, "access_log.topic"},
+		{"sample above one", AccessLogConfig{Topic: "kahook.access", SampleRatio: 1.5}, "sample_ratio"},
+		{"negative batch", AccessLogConfig{Topic: "kahook.access", BatchSize: -1}, "batch_size"},
+		{"negative flush", AccessLogConfig{Topic: "kahook.access", FlushMs: -1}, "flush_ms"},
+	}
+	for _, tt := range tests {
+		err := validateAccessLog(tt.log)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateAccessLog() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateAccessLog() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_AccessLogFromEnv(t *testing.T) {
+	t.Setenv("ACCESS_LOG_TOPIC", "kahook.access")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.AccessLog.Topic != "kahook.access" {
+		t.Errorf("access_log.topic = %q, want kahook.access", cfg.AccessLog.Topic)
+	}
+	if !slices.Contains(cfg.KafkaTopics(), "kahook.access") {
+		t.Errorf("KafkaTopics() = %v, want the access log topic included", cfg.KafkaTopics())
+	}
+}
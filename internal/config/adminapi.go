@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultAdminHost is the address the admin listener binds when
+// AdminListenerConfig.Host is empty.
+const defaultAdminHost = "127.0.0.1"
+
+// AdminListenerConfig serves the admin API on a port of its own, apart from
+// webhook traffic: the configured routes, per-topic counters, switching a
+// topic's ingestion off and on, publish token rotation, and the effective
+// config with secrets redacted. Port enables it and must differ from
+// server.port; Host defaults to 127.0.0.1. Requests need a bearer token:
+// Tokens are operator credentials, which may use every endpoint, and
+// ReadOnlyTokens may only view routes, topics, and the config. Without
+// tokens the API is open, so Host must then be a loopback address.
+type AdminListenerConfig struct {
+	Port           int      `yaml:"port"`
+	Host           string   `yaml:"host"`
+	Tokens         []string `yaml:"tokens" secret:"true"`
+	ReadOnlyTokens []string `yaml:"read_only_tokens" secret:"true"`
+}
+
+// Enabled reports whether the admin listener is served.
+func (a AdminListenerConfig) Enabled() bool {
+	return a.Port != 0
+}
+
+// Addr returns the host:port the admin listener binds.
+func (a AdminListenerConfig) Addr() string {
+	host := a.Host
+	if host == "" {
+		host = defaultAdminHost
+	}
+	return net.JoinHostPort(strings.Trim(host, "[]"), strconv.Itoa(a.Port))
+}
+
+// loopbackHost reports whether host only accepts local connections.
+func loopbackHost(host string) bool {
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(host, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+func validateAdminListener(a AdminListenerConfig, serverPort int, hardened bool) error {
+	if !a.Enabled() {
+		return nil
+	}
+	if a.Port < 1 || a.Port > 65535 {
+		return fmt.Errorf("admin.listener.port: invalid port %d", a.Port)
+	}
+	if a.Port == serverPort {
+		return fmt.Errorf("admin.listener.port must differ from server.port")
+	}
+	for _, t := range a.Tokens {
+		if t == "" {
+			return fmt.Errorf("admin.listener.tokens must not contain empty tokens")
+		}
+	}
+	for _, t := range a.ReadOnlyTokens {
+		if t == "" {
+			return fmt.Errorf("admin.listener.read_only_tokens must not contain empty tokens")
+		}
+		if slices.Contains(a.Tokens, t) {
+			return fmt.Errorf("admin.listener.read_only_tokens: a read-only token is also listed in admin.listener.tokens, which grants operator access")
+		}
+	}
+	if len(a.Tokens)+len(a.ReadOnlyTokens) == 0 {
+		if hardened {
+			return fmt.Errorf("hardened requires admin.listener.tokens")
+		}
+		if !loopbackHost(a.Host) {
+			return fmt.Errorf("admin.listener.tokens is required unless admin.listener.host is a loopback address")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateAdminListener(t *testing.T) {
+	tests := []struct {
+		name     string
+		listener AdminListenerConfig
+		hardened bool
+		wantErr  string
+	}{
+		{"disabled", AdminListenerConfig{}, true, ""},
+		{"loopback without tokens", AdminListenerConfig{Port: 9090}, false, ""},
+		{"localhost without tokens", AdminListenerConfig{Port: 9090, Host: "localhost"}, false, ""},
+		{"IPv6 loopback without tokens", AdminListenerConfig{Port: 9090, Host: "[::1]"}, false, ""},
+		{"public with tokens", AdminListenerConfig{Port: 9090, Host: "0.0.0.0", Tokens: []string{"t"}}, true, ""},
+		{"public without tokens", AdminListenerConfig{Port: 9090, Host: "0.0.0.0"}, false, "tokens is required"},
+		{"hardened without tokens", AdminListenerConfig{Port: 9090}, true, "hardened requires"},
+		{"server port", AdminListenerConfig{Port: 8080}, false, "must differ"},
+		{"bad port", AdminListenerConfig{Port: 70000}, false, "invalid port"},
+		{"empty token", AdminListenerConfig{Port: 9090, Tokens: []string{""}}, false, "empty tokens"},
+		{"public with read-only tokens", AdminListenerConfig{Port: 9090, Host: "0.0.0.0", ReadOnlyTokens: []string{"noc"}}, true, ""},
+		{"both roles", AdminListenerConfig{Port: 9090, Tokens: []string{"ops"}, ReadOnlyTokens: []string{"noc"}}, true, ""},
+		{"empty read-only token", AdminListenerConfig{Port: 9090, ReadOnlyTokens: []string{""}}, false, "empty tokens"},
+		{"token in both roles", AdminListenerConfig{Port: 9090, Tokens: []string{"t"}, ReadOnlyTokens: []string{"t"}}, false, "operator access"},
+	}
+	for _, tt := range tests {
+		err := validateAdminListener(tt.listener, 8080, tt.hardened)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateAdminListener() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateAdminListener() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAdminListenerConfig_Addr(t *testing.T) {
+	if got := (AdminListenerConfig{Port: 9090}).Addr(); got != "127.0.0.1:9090" {
+		t.Errorf("Addr() = %q, want the loopback default", got)
+	}
+	if got := (AdminListenerConfig{Port: 9090, Host: "[::]"}).Addr(); got != "[::]:9090" {
+		t.Errorf("Addr() = %q", got)
+	}
+}
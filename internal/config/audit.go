@@ -0,0 +1,24 @@
+package config
+
+import "fmt"
+
+// AuditConfig writes a compact record of every webhook produce attempt
+// (request and message ID, principal, topic, key hash, size, outcome,
+// attempts, and latency) to Topic, separate from the payload topics, for
+// "who wrote what when" audits. Buffer bounds the records waiting to be
+// produced (default 4096); records beyond it are dropped and counted. An
+// empty Topic disables it.
+type AuditConfig struct {
+	Topic  string `yaml:"topic"`
+	Buffer int    `yaml:"buffer"`
+}
+
+func validateAudit(a AuditConfig) error {
+	if a.Topic != "" && !validRouteName.MatchString(a.Topic) {
+		return fmt.Errorf("audit.topic: %q must match [a-zA-Z0-9._-] and be 1-249 characters", a.Topic)
+	}
+	if a.Buffer < 0 {
+		return fmt.Errorf("audit.buffer must not be negative, got %d", a.Buffer)
+	}
+	return nil
+}
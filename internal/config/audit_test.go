@@ -0,0 +1,46 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateAudit(t *testing.T) {
+	tests := []struct {
+		name    string
+		audit   AuditConfig
+		wantErr string
+	}{
+		{"disabled", AuditConfig{}, ""},
+		{"topic", AuditConfig{Topic: "kahook.audit", Buffer: 1000}, ""},
+		{"bad topic", AuditConfig{Topic: "audit log"}, "audit.topic"},
+		{"negative buffer", AuditConfig{Topic: "kahook.audit", Buffer: -1}, "audit.buffer"},
+	}
+	for _, tt := range tests {
+		err := validateAudit(tt.audit)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateAudit() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateAudit() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_AuditFromEnv(t *testing.T) {
+	t.Setenv("AUDIT_TOPIC", "kahook.audit")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Audit.Topic != "kahook.audit" {
+		t.Errorf("audit.topic = %q, want kahook.audit", cfg.Audit.Topic)
+	}
+	if !slices.Contains(cfg.KafkaTopics(), "kahook.audit") {
+		t.Errorf("KafkaTopics() = %v, want the audit topic included", cfg.KafkaTopics())
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+import "fmt"
+
+// BatchConfig serves /batch/{topic}, which splits one request carrying
+// NDJSON or a JSON array into a message per record, for senders such as
+// IoT gateways that would otherwise make a call per event. MaxRecords
+// (default 1000) and MaxBodyBytes (default 10 MiB) bound a batch.
+type BatchConfig struct {
+	Enabled      bool  `yaml:"enabled"`
+	MaxRecords   int   `yaml:"max_records"`
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+}
+
+func validateBatch(b BatchConfig) error {
+	if b.MaxRecords < 0 {
+		return fmt.Errorf("server.batch.max_records must not be negative, got %d", b.MaxRecords)
+	}
+	if b.MaxBodyBytes < 0 {
+		return fmt.Errorf("server.batch.max_body_bytes must not be negative, got %d", b.MaxBodyBytes)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestValidateBatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		batch   BatchConfig
+		wantErr bool
+	}{
+		{"disabled", BatchConfig{}, false},
+		{"defaults", BatchConfig{Enabled: true}, false},
+		{"limits", BatchConfig{Enabled: true, MaxRecords: 500, MaxBodyBytes: 4 << 20}, false},
+		{"negative records", BatchConfig{MaxRecords: -1}, true},
+		{"negative bytes", BatchConfig{MaxBodyBytes: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := validateBatch(tt.batch); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateBatch() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_BatchFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	orig, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(orig) }()
+
+	t.Setenv("SERVER_BATCH_ENABLED", "true")
+	t.Setenv("SERVER_BATCH_MAX_RECORDS", "250")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if b := cfg.Server.Batch; !b.Enabled || b.MaxRecords != 250 {
+		t.Errorf("server.batch = %+v, want enabled with 250 records", b)
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import "fmt"
+
+// DefaultMaxBodyBytes is the webhook body limit when server.max_body_bytes
+// is unset (1 MiB).
+const DefaultMaxBodyBytes = 1 << 20
+
+// messageOverheadBytes is room left in message.max.bytes for a body's key,
+// headers, and record framing.
+const messageOverheadBytes = 64 << 10
+
+// BodyLimit returns the largest webhook body topic accepts: its own
+// max_body_bytes, or the server's.
+func (c *Config) BodyLimit(topic string) int64 {
+	if n := c.Topics[topic].MaxBodyBytes; n > 0 {
+		return n
+	}
+	if c.Server.MaxBodyBytes > 0 {
+		return c.Server.MaxBodyBytes
+	}
+	return DefaultMaxBodyBytes
+}
+
+// maxBodyLimit returns the largest body any topic accepts.
+func (c *Config) maxBodyLimit() int64 {
+	n := c.BodyLimit("")
+	for name := range c.Topics {
+		n = max(n, c.BodyLimit(name))
+	}
+	return n
+}
+
+// validateBodyLimits checks the server's and each topic's body limit.
+func validateBodyLimits(cfg *Config) error {
+	if n := cfg.Server.MaxBodyBytes; n < 0 {
+		return fmt.Errorf("server.max_body_bytes must not be negative, got %d", n)
+	}
+	for name, t := range cfg.Topics {
+		if t.MaxBodyBytes < 0 {
+			return fmt.Errorf("topics.%s.max_body_bytes must not be negative, got %d", name, t.MaxBodyBytes)
+		}
+	}
+	return nil
+}
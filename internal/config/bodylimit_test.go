@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateBodyLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"unset", Config{}, ""},
+		{"limits", Config{Server: ServerConfig{MaxBodyBytes: 256 << 10}, Topics: map[string]TopicConfig{"audit-uploads": {MaxBodyBytes: 10 << 20}}}, ""},
+		{"negative server limit", Config{Server: ServerConfig{MaxBodyBytes: -1}}, "server.max_body_bytes"},
+		{"negative topic limit", Config{Topics: map[string]TopicConfig{"orders": {MaxBodyBytes: -1}}}, "topics.orders.max_body_bytes"},
+	}
+	for _, tt := range tests {
+		err := validateBodyLimits(&tt.cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateBodyLimits() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateBodyLimits() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestConfig_BodyLimit(t *testing.T) {
+	cfg := &Config{Topics: map[string]TopicConfig{"orders": {Payload: "json_only"}}}
+	if got := cfg.BodyLimit("orders"); got != DefaultMaxBodyBytes {
+		t.Errorf("BodyLimit(orders) = %d, want the default", got)
+	}
+	if _, ok := cfg.KafkaConfigMap()["message.max.bytes"]; ok {
+		t.Error("KafkaConfigMap() overrides message.max.bytes at the default limits")
+	}
+
+	cfg.Server.MaxBodyBytes = 256 << 10
+	cfg.Topics["audit-uploads"] = TopicConfig{MaxBodyBytes: 10 << 20}
+	if got := cfg.BodyLimit("orders"); got != 256<<10 {
+		t.Errorf("BodyLimit(orders) = %d, want the server limit", got)
+	}
+	if got := cfg.BodyLimit("audit-uploads"); got != 10<<20 {
+		t.Errorf("BodyLimit(audit-uploads) = %d, want the topic limit", got)
+	}
+	if got := cfg.KafkaConfigMap()["message.max.bytes"]; got != int64(10<<20+messageOverheadBytes) {
+		t.Errorf("message.max.bytes = %v, want room for the largest body", got)
+	}
+
+	// A profile's cap wins.
+	cfg.Kafka.Profile = KafkaProfileEventHubs
+	if got := cfg.KafkaConfigMap()["message.max.bytes"]; got != eventHubsMaxMessageBytes {
+		t.Errorf("message.max.bytes = %v under the Event Hubs profile, want its cap", got)
+	}
+}
+
+func TestLoad_BodyLimits(t *testing.T) {
+	t.Setenv("SERVER_MAX_BODY_BYTES", "65536")
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+routes:
+  - path: audit
+    topic: audit-uploads
+    max_body_bytes: 10485760
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.BodyLimit("orders"); got != 65536 {
+		t.Errorf("BodyLimit(orders) = %d, want 65536 from SERVER_MAX_BODY_BYTES", got)
+	}
+	if got := cfg.BodyLimit("audit-uploads"); got != 10<<20 {
+		t.Errorf("BodyLimit(audit-uploads) = %d, want the route's limit", got)
+	}
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// clientPlaceholder matches {name} and {env:VAR} in client.id and client.rack.
+var clientPlaceholder = regexp.MustCompile(`\{([a-z_]+|env:[A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandClientTemplate substitutes placeholders in a client.id or client.rack
+// template:
+//
+//	{hostname}       os.Hostname()
+//	{pod_name}       $POD_NAME, falling back to the hostname
+//	{pod_namespace}  $POD_NAMESPACE
+//	{env:VAR}        $VAR
+//
+// Unknown placeholders are left in place for validation to report.
+func expandClientTemplate(tmpl string) string {
+	if !strings.Contains(tmpl, "{") {
+		return tmpl
+	}
+	return clientPlaceholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := m[1 : len(m)-1]
+		switch {
+		case name == "hostname":
+			return hostname()
+		case name == "pod_name":
+			if v := os.Getenv("POD_NAME"); v != "" {
+				return v
+			}
+			return hostname()
+		case name == "pod_namespace":
+			return os.Getenv("POD_NAMESPACE")
+		case strings.HasPrefix(name, "env:"):
+			return os.Getenv(strings.TrimPrefix(name, "env:"))
+		}
+		return m
+	})
+}
+
+func hostname() string {
+	h, err := os.Hostname()
+	if err != nil {
+		return "unknown"
+	}
+	return h
+}
+
+// applyClientIdentity expands the client.id and client.rack templates, and
+// the transactional ID, the leader election identity and namespace, and the
+// usage report instance, which name the same replica.
+func applyClientIdentity(cfg *Config) {
+	cfg.Kafka.ClientID = expandClientTemplate(cfg.Kafka.ClientID)
+	cfg.Kafka.ClientRack = expandClientTemplate(cfg.Kafka.ClientRack)
+	cfg.Kafka.Transactional.ID = expandClientTemplate(cfg.Kafka.Transactional.ID)
+	cfg.LeaderElection.Identity = expandClientTemplate(cfg.LeaderElection.Identity)
+	cfg.LeaderElection.Namespace = expandClientTemplate(cfg.LeaderElection.Namespace)
+	cfg.Usage.Instance = expandClientTemplate(cfg.Usage.Instance)
+}
+
+// validClientID matches the characters Kafka accepts in client IDs used for
+// quotas (alphanumerics, '.', '_', '-').
+var validClientID = regexp.MustCompile(`^[a-zA-Z0-9._-]*$`)
+
+func validateClientIdentity(k KafkaConfig) error {
+	if !validClientID.MatchString(k.ClientID) {
+		return fmt.Errorf("kafka.client_id %q: only [a-zA-Z0-9._-] allowed after expanding placeholders ({hostname}, {pod_name}, {pod_namespace}, {env:VAR})", k.ClientID)
+	}
+	if strings.ContainsAny(k.ClientRack, "{}") {
+		return fmt.Errorf("kafka.client_rack %q has an unknown placeholder", k.ClientRack)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExpandClientTemplate(t *testing.T) {
+	host, _ := os.Hostname()
+	t.Setenv("POD_NAME", "kahook-7d9f-abc")
+	t.Setenv("POD_NAMESPACE", "webhooks")
+	t.Setenv("ZONE", "eu-west-1a")
+
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"kahook", "kahook"},
+		{"kahook-{hostname}", "kahook-" + host},
+		{"{pod_namespace}.{pod_name}", "webhooks.kahook-7d9f-abc"},
+		{"{env:ZONE}", "eu-west-1a"},
+		{"kahook-{nope}", "kahook-{nope}"},
+	}
+
+	for _, tt := range tests {
+		if got := expandClientTemplate(tt.tmpl); got != tt.want {
+			t.Errorf("expandClientTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestExpandClientTemplate_PodNameFallsBackToHostname(t *testing.T) {
+	host, _ := os.Hostname()
+	t.Setenv("POD_NAME", "")
+
+	if got := expandClientTemplate("{pod_name}"); got != host {
+		t.Errorf("{pod_name} = %q, want hostname %q", got, host)
+	}
+}
+
+func TestLoad_ClientIdentity(t *testing.T) {
+	t.Setenv("POD_NAME", "kahook-0")
+	t.Setenv("KAFKA_CLIENT_ID", "kahook-{pod_name}")
+	t.Setenv("KAFKA_CLIENT_RACK", "use1-az1")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	m := cfg.KafkaConfigMap()
+	if m["client.id"] != "kahook-kahook-0" {
+		t.Errorf("client.id = %v, want kahook-kahook-0", m["client.id"])
+	}
+	if m["client.rack"] != "use1-az1" {
+		t.Errorf("client.rack = %v, want use1-az1", m["client.rack"])
+	}
+
+	t.Setenv("KAFKA_CLIENT_ID", "kahook-{bogus}")
+	if _, err := Load(""); err == nil {
+		t.Error("Load() should reject an unknown client.id placeholder")
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+)
+
+// ClientIPConfig trusts the client address HTTP proxies in TrustedCIDRs
+// report in Header (default X-Forwarded-For), for routes' allowed_cidrs.
+// Use it behind HTTP load balancers and CDNs; behind TCP load balancers,
+// prefer proxy_protocol. Without TrustedCIDRs the header is ignored, since
+// any client could send it.
+type ClientIPConfig struct {
+	Header       string   `yaml:"header"`
+	TrustedCIDRs []string `yaml:"trusted_cidrs"`
+}
+
+// TrustedNetworks parses TrustedCIDRs, accepting bare IPs as single-address
+// networks.
+func (c ClientIPConfig) TrustedNetworks() ([]netip.Prefix, error) {
+	return parseNetworks(c.TrustedCIDRs)
+}
+
+func validateClientIP(c ClientIPConfig) error {
+	if c.Header != "" && !validHeaderName.MatchString(c.Header) {
+		return fmt.Errorf("server.client_ip.header %q must be a header name of letters, digits, and hyphens", c.Header)
+	}
+	if _, err := c.TrustedNetworks(); err != nil {
+		return fmt.Errorf("server.client_ip.trusted_cidrs: %w", err)
+	}
+	return nil
+}
+
+// RouteNetworks maps topics to the client networks their routes accept.
+// Topics without allowed_cidrs have no entry.
+func (c *Config) RouteNetworks() (map[string][]netip.Prefix, error) {
+	networks := make(map[string][]netip.Prefix)
+	for i, r := range c.Routes {
+		if len(r.AllowedCIDRs) == 0 {
+			continue
+		}
+		nets, err := parseNetworks(r.AllowedCIDRs)
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d].allowed_cidrs: %w", i, err)
+		}
+		networks[r.Topic] = nets
+	}
+	return networks, nil
+}
+
+// allowedCIDRsEqual reports whether two routes accept the same networks.
+func allowedCIDRsEqual(a, b []string) bool {
+	return slices.Equal(a, b)
+}
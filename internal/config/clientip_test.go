@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateClientIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       ClientIPConfig
+		wantErr string
+	}{
+		{"disabled", ClientIPConfig{}, ""},
+		{"trusted", ClientIPConfig{Header: "CF-Connecting-IP", TrustedCIDRs: []string{"10.0.0.0/8", "192.0.2.1"}}, ""},
+		{"bad header", ClientIPConfig{Header: "X Forwarded"}, "server.client_ip.header"},
+		{"bad cidr", ClientIPConfig{TrustedCIDRs: []string{"10.0.0.0/33"}}, "server.client_ip.trusted_cidrs"},
+	}
+	for _, tt := range tests {
+		err := validateClientIP(tt.c)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateClientIP() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateClientIP() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_RouteAllowedCIDRs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+routes:
+  - path: github
+    topic: github.events
+    allowed_cidrs: [192.30.252.0/22, 2001:db8::/32, 203.0.113.7]
+  - path: github-legacy
+    topic: github.events
+    allowed_cidrs: [192.30.252.0/22]
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "different options") {
+		t.Fatalf("Load() error = %v, want routes to disagree on allowed_cidrs", err)
+	}
+
+	yaml = yaml[:strings.Index(yaml, "  - path: github-legacy")]
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	networks, err := cfg.RouteNetworks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	nets := networks["github.events"]
+	if len(nets) != 3 || nets[2].String() != "203.0.113.7/32" {
+		t.Errorf("RouteNetworks() = %v, want the three networks with the bare IP as a /32", networks)
+	}
+
+	if err := os.WriteFile(path, []byte(strings.Replace(yaml, "203.0.113.7", "not-an-ip", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "routes[0].allowed_cidrs") {
+		t.Errorf("Load() error = %v, want an invalid allowed_cidrs error", err)
+	}
+}
@@ -0,0 +1,35 @@
+package config
+
+import "fmt"
+
+// ClockConfig checks the local clock against reference clocks at startup and
+// every Interval seconds, warning when they differ by more than MaxSkewMs.
+// NTPServer (host or host:port) is queried with SNTP. KafkaTopic is a topic
+// configured with message.timestamp.type=LogAppendTime; a small probe
+// message is produced to it on every check and the broker's append time is
+// the reference. With neither set, the clock is not checked.
+type ClockConfig struct {
+	NTPServer  string `yaml:"ntp_server"`
+	KafkaTopic string `yaml:"kafka_topic"`
+	MaxSkewMs  int    `yaml:"max_skew_ms"`
+	Interval   int    `yaml:"interval"`
+}
+
+// Enabled reports whether any reference clock is configured.
+func (c ClockConfig) Enabled() bool {
+	return c.NTPServer != "" || c.KafkaTopic != ""
+}
+
+func validateClock(cfg *Config) error {
+	c := cfg.Clock
+	if c.MaxSkewMs < 0 {
+		return fmt.Errorf("clock.max_skew_ms must not be negative, got %d", c.MaxSkewMs)
+	}
+	if c.Interval < 0 {
+		return fmt.Errorf("clock.interval must not be negative, got %d", c.Interval)
+	}
+	if c.KafkaTopic != "" && cfg.DefaultBackend() != BackendKafka {
+		return fmt.Errorf("clock.kafka_topic requires the kafka backend, default backend is %q", cfg.DefaultBackend())
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateClock(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"disabled", Config{}, ""},
+		{"ntp", Config{Clock: ClockConfig{NTPServer: "pool.ntp.org", MaxSkewMs: 500, Interval: 60}}, ""},
+		{"kafka", Config{Clock: ClockConfig{KafkaTopic: "kahook-clock"}}, ""},
+		{"kafka topic on nats", Config{Backend: BackendNATS, Clock: ClockConfig{KafkaTopic: "kahook-clock"}}, "requires the kafka backend"},
+		{"negative skew", Config{Clock: ClockConfig{MaxSkewMs: -1}}, "max_skew_ms"},
+		{"negative interval", Config{Clock: ClockConfig{Interval: -1}}, "interval"},
+	}
+	for _, tt := range tests {
+		err := validateClock(&tt.cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateClock() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateClock() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_ClockFromEnv(t *testing.T) {
+	t.Setenv("CLOCK_NTP_SERVER", "time.example.com:123")
+	t.Setenv("CLOCK_KAFKA_TOPIC", "kahook-clock")
+	t.Setenv("CLOCK_MAX_SKEW_MS", "250")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := ClockConfig{NTPServer: "time.example.com:123", KafkaTopic: "kahook-clock", MaxSkewMs: 250, Interval: 300}
+	if cfg.Clock != want {
+		t.Errorf("clock = %+v, want %+v", cfg.Clock, want)
+	}
+	if !cfg.Clock.Enabled() {
+		t.Error("Enabled() = false with reference clocks configured")
+	}
+	if !slices.Contains(cfg.KafkaTopics(), "kahook-clock") {
+		t.Errorf("KafkaTopics() = %v, want the clock topic included", cfg.KafkaTopics())
+	}
+}
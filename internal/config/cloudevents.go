@@ -0,0 +1,52 @@
+package config
+
+import "fmt"
+
+// CloudEventsConfig emits a topic's messages as CloudEvents 1.0 for
+// consumers such as Knative that expect them. Mode is "structured" (the
+// whole event as an application/cloudevents+json value) or "binary" (the
+// body unchanged, with the attributes in ce_ headers). The event's id is
+// the request ID and its time when the webhook was received. Source
+// defaults to the route path ("/github"); the type is read from
+// TypeHeader when the request has it, then Type, then
+// "dev.kahook.webhook".
+//
+//	routes:
+//	  - path: github
+//	    topic: scm.github.events
+//	    cloudevents:
+//	      mode: binary
+//	      source: https://github.com/acme
+//	      type: com.github.event
+//	      type_header: X-GitHub-Event
+type CloudEventsConfig struct {
+	Mode       string `yaml:"mode" enum:"structured,binary"`
+	Source     string `yaml:"source"`
+	Type       string `yaml:"type"`
+	TypeHeader string `yaml:"type_header"`
+}
+
+// Enabled reports whether messages are emitted as CloudEvents.
+func (c CloudEventsConfig) Enabled() bool {
+	return c.Mode != ""
+}
+
+func validateCloudEvents(name string, c CloudEventsConfig, payload string) error {
+	switch c.Mode {
+	case "structured", "binary":
+	case "":
+		if c != (CloudEventsConfig{}) {
+			return fmt.Errorf("%s: mode is required", name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s.mode: invalid value %q (want structured or binary)", name, c.Mode)
+	}
+	if c.TypeHeader != "" && !validHeaderName.MatchString(c.TypeHeader) {
+		return fmt.Errorf("%s.type_header: %q is not a valid header name", name, c.TypeHeader)
+	}
+	if payload == "base64" {
+		return fmt.Errorf("%s: cannot be combined with payload: base64; CloudEvents carry non-JSON bodies themselves", name)
+	}
+	return nil
+}
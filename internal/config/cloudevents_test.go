@@ -0,0 +1,60 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCloudEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		ce      CloudEventsConfig
+		payload string
+		wantErr string
+	}{
+		{"disabled", CloudEventsConfig{}, "", ""},
+		{"structured", CloudEventsConfig{Mode: "structured"}, "", ""},
+		{"binary with type header", CloudEventsConfig{Mode: "binary", Source: "https://github.com/acme", TypeHeader: "X-GitHub-Event"}, "json_only", ""},
+		{"unknown mode", CloudEventsConfig{Mode: "batched"}, "", "mode"},
+		{"options without mode", CloudEventsConfig{Type: "com.example"}, "", "mode is required"},
+		{"bad type header", CloudEventsConfig{Mode: "binary", TypeHeader: "X GitHub"}, "", "type_header"},
+		{"base64 payload", CloudEventsConfig{Mode: "structured"}, "base64", "payload: base64"},
+	}
+	for _, tt := range tests {
+		err := validateCloudEvents("topics.events.cloudevents", tt.ce, tt.payload)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateCloudEvents() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateCloudEvents() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_RouteCloudEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+routes:
+  - path: github
+    topic: scm.github.events
+    cloudevents:
+      mode: binary
+      type_header: X-GitHub-Event
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := CloudEventsConfig{Mode: "binary", TypeHeader: "X-GitHub-Event"}
+	if got := cfg.Topics["scm.github.events"].CloudEvents; got != want {
+		t.Errorf("CloudEvents = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+import "fmt"
+
+// Values of TopicConfig.Compression.
+const (
+	CompressionDecompress = "decompress"
+	CompressionKeep       = "keep"
+)
+
+// validateCompression checks the decompressed body limit and each topic's
+// compression mode.
+func validateCompression(cfg *Config) error {
+	if n := cfg.Limits.MaxDecompressedBytes; n < 0 {
+		return fmt.Errorf("limits.max_decompressed_bytes must not be negative, got %d", n)
+	}
+	for name, t := range cfg.Topics {
+		switch t.Compression {
+		case "", CompressionDecompress, CompressionKeep:
+		default:
+			return fmt.Errorf("topics.%s.compression: invalid value %q (want decompress or keep)", name, t.Compression)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateCompression(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		maxBytes    int
+		wantErr     string
+	}{
+		{"defaults", "", 0, ""},
+		{"decompress", "decompress", 8 << 20, ""},
+		{"keep", "keep", 0, ""},
+		{"unknown mode", "brotli", 0, "topics.orders.compression"},
+		{"negative limit", "", -1, "limits.max_decompressed_bytes"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{
+			Topics: map[string]TopicConfig{"orders": {Compression: tt.compression}},
+			Limits: LimitsConfig{MaxDecompressedBytes: tt.maxBytes},
+		}
+		err := validateCompression(cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateCompression() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateCompression() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -2,17 +2,148 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/netip"
 	"os"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
 	"gopkg.in/yaml.v3"
 )
 
+// Profiles select groups of defaults aimed at a particular environment.
+const (
+	ProfileDefault = "default"
+	ProfileDev     = "dev"
+)
+
+// Backends webhooks can be published to.
+const (
+	BackendKafka  = "kafka"
+	BackendPulsar = "pulsar"
+	BackendNATS   = "nats"
+	// BackendFile writes JSON lines to stdout or a file and BackendDevNull
+	// discards messages; both are for local development without a broker.
+	BackendFile    = "file"
+	BackendDevNull = "devnull"
+)
+
 type Config struct {
+	// Profile is "default" or "dev". The dev profile trades information
+	// hiding for developer convenience (e.g. route suggestions on 404s).
+	Profile string `yaml:"profile" enum:"default,dev"`
+
+	// Backend selects the messaging system webhooks are published to:
+	// "kafka" (default), "pulsar", "nats", "file", or "devnull". Topics can
+	// override it.
+	Backend string `yaml:"backend" enum:"kafka,pulsar,nats,file,devnull"`
+
+	// Hardened is a baseline for internet-facing deployments: it requires
+	// TLS (inbound and to the broker) and authentication, keeps Kafka
+	// credentials out of the config file, answers errors without detail,
+	// checks request content types strictly, and limits bandwidth per
+	// principal unless configured otherwise.
+	Hardened bool `yaml:"hardened"`
+
 	Server ServerConfig `yaml:"server"`
 	Auth   AuthConfig   `yaml:"auth"`
 	Kafka  KafkaConfig  `yaml:"kafka"`
+	Pulsar PulsarConfig `yaml:"pulsar"`
+	NATS   NATSConfig   `yaml:"nats"`
+	File   FileConfig   `yaml:"file"`
+	Limits LimitsConfig `yaml:"limits"`
+	Admin  AdminConfig  `yaml:"admin"`
+	SLO    SLOConfig    `yaml:"slo"`
+	GeoIP  GeoIPConfig  `yaml:"geoip"`
+	Record RecordConfig `yaml:"record"`
+	Clock  ClockConfig  `yaml:"clock"`
+	Usage  UsageConfig  `yaml:"usage"`
+
+	Quarantine QuarantineConfig `yaml:"quarantine"`
+	DeadLetter DeadLetterConfig `yaml:"dead_letter"`
+	Audit      AuditConfig      `yaml:"audit"`
+	Receipts   ReceiptsConfig   `yaml:"receipts"`
+	AccessLog  AccessLogConfig  `yaml:"access_log"`
+	Drift      DriftConfig      `yaml:"drift"`
+	Tracing    TracingConfig    `yaml:"tracing"`
+	Startup    StartupConfig    `yaml:"startup"`
+	Reload     ReloadConfig     `yaml:"reload"`
+
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	LoadSignal  LoadSignalConfig  `yaml:"load_signal"`
+
+	LeaderElection LeaderElectionConfig `yaml:"leader_election"`
+
+	// Routes lists webhook endpoints with their topic and options. It is the
+	// preferred way to configure per-route behaviour; see RouteConfig.
+	Routes []RouteConfig `yaml:"routes"`
+
+	// Topics holds per-topic settings keyed by topic name.
+	Topics map[string]TopicConfig `yaml:"topics"`
+}
+
+// TopicConfig holds settings that apply to a single topic.
+type TopicConfig struct {
+	// Payload is how non-JSON bodies are handled: "raw" (default) forwards
+	// them unchanged, "base64" wraps them in a JSON envelope, and "json_only"
+	// rejects them.
+	Payload string `yaml:"payload" enum:"raw,base64,json_only"`
+
+	// Ordering is "" (default) or "strict". Strict topics are produced
+	// through a dedicated ordering-safe producer (see
+	// KafkaConfig.StrictOrdering) and messages with the same key are sent one
+	// at a time, trading throughput for guaranteed per-key order.
+	Ordering string `yaml:"ordering" enum:"strict"`
+
+	// Partitioning is how keyless messages are assigned partitions:
+	// "sticky" (default) leaves it to librdkafka's sticky partitioner, and
+	// "round_robin" cycles through the topic's partitions one message at a
+	// time, for throughput topics where bursts turn sticky batches into hot
+	// partitions. Keyed messages are always hashed.
+	Partitioning string `yaml:"partitioning" enum:"sticky,round_robin"`
+
+	// Backend overrides the top-level backend for this topic.
+	Backend string `yaml:"backend" enum:"kafka,pulsar,nats,file,devnull"`
+
+	// Priority is the topic's class under limits.priority: "high",
+	// "normal" (default), or "low".
+	Priority string `yaml:"priority" enum:"high,normal,low"`
+
+	// Response is the format of webhook responses unless the sender's
+	// Accept header asks for JSON or text: "json" (default), "text"
+	// (text/plain "key: value" lines), or "none" (no body; 204 on success).
+	Response string `yaml:"response" enum:"json,text,none"`
+
+	// Signature verifies the provider's webhook signature; see
+	// SignatureConfig.
+	Signature SignatureConfig `yaml:"signature"`
+
+	// KeyHash hashes message keys before producing; see KeyHashConfig.
+	KeyHash KeyHashConfig `yaml:"key_hash"`
+
+	// Key derives message keys from the payload; see KeyConfig.
+	Key KeyConfig `yaml:"key"`
+
+	// Schema is the path of a JSON Schema file payloads must match; see
+	// PayloadSchemas.
+	Schema string `yaml:"schema"`
+
+	// CloudEvents emits messages as CloudEvents; see CloudEventsConfig.
+	CloudEvents CloudEventsConfig `yaml:"cloudevents"`
+
+	// Compression is what happens to gzip and deflate bodies, which are
+	// always decompressed for checks and transforms: "decompress" (default)
+	// produces the decompressed payload, and "keep" produces it compressed
+	// with a Content-Encoding header naming the encoding.
+	Compression string `yaml:"compression" enum:"decompress,keep"`
+
+	// MaxBodyBytes overrides server.max_body_bytes for the topic's
+	// webhooks, for topics whose payloads are legitimately larger or
+	// should be kept smaller.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
 }
 
 type ServerConfig struct {
@@ -21,28 +152,378 @@ type ServerConfig struct {
 	WriteTimeout  int      `yaml:"write_timeout"`
 	IdleTimeout   int      `yaml:"idle_timeout"`
 	AllowedTopics []string `yaml:"allowed_topics"`
+	StrictRoutes  bool     `yaml:"strict_routes"`
+
+	// RoutePathsOnly serves a topic whose routes all have a path of their
+	// own only at those paths, not also at /<topic>, so clients cannot get
+	// around an alias by naming the Kafka topic.
+	RoutePathsOnly bool `yaml:"route_paths_only"`
+
+	// Host is the address to bind (e.g. "::1", "10.0.0.5"); empty binds all
+	// interfaces. AddressFamily is "dual" (default), "ipv4", or "ipv6"
+	// (IPv6-only, refusing IPv4-mapped connections).
+	Host          string `yaml:"host"`
+	AddressFamily string `yaml:"address_family" enum:"dual,ipv4,ipv6"`
+
+	ProxyProtocol ProxyProtocolConfig `yaml:"proxy_protocol"`
+	ClientIP      ClientIPConfig      `yaml:"client_ip"`
+
+	TLS TLSConfig `yaml:"tls"`
+
+	// ResponseSigning signs webhook responses; see ResponseSigningConfig.
+	ResponseSigning ResponseSigningConfig `yaml:"response_signing"`
+
+	// MaxBodyBytes bounds webhook bodies; larger ones are rejected with
+	// 413. Zero means DefaultMaxBodyBytes. Topics and routes may set their
+	// own limit.
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
+
+	// MaxConnectionAge (seconds) recycles keep-alive connections once they
+	// reach this age; 0 keeps them until idle_timeout or the client closes.
+	MaxConnectionAge int `yaml:"max_connection_age"`
+
+	// ReadHeaderTimeout (seconds) bounds reading request headers,
+	// MinBodyRate (bytes per second) is the slowest average rate a body may
+	// arrive at, and MaxRequestsPerConnection closes keep-alive connections
+	// after that many requests. Zero disables each.
+	ReadHeaderTimeout        int `yaml:"read_header_timeout"`
+	MinBodyRate              int `yaml:"min_body_rate"`
+	MaxRequestsPerConnection int `yaml:"max_requests_per_connection"`
+
+	// MaxHeaderBytes is the most request header bytes read before the
+	// request is refused with 431 (default 1 MiB); limits.max_header_bytes
+	// is the limit applied, or quarantined, below it. MaxConnections is the
+	// most connections served at once, with further clients waiting in the
+	// listen backlog; zero allows any number. DisableHTTP2 serves HTTPS over
+	// HTTP/1.1 only, and DisableKeepAlives closes each connection after one
+	// response.
+	MaxHeaderBytes    int  `yaml:"max_header_bytes"`
+	MaxConnections    int  `yaml:"max_connections"`
+	DisableHTTP2      bool `yaml:"disable_http2"`
+	DisableKeepAlives bool `yaml:"disable_keep_alives"`
+
+	ProduceQueue ProduceQueueConfig `yaml:"produce_queue"`
+	Batch        BatchConfig        `yaml:"batch"`
+	Readiness    ReadinessConfig    `yaml:"readiness"`
+	Probes       ProbeConfig        `yaml:"probes"`
+	Logging      LoggingConfig      `yaml:"logging"`
+
+	// ScannerPaths are path prefixes probed by bots and vulnerability
+	// scanners. They are answered with a 404 that is neither logged nor
+	// counted as a request error, unless they are a configured route or
+	// topic. Defaults to defaultScannerPaths; set an empty list to turn it
+	// off.
+	ScannerPaths []string `yaml:"scanner_paths"`
+
+	// IDScheme is how request IDs and message IDs are generated: "uuidv4"
+	// (default), or "uuidv7", "ulid", or "ksuid", which sort by creation
+	// time.
+	IDScheme string `yaml:"id_scheme" enum:"uuidv4,uuidv7,ulid,ksuid"`
+}
+
+// defaultScannerPaths are commonly probed paths that no webhook uses.
+var defaultScannerPaths = []string{
+	"/.env", "/.git", "/.aws", "/.ssh", "/.DS_Store", "/.well-known/security.txt",
+	"/wp-admin", "/wp-login.php", "/wp-content", "/wp-includes", "/xmlrpc.php",
+	"/phpmyadmin", "/vendor/phpunit", "/cgi-bin",
+	"/actuator", "/server-status", "/boaform", "/HNAP1",
+	"/favicon.ico", "/robots.txt",
+}
+
+// ProduceQueueConfig produces each topic through its own worker goroutines
+// fed by a queue of Depth messages. Depth 0 (default) produces inline from
+// the request handler; Workers defaults to 4 per topic.
+type ProduceQueueConfig struct {
+	Depth   int `yaml:"depth"`
+	Workers int `yaml:"workers"`
+}
+
+// ReadinessConfig fails /ready while the instance is overloaded: when any
+// topic's produce queue is at least QueueSaturation full, or at least
+// ErrorRate of the last minute's produces (once there are MinRequests of
+// them) failed, for Sustain seconds. Zero thresholds are not checked.
+type ReadinessConfig struct {
+	QueueSaturation float64 `yaml:"queue_saturation"`
+	ErrorRate       float64 `yaml:"error_rate"`
+	MinRequests     int     `yaml:"min_requests"`
+	Sustain         int     `yaml:"sustain"`
+}
+
+// TLSConfig serves HTTPS with the certificate and key in CertFile and
+// KeyFile (PEM). Offloaded declares that a load balancer in front of kahook
+// terminates TLS instead; responses then still carry HSTS.
+type TLSConfig struct {
+	CertFile  string `yaml:"cert_file"`
+	KeyFile   string `yaml:"key_file"`
+	Offloaded bool   `yaml:"offloaded"`
+}
+
+// ProxyProtocolConfig accepts PROXY protocol v1/v2 headers from load
+// balancers in TrustedCIDRs. With Required, trusted connections without a
+// header are rejected; otherwise they are served with their own address.
+type ProxyProtocolConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	TrustedCIDRs []string `yaml:"trusted_cidrs"`
+	Required     bool     `yaml:"required"`
 }
 
 type AuthConfig struct {
 	Type   string       `yaml:"type"`
 	Users  []UserConfig `yaml:"users"`
-	Tokens []string     `yaml:"tokens"`
+	Tokens []string     `yaml:"tokens" secret:"true"`
+
+	// MetricsTokens are read-only bearer tokens for monitoring systems: they
+	// are accepted on /metrics and nowhere else.
+	MetricsTokens []string `yaml:"metrics_tokens" secret:"true"`
+
+	// DormantAfter (seconds) logs a warning when a credential is used after
+	// going unused this long; 0 disables it. Usage is tracked in memory, so
+	// the clock starts at each restart.
+	DormantAfter int `yaml:"dormant_after"`
+
+	// Realm is the realm in WWW-Authenticate challenges (default "kahook").
+	// Challenge selects the challenge sent with 401 responses: "auto"
+	// (default; Bearer for bearer requests, Basic otherwise), "basic",
+	// "bearer", or "none" to send no challenge, which keeps browsers behind
+	// a proxying dashboard from showing a login prompt.
+	Realm     string `yaml:"realm"`
+	Challenge string `yaml:"challenge" enum:"auto,basic,bearer,none"`
+
+	JWT JWTConfig `yaml:"jwt"`
+
+	// Scopes limits principals to the topics they may publish to: topic
+	// names, prefixes ending in "*", or "*" for all. Principals are Basic
+	// usernames, token fingerprints, or "jwt:" and a JWT subject; those not
+	// listed may publish to any topic, unless a JWT carries scopes (see
+	// JWTConfig.ScopePrefix) or DenyUnlisted is set, which allows them no
+	// topic.
+	Scopes       map[string][]string `yaml:"scopes"`
+	DenyUnlisted bool                `yaml:"deny_unlisted"`
 }
 
 type UserConfig struct {
 	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	Password string `yaml:"password" secret:"true"`
 }
 
 type KafkaConfig struct {
+	// Profile adapts defaults and validation to a Kafka-compatible service:
+	// "" (Apache Kafka / Confluent), "redpanda", or "eventhubs".
+	Profile string `yaml:"profile"`
+
+	// Client selects the Kafka client: "librdkafka" (default; requires cgo)
+	// or "native", a pure-Go client for static binaries. See
+	// KafkaClientNative.
+	Client string `yaml:"client" enum:"librdkafka,native"`
+
 	Brokers          []string `yaml:"brokers"`
 	SASLUsername     string   `yaml:"sasl_username"`
-	SASLPassword     string   `yaml:"sasl_password"`
+	SASLPassword     string   `yaml:"sasl_password" secret:"true"`
 	SASLMechanism    string   `yaml:"sasl_mechanism"`
 	SecurityProtocol string   `yaml:"security_protocol"`
 	Acks             string   `yaml:"acks"`
 	Retries          int      `yaml:"retries"`
 	CompressionType  string   `yaml:"compression_type"`
+
+	// ClientID and ClientRack set client.id and client.rack. Both accept
+	// {hostname}, {pod_name}, {pod_namespace}, and {env:VAR} placeholders, so
+	// one config can give every replica its own identity and zone.
+	ClientID   string `yaml:"client_id"`
+	ClientRack string `yaml:"client_rack"`
+
+	Pool PoolConfig `yaml:"pool"`
+
+	// StrictOrdering selects how the producer for strict-ordering topics
+	// avoids reordering on retries: "idempotence" (default; enable.idempotence)
+	// or "single_in_flight" (max.in.flight.requests.per.connection=1, for
+	// brokers without idempotent producer support).
+	StrictOrdering string `yaml:"strict_ordering" enum:"idempotence,single_in_flight"`
+
+	// Preflight checks at startup that the principal can write to every
+	// configured topic: "off" (default), "warn" (log denied topics), or
+	// "fail" (refuse to start).
+	Preflight string `yaml:"preflight" enum:"off,warn,fail"`
+
+	// Drain bounds the flush of buffered messages at shutdown and can spill
+	// the undelivered ones to disk.
+	Drain DrainConfig `yaml:"drain"`
+
+	// EnableIdempotence makes the brokers discard duplicates of messages the
+	// producer retries. Transactional implies it.
+	EnableIdempotence bool                `yaml:"enable_idempotence"`
+	Transactional     TransactionalConfig `yaml:"transactional"`
+}
+
+// PoolConfig sizes the producer pool. Strategy is "consistent_hash" (messages
+// with the same key always use the same producer) or "round_robin" (keys are
+// ignored; no per-key ordering across producers).
+type PoolConfig struct {
+	Size     int    `yaml:"size"`
+	Strategy string `yaml:"strategy" enum:"consistent_hash,round_robin"`
+}
+
+// PulsarConfig configures the Pulsar backend, which publishes through the
+// broker's REST producer API.
+type PulsarConfig struct {
+	ServiceURL    string `yaml:"service_url" secret:"url"`
+	Tenant        string `yaml:"tenant"`
+	Namespace     string `yaml:"namespace"`
+	NonPersistent bool   `yaml:"non_persistent"`
+	Token         string `yaml:"token" secret:"true"`
+	// HealthTopic is the topic /ready looks up; the token needs produce or
+	// consume permission on it. Empty uses the topic last produced to.
+	HealthTopic string `yaml:"health_topic"`
+}
+
+// NATSConfig configures the NATS JetStream backend. Topics are published to
+// SubjectPrefix + topic, which must be captured by a JetStream stream.
+type NATSConfig struct {
+	URL           string `yaml:"url" secret:"url"`
+	SubjectPrefix string `yaml:"subject_prefix"`
+	Username      string `yaml:"username"`
+	Password      string `yaml:"password" secret:"true"`
+	Token         string `yaml:"token" secret:"true"`
+	TLS           bool   `yaml:"tls"`
+}
+
+// FileConfig configures the file sink backend.
+type FileConfig struct {
+	// Path is the file records are appended to; "-" writes to stdout.
+	Path string `yaml:"path"`
+}
+
+// RecordConfig records every incoming webhook as a fixture file in Dir, for
+// replaying real provider payloads in tests. It is meant for development and
+// staging: bodies are stored as received, with only configured secrets
+// masked.
+type RecordConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// AdminConfig configures the authenticated /admin endpoints.
+type AdminConfig struct {
+	Verify VerifyConfig `yaml:"verify"`
+	Tail   TailConfig   `yaml:"tail"`
+
+	// Listener serves the admin API on its own port; see
+	// AdminListenerConfig.
+	Listener AdminListenerConfig `yaml:"listener"`
+}
+
+// VerifyConfig enables /admin/verify, which produces a probe message to Topic
+// and consumes it back. Timeout is in seconds.
+type VerifyConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Topic   string `yaml:"topic"`
+	Timeout int    `yaml:"timeout"`
+}
+
+// TailConfig enables /admin/tail, a Server-Sent Events stream of the
+// messages being produced. At most MaxSubscribers streams are open at once,
+// and each event carries up to MaxBodyBytes of the message; zero sends
+// metadata only.
+type TailConfig struct {
+	Enabled        bool `yaml:"enabled"`
+	MaxSubscribers int  `yaml:"max_subscribers"`
+	MaxBodyBytes   int  `yaml:"max_body_bytes"`
+}
+
+// SLOConfig sets a produce latency objective: Target (e.g. 0.99) of produces
+// must succeed within ProduceLatencyMs. Zero ProduceLatencyMs disables it.
+type SLOConfig struct {
+	ProduceLatencyMs int     `yaml:"produce_latency_ms"`
+	Target           float64 `yaml:"target"`
+}
+
+// LeaderElectionConfig elects one replica, through a Kubernetes Lease, to run
+// background tasks that must not run on every replica. Identity and
+// Namespace accept the same placeholders as kafka.client_id; an empty
+// Namespace is the pod's own. Durations are in seconds.
+type LeaderElectionConfig struct {
+	Enabled       bool   `yaml:"enabled"`
+	LeaseName     string `yaml:"lease_name"`
+	Namespace     string `yaml:"namespace"`
+	Identity      string `yaml:"identity"`
+	LeaseDuration int    `yaml:"lease_duration"`
+	RenewDeadline int    `yaml:"renew_deadline"`
+	RetryPeriod   int    `yaml:"retry_period"`
+}
+
+// LimitsConfig groups admission limits applied before producing.
+type LimitsConfig struct {
+	Requests  RequestRateConfig `yaml:"requests"`
+	Bandwidth BandwidthConfig   `yaml:"bandwidth"`
+	Exempt    ExemptConfig      `yaml:"exempt"`
+	Priority  PriorityConfig    `yaml:"priority"`
+
+	ErrorBudget ErrorBudgetConfig `yaml:"error_budget"`
+	ConsumerLag ConsumerLagConfig `yaml:"consumer_lag"`
+
+	// MaxHeaderBytes is a soft limit on the size of a webhook's headers:
+	// larger requests are rejected with 431, or quarantined. 0 disables it.
+	MaxHeaderBytes int `yaml:"max_header_bytes"`
+
+	// MaxDecompressedBytes bounds what a gzip or deflate body may
+	// decompress to; larger bodies are rejected with 413. 0 means the
+	// webhook's body limit.
+	MaxDecompressedBytes int `yaml:"max_decompressed_bytes"`
+}
+
+// ExemptConfig lists traffic that bypasses every limit, such as internal
+// backfills that legitimately exceed limits meant for external providers.
+// Principals are Basic usernames or bearer token fingerprints ("token:" and
+// 8 hex digits, as shown on /admin/credentials); CIDRs are client IPs or
+// networks; Routes are topic names or route paths.
+type ExemptConfig struct {
+	Principals []string `yaml:"principals"`
+	CIDRs      []string `yaml:"cidrs"`
+	Routes     []string `yaml:"routes"`
+}
+
+// Networks parses CIDRs, accepting bare IPs as single-address networks.
+func (e ExemptConfig) Networks() ([]netip.Prefix, error) {
+	return parseNetworks(e.CIDRs)
+}
+
+// parseNetworks parses IPs and CIDRs, accepting bare IPs as single-address
+// networks.
+func parseNetworks(cidrs []string) ([]netip.Prefix, error) {
+	nets := make([]netip.Prefix, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			addr, err := netip.ParseAddr(c)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", c)
+			}
+			addr = addr.Unmap()
+			nets = append(nets, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q", c)
+		}
+		nets = append(nets, p.Masked())
+	}
+	return nets, nil
+}
+
+// BandwidthConfig limits request body bytes per second. PerTopic and
+// PerPrincipal are the defaults applied to every topic and every
+// authenticated principal; Topics and Principals override them by name.
+// A zero rate disables the corresponding limit.
+type BandwidthConfig struct {
+	PerTopic     ByteRate            `yaml:"per_topic"`
+	PerPrincipal ByteRate            `yaml:"per_principal"`
+	Topics       map[string]ByteRate `yaml:"topics"`
+	Principals   map[string]ByteRate `yaml:"principals"`
+}
+
+// ByteRate is a sustained byte rate with an optional burst allowance.
+// BurstBytes defaults to one second's worth of BytesPerSecond.
+type ByteRate struct {
+	BytesPerSecond int64 `yaml:"bytes_per_second"`
+	BurstBytes     int64 `yaml:"burst_bytes"`
 }
 
 func Load(configPath string) (*Config, error) {
@@ -51,26 +532,114 @@ func Load(configPath string) (*Config, error) {
 	if err := loadFile(cfg, configPath); err != nil {
 		return nil, err
 	}
+	saslPasswordInFile := cfg.Kafka.SASLPassword != ""
 
 	applyEnv(cfg)
+	applyClientIdentity(cfg)
+	applyKafkaProfile(cfg)
+	applyKafkaClient(cfg)
+	applyHardened(cfg)
+	if err := applyRoutes(cfg); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
 
 	if err := validate(cfg); err != nil {
 		return nil, fmt.Errorf("config validation failed: %w", err)
 	}
+	if err := validateHardened(cfg, saslPasswordInFile); err != nil {
+		return nil, fmt.Errorf("config validation failed: %w", err)
+	}
 
 	return cfg, nil
 }
 
 func defaults() *Config {
 	return &Config{
+		Profile: ProfileDefault,
+		Backend: BackendKafka,
 		Server: ServerConfig{
 			Port:         8080,
 			ReadTimeout:  10,
 			WriteTimeout: 10,
 			IdleTimeout:  60,
+
+			ReadHeaderTimeout: 5,
+
+			Readiness: ReadinessConfig{
+				MinRequests: 20,
+				Sustain:     30,
+			},
+			ScannerPaths: slices.Clone(defaultScannerPaths),
+			IDScheme:     "uuidv4",
 		},
 		Auth: AuthConfig{
 			Type: "none",
+			JWT: JWTConfig{
+				Leeway:          60,
+				RefreshInterval: 3600,
+			},
+		},
+		Pulsar: PulsarConfig{
+			ServiceURL: "http://localhost:8080",
+			Tenant:     "public",
+			Namespace:  "default",
+		},
+		File: FileConfig{
+			Path: "-",
+		},
+		SLO: SLOConfig{
+			Target: 0.99,
+		},
+		GeoIP: GeoIPConfig{
+			Header: defaultCountryHeader,
+		},
+		Clock: ClockConfig{
+			MaxSkewMs: 1000,
+			Interval:  300,
+		},
+		Drift: DriftConfig{
+			Interval: 300,
+		},
+		DeadLetter: DeadLetterConfig{
+			BackoffMs: 200,
+		},
+		Idempotency: IdempotencyConfig{
+			DuplicateStatus: 200,
+			Redis:           IdempotencyRedisConfig{KeyPrefix: "kahook:"},
+		},
+		Tracing: TracingConfig{
+			OTLP: OTLPConfig{
+				ServiceName: "kahook",
+				SampleRatio: 1,
+			},
+		},
+		Usage: UsageConfig{
+			Header:   defaultTenantHeader,
+			Instance: "{pod_name}",
+		},
+		Limits: LimitsConfig{
+			Priority: PriorityConfig{
+				ShedLowAt:    0.5,
+				ShedNormalAt: 0.8,
+				Header:       defaultPriorityHeader,
+			},
+		},
+		LeaderElection: LeaderElectionConfig{
+			LeaseName:     "kahook-leader",
+			Identity:      "{pod_name}",
+			LeaseDuration: 15,
+			RenewDeadline: 10,
+			RetryPeriod:   2,
+		},
+		Admin: AdminConfig{
+			Verify: VerifyConfig{
+				Topic:   "kahook-verify",
+				Timeout: 10,
+			},
+			Tail: TailConfig{
+				MaxSubscribers: 4,
+				MaxBodyBytes:   1024,
+			},
 		},
 		Kafka: KafkaConfig{
 			Brokers:          []string{"localhost:9092"},
@@ -79,6 +648,17 @@ func defaults() *Config {
 			CompressionType:  "snappy",
 			SASLMechanism:    "PLAIN",
 			SecurityProtocol: "PLAINTEXT",
+			Pool: PoolConfig{
+				Size:     1,
+				Strategy: "consistent_hash",
+			},
+			StrictOrdering: "idempotence",
+			Drain:          DrainConfig{FlushTimeout: 5},
+			Transactional: TransactionalConfig{
+				ID:          "kahook-{pod_name}",
+				Timeout:     60,
+				MaxMessages: 100,
+			},
 		},
 	}
 }
@@ -103,16 +683,73 @@ func loadFile(cfg *Config, path string) error {
 		return fmt.Errorf("error reading config file: %w", err)
 	}
 
-	if err := yaml.Unmarshal(data, cfg); err != nil {
+	return decodeFile(cfg, data, path)
+}
+
+// decodeFile decodes a config file's contents into cfg, checking it against
+// the schema first. name identifies the file in errors.
+func decodeFile(cfg *Config, data []byte, name string) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("error parsing config file: %w", err)
+	}
+	if err := checkSchema(&doc); err != nil {
+		return fmt.Errorf("invalid config file %s:\n%w", name, err)
+	}
+	if err := doc.Decode(cfg); err != nil {
 		return fmt.Errorf("error parsing config file: %w", err)
 	}
-
 	return nil
 }
 
 // applyEnv overrides config fields from environment variables.
 // Only non-empty env vars override the current value.
 func applyEnv(cfg *Config) {
+	if v := os.Getenv("KAHOOK_PROFILE"); v != "" {
+		cfg.Profile = v
+	}
+	if v := os.Getenv("BACKEND"); v != "" {
+		cfg.Backend = v
+	}
+	if v := os.Getenv("HARDENED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Hardened = b
+		}
+	}
+	if v := os.Getenv("PULSAR_SERVICE_URL"); v != "" {
+		cfg.Pulsar.ServiceURL = v
+	}
+	if v := os.Getenv("PULSAR_TENANT"); v != "" {
+		cfg.Pulsar.Tenant = v
+	}
+	if v := os.Getenv("PULSAR_NAMESPACE"); v != "" {
+		cfg.Pulsar.Namespace = v
+	}
+	if v := os.Getenv("PULSAR_TOKEN"); v != "" {
+		cfg.Pulsar.Token = v
+	}
+	if v := os.Getenv("PULSAR_HEALTH_TOPIC"); v != "" {
+		cfg.Pulsar.HealthTopic = v
+	}
+	if v := os.Getenv("NATS_URL"); v != "" {
+		cfg.NATS.URL = v
+	}
+	if v := os.Getenv("NATS_SUBJECT_PREFIX"); v != "" {
+		cfg.NATS.SubjectPrefix = v
+	}
+	if v := os.Getenv("NATS_USERNAME"); v != "" {
+		cfg.NATS.Username = v
+	}
+	if v := os.Getenv("NATS_PASSWORD"); v != "" {
+		cfg.NATS.Password = v
+	}
+	if v := os.Getenv("NATS_TOKEN"); v != "" {
+		cfg.NATS.Token = v
+	}
+	if v := os.Getenv("FILE_SINK_PATH"); v != "" {
+		cfg.File.Path = v
+	}
+
 	if v := os.Getenv("SERVER_PORT"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
 			cfg.Server.Port = n
@@ -133,6 +770,129 @@ func applyEnv(cfg *Config) {
 			cfg.Server.IdleTimeout = n
 		}
 	}
+	if v := os.Getenv("SERVER_HOST"); v != "" {
+		cfg.Server.Host = v
+	}
+	if v := os.Getenv("SERVER_ADDRESS_FAMILY"); v != "" {
+		cfg.Server.AddressFamily = v
+	}
+	if v := os.Getenv("SERVER_TLS_CERT_FILE"); v != "" {
+		cfg.Server.TLS.CertFile = v
+	}
+	if v := os.Getenv("SERVER_TLS_KEY_FILE"); v != "" {
+		cfg.Server.TLS.KeyFile = v
+	}
+	if v := os.Getenv("SERVER_RESPONSE_SIGNING_KEY_FILE"); v != "" {
+		cfg.Server.ResponseSigning.KeyFile = v
+	}
+	if v := os.Getenv("SERVER_RESPONSE_SIGNING_KEY_ID"); v != "" {
+		cfg.Server.ResponseSigning.KeyID = v
+	}
+	if v := os.Getenv("SERVER_TLS_OFFLOADED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.TLS.Offloaded = b
+		}
+	}
+	if v := os.Getenv("SERVER_PROXY_PROTOCOL"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.ProxyProtocol.Enabled = b
+		}
+	}
+	if v := os.Getenv("SERVER_PROXY_PROTOCOL_TRUSTED_CIDRS"); v != "" {
+		cfg.Server.ProxyProtocol.TrustedCIDRs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("SERVER_CLIENT_IP_HEADER"); v != "" {
+		cfg.Server.ClientIP.Header = v
+	}
+	if v := os.Getenv("SERVER_CLIENT_IP_TRUSTED_CIDRS"); v != "" {
+		cfg.Server.ClientIP.TrustedCIDRs = strings.Split(v, ",")
+	}
+	if v := os.Getenv("SERVER_MAX_BODY_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Server.MaxBodyBytes = n
+		}
+	}
+	if v := os.Getenv("SERVER_MAX_CONNECTION_AGE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.MaxConnectionAge = n
+		}
+	}
+	if v := os.Getenv("SERVER_READ_HEADER_TIMEOUT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.ReadHeaderTimeout = n
+		}
+	}
+	if v := os.Getenv("SERVER_MIN_BODY_RATE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.MinBodyRate = n
+		}
+	}
+	if v := os.Getenv("SERVER_MAX_REQUESTS_PER_CONNECTION"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.MaxRequestsPerConnection = n
+		}
+	}
+	if v := os.Getenv("SERVER_MAX_HEADER_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.MaxHeaderBytes = n
+		}
+	}
+	if v := os.Getenv("SERVER_MAX_CONNECTIONS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.MaxConnections = n
+		}
+	}
+	if v := os.Getenv("SERVER_DISABLE_HTTP2"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.DisableHTTP2 = b
+		}
+	}
+	if v := os.Getenv("SERVER_DISABLE_KEEP_ALIVES"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.DisableKeepAlives = b
+		}
+	}
+	if v := os.Getenv("SERVER_BATCH_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.Batch.Enabled = b
+		}
+	}
+	if v := os.Getenv("SERVER_BATCH_MAX_RECORDS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.Batch.MaxRecords = n
+		}
+	}
+	if v := os.Getenv("SERVER_PRODUCE_QUEUE_DEPTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.ProduceQueue.Depth = n
+		}
+	}
+	if v := os.Getenv("SERVER_PRODUCE_QUEUE_WORKERS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.ProduceQueue.Workers = n
+		}
+	}
+	if v := os.Getenv("SERVER_READY_QUEUE_SATURATION"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.Server.Readiness.QueueSaturation = f
+		}
+	}
+	if v := os.Getenv("SERVER_READY_ERROR_RATE"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.Server.Readiness.ErrorRate = f
+		}
+	}
+	if v := os.Getenv("SERVER_SCANNER_PATHS"); v != "" {
+		cfg.Server.ScannerPaths = strings.Split(v, ",")
+	}
+	if v := os.Getenv("SERVER_ID_SCHEME"); v != "" {
+		cfg.Server.IDScheme = v
+	}
+	if v := os.Getenv("SERVER_READY_SUSTAIN"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Server.Readiness.Sustain = n
+		}
+	}
 
 	if v := os.Getenv("AUTH_TYPE"); v != "" {
 		cfg.Auth.Type = v
@@ -140,6 +900,43 @@ func applyEnv(cfg *Config) {
 	if v := os.Getenv("AUTH_TOKENS"); v != "" {
 		cfg.Auth.Tokens = strings.Split(v, ",")
 	}
+	if v := os.Getenv("AUTH_METRICS_TOKENS"); v != "" {
+		cfg.Auth.MetricsTokens = strings.Split(v, ",")
+	}
+	if v := os.Getenv("ADMIN_PORT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Admin.Listener.Port = n
+		}
+	}
+	if v := os.Getenv("ADMIN_HOST"); v != "" {
+		cfg.Admin.Listener.Host = v
+	}
+	if v := os.Getenv("ADMIN_TOKENS"); v != "" {
+		cfg.Admin.Listener.Tokens = strings.Split(v, ",")
+	}
+	if v := os.Getenv("ADMIN_READ_ONLY_TOKENS"); v != "" {
+		cfg.Admin.Listener.ReadOnlyTokens = strings.Split(v, ",")
+	}
+	if v := os.Getenv("AUTH_DORMANT_AFTER"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Auth.DormantAfter = n
+		}
+	}
+	if v := os.Getenv("AUTH_REALM"); v != "" {
+		cfg.Auth.Realm = v
+	}
+	if v := os.Getenv("AUTH_CHALLENGE"); v != "" {
+		cfg.Auth.Challenge = v
+	}
+	if v := os.Getenv("AUTH_JWT_JWKS_URL"); v != "" {
+		cfg.Auth.JWT.JWKSURL = v
+	}
+	if v := os.Getenv("AUTH_JWT_ISSUER"); v != "" {
+		cfg.Auth.JWT.Issuer = v
+	}
+	if v := os.Getenv("AUTH_JWT_AUDIENCE"); v != "" {
+		cfg.Auth.JWT.Audience = strings.Split(v, ",")
+	}
 	if v := os.Getenv("AUTH_BASIC_USERS"); v != "" {
 		var users []UserConfig
 		for _, pair := range strings.Split(v, ",") {
@@ -157,58 +954,759 @@ func applyEnv(cfg *Config) {
 		cfg.Server.AllowedTopics = strings.Split(v, ",")
 	}
 
-	if v := os.Getenv("KAFKA_BROKERS"); v != "" {
-		cfg.Kafka.Brokers = strings.Split(v, ",")
+	if v := os.Getenv("SERVER_STRICT_ROUTES"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.StrictRoutes = b
+		}
 	}
-	if v := os.Getenv("KAFKA_SASL_USERNAME"); v != "" {
-		cfg.Kafka.SASLUsername = v
+	if v := os.Getenv("SERVER_PROBE_AUTH"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.Probes.Auth = b
+		}
 	}
-	if v := os.Getenv("KAFKA_SASL_PASSWORD"); v != "" {
-		cfg.Kafka.SASLPassword = v
+	if v := os.Getenv("SERVER_PROBE_BYPASS_CIDRS"); v != "" {
+		cfg.Server.Probes.BypassCIDRs = strings.Split(v, ",")
 	}
-	if v := os.Getenv("KAFKA_SASL_MECHANISM"); v != "" {
-		cfg.Kafka.SASLMechanism = v
+	if v := os.Getenv("SERVER_LOG_FORMAT"); v != "" {
+		cfg.Server.Logging.Format = v
 	}
-	if v := os.Getenv("KAFKA_SECURITY_PROTOCOL"); v != "" {
-		cfg.Kafka.SecurityProtocol = v
+	if v := os.Getenv("SERVER_LOG_FIELDS"); v != "" {
+		cfg.Server.Logging.Fields = strings.Split(v, ",")
 	}
-	if v := os.Getenv("KAFKA_ACKS"); v != "" {
-		cfg.Kafka.Acks = v
+	if v := os.Getenv("SERVER_LOG_SAMPLE_RATIO"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.Server.Logging.SampleRatio = f
+		}
 	}
-	if v := os.Getenv("KAFKA_RETRIES"); v != "" {
+	if v := os.Getenv("SERVER_ROUTE_PATHS_ONLY"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Server.RoutePathsOnly = b
+		}
+	}
+	if v := os.Getenv("SLO_PRODUCE_LATENCY_MS"); v != "" {
 		if n, err := strconv.Atoi(v); err == nil {
-			cfg.Kafka.Retries = n
+			cfg.SLO.ProduceLatencyMs = n
 		}
 	}
-	if v := os.Getenv("KAFKA_COMPRESSION_TYPE"); v != "" {
-		cfg.Kafka.CompressionType = v
+	if v := os.Getenv("SLO_TARGET"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			cfg.SLO.Target = f
+		}
 	}
-}
-
-func validate(cfg *Config) error {
-	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
-		return fmt.Errorf("invalid server port: %d", cfg.Server.Port)
+	if v := os.Getenv("RECORD_DIR"); v != "" {
+		cfg.Record.Dir = v
 	}
-
-	if len(cfg.Kafka.Brokers) == 0 {
-		return fmt.Errorf("kafka brokers cannot be empty")
+	if v := os.Getenv("CLOCK_NTP_SERVER"); v != "" {
+		cfg.Clock.NTPServer = v
 	}
-
-	for _, b := range cfg.Kafka.Brokers {
-		if strings.Contains(b, "REPLACE_VIA") {
-			return fmt.Errorf("kafka broker %q looks like an un-replaced placeholder — set KAFKA_BROKERS", b)
+	if v := os.Getenv("CLOCK_KAFKA_TOPIC"); v != "" {
+		cfg.Clock.KafkaTopic = v
+	}
+	if v := os.Getenv("CLOCK_MAX_SKEW_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Clock.MaxSkewMs = n
 		}
 	}
-
-	authType := strings.ToLower(cfg.Auth.Type)
-	if authType == "basic" && len(cfg.Auth.Users) == 0 {
-		return fmt.Errorf("auth.type is 'basic' but no users are configured")
+	if v := os.Getenv("CLOCK_INTERVAL"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Clock.Interval = n
+		}
 	}
-
-	if authType == "bearer" && len(cfg.Auth.Tokens) == 0 {
-		return fmt.Errorf("auth.type is 'bearer' but no tokens are configured")
+	if v := os.Getenv("USAGE_INTERVAL"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Usage.Interval = n
+		}
+	}
+	if v := os.Getenv("USAGE_TOPIC"); v != "" {
+		cfg.Usage.Topic = v
+	}
+	if v := os.Getenv("GEOIP_DATABASE"); v != "" {
+		cfg.GeoIP.Database = v
+	}
+	if v := os.Getenv("GEOIP_HEADER"); v != "" {
+		cfg.GeoIP.Header = v
+	}
+	if v := os.Getenv("ADMIN_VERIFY_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Admin.Verify.Enabled = b
+		}
+	}
+	if v := os.Getenv("ADMIN_VERIFY_TOPIC"); v != "" {
+		cfg.Admin.Verify.Topic = v
+	}
+	if v := os.Getenv("QUARANTINE_TOPIC"); v != "" {
+		cfg.Quarantine.Topic = v
+	}
+	if v := os.Getenv("DEAD_LETTER_TOPIC"); v != "" {
+		cfg.DeadLetter.Topic = v
+	}
+	if v := os.Getenv("DEAD_LETTER_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.DeadLetter.Retries = n
+		}
+	}
+	if v := os.Getenv("AUDIT_TOPIC"); v != "" {
+		cfg.Audit.Topic = v
+	}
+	if v := os.Getenv("RECEIPTS_TOPIC"); v != "" {
+		cfg.Receipts.Topic = v
+	}
+	if v := os.Getenv("IDEMPOTENCY_WINDOW"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Idempotency.Window = n
+		}
+	}
+	if v := os.Getenv("IDEMPOTENCY_REDIS_URL"); v != "" {
+		cfg.Idempotency.Redis.URL = v
+	}
+	if v := os.Getenv("LOAD_SIGNAL_TARGET_IN_FLIGHT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LoadSignal.TargetInFlight = n
+		}
+	}
+	if v := os.Getenv("LOAD_SIGNAL_TARGET_LATENCY_MS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.LoadSignal.TargetLatencyMs = n
+		}
+	}
+	if v := os.Getenv("ACCESS_LOG_TOPIC"); v != "" {
+		cfg.AccessLog.Topic = v
+	}
+	if v := os.Getenv("TRACING_HEADERS"); v != "" {
+		cfg.Tracing.Headers = v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); v != "" {
+		cfg.Tracing.OTLP.Endpoint = v
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"); v != "" {
+		cfg.Tracing.OTLP.Headers = parseOTLPHeaders(v)
+	}
+	if v := os.Getenv("OTEL_SERVICE_NAME"); v != "" {
+		cfg.Tracing.OTLP.ServiceName = v
+	}
+	switch os.Getenv("OTEL_LOGS_EXPORTER") {
+	case "otlp":
+		cfg.Tracing.OTLP.Logs = true
+	case "none":
+		cfg.Tracing.OTLP.Logs = false
+	}
+	if v := os.Getenv("STARTUP_PRODUCER"); v != "" {
+		cfg.Startup.Producer = v
+	}
+	if v := os.Getenv("STARTUP_RETRY_TIMEOUT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Startup.RetryTimeout = n
+		}
+	}
+	if v := os.Getenv("RELOAD_WATCH"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Reload.Watch = b
+		}
+	}
+	if v := os.Getenv("DRIFT_URL"); v != "" {
+		cfg.Drift.URL = v
+	}
+	if v := os.Getenv("DRIFT_TOKEN"); v != "" {
+		cfg.Drift.Token = v
+	}
+	if v := os.Getenv("DRIFT_INTERVAL"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Drift.Interval = n
+		}
+	}
+	if v := os.Getenv("LIMITS_MAX_HEADER_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Limits.MaxHeaderBytes = n
+		}
+	}
+	if v := os.Getenv("LIMITS_MAX_DECOMPRESSED_BYTES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Limits.MaxDecompressedBytes = n
+		}
+	}
+	if v := os.Getenv("ADMIN_TAIL_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Admin.Tail.Enabled = b
+		}
+	}
+	if v := os.Getenv("LEADER_ELECTION_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.LeaderElection.Enabled = b
+		}
+	}
+	if v := os.Getenv("LEADER_ELECTION_LEASE_NAME"); v != "" {
+		cfg.LeaderElection.LeaseName = v
+	}
+	if v := os.Getenv("LEADER_ELECTION_NAMESPACE"); v != "" {
+		cfg.LeaderElection.Namespace = v
+	}
+
+	if v := os.Getenv("KAFKA_PROFILE"); v != "" {
+		cfg.Kafka.Profile = v
+	}
+	if v := os.Getenv("KAFKA_CLIENT"); v != "" {
+		cfg.Kafka.Client = v
+	}
+	if v := os.Getenv("KAFKA_BROKERS"); v != "" {
+		cfg.Kafka.Brokers = strings.Split(v, ",")
+	}
+	if v := os.Getenv("KAFKA_SASL_USERNAME"); v != "" {
+		cfg.Kafka.SASLUsername = v
+	}
+	if v := os.Getenv("KAFKA_SASL_PASSWORD"); v != "" {
+		cfg.Kafka.SASLPassword = v
+	}
+	if v := os.Getenv("KAFKA_SASL_MECHANISM"); v != "" {
+		cfg.Kafka.SASLMechanism = v
+	}
+	if v := os.Getenv("KAFKA_SECURITY_PROTOCOL"); v != "" {
+		cfg.Kafka.SecurityProtocol = v
+	}
+	if v := os.Getenv("KAFKA_ACKS"); v != "" {
+		cfg.Kafka.Acks = v
+	}
+	if v := os.Getenv("KAFKA_RETRIES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Kafka.Retries = n
+		}
+	}
+	if v := os.Getenv("KAFKA_COMPRESSION_TYPE"); v != "" {
+		cfg.Kafka.CompressionType = v
+	}
+	if v := os.Getenv("KAFKA_POOL_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Kafka.Pool.Size = n
+		}
+	}
+	if v := os.Getenv("KAFKA_POOL_STRATEGY"); v != "" {
+		cfg.Kafka.Pool.Strategy = v
+	}
+	if v := os.Getenv("KAFKA_CLIENT_ID"); v != "" {
+		cfg.Kafka.ClientID = v
+	}
+	if v := os.Getenv("KAFKA_CLIENT_RACK"); v != "" {
+		cfg.Kafka.ClientRack = v
+	}
+	if v := os.Getenv("KAFKA_PREFLIGHT"); v != "" {
+		cfg.Kafka.Preflight = v
+	}
+	if v := os.Getenv("KAFKA_DRAIN_FLUSH_TIMEOUT"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.Kafka.Drain.FlushTimeout = n
+		}
+	}
+	if v := os.Getenv("KAFKA_DRAIN_SPILL_DIR"); v != "" {
+		cfg.Kafka.Drain.SpillDir = v
+	}
+	if v := os.Getenv("KAFKA_DRAIN_REPLAY"); v != "" {
+		cfg.Kafka.Drain.Replay = v
+	}
+	if v := os.Getenv("KAFKA_DRAIN_SPOOL_OUTAGES"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Kafka.Drain.SpoolOutages = b
+		}
+	}
+	if v := os.Getenv("KAFKA_DRAIN_SPILL_ENCRYPTION_KEY"); v != "" {
+		cfg.Kafka.Drain.SpillEncryptionKey = v
+	}
+	if v := os.Getenv("KAFKA_DRAIN_SPILL_MAX_BYTES"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.Kafka.Drain.SpillMaxBytes = n
+		}
+	}
+	if v := os.Getenv("KAFKA_ENABLE_IDEMPOTENCE"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Kafka.EnableIdempotence = b
+		}
+	}
+	if v := os.Getenv("KAFKA_TRANSACTIONAL_ENABLED"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.Kafka.Transactional.Enabled = b
+		}
+	}
+	if v := os.Getenv("KAFKA_TRANSACTIONAL_ID"); v != "" {
+		cfg.Kafka.Transactional.ID = v
+	}
+}
+
+func validate(cfg *Config) error {
+	if cfg.Server.Port < 1 || cfg.Server.Port > 65535 {
+		return fmt.Errorf("invalid server port: %d", cfg.Server.Port)
+	}
+
+	if err := validateListener(cfg.Server); err != nil {
+		return err
+	}
+
+	if cfg.Server.MaxConnectionAge < 0 {
+		return fmt.Errorf("server.max_connection_age must not be negative, got %d", cfg.Server.MaxConnectionAge)
+	}
+
+	if err := validateSlowClients(cfg.Server); err != nil {
+		return err
+	}
+	if err := validateConnections(cfg); err != nil {
+		return err
+	}
+
+	if err := validateBatch(cfg.Server.Batch); err != nil {
+		return err
+	}
+
+	if q := cfg.Server.ProduceQueue; q.Depth < 0 || q.Workers < 0 {
+		return fmt.Errorf("server.produce_queue depth and workers must not be negative, got %d and %d", q.Depth, q.Workers)
+	}
+
+	if err := validateReadiness(cfg.Server); err != nil {
+		return err
+	}
+
+	if err := validateScannerPaths(cfg.Server); err != nil {
+		return err
+	}
+
+	switch cfg.Server.IDScheme {
+	case "", "uuidv4", "uuidv7", "ulid", "ksuid":
+	default:
+		return fmt.Errorf("server.id_scheme: invalid value %q (want uuidv4, uuidv7, ulid, or ksuid)", cfg.Server.IDScheme)
+	}
+
+	switch cfg.Profile {
+	case "", ProfileDefault, ProfileDev:
+	default:
+		return fmt.Errorf("invalid profile %q: must be %q or %q", cfg.Profile, ProfileDefault, ProfileDev)
+	}
+
+	if cfg.Server.StrictRoutes && len(cfg.Server.AllowedTopics) == 0 {
+		return fmt.Errorf("server.strict_routes requires server.allowed_topics or routes to be set")
+	}
+
+	if err := validateRoutes(cfg.Routes); err != nil {
+		return err
 	}
 
+	for _, b := range cfg.Backends() {
+		if err := validateBackend(cfg, b); err != nil {
+			return err
+		}
+	}
+
+	if err := validateKafkaProfile(cfg.Kafka); err != nil {
+		return err
+	}
+
+	if err := validateClientIdentity(cfg.Kafka); err != nil {
+		return err
+	}
+
+	if err := validateDelivery(cfg); err != nil {
+		return err
+	}
+
+	if err := validateKafkaClient(cfg); err != nil {
+		return err
+	}
+
+	if cfg.Kafka.Pool.Size < 0 {
+		return fmt.Errorf("kafka.pool.size must not be negative, got %d", cfg.Kafka.Pool.Size)
+	}
+	switch cfg.Kafka.Pool.Strategy {
+	case "", "consistent_hash", "round_robin":
+	default:
+		return fmt.Errorf("kafka.pool.strategy: invalid value %q (want consistent_hash or round_robin)", cfg.Kafka.Pool.Strategy)
+	}
+
+	switch cfg.Kafka.StrictOrdering {
+	case "", "idempotence", "single_in_flight":
+	default:
+		return fmt.Errorf("kafka.strict_ordering: invalid value %q (want idempotence or single_in_flight)", cfg.Kafka.StrictOrdering)
+	}
+
+	switch cfg.Kafka.Preflight {
+	case "", "off", "warn", "fail":
+	default:
+		return fmt.Errorf("kafka.preflight: invalid value %q (want off, warn, or fail)", cfg.Kafka.Preflight)
+	}
+
+	if err := validateDrain(cfg.Kafka.Drain); err != nil {
+		return err
+	}
+
+	authType := strings.ToLower(cfg.Auth.Type)
+	if authType == "basic" && len(cfg.Auth.Users) == 0 {
+		return fmt.Errorf("auth.type is 'basic' but no users are configured")
+	}
+
+	if authType == "bearer" && len(cfg.Auth.Tokens) == 0 {
+		return fmt.Errorf("auth.type is 'bearer' but no tokens are configured")
+	}
+
+	if err := validateJWT(cfg.Auth); err != nil {
+		return err
+	}
+	if err := validateScopes(cfg.Auth); err != nil {
+		return err
+	}
+
+	for _, t := range cfg.Auth.MetricsTokens {
+		if t == "" {
+			return fmt.Errorf("auth.metrics_tokens must not contain empty tokens")
+		}
+		if slices.Contains(cfg.Auth.Tokens, t) {
+			return fmt.Errorf("auth.metrics_tokens: a metrics token is also listed in auth.tokens, which can publish")
+		}
+	}
+
+	if cfg.Auth.DormantAfter < 0 {
+		return fmt.Errorf("auth.dormant_after must not be negative, got %d", cfg.Auth.DormantAfter)
+	}
+
+	switch cfg.Auth.Challenge {
+	case "", "auto", "basic", "bearer", "none":
+	default:
+		return fmt.Errorf("auth.challenge: invalid value %q (want auto, basic, bearer, or none)", cfg.Auth.Challenge)
+	}
+	if strings.IndexFunc(cfg.Auth.Realm, unicode.IsControl) >= 0 {
+		return fmt.Errorf("auth.realm must not contain control characters")
+	}
+
+	if err := validateRequestRate(cfg.Limits.Requests); err != nil {
+		return err
+	}
+	if err := validateErrorBudget(cfg.Limits.ErrorBudget); err != nil {
+		return err
+	}
+	if err := validateConsumerLag(cfg); err != nil {
+		return err
+	}
+	if err := validateBandwidth(cfg.Limits.Bandwidth); err != nil {
+		return err
+	}
+	if err := validateExempt(cfg.Limits.Exempt); err != nil {
+		return err
+	}
+	if err := validateProbes(cfg.Server.Probes); err != nil {
+		return err
+	}
+	if err := validateLogging(cfg.Server.Logging); err != nil {
+		return err
+	}
+	if err := validateClientIP(cfg.Server.ClientIP); err != nil {
+		return err
+	}
+	if err := validatePriority(cfg); err != nil {
+		return err
+	}
+
+	if cfg.SLO.ProduceLatencyMs < 0 {
+		return fmt.Errorf("slo.produce_latency_ms must not be negative, got %d", cfg.SLO.ProduceLatencyMs)
+	}
+	if cfg.SLO.ProduceLatencyMs > 0 && (cfg.SLO.Target <= 0 || cfg.SLO.Target >= 1) {
+		return fmt.Errorf("slo.target must be between 0 and 1 exclusive, got %v", cfg.SLO.Target)
+	}
+
+	if v := cfg.Admin.Verify; v.Enabled {
+		if v.Topic == "" {
+			return fmt.Errorf("admin.verify.topic is required when admin.verify is enabled")
+		}
+		if v.Timeout < 0 {
+			return fmt.Errorf("admin.verify.timeout must not be negative, got %d", v.Timeout)
+		}
+		if authType == "" || authType == "none" {
+			return fmt.Errorf("admin.verify writes to kafka and requires auth.type basic, bearer, or jwt")
+		}
+		if cfg.DefaultBackend() != BackendKafka {
+			return fmt.Errorf("admin.verify requires the kafka backend, default backend is %q", cfg.DefaultBackend())
+		}
+	}
+	if t := cfg.Admin.Tail; t.Enabled {
+		if t.MaxSubscribers <= 0 {
+			return fmt.Errorf("admin.tail.max_subscribers must be positive, got %d", t.MaxSubscribers)
+		}
+		if t.MaxBodyBytes < 0 {
+			return fmt.Errorf("admin.tail.max_body_bytes must not be negative, got %d", t.MaxBodyBytes)
+		}
+		if authType == "" || authType == "none" {
+			return fmt.Errorf("admin.tail exposes message contents and requires auth.type basic, bearer, or jwt")
+		}
+	}
+
+	if err := validateLeaderElection(cfg.LeaderElection); err != nil {
+		return err
+	}
+
+	if err := validateGeoIP(cfg); err != nil {
+		return err
+	}
+
+	if err := validateClock(cfg); err != nil {
+		return err
+	}
+
+	if err := validateUsage(cfg); err != nil {
+		return err
+	}
+
+	if err := validateQuarantine(cfg); err != nil {
+		return err
+	}
+	if err := validateCompression(cfg); err != nil {
+		return err
+	}
+	if err := validateBodyLimits(cfg); err != nil {
+		return err
+	}
+	if err := validateResponseSigning(cfg.Server.ResponseSigning); err != nil {
+		return err
+	}
+	if err := validateDeadLetter(cfg.DeadLetter); err != nil {
+		return err
+	}
+	if err := validateAudit(cfg.Audit); err != nil {
+		return err
+	}
+	if err := validateReceipts(cfg.Receipts); err != nil {
+		return err
+	}
+	if err := validateIdempotency(cfg.Idempotency); err != nil {
+		return err
+	}
+	if err := validateLoadSignal(cfg.LoadSignal); err != nil {
+		return err
+	}
+	if err := validateAccessLog(cfg.AccessLog); err != nil {
+		return err
+	}
+
+	if err := validateDrift(cfg.Drift); err != nil {
+		return err
+	}
+
+	if err := validateTracing(cfg.Tracing); err != nil {
+		return err
+	}
+
+	if err := validateStartup(cfg.Startup, cfg.Kafka.Preflight); err != nil {
+		return err
+	}
+	if err := validateReload(cfg.Reload); err != nil {
+		return err
+	}
+	if err := validateAdminListener(cfg.Admin.Listener, cfg.Server.Port, cfg.Hardened); err != nil {
+		return err
+	}
+
+	for name, t := range cfg.Topics {
+		switch t.Payload {
+		case "", "raw", "base64", "json_only":
+		default:
+			return fmt.Errorf("topics.%s.payload: invalid value %q (want raw, base64, or json_only)", name, t.Payload)
+		}
+		switch t.Response {
+		case "", "json", "text", "none":
+		default:
+			return fmt.Errorf("topics.%s.response: invalid value %q (want json, text, or none)", name, t.Response)
+		}
+		switch t.Ordering {
+		case "":
+		case "strict":
+			if b := cfg.TopicBackend(name); b != BackendKafka {
+				return fmt.Errorf("topics.%s.ordering: strict ordering requires the kafka backend, topic uses %q", name, b)
+			}
+		default:
+			return fmt.Errorf("topics.%s.ordering: invalid value %q (want strict)", name, t.Ordering)
+		}
+		switch t.Partitioning {
+		case "", "sticky":
+		case "round_robin":
+			if b := cfg.TopicBackend(name); b != BackendKafka {
+				return fmt.Errorf("topics.%s.partitioning: round_robin requires the kafka backend, topic uses %q", name, b)
+			}
+		default:
+			return fmt.Errorf("topics.%s.partitioning: invalid value %q (want sticky or round_robin)", name, t.Partitioning)
+		}
+		if err := validateSignature(fmt.Sprintf("topics.%s.signature", name), t.Signature); err != nil {
+			return err
+		}
+		if err := validateKeyHash(fmt.Sprintf("topics.%s.key_hash", name), t.KeyHash); err != nil {
+			return err
+		}
+		if err := validateKey(fmt.Sprintf("topics.%s.key", name), t.Key); err != nil {
+			return err
+		}
+		if err := validatePayloadSchema(fmt.Sprintf("topics.%s.schema", name), t.Schema); err != nil {
+			return err
+		}
+		if err := validateCloudEvents(fmt.Sprintf("topics.%s.cloudevents", name), t.CloudEvents, t.Payload); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateListener checks the address family, that Host belongs to it when it
+// is an IP literal, and the PROXY protocol settings.
+func validateListener(s ServerConfig) error {
+	switch s.AddressFamily {
+	case "", "dual", "ipv4", "ipv6":
+	default:
+		return fmt.Errorf("server.address_family: invalid value %q (want dual, ipv4, or ipv6)", s.AddressFamily)
+	}
+
+	if ip := net.ParseIP(strings.Trim(s.Host, "[]")); ip != nil {
+		is4 := ip.To4() != nil
+		if s.AddressFamily == "ipv6" && is4 {
+			return fmt.Errorf("server.host %q is an IPv4 address but address_family is ipv6", s.Host)
+		}
+		if s.AddressFamily == "ipv4" && !is4 {
+			return fmt.Errorf("server.host %q is an IPv6 address but address_family is ipv4", s.Host)
+		}
+	}
+
+	if pp := s.ProxyProtocol; pp.Enabled {
+		if len(pp.TrustedCIDRs) == 0 {
+			return fmt.Errorf("server.proxy_protocol.trusted_cidrs is required; list your load balancer networks (0.0.0.0/0 and ::/0 trust everyone)")
+		}
+		for _, c := range pp.TrustedCIDRs {
+			if _, _, err := net.ParseCIDR(c); err != nil && net.ParseIP(c) == nil {
+				return fmt.Errorf("server.proxy_protocol.trusted_cidrs: invalid IP or CIDR %q", c)
+			}
+		}
+	}
+
+	if t := s.TLS; (t.CertFile == "") != (t.KeyFile == "") {
+		return fmt.Errorf("server.tls.cert_file and key_file must be set together")
+	} else if t.Offloaded && t.CertFile != "" {
+		return fmt.Errorf("server.tls.offloaded means TLS is terminated upstream; remove cert_file and key_file")
+	}
+	return nil
+}
+
+// validateScannerPaths checks that scanner paths are absolute and do not
+// cover kahook's own endpoints. Paths that match a configured route or topic
+// are ignored by the server, so they need no check here.
+func validateScannerPaths(s ServerConfig) error {
+	for _, p := range s.ScannerPaths {
+		if !strings.HasPrefix(p, "/") || strings.Trim(p, "/") == "" {
+			return fmt.Errorf("server.scanner_paths: %q must be an absolute path other than /", p)
+		}
+		first, _, _ := strings.Cut(strings.Trim(p, "/"), "/")
+		if reservedPaths[strings.ToLower(first)] {
+			return fmt.Errorf("server.scanner_paths: %q would hide kahook's /%s endpoint", p, strings.ToLower(first))
+		}
+	}
+	return nil
+}
+
+func validateReadiness(s ServerConfig) error {
+	r := s.Readiness
+	if r.QueueSaturation < 0 || r.QueueSaturation > 1 {
+		return fmt.Errorf("server.readiness.queue_saturation must be between 0 and 1, got %v", r.QueueSaturation)
+	}
+	if r.ErrorRate < 0 || r.ErrorRate > 1 {
+		return fmt.Errorf("server.readiness.error_rate must be between 0 and 1, got %v", r.ErrorRate)
+	}
+	if r.MinRequests < 0 || r.Sustain < 0 {
+		return fmt.Errorf("server.readiness min_requests and sustain must not be negative, got %d and %d", r.MinRequests, r.Sustain)
+	}
+	if r.QueueSaturation > 0 && s.ProduceQueue.Depth == 0 {
+		return fmt.Errorf("server.readiness.queue_saturation requires server.produce_queue.depth to be set")
+	}
+	return nil
+}
+
+func validateLeaderElection(l LeaderElectionConfig) error {
+	if !l.Enabled {
+		return nil
+	}
+	if l.LeaseName == "" {
+		return fmt.Errorf("leader_election.lease_name is required when leader_election is enabled")
+	}
+	if l.Identity == "" || strings.ContainsAny(l.Identity, "{}") {
+		return fmt.Errorf("leader_election.identity %q must be non-empty with known placeholders", l.Identity)
+	}
+	// The leader must give up before its lease can expire, or two replicas
+	// could briefly both be leader.
+	if l.RetryPeriod <= 0 || l.RetryPeriod >= l.RenewDeadline || l.RenewDeadline >= l.LeaseDuration {
+		return fmt.Errorf("leader_election: want 0 < retry_period < renew_deadline < lease_duration, got %d, %d, %d",
+			l.RetryPeriod, l.RenewDeadline, l.LeaseDuration)
+	}
+	return nil
+}
+
+func validateBackend(cfg *Config, backend string) error {
+	switch backend {
+	case BackendKafka:
+		if len(cfg.Kafka.Brokers) == 0 {
+			return fmt.Errorf("kafka brokers cannot be empty")
+		}
+		for _, b := range cfg.Kafka.Brokers {
+			if strings.Contains(b, "REPLACE_VIA") {
+				return fmt.Errorf("kafka broker %q looks like an un-replaced placeholder — set KAFKA_BROKERS", b)
+			}
+		}
+	case BackendPulsar:
+		if cfg.Pulsar.ServiceURL == "" || cfg.Pulsar.Tenant == "" || cfg.Pulsar.Namespace == "" {
+			return fmt.Errorf("backend 'pulsar' requires pulsar.service_url, pulsar.tenant, and pulsar.namespace")
+		}
+	case BackendNATS:
+		if cfg.NATS.URL == "" {
+			return fmt.Errorf("backend 'nats' requires nats.url")
+		}
+	case BackendFile:
+		if cfg.File.Path == "" {
+			return fmt.Errorf("backend 'file' requires file.path (use \"-\" for stdout)")
+		}
+	case BackendDevNull:
+	default:
+		return fmt.Errorf("invalid backend %q: must be one of %s", backend,
+			strings.Join([]string{BackendKafka, BackendPulsar, BackendNATS, BackendFile, BackendDevNull}, ", "))
+	}
+	return nil
+}
+
+func validateBandwidth(b BandwidthConfig) error {
+	check := func(name string, r ByteRate) error {
+		if r.BytesPerSecond < 0 || r.BurstBytes < 0 {
+			return fmt.Errorf("limits.bandwidth.%s: bytes_per_second and burst_bytes must not be negative", name)
+		}
+		return nil
+	}
+
+	if err := check("per_topic", b.PerTopic); err != nil {
+		return err
+	}
+	if err := check("per_principal", b.PerPrincipal); err != nil {
+		return err
+	}
+	for name, r := range b.Topics {
+		if err := check("topics."+name, r); err != nil {
+			return err
+		}
+	}
+	for name, r := range b.Principals {
+		if err := check("principals."+name, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateExempt(e ExemptConfig) error {
+	if _, err := e.Networks(); err != nil {
+		return fmt.Errorf("limits.exempt.cidrs: %w", err)
+	}
+	for _, p := range e.Principals {
+		if p == "" {
+			return fmt.Errorf("limits.exempt.principals: entries must not be empty")
+		}
+	}
+	for _, r := range e.Routes {
+		if strings.Trim(r, "/") == "" {
+			return fmt.Errorf("limits.exempt.routes: entries must name a topic or route path")
+		}
+	}
 	return nil
 }
 
@@ -227,6 +1725,165 @@ func (c *Config) KafkaConfigMap() map[string]any {
 	m["acks"] = c.Kafka.Acks
 	m["retries"] = c.Kafka.Retries
 	m["compression.type"] = c.Kafka.CompressionType
+	// Bodies above the default limit would be accepted and then fail to
+	// produce at librdkafka's default message.max.bytes. Profiles with a
+	// hard cap override this.
+	if n := c.maxBodyLimit(); n > DefaultMaxBodyBytes {
+		m["message.max.bytes"] = n + messageOverheadBytes
+	}
+
+	if c.Kafka.ProducerMode() != ProducerModeDefault {
+		m["enable.idempotence"] = true
+		m["acks"] = "all"
+	}
+	if t := c.Kafka.Transactional; t.Enabled {
+		m["transactional.id"] = t.ID
+		m["transaction.timeout.ms"] = t.Timeout * 1000
+	}
+
+	if c.Kafka.ClientID != "" {
+		m["client.id"] = c.Kafka.ClientID
+	}
+	if c.Kafka.ClientRack != "" {
+		m["client.rack"] = c.Kafka.ClientRack
+	}
 
+	for k, v := range kafkaProfileSettings(c.Kafka.Profile) {
+		m[k] = v
+	}
+
+	return m
+}
+
+// DefaultBackend returns the top-level backend, defaulting to Kafka.
+func (c *Config) DefaultBackend() string {
+	if c.Backend == "" {
+		return BackendKafka
+	}
+	return c.Backend
+}
+
+// TopicBackend returns the backend topic is published to.
+func (c *Config) TopicBackend(topic string) string {
+	if b := c.Topics[topic].Backend; b != "" {
+		return b
+	}
+	return c.DefaultBackend()
+}
+
+// Backends returns every backend in use: the default plus any topic
+// overrides, sorted.
+func (c *Config) Backends() []string {
+	seen := map[string]bool{c.DefaultBackend(): true}
+	for _, t := range c.Topics {
+		if t.Backend != "" {
+			seen[t.Backend] = true
+		}
+	}
+	out := make([]string, 0, len(seen))
+	for b := range seen {
+		out = append(out, b)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// KafkaTopics returns the topics known from configuration that are published
+// to Kafka: the allowlist, route targets, topics with per-topic settings, and
+// the verification and clock check topics, sorted. Topics only ever named in
+// request paths are not included.
+func (c *Config) KafkaTopics() []string {
+	seen := make(map[string]bool)
+	for _, t := range c.Server.AllowedTopics {
+		if c.TopicBackend(t) == BackendKafka {
+			seen[t] = true
+		}
+	}
+	for _, r := range c.Routes {
+		if c.TopicBackend(r.Topic) == BackendKafka {
+			seen[r.Topic] = true
+		}
+	}
+	for name := range c.Topics {
+		if c.TopicBackend(name) == BackendKafka {
+			seen[name] = true
+		}
+	}
+	if c.Admin.Verify.Enabled && c.DefaultBackend() == BackendKafka {
+		seen[c.Admin.Verify.Topic] = true
+	}
+	if c.Clock.KafkaTopic != "" && c.DefaultBackend() == BackendKafka {
+		seen[c.Clock.KafkaTopic] = true
+	}
+	if c.Usage.Enabled() && c.Usage.Topic != "" && c.TopicBackend(c.Usage.Topic) == BackendKafka {
+		seen[c.Usage.Topic] = true
+	}
+	if c.Quarantine.Topic != "" && c.TopicBackend(c.Quarantine.Topic) == BackendKafka {
+		seen[c.Quarantine.Topic] = true
+	}
+	if c.DeadLetter.Topic != "" && c.TopicBackend(c.DeadLetter.Topic) == BackendKafka {
+		seen[c.DeadLetter.Topic] = true
+	}
+	if c.Audit.Topic != "" && c.TopicBackend(c.Audit.Topic) == BackendKafka {
+		seen[c.Audit.Topic] = true
+	}
+	if c.Receipts.Topic != "" && c.TopicBackend(c.Receipts.Topic) == BackendKafka {
+		seen[c.Receipts.Topic] = true
+	}
+	if c.AccessLog.Topic != "" && c.TopicBackend(c.AccessLog.Topic) == BackendKafka {
+		seen[c.AccessLog.Topic] = true
+	}
+	out := make([]string, 0, len(seen))
+	for t := range seen {
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// StrictOrderingTopics returns the topics configured with ordering: strict.
+func (c *Config) StrictOrderingTopics() []string {
+	var topics []string
+	for name, t := range c.Topics {
+		if t.Ordering == "strict" {
+			topics = append(topics, name)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// RoundRobinTopics returns the topics configured with partitioning:
+// round_robin.
+func (c *Config) RoundRobinTopics() []string {
+	var topics []string
+	for name, t := range c.Topics {
+		if t.Partitioning == "round_robin" {
+			topics = append(topics, name)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// OrderedKafkaConfigMap returns the producer configuration for strict-ordering
+// topics: the regular settings plus whatever prevents retries from reordering
+// messages.
+func (c *Config) OrderedKafkaConfigMap() map[string]any {
+	m := c.KafkaConfigMap()
+	switch {
+	case c.Kafka.StrictOrdering == "single_in_flight":
+		m["max.in.flight.requests.per.connection"] = 1
+	default:
+		// Idempotence requires acks=all and keeps ordering with up to 5
+		// in-flight requests per connection.
+		m["enable.idempotence"] = true
+		m["acks"] = "all"
+	}
+	// The ordered producer is a producer of its own, and one transactional
+	// ID fences any other producer using it.
+	if id, ok := m["transactional.id"].(string); ok {
+		m["transactional.id"] = id + "-ordered"
+	}
 	return m
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"net/netip"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -242,6 +244,60 @@ func TestValidate_ValidBearerAuth(t *testing.T) {
 	}
 }
 
+func TestValidate_AuthChallenge(t *testing.T) {
+	for _, tt := range []struct {
+		auth    AuthConfig
+		wantErr bool
+	}{
+		{AuthConfig{Challenge: "none", Realm: "Acme webhooks"}, false},
+		{AuthConfig{Challenge: "digest"}, true},
+		{AuthConfig{Realm: "line\nbreak"}, true},
+	} {
+		cfg := &Config{
+			Server: ServerConfig{Port: 8080},
+			Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+			Auth:   tt.auth,
+		}
+		if err := validate(cfg); (err != nil) != tt.wantErr {
+			t.Errorf("validate(%+v) error = %v, wantErr %v", tt.auth, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate_MetricsTokens(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "bearer", Tokens: []string{"publish"}, MetricsTokens: []string{"scrape"}},
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+
+	cfg.Auth.MetricsTokens = []string{"publish"}
+	if err := validate(cfg); err == nil {
+		t.Error("validate() should reject a metrics token that can also publish")
+	}
+}
+
+func TestLoad_AuthChallengeFromEnv(t *testing.T) {
+	t.Setenv("AUTH_REALM", "acme")
+	t.Setenv("AUTH_CHALLENGE", "bearer")
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Auth.Realm != "acme" || cfg.Auth.Challenge != "bearer" {
+		t.Errorf("auth = %+v, want realm acme and challenge bearer", cfg.Auth)
+	}
+}
+
 func TestLoad_AuthTokensFromEnv(t *testing.T) {
 	dir := t.TempDir()
 	orig, _ := os.Getwd()
@@ -434,6 +490,31 @@ func TestKafkaConfigMap(t *testing.T) {
 				"bootstrap.servers": "broker1:9092,broker2:9092,broker3:9092",
 			},
 		},
+		{
+			name: "idempotent",
+			kafka: KafkaConfig{
+				Brokers:           []string{"localhost:9092"},
+				Acks:              "1",
+				EnableIdempotence: true,
+			},
+			checks: map[string]any{
+				"enable.idempotence": true,
+				"acks":               "all",
+				"transactional.id":   nil,
+			},
+		},
+		{
+			name: "transactional",
+			kafka: KafkaConfig{
+				Brokers:       []string{"localhost:9092"},
+				Transactional: TransactionalConfig{Enabled: true, ID: "kahook-web-0", Timeout: 30},
+			},
+			checks: map[string]any{
+				"enable.idempotence":     true,
+				"transactional.id":       "kahook-web-0",
+				"transaction.timeout.ms": 30000,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -449,3 +530,643 @@ func TestKafkaConfigMap(t *testing.T) {
 		})
 	}
 }
+
+func TestLoad_BandwidthLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	data := []byte(`
+limits:
+  bandwidth:
+    per_topic:
+      bytes_per_second: 1048576
+    topics:
+      audit-uploads:
+        bytes_per_second: 10485760
+        burst_bytes: 20971520
+`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	bw := cfg.Limits.Bandwidth
+	if bw.PerTopic.BytesPerSecond != 1048576 {
+		t.Errorf("per_topic.bytes_per_second = %d, want 1048576", bw.PerTopic.BytesPerSecond)
+	}
+	if got := bw.Topics["audit-uploads"]; got.BurstBytes != 20971520 {
+		t.Errorf("audit-uploads burst = %d, want 20971520", got.BurstBytes)
+	}
+}
+
+func TestValidate_NegativeBandwidth(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		Limits: LimitsConfig{Bandwidth: BandwidthConfig{
+			Topics: map[string]ByteRate{"orders": {BytesPerSecond: -1}},
+		}},
+	}
+
+	err := validate(cfg)
+	if err == nil {
+		t.Fatal("Should fail with negative bandwidth")
+	}
+	if !strings.Contains(err.Error(), "topics.orders") {
+		t.Errorf("Error should name the offending entry, got: %v", err)
+	}
+}
+
+func TestExemptConfig_Networks(t *testing.T) {
+	e := ExemptConfig{CIDRs: []string{"10.0.0.0/8", "192.0.2.7", "::ffff:198.51.100.1", "2001:db8::1/32"}}
+	nets, err := e.Networks()
+	if err != nil {
+		t.Fatalf("Networks() error = %v", err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.7/32"),
+		netip.MustParsePrefix("198.51.100.1/32"),
+		netip.MustParsePrefix("2001:db8::/32"),
+	}
+	if !reflect.DeepEqual(nets, want) {
+		t.Errorf("Networks() = %v, want %v", nets, want)
+	}
+}
+
+func TestValidateExempt(t *testing.T) {
+	tests := []struct {
+		name    string
+		exempt  ExemptConfig
+		wantErr string
+	}{
+		{"empty", ExemptConfig{}, ""},
+		{"valid", ExemptConfig{Principals: []string{"backfill", "token:0a1b2c3d"}, CIDRs: []string{"10.0.0.0/8"}, Routes: []string{"/internal/replay"}}, ""},
+		{"bad cidr", ExemptConfig{CIDRs: []string{"10.0.0.0/33"}}, "limits.exempt.cidrs"},
+		{"empty principal", ExemptConfig{Principals: []string{""}}, "limits.exempt.principals"},
+		{"root route", ExemptConfig{Routes: []string{"/"}}, "limits.exempt.routes"},
+	}
+	for _, tt := range tests {
+		err := validateExempt(tt.exempt)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateExempt() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateExempt() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidate_Profile(t *testing.T) {
+	cfg := &Config{
+		Profile: "staging",
+		Server:  ServerConfig{Port: 8080},
+		Kafka:   KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:    AuthConfig{Type: "none"},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with unknown profile")
+	}
+
+	cfg.Profile = ProfileDev
+	if err := validate(cfg); err != nil {
+		t.Errorf("dev profile should be valid, got: %v", err)
+	}
+}
+
+func TestValidate_StrictRoutesRequiresAllowlist(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080, StrictRoutes: true},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with strict_routes and no allowed_topics")
+	}
+
+	cfg.Server.AllowedTopics = []string{"orders"}
+	if err := validate(cfg); err != nil {
+		t.Errorf("strict_routes with allowlist should be valid, got: %v", err)
+	}
+}
+
+func TestValidate_TopicPayloadMode(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		Topics: map[string]TopicConfig{"uploads": {Payload: "base64"}},
+	}
+	if err := validate(cfg); err != nil {
+		t.Errorf("base64 payload mode should be valid, got: %v", err)
+	}
+
+	cfg.Topics["uploads"] = TopicConfig{Payload: "hex"}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with unknown payload mode")
+	}
+}
+
+func TestValidate_TopicResponse(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		Topics: map[string]TopicConfig{"legacy": {Response: "none"}},
+	}
+	if err := validate(cfg); err != nil {
+		t.Errorf("response none should be valid, got: %v", err)
+	}
+
+	cfg.Topics["legacy"] = TopicConfig{Response: "xml"}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with unknown response format")
+	}
+}
+
+func TestLoad_PoolDefaultsAndEnv(t *testing.T) {
+	dir := t.TempDir()
+	orig, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(orig) }()
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Kafka.Pool.Size != 1 || cfg.Kafka.Pool.Strategy != "consistent_hash" {
+		t.Errorf("default pool = %+v, want size 1 consistent_hash", cfg.Kafka.Pool)
+	}
+
+	t.Setenv("KAFKA_POOL_SIZE", "4")
+	t.Setenv("KAFKA_POOL_STRATEGY", "round_robin")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Kafka.Pool.Size != 4 || cfg.Kafka.Pool.Strategy != "round_robin" {
+		t.Errorf("env pool = %+v, want size 4 round_robin", cfg.Kafka.Pool)
+	}
+
+	t.Setenv("KAFKA_POOL_STRATEGY", "random")
+	if _, err := Load(""); err == nil {
+		t.Error("Should fail with unknown pool strategy")
+	}
+}
+
+func TestOrderedKafkaConfigMap(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Brokers: []string{"b:9092"}, Acks: "1"}}
+
+	m := cfg.OrderedKafkaConfigMap()
+	if m["enable.idempotence"] != true || m["acks"] != "all" {
+		t.Errorf("default strict ordering should enable idempotence with acks=all, got %v", m)
+	}
+
+	cfg.Kafka.StrictOrdering = "single_in_flight"
+	m = cfg.OrderedKafkaConfigMap()
+	if m["max.in.flight.requests.per.connection"] != 1 {
+		t.Errorf("single_in_flight should cap in-flight requests, got %v", m)
+	}
+	if _, ok := m["enable.idempotence"]; ok {
+		t.Error("single_in_flight should not enable idempotence")
+	}
+
+	// The regular producer is unaffected.
+	if _, ok := cfg.KafkaConfigMap()["max.in.flight.requests.per.connection"]; ok {
+		t.Error("KafkaConfigMap should not carry strict ordering settings")
+	}
+}
+
+func TestStrictOrderingTopics(t *testing.T) {
+	cfg := &Config{Topics: map[string]TopicConfig{
+		"payments": {Ordering: "strict"},
+		"audit":    {Ordering: "strict"},
+		"events":   {},
+	}}
+	got := cfg.StrictOrderingTopics()
+	if strings.Join(got, ",") != "audit,payments" {
+		t.Errorf("StrictOrderingTopics() = %v, want [audit payments]", got)
+	}
+}
+
+func TestRoundRobinTopics(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		Topics: map[string]TopicConfig{
+			"telemetry": {Partitioning: "round_robin"},
+			"clicks":    {Partitioning: "round_robin"},
+			"orders":    {Partitioning: "sticky"},
+		},
+	}
+	if err := validate(cfg); err != nil {
+		t.Fatalf("valid partitioning rejected: %v", err)
+	}
+	if got := cfg.RoundRobinTopics(); strings.Join(got, ",") != "clicks,telemetry" {
+		t.Errorf("RoundRobinTopics() = %v, want [clicks telemetry]", got)
+	}
+
+	cfg.Topics["clicks"] = TopicConfig{Partitioning: "random"}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with unknown partitioning")
+	}
+
+	cfg.Topics["clicks"] = TopicConfig{Partitioning: "round_robin", Backend: BackendNATS}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with round_robin partitioning on a non-kafka topic")
+	}
+}
+
+func TestLoad_PulsarBackendFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	orig, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(orig) }()
+
+	t.Setenv("BACKEND", "pulsar")
+	t.Setenv("PULSAR_SERVICE_URL", "http://pulsar:8080")
+	t.Setenv("PULSAR_TENANT", "webhooks")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Backend != BackendPulsar {
+		t.Errorf("Backend = %q, want pulsar", cfg.Backend)
+	}
+	if cfg.Pulsar.ServiceURL != "http://pulsar:8080" || cfg.Pulsar.Tenant != "webhooks" {
+		t.Errorf("Pulsar = %+v", cfg.Pulsar)
+	}
+	if cfg.Pulsar.Namespace != "default" {
+		t.Errorf("Namespace should default to 'default', got %q", cfg.Pulsar.Namespace)
+	}
+}
+
+func TestValidate_Backend(t *testing.T) {
+	cfg := &Config{
+		Backend: "rabbitmq",
+		Server:  ServerConfig{Port: 8080},
+		Kafka:   KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:    AuthConfig{Type: "none"},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with unknown backend")
+	}
+
+	cfg.Backend = BackendPulsar
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with pulsar backend and no pulsar settings")
+	}
+
+	cfg.Pulsar = PulsarConfig{ServiceURL: "http://pulsar:8080", Tenant: "public", Namespace: "default"}
+	if err := validate(cfg); err != nil {
+		t.Errorf("valid pulsar config rejected: %v", err)
+	}
+}
+
+func TestValidate_TopicBackendOverride(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		Topics: map[string]TopicConfig{"telemetry": {Backend: BackendNATS}},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail when a topic uses nats without nats.url")
+	}
+
+	cfg.NATS.URL = "nats://nats:4222"
+	if err := validate(cfg); err != nil {
+		t.Errorf("valid nats override rejected: %v", err)
+	}
+	if got := strings.Join(cfg.Backends(), ","); got != "kafka,nats" {
+		t.Errorf("Backends() = %q, want kafka,nats", got)
+	}
+	if cfg.TopicBackend("telemetry") != BackendNATS || cfg.TopicBackend("orders") != BackendKafka {
+		t.Error("TopicBackend should honour the override and fall back to the default")
+	}
+
+	cfg.Topics["telemetry"] = TopicConfig{Backend: BackendNATS, Ordering: "strict"}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with strict ordering on a non-kafka topic")
+	}
+}
+
+func TestValidate_FileBackendNeedsNoBrokers(t *testing.T) {
+	cfg := &Config{
+		Backend: BackendFile,
+		Server:  ServerConfig{Port: 8080},
+		Auth:    AuthConfig{Type: "none"},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with file backend and no file.path")
+	}
+
+	cfg.File.Path = "-"
+	if err := validate(cfg); err != nil {
+		t.Errorf("file backend should not require kafka brokers: %v", err)
+	}
+
+	cfg.Backend = BackendDevNull
+	cfg.File.Path = ""
+	if err := validate(cfg); err != nil {
+		t.Errorf("devnull backend rejected: %v", err)
+	}
+}
+
+func TestValidate_AdminVerify(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		Admin:  AdminConfig{Verify: VerifyConfig{Enabled: true, Topic: "kahook-verify"}},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with admin.verify enabled and no auth")
+	}
+
+	cfg.Auth = AuthConfig{Type: "bearer", Tokens: []string{"t"}}
+	if err := validate(cfg); err != nil {
+		t.Errorf("valid admin.verify config rejected: %v", err)
+	}
+
+	cfg.Admin.Verify.Topic = ""
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with admin.verify enabled and no topic")
+	}
+}
+
+func TestValidate_AdminTail(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		Admin:  AdminConfig{Tail: TailConfig{Enabled: true, MaxSubscribers: 4, MaxBodyBytes: 1024}},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with admin.tail enabled and no auth")
+	}
+
+	cfg.Auth = AuthConfig{Type: "bearer", Tokens: []string{"t"}}
+	if err := validate(cfg); err != nil {
+		t.Errorf("valid admin.tail config rejected: %v", err)
+	}
+
+	cfg.Admin.Tail.MaxSubscribers = 0
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with admin.tail enabled and no subscribers allowed")
+	}
+
+	cfg.Admin.Tail.MaxSubscribers = 1
+	cfg.Admin.Tail.MaxBodyBytes = -1
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with negative admin.tail.max_body_bytes")
+	}
+}
+
+func TestKafkaTopics(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{AllowedTopics: []string{"orders", "telemetry"}},
+		Topics: map[string]TopicConfig{
+			"telemetry": {Backend: BackendNATS},
+			"payments":  {Ordering: "strict"},
+		},
+		Admin: AdminConfig{Verify: VerifyConfig{Enabled: true, Topic: "kahook-verify"}},
+	}
+
+	if got := strings.Join(cfg.KafkaTopics(), ","); got != "kahook-verify,orders,payments" {
+		t.Errorf("KafkaTopics() = %q, want kahook-verify,orders,payments", got)
+	}
+}
+
+func TestValidate_SLO(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{Port: 8080},
+		Kafka:  KafkaConfig{Brokers: []string{"localhost:9092"}},
+		Auth:   AuthConfig{Type: "none"},
+		SLO:    SLOConfig{ProduceLatencyMs: 250, Target: 1},
+	}
+	if err := validate(cfg); err == nil {
+		t.Error("Should fail with slo.target of 1 (no error budget)")
+	}
+
+	cfg.SLO.Target = 0.99
+	if err := validate(cfg); err != nil {
+		t.Errorf("valid slo rejected: %v", err)
+	}
+}
+
+func TestValidateListener(t *testing.T) {
+	tests := []struct {
+		host, family string
+		wantErr      bool
+	}{
+		{"", "", false},
+		{"", "ipv6", false},
+		{"::", "ipv6", false},
+		{"[::1]", "dual", false},
+		{"0.0.0.0", "ipv4", false},
+		{"kahook.internal", "ipv6", false},
+		{"0.0.0.0", "ipv6", true},
+		{"::", "ipv4", true},
+		{"", "ipv5", true},
+	}
+	for _, tt := range tests {
+		err := validateListener(ServerConfig{Host: tt.host, AddressFamily: tt.family})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateListener(%q, %q) error = %v, wantErr %v", tt.host, tt.family, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateListener_ProxyProtocol(t *testing.T) {
+	s := ServerConfig{ProxyProtocol: ProxyProtocolConfig{Enabled: true}}
+	if err := validateListener(s); err == nil {
+		t.Error("Should fail with proxy_protocol enabled and no trusted_cidrs")
+	}
+
+	s.ProxyProtocol.TrustedCIDRs = []string{"10.0.0.0/8", "192.0.2.10"}
+	if err := validateListener(s); err != nil {
+		t.Errorf("valid proxy_protocol rejected: %v", err)
+	}
+
+	s.ProxyProtocol.TrustedCIDRs = []string{"10.0.0.0/33"}
+	if err := validateListener(s); err == nil {
+		t.Error("Should fail with an invalid CIDR")
+	}
+}
+
+func TestLoad_ProduceQueueFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	orig, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(orig) }()
+
+	t.Setenv("SERVER_PRODUCE_QUEUE_DEPTH", "128")
+	t.Setenv("SERVER_PRODUCE_QUEUE_WORKERS", "2")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if q := cfg.Server.ProduceQueue; q.Depth != 128 || q.Workers != 2 {
+		t.Errorf("produce queue = %+v, want depth 128 workers 2", q)
+	}
+
+	t.Setenv("SERVER_PRODUCE_QUEUE_DEPTH", "-1")
+	if _, err := Load(""); err == nil {
+		t.Error("Should fail with a negative produce queue depth")
+	}
+}
+
+func TestValidateReadiness(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  ServerConfig
+		wantErr bool
+	}{
+		{"disabled", ServerConfig{}, false},
+		{"error rate", ServerConfig{Readiness: ReadinessConfig{ErrorRate: 0.5, Sustain: 30}}, false},
+		{"error rate above 1", ServerConfig{Readiness: ReadinessConfig{ErrorRate: 1.5}}, true},
+		{"negative sustain", ServerConfig{Readiness: ReadinessConfig{Sustain: -1}}, true},
+		{"saturation without queue", ServerConfig{Readiness: ReadinessConfig{QueueSaturation: 0.9}}, true},
+		{"saturation with queue", ServerConfig{
+			ProduceQueue: ProduceQueueConfig{Depth: 100},
+			Readiness:    ReadinessConfig{QueueSaturation: 0.9},
+		}, false},
+	}
+	for _, tt := range tests {
+		if err := validateReadiness(tt.server); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateReadiness() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateLeaderElection(t *testing.T) {
+	valid := defaults().LeaderElection
+	valid.Enabled = true
+	valid.Identity = "kahook-0"
+
+	tests := []struct {
+		name    string
+		mutate  func(*LeaderElectionConfig)
+		wantErr bool
+	}{
+		{"defaults", func(*LeaderElectionConfig) {}, false},
+		{"disabled ignores values", func(l *LeaderElectionConfig) { l.Enabled, l.LeaseName = false, "" }, false},
+		{"no lease name", func(l *LeaderElectionConfig) { l.LeaseName = "" }, true},
+		{"unexpanded identity", func(l *LeaderElectionConfig) { l.Identity = "{pod}" }, true},
+		{"renew deadline not below lease", func(l *LeaderElectionConfig) { l.RenewDeadline = 15 }, true},
+		{"retry period not below renew", func(l *LeaderElectionConfig) { l.RetryPeriod = 10 }, true},
+	}
+	for _, tt := range tests {
+		l := valid
+		tt.mutate(&l)
+		if err := validateLeaderElection(l); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateLeaderElection() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_LeaderElectionIdentityFromPod(t *testing.T) {
+	dir := t.TempDir()
+	orig, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(orig) }()
+
+	t.Setenv("POD_NAME", "kahook-7d9f-abcde")
+	t.Setenv("LEADER_ELECTION_ENABLED", "true")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LeaderElection.Identity != "kahook-7d9f-abcde" {
+		t.Errorf("identity = %q, want the pod name", cfg.LeaderElection.Identity)
+	}
+}
+
+func TestValidateScannerPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		paths   []string
+		wantErr bool
+	}{
+		{"defaults", defaultScannerPaths, false},
+		{"none", nil, false},
+		{"relative", []string{"wp-admin"}, true},
+		{"root", []string{"/"}, true},
+		{"hides metrics", []string{"/metrics"}, true},
+		{"hides admin endpoints", []string{"/Admin/verify"}, true},
+	}
+	for _, tt := range tests {
+		if err := validateScannerPaths(ServerConfig{ScannerPaths: tt.paths}); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateScannerPaths() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_ScannerPaths(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  scanner_paths: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(cfg.Server.ScannerPaths) != 0 {
+		t.Errorf("scanner_paths = %v, want none when set to an empty list", cfg.Server.ScannerPaths)
+	}
+
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SERVER_SCANNER_PATHS", "/.env,/wp-admin")
+	cfg, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if want := []string{"/.env", "/wp-admin"}; !reflect.DeepEqual(cfg.Server.ScannerPaths, want) {
+		t.Errorf("scanner_paths = %v, want %v", cfg.Server.ScannerPaths, want)
+	}
+}
+
+func TestLoad_IDScheme(t *testing.T) {
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.IDScheme != "uuidv4" {
+		t.Errorf("id_scheme = %q, want uuidv4 by default", cfg.Server.IDScheme)
+	}
+
+	t.Setenv("SERVER_ID_SCHEME", "ulid")
+	if cfg, err = Load(""); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.IDScheme != "ulid" {
+		t.Errorf("id_scheme = %q, want ulid from SERVER_ID_SCHEME", cfg.Server.IDScheme)
+	}
+
+	t.Setenv("SERVER_ID_SCHEME", "snowflake")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "server.id_scheme") {
+		t.Errorf("Load() error = %v, want an invalid id_scheme error", err)
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import "fmt"
+
+// minHeaderBytes is the smallest server.max_header_bytes accepted, so
+// ordinary requests are not refused.
+const minHeaderBytes = 4096
+
+// validateConnections checks the HTTP server's header and connection
+// limits. server.max_header_bytes must leave room for
+// limits.max_header_bytes, which can only act on headers that were read.
+func validateConnections(cfg *Config) error {
+	s := cfg.Server
+	if n := s.MaxHeaderBytes; n != 0 && n < minHeaderBytes {
+		return fmt.Errorf("server.max_header_bytes must be 0 or at least %d, got %d", minHeaderBytes, n)
+	}
+	if soft := cfg.Limits.MaxHeaderBytes; s.MaxHeaderBytes > 0 && soft > s.MaxHeaderBytes {
+		return fmt.Errorf("limits.max_header_bytes (%d) must not exceed server.max_header_bytes (%d)", soft, s.MaxHeaderBytes)
+	}
+	if s.MaxConnections < 0 {
+		return fmt.Errorf("server.max_connections must not be negative, got %d", s.MaxConnections)
+	}
+	return nil
+}
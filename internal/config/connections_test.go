@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateConnections(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"defaults", Config{}, ""},
+		{"tuned", Config{Server: ServerConfig{MaxHeaderBytes: 65536, MaxConnections: 10000, DisableHTTP2: true, DisableKeepAlives: true}}, ""},
+		{"soft limit below", Config{Server: ServerConfig{MaxHeaderBytes: 65536}, Limits: LimitsConfig{MaxHeaderBytes: 16384}}, ""},
+		{"header bytes too small", Config{Server: ServerConfig{MaxHeaderBytes: 512}}, "server.max_header_bytes"},
+		{"soft limit above", Config{Server: ServerConfig{MaxHeaderBytes: 8192}, Limits: LimitsConfig{MaxHeaderBytes: 16384}}, "limits.max_header_bytes"},
+		{"negative connections", Config{Server: ServerConfig{MaxConnections: -1}}, "server.max_connections"},
+	}
+	for _, tt := range tests {
+		err := validateConnections(&tt.cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateConnections() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateConnections() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_ConnectionsFromEnv(t *testing.T) {
+	t.Setenv("SERVER_MAX_CONNECTIONS", "5000")
+	t.Setenv("SERVER_DISABLE_HTTP2", "true")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.MaxConnections != 5000 || !cfg.Server.DisableHTTP2 {
+		t.Errorf("server = max_connections %d, disable_http2 %v", cfg.Server.MaxConnections, cfg.Server.DisableHTTP2)
+	}
+}
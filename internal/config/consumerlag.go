@@ -0,0 +1,61 @@
+package config
+
+import "fmt"
+
+// ConsumerLagConfig pushes back on webhooks to a topic, with 429s, while a
+// consumer group of it is too far behind, so a catching-up consumer is not
+// buried deeper. Every Interval seconds (default 30) each group's lag, the
+// messages it has not consumed, is read from the brokers; once it exceeds
+// MaxLag the topic's webhooks are refused until it falls to ResumeLag
+// (default half of MaxLag). It requires the kafka backend.
+//
+//	limits:
+//	  consumer_lag:
+//	    topics:
+//	      orders:
+//	        - group: billing
+//	          max_lag: 100000
+type ConsumerLagConfig struct {
+	Interval int                       `yaml:"interval"`
+	Topics   map[string][]LagThreshold `yaml:"topics"`
+}
+
+// LagThreshold is the lag one consumer group of a topic may build up.
+type LagThreshold struct {
+	Group     string `yaml:"group"`
+	MaxLag    int64  `yaml:"max_lag"`
+	ResumeLag int64  `yaml:"resume_lag"`
+}
+
+// Enabled reports whether any topic's consumer lag is watched.
+func (c ConsumerLagConfig) Enabled() bool {
+	return len(c.Topics) > 0
+}
+
+func validateConsumerLag(cfg *Config) error {
+	c := cfg.Limits.ConsumerLag
+	if c.Interval < 0 {
+		return fmt.Errorf("limits.consumer_lag.interval must not be negative, got %d", c.Interval)
+	}
+	for topic, groups := range c.Topics {
+		if len(groups) == 0 {
+			return fmt.Errorf("limits.consumer_lag.topics.%s: at least one group is required", topic)
+		}
+		if b := cfg.TopicBackend(topic); b != BackendKafka {
+			return fmt.Errorf("limits.consumer_lag.topics.%s: consumer lag requires the kafka backend, but the topic uses %s", topic, b)
+		}
+		for i, g := range groups {
+			name := fmt.Sprintf("limits.consumer_lag.topics.%s[%d]", topic, i)
+			if g.Group == "" {
+				return fmt.Errorf("%s: group is required", name)
+			}
+			if g.MaxLag <= 0 {
+				return fmt.Errorf("%s: max_lag must be positive, got %d", name, g.MaxLag)
+			}
+			if g.ResumeLag < 0 || g.ResumeLag >= g.MaxLag {
+				return fmt.Errorf("%s: resume_lag must be at least 0 and below max_lag, got %d", name, g.ResumeLag)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package config
+
+import "testing"
+
+func TestValidateConsumerLag(t *testing.T) {
+	group := func(g LagThreshold) map[string][]LagThreshold {
+		return map[string][]LagThreshold{"orders": {g}}
+	}
+	tests := []struct {
+		name    string
+		backend string
+		lag     ConsumerLagConfig
+		wantErr bool
+	}{
+		{"disabled", "", ConsumerLagConfig{}, false},
+		{"one group", "", ConsumerLagConfig{Topics: group(LagThreshold{Group: "billing", MaxLag: 1000})}, false},
+		{"resume lag", "kafka", ConsumerLagConfig{Interval: 10, Topics: group(LagThreshold{Group: "billing", MaxLag: 1000, ResumeLag: 900})}, false},
+		{"no groups", "", ConsumerLagConfig{Topics: map[string][]LagThreshold{"orders": nil}}, true},
+		{"no group name", "", ConsumerLagConfig{Topics: group(LagThreshold{MaxLag: 1000})}, true},
+		{"no max lag", "", ConsumerLagConfig{Topics: group(LagThreshold{Group: "billing"})}, true},
+		{"resume at max", "", ConsumerLagConfig{Topics: group(LagThreshold{Group: "billing", MaxLag: 1000, ResumeLag: 1000})}, true},
+		{"negative interval", "", ConsumerLagConfig{Interval: -1}, true},
+		{"other backend", "nats", ConsumerLagConfig{Topics: group(LagThreshold{Group: "billing", MaxLag: 1000})}, true},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Backend: tt.backend, Limits: LimitsConfig{ConsumerLag: tt.lag}}
+		if err := validateConsumerLag(cfg); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateConsumerLag() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
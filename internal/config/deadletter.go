@@ -0,0 +1,37 @@
+package config
+
+import "fmt"
+
+// maxDeadLetterRetries bounds DeadLetterConfig.Retries. Every retry holds
+// the request open for up to the produce timeout.
+const maxDeadLetterRetries = 10
+
+// DeadLetterConfig retries failed produces and then writes the message to
+// Topic, with the error and the topic it was sent to as message headers,
+// so a webhook is not lost when its topic cannot be written. Retries is
+// the number of extra attempts after the first, waiting BackoffMs before
+// the first retry and twice as long before each one after. An empty Topic
+// only retries.
+type DeadLetterConfig struct {
+	Topic     string `yaml:"topic"`
+	Retries   int    `yaml:"retries"`
+	BackoffMs int    `yaml:"backoff_ms"`
+}
+
+// Enabled reports whether failed produces are retried or dead-lettered.
+func (d DeadLetterConfig) Enabled() bool {
+	return d.Topic != "" || d.Retries > 0
+}
+
+func validateDeadLetter(d DeadLetterConfig) error {
+	if d.Topic != "" && !validRouteName.MatchString(d.Topic) {
+		return fmt.Errorf("dead_letter.topic: %q must match [a-zA-Z0-9._-] and be 1-249 characters", d.Topic)
+	}
+	if d.Retries < 0 || d.Retries > maxDeadLetterRetries {
+		return fmt.Errorf("dead_letter.retries must be between 0 and %d, got %d", maxDeadLetterRetries, d.Retries)
+	}
+	if d.BackoffMs < 0 {
+		return fmt.Errorf("dead_letter.backoff_ms must not be negative, got %d", d.BackoffMs)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateDeadLetter(t *testing.T) {
+	tests := []struct {
+		name       string
+		deadLetter DeadLetterConfig
+		wantErr    string
+	}{
+		{"disabled", DeadLetterConfig{}, ""},
+		{"topic", DeadLetterConfig{Topic: "kahook.dlq", Retries: 3, BackoffMs: 200}, ""},
+		{"retries only", DeadLetterConfig{Retries: 2}, ""},
+		{"bad topic", DeadLetterConfig{Topic: "dlq/all"}, "dead_letter.topic"},
+		{"negative retries", DeadLetterConfig{Retries: -1}, "dead_letter.retries"},
+		{"too many retries", DeadLetterConfig{Retries: 11}, "dead_letter.retries"},
+		{"negative backoff", DeadLetterConfig{BackoffMs: -5}, "dead_letter.backoff_ms"},
+	}
+	for _, tt := range tests {
+		err := validateDeadLetter(tt.deadLetter)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateDeadLetter() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateDeadLetter() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_DeadLetterFromEnv(t *testing.T) {
+	t.Setenv("DEAD_LETTER_TOPIC", "kahook.dlq")
+	t.Setenv("DEAD_LETTER_RETRIES", "3")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	d := cfg.DeadLetter
+	if d.Topic != "kahook.dlq" || d.Retries != 3 || d.BackoffMs != 200 {
+		t.Errorf("dead_letter = %+v, want topic, 3 retries, and the default backoff", d)
+	}
+	if !slices.Contains(cfg.KafkaTopics(), "kahook.dlq") {
+		t.Errorf("KafkaTopics() = %v, want the dead letter topic included", cfg.KafkaTopics())
+	}
+}
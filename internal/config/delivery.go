@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Producer modes, from weakest to strongest delivery guarantee.
+const (
+	ProducerModeDefault       = "default"
+	ProducerModeIdempotent    = "idempotent"
+	ProducerModeTransactional = "transactional"
+)
+
+// TransactionalConfig produces webhooks inside Kafka transactions. ID is
+// the transactional.id and accepts the same placeholders as client_id; it
+// must be stable across restarts of a replica and unique across replicas,
+// so the default is "kahook-{pod_name}". Producers of a pool append their
+// index to it. Up to MaxMessages (default 100) queued messages are
+// committed in one transaction, which must complete within Timeout
+// seconds (default 60).
+type TransactionalConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	ID          string `yaml:"id"`
+	Timeout     int    `yaml:"timeout"`
+	MaxMessages int    `yaml:"max_messages"`
+}
+
+// ProducerMode returns how webhooks are produced: "transactional",
+// "idempotent", or "default".
+func (k KafkaConfig) ProducerMode() string {
+	switch {
+	case k.Transactional.Enabled:
+		return ProducerModeTransactional
+	case k.EnableIdempotence:
+		return ProducerModeIdempotent
+	}
+	return ProducerModeDefault
+}
+
+// DeliverySemantics describes what the producer mode guarantees, for
+// operators reading /metrics.
+func (k KafkaConfig) DeliverySemantics() string {
+	switch k.ProducerMode() {
+	case ProducerModeTransactional:
+		return "at-least-once; producer retries are deduplicated by the broker and messages of failed or aborted requests are hidden from read_committed consumers"
+	case ProducerModeIdempotent:
+		return "at-least-once; producer retries are deduplicated by the broker and per-partition order is kept"
+	}
+	return "at-least-once; producer retries may write duplicates"
+}
+
+func validateDelivery(cfg *Config) error {
+	k := cfg.Kafka
+	if k.ProducerMode() == ProducerModeDefault {
+		return nil
+	}
+	if k.Acks != "" && k.Acks != "all" && k.Acks != "-1" {
+		return fmt.Errorf("kafka.acks must be all with kafka.%s, got %q", modeSetting(k), k.Acks)
+	}
+	if k.Retries < 1 {
+		return fmt.Errorf("kafka.retries must be at least 1 with kafka.%s, got %d", modeSetting(k), k.Retries)
+	}
+	if !k.Transactional.Enabled {
+		return nil
+	}
+	t := k.Transactional
+	if strings.EqualFold(k.Profile, KafkaProfileEventHubs) {
+		return fmt.Errorf("kafka.transactional is not supported by kafka.profile eventhubs")
+	}
+	if !slices.Contains(cfg.Backends(), BackendKafka) {
+		return fmt.Errorf("kafka.transactional requires the kafka backend")
+	}
+	if t.ID == "" {
+		return fmt.Errorf("kafka.transactional.id must not be empty")
+	}
+	if !validClientID.MatchString(t.ID) {
+		return fmt.Errorf("kafka.transactional.id %q: only [a-zA-Z0-9._-] allowed after expanding placeholders ({hostname}, {pod_name}, {pod_namespace}, {env:VAR})", t.ID)
+	}
+	if t.Timeout < 0 {
+		return fmt.Errorf("kafka.transactional.timeout must not be negative, got %d", t.Timeout)
+	}
+	if t.MaxMessages < 0 {
+		return fmt.Errorf("kafka.transactional.max_messages must not be negative, got %d", t.MaxMessages)
+	}
+	return nil
+}
+
+// modeSetting names the setting that selected a non-default producer mode.
+func modeSetting(k KafkaConfig) string {
+	if k.Transactional.Enabled {
+		return "transactional.enabled"
+	}
+	return "enable_idempotence"
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDelivery(t *testing.T) {
+	txn := func(id string) TransactionalConfig {
+		return TransactionalConfig{Enabled: true, ID: id, Timeout: 60, MaxMessages: 100}
+	}
+	tests := []struct {
+		name    string
+		kafka   KafkaConfig
+		backend string
+		wantErr string
+	}{
+		{"default", KafkaConfig{Acks: "1", Retries: 0}, "", ""},
+		{"idempotent", KafkaConfig{Acks: "all", Retries: 3, EnableIdempotence: true}, "", ""},
+		{"idempotent acks=1", KafkaConfig{Acks: "1", Retries: 3, EnableIdempotence: true}, "", "kafka.acks must be all with kafka.enable_idempotence"},
+		{"idempotent no retries", KafkaConfig{Acks: "all", EnableIdempotence: true}, "", "kafka.retries"},
+		{"transactional", KafkaConfig{Acks: "all", Retries: 3, Transactional: txn("kahook-web-0")}, "", ""},
+		{"transactional acks=0", KafkaConfig{Acks: "0", Retries: 3, Transactional: txn("kahook-web-0")}, "", "kafka.transactional.enabled"},
+		{"unexpanded id", KafkaConfig{Acks: "all", Retries: 3, Transactional: txn("kahook-{pod}")}, "", "kafka.transactional.id"},
+		{"empty id", KafkaConfig{Acks: "all", Retries: 3, Transactional: txn("")}, "", "kafka.transactional.id"},
+		{"eventhubs", KafkaConfig{Profile: "eventhubs", Acks: "all", Retries: 3, Transactional: txn("kahook-web-0")}, "", "eventhubs"},
+		{"no kafka backend", KafkaConfig{Acks: "all", Retries: 3, Transactional: txn("kahook-web-0")}, BackendNATS, "requires the kafka backend"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Backend: tt.backend, Kafka: tt.kafka}
+		err := validateDelivery(cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateDelivery() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateDelivery() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestOrderedKafkaConfigMap_TransactionalID(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Transactional: TransactionalConfig{Enabled: true, ID: "kahook-web-0"}}}
+	if got := cfg.OrderedKafkaConfigMap()["transactional.id"]; got != "kahook-web-0-ordered" {
+		t.Errorf("transactional.id = %v, want kahook-web-0-ordered", got)
+	}
+	if got := cfg.KafkaConfigMap()["transactional.id"]; got != "kahook-web-0" {
+		t.Errorf("transactional.id = %v, want kahook-web-0", got)
+	}
+}
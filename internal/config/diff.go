@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kahook/internal/redact"
+)
+
+// setValue and unsetValue mark a map entry or list item present in only one
+// of the configs being compared.
+const (
+	setValue   = "<set>"
+	unsetValue = "<unset>"
+)
+
+// Change is one setting that differs between two configs. Path is the
+// dotted config-file path ("kafka.brokers", "topics.orders.payload",
+// "routes[1].path"). Old and New are formatted for reading, with secrets
+// redacted, so a diff is safe to log.
+type Change struct {
+	Path   string `json:"path"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	Secret bool   `json:"secret,omitempty"`
+}
+
+func (c Change) String() string {
+	if c.Secret && c.Old == c.New {
+		return c.Path + ": changed (secret)"
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.Path, c.Old, c.New)
+}
+
+// Diff lists the settings that differ between old and new, sorted by path.
+// A changed secret is reported, but only as whether it is set.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diffValue(reflect.ValueOf(*old), reflect.ValueOf(*new), "", "", &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// diffValue appends the differences between a and b, read from the field at
+// path whose secret tag is tag.
+func diffValue(a, b reflect.Value, path, tag string, changes *[]Change) {
+	t := a.Type()
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			diffValue(a.Field(i), b.Field(i), joinPath(path, name), f.Tag.Get("secret"), changes)
+		}
+	case reflect.Map, reflect.Slice:
+		if t.Elem().Kind() == reflect.Struct {
+			diffEntries(a, b, path, tag, changes)
+			return
+		}
+		diffLeaf(a, b, path, tag, changes)
+	default:
+		diffLeaf(a, b, path, tag, changes)
+	}
+}
+
+// diffLeaf compares a and b whole.
+func diffLeaf(a, b reflect.Value, path, tag string, changes *[]Change) {
+	if reflect.DeepEqual(a.Interface(), b.Interface()) {
+		return
+	}
+	*changes = append(*changes, Change{
+		Path:   path,
+		Old:    formatValue(a, tag),
+		New:    formatValue(b, tag),
+		Secret: tag != "",
+	})
+}
+
+// diffEntries compares maps by key and lists of structs by index, so a change
+// inside one entry is reported at its own path. An entry only one side has
+// is reported as added or removed, followed by its settings.
+func diffEntries(a, b reflect.Value, path, tag string, changes *[]Change) {
+	if a.Kind() == reflect.Slice {
+		n := max(a.Len(), b.Len())
+		for i := range n {
+			diffEntry(index(a, i), index(b, i), fmt.Sprintf("%s[%d]", path, i), tag, changes)
+		}
+		return
+	}
+	keys := map[string]reflect.Value{}
+	for _, m := range []reflect.Value{a, b} {
+		for _, k := range m.MapKeys() {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+	}
+	for name, k := range keys {
+		diffEntry(a.MapIndex(k), b.MapIndex(k), joinPath(path, name), tag, changes)
+	}
+}
+
+// diffEntry compares two map entries or list items, either of which may be
+// missing. A missing one is compared as its zero value, so only the settings
+// an added or removed entry actually sets are listed.
+func diffEntry(a, b reflect.Value, path, tag string, changes *[]Change) {
+	switch {
+	case !a.IsValid():
+		*changes = append(*changes, Change{Path: path, Old: unsetValue, New: setValue})
+		a = reflect.Zero(b.Type())
+	case !b.IsValid():
+		*changes = append(*changes, Change{Path: path, Old: setValue, New: unsetValue})
+		b = reflect.Zero(a.Type())
+	}
+	diffValue(a, b, path, tag, changes)
+}
+
+// formatValue formats a setting for a diff, masking it according to tag.
+func formatValue(v reflect.Value, tag string) string {
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		switch tag {
+		case "true":
+			s = redact.Mask(s)
+		case "url":
+			s = redact.URL(s)
+		}
+		return strconv.Quote(s)
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatValue(v.Index(i), tag)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case reflect.Map:
+		keys := v.MapKeys()
+		items := make([]string, 0, len(keys))
+		for _, k := range keys {
+			items = append(items, fmt.Sprintf("%v: %s", k.Interface(), formatValue(v.MapIndex(k), tag)))
+		}
+		sort.Strings(items)
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// index returns an invalid value for a missing item.
+func index(v reflect.Value, i int) reflect.Value {
+	if i >= v.Len() {
+		return reflect.Value{}
+	}
+	return v.Index(i)
+}
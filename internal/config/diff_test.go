@@ -0,0 +1,50 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := secretConfig()
+	old.Kafka.Brokers = []string{"a:9092"}
+	old.Routes = []RouteConfig{{Path: "github", Topic: "github"}}
+
+	cfg := secretConfig()
+	cfg.Kafka.Brokers = []string{"a:9092", "b:9092"}
+	cfg.Kafka.SASLPassword = "rotated-password"
+	cfg.Auth.Tokens = cfg.Auth.Tokens[:1]
+	cfg.Auth.Users = append(cfg.Auth.Users, UserConfig{Username: "bob", Password: "bob-password"})
+	cfg.Topics = map[string]TopicConfig{"orders": {Payload: "base64"}}
+	cfg.Routes = []RouteConfig{{Path: "gh", Topic: "github"}}
+
+	var lines []string
+	for _, c := range Diff(old, cfg) {
+		lines = append(lines, c.String())
+	}
+	got := strings.Join(lines, "\n")
+	want := strings.Join([]string{
+		`auth.tokens: ["[REDACTED]", "[REDACTED]"] -> ["[REDACTED]"]`,
+		`auth.users[1]: <unset> -> <set>`,
+		`auth.users[1].password: "" -> "[REDACTED]"`,
+		`auth.users[1].username: "" -> "bob"`,
+		`kafka.brokers: ["a:9092"] -> ["a:9092", "b:9092"]`,
+		`kafka.sasl_password: changed (secret)`,
+		`routes[0].path: "github" -> "gh"`,
+		`topics.orders: <unset> -> <set>`,
+		`topics.orders.payload: "" -> "base64"`,
+	}, "\n")
+	if got != want {
+		t.Errorf("Diff() =\n%s\nwant\n%s", got, want)
+	}
+
+	for _, secret := range append(configSecrets, "rotated-password", "bob-password") {
+		if strings.Contains(got, secret) {
+			t.Errorf("diff contains secret %q", secret)
+		}
+	}
+
+	if changes := Diff(cfg, cfg); len(changes) != 0 {
+		t.Errorf("Diff of a config with itself = %v, want none", changes)
+	}
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/kahook/internal/spool"
+)
+
+// DrainConfig controls what the Kafka producer does with buffered messages
+// at shutdown. It waits up to FlushTimeout seconds (default 5) for them to
+// be delivered; those still undelivered are written to a file in SpillDir,
+// if set, and are otherwise lost.
+//
+// Spill files hold the same data as the topics. SpillEncryptionKey, a
+// base64-encoded 32-byte key, encrypts them with AES-256-GCM.
+// SpillMaxBytes caps the directory's size and SpillMaxAge (seconds) how
+// long files are kept; zero means no limit. A spill that would exceed
+// SpillMaxBytes deletes the oldest files with SpillOnFull "evict_oldest"
+// (default), or stops, losing the rest, with "fail".
+//
+// Replay produces the segments found in SpillDir at startup, such as those
+// left by a crashed instance or a terminated pod's volume: "before_serving"
+// replays them before the server listens, "background" alongside traffic,
+// and "off" (default) leaves them for `kahook spool cat`.
+//
+// SpoolOutages also keeps webhooks in SpillDir while the brokers cannot be
+// reached, accepting them with 202, and produces them in order once the
+// producer reconnects.
+type DrainConfig struct {
+	FlushTimeout int    `yaml:"flush_timeout"`
+	SpillDir     string `yaml:"spill_dir"`
+
+	SpillEncryptionKey string `yaml:"spill_encryption_key" secret:"true"`
+	SpillMaxBytes      int64  `yaml:"spill_max_bytes"`
+	SpillMaxAge        int    `yaml:"spill_max_age"`
+	SpillOnFull        string `yaml:"spill_on_full" enum:"evict_oldest,fail"`
+
+	Replay       string `yaml:"replay" enum:"off,before_serving,background"`
+	SpoolOutages bool   `yaml:"spool_outages"`
+}
+
+// Spill replay modes.
+const (
+	ReplayOff           = "off"
+	ReplayBeforeServing = "before_serving"
+	ReplayBackground    = "background"
+)
+
+// Replays reports whether spilled segments are replayed at startup.
+func (d DrainConfig) Replays() bool {
+	return d.Replay != "" && d.Replay != ReplayOff
+}
+
+// Spool returns the configuration of the spill directory's spool.
+func (d DrainConfig) Spool() (spool.Config, error) {
+	cfg := spool.Config{
+		Dir:      d.SpillDir,
+		MaxBytes: d.SpillMaxBytes,
+		MaxAge:   time.Duration(d.SpillMaxAge) * time.Second,
+		OnFull:   d.SpillOnFull,
+	}
+	if d.SpillEncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(d.SpillEncryptionKey)
+		if err != nil {
+			return cfg, fmt.Errorf("kafka.drain.spill_encryption_key must be base64: %w", err)
+		}
+		if len(key) != spool.KeySize {
+			return cfg, fmt.Errorf("kafka.drain.spill_encryption_key must be %d bytes, got %d", spool.KeySize, len(key))
+		}
+		cfg.Key = key
+	}
+	return cfg, nil
+}
+
+func validateDrain(d DrainConfig) error {
+	if d.FlushTimeout < 0 {
+		return fmt.Errorf("kafka.drain.flush_timeout must not be negative, got %d", d.FlushTimeout)
+	}
+	if d.SpillMaxBytes < 0 {
+		return fmt.Errorf("kafka.drain.spill_max_bytes must not be negative, got %d", d.SpillMaxBytes)
+	}
+	if d.SpillMaxAge < 0 {
+		return fmt.Errorf("kafka.drain.spill_max_age must not be negative, got %d", d.SpillMaxAge)
+	}
+	switch d.SpillOnFull {
+	case "", spool.PolicyEvictOldest, spool.PolicyFail:
+	default:
+		return fmt.Errorf("kafka.drain.spill_on_full: invalid value %q (want evict_oldest or fail)", d.SpillOnFull)
+	}
+	switch d.Replay {
+	case "", ReplayOff, ReplayBeforeServing, ReplayBackground:
+	default:
+		return fmt.Errorf("kafka.drain.replay: invalid value %q (want off, before_serving, or background)", d.Replay)
+	}
+	if d.SpillDir == "" && (d.SpillEncryptionKey != "" || d.SpillMaxBytes != 0 || d.SpillMaxAge != 0 || d.SpillOnFull != "" || d.Replays() || d.SpoolOutages) {
+		return fmt.Errorf("kafka.drain spill settings require kafka.drain.spill_dir")
+	}
+	_, err := d.Spool()
+	return err
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+// testSpillKey is 32 zero bytes, base64-encoded.
+const testSpillKey = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+func TestValidateDrain(t *testing.T) {
+	tests := []struct {
+		name    string
+		drain   DrainConfig
+		wantErr bool
+	}{
+		{"defaults", DrainConfig{FlushTimeout: 5}, false},
+		{"spill", DrainConfig{FlushTimeout: 30, SpillDir: "/var/lib/kahook/spill"}, false},
+		{"no wait", DrainConfig{}, false},
+		{"negative timeout", DrainConfig{FlushTimeout: -1}, true},
+		{"encrypted spill", DrainConfig{SpillDir: "/spill", SpillEncryptionKey: testSpillKey}, false},
+		{"bounded spill", DrainConfig{SpillDir: "/spill", SpillMaxBytes: 1 << 30, SpillMaxAge: 86400, SpillOnFull: "fail"}, false},
+		{"key not base64", DrainConfig{SpillDir: "/spill", SpillEncryptionKey: "not base64!"}, true},
+		{"short key", DrainConfig{SpillDir: "/spill", SpillEncryptionKey: "c2hvcnQ="}, true},
+		{"negative max bytes", DrainConfig{SpillDir: "/spill", SpillMaxBytes: -1}, true},
+		{"negative max age", DrainConfig{SpillDir: "/spill", SpillMaxAge: -1}, true},
+		{"unknown policy", DrainConfig{SpillDir: "/spill", SpillOnFull: "block"}, true},
+		{"limits without dir", DrainConfig{SpillMaxBytes: 1 << 30}, true},
+		{"replay before serving", DrainConfig{SpillDir: "/spill", Replay: "before_serving"}, false},
+		{"replay in background", DrainConfig{SpillDir: "/spill", Replay: "background"}, false},
+		{"replay off without dir", DrainConfig{Replay: "off"}, false},
+		{"replay without dir", DrainConfig{Replay: "background"}, true},
+		{"unknown replay", DrainConfig{SpillDir: "/spill", Replay: "always"}, true},
+		{"outage spool", DrainConfig{SpillDir: "/spill", SpoolOutages: true}, false},
+		{"outage spool without dir", DrainConfig{SpoolOutages: true}, true},
+	}
+	for _, tt := range tests {
+		if err := validateDrain(tt.drain); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateDrain() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_DrainFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	orig, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(orig) }()
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Kafka.Drain.FlushTimeout != 5 {
+		t.Errorf("default flush_timeout = %d, want 5", cfg.Kafka.Drain.FlushTimeout)
+	}
+
+	t.Setenv("KAFKA_DRAIN_FLUSH_TIMEOUT", "20")
+	t.Setenv("KAFKA_DRAIN_SPILL_DIR", "/spill")
+	t.Setenv("KAFKA_DRAIN_REPLAY", "background")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if d := cfg.Kafka.Drain; d.FlushTimeout != 20 || d.SpillDir != "/spill" || d.Replay != ReplayBackground {
+		t.Errorf("drain = %+v, want 20s, /spill, and background replay", d)
+	}
+}
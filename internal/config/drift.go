@@ -0,0 +1,73 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// DriftConfig periodically fetches a reference copy of the config file from
+// URL — a config server, or the raw-file URL of the copy kept in git — and
+// compares it with the file the server started from, so a replica whose
+// config map was edited by hand is flagged. Token, when set, is sent as a
+// bearer token. The check runs at startup and every Interval seconds; zero
+// checks once. An empty URL disables the check.
+type DriftConfig struct {
+	URL      string `yaml:"url" secret:"url"`
+	Token    string `yaml:"token" secret:"true"`
+	Interval int    `yaml:"interval"`
+}
+
+// Enabled reports whether the drift check runs.
+func (d DriftConfig) Enabled() bool {
+	return d.URL != ""
+}
+
+func validateDrift(d DriftConfig) error {
+	if d.Interval < 0 {
+		return fmt.Errorf("drift.interval must not be negative, got %d", d.Interval)
+	}
+	if !d.Enabled() {
+		return nil
+	}
+	u, err := url.Parse(d.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("drift.url: must be an http or https URL")
+	}
+	return nil
+}
+
+// LoadFile reads the config file at path as written, with defaults but
+// without environment overrides, profiles, or validation: the form in
+// which drift checks compare it with a reference copy. An empty path
+// searches the same default locations as Load.
+func LoadFile(path string) (*Config, error) {
+	cfg := defaults()
+	if err := loadFile(cfg, path); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Parse reads a config file's contents the way LoadFile does.
+func Parse(data []byte) (*Config, error) {
+	cfg := defaults()
+	if err := decodeFile(cfg, data, "reference config"); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Hash returns a SHA-256 of the config's settings, hex-encoded. Configs
+// with the same settings hash the same however their files are formatted.
+func (c *Config) Hash() string {
+	data, err := json.Marshal(c)
+	if err != nil {
+		// Config holds only plain data; this cannot happen.
+		panic(fmt.Sprintf("config: hashing config: %v", err))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
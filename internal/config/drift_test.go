@@ -0,0 +1,85 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateDrift(t *testing.T) {
+	tests := []struct {
+		name    string
+		drift   DriftConfig
+		wantErr string
+	}{
+		{"disabled", DriftConfig{}, ""},
+		{"https", DriftConfig{URL: "https://config.example.com/kahook.yaml", Interval: 300}, ""},
+		{"once", DriftConfig{URL: "http://config:8888/kahook.yaml"}, ""},
+		{"negative interval", DriftConfig{Interval: -1}, "drift.interval"},
+		{"git ssh url", DriftConfig{URL: "git@github.com:acme/config.git"}, "drift.url"},
+		{"no host", DriftConfig{URL: "https:///kahook.yaml"}, "drift.url"},
+	}
+	for _, tt := range tests {
+		err := validateDrift(tt.drift)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateDrift() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateDrift() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("server:\n  port: 9090\nkafka:\n  brokers: [a:9092]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Environment overrides are not part of the file as written.
+	t.Setenv("SERVER_PORT", "7070")
+	running, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	same, err := Parse([]byte("# reference\nkafka:\n  brokers:\n    - a:9092\nserver: {port: 9090}\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if running.Hash() != same.Hash() {
+		t.Error("configs with the same settings hash differently")
+	}
+
+	edited, err := Parse([]byte("server:\n  port: 9091\nkafka:\n  brokers: [a:9092]\n"))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if running.Hash() == edited.Hash() {
+		t.Error("configs with different settings hash the same")
+	}
+	if changes := Diff(edited, running); len(changes) != 1 || changes[0].Path != "server.port" {
+		t.Errorf("Diff() = %v, want server.port only", changes)
+	}
+
+	if _, err := Parse([]byte("server:\n  prot: 9090\n")); err == nil {
+		t.Error("Parse() accepted an unknown setting")
+	}
+}
+
+func TestLoad_DriftFromEnv(t *testing.T) {
+	t.Setenv("DRIFT_URL", "https://config.example.com/kahook.yaml")
+	t.Setenv("DRIFT_TOKEN", "token")
+	t.Setenv("DRIFT_INTERVAL", "60")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := DriftConfig{URL: "https://config.example.com/kahook.yaml", Token: "token", Interval: 60}
+	if cfg.Drift != want {
+		t.Errorf("drift = %+v, want %+v", cfg.Drift, want)
+	}
+}
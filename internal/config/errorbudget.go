@@ -0,0 +1,48 @@
+package config
+
+import "fmt"
+
+// ErrorBudgetConfig throttles a topic whose produces keep failing. When more
+// than FailureRatio of at least MinRequests produces (default 20) over
+// Window seconds (default 60) fail, the topic is held to Throttle (default
+// one request per second) for Duration seconds (default 60). Topics
+// overrides FailureRatio by topic; 0 exempts a topic, and a FailureRatio of
+// 0 (default) disables the budget for every other topic.
+//
+//	limits:
+//	  error_budget:
+//	    failure_ratio: 0.5
+//	    topics:
+//	      payments: 0.1
+type ErrorBudgetConfig struct {
+	FailureRatio float64            `yaml:"failure_ratio"`
+	Topics       map[string]float64 `yaml:"topics"`
+	MinRequests  int                `yaml:"min_requests"`
+	Window       int                `yaml:"window"`
+	Duration     int                `yaml:"duration"`
+	Throttle     RequestRate        `yaml:"throttle"`
+}
+
+func validateErrorBudget(c ErrorBudgetConfig) error {
+	check := func(name string, ratio float64) error {
+		if ratio < 0 || ratio >= 1 {
+			return fmt.Errorf("limits.error_budget.%s must be between 0 and 1, got %v", name, ratio)
+		}
+		return nil
+	}
+	if err := check("failure_ratio", c.FailureRatio); err != nil {
+		return err
+	}
+	for name, ratio := range c.Topics {
+		if err := check("topics."+name, ratio); err != nil {
+			return err
+		}
+	}
+	if c.MinRequests < 0 || c.Window < 0 || c.Duration < 0 {
+		return fmt.Errorf("limits.error_budget: min_requests, window, and duration must not be negative")
+	}
+	if c.Throttle.RequestsPerSecond < 0 || c.Throttle.Burst < 0 {
+		return fmt.Errorf("limits.error_budget.throttle: requests_per_second and burst must not be negative")
+	}
+	return nil
+}
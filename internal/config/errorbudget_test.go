@@ -0,0 +1,26 @@
+package config
+
+import "testing"
+
+func TestValidateErrorBudget(t *testing.T) {
+	tests := []struct {
+		name    string
+		budget  ErrorBudgetConfig
+		wantErr bool
+	}{
+		{"disabled", ErrorBudgetConfig{}, false},
+		{"default ratio", ErrorBudgetConfig{FailureRatio: 0.5, MinRequests: 50, Window: 120, Duration: 30}, false},
+		{"topic overrides", ErrorBudgetConfig{FailureRatio: 0.5, Topics: map[string]float64{"payments": 0.1, "legacy": 0}}, false},
+		{"throttle", ErrorBudgetConfig{FailureRatio: 0.5, Throttle: RequestRate{RequestsPerSecond: 5, Burst: 10}}, false},
+		{"ratio of one", ErrorBudgetConfig{FailureRatio: 1}, true},
+		{"negative ratio", ErrorBudgetConfig{FailureRatio: -0.1}, true},
+		{"bad topic ratio", ErrorBudgetConfig{Topics: map[string]float64{"payments": 2}}, true},
+		{"negative window", ErrorBudgetConfig{FailureRatio: 0.5, Window: -1}, true},
+		{"negative throttle", ErrorBudgetConfig{FailureRatio: 0.5, Throttle: RequestRate{RequestsPerSecond: -1}}, true},
+	}
+	for _, tt := range tests {
+		if err := validateErrorBudget(tt.budget); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateErrorBudget() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+)
+
+// defaultCountryHeader is the message header carrying the client's country.
+const defaultCountryHeader = "Kahook-Country"
+
+// GeoIPConfig resolves client addresses to ISO country codes using a local
+// MaxMind DB (GeoLite2-Country or GeoIP2-Country). Database enables it; the
+// country is attached to messages as Header and counted per topic in
+// /metrics, and routes can restrict the countries they accept.
+type GeoIPConfig struct {
+	Database string `yaml:"database"`
+	Header   string `yaml:"header"`
+}
+
+// CountryPolicy restricts a route to clients from the listed countries
+// (Allow) or from anywhere but them (Deny). With Allow set, clients whose
+// country cannot be resolved are rejected.
+type CountryPolicy struct {
+	Allow []string `yaml:"allow"`
+	Deny  []string `yaml:"deny"`
+}
+
+// isZero reports whether p places no restriction.
+func (p CountryPolicy) isZero() bool {
+	return len(p.Allow) == 0 && len(p.Deny) == 0
+}
+
+func (p CountryPolicy) equal(o CountryPolicy) bool {
+	return slices.Equal(p.Allow, o.Allow) && slices.Equal(p.Deny, o.Deny)
+}
+
+// validCountryCode matches an ISO 3166-1 alpha-2 code as MaxMind reports it.
+var validCountryCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+func validateCountryPolicy(name string, p CountryPolicy) error {
+	if len(p.Allow) > 0 && len(p.Deny) > 0 {
+		return fmt.Errorf("%s: set allow or deny, not both", name)
+	}
+	for _, c := range slices.Concat(p.Allow, p.Deny) {
+		if !validCountryCode.MatchString(c) {
+			return fmt.Errorf("%s: %q is not an uppercase two-letter ISO country code", name, c)
+		}
+	}
+	return nil
+}
+
+// validHeaderName matches the header names the country can be sent as.
+var validHeaderName = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// validateGeoIP checks the header name and that routes restricting countries
+// have a database to resolve them with.
+func validateGeoIP(cfg *Config) error {
+	if cfg.GeoIP.Database != "" {
+		if !validHeaderName.MatchString(cfg.GeoIP.Header) {
+			return fmt.Errorf("geoip.header %q must be a non-empty header name of letters, digits, and hyphens", cfg.GeoIP.Header)
+		}
+		return nil
+	}
+	for i, r := range cfg.Routes {
+		if !r.Countries.isZero() {
+			return fmt.Errorf("routes[%d].countries requires geoip.database", i)
+		}
+	}
+	return nil
+}
+
+// CountryPolicies maps topics to the country restrictions of the routes that
+// produce to them. Topics without restrictions have no entry.
+func (c *Config) CountryPolicies() map[string]CountryPolicy {
+	policies := make(map[string]CountryPolicy)
+	for _, r := range c.Routes {
+		if !r.Countries.isZero() {
+			policies[r.Topic] = r.Countries
+		}
+	}
+	return policies
+}
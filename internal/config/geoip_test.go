@@ -0,0 +1,123 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateCountryPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  CountryPolicy
+		wantErr bool
+	}{
+		{"empty", CountryPolicy{}, false},
+		{"allow", CountryPolicy{Allow: []string{"DE", "FR"}}, false},
+		{"deny", CountryPolicy{Deny: []string{"RU"}}, false},
+		{"both", CountryPolicy{Allow: []string{"DE"}, Deny: []string{"RU"}}, true},
+		{"lowercase", CountryPolicy{Allow: []string{"de"}}, true},
+		{"alpha-3", CountryPolicy{Deny: []string{"DEU"}}, true},
+		{"empty code", CountryPolicy{Allow: []string{""}}, true},
+	}
+	for _, tt := range tests {
+		if err := validateCountryPolicy("countries", tt.policy); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateCountryPolicy() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateGeoIP(t *testing.T) {
+	eu := CountryPolicy{Allow: []string{"DE", "FR"}}
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"disabled", Config{}, ""},
+		{"enabled", Config{GeoIP: GeoIPConfig{Database: "country.mmdb", Header: "Kahook-Country"}}, ""},
+		{"policy without database", Config{Routes: []RouteConfig{{Topic: "a"}, {Topic: "b", Countries: eu}}}, "routes[1].countries requires geoip.database"},
+		{"policy with database", Config{
+			GeoIP:  GeoIPConfig{Database: "country.mmdb", Header: "Kahook-Country"},
+			Routes: []RouteConfig{{Topic: "b", Countries: eu}},
+		}, ""},
+		{"empty header", Config{GeoIP: GeoIPConfig{Database: "country.mmdb"}}, "geoip.header"},
+		{"invalid header", Config{GeoIP: GeoIPConfig{Database: "country.mmdb", Header: "X Country"}}, "geoip.header"},
+	}
+	for _, tt := range tests {
+		err := validateGeoIP(&tt.cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateGeoIP() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateGeoIP() error = %v, want containing %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyRoutes_CountryConflict(t *testing.T) {
+	cfg := &Config{Routes: []RouteConfig{
+		{Path: "a", Topic: "orders", Countries: CountryPolicy{Allow: []string{"DE"}}},
+		{Path: "b", Topic: "orders", Countries: CountryPolicy{Allow: []string{"FR"}}},
+	}}
+	if err := applyRoutes(cfg); err == nil {
+		t.Error("applyRoutes() should fail for routes with different country policies")
+	}
+}
+
+func TestLoad_GeoIP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+geoip:
+  database: /var/lib/geoip/GeoLite2-Country.mmdb
+routes:
+  - path: eu-payments
+    topic: payments.eu
+    countries:
+      allow: [DE, FR, NL]
+  - topic: orders
+    countries:
+      deny: [KP]
+  - topic: plain
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.GeoIP.Header != defaultCountryHeader {
+		t.Errorf("geoip.header = %q, want %q", cfg.GeoIP.Header, defaultCountryHeader)
+	}
+	want := map[string]CountryPolicy{
+		"payments.eu": {Allow: []string{"DE", "FR", "NL"}},
+		"orders":      {Deny: []string{"KP"}},
+	}
+	if got := cfg.CountryPolicies(); !reflect.DeepEqual(got, want) {
+		t.Errorf("CountryPolicies() = %v, want %v", got, want)
+	}
+}
+
+func TestLoad_GeoIPEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GEOIP_DATABASE", "/data/country.mmdb")
+	t.Setenv("GEOIP_HEADER", "X-Client-Country")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.GeoIP.Database != "/data/country.mmdb" || cfg.GeoIP.Header != "X-Client-Country" {
+		t.Errorf("geoip = %+v, want values from env", cfg.GeoIP)
+	}
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// hardenedPrincipalRate is the per-principal bandwidth limit the hardened
+// profile applies when none is configured: 1 MiB/s, enough for one
+// maximum-size webhook per second.
+var hardenedPrincipalRate = ByteRate{BytesPerSecond: 1 << 20}
+
+// applyHardened fills in the defaults implied by hardened: true that the user
+// left unset. It runs after env overrides and before validation.
+func applyHardened(cfg *Config) {
+	if !cfg.Hardened {
+		return
+	}
+	if cfg.Limits.Bandwidth.PerPrincipal == (ByteRate{}) {
+		cfg.Limits.Bandwidth.PerPrincipal = hardenedPrincipalRate
+	}
+}
+
+// validateHardened rejects settings that are unsafe for an internet-facing
+// deployment when hardened: true. saslPasswordInFile reports whether the
+// config file itself contained kafka.sasl_password.
+func validateHardened(cfg *Config, saslPasswordInFile bool) error {
+	if !cfg.Hardened {
+		return nil
+	}
+	if cfg.Profile == ProfileDev {
+		return fmt.Errorf("hardened cannot be combined with the dev profile")
+	}
+
+	switch strings.ToLower(cfg.Auth.Type) {
+	case "basic", "bearer", "jwt":
+	default:
+		return fmt.Errorf("hardened requires auth.type basic, bearer, or jwt, got %q", cfg.Auth.Type)
+	}
+	if u := cfg.Auth.JWT.JWKSURL; u != "" && !strings.HasPrefix(u, "https://") {
+		return fmt.Errorf("hardened requires auth.jwt.jwks_url to use https")
+	}
+
+	if t := cfg.Server.TLS; !t.Offloaded && (t.CertFile == "" || t.KeyFile == "") {
+		return fmt.Errorf("hardened requires server.tls.cert_file and key_file, or server.tls.offloaded when a load balancer terminates TLS")
+	}
+
+	if cfg.Record.Dir != "" {
+		return fmt.Errorf("hardened refuses record.dir, which writes request bodies to disk")
+	}
+
+	backends := cfg.Backends()
+	if slices.Contains(backends, BackendKafka) {
+		switch strings.ToUpper(cfg.Kafka.SecurityProtocol) {
+		case "SSL", "SASL_SSL":
+		default:
+			return fmt.Errorf("hardened requires kafka.security_protocol SSL or SASL_SSL, got %q", cfg.Kafka.SecurityProtocol)
+		}
+		if saslPasswordInFile {
+			return fmt.Errorf("hardened refuses kafka.sasl_password in the config file; set KAFKA_SASL_PASSWORD instead")
+		}
+	}
+	if slices.Contains(backends, BackendPulsar) && !strings.HasPrefix(cfg.Pulsar.ServiceURL, "https://") {
+		return fmt.Errorf("hardened requires an https pulsar.service_url")
+	}
+	if slices.Contains(backends, BackendNATS) && !cfg.NATS.TLS && !strings.HasPrefix(cfg.NATS.URL, "tls://") {
+		return fmt.Errorf("hardened requires nats.tls or a tls:// nats.url")
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const hardenedYAML = `
+hardened: true
+auth:
+  type: bearer
+  tokens:
+    - tok
+server:
+  tls:
+    offloaded: true
+kafka:
+  brokers:
+    - broker:9093
+  security_protocol: SASL_SSL
+  sasl_username: svc
+`
+
+func writeHardenedConfig(t *testing.T, extra string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(hardenedYAML+extra), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_HardenedDefaults(t *testing.T) {
+	t.Setenv("KAFKA_SASL_PASSWORD", "from-env")
+
+	cfg, err := Load(writeHardenedConfig(t, ""))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Limits.Bandwidth.PerPrincipal != hardenedPrincipalRate {
+		t.Errorf("per_principal = %+v, want the hardened default", cfg.Limits.Bandwidth.PerPrincipal)
+	}
+}
+
+func TestLoad_HardenedKeepsConfiguredBandwidth(t *testing.T) {
+	cfg, err := Load(writeHardenedConfig(t, `
+limits:
+  bandwidth:
+    per_principal:
+      bytes_per_second: 5000000
+`))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Limits.Bandwidth.PerPrincipal.BytesPerSecond != 5000000 {
+		t.Errorf("per_principal = %+v, want the configured rate", cfg.Limits.Bandwidth.PerPrincipal)
+	}
+}
+
+func TestLoad_HardenedRejectsPasswordInFile(t *testing.T) {
+	// The environment overriding it does not make a password in the file safe.
+	t.Setenv("KAFKA_SASL_PASSWORD", "from-env")
+
+	_, err := Load(writeHardenedConfig(t, "  sasl_password: in-file\n"))
+	if err == nil || !strings.Contains(err.Error(), "KAFKA_SASL_PASSWORD") {
+		t.Errorf("Load() error = %v, want a refusal of the file password", err)
+	}
+}
+
+func TestValidateHardened(t *testing.T) {
+	valid := func() *Config {
+		cfg := defaults()
+		cfg.Hardened = true
+		cfg.Auth = AuthConfig{Type: "basic", Users: []UserConfig{{Username: "u", Password: "p"}}}
+		cfg.Server.TLS = TLSConfig{CertFile: "tls.crt", KeyFile: "tls.key"}
+		cfg.Kafka.SecurityProtocol = "SSL"
+		return cfg
+	}
+	if err := validateHardened(valid(), false); err != nil {
+		t.Fatalf("validateHardened() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		want   string
+	}{
+		{"dev profile", func(c *Config) { c.Profile = ProfileDev }, "dev profile"},
+		{"no auth", func(c *Config) { c.Auth.Type = "none" }, "auth.type"},
+		{"no tls", func(c *Config) { c.Server.TLS = TLSConfig{} }, "server.tls"},
+		{"plaintext kafka", func(c *Config) { c.Kafka.SecurityProtocol = "SASL_PLAINTEXT" }, "security_protocol"},
+		{"plain pulsar", func(c *Config) {
+			c.Backend = BackendPulsar
+			c.Pulsar.ServiceURL = "http://pulsar:8080"
+		}, "pulsar.service_url"},
+		{"plain nats", func(c *Config) {
+			c.Backend = BackendNATS
+			c.NATS.URL = "nats://nats:4222"
+		}, "nats.tls"},
+		{"fixture recording", func(c *Config) { c.Record.Dir = "fixtures" }, "record.dir"},
+		{"plain jwks url", func(c *Config) {
+			c.Auth = AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: "http://idp/.well-known/jwks.json"}}
+		}, "auth.jwt.jwks_url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid()
+			tt.modify(cfg)
+			err := validateHardened(cfg, false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validateHardened() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	// Not hardened: nothing is enforced.
+	cfg := valid()
+	cfg.Hardened = false
+	cfg.Auth.Type = "none"
+	if err := validateHardened(cfg, true); err != nil {
+		t.Errorf("validateHardened() without hardened = %v", err)
+	}
+}
+
+func TestValidate_ServerTLS(t *testing.T) {
+	cfg := defaults()
+	cfg.Server.TLS = TLSConfig{CertFile: "tls.crt"}
+	if err := validate(cfg); err == nil {
+		t.Error("validate() should require key_file with cert_file")
+	}
+	cfg.Server.TLS = TLSConfig{CertFile: "tls.crt", KeyFile: "tls.key", Offloaded: true}
+	if err := validate(cfg); err == nil {
+		t.Error("validate() should reject offloaded with a certificate")
+	}
+}
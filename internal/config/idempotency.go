@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/kahook/internal/redis"
+)
+
+// IdempotencyConfig caches the response to each webhook for Window
+// seconds, so a sender retrying the same delivery gets the original
+// response (with Idempotent-Replayed: true) instead of the message being
+// produced twice. Deliveries are identified by Header (default
+// Idempotency-Key), or, on topics that verify signatures or with
+// HashBodies, by their body. Duplicates are answered with DuplicateStatus
+// (default 200), or the original status when it is set to 0. MaxEntries
+// bounds the responses kept in memory (default 10000); with Redis set they
+// are kept there instead, shared between replicas. A zero Window disables
+// it.
+type IdempotencyConfig struct {
+	Window          int                    `yaml:"window"`
+	Header          string                 `yaml:"header"`
+	MaxEntries      int                    `yaml:"max_entries"`
+	HashBodies      bool                   `yaml:"hash_bodies"`
+	DuplicateStatus int                    `yaml:"duplicate_status"`
+	Redis           IdempotencyRedisConfig `yaml:"redis"`
+}
+
+// IdempotencyRedisConfig keeps idempotency responses in Redis at URL
+// (redis://[[user]:password@]host:port[/db], or rediss:// for TLS), under
+// keys starting with KeyPrefix (default "kahook:"). An empty URL keeps them
+// in memory.
+type IdempotencyRedisConfig struct {
+	URL       string `yaml:"url" secret:"url"`
+	KeyPrefix string `yaml:"key_prefix"`
+}
+
+func validateIdempotency(c IdempotencyConfig) error {
+	if c.Window < 0 {
+		return fmt.Errorf("idempotency.window must not be negative, got %d", c.Window)
+	}
+	if c.Header != "" && !validHeaderName.MatchString(c.Header) {
+		return fmt.Errorf("idempotency.header: %q is not a valid header name", c.Header)
+	}
+	if c.MaxEntries < 0 {
+		return fmt.Errorf("idempotency.max_entries must not be negative, got %d", c.MaxEntries)
+	}
+	if c.DuplicateStatus != 0 && (c.DuplicateStatus < 200 || c.DuplicateStatus > 299) {
+		return fmt.Errorf("idempotency.duplicate_status must be a 2xx status, got %d", c.DuplicateStatus)
+	}
+	if c.Redis.URL != "" {
+		if c.Window == 0 {
+			return fmt.Errorf("idempotency.redis requires idempotency.window")
+		}
+		if _, err := redis.New(redis.Config{URL: c.Redis.URL}); err != nil {
+			return fmt.Errorf("idempotency.redis.url: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateIdempotency(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     IdempotencyConfig
+		wantErr string
+	}{
+		{"disabled", IdempotencyConfig{}, ""},
+		{"enabled", IdempotencyConfig{Window: 3600, Header: "X-GitHub-Delivery", MaxEntries: 50000}, ""},
+		{"negative window", IdempotencyConfig{Window: -1}, "idempotency.window"},
+		{"bad header", IdempotencyConfig{Window: 60, Header: "Idempotency Key"}, "idempotency.header"},
+		{"negative entries", IdempotencyConfig{Window: 60, MaxEntries: -1}, "idempotency.max_entries"},
+		{"dedupe", IdempotencyConfig{Window: 86400, HashBodies: true, DuplicateStatus: 200}, ""},
+		{"error status", IdempotencyConfig{Window: 60, DuplicateStatus: 409}, "idempotency.duplicate_status"},
+		{"redis", IdempotencyConfig{Window: 60, Redis: IdempotencyRedisConfig{URL: "rediss://:secret@redis:6380/2"}}, ""},
+		{"redis without window", IdempotencyConfig{Redis: IdempotencyRedisConfig{URL: "redis://redis:6379"}}, "idempotency.window"},
+		{"bad redis url", IdempotencyConfig{Window: 60, Redis: IdempotencyRedisConfig{URL: "redis:6379"}}, "idempotency.redis.url"},
+	}
+	for _, tt := range tests {
+		err := validateIdempotency(tt.cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateIdempotency() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateIdempotency() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_IdempotencyFromEnv(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_WINDOW", "600")
+	t.Setenv("IDEMPOTENCY_REDIS_URL", "redis://redis:6379")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Idempotency.Window != 600 {
+		t.Errorf("idempotency.window = %d, want 600", cfg.Idempotency.Window)
+	}
+	if r := cfg.Idempotency.Redis; r.URL != "redis://redis:6379" || r.KeyPrefix != "kahook:" {
+		t.Errorf("idempotency.redis = %+v, want the URL with the default key prefix", r)
+	}
+	if s := cfg.Idempotency.DuplicateStatus; s != 200 {
+		t.Errorf("idempotency.duplicate_status = %d, want the default 200", s)
+	}
+}
+
+func TestLoad_IdempotencyOriginalStatus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("idempotency:\n  window: 60\n  duplicate_status: 0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if s := cfg.Idempotency.DuplicateStatus; s != 0 {
+		t.Errorf("idempotency.duplicate_status = %d, want 0 to replay the original status", s)
+	}
+}
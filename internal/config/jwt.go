@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// JWTConfig accepts bearer tokens that are JWTs signed with RS256 or ES256
+// by a key in the JSON Web Key Set at JWKSURL, which enables it. Issuer and
+// Audience are required with it: the iss claim must equal Issuer and the
+// aud claim include a value of Audience, so tokens the identity provider
+// issued for other services are refused. Leeway (seconds,
+// default 60) is the clock skew allowed on exp and nbf, and
+// RefreshInterval (seconds, default 3600) how long fetched keys are used
+// before the set is fetched again. A token authenticates as "jwt:" and its
+// sub claim, which messages carry in the Kahook-Subject header.
+//
+// ScopePrefix, if set, limits a token to the topics its scopes name: each
+// scope starting with the prefix, such as "kahook:publish:orders", grants
+// the topic or pattern after it, and a token with none may publish to no
+// topic. auth.scopes overrides it for the subjects it lists.
+type JWTConfig struct {
+	JWKSURL         string   `yaml:"jwks_url"`
+	Issuer          string   `yaml:"issuer"`
+	Audience        []string `yaml:"audience"`
+	Leeway          int      `yaml:"leeway"`
+	RefreshInterval int      `yaml:"refresh_interval"`
+	ScopePrefix     string   `yaml:"scope_prefix"`
+}
+
+// Enabled reports whether JWTs are accepted.
+func (j JWTConfig) Enabled() bool {
+	return j.JWKSURL != ""
+}
+
+func validateJWT(a AuthConfig) error {
+	j := a.JWT
+	if strings.ToLower(a.Type) == "jwt" && !j.Enabled() {
+		return fmt.Errorf("auth.type is 'jwt' but auth.jwt.jwks_url is not set")
+	}
+	if !j.Enabled() {
+		if j.Issuer != "" || len(j.Audience) > 0 || j.ScopePrefix != "" {
+			return fmt.Errorf("auth.jwt.issuer, audience, and scope_prefix require auth.jwt.jwks_url")
+		}
+		return nil
+	}
+	u, err := url.Parse(j.JWKSURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("auth.jwt.jwks_url: must be an http or https URL")
+	}
+	if j.Issuer == "" {
+		return fmt.Errorf("auth.jwt.issuer is required with auth.jwt.jwks_url")
+	}
+	if len(j.Audience) == 0 {
+		return fmt.Errorf("auth.jwt.audience is required with auth.jwt.jwks_url")
+	}
+	for _, aud := range j.Audience {
+		if aud == "" {
+			return fmt.Errorf("auth.jwt.audience must not contain empty values")
+		}
+	}
+	if j.Leeway < 0 {
+		return fmt.Errorf("auth.jwt.leeway must not be negative, got %d", j.Leeway)
+	}
+	if j.RefreshInterval <= 0 {
+		return fmt.Errorf("auth.jwt.refresh_interval must be positive, got %d", j.RefreshInterval)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateJWT(t *testing.T) {
+	const jwks = "https://idp.example.com/.well-known/jwks.json"
+	tests := []struct {
+		name    string
+		auth    AuthConfig
+		wantErr string
+	}{
+		{"disabled", AuthConfig{Type: "none"}, ""},
+		{"enabled", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: jwks, Issuer: "https://idp.example.com", Audience: []string{"kahook"}, Leeway: 60, RefreshInterval: 3600}}, ""},
+		{"alongside bearer", AuthConfig{Type: "bearer", Tokens: []string{"tok"}, JWT: JWTConfig{JWKSURL: "http://idp:8080/jwks", Issuer: "http://idp:8080", Audience: []string{"kahook"}, RefreshInterval: 300}}, ""},
+		{"no issuer", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: jwks, Audience: []string{"kahook"}, RefreshInterval: 3600}}, "auth.jwt.issuer is required"},
+		{"no audience", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: jwks, Issuer: "https://idp.example.com", RefreshInterval: 3600}}, "auth.jwt.audience is required"},
+		{"type without url", AuthConfig{Type: "JWT"}, "auth.jwt.jwks_url"},
+		{"issuer without url", AuthConfig{Type: "none", JWT: JWTConfig{Issuer: "https://idp.example.com"}}, "auth.jwt.issuer"},
+		{"not a url", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: "idp/jwks", RefreshInterval: 3600}}, "auth.jwt.jwks_url"},
+		{"empty audience", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: jwks, Issuer: "https://idp.example.com", Audience: []string{""}, RefreshInterval: 3600}}, "auth.jwt.audience"},
+		{"negative leeway", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: jwks, Issuer: "https://idp.example.com", Audience: []string{"kahook"}, Leeway: -1, RefreshInterval: 3600}}, "auth.jwt.leeway"},
+		{"no refresh", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: jwks, Issuer: "https://idp.example.com", Audience: []string{"kahook"}}}, "auth.jwt.refresh_interval"},
+	}
+	for _, tt := range tests {
+		err := validateJWT(tt.auth)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateJWT() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateJWT() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_JWTFromEnv(t *testing.T) {
+	t.Setenv("AUTH_TYPE", "jwt")
+	t.Setenv("AUTH_JWT_JWKS_URL", "https://idp.example.com/jwks")
+	t.Setenv("AUTH_JWT_ISSUER", "https://idp.example.com")
+	t.Setenv("AUTH_JWT_AUDIENCE", "kahook,webhooks")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	j := cfg.Auth.JWT
+	if j.JWKSURL != "https://idp.example.com/jwks" || j.Issuer != "https://idp.example.com" ||
+		len(j.Audience) != 2 || j.Audience[1] != "webhooks" || j.Leeway != 60 || j.RefreshInterval != 3600 {
+		t.Errorf("auth.jwt = %+v", j)
+	}
+}
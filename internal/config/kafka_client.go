@@ -0,0 +1,46 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kafka clients.
+const (
+	// KafkaClientLibrdkafka is confluent-kafka-go over librdkafka, which
+	// requires a cgo build.
+	KafkaClientLibrdkafka = "librdkafka"
+	// KafkaClientNative is franz-go, a pure-Go client that runs in binaries
+	// built with CGO_ENABLED=0.
+	KafkaClientNative = "native"
+)
+
+// applyKafkaClient accepts kafka.client in any case. It runs after
+// applyKafkaProfile.
+func applyKafkaClient(cfg *Config) {
+	if strings.EqualFold(cfg.Kafka.Client, KafkaClientNative) {
+		cfg.Kafka.Client = KafkaClientNative
+	}
+}
+
+// validateKafkaClient rejects an unknown client, and SASL mechanisms the
+// native client has no implementation of.
+func validateKafkaClient(cfg *Config) error {
+	k := cfg.Kafka
+	switch k.Client {
+	case "", KafkaClientLibrdkafka:
+		return nil
+	case KafkaClientNative:
+	default:
+		return fmt.Errorf("kafka.client: invalid value %q (want librdkafka or native)", k.Client)
+	}
+
+	if k.SASLUsername != "" && k.SASLPassword != "" {
+		switch k.SASLMechanism {
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		default:
+			return fmt.Errorf("kafka.sasl_mechanism %q is not supported by kafka.client native (want PLAIN, SCRAM-SHA-256, or SCRAM-SHA-512)", k.SASLMechanism)
+		}
+	}
+	return nil
+}
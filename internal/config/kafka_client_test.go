@@ -0,0 +1,62 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateKafkaClient(t *testing.T) {
+	native := func(mod func(*Config)) *Config {
+		cfg := &Config{Kafka: KafkaConfig{Client: KafkaClientNative, CompressionType: "none", Acks: "all", Retries: 3}}
+		if mod != nil {
+			mod(cfg)
+		}
+		return cfg
+	}
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr string
+	}{
+		{"librdkafka", &Config{Kafka: KafkaConfig{CompressionType: "snappy", EnableIdempotence: true}}, ""},
+		{"native", native(nil), ""},
+		{"native gzip scram", native(func(c *Config) {
+			c.Kafka.CompressionType = "gzip"
+			c.Kafka.SASLUsername, c.Kafka.SASLPassword, c.Kafka.SASLMechanism = "u", "p", "SCRAM-SHA-512"
+		}), ""},
+		{"unknown client", &Config{Kafka: KafkaConfig{Client: "sarama"}}, "kafka.client: invalid value"},
+		{"oauthbearer", native(func(c *Config) {
+			c.Kafka.SASLUsername, c.Kafka.SASLPassword, c.Kafka.SASLMechanism = "u", "p", "OAUTHBEARER"
+		}), "kafka.sasl_mechanism"},
+		{"lz4", native(func(c *Config) { c.Kafka.CompressionType = "lz4" }), ""},
+		{"transactions", native(func(c *Config) { c.Kafka.Transactional.Enabled = true }), ""},
+		{"preflight and checks", native(func(c *Config) {
+			c.Kafka.Preflight = "fail"
+			c.Admin.Verify.Enabled = true
+			c.Clock.KafkaTopic = "clock"
+		}), ""},
+	}
+	for _, tt := range tests {
+		err := validateKafkaClient(tt.cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateKafkaClient() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateKafkaClient() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyKafkaClient(t *testing.T) {
+	cfg := &Config{Kafka: KafkaConfig{Client: "Native", CompressionType: "snappy", StrictOrdering: "idempotence"}}
+	applyKafkaClient(cfg)
+	if cfg.Kafka.Client != KafkaClientNative || cfg.Kafka.CompressionType != "snappy" {
+		t.Errorf("applyKafkaClient() = client %q, compression %q, want native, snappy", cfg.Kafka.Client, cfg.Kafka.CompressionType)
+	}
+	if m := cfg.OrderedKafkaConfigMap(); m["enable.idempotence"] != true {
+		t.Errorf("OrderedKafkaConfigMap() sets enable.idempotence = %v for the native client, want true", m["enable.idempotence"])
+	}
+}
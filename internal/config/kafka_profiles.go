@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kafka compatibility profiles for Kafka-protocol services that need
+// settings different from a stock Apache Kafka cluster.
+const (
+	KafkaProfileRedpanda  = "redpanda"
+	KafkaProfileEventHubs = "eventhubs"
+)
+
+// eventHubsUsername is the fixed SASL username Azure Event Hubs expects when
+// the password is a namespace connection string.
+const eventHubsUsername = "$ConnectionString"
+
+// eventHubsMaxMessageBytes is the Event Hubs per-event size limit (1 MB).
+const eventHubsMaxMessageBytes = 1000000
+
+// applyKafkaProfile fills in settings implied by the Kafka profile that the
+// user left unset. It runs after env overrides and before validation.
+func applyKafkaProfile(cfg *Config) {
+	switch strings.ToLower(cfg.Kafka.Profile) {
+	case KafkaProfileEventHubs:
+		// Event Hubs only speaks SASL PLAIN over TLS.
+		if cfg.Kafka.SASLUsername == "" {
+			cfg.Kafka.SASLUsername = eventHubsUsername
+		}
+		if cfg.Kafka.SecurityProtocol == "" || cfg.Kafka.SecurityProtocol == "PLAINTEXT" {
+			cfg.Kafka.SecurityProtocol = "SASL_SSL"
+		}
+		// snappy is the global default but Event Hubs rejects it.
+		if cfg.Kafka.CompressionType == "snappy" {
+			cfg.Kafka.CompressionType = "none"
+		}
+	}
+}
+
+// validateKafkaProfile rejects settings known not to work with the profile's
+// target service.
+func validateKafkaProfile(k KafkaConfig) error {
+	switch strings.ToLower(k.Profile) {
+	case "":
+		return nil
+	case KafkaProfileRedpanda:
+		return nil
+	case KafkaProfileEventHubs:
+		if k.SecurityProtocol != "SASL_SSL" {
+			return fmt.Errorf("kafka.profile eventhubs requires security_protocol SASL_SSL, got %q", k.SecurityProtocol)
+		}
+		if k.SASLMechanism != "PLAIN" {
+			return fmt.Errorf("kafka.profile eventhubs requires sasl_mechanism PLAIN, got %q", k.SASLMechanism)
+		}
+		if k.SASLUsername != eventHubsUsername {
+			return fmt.Errorf("kafka.profile eventhubs requires sasl_username %q (the password is the connection string)", eventHubsUsername)
+		}
+		if !strings.HasPrefix(k.SASLPassword, "Endpoint=sb://") {
+			return fmt.Errorf("kafka.profile eventhubs: sasl_password must be an Event Hubs connection string (Endpoint=sb://...)")
+		}
+		switch k.CompressionType {
+		case "none", "gzip":
+		default:
+			return fmt.Errorf("kafka.profile eventhubs supports compression_type none or gzip, got %q", k.CompressionType)
+		}
+		for _, b := range k.Brokers {
+			if !strings.HasSuffix(b, ":9093") {
+				return fmt.Errorf("kafka.profile eventhubs: broker %q must use port 9093 (<namespace>.servicebus.windows.net:9093)", b)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown kafka.profile %q (want %s or %s)", k.Profile, KafkaProfileRedpanda, KafkaProfileEventHubs)
+	}
+}
+
+// kafkaProfileSettings returns extra librdkafka settings for the profile.
+func kafkaProfileSettings(profile string) map[string]any {
+	switch strings.ToLower(profile) {
+	case KafkaProfileEventHubs:
+		// Microsoft's recommended librdkafka settings: Event Hubs closes idle
+		// connections after 240s and caps events at 1 MB.
+		return map[string]any{
+			"socket.keepalive.enable": true,
+			"metadata.max.age.ms":     180000,
+			"connections.max.idle.ms": 180000,
+			"request.timeout.ms":      60000,
+			"message.max.bytes":       eventHubsMaxMessageBytes,
+		}
+	case KafkaProfileRedpanda:
+		// Redpanda rejects batches over its kafka_batch_max_bytes (1 MiB by
+		// default) with a less obvious error than a client-side size check.
+		return map[string]any{
+			"message.max.bytes": 1 << 20,
+		}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testConnString = "Endpoint=sb://ns.servicebus.windows.net/;SharedAccessKeyName=send;SharedAccessKey=abc"
+
+func TestLoad_EventHubsProfileDefaults(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	data := []byte(`
+kafka:
+  profile: eventhubs
+  brokers:
+    - ns.servicebus.windows.net:9093
+`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KAFKA_SASL_PASSWORD", testConnString)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Kafka.SASLUsername != "$ConnectionString" {
+		t.Errorf("SASLUsername = %q, want $ConnectionString", cfg.Kafka.SASLUsername)
+	}
+	if cfg.Kafka.SecurityProtocol != "SASL_SSL" {
+		t.Errorf("SecurityProtocol = %q, want SASL_SSL", cfg.Kafka.SecurityProtocol)
+	}
+	if cfg.Kafka.CompressionType != "none" {
+		t.Errorf("CompressionType = %q, want none (snappy is unsupported)", cfg.Kafka.CompressionType)
+	}
+
+	m := cfg.KafkaConfigMap()
+	if m["message.max.bytes"] != eventHubsMaxMessageBytes {
+		t.Errorf("message.max.bytes = %v, want %d", m["message.max.bytes"], eventHubsMaxMessageBytes)
+	}
+	if m["sasl.username"] != "$ConnectionString" {
+		t.Errorf("sasl.username = %v, want $ConnectionString", m["sasl.username"])
+	}
+}
+
+func TestValidateKafkaProfile_EventHubs(t *testing.T) {
+	valid := KafkaConfig{
+		Profile:          KafkaProfileEventHubs,
+		Brokers:          []string{"ns.servicebus.windows.net:9093"},
+		SASLUsername:     "$ConnectionString",
+		SASLPassword:     testConnString,
+		SASLMechanism:    "PLAIN",
+		SecurityProtocol: "SASL_SSL",
+		CompressionType:  "gzip",
+	}
+	if err := validateKafkaProfile(valid); err != nil {
+		t.Fatalf("valid Event Hubs config rejected: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(*KafkaConfig)
+		wantErr string
+	}{
+		{"wrong username", func(k *KafkaConfig) { k.SASLUsername = "user" }, "$ConnectionString"},
+		{"password not a connection string", func(k *KafkaConfig) { k.SASLPassword = "secret" }, "connection string"},
+		{"plaintext", func(k *KafkaConfig) { k.SecurityProtocol = "PLAINTEXT" }, "SASL_SSL"},
+		{"scram", func(k *KafkaConfig) { k.SASLMechanism = "SCRAM-SHA-512" }, "PLAIN"},
+		{"snappy", func(k *KafkaConfig) { k.CompressionType = "snappy" }, "compression"},
+		{"wrong port", func(k *KafkaConfig) { k.Brokers = []string{"ns.servicebus.windows.net:9092"} }, "9093"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := valid
+			tt.mutate(&k)
+			err := validateKafkaProfile(k)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateKafkaProfile_Unknown(t *testing.T) {
+	if err := validateKafkaProfile(KafkaConfig{Profile: "kinesis"}); err == nil {
+		t.Error("unknown profile should be rejected")
+	}
+	if err := validateKafkaProfile(KafkaConfig{Profile: KafkaProfileRedpanda}); err != nil {
+		t.Errorf("redpanda profile should be accepted, got %v", err)
+	}
+}
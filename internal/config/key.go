@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/kahook/internal/keyexpr"
+)
+
+// KeyConfig derives a topic's message keys from the payload, for senders
+// that cannot set X-Webhook-Key. Path is a JSONPath into the body
+// ($.repository.id); Template is a Go template over .Body and .Headers
+// ({{.Headers.Get "X-GitHub-Event"}}-{{.Body.repository.id}}); set one.
+// A sender's X-Webhook-Key still wins. Payloads the rule finds no key in
+// are produced without one, or, with Required, rejected with 422 (or
+// quarantined as key_missing).
+type KeyConfig struct {
+	Path     string `yaml:"path"`
+	Template string `yaml:"template"`
+	Required bool   `yaml:"required"`
+}
+
+// Enabled reports whether keys are extracted.
+func (k KeyConfig) Enabled() bool {
+	return k.Path != "" || k.Template != ""
+}
+
+// Extractor compiles the key rule.
+func (k KeyConfig) Extractor() (*keyexpr.Extractor, error) {
+	return keyexpr.Compile(k.Path, k.Template)
+}
+
+// KeyExtractors returns the compiled key rule of each topic that sets one.
+func (c *Config) KeyExtractors() (map[string]*keyexpr.Extractor, error) {
+	extractors := make(map[string]*keyexpr.Extractor)
+	for name, t := range c.Topics {
+		if !t.Key.Enabled() {
+			continue
+		}
+		e, err := t.Key.Extractor()
+		if err != nil {
+			return nil, fmt.Errorf("topics.%s.key: %w", name, err)
+		}
+		extractors[name] = e
+	}
+	return extractors, nil
+}
+
+func validateKey(name string, k KeyConfig) error {
+	if !k.Enabled() {
+		if k.Required {
+			return fmt.Errorf("%s.required is set without a path or template", name)
+		}
+		return nil
+	}
+	if _, err := k.Extractor(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
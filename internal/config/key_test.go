@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     KeyConfig
+		wantErr string
+	}{
+		{"disabled", KeyConfig{}, ""},
+		{"path", KeyConfig{Path: "$.repository.id"}, ""},
+		{"template", KeyConfig{Template: `{{.Body.customer}}`, Required: true}, ""},
+		{"both", KeyConfig{Path: "$.id", Template: `{{.Body.id}}`}, "exactly one"},
+		{"bad path", KeyConfig{Path: "$.items[*].id"}, "wildcards"},
+		{"bad template", KeyConfig{Template: `{{.Body.id`}, "template"},
+		{"required without rule", KeyConfig{Required: true}, "without a path or template"},
+	}
+	for _, tt := range tests {
+		err := validateKey("topics.events.key", tt.key)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateKey() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateKey() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_RouteKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+kafka:
+  brokers: ["kafka:9092"]
+routes:
+  - path: github
+    topic: github-events
+    key:
+      path: $.repository.id
+      required: true
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if k := cfg.Topics["github-events"].Key; k.Path != "$.repository.id" || !k.Required {
+		t.Errorf("topics.github-events.key = %+v", k)
+	}
+	extractors, err := cfg.KeyExtractors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := extractors["github-events"].Extract(nil, []byte(`{"repository":{"id":42}}`)); !ok || got != "42" {
+		t.Errorf("Extract() = %q, %v, want 42", got, ok)
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import "fmt"
+
+// KeyHashConfig replaces a topic's message keys with their hash, for keys
+// that are PII such as email addresses. Equal keys still land on the same
+// partition, but record keys hold no raw identifiers. Algorithm is "sha256",
+// the hex SHA-256 of the key; with Pepper set it is the HMAC-SHA256 under
+// Pepper instead, so keys cannot be recovered by hashing candidate values.
+// Changing Pepper changes every key, and with it partition assignment.
+type KeyHashConfig struct {
+	Algorithm string `yaml:"algorithm" enum:"sha256"`
+	Pepper    string `yaml:"pepper" secret:"true"`
+}
+
+// Enabled reports whether keys are hashed.
+func (k KeyHashConfig) Enabled() bool {
+	return k.Algorithm != ""
+}
+
+func validateKeyHash(name string, k KeyHashConfig) error {
+	switch k.Algorithm {
+	case "sha256":
+		return nil
+	case "":
+		if k.Pepper != "" {
+			return fmt.Errorf("%s.pepper is set without an algorithm", name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s.algorithm: invalid value %q (want sha256)", name, k.Algorithm)
+	}
+}
@@ -0,0 +1,32 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateKeyHash(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyHash KeyHashConfig
+		wantErr string
+	}{
+		{"disabled", KeyHashConfig{}, ""},
+		{"sha256", KeyHashConfig{Algorithm: "sha256"}, ""},
+		{"peppered", KeyHashConfig{Algorithm: "sha256", Pepper: "p"}, ""},
+		{"unknown algorithm", KeyHashConfig{Algorithm: "md5"}, "algorithm"},
+		{"pepper without algorithm", KeyHashConfig{Pepper: "p"}, "without an algorithm"},
+	}
+	for _, tt := range tests {
+		err := validateKeyHash("topics.users.key_hash", tt.keyHash)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateKeyHash() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateKeyHash() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
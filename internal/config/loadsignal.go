@@ -0,0 +1,24 @@
+package config
+
+import "fmt"
+
+// LoadSignalConfig sets the targets of the load signal on /admin/load and
+// the kahook_load gauge, which autoscalers (KEDA, or an HPA on external
+// metrics) can scale on instead of CPU. The load is the largest of the
+// produce queue fill, the webhooks in flight over TargetInFlight, and the
+// mean produce latency over TargetLatencyMs, so 1 means some component is
+// at its target. A zero target leaves its component out.
+type LoadSignalConfig struct {
+	TargetInFlight  int `yaml:"target_in_flight"`
+	TargetLatencyMs int `yaml:"target_latency_ms"`
+}
+
+func validateLoadSignal(c LoadSignalConfig) error {
+	if c.TargetInFlight < 0 {
+		return fmt.Errorf("load_signal.target_in_flight must not be negative, got %d", c.TargetInFlight)
+	}
+	if c.TargetLatencyMs < 0 {
+		return fmt.Errorf("load_signal.target_latency_ms must not be negative, got %d", c.TargetLatencyMs)
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateLoadSignal(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     LoadSignalConfig
+		wantErr string
+	}{
+		{"queue only", LoadSignalConfig{}, ""},
+		{"targets", LoadSignalConfig{TargetInFlight: 200, TargetLatencyMs: 250}, ""},
+		{"negative in flight", LoadSignalConfig{TargetInFlight: -1}, "load_signal.target_in_flight"},
+		{"negative latency", LoadSignalConfig{TargetLatencyMs: -1}, "load_signal.target_latency_ms"},
+	}
+	for _, tt := range tests {
+		err := validateLoadSignal(tt.cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateLoadSignal() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateLoadSignal() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_LoadSignalFromEnv(t *testing.T) {
+	t.Setenv("LOAD_SIGNAL_TARGET_IN_FLIGHT", "150")
+	t.Setenv("LOAD_SIGNAL_TARGET_LATENCY_MS", "300")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.LoadSignal.TargetInFlight != 150 || cfg.LoadSignal.TargetLatencyMs != 300 {
+		t.Errorf("load_signal = %+v, want 150 in flight and 300ms", cfg.LoadSignal)
+	}
+}
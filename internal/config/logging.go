@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Request log fields that can be added to the default ones.
+const (
+	LogFieldQuery     = "query"
+	LogFieldUserAgent = "user_agent"
+	LogFieldPrincipal = "principal"
+	LogFieldHeaders   = "headers"
+)
+
+var logFields = []string{LogFieldQuery, LogFieldUserAgent, LogFieldPrincipal, LogFieldHeaders}
+
+// LoggingConfig controls the line logged for each request. Format is
+// "json" (default), "console", or "common" (Apache Common Log Format).
+// Fields adds any of query, user_agent, principal, and headers to the
+// method, path, status, duration, remote address, and request ID logged by
+// default; headers logs the request headers named in Headers, with
+// credentials redacted. Common Log Format lines have fixed fields.
+// SampleRatio keeps that fraction of successful requests, zero meaning
+// all; 4xx and 5xx responses are always logged.
+type LoggingConfig struct {
+	Format      string   `yaml:"format" enum:"json,console,common"`
+	Fields      []string `yaml:"fields"`
+	Headers     []string `yaml:"headers"`
+	SampleRatio float64  `yaml:"sample_ratio"`
+}
+
+// HasField reports whether Fields includes name.
+func (l LoggingConfig) HasField(name string) bool {
+	return slices.Contains(l.Fields, name)
+}
+
+func validateLogging(l LoggingConfig) error {
+	switch l.Format {
+	case "", "json", "console", "common":
+	default:
+		return fmt.Errorf("server.logging.format: invalid value %q (want json, console, or common)", l.Format)
+	}
+	for _, f := range l.Fields {
+		if !slices.Contains(logFields, f) {
+			return fmt.Errorf("server.logging.fields: unknown field %q (want %s)", f, strings.Join(logFields, ", "))
+		}
+	}
+	if l.HasField(LogFieldHeaders) != (len(l.Headers) > 0) {
+		return fmt.Errorf("server.logging.headers and the headers field of server.logging.fields must be set together")
+	}
+	for _, h := range l.Headers {
+		if h == "" || strings.ContainsAny(h, " :\t") {
+			return fmt.Errorf("server.logging.headers: invalid header name %q", h)
+		}
+	}
+	if l.SampleRatio < 0 || l.SampleRatio > 1 {
+		return fmt.Errorf("server.logging.sample_ratio must be between 0 and 1, got %g", l.SampleRatio)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateLogging(t *testing.T) {
+	tests := []struct {
+		name    string
+		log     LoggingConfig
+		wantErr string
+	}{
+		{"default", LoggingConfig{}, ""},
+		{"common", LoggingConfig{Format: "common", SampleRatio: 0.1}, ""},
+		{"fields", LoggingConfig{Format: "console", Fields: []string{"query", "user_agent", "principal", "headers"}, Headers: []string{"X-Tenant"}}, ""},
+		{"bad format", LoggingConfig{Format: "xml"}, "server.logging.format"},
+		{"unknown field", LoggingConfig{Fields: []string{"body"}}, "unknown field"},
+		{"headers without field", LoggingConfig{Headers: []string{"X-Tenant"}}, "set together"},
+		{"field without headers", LoggingConfig{Fields: []string{"headers"}}, "set together"},
+		{"bad header", LoggingConfig{Fields: []string{"headers"}, Headers: []string{"X Tenant"}}, "invalid header name"},
+		{"sample above one", LoggingConfig{SampleRatio: 2}, "sample_ratio"},
+	}
+	for _, tt := range tests {
+		err := validateLogging(tt.log)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateLogging() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateLogging() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_LoggingFromEnv(t *testing.T) {
+	t.Setenv("SERVER_LOG_FORMAT", "common")
+	t.Setenv("SERVER_LOG_FIELDS", "query,principal")
+	t.Setenv("SERVER_LOG_SAMPLE_RATIO", "0.25")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := LoggingConfig{Format: "common", Fields: []string{"query", "principal"}, SampleRatio: 0.25}
+	if !reflect.DeepEqual(cfg.Server.Logging, want) {
+		t.Errorf("server.logging = %+v, want %+v", cfg.Server.Logging, want)
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kahook/internal/jsonschema"
+)
+
+// loadPayloadSchema reads and compiles the JSON Schema file at path.
+func loadPayloadSchema(path string) (*jsonschema.Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := jsonschema.Compile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// PayloadSchemas returns the compiled schema of each topic that sets one.
+// Payloads sent to such a topic are validated against it before producing,
+// and those that do not match are rejected with 422, or quarantined as
+// schema_invalid, so malformed events never reach consumers.
+func (c *Config) PayloadSchemas() (map[string]*jsonschema.Schema, error) {
+	schemas := make(map[string]*jsonschema.Schema)
+	for name, t := range c.Topics {
+		if t.Schema == "" {
+			continue
+		}
+		s, err := loadPayloadSchema(t.Schema)
+		if err != nil {
+			return nil, fmt.Errorf("topics.%s.schema: %w", name, err)
+		}
+		schemas[name] = s
+	}
+	return schemas, nil
+}
+
+func validatePayloadSchema(name, path string) error {
+	if path == "" {
+		return nil
+	}
+	if _, err := loadPayloadSchema(path); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
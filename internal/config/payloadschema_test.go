@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad_PayloadSchema(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "order.json")
+	if err := os.WriteFile(schemaPath, []byte(`{"type": "object", "required": ["id"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config.yaml")
+	yaml := `
+routes:
+  - path: shop
+    topic: orders
+    schema: ` + schemaPath + `
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	schemas, err := cfg.PayloadSchemas()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := schemas["orders"]
+	if s == nil {
+		t.Fatalf("PayloadSchemas() = %v, want one for orders", schemas)
+	}
+	if problems := s.Validate([]byte(`{"name": "x"}`)); len(problems) != 1 {
+		t.Errorf("Validate() = %v, want the missing id", problems)
+	}
+
+	if err := os.WriteFile(schemaPath, []byte(`{"type": "objekt"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "topics.orders.schema") {
+		t.Errorf("Load() error = %v, want the invalid schema reported", err)
+	}
+
+	if err := os.Remove(schemaPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("Load() error = %v, want the missing schema file reported", err)
+	}
+}
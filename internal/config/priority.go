@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// defaultPriorityHeader is the request header trusted callers set a
+// webhook's priority class with.
+const defaultPriorityHeader = "Kahook-Priority"
+
+// PriorityConfig sheds webhooks by priority class under saturation. With
+// MaxInFlight webhooks in flight at once, low-priority ones are answered 429
+// once ShedLowAt of them are in use and normal-priority ones once
+// ShedNormalAt are; high-priority topics keep being accepted until every
+// slot is taken. Topics and routes set their class with priority; callers
+// listed in TrustedPrincipals or TrustedCIDRs may override it per request
+// with Header. Zero MaxInFlight disables shedding.
+type PriorityConfig struct {
+	MaxInFlight       int      `yaml:"max_in_flight"`
+	ShedLowAt         float64  `yaml:"shed_low_at"`
+	ShedNormalAt      float64  `yaml:"shed_normal_at"`
+	Header            string   `yaml:"header"`
+	TrustedPrincipals []string `yaml:"trusted_principals"`
+	TrustedCIDRs      []string `yaml:"trusted_cidrs"`
+}
+
+// TrustedNetworks parses TrustedCIDRs, accepting bare IPs as
+// single-address networks.
+func (p PriorityConfig) TrustedNetworks() ([]netip.Prefix, error) {
+	return parseNetworks(p.TrustedCIDRs)
+}
+
+func validatePriority(cfg *Config) error {
+	p := cfg.Limits.Priority
+	if p.MaxInFlight < 0 {
+		return fmt.Errorf("limits.priority.max_in_flight must not be negative, got %d", p.MaxInFlight)
+	}
+	// Thresholds and trusted callers only matter once shedding is enabled.
+	if p.MaxInFlight > 0 {
+		if p.ShedLowAt <= 0 || p.ShedLowAt > 1 {
+			return fmt.Errorf("limits.priority.shed_low_at must be in (0, 1], got %v", p.ShedLowAt)
+		}
+		if p.ShedNormalAt <= 0 || p.ShedNormalAt > 1 {
+			return fmt.Errorf("limits.priority.shed_normal_at must be in (0, 1], got %v", p.ShedNormalAt)
+		}
+		if p.ShedLowAt > p.ShedNormalAt {
+			return fmt.Errorf("limits.priority.shed_low_at (%v) must not exceed shed_normal_at (%v)", p.ShedLowAt, p.ShedNormalAt)
+		}
+		if !validHeaderName.MatchString(p.Header) {
+			return fmt.Errorf("limits.priority.header: %q is not a valid header name", p.Header)
+		}
+		if _, err := p.TrustedNetworks(); err != nil {
+			return fmt.Errorf("limits.priority.trusted_cidrs: %w", err)
+		}
+		for _, t := range p.TrustedPrincipals {
+			if t == "" {
+				return fmt.Errorf("limits.priority.trusted_principals: entries must not be empty")
+			}
+		}
+	}
+	for name, t := range cfg.Topics {
+		switch t.Priority {
+		case "", "high", "normal", "low":
+		default:
+			return fmt.Errorf("topics.%s.priority: invalid value %q (want high, normal, or low)", name, t.Priority)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePriority(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*Config)
+		wantErr string
+	}{
+		{"defaults", func(*Config) {}, ""},
+		{"enabled", func(c *Config) {
+			c.Limits.Priority.MaxInFlight = 500
+			c.Limits.Priority.TrustedCIDRs = []string{"10.0.0.0/8", "192.0.2.1"}
+			c.Topics = map[string]TopicConfig{"payments": {Priority: "high"}}
+		}, ""},
+		{"disabled ignores thresholds", func(c *Config) { c.Limits.Priority = PriorityConfig{} }, ""},
+		{"negative max", func(c *Config) { c.Limits.Priority.MaxInFlight = -1 }, "max_in_flight"},
+		{"zero shed_low_at", func(c *Config) { c.Limits.Priority.MaxInFlight = 100; c.Limits.Priority.ShedLowAt = 0 }, "shed_low_at"},
+		{"shed_normal_at over 1", func(c *Config) { c.Limits.Priority.MaxInFlight = 100; c.Limits.Priority.ShedNormalAt = 1.5 }, "shed_normal_at"},
+		{"low above normal", func(c *Config) { c.Limits.Priority.MaxInFlight = 100; c.Limits.Priority.ShedLowAt = 0.9 }, "must not exceed"},
+		{"bad header", func(c *Config) { c.Limits.Priority.MaxInFlight = 100; c.Limits.Priority.Header = "Kahook Priority" }, "header"},
+		{"bad cidr", func(c *Config) {
+			c.Limits.Priority.MaxInFlight = 100
+			c.Limits.Priority.TrustedCIDRs = []string{"10.0.0.0/33"}
+		}, "trusted_cidrs"},
+		{"empty principal", func(c *Config) {
+			c.Limits.Priority.MaxInFlight = 100
+			c.Limits.Priority.TrustedPrincipals = []string{""}
+		}, "trusted_principals"},
+		{"bad topic priority", func(c *Config) {
+			c.Topics = map[string]TopicConfig{"payments": {Priority: "urgent"}}
+		}, "topics.payments.priority"},
+	}
+	for _, tt := range tests {
+		cfg := defaults()
+		tt.modify(cfg)
+		err := validatePriority(cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validatePriority() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validatePriority() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyRoutes_Priority(t *testing.T) {
+	cfg := defaults()
+	cfg.Routes = []RouteConfig{
+		{Path: "stripe", Topic: "payments", Priority: "high"},
+		{Path: "stripe-legacy", Topic: "payments", Priority: "low"},
+	}
+	if err := applyRoutes(cfg); err == nil || !strings.Contains(err.Error(), "different options") {
+		t.Fatalf("applyRoutes() error = %v, want a conflict between priorities", err)
+	}
+
+	cfg.Routes = cfg.Routes[:1]
+	if err := applyRoutes(cfg); err != nil {
+		t.Fatalf("applyRoutes() error = %v", err)
+	}
+	if got := cfg.Topics["payments"].Priority; got != "high" {
+		t.Errorf("topics.payments.priority = %q, want high", got)
+	}
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// ProbeConfig controls access to /health and /ready. With Auth set they
+// require publish credentials or a metrics token, like /metrics. Requests
+// from BypassCIDRs, such as the kubelet's node range or link-local
+// addresses, are always let through, so enabling Auth (or the hardened
+// settings that call for it) does not fail liveness and readiness probes.
+type ProbeConfig struct {
+	Auth        bool     `yaml:"auth"`
+	BypassCIDRs []string `yaml:"bypass_cidrs"`
+}
+
+// BypassNetworks parses BypassCIDRs, accepting bare IPs as single-address
+// networks.
+func (p ProbeConfig) BypassNetworks() ([]netip.Prefix, error) {
+	return parseNetworks(p.BypassCIDRs)
+}
+
+func validateProbes(p ProbeConfig) error {
+	if _, err := p.BypassNetworks(); err != nil {
+		return fmt.Errorf("server.probes.bypass_cidrs: %w", err)
+	}
+	return nil
+}
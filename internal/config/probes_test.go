@@ -0,0 +1,43 @@
+package config
+
+import (
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoad_ProbesFromEnv(t *testing.T) {
+	t.Setenv("SERVER_PROBE_AUTH", "true")
+	t.Setenv("SERVER_PROBE_BYPASS_CIDRS", "10.0.0.0/8,169.254.0.0/16,fe80::1")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.Server.Probes.Auth {
+		t.Error("server.probes.auth = false, want true")
+	}
+	nets, err := cfg.Server.Probes.BypassNetworks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("169.254.0.0/16"),
+		netip.MustParsePrefix("fe80::1/128"),
+	}
+	if !reflect.DeepEqual(nets, want) {
+		t.Errorf("BypassNetworks() = %v, want %v", nets, want)
+	}
+}
+
+func TestValidateProbes(t *testing.T) {
+	// Bypass networks may be configured before probe auth is turned on.
+	if err := validateProbes(ProbeConfig{BypassCIDRs: []string{"10.0.0.0/8"}}); err != nil {
+		t.Errorf("validateProbes() error = %v", err)
+	}
+	err := validateProbes(ProbeConfig{Auth: true, BypassCIDRs: []string{"kubelet"}})
+	if err == nil || !strings.Contains(err.Error(), "server.probes.bypass_cidrs") {
+		t.Errorf("validateProbes() error = %v, want a bypass_cidrs error", err)
+	}
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+)
+
+// quarantineViolations are the soft policy violations that can be
+// quarantined.
+var quarantineViolations = []string{"header_size", "not_json", "invalid_json", "upcast_failed", "schema_invalid", "key_missing", "transform_failed"}
+
+// QuarantineConfig produces webhooks that break soft policies to Topic,
+// with the violation and the topic they were sent to as message headers,
+// instead of rejecting them. Violations lists which kinds are quarantined:
+// header_size (headers over limits.max_header_bytes), not_json (non-JSON
+// body on a json_only topic), invalid_json, upcast_failed, schema_invalid
+// (a payload that does not match its topic's schema), key_missing (a
+// payload its topic's required key is not found in), and transform_failed
+// (a payload a route's transforms cannot apply to); empty means all of
+// them. An empty Topic disables quarantine.
+type QuarantineConfig struct {
+	Topic      string   `yaml:"topic"`
+	Violations []string `yaml:"violations"`
+}
+
+func validateQuarantine(cfg *Config) error {
+	if n := cfg.Limits.MaxHeaderBytes; n < 0 {
+		return fmt.Errorf("limits.max_header_bytes must not be negative, got %d", n)
+	}
+	q := cfg.Quarantine
+	if q.Topic == "" {
+		return nil
+	}
+	if !validRouteName.MatchString(q.Topic) {
+		return fmt.Errorf("quarantine.topic: %q must match [a-zA-Z0-9._-] and be 1-249 characters", q.Topic)
+	}
+	for _, v := range q.Violations {
+		if !slices.Contains(quarantineViolations, v) {
+			return fmt.Errorf("quarantine.violations: unknown violation %q (want one of %v)", v, quarantineViolations)
+		}
+	}
+	return nil
+}
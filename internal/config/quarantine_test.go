@@ -0,0 +1,52 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateQuarantine(t *testing.T) {
+	tests := []struct {
+		name       string
+		quarantine QuarantineConfig
+		maxHeader  int
+		wantErr    string
+	}{
+		{"disabled", QuarantineConfig{}, 0, ""},
+		{"header limit without quarantine", QuarantineConfig{}, 8192, ""},
+		{"all violations", QuarantineConfig{Topic: "kahook.quarantine"}, 8192, ""},
+		{"some violations", QuarantineConfig{Topic: "kahook.quarantine", Violations: []string{"header_size", "invalid_json"}}, 0, ""},
+		{"negative header limit", QuarantineConfig{}, -1, "limits.max_header_bytes"},
+		{"bad topic", QuarantineConfig{Topic: "quarantine/all"}, 0, "quarantine.topic"},
+		{"unknown violation", QuarantineConfig{Topic: "kahook.quarantine", Violations: []string{"rate_limit"}}, 0, "quarantine.violations"},
+	}
+	for _, tt := range tests {
+		cfg := &Config{Quarantine: tt.quarantine, Limits: LimitsConfig{MaxHeaderBytes: tt.maxHeader}}
+		err := validateQuarantine(cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateQuarantine() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateQuarantine() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_QuarantineFromEnv(t *testing.T) {
+	t.Setenv("QUARANTINE_TOPIC", "kahook.quarantine")
+	t.Setenv("LIMITS_MAX_HEADER_BYTES", "16384")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Quarantine.Topic != "kahook.quarantine" || cfg.Limits.MaxHeaderBytes != 16384 {
+		t.Errorf("quarantine = %+v, max_header_bytes = %d", cfg.Quarantine, cfg.Limits.MaxHeaderBytes)
+	}
+	if !slices.Contains(cfg.KafkaTopics(), "kahook.quarantine") {
+		t.Errorf("KafkaTopics() = %v, want the quarantine topic included", cfg.KafkaTopics())
+	}
+}
@@ -0,0 +1,24 @@
+package config
+
+import "fmt"
+
+// ReceiptsConfig produces a receipt (request and message ID, topic,
+// partition, offset, and timestamp) to Topic for every webhook message
+// delivered, so senders that consume it can reconcile what they sent
+// against what was written. Buffer bounds the receipts waiting to be
+// produced (default 4096); receipts beyond it are dropped and counted. An
+// empty Topic disables it.
+type ReceiptsConfig struct {
+	Topic  string `yaml:"topic"`
+	Buffer int    `yaml:"buffer"`
+}
+
+func validateReceipts(r ReceiptsConfig) error {
+	if r.Topic != "" && !validRouteName.MatchString(r.Topic) {
+		return fmt.Errorf("receipts.topic: %q must match [a-zA-Z0-9._-] and be 1-249 characters", r.Topic)
+	}
+	if r.Buffer < 0 {
+		return fmt.Errorf("receipts.buffer must not be negative, got %d", r.Buffer)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateReceipts(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipts ReceiptsConfig
+		wantErr  string
+	}{
+		{"disabled", ReceiptsConfig{}, ""},
+		{"topic", ReceiptsConfig{Topic: "kahook.receipts", Buffer: 1000}, ""},
+		{"bad topic", ReceiptsConfig{Topic: "receipts/all"}, "receipts.topic"},
+		{"negative buffer", ReceiptsConfig{Topic: "kahook.receipts", Buffer: -1}, "receipts.buffer"},
+	}
+	for _, tt := range tests {
+		err := validateReceipts(tt.receipts)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateReceipts() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateReceipts() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_ReceiptsFromEnv(t *testing.T) {
+	t.Setenv("RECEIPTS_TOPIC", "kahook.receipts")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Receipts.Topic != "kahook.receipts" {
+		t.Errorf("receipts.topic = %q, want kahook.receipts", cfg.Receipts.Topic)
+	}
+	if !slices.Contains(cfg.KafkaTopics(), "kahook.receipts") {
+		t.Errorf("KafkaTopics() = %v, want the receipts topic included", cfg.KafkaTopics())
+	}
+}
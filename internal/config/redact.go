@@ -0,0 +1,95 @@
+package config
+
+import (
+	"reflect"
+
+	"github.com/kahook/internal/redact"
+)
+
+// Fields holding credentials are tagged secret:"true", or secret:"url" for
+// connection URLs that may embed them. Redacted and Secrets find them by
+// tag, so a new credential field only needs the tag to be covered.
+
+// Redacted returns a deep copy of c with every secret replaced by
+// redact.Placeholder, safe to print or serve.
+func (c *Config) Redacted() *Config {
+	out := redactValue(reflect.ValueOf(*c), "")
+	cfg := out.Interface().(Config)
+	return &cfg
+}
+
+// Secrets returns every credential value in c, for scrubbing from logs.
+func (c *Config) Secrets() []string {
+	var secrets []string
+	collectSecrets(reflect.ValueOf(*c), "", &secrets)
+	return secrets
+}
+
+// redactValue copies v, masking strings according to tag, the secret tag of
+// the field v was read from.
+func redactValue(v reflect.Value, tag string) reflect.Value {
+	out := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			out.Field(i).Set(redactValue(v.Field(i), v.Type().Field(i).Tag.Get("secret")))
+		}
+	case reflect.Slice:
+		if v.IsNil() {
+			return out
+		}
+		out.Set(reflect.MakeSlice(v.Type(), v.Len(), v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			out.Index(i).Set(redactValue(v.Index(i), tag))
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return out
+		}
+		out.Set(reflect.MakeMapWithSize(v.Type(), v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			out.SetMapIndex(iter.Key(), redactValue(iter.Value(), tag))
+		}
+	case reflect.String:
+		switch tag {
+		case "true":
+			out.SetString(redact.Mask(v.String()))
+		case "url":
+			out.SetString(redact.URL(v.String()))
+		default:
+			out.Set(v)
+		}
+	default:
+		out.Set(v)
+	}
+	return out
+}
+
+func collectSecrets(v reflect.Value, tag string, secrets *[]string) {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			collectSecrets(v.Field(i), v.Type().Field(i).Tag.Get("secret"), secrets)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectSecrets(v.Index(i), tag, secrets)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			collectSecrets(iter.Value(), tag, secrets)
+		}
+	case reflect.String:
+		s := v.String()
+		if tag == "url" {
+			s = redact.URLSecret(s)
+		} else if tag != "true" {
+			s = ""
+		}
+		if s != "" {
+			*secrets = append(*secrets, s)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultReloadInterval is how often, in seconds, a watched config file is
+// checked when ReloadConfig.Interval is zero.
+const defaultReloadInterval = 5
+
+// ReloadConfig controls reloading the config file while serving. SIGHUP
+// always reloads it; with Watch the file is also checked every Interval
+// seconds (default 5) and reloaded when its contents change. A reload
+// applies credentials, the topic allowlist, routes and topics (signature
+// secrets included), and request and bandwidth limits, and rebuilds the
+// producer when broker or backend settings change. Other changes are logged
+// and take effect at the next restart.
+type ReloadConfig struct {
+	Watch    bool `yaml:"watch"`
+	Interval int  `yaml:"interval"`
+}
+
+// WatchInterval returns Interval, or the default when it is unset.
+func (r ReloadConfig) WatchInterval() int {
+	if r.Interval > 0 {
+		return r.Interval
+	}
+	return defaultReloadInterval
+}
+
+func validateReload(r ReloadConfig) error {
+	if r.Interval < 0 {
+		return fmt.Errorf("reload.interval must not be negative, got %d", r.Interval)
+	}
+	return nil
+}
+
+// Settings a reload applies, and those that need a new producer, as config
+// paths. A path matches its own changes and those of everything under it.
+var (
+	reloadablePaths = []string{
+		"auth.type", "auth.users", "auth.tokens", "auth.jwt", "auth.scopes",
+		"server.allowed_topics", "routes", "topics",
+		"limits.requests", "limits.bandwidth",
+	}
+	producerPaths = []string{"backend", "kafka", "pulsar", "nats", "file"}
+)
+
+// producerTopicSettings are the topic and route settings the producer is
+// built from.
+var producerTopicSettings = []string{".backend", ".ordering", ".partitioning"}
+
+// ReloadPlan is what reloading a running config involves.
+type ReloadPlan struct {
+	// Changes lists every setting that differs.
+	Changes []Change
+	// RebuildProducer is set when broker or backend settings changed.
+	RebuildProducer bool
+	// Restart lists the changes a reload cannot apply.
+	Restart []Change
+}
+
+// PlanReload compares the running config with the one to reload.
+func PlanReload(running, next *Config) ReloadPlan {
+	plan := ReloadPlan{Changes: Diff(running, next)}
+	for _, c := range plan.Changes {
+		switch {
+		case underAny(c.Path, producerPaths):
+			plan.RebuildProducer = true
+		case underAny(c.Path, reloadablePaths):
+			for _, s := range producerTopicSettings {
+				if strings.HasSuffix(c.Path, s) {
+					plan.RebuildProducer = true
+				}
+			}
+		default:
+			plan.Restart = append(plan.Restart, c)
+		}
+	}
+	return plan
+}
+
+// underAny reports whether path is one of prefixes or a setting under one.
+func underAny(path string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if path == p || strings.HasPrefix(path, p+".") || strings.HasPrefix(path, p+"[") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPlanReload(t *testing.T) {
+	base := func() *Config {
+		cfg := secretConfig()
+		cfg.Routes = []RouteConfig{{Path: "github", Topic: "github"}}
+		return cfg
+	}
+	tests := []struct {
+		name        string
+		change      func(*Config)
+		wantRebuild bool
+		wantRestart []string
+	}{
+		{"none", func(*Config) {}, false, nil},
+		{"credentials and routes", func(c *Config) {
+			c.Auth.Tokens = c.Auth.Tokens[:1]
+			c.Routes = append(c.Routes, RouteConfig{Path: "shop", Topic: "orders", Signature: SignatureConfig{Secret: "s"}})
+			c.Limits.Requests.Global.RequestsPerSecond = 10
+		}, false, nil},
+		{"brokers", func(c *Config) { c.Kafka.Brokers = []string{"b:9092"} }, true, nil},
+		{"route backend", func(c *Config) { c.Routes[0].Backend = "devnull" }, true, nil},
+		{"port", func(c *Config) { c.Server.Port = 9090 }, false, []string{"server.port"}},
+	}
+	for _, tt := range tests {
+		next := base()
+		tt.change(next)
+		plan := PlanReload(base(), next)
+		if plan.RebuildProducer != tt.wantRebuild {
+			t.Errorf("%s: RebuildProducer = %v, want %v", tt.name, plan.RebuildProducer, tt.wantRebuild)
+		}
+		var restart []string
+		for _, c := range plan.Restart {
+			restart = append(restart, c.Path)
+		}
+		if strings.Join(restart, ",") != strings.Join(tt.wantRestart, ",") {
+			t.Errorf("%s: Restart = %v, want %v", tt.name, restart, tt.wantRestart)
+		}
+	}
+}
+
+func TestValidateReload(t *testing.T) {
+	if err := validateReload(ReloadConfig{Watch: true}); err != nil {
+		t.Errorf("validateReload() error = %v", err)
+	}
+	if err := validateReload(ReloadConfig{Interval: -1}); err == nil {
+		t.Error("validateReload() accepted a negative interval")
+	}
+}
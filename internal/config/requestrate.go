@@ -0,0 +1,59 @@
+package config
+
+import "fmt"
+
+// RequestRateConfig limits webhook requests per second, checked before the
+// body is read. Global caps the whole instance; PerTopic and PerPrincipal
+// are the defaults applied to every topic and every authenticated
+// principal, and Topics and Principals override them by name. A zero rate
+// disables the corresponding limit.
+//
+//	limits:
+//	  requests:
+//	    per_principal:
+//	      requests_per_second: 50
+//	      burst: 200
+type RequestRateConfig struct {
+	Global       RequestRate            `yaml:"global"`
+	PerTopic     RequestRate            `yaml:"per_topic"`
+	PerPrincipal RequestRate            `yaml:"per_principal"`
+	Topics       map[string]RequestRate `yaml:"topics"`
+	Principals   map[string]RequestRate `yaml:"principals"`
+}
+
+// RequestRate is a sustained request rate with an optional burst allowance.
+// Burst defaults to one second's worth of RequestsPerSecond.
+type RequestRate struct {
+	RequestsPerSecond float64 `yaml:"requests_per_second"`
+	Burst             int     `yaml:"burst"`
+}
+
+func validateRequestRate(c RequestRateConfig) error {
+	check := func(name string, r RequestRate) error {
+		if r.RequestsPerSecond < 0 || r.Burst < 0 {
+			return fmt.Errorf("limits.requests.%s: requests_per_second and burst must not be negative", name)
+		}
+		return nil
+	}
+
+	if err := check("global", c.Global); err != nil {
+		return err
+	}
+	if err := check("per_topic", c.PerTopic); err != nil {
+		return err
+	}
+	if err := check("per_principal", c.PerPrincipal); err != nil {
+		return err
+	}
+	for name, r := range c.Topics {
+		if err := check("topics."+name, r); err != nil {
+			return err
+		}
+	}
+	for name, r := range c.Principals {
+		if err := check("principals."+name, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
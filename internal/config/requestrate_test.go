@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad_RequestRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte(`
+limits:
+  requests:
+    global:
+      requests_per_second: 1000
+    per_principal:
+      requests_per_second: 50
+      burst: 200
+    topics:
+      github:
+        requests_per_second: 0.5
+`)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	rr := cfg.Limits.Requests
+	if rr.Global.RequestsPerSecond != 1000 {
+		t.Errorf("global.requests_per_second = %v, want 1000", rr.Global.RequestsPerSecond)
+	}
+	if rr.PerPrincipal.Burst != 200 {
+		t.Errorf("per_principal.burst = %d, want 200", rr.PerPrincipal.Burst)
+	}
+	if got := rr.Topics["github"].RequestsPerSecond; got != 0.5 {
+		t.Errorf("topics.github.requests_per_second = %v, want 0.5", got)
+	}
+}
+
+func TestValidateRequestRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    RequestRateConfig
+		wantErr string
+	}{
+		{"disabled", RequestRateConfig{}, ""},
+		{"negative global", RequestRateConfig{Global: RequestRate{RequestsPerSecond: -1}}, "limits.requests.global"},
+		{"negative burst", RequestRateConfig{PerTopic: RequestRate{RequestsPerSecond: 1, Burst: -1}}, "limits.requests.per_topic"},
+		{"negative override", RequestRateConfig{Principals: map[string]RequestRate{"ci": {RequestsPerSecond: -5}}}, "principals.ci"},
+	}
+	for _, tt := range tests {
+		err := validateRequestRate(tt.rate)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateRequestRate() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateRequestRate() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kahook/internal/jws"
+)
+
+// ResponseSigningConfig signs webhook response bodies with a detached JWS
+// in the X-JWS-Signature header, so callers can prove after the fact that
+// kahook acknowledged a delivery. KeyFile is a PEM private key: Ed25519,
+// ECDSA P-256 or P-384, or RSA of at least 2048 bits. KeyID is the kid
+// signatures carry; it defaults to the key's RFC 7638 thumbprint.
+type ResponseSigningConfig struct {
+	KeyFile string `yaml:"key_file"`
+	KeyID   string `yaml:"key_id"`
+}
+
+// Enabled reports whether responses are signed.
+func (r ResponseSigningConfig) Enabled() bool {
+	return r.KeyFile != ""
+}
+
+// Signer loads the signing key.
+func (r ResponseSigningConfig) Signer() (*jws.Signer, error) {
+	b, err := os.ReadFile(r.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	return jws.NewSigner(b, r.KeyID)
+}
+
+func validateResponseSigning(r ResponseSigningConfig) error {
+	if !r.Enabled() {
+		if r.KeyID != "" {
+			return fmt.Errorf("server.response_signing.key_id requires key_file")
+		}
+		return nil
+	}
+	if _, err := r.Signer(); err != nil {
+		return fmt.Errorf("server.response_signing.key_file: %w", err)
+	}
+	return nil
+}
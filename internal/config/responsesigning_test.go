@@ -0,0 +1,54 @@
+package config
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateResponseSigning(t *testing.T) {
+	dir := t.TempDir()
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "signing.pem")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	notKey := filepath.Join(dir, "not-a-key.pem")
+	if err := os.WriteFile(notKey, []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		signing ResponseSigningConfig
+		wantErr string
+	}{
+		{"disabled", ResponseSigningConfig{}, ""},
+		{"key", ResponseSigningConfig{KeyFile: keyFile}, ""},
+		{"key with kid", ResponseSigningConfig{KeyFile: keyFile, KeyID: "kahook-2024"}, ""},
+		{"kid without key", ResponseSigningConfig{KeyID: "kahook-2024"}, "requires key_file"},
+		{"missing file", ResponseSigningConfig{KeyFile: filepath.Join(dir, "missing.pem")}, "key_file"},
+		{"not a key", ResponseSigningConfig{KeyFile: notKey}, "no PEM block"},
+	}
+	for _, tt := range tests {
+		err := validateResponseSigning(tt.signing)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateResponseSigning() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateResponseSigning() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,265 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RouteConfig is one webhook endpoint and everything that applies to it:
+// the path it is served on, the topic it produces to, and the per-topic
+// options that would otherwise be spread over topics, limits, and the
+// allowlist.
+//
+//	routes:
+//	  - path: github
+//	    topic: scm.github.events
+//	    payload: json_only
+//	    bandwidth:
+//	      bytes_per_second: 1048576
+type RouteConfig struct {
+	// Path is the URL path segment the route is served on (/github);
+	// it defaults to Topic.
+	Path string `yaml:"path"`
+
+	// Topic is the topic messages are produced to.
+	Topic string `yaml:"topic"`
+
+	// Payload, Ordering, Partitioning, Backend, Priority, Response,
+	// Compression, MaxBodyBytes, Signature, KeyHash, Key, Schema, and
+	// CloudEvents are as in TopicConfig.
+	Payload      string `yaml:"payload" enum:"raw,base64,json_only"`
+	Ordering     string `yaml:"ordering" enum:"strict"`
+	Partitioning string `yaml:"partitioning" enum:"sticky,round_robin"`
+	Backend      string `yaml:"backend" enum:"kafka,pulsar,nats,file,devnull"`
+	Priority     string `yaml:"priority" enum:"high,normal,low"`
+	Response     string `yaml:"response" enum:"json,text,none"`
+	Compression  string `yaml:"compression" enum:"decompress,keep"`
+	MaxBodyBytes int64  `yaml:"max_body_bytes"`
+
+	Signature SignatureConfig `yaml:"signature"`
+	KeyHash   KeyHashConfig   `yaml:"key_hash"`
+	Key       KeyConfig       `yaml:"key"`
+	Schema    string          `yaml:"schema"`
+
+	CloudEvents CloudEventsConfig `yaml:"cloudevents"`
+
+	// Bandwidth limits the topic's body bytes per second, overriding
+	// limits.bandwidth.per_topic.
+	Bandwidth ByteRate `yaml:"bandwidth"`
+
+	// Countries restricts the client countries the route accepts; it
+	// requires geoip.database.
+	Countries CountryPolicy `yaml:"countries"`
+
+	// AllowedCIDRs, when set, are the only client networks the route
+	// accepts, such as a provider's published webhook source ranges. Bare
+	// IPs are single-address networks; see ClientIPConfig for clients
+	// behind HTTP proxies.
+	AllowedCIDRs []string `yaml:"allowed_cidrs"`
+
+	// Upcast rewrites payloads sent in older versions; see UpcastConfig.
+	Upcast UpcastConfig `yaml:"upcast"`
+
+	// Transforms reshape payloads before producing; see TransformConfig.
+	Transforms []TransformConfig `yaml:"transforms"`
+
+	// Headers are static message headers attached to every message from
+	// this route (source: github, env: prod), so consumers can filter
+	// without a transformation. They replace request headers of the same
+	// name. Unlike the options above they belong to the path, so routes
+	// sharing a topic can tag their messages differently.
+	Headers map[string]string `yaml:"headers"`
+}
+
+// reservedPaths are served by kahook itself and cannot be route paths.
+var reservedPaths = map[string]bool{"health": true, "ready": true, "metrics": true, "admin": true}
+
+// validRouteName matches the characters the server accepts in a topic path:
+// letters, digits, dots, underscores, and hyphens, 1-249 characters.
+var validRouteName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// path returns the route's path, defaulting to its topic.
+func (r RouteConfig) path() string {
+	if r.Path != "" {
+		return r.Path
+	}
+	return r.Topic
+}
+
+// topicConfig returns the per-topic settings the route carries.
+func (r RouteConfig) topicConfig() TopicConfig {
+	return TopicConfig{
+		Payload:      r.Payload,
+		Ordering:     r.Ordering,
+		Partitioning: r.Partitioning,
+		Backend:      r.Backend,
+		Priority:     r.Priority,
+		Response:     r.Response,
+		Compression:  r.Compression,
+		MaxBodyBytes: r.MaxBodyBytes,
+		Signature:    r.Signature,
+		KeyHash:      r.KeyHash,
+		Key:          r.Key,
+		Schema:       r.Schema,
+		CloudEvents:  r.CloudEvents,
+	}
+}
+
+// validateRoutes checks each route on its own and that no two share a path.
+// Option values are checked along with the topics section they are merged
+// into.
+func validateRoutes(routes []RouteConfig) error {
+	paths := make(map[string]int, len(routes))
+	for i, r := range routes {
+		if !validRouteName.MatchString(r.Topic) {
+			return fmt.Errorf("routes[%d]: topic %q must match [a-zA-Z0-9._-] and be 1-249 characters", i, r.Topic)
+		}
+		path := r.path()
+		if !validRouteName.MatchString(path) {
+			return fmt.Errorf("routes[%d]: path %q must be a single segment of [a-zA-Z0-9._-]", i, path)
+		}
+		if reservedPaths[path] {
+			return fmt.Errorf("routes[%d]: path %q is reserved", i, path)
+		}
+		if j, ok := paths[path]; ok {
+			return fmt.Errorf("routes[%d]: path %q is already used by routes[%d]", i, path, j)
+		}
+		paths[path] = i
+		if r.Bandwidth.BytesPerSecond < 0 || r.Bandwidth.BurstBytes < 0 {
+			return fmt.Errorf("routes[%d]: bandwidth bytes_per_second and burst_bytes must not be negative", i)
+		}
+		if err := validateCountryPolicy(fmt.Sprintf("routes[%d].countries", i), r.Countries); err != nil {
+			return err
+		}
+		if _, err := parseNetworks(r.AllowedCIDRs); err != nil {
+			return fmt.Errorf("routes[%d].allowed_cidrs: %w", i, err)
+		}
+		if err := validateUpcast(fmt.Sprintf("routes[%d].upcast", i), r.Upcast); err != nil {
+			return err
+		}
+		if err := validateTransforms(fmt.Sprintf("routes[%d].transforms", i), r.Transforms); err != nil {
+			return err
+		}
+		for name := range r.Headers {
+			if !validHeaderName.MatchString(name) {
+				return fmt.Errorf("routes[%d].headers: %q is not a valid header name", i, name)
+			}
+			if strings.HasPrefix(strings.ToLower(name), "kahook-") {
+				return fmt.Errorf("routes[%d].headers: %q is reserved; Kahook- headers are set by kahook", i, name)
+			}
+		}
+	}
+	return nil
+}
+
+// applyRoutes merges routes into the per-topic settings the rest of the
+// configuration is read from, so everything downstream sees one model. A
+// topic configured both by a route and in topics or limits.bandwidth.topics,
+// or by two routes with different options, is an error. When an allowlist or
+// strict routes is in use, route topics are added to the allowlist.
+func applyRoutes(cfg *Config) error {
+	if len(cfg.Routes) == 0 {
+		return nil
+	}
+	if err := validateRoutes(cfg.Routes); err != nil {
+		return err
+	}
+
+	fromRoute := make(map[string]int)
+	for i, r := range cfg.Routes {
+		if j, ok := fromRoute[r.Topic]; ok {
+			prev := cfg.Routes[j]
+			if r.topicConfig() != prev.topicConfig() || r.Bandwidth != prev.Bandwidth || !r.Countries.equal(prev.Countries) || !allowedCIDRsEqual(r.AllowedCIDRs, prev.AllowedCIDRs) || !r.Upcast.equal(prev.Upcast) || !transformsEqual(r.Transforms, prev.Transforms) {
+				return fmt.Errorf("routes[%d]: topic %q is also the target of routes[%d] with different options", i, r.Topic, j)
+			}
+			continue
+		}
+		if _, ok := cfg.Topics[r.Topic]; ok {
+			return fmt.Errorf("routes[%d]: topic %q is also configured under topics; configure it in one place", i, r.Topic)
+		}
+		if _, ok := cfg.Limits.Bandwidth.Topics[r.Topic]; ok {
+			return fmt.Errorf("routes[%d]: topic %q is also configured under limits.bandwidth.topics; configure it in one place", i, r.Topic)
+		}
+		fromRoute[r.Topic] = i
+	}
+
+	restrict := len(cfg.Server.AllowedTopics) > 0 || cfg.Server.StrictRoutes
+	allowed := make(map[string]bool, len(cfg.Server.AllowedTopics))
+	for _, t := range cfg.Server.AllowedTopics {
+		allowed[t] = true
+	}
+
+	for topic, i := range fromRoute {
+		r := cfg.Routes[i]
+		if tc := r.topicConfig(); tc != (TopicConfig{}) {
+			if cfg.Topics == nil {
+				cfg.Topics = make(map[string]TopicConfig)
+			}
+			cfg.Topics[topic] = tc
+		}
+		if r.Bandwidth != (ByteRate{}) {
+			if cfg.Limits.Bandwidth.Topics == nil {
+				cfg.Limits.Bandwidth.Topics = make(map[string]ByteRate)
+			}
+			cfg.Limits.Bandwidth.Topics[topic] = r.Bandwidth
+		}
+		if restrict && !allowed[topic] {
+			allowed[topic] = true
+			cfg.Server.AllowedTopics = append(cfg.Server.AllowedTopics, topic)
+		}
+	}
+	sort.Strings(cfg.Server.AllowedTopics)
+	return nil
+}
+
+// RoutePaths maps route paths to the topic they produce to, for routes
+// served on a path other than their topic's name.
+func (c *Config) RoutePaths() map[string]string {
+	paths := make(map[string]string)
+	for _, r := range c.Routes {
+		if p := r.path(); p != r.Topic {
+			paths[p] = r.Topic
+		}
+	}
+	return paths
+}
+
+// RouteHeaders maps route paths to the static headers their messages carry,
+// for routes that set any.
+func (c *Config) RouteHeaders() map[string]map[string]string {
+	headers := make(map[string]map[string]string)
+	for _, r := range c.Routes {
+		if len(r.Headers) > 0 {
+			headers[r.path()] = r.Headers
+		}
+	}
+	return headers
+}
+
+// AliasedTopics returns the topics served only at their route paths when
+// server.route_paths_only is set: those whose routes all have a path other
+// than the topic's name. It is nil otherwise.
+func (c *Config) AliasedTopics() []string {
+	if !c.Server.RoutePathsOnly {
+		return nil
+	}
+	aliased := make(map[string]bool)
+	for _, r := range c.Routes {
+		if _, ok := aliased[r.Topic]; !ok {
+			aliased[r.Topic] = true
+		}
+		if r.path() == r.Topic {
+			aliased[r.Topic] = false
+		}
+	}
+	var topics []string
+	for t, ok := range aliased {
+		if ok {
+			topics = append(topics, t)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
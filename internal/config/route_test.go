@@ -0,0 +1,174 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		routes  []RouteConfig
+		wantErr bool
+	}{
+		{"topic only", []RouteConfig{{Topic: "orders"}}, false},
+		{"path and topic", []RouteConfig{{Path: "github", Topic: "scm.github.events"}}, false},
+		{"missing topic", []RouteConfig{{Path: "github"}}, true},
+		{"invalid path", []RouteConfig{{Path: "a/b", Topic: "t"}}, true},
+		{"reserved path", []RouteConfig{{Path: "metrics", Topic: "t"}}, true},
+		{"reserved by topic name", []RouteConfig{{Topic: "health"}}, true},
+		{"duplicate path", []RouteConfig{{Path: "hook", Topic: "a"}, {Path: "hook", Topic: "b"}}, true},
+		{"duplicate implicit path", []RouteConfig{{Topic: "a"}, {Path: "a", Topic: "b"}}, true},
+		{"negative bandwidth", []RouteConfig{{Topic: "a", Bandwidth: ByteRate{BytesPerSecond: -1}}}, true},
+	}
+	for _, tt := range tests {
+		if err := validateRoutes(tt.routes); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateRoutes() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestApplyRoutes_MergesIntoTopicSettings(t *testing.T) {
+	cfg := &Config{Routes: []RouteConfig{
+		{Path: "github", Topic: "scm.events", Payload: "json_only", Bandwidth: ByteRate{BytesPerSecond: 1024}},
+		{Path: "gitlab", Topic: "scm.events", Payload: "json_only", Bandwidth: ByteRate{BytesPerSecond: 1024}},
+		{Topic: "orders", Backend: BackendNATS},
+		{Topic: "plain"},
+	}}
+	if err := applyRoutes(cfg); err != nil {
+		t.Fatalf("applyRoutes() error = %v", err)
+	}
+
+	wantTopics := map[string]TopicConfig{
+		"scm.events": {Payload: "json_only"},
+		"orders":     {Backend: BackendNATS},
+	}
+	if !reflect.DeepEqual(cfg.Topics, wantTopics) {
+		t.Errorf("Topics = %v, want %v", cfg.Topics, wantTopics)
+	}
+	if got := cfg.Limits.Bandwidth.Topics["scm.events"]; got.BytesPerSecond != 1024 {
+		t.Errorf("bandwidth for scm.events = %+v, want 1024 B/s", got)
+	}
+	// Without an allowlist, routes only add options; they do not restrict.
+	if len(cfg.Server.AllowedTopics) != 0 {
+		t.Errorf("AllowedTopics = %v, want none", cfg.Server.AllowedTopics)
+	}
+
+	wantPaths := map[string]string{"github": "scm.events", "gitlab": "scm.events"}
+	if got := cfg.RoutePaths(); !reflect.DeepEqual(got, wantPaths) {
+		t.Errorf("RoutePaths() = %v, want %v", got, wantPaths)
+	}
+}
+
+func TestApplyRoutes_ExtendsAllowlist(t *testing.T) {
+	cfg := &Config{
+		Server: ServerConfig{StrictRoutes: true},
+		Routes: []RouteConfig{{Path: "github", Topic: "scm.events"}, {Topic: "orders"}},
+	}
+	if err := applyRoutes(cfg); err != nil {
+		t.Fatalf("applyRoutes() error = %v", err)
+	}
+	if want := []string{"orders", "scm.events"}; !reflect.DeepEqual(cfg.Server.AllowedTopics, want) {
+		t.Errorf("AllowedTopics = %v, want %v", cfg.Server.AllowedTopics, want)
+	}
+}
+
+func TestApplyRoutes_Conflicts(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"route and topics section", Config{
+			Routes: []RouteConfig{{Topic: "orders", Payload: "base64"}},
+			Topics: map[string]TopicConfig{"orders": {Payload: "raw"}},
+		}},
+		{"route and bandwidth section", Config{
+			Routes: []RouteConfig{{Topic: "orders"}},
+			Limits: LimitsConfig{Bandwidth: BandwidthConfig{Topics: map[string]ByteRate{"orders": {BytesPerSecond: 1}}}},
+		}},
+		{"routes disagree on a topic", Config{
+			Routes: []RouteConfig{{Path: "a", Topic: "orders"}, {Path: "b", Topic: "orders", Ordering: "strict"}},
+		}},
+	}
+	for _, tt := range tests {
+		if err := applyRoutes(&tt.cfg); err == nil {
+			t.Errorf("%s: applyRoutes() should fail", tt.name)
+		}
+	}
+}
+
+func TestLoad_Routes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+server:
+  strict_routes: true
+routes:
+  - path: github
+    topic: scm.github.events
+    payload: json_only
+  - topic: orders
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := cfg.Topics["scm.github.events"].Payload; got != "json_only" {
+		t.Errorf("payload = %q, want json_only", got)
+	}
+	if got := cfg.KafkaTopics(); !reflect.DeepEqual(got, []string{"orders", "scm.github.events"}) {
+		t.Errorf("KafkaTopics() = %v", got)
+	}
+}
+
+func TestAliasedTopics(t *testing.T) {
+	cfg := &Config{
+		Routes: []RouteConfig{
+			{Path: "github", Topic: "events.github.raw"},
+			{Path: "gitlab", Topic: "scm.events"},
+			{Topic: "scm.events"},
+			{Topic: "orders"},
+		},
+	}
+	if got := cfg.AliasedTopics(); got != nil {
+		t.Errorf("AliasedTopics() without route_paths_only = %v, want nil", got)
+	}
+	cfg.Server.RoutePathsOnly = true
+	if got, want := cfg.AliasedTopics(), []string{"events.github.raw"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("AliasedTopics() = %v, want %v", got, want)
+	}
+}
+
+func TestRouteHeaders(t *testing.T) {
+	cfg := &Config{
+		Routes: []RouteConfig{
+			{Path: "github", Topic: "scm.events", Headers: map[string]string{"source": "github", "env": "prod"}},
+			{Path: "gitlab", Topic: "scm.events", Headers: map[string]string{"source": "gitlab"}},
+			{Topic: "orders"},
+		},
+	}
+	if err := applyRoutes(cfg); err != nil {
+		t.Fatalf("applyRoutes() error = %v; routes sharing a topic may differ in headers", err)
+	}
+	want := map[string]map[string]string{
+		"github": {"source": "github", "env": "prod"},
+		"gitlab": {"source": "gitlab"},
+	}
+	if got := cfg.RouteHeaders(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RouteHeaders() = %v, want %v", got, want)
+	}
+
+	for name, routes := range map[string][]RouteConfig{
+		"invalid name":  {{Topic: "a", Headers: map[string]string{"bad name": "x"}}},
+		"reserved name": {{Topic: "a", Headers: map[string]string{"kahook-message-id": "x"}}},
+	} {
+		if err := validateRoutes(routes); err == nil {
+			t.Errorf("%s: validateRoutes() accepted %v", name, routes[0].Headers)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxSchemaErrors caps how many problems one config file reports, so a file
+// for the wrong program does not produce a wall of errors.
+const maxSchemaErrors = 10
+
+// schema is a JSON Schema node. Only the keywords the config needs are used.
+type schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Type                 string             `json:"type"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Properties           map[string]*schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *schema            `json:"items,omitempty"`
+}
+
+// configSchema is derived from the Config struct's yaml and enum tags once,
+// so it describes exactly what Load accepts.
+var configSchema = func() *schema {
+	s := schemaFor(reflect.TypeOf(Config{}))
+	s.Schema = "https://json-schema.org/draft/2020-12/schema"
+	s.Title = "kahook configuration"
+	return s
+}()
+
+// Schema returns the JSON Schema for the config file, for editors and CI to
+// validate config.yaml against.
+func Schema() ([]byte, error) {
+	return json.MarshalIndent(configSchema, "", "  ")
+}
+
+func schemaFor(t reflect.Type) *schema {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaFor(t.Elem())
+	case reflect.Struct:
+		s := &schema{Type: "object", Properties: make(map[string]*schema), AdditionalProperties: false}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "" || name == "-" {
+				continue
+			}
+			prop := schemaFor(f.Type)
+			if enum := f.Tag.Get("enum"); enum != "" {
+				prop.Enum = strings.Split(enum, ",")
+			}
+			s.Properties[name] = prop
+		}
+		return s
+	case reflect.Map:
+		return &schema{Type: "object", AdditionalProperties: schemaFor(t.Elem())}
+	case reflect.Slice:
+		return &schema{Type: "array", Items: schemaFor(t.Elem())}
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	default:
+		return &schema{Type: "string"}
+	}
+}
+
+// checkSchema validates a parsed config file against the schema, reporting
+// each problem with its line number and dotted path.
+func checkSchema(doc *yaml.Node) error {
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil
+	}
+	var errs []error
+	checkNode(doc.Content[0], configSchema, "", &errs)
+	if len(errs) > maxSchemaErrors {
+		errs = append(errs[:maxSchemaErrors], fmt.Errorf("... and %d more", len(errs)-maxSchemaErrors))
+	}
+	return errors.Join(errs...)
+}
+
+func checkNode(n *yaml.Node, s *schema, path string, errs *[]error) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	// An empty value (key: or key: ~) leaves the default in place.
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!null" {
+		return
+	}
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, fmt.Errorf("line %d: %s: %s", n.Line, displayPath(path), fmt.Sprintf(format, args...)))
+	}
+
+	switch s.Type {
+	case "object":
+		if n.Kind != yaml.MappingNode {
+			fail("want a mapping, got %s", describe(n))
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			if key.Value == "<<" {
+				checkNode(value, s, path, errs)
+				continue
+			}
+			child := path + "." + key.Value
+			prop, ok := s.Properties[key.Value]
+			if !ok {
+				extra, isSchema := s.AdditionalProperties.(*schema)
+				if !isSchema {
+					*errs = append(*errs, fmt.Errorf("line %d: %s: unknown field%s", key.Line, displayPath(child), knownFields(s)))
+					continue
+				}
+				prop = extra
+			}
+			checkNode(value, prop, child, errs)
+		}
+	case "array":
+		if n.Kind != yaml.SequenceNode {
+			fail("want a list, got %s", describe(n))
+			return
+		}
+		for i, item := range n.Content {
+			checkNode(item, s.Items, fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	default:
+		if n.Kind != yaml.ScalarNode {
+			fail("want %s, got %s", typeName(s.Type), describe(n))
+			return
+		}
+		switch {
+		case s.Type == "integer" && n.Tag != "!!int",
+			s.Type == "number" && n.Tag != "!!int" && n.Tag != "!!float",
+			s.Type == "boolean" && n.Tag != "!!bool":
+			fail("want %s, got %q", typeName(s.Type), n.Value)
+		case len(s.Enum) > 0 && n.Value != "" && !slices.Contains(s.Enum, n.Value):
+			fail("invalid value %q (want %s)", n.Value, strings.Join(s.Enum, ", "))
+		}
+	}
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "(top level)"
+	}
+	return strings.TrimPrefix(path, ".")
+}
+
+func typeName(t string) string {
+	if t == "integer" {
+		return "an integer"
+	}
+	return "a " + t
+}
+
+func describe(n *yaml.Node) string {
+	switch n.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", n.Value)
+	}
+}
+
+// knownFields lists the fields s accepts, to make typos easy to spot.
+func knownFields(s *schema) string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return " (known fields: " + strings.Join(names, ", ") + ")"
+}
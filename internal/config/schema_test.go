@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSchema_MatchesCommittedFile(t *testing.T) {
+	schema, err := Schema()
+	if err != nil {
+		t.Fatalf("Schema() error = %v", err)
+	}
+	committed, err := os.ReadFile("../../config.schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bytes.TrimSpace(committed), schema) {
+		t.Error("config.schema.json is out of date; run make schema")
+	}
+}
+
+func TestLoadFile_BundledConfigsMatchSchema(t *testing.T) {
+	for _, path := range []string{"../../config.yaml", "../../config.confluent.yaml"} {
+		if err := loadFile(defaults(), path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+func TestLoadFile_SchemaErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `server:
+  prot: 8080
+  port: eighty
+backend: kafak
+topics:
+  orders:
+    payload: json
+routes:
+  - topic: events
+    ordering: loose
+leader_election:
+  enabled: maybe
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := loadFile(defaults(), path)
+	if err == nil {
+		t.Fatal("loadFile() should fail")
+	}
+	for _, want := range []string{
+		"line 2: server.prot: unknown field (known fields: ",
+		`line 3: server.port: want an integer, got "eighty"`,
+		`line 4: backend: invalid value "kafak" (want kafka, pulsar, nats, file, devnull)`,
+		`line 7: topics.orders.payload: invalid value "json"`,
+		`line 10: routes[0].ordering: invalid value "loose"`,
+		`line 12: leader_election.enabled: want a boolean, got "maybe"`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error missing %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadFile_SchemaAllowsEmptyValuesAndAnchors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `profile:
+server:
+  allowed_topics: ~
+limits:
+  bandwidth:
+    per_topic: &rate
+      bytes_per_second: 1024
+    per_principal: *rate
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := defaults()
+	if err := loadFile(cfg, path); err != nil {
+		t.Fatalf("loadFile() error = %v", err)
+	}
+	if cfg.Limits.Bandwidth.PerPrincipal.BytesPerSecond != 1024 {
+		t.Errorf("per_principal = %+v, want the anchored rate", cfg.Limits.Bandwidth.PerPrincipal)
+	}
+}
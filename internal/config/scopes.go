@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kahook/internal/auth"
+)
+
+// validScopePattern matches a topic name, a topic prefix ending in "*", or
+// "*" alone.
+var validScopePattern = regexp.MustCompile(`^[a-zA-Z0-9._-]*\*?$`)
+
+// validateScopes checks auth.scopes: principals (Basic usernames, token
+// fingerprints, or "jwt:" and a subject) mapped to the topics they may
+// publish to. Usernames and fingerprints must be those of configured
+// credentials, so a typo does not leave its principal unrestricted; JWT
+// subjects are only known when tokens arrive.
+func validateScopes(a AuthConfig) error {
+	if (len(a.Scopes) > 0 || a.DenyUnlisted) && len(a.Users) == 0 && len(a.Tokens) == 0 && !a.JWT.Enabled() {
+		return fmt.Errorf("auth.scopes requires users, tokens, or auth.jwt")
+	}
+	principals := make(map[string]bool, len(a.Users)+len(a.Tokens))
+	for _, u := range a.Users {
+		principals[u.Username] = true
+	}
+	for _, t := range a.Tokens {
+		principals[auth.TokenFingerprint(t)] = true
+	}
+	for principal, topics := range a.Scopes {
+		switch {
+		case principal == "":
+			return fmt.Errorf("auth.scopes: principal must not be empty")
+		case strings.HasPrefix(principal, "jwt:"):
+			if !a.JWT.Enabled() {
+				return fmt.Errorf("auth.scopes.%s: JWT subjects require auth.jwt", principal)
+			}
+		case strings.HasPrefix(principal, "token:") && !principals[principal]:
+			return fmt.Errorf("auth.scopes.%s: no token in auth.tokens has this fingerprint", principal)
+		case !principals[principal]:
+			return fmt.Errorf("auth.scopes.%s: no user in auth.users has this name", principal)
+		}
+		for _, t := range topics {
+			if t == "" || !validScopePattern.MatchString(t) {
+				return fmt.Errorf("auth.scopes.%s: %q is not a topic name, a prefix ending in *, or *", principal, t)
+			}
+		}
+	}
+	if p := a.JWT.ScopePrefix; p != "" && strings.ContainsAny(p, " \t") {
+		return fmt.Errorf("auth.jwt.scope_prefix must not contain spaces")
+	}
+	return nil
+}
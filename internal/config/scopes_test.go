@@ -0,0 +1,45 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/kahook/internal/auth"
+)
+
+func TestValidateScopes(t *testing.T) {
+	users := []UserConfig{{Username: "billing", Password: "s3cret"}}
+	tests := []struct {
+		name    string
+		auth    AuthConfig
+		wantErr string
+	}{
+		{"none", AuthConfig{Type: "none"}, ""},
+		{"topics and prefixes", AuthConfig{Type: "basic", Users: users, Tokens: []string{"audit-token"}, Scopes: map[string][]string{"billing": {"invoices", "payments.*"}, auth.TokenFingerprint("audit-token"): {"*"}}}, ""},
+		{"deny unlisted", AuthConfig{Type: "basic", Users: users, DenyUnlisted: true}, ""},
+		{"deny unlisted without auth", AuthConfig{Type: "none", DenyUnlisted: true}, "auth.scopes requires"},
+		{"unknown user", AuthConfig{Type: "basic", Users: users, Scopes: map[string][]string{"biling": {"invoices"}}}, "no user in auth.users"},
+		{"unknown token", AuthConfig{Type: "basic", Users: users, Tokens: []string{"audit-token"}, Scopes: map[string][]string{"token:3f5a9c0e": {"audit"}}}, "no token in auth.tokens"},
+		{"jwt subject without jwt", AuthConfig{Type: "basic", Users: users, Scopes: map[string][]string{"jwt:svc": {"orders"}}}, "require auth.jwt"},
+		{"empty list", AuthConfig{Type: "basic", Users: users, Scopes: map[string][]string{"billing": {}}}, ""},
+		{"jwt subject", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: "https://idp/jwks"}, Scopes: map[string][]string{"jwt:svc": {"orders"}}}, ""},
+		{"without auth", AuthConfig{Type: "none", Scopes: map[string][]string{"billing": {"orders"}}}, "auth.scopes requires"},
+		{"empty principal", AuthConfig{Type: "basic", Users: users, Scopes: map[string][]string{"": {"orders"}}}, "principal must not be empty"},
+		{"empty topic", AuthConfig{Type: "basic", Users: users, Scopes: map[string][]string{"billing": {""}}}, "auth.scopes.billing"},
+		{"star inside", AuthConfig{Type: "basic", Users: users, Scopes: map[string][]string{"billing": {"pay*ments"}}}, "auth.scopes.billing"},
+		{"bad topic", AuthConfig{Type: "basic", Users: users, Scopes: map[string][]string{"billing": {"orders/eu"}}}, "auth.scopes.billing"},
+		{"spaced prefix", AuthConfig{Type: "jwt", JWT: JWTConfig{JWKSURL: "https://idp/jwks", ScopePrefix: "kahook publish:"}}, "scope_prefix"},
+	}
+	for _, tt := range tests {
+		err := validateScopes(tt.auth)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateScopes() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateScopes() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
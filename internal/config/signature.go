@@ -0,0 +1,62 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/kahook/internal/signature"
+)
+
+// SignatureConfig rejects webhooks to a topic with 401 unless they carry a
+// valid provider signature made with Secret. Scheme is "github"
+// (X-Hub-Signature-256, an HMAC-SHA256 of the body), "gitlab"
+// (X-Gitlab-Token, the secret itself), or "stripe" (Stripe-Signature, an
+// HMAC-SHA256 of the timestamp and body, with the timestamp no more than
+// Tolerance seconds off; default 300).
+//
+//	topics:
+//	  scm.github.events:
+//	    signature:
+//	      scheme: github
+//	      secret: my-webhook-secret
+type SignatureConfig struct {
+	Scheme    string `yaml:"scheme" enum:"github,gitlab,stripe"`
+	Secret    string `yaml:"secret" secret:"true"`
+	Tolerance int    `yaml:"tolerance"`
+}
+
+// Verifier builds the signature scheme the config describes, or returns nil
+// when none is configured. Stripe timestamps are checked against now; nil
+// means time.Now.
+func (s SignatureConfig) Verifier(now func() time.Time) signature.Scheme {
+	switch s.Scheme {
+	case "github":
+		return signature.NewGitHub([]byte(s.Secret))
+	case "gitlab":
+		return signature.NewGitLab([]byte(s.Secret))
+	case "stripe":
+		return signature.NewStripe([]byte(s.Secret), time.Duration(s.Tolerance)*time.Second, now)
+	default:
+		return nil
+	}
+}
+
+func validateSignature(name string, s SignatureConfig) error {
+	switch s.Scheme {
+	case "":
+		if s.Secret != "" {
+			return fmt.Errorf("%s.secret is set without a scheme", name)
+		}
+		return nil
+	case "github", "gitlab", "stripe":
+	default:
+		return fmt.Errorf("%s.scheme: invalid value %q (want github, gitlab, or stripe)", name, s.Scheme)
+	}
+	if s.Secret == "" {
+		return fmt.Errorf("%s.secret is required for the %s scheme", name, s.Scheme)
+	}
+	if s.Tolerance < 0 {
+		return fmt.Errorf("%s.tolerance must not be negative, got %d", name, s.Tolerance)
+	}
+	return nil
+}
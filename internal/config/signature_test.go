@@ -0,0 +1,59 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateSignature(t *testing.T) {
+	tests := []struct {
+		name    string
+		sig     SignatureConfig
+		wantErr string
+	}{
+		{"none", SignatureConfig{}, ""},
+		{"github", SignatureConfig{Scheme: "github", Secret: "s"}, ""},
+		{"stripe with tolerance", SignatureConfig{Scheme: "stripe", Secret: "whsec_s", Tolerance: 60}, ""},
+		{"unknown scheme", SignatureConfig{Scheme: "slack", Secret: "s"}, "scheme"},
+		{"missing secret", SignatureConfig{Scheme: "gitlab"}, "secret is required"},
+		{"secret without scheme", SignatureConfig{Secret: "s"}, "without a scheme"},
+		{"negative tolerance", SignatureConfig{Scheme: "stripe", Secret: "s", Tolerance: -1}, "tolerance"},
+	}
+	for _, tt := range tests {
+		err := validateSignature("topics.t.signature", tt.sig)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateSignature() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateSignature() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_RouteSignature(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "routes:\n  - path: github\n    topic: scm.github.events\n    signature:\n      scheme: github\n      secret: github-webhook-secret\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	sig := cfg.Topics["scm.github.events"].Signature
+	if sig.Scheme != "github" || sig.Verifier(nil) == nil {
+		t.Errorf("signature = %+v, want the route's github scheme", sig)
+	}
+	if !slices.Contains(cfg.Secrets(), "github-webhook-secret") {
+		t.Error("Secrets() does not include the signature secret")
+	}
+	if strings.Contains(cfg.Redacted().Topics["scm.github.events"].Signature.Secret, "github-webhook-secret") {
+		t.Error("Redacted() leaks the signature secret")
+	}
+}
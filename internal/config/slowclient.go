@@ -0,0 +1,25 @@
+package config
+
+import "fmt"
+
+// validateSlowClients checks the limits that stop slow or greedy clients
+// from tying up connections: read_header_timeout (seconds) bounds reading
+// request headers, min_body_rate (bytes per second) closes requests whose
+// body trickles in slower than that, and max_requests_per_connection
+// closes keep-alive connections after that many requests. Zero disables
+// each of them.
+func validateSlowClients(s ServerConfig) error {
+	if s.ReadHeaderTimeout < 0 {
+		return fmt.Errorf("server.read_header_timeout must not be negative, got %d", s.ReadHeaderTimeout)
+	}
+	if s.ReadTimeout > 0 && s.ReadHeaderTimeout > s.ReadTimeout {
+		return fmt.Errorf("server.read_header_timeout (%d) must not exceed server.read_timeout (%d)", s.ReadHeaderTimeout, s.ReadTimeout)
+	}
+	if s.MinBodyRate < 0 {
+		return fmt.Errorf("server.min_body_rate must not be negative, got %d", s.MinBodyRate)
+	}
+	if s.MaxRequestsPerConnection < 0 {
+		return fmt.Errorf("server.max_requests_per_connection must not be negative, got %d", s.MaxRequestsPerConnection)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestValidateSlowClients(t *testing.T) {
+	tests := []struct {
+		name    string
+		server  ServerConfig
+		wantErr bool
+	}{
+		{"disabled", ServerConfig{}, false},
+		{"all set", ServerConfig{ReadTimeout: 10, ReadHeaderTimeout: 5, MinBodyRate: 1024, MaxRequestsPerConnection: 1000}, false},
+		{"header timeout without read timeout", ServerConfig{ReadHeaderTimeout: 30}, false},
+		{"negative header timeout", ServerConfig{ReadHeaderTimeout: -1}, true},
+		{"header timeout above read timeout", ServerConfig{ReadTimeout: 10, ReadHeaderTimeout: 20}, true},
+		{"negative body rate", ServerConfig{MinBodyRate: -1}, true},
+		{"negative requests per connection", ServerConfig{MaxRequestsPerConnection: -1}, true},
+	}
+	for _, tt := range tests {
+		if err := validateSlowClients(tt.server); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateSlowClients() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_SlowClientsFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	orig, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.Chdir(orig) }()
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Server.ReadHeaderTimeout != 5 {
+		t.Errorf("default read_header_timeout = %d, want 5", cfg.Server.ReadHeaderTimeout)
+	}
+
+	t.Setenv("SERVER_READ_HEADER_TIMEOUT", "2")
+	t.Setenv("SERVER_MIN_BODY_RATE", "4096")
+	t.Setenv("SERVER_MAX_REQUESTS_PER_CONNECTION", "500")
+	cfg, err = Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if s := cfg.Server; s.ReadHeaderTimeout != 2 || s.MinBodyRate != 4096 || s.MaxRequestsPerConnection != 500 {
+		t.Errorf("server = %d/%d/%d, want 2/4096/500", s.ReadHeaderTimeout, s.MinBodyRate, s.MaxRequestsPerConnection)
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import "fmt"
+
+// StartupConfig sets what happens when the producer cannot be created at
+// startup. Producer is "fail" (default: exit, leaving restarts to the
+// supervisor) or "lazy": kahook starts serving anyway and keeps creating
+// the producer in the background, answering webhooks with 503 and failing
+// /ready until it succeeds. Lazy suits docker-compose setups where Kafka and
+// kahook start together.
+//
+// With "fail", RetryTimeout (seconds) first retries creating the producer,
+// and checking a broker answers, with backoff for that long, so a
+// transient DNS or broker startup race does not crash-loop the pod. Zero
+// fails on the first error.
+type StartupConfig struct {
+	Producer     string `yaml:"producer" enum:"fail,lazy"`
+	RetryTimeout int    `yaml:"retry_timeout"`
+}
+
+// Lazy reports whether the producer is created in the background.
+func (s StartupConfig) Lazy() bool {
+	return s.Producer == "lazy"
+}
+
+func validateStartup(s StartupConfig, preflight string) error {
+	if s.RetryTimeout < 0 {
+		return fmt.Errorf("startup.retry_timeout must not be negative, got %d", s.RetryTimeout)
+	}
+	switch s.Producer {
+	case "", "fail":
+		return nil
+	case "lazy":
+		if preflight == "fail" {
+			return fmt.Errorf("startup.producer: lazy cannot be combined with kafka.preflight: fail")
+		}
+		if s.RetryTimeout > 0 {
+			return fmt.Errorf("startup.retry_timeout: lazy startup retries until it succeeds; remove the timeout or use producer: fail")
+		}
+		return nil
+	default:
+		return fmt.Errorf("startup.producer: invalid value %q (want fail or lazy)", s.Producer)
+	}
+}
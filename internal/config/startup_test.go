@@ -0,0 +1,60 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoad_Startup(t *testing.T) {
+	for _, tt := range []struct {
+		value    string
+		wantLazy bool
+		wantErr  string
+	}{
+		{"fail", false, ""},
+		{"lazy", true, ""},
+		{"retry", false, "startup.producer"},
+	} {
+		t.Setenv("STARTUP_PRODUCER", tt.value)
+		cfg, err := Load("")
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: Load() error = %v", tt.value, err)
+			} else if cfg.Startup.Lazy() != tt.wantLazy {
+				t.Errorf("%s: Lazy() = %v, want %v", tt.value, cfg.Startup.Lazy(), tt.wantLazy)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Load() error = %v, want %q", tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateStartup(t *testing.T) {
+	tests := []struct {
+		name      string
+		startup   StartupConfig
+		preflight string
+		wantErr   string
+	}{
+		{"default", StartupConfig{}, "", ""},
+		{"fail with retries", StartupConfig{Producer: "fail", RetryTimeout: 120}, "fail", ""},
+		{"lazy with preflight warn", StartupConfig{Producer: "lazy"}, "warn", ""},
+		{"lazy with preflight fail", StartupConfig{Producer: "lazy"}, "fail", "kafka.preflight"},
+		{"lazy with retry timeout", StartupConfig{Producer: "lazy", RetryTimeout: 60}, "", "startup.retry_timeout"},
+		{"negative retry timeout", StartupConfig{RetryTimeout: -1}, "", "startup.retry_timeout"},
+	}
+	for _, tt := range tests {
+		err := validateStartup(tt.startup, tt.preflight)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateStartup() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateStartup() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// TracingConfig sets how inbound tracing headers (traceparent, tracestate,
+// b3, x-b3-*, x-cloud-trace-context) are handled. Headers is "forward"
+// (default: forwarded as message headers like any other), "strip", or
+// "parent": kahook continues the sender's trace, whatever its format, and
+// the message carries a W3C traceparent for kahook's span instead.
+type TracingConfig struct {
+	Headers string `yaml:"headers" enum:"forward,strip,parent"`
+
+	// OTLP exports kahook's spans; see OTLPConfig.
+	OTLP OTLPConfig `yaml:"otlp"`
+}
+
+// OTLPConfig exports a server span for each webhook and a producer span
+// for its produce to an OpenTelemetry collector over OTLP/HTTP. Endpoint
+// is the collector's base URL (http://otel-collector:4318) and enables it;
+// Headers are sent with each export. Exporting implies headers: parent, and
+// the message's traceparent names the producer span. SampleRatio is the
+// fraction of new traces recorded (default 1); traces continued from a
+// sender keep its sampling decision. Logs also exports kahook's logs to the
+// collector, as they are written to stdout.
+type OTLPConfig struct {
+	Endpoint    string            `yaml:"endpoint" secret:"url"`
+	Headers     map[string]string `yaml:"headers" secret:"true"`
+	ServiceName string            `yaml:"service_name"`
+	SampleRatio float64           `yaml:"sample_ratio"`
+	Logs        bool              `yaml:"logs"`
+}
+
+// Enabled reports whether spans are exported.
+func (o OTLPConfig) Enabled() bool {
+	return o.Endpoint != ""
+}
+
+// parseOTLPHeaders parses OTEL_EXPORTER_OTLP_HEADERS: comma-separated
+// key=value pairs with URL-encoded values.
+func parseOTLPHeaders(v string) map[string]string {
+	headers := make(map[string]string)
+	for _, pair := range strings.Split(v, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = unescaped
+		}
+		headers[strings.TrimSpace(key)] = value
+	}
+	return headers
+}
+
+func validateTracing(t TracingConfig) error {
+	switch t.Headers {
+	case "", "forward", "strip", "parent":
+	default:
+		return fmt.Errorf("tracing.headers: invalid value %q (want forward, strip, or parent)", t.Headers)
+	}
+
+	o := t.OTLP
+	if !o.Enabled() {
+		if o.Logs {
+			return fmt.Errorf("tracing.otlp.logs requires tracing.otlp.endpoint")
+		}
+		return nil
+	}
+	if t.Headers != "" && t.Headers != "parent" {
+		return fmt.Errorf("tracing.headers: %q cannot be combined with tracing.otlp, which continues traces as parent", t.Headers)
+	}
+	u, err := url.Parse(o.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("tracing.otlp.endpoint: must be an http or https URL")
+	}
+	for name := range o.Headers {
+		if !validHeaderName.MatchString(name) {
+			return fmt.Errorf("tracing.otlp.headers: %q is not a valid header name", name)
+		}
+	}
+	if o.ServiceName == "" {
+		return fmt.Errorf("tracing.otlp.service_name must not be empty")
+	}
+	if o.SampleRatio <= 0 || o.SampleRatio > 1 {
+		return fmt.Errorf("tracing.otlp.sample_ratio must be greater than 0 and at most 1, got %v", o.SampleRatio)
+	}
+	return nil
+}
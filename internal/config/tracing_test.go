@@ -0,0 +1,84 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoad_Tracing(t *testing.T) {
+	for _, tt := range []struct {
+		value   string
+		wantErr string
+	}{
+		{"forward", ""},
+		{"strip", ""},
+		{"parent", ""},
+		{"drop", "tracing.headers"},
+	} {
+		t.Setenv("TRACING_HEADERS", tt.value)
+		cfg, err := Load("")
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: Load() error = %v", tt.value, err)
+			} else if cfg.Tracing.Headers != tt.value {
+				t.Errorf("%s: tracing.headers = %q", tt.value, cfg.Tracing.Headers)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Load() error = %v, want %q", tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestValidateTracing_OTLP(t *testing.T) {
+	otlp := OTLPConfig{Endpoint: "http://otel-collector:4318", ServiceName: "kahook", SampleRatio: 1}
+	tests := []struct {
+		name    string
+		mutate  func(*TracingConfig)
+		wantErr string
+	}{
+		{"valid", func(*TracingConfig) {}, ""},
+		{"parent", func(t *TracingConfig) { t.Headers = "parent" }, ""},
+		{"strip", func(t *TracingConfig) { t.Headers = "strip" }, "cannot be combined"},
+		{"no scheme", func(t *TracingConfig) { t.OTLP.Endpoint = "otel-collector:4318" }, "tracing.otlp.endpoint"},
+		{"bad header", func(t *TracingConfig) { t.OTLP.Headers = map[string]string{"api key": "x"} }, "tracing.otlp.headers"},
+		{"no service name", func(t *TracingConfig) { t.OTLP.ServiceName = "" }, "service_name"},
+		{"zero ratio", func(t *TracingConfig) { t.OTLP.SampleRatio = 0 }, "sample_ratio"},
+		{"ratio above 1", func(t *TracingConfig) { t.OTLP.SampleRatio = 1.5 }, "sample_ratio"},
+		{"logs", func(t *TracingConfig) { t.OTLP.Logs = true }, ""},
+		{"logs without endpoint", func(t *TracingConfig) { t.OTLP = OTLPConfig{Logs: true} }, "requires tracing.otlp.endpoint"},
+	}
+	for _, tt := range tests {
+		cfg := TracingConfig{OTLP: otlp}
+		tt.mutate(&cfg)
+		err := validateTracing(cfg)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateTracing() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateTracing() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_OTLPFromEnv(t *testing.T) {
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "https://otlp.example.com")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "api-key=abc%3D, x-team=webhooks")
+	t.Setenv("OTEL_SERVICE_NAME", "kahook-eu")
+	t.Setenv("OTEL_LOGS_EXPORTER", "otlp")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	o := cfg.Tracing.OTLP
+	if !o.Enabled() || o.Endpoint != "https://otlp.example.com" || o.ServiceName != "kahook-eu" || o.SampleRatio != 1 || !o.Logs {
+		t.Errorf("tracing.otlp = %+v", o)
+	}
+	if o.Headers["api-key"] != "abc=" || o.Headers["x-team"] != "webhooks" {
+		t.Errorf("tracing.otlp.headers = %v", o.Headers)
+	}
+}
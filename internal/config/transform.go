@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/kahook/internal/transform"
+)
+
+// TransformConfig is one step of a route's transform pipeline, which
+// reshapes payloads before producing. Steps run in order and each sets
+// exactly one of its keys:
+//
+//	transforms:
+//	  - remove: [card.number]
+//	  - drop: "(?i)^(password|ssn)$"
+//	  - add: {meta.shop: "{header:X-Shop-Domain}"}
+//	  - flatten: "_"
+//	  - envelope: {field: payload}
+//
+// Add and Remove take dot-separated paths; Drop is a regular expression
+// matched against field names at any depth; Flatten is the separator
+// nested object paths are joined with. Add values and envelope metadata may
+// use the placeholders {received_at}, {topic}, {path}, {request_id}, and
+// {header:Name}.
+type TransformConfig struct {
+	Add      map[string]string `yaml:"add"`
+	Remove   []string          `yaml:"remove"`
+	Drop     string            `yaml:"drop"`
+	Flatten  string            `yaml:"flatten"`
+	Envelope EnvelopeConfig    `yaml:"envelope"`
+}
+
+// EnvelopeConfig wraps the payload in a new object under Field, next to
+// Metadata, which defaults to received_at and source (the route path).
+type EnvelopeConfig struct {
+	Field    string            `yaml:"field"`
+	Metadata map[string]string `yaml:"metadata"`
+}
+
+// transformsEqual reports whether two routes' pipelines are the same.
+func transformsEqual(a, b []TransformConfig) bool {
+	return len(a) == len(b) && (len(a) == 0 || reflect.DeepEqual(a, b))
+}
+
+// pipeline builds the pipeline the steps describe.
+func pipeline(steps []TransformConfig) (*transform.Pipeline, error) {
+	specs := make([]transform.Step, len(steps))
+	for i, s := range steps {
+		specs[i] = transform.Step{
+			Add:      s.Add,
+			Remove:   s.Remove,
+			Drop:     s.Drop,
+			Flatten:  s.Flatten,
+			Envelope: s.Envelope.Field,
+			Metadata: s.Envelope.Metadata,
+		}
+	}
+	return transform.New(specs)
+}
+
+// Transforms returns the transform pipeline of each route's topic that
+// configures one.
+func (c *Config) Transforms() (map[string]*transform.Pipeline, error) {
+	pipelines := make(map[string]*transform.Pipeline)
+	for i, r := range c.Routes {
+		if len(r.Transforms) == 0 {
+			continue
+		}
+		p, err := pipeline(r.Transforms)
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d].transforms: %w", i, err)
+		}
+		pipelines[r.Topic] = p
+	}
+	return pipelines, nil
+}
+
+func validateTransforms(name string, steps []TransformConfig) error {
+	if len(steps) == 0 {
+		return nil
+	}
+	if _, err := pipeline(steps); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kahook/internal/transform"
+)
+
+func TestValidateTransforms(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []TransformConfig
+		wantErr string
+	}{
+		{"none", nil, ""},
+		{"each kind", []TransformConfig{
+			{Add: map[string]string{"meta.topic": "{topic}"}},
+			{Remove: []string{"card.number"}},
+			{Drop: "^_"},
+			{Flatten: "_"},
+			{Envelope: EnvelopeConfig{Field: "payload"}},
+		}, ""},
+		{"empty step", []TransformConfig{{}}, "exactly one"},
+		{"two kinds", []TransformConfig{{Drop: "x", Remove: []string{"y"}}}, "exactly one"},
+		{"bad regex", []TransformConfig{{Drop: "["}}, "drop"},
+		{"unknown placeholder", []TransformConfig{{Add: map[string]string{"a": "{when}"}}}, "unknown placeholder"},
+		{"metadata without field", []TransformConfig{{Envelope: EnvelopeConfig{Metadata: map[string]string{"a": "b"}}}}, "exactly one"},
+	}
+	for _, tt := range tests {
+		err := validateTransforms("routes[0].transforms", tt.steps)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateTransforms() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateTransforms() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_RouteTransforms(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+routes:
+  - path: shop
+    topic: orders
+    transforms:
+      - remove: [card]
+      - envelope:
+          field: data
+          metadata: {source: "{path}"}
+  - path: shop-eu
+    topic: orders
+    transforms:
+      - remove: [card]
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "different options") {
+		t.Fatalf("Load() error = %v, want routes to disagree on transforms", err)
+	}
+
+	yaml = yaml[:strings.Index(yaml, "  - path: shop-eu")]
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	pipelines, err := cfg.Transforms()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pipelines["orders"]
+	if p == nil {
+		t.Fatalf("Transforms() = %v, want one for orders", pipelines)
+	}
+	got, err := p.Apply([]byte(`{"id":1,"card":"4242"}`), transform.Meta{ReceivedAt: time.Now(), Path: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != `{"data":{"id":1},"source":"shop"}` {
+		t.Errorf("transformed body = %s", got)
+	}
+}
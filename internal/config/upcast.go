@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/kahook/internal/upcast"
+)
+
+// UpcastConfig rewrites payloads sent in an older version to the current one
+// before producing, so a topic's schema stays clean while a provider
+// migrates senders between API versions. The version is read from
+// VersionHeader or from VersionField, a dot-separated path into the JSON
+// body; set one. Each step upcasts one version to the next, and steps chain:
+//
+//	upcast:
+//	  version_field: api_version
+//	  steps:
+//	    - from: "2023-10-16"
+//	      to: "2024-06-20"
+//	      rename: {data.amount_cents: data.amount}
+//	      set: {data.currency: usd}
+//	      remove: [data.legacy_id]
+//
+// Payloads whose version has no step are produced unchanged.
+type UpcastConfig struct {
+	VersionHeader string       `yaml:"version_header"`
+	VersionField  string       `yaml:"version_field"`
+	Steps         []UpcastStep `yaml:"steps"`
+}
+
+// UpcastStep upcasts payloads at version From to version To: Rename moves
+// fields, Set writes string fields, and Remove deletes fields, in that
+// order.
+type UpcastStep struct {
+	From   string            `yaml:"from"`
+	To     string            `yaml:"to"`
+	Rename map[string]string `yaml:"rename"`
+	Set    map[string]string `yaml:"set"`
+	Remove []string          `yaml:"remove"`
+}
+
+// isZero reports whether no upcasting is configured.
+func (u UpcastConfig) isZero() bool {
+	return u.VersionHeader == "" && u.VersionField == "" && len(u.Steps) == 0
+}
+
+func (u UpcastConfig) equal(o UpcastConfig) bool {
+	return reflect.DeepEqual(u, o)
+}
+
+// Upcaster builds the upcaster the config describes.
+func (u UpcastConfig) Upcaster() (*upcast.Upcaster, error) {
+	steps := make([]upcast.Step, len(u.Steps))
+	for i, s := range u.Steps {
+		steps[i] = upcast.Step{From: s.From, To: s.To, Rename: s.Rename, Set: s.Set, Remove: s.Remove}
+	}
+	return upcast.New(upcast.Config{VersionHeader: u.VersionHeader, VersionField: u.VersionField, Steps: steps})
+}
+
+// Upcasters returns the upcaster of each route's topic that configures one.
+func (c *Config) Upcasters() (map[string]*upcast.Upcaster, error) {
+	upcasters := make(map[string]*upcast.Upcaster)
+	for i, r := range c.Routes {
+		if r.Upcast.isZero() {
+			continue
+		}
+		up, err := r.Upcast.Upcaster()
+		if err != nil {
+			return nil, fmt.Errorf("routes[%d].upcast: %w", i, err)
+		}
+		upcasters[r.Topic] = up
+	}
+	return upcasters, nil
+}
+
+func validateUpcast(name string, u UpcastConfig) error {
+	if u.isZero() {
+		return nil
+	}
+	if len(u.Steps) == 0 {
+		return fmt.Errorf("%s: at least one step is required", name)
+	}
+	if u.VersionHeader != "" && !validHeaderName.MatchString(u.VersionHeader) {
+		return fmt.Errorf("%s.version_header: %q is not a valid header name", name, u.VersionHeader)
+	}
+	if _, err := u.Upcaster(); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
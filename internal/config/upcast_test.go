@@ -0,0 +1,93 @@
+package config
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateUpcast(t *testing.T) {
+	step := []UpcastStep{{From: "1", To: "2"}}
+	tests := []struct {
+		name    string
+		upcast  UpcastConfig
+		wantErr string
+	}{
+		{"none", UpcastConfig{}, ""},
+		{"header", UpcastConfig{VersionHeader: "Stripe-Version", Steps: step}, ""},
+		{"field", UpcastConfig{VersionField: "meta.version", Steps: step}, ""},
+		{"no steps", UpcastConfig{VersionField: "version"}, "at least one step"},
+		{"no version source", UpcastConfig{Steps: step}, "exactly one"},
+		{"bad header", UpcastConfig{VersionHeader: "Stripe Version", Steps: step}, "version_header"},
+		{"cycle", UpcastConfig{VersionField: "v", Steps: []UpcastStep{{From: "1", To: "2"}, {From: "2", To: "1"}}}, "loop"},
+	}
+	for _, tt := range tests {
+		err := validateUpcast("routes[0].upcast", tt.upcast)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateUpcast() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateUpcast() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_RouteUpcast(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := `
+routes:
+  - path: stripe
+    topic: payments
+    upcast:
+      version_header: Stripe-Version
+      steps:
+        - from: "2023-10-16"
+          to: "2024-06-20"
+          rename: {amount_cents: amount}
+          set: {currency: usd}
+          remove: [legacy_id]
+  - path: stripe-eu
+    topic: payments
+    upcast:
+      version_header: Stripe-Version
+      steps:
+        - from: "2023-10-16"
+          to: "2024-06-20"
+          rename: {amount_cents: amount}
+`
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path); err == nil || !strings.Contains(err.Error(), "different options") {
+		t.Fatalf("Load() error = %v, want routes to disagree on upcasting", err)
+	}
+
+	yaml = yaml[:strings.Index(yaml, "  - path: stripe-eu")]
+	if err := os.WriteFile(path, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	upcasters, err := cfg.Upcasters()
+	if err != nil {
+		t.Fatal(err)
+	}
+	up := upcasters["payments"]
+	if up == nil {
+		t.Fatalf("Upcasters() = %v, want one for payments", upcasters)
+	}
+	res, err := up.Apply(http.Header{"Stripe-Version": {"2023-10-16"}}, []byte(`{"amount_cents":5,"legacy_id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Body) != `{"amount":5,"currency":"usd"}` {
+		t.Errorf("upcast body = %s", res.Body)
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import "fmt"
+
+// defaultTenantHeader is the message header carrying a webhook's tenant.
+const defaultTenantHeader = "Kahook-Tenant"
+
+// UsageConfig emits per-tenant, per-topic usage summaries (requests, bytes,
+// messages) every Interval seconds, for chargeback. The tenant is the
+// authenticated principal. Summaries are served on /admin/usage and, when
+// Topic is set, produced to it as JSON; messages are stamped with their
+// tenant as Header. Instance names the replica in reports and accepts the
+// same placeholders as kafka.client_id. Zero Interval disables usage reports.
+type UsageConfig struct {
+	Interval int    `yaml:"interval"`
+	Topic    string `yaml:"topic"`
+	Header   string `yaml:"header"`
+	Instance string `yaml:"instance"`
+}
+
+// Enabled reports whether usage reports are emitted.
+func (u UsageConfig) Enabled() bool {
+	return u.Interval > 0
+}
+
+func validateUsage(cfg *Config) error {
+	u := cfg.Usage
+	if u.Interval < 0 {
+		return fmt.Errorf("usage.interval must not be negative, got %d", u.Interval)
+	}
+	if !u.Enabled() {
+		return nil
+	}
+	if !validHeaderName.MatchString(u.Header) {
+		return fmt.Errorf("usage.header: %q is not a valid header name", u.Header)
+	}
+	if u.Topic != "" && !validRouteName.MatchString(u.Topic) {
+		return fmt.Errorf("usage.topic: %q must match [a-zA-Z0-9._-] and be 1-249 characters", u.Topic)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateUsage(t *testing.T) {
+	tests := []struct {
+		name    string
+		usage   UsageConfig
+		wantErr string
+	}{
+		{"disabled", UsageConfig{}, ""},
+		{"endpoint only", UsageConfig{Interval: 3600, Header: "Kahook-Tenant"}, ""},
+		{"with topic", UsageConfig{Interval: 60, Topic: "kahook.usage", Header: "Kahook-Tenant"}, ""},
+		{"negative interval", UsageConfig{Interval: -1}, "usage.interval"},
+		{"bad header", UsageConfig{Interval: 60, Header: "Kahook Tenant"}, "usage.header"},
+		{"bad topic", UsageConfig{Interval: 60, Topic: "usage/reports", Header: "Kahook-Tenant"}, "usage.topic"},
+	}
+	for _, tt := range tests {
+		err := validateUsage(&Config{Usage: tt.usage})
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: validateUsage() error = %v", tt.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: validateUsage() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLoad_UsageFromEnv(t *testing.T) {
+	t.Setenv("USAGE_INTERVAL", "900")
+	t.Setenv("USAGE_TOPIC", "kahook.usage")
+	t.Setenv("POD_NAME", "kahook-7f9c")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := UsageConfig{Interval: 900, Topic: "kahook.usage", Header: "Kahook-Tenant", Instance: "kahook-7f9c"}
+	if cfg.Usage != want {
+		t.Errorf("usage = %+v, want %+v", cfg.Usage, want)
+	}
+	if !slices.Contains(cfg.KafkaTopics(), "kahook.usage") {
+		t.Errorf("KafkaTopics() = %v, want the usage topic included", cfg.KafkaTopics())
+	}
+}
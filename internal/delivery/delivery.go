@@ -0,0 +1,54 @@
+// Package delivery carries where a producer wrote a message back to the
+// caller of Produce through the context, so the producers, and the types
+// that wrap and route between them, keep one Produce signature.
+package delivery
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Report is where a message was written: its partition and offset, and
+// the timestamp the broker stored with it.
+type Report struct {
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+}
+
+// Recorder receives the report of the message produced with a context from
+// WithRecorder. The zero value is ready to use.
+type Recorder struct {
+	mu     sync.Mutex
+	report Report
+	ok     bool
+}
+
+// Report returns the recorded report, and false if the producer recorded
+// none, as backends without partitions and offsets do.
+func (r *Recorder) Report() (Report, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.report, r.ok
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a context that makes producers record the delivery
+// of the message produced with it in rec.
+func WithRecorder(ctx context.Context, rec *Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, rec)
+}
+
+// Record stores report in ctx's Recorder, if it has one. Producers call it
+// once the message is acknowledged.
+func Record(ctx context.Context, report Report) {
+	rec, ok := ctx.Value(recorderKey{}).(*Recorder)
+	if !ok {
+		return
+	}
+	rec.mu.Lock()
+	rec.report, rec.ok = report, true
+	rec.mu.Unlock()
+}
@@ -0,0 +1,21 @@
+package delivery
+
+import (
+	"context"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	// Without a recorder, Record is a no-op.
+	Record(context.Background(), Report{Offset: 1})
+
+	var rec Recorder
+	if _, ok := rec.Report(); ok {
+		t.Error("empty Recorder reported a delivery")
+	}
+	ctx := WithRecorder(context.Background(), &rec)
+	Record(ctx, Report{Partition: 3, Offset: 42})
+	if got, ok := rec.Report(); !ok || got.Partition != 3 || got.Offset != 42 {
+		t.Errorf("Report() = %+v, %v, want partition 3 offset 42", got, ok)
+	}
+}
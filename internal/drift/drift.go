@@ -0,0 +1,166 @@
+// Package drift compares the config a replica is running with a reference
+// copy, from a config server or the copy kept in git, and warns when they
+// differ. In a fleet, a config map edited by hand on one cluster otherwise
+// goes unnoticed until it causes an incident, so kahook checks at startup
+// and periodically.
+package drift
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxReferenceBytes bounds the reference config read from a Source.
+const maxReferenceBytes = 4 << 20
+
+// Source fetches the reference config file.
+type Source interface {
+	// Name identifies the source in logs, e.g. a redacted URL.
+	Name() string
+	Fetch(ctx context.Context) ([]byte, error)
+}
+
+// HTTP fetches the reference config with a GET, e.g. from a config server
+// or a git host's raw-file URL. Token, when set, is sent as a bearer token.
+type HTTP struct {
+	URL   string
+	Token string
+	// Label names the source in logs instead of URL, which may carry
+	// credentials.
+	Label  string
+	Client *http.Client
+}
+
+// Name returns Label.
+func (h HTTP) Name() string { return h.Label }
+
+// Fetch GETs URL and returns the body of a 200 response.
+func (h HTTP) Fetch(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if h.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.Token)
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxReferenceBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxReferenceBytes {
+		return nil, fmt.Errorf("reference config is larger than %d bytes", maxReferenceBytes)
+	}
+	return data, nil
+}
+
+// Compare parses a reference config and returns its hash and the settings
+// in which the running config differs from it, formatted for logs.
+type Compare func(reference []byte) (hash string, changes []string, err error)
+
+// Config configures a Checker.
+type Config struct {
+	Source  Source
+	Compare Compare
+	// Hash is the running config's hash, logged alongside the reference's.
+	Hash string
+	// Interval between checks after the startup check; zero checks once.
+	Interval time.Duration
+	// Timeout bounds each fetch; zero means 10s.
+	Timeout time.Duration
+	Logger  *zap.Logger
+}
+
+// Checker periodically compares the running config with the reference.
+type Checker struct {
+	cfg     Config
+	drifted atomic.Bool
+	checked atomic.Bool
+}
+
+// New returns a Checker; call Run to start checking.
+func New(cfg Config) *Checker {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Checker{cfg: cfg}
+}
+
+// Drifted reports whether the last successful check found the running
+// config differs from the reference, and false as its second result if no
+// check has succeeded yet.
+func (c *Checker) Drifted() (drifted, checked bool) {
+	return c.drifted.Load(), c.checked.Load()
+}
+
+// Run checks immediately, then every Interval until ctx is done.
+func (c *Checker) Run(ctx context.Context) {
+	c.Check(ctx)
+	if c.cfg.Interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Check(ctx)
+		}
+	}
+}
+
+// Check fetches the reference once and compares it with the running
+// config, warning on drift. A failed fetch or an unparseable reference is
+// logged and leaves the last result in place.
+func (c *Checker) Check(ctx context.Context) {
+	fetchCtx, cancel := context.WithTimeout(ctx, c.cfg.Timeout)
+	data, err := c.cfg.Source.Fetch(fetchCtx)
+	cancel()
+	if err != nil {
+		c.cfg.Logger.Warn("config drift check failed", zap.String("source", c.cfg.Source.Name()), zap.Error(err))
+		return
+	}
+	hash, changes, err := c.cfg.Compare(data)
+	if err != nil {
+		c.cfg.Logger.Warn("config drift check failed: invalid reference config",
+			zap.String("source", c.cfg.Source.Name()), zap.Error(err))
+		return
+	}
+
+	drifted := len(changes) > 0
+	wasDrifted := c.drifted.Swap(drifted)
+	c.checked.Store(true)
+	fields := []zap.Field{
+		zap.String("source", c.cfg.Source.Name()),
+		zap.String("running_hash", c.cfg.Hash),
+		zap.String("reference_hash", hash),
+	}
+	switch {
+	case drifted:
+		c.cfg.Logger.Warn("running config has drifted from the reference",
+			append(fields, zap.Strings("changes", changes))...)
+	case wasDrifted:
+		c.cfg.Logger.Info("running config matches the reference again", fields...)
+	default:
+		c.cfg.Logger.Debug("config drift check", fields...)
+	}
+}
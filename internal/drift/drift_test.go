@@ -0,0 +1,100 @@
+package drift
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fakeSource struct {
+	data []byte
+	err  error
+}
+
+func (f *fakeSource) Name() string { return "fake" }
+
+func (f *fakeSource) Fetch(context.Context) ([]byte, error) { return f.data, f.err }
+
+// compareTo treats the reference as drifted unless it equals running.
+func compareTo(running string) Compare {
+	return func(reference []byte) (string, []string, error) {
+		if string(reference) == "garbage" {
+			return "", nil, errors.New("not a config")
+		}
+		if string(reference) == running {
+			return "h-" + running, nil, nil
+		}
+		return "h-" + string(reference), []string{"server.port: 8080 -> 9090"}, nil
+	}
+}
+
+func TestChecker_Check(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	src := &fakeSource{err: errors.New("unreachable")}
+	c := New(Config{
+		Source:  src,
+		Compare: compareTo("a"),
+		Hash:    "h-a",
+		Logger:  zap.New(core),
+	})
+	ctx := context.Background()
+
+	c.Check(ctx)
+	if _, checked := c.Drifted(); checked {
+		t.Fatal("Drifted reported a check after a failed fetch")
+	}
+	if n := logs.FilterMessage("config drift check failed").Len(); n != 1 {
+		t.Errorf("logged %d fetch failures, want 1", n)
+	}
+
+	src.data, src.err = []byte("b"), nil
+	c.Check(ctx)
+	if drifted, checked := c.Drifted(); !drifted || !checked {
+		t.Errorf("Drifted() = %v, %v; want true, true", drifted, checked)
+	}
+	warn := logs.FilterMessageSnippet("has drifted")
+	if warn.Len() != 1 || warn.FilterField(zap.String("reference_hash", "h-b")).Len() != 1 {
+		t.Errorf("drift warnings = %v, want one with the reference hash", warn.All())
+	}
+
+	// An unparseable reference keeps the last result.
+	src.data = []byte("garbage")
+	c.Check(ctx)
+	if drifted, _ := c.Drifted(); !drifted {
+		t.Error("an invalid reference cleared the drift")
+	}
+
+	src.data = []byte("a")
+	c.Check(ctx)
+	if drifted, _ := c.Drifted(); drifted {
+		t.Error("Drifted() = true after the reference matched")
+	}
+	if n := logs.FilterMessageSnippet("matches the reference again").Len(); n != 1 {
+		t.Errorf("logged %d recoveries, want 1", n)
+	}
+}
+
+func TestHTTP_Fetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("server:\n  port: 8080\n"))
+	}))
+	defer srv.Close()
+
+	data, err := HTTP{URL: srv.URL, Token: "s3cret"}.Fetch(context.Background())
+	if err != nil || string(data) != "server:\n  port: 8080\n" {
+		t.Errorf("Fetch() = %q, %v", data, err)
+	}
+	if _, err := (HTTP{URL: srv.URL}).Fetch(context.Background()); err == nil {
+		t.Error("Fetch() without a token succeeded on a 401")
+	}
+}
@@ -0,0 +1,146 @@
+// Package filesink implements the server's producer interface by writing
+// each message as a JSON line to stdout or a file. It needs no broker and no
+// cgo, which makes it suitable for local development and integration tests.
+package filesink
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Stdout is the path that selects standard output.
+const Stdout = "-"
+
+// Record is one line of sink output.
+type Record struct {
+	Time    time.Time         `json:"time"`
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// ValueEncoding says how Value is represented: "json" (the body, embedded
+	// as-is), "text" (a UTF-8 string), or "base64".
+	ValueEncoding string          `json:"value_encoding"`
+	Value         json.RawMessage `json:"value"`
+}
+
+// Producer appends records to a writer.
+type Producer struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer // nil for stdout
+	err    error     // first write error; the sink is unhealthy after one
+}
+
+// NewProducer opens path for appending, creating it if needed. An empty path
+// or "-" writes to stdout.
+func NewProducer(path string) (*Producer, error) {
+	if path == "" || path == Stdout {
+		return NewWriterProducer(os.Stdout), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sink file: %w", err)
+	}
+	p := NewWriterProducer(f)
+	p.closer = f
+	return p, nil
+}
+
+// NewWriterProducer writes records to w. It does not close w.
+func NewWriterProducer(w io.Writer) *Producer {
+	return &Producer{w: bufio.NewWriter(w)}
+}
+
+// Produce writes the message as a single JSON line. The line is flushed
+// before returning so that a successful Produce is visible to readers.
+func (p *Producer) Produce(_ context.Context, topic string, key, value []byte, headers map[string]string) error {
+	rec := Record{
+		Time:    time.Now().UTC(),
+		Topic:   topic,
+		Key:     string(key),
+		Headers: headers,
+	}
+	rec.ValueEncoding, rec.Value = encodeValue(value)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return fmt.Errorf("sink unavailable: %w", p.err)
+	}
+	_, err = p.w.Write(append(line, '\n'))
+	if err == nil {
+		err = p.w.Flush()
+	}
+	if err != nil {
+		p.err = err
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	return nil
+}
+
+func encodeValue(value []byte) (string, json.RawMessage) {
+	if json.Valid(value) {
+		return "json", value
+	}
+	if utf8.Valid(value) {
+		s, _ := json.Marshal(string(value))
+		return "text", s
+	}
+	s, _ := json.Marshal(base64.StdEncoding.EncodeToString(value))
+	return "base64", s
+}
+
+// Payload returns the message value r holds, decoded from its
+// ValueEncoding.
+func (r Record) Payload() ([]byte, error) {
+	switch r.ValueEncoding {
+	case "json":
+		return r.Value, nil
+	case "text":
+		var s string
+		if err := json.Unmarshal(r.Value, &s); err != nil {
+			return nil, fmt.Errorf("invalid text value: %w", err)
+		}
+		return []byte(s), nil
+	case "base64":
+		var s string
+		if err := json.Unmarshal(r.Value, &s); err != nil {
+			return nil, fmt.Errorf("invalid base64 value: %w", err)
+		}
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unknown value encoding %q", r.ValueEncoding)
+	}
+}
+
+// IsConnected reports whether the sink is still writable.
+func (p *Producer) IsConnected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err == nil
+}
+
+// Close flushes and closes the underlying file.
+func (p *Producer) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_ = p.w.Flush()
+	if p.closer != nil {
+		_ = p.closer.Close()
+	}
+}
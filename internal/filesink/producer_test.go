@@ -0,0 +1,92 @@
+package filesink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProduce_Encodings(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    []byte
+		wantEnc  string
+		wantJSON string
+	}{
+		{"json body embedded", []byte(`{"a":1}`), "json", `{"a":1}`},
+		{"text body as string", []byte("hello"), "text", `"hello"`},
+		{"binary body as base64", []byte{0xff, 0x00}, "base64", `"/wA="`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			p := NewWriterProducer(&buf)
+
+			err := p.Produce(context.Background(), "orders", []byte("k"), tt.value, map[string]string{"X-A": "b"})
+			if err != nil {
+				t.Fatalf("Produce() error = %v", err)
+			}
+
+			var rec Record
+			if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+				t.Fatalf("output is not a JSON line: %v (%q)", err, buf.String())
+			}
+			if rec.Topic != "orders" || rec.Key != "k" || rec.Headers["X-A"] != "b" {
+				t.Errorf("record = %+v", rec)
+			}
+			if rec.ValueEncoding != tt.wantEnc || string(rec.Value) != tt.wantJSON {
+				t.Errorf("value = %s (%s), want %s (%s)", rec.Value, rec.ValueEncoding, tt.wantJSON, tt.wantEnc)
+			}
+			if got, err := rec.Payload(); err != nil || !bytes.Equal(got, tt.value) {
+				t.Errorf("Payload() = %q, %v, want %q", got, err, tt.value)
+			}
+		})
+	}
+}
+
+func TestNewProducer_AppendsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+
+	for i := 0; i < 2; i++ {
+		p, err := NewProducer(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = p.Produce(context.Background(), "t", nil, []byte(`{}`), nil)
+		p.Close()
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	for sc := bufio.NewScanner(f); sc.Scan(); {
+		lines++
+	}
+	if lines != 2 {
+		t.Errorf("file has %d lines, want 2 (one per producer, appended)", lines)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func TestProduce_WriteErrorMarksUnhealthy(t *testing.T) {
+	p := NewWriterProducer(failingWriter{})
+	if err := p.Produce(context.Background(), "t", nil, []byte("x"), nil); err == nil {
+		t.Fatal("Produce() should fail when the writer fails")
+	}
+	if p.IsConnected() {
+		t.Error("IsConnected() should be false after a write error")
+	}
+}
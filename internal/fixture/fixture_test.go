@@ -0,0 +1,80 @@
+package fixture
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteLoad_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	text := &Fixture{
+		RecordedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Method:     http.MethodPost,
+		Path:       "/github",
+		Headers:    http.Header{"X-Github-Event": {"push"}},
+		Status:     http.StatusAccepted,
+	}
+	text.SetBody([]byte(`{"ref":"refs/heads/main"}`))
+	binary := &Fixture{Method: http.MethodPost, Path: "/files", Status: http.StatusAccepted}
+	binary.SetBody([]byte{0xff, 0x00, 0xfe})
+
+	if err := Write(filepath.Join(dir, "1.json"), text); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(filepath.Join(dir, "2.json"), binary); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(filepath.Join(dir, "1.json"), text); err == nil {
+		t.Error("Write should not overwrite an existing fixture")
+	}
+
+	fixtures, err := LoadDir(dir)
+	if err != nil {
+		t.Fatalf("LoadDir: %v", err)
+	}
+	if len(fixtures) != 2 {
+		t.Fatalf("LoadDir returned %d fixtures, want 2", len(fixtures))
+	}
+	if f := fixtures[0]; f.Path != "/github" || f.Body != `{"ref":"refs/heads/main"}` || f.BodyEncoding != EncodingUTF8 || !f.RecordedAt.Equal(text.RecordedAt) {
+		t.Errorf("text fixture = %+v", f)
+	}
+	if fixtures[1].BodyEncoding != EncodingBase64 {
+		t.Errorf("binary body encoding = %q, want base64", fixtures[1].BodyEncoding)
+	}
+	if b, err := fixtures[1].BodyBytes(); err != nil || !bytes.Equal(b, []byte{0xff, 0x00, 0xfe}) {
+		t.Errorf("binary BodyBytes() = %x, %v", b, err)
+	}
+
+	req, err := fixtures[0].NewRequest("http://kahook.test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "http://kahook.test/github" || req.Header.Get("X-Github-Event") != "push" {
+		t.Errorf("NewRequest() = %s %v", req.URL, req.Header)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"malformed.json": `{`,
+		"no-path.json":   `{"method":"POST"}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) should fail", name)
+		}
+	}
+
+	f := &Fixture{Body: "x", BodyEncoding: "gzip"}
+	if _, err := f.BodyBytes(); err == nil {
+		t.Error("BodyBytes() should fail for an unknown encoding")
+	}
+}
@@ -0,0 +1,377 @@
+// Package geoip resolves IP addresses to ISO 3166-1 country codes using a
+// local MaxMind DB file (GeoLite2-Country, GeoIP2-Country, or any database
+// whose records carry country.iso_code). It implements only the parts of the
+// MaxMind DB format needed for country lookups, so no client library is
+// required.
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"sync"
+)
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// dataSectionSeparator is the number of zero bytes between the search tree
+// and the data section.
+const dataSectionSeparator = 16
+
+// maxDecodeDepth bounds nesting while decoding, so a corrupt file cannot
+// recurse without limit.
+const maxDecodeDepth = 32
+
+// Reader looks up countries in a MaxMind DB loaded into memory. It is safe
+// for concurrent use.
+type Reader struct {
+	tree       []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint // node at which IPv4 lookups start in an IPv6 tree
+
+	// countries caches the country of each data record. Databases share one
+	// record per country, so the cache stays small and most lookups only
+	// walk the tree.
+	countries sync.Map // uint -> string
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading geoip database: %w", err)
+	}
+	r, err := New(b)
+	if err != nil {
+		return nil, fmt.Errorf("geoip database %s: %w", path, err)
+	}
+	return r, nil
+}
+
+// New parses a database held in b. b must not be modified afterwards.
+func New(b []byte) (*Reader, error) {
+	i := bytes.LastIndex(b, metadataMarker)
+	if i < 0 {
+		return nil, errors.New("not a MaxMind DB file: metadata marker not found")
+	}
+	d := decoder{buf: b[i+len(metadataMarker):]}
+	v, _, err := d.decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("decoding metadata: %w", err)
+	}
+	meta, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("metadata is not a map")
+	}
+
+	r := &Reader{
+		nodeCount:  metaUint(meta, "node_count"),
+		recordSize: metaUint(meta, "record_size"),
+		ipVersion:  metaUint(meta, "ip_version"),
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("unsupported ip version %d", r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSectionSeparator > uint(i) {
+		return nil, errors.New("search tree is larger than the file")
+	}
+	r.tree = b[:treeSize]
+	r.data = b[treeSize+dataSectionSeparator : i]
+
+	if r.ipVersion == 6 {
+		// IPv4 addresses live under ::/96; find that subtree once.
+		node := uint(0)
+		for n := 0; n < 96 && node < r.nodeCount; n++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+func metaUint(meta map[string]any, key string) uint {
+	n, _ := meta[key].(uint64)
+	return uint(n)
+}
+
+// Country returns the ISO country code for addr, or "" if the database has
+// no country for it.
+func (r *Reader) Country(addr netip.Addr) (string, error) {
+	offset, ok, err := r.lookup(addr)
+	if err != nil || !ok {
+		return "", err
+	}
+	if c, ok := r.countries.Load(offset); ok {
+		return c.(string), nil
+	}
+
+	d := decoder{buf: r.data}
+	v, _, err := d.decode(offset, 0)
+	if err != nil {
+		return "", fmt.Errorf("decoding geoip record: %w", err)
+	}
+	country := isoCode(v, "country")
+	if country == "" {
+		// Anycast and satellite ranges may only have a registered country.
+		country = isoCode(v, "registered_country")
+	}
+	r.countries.Store(offset, country)
+	return country, nil
+}
+
+func isoCode(record any, key string) string {
+	m, _ := record.(map[string]any)
+	c, _ := m[key].(map[string]any)
+	code, _ := c["iso_code"].(string)
+	return code
+}
+
+// lookup walks the search tree and returns the data section offset of
+// addr's record.
+func (r *Reader) lookup(addr netip.Addr) (uint, bool, error) {
+	addr = addr.Unmap()
+	var ip []byte
+	node := uint(0)
+	switch {
+	case addr.Is4():
+		a := addr.As4()
+		ip = a[:]
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	case r.ipVersion == 4:
+		return 0, false, nil // an IPv6 address in an IPv4-only database
+	default:
+		a := addr.As16()
+		ip = a[:]
+	}
+
+	for i := 0; i < len(ip)*8 && node < r.nodeCount; i++ {
+		bit := uint(ip[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+
+	switch {
+	case node == r.nodeCount:
+		return 0, false, nil
+	case node < r.nodeCount:
+		return 0, false, errors.New("geoip search tree does not terminate")
+	}
+	offset := node - r.nodeCount - dataSectionSeparator
+	if offset >= uint(len(r.data)) {
+		return 0, false, errors.New("geoip record pointer out of range")
+	}
+	return offset, true, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node, bit uint) uint {
+	n := r.tree[node*r.recordSize/4:]
+	switch r.recordSize {
+	case 24:
+		n = n[bit*3:]
+		return uint(n[0])<<16 | uint(n[1])<<8 | uint(n[2])
+	case 28:
+		if bit == 0 {
+			return uint(n[3]&0xF0)<<20 | uint(n[0])<<16 | uint(n[1])<<8 | uint(n[2])
+		}
+		return uint(n[3]&0x0F)<<24 | uint(n[4])<<16 | uint(n[5])<<8 | uint(n[6])
+	default:
+		return uint(binary.BigEndian.Uint32(n[bit*4:]))
+	}
+}
+
+// MaxMind DB data types.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+var errTruncated = errors.New("truncated data")
+
+// decoder decodes MaxMind DB values from buf. Pointers are offsets into buf.
+type decoder struct {
+	buf []byte
+}
+
+// decode returns the value at offset and the offset just past it. Maps
+// decode to map[string]any, arrays to []any, and unsigned integers to
+// uint64.
+func (d *decoder) decode(offset uint, depth int) (any, uint, error) {
+	if depth > maxDecodeDepth {
+		return nil, 0, errors.New("data nested too deeply")
+	}
+	typ, size, offset, err := d.controlByte(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		// A pointer is followed by its target; the value continues after
+		// the pointer itself.
+		v, _, err := d.decode(size, depth+1)
+		return v, offset, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 256))
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(d.buf)) {
+		return nil, 0, errTruncated
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, next, nil
+	case typeInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int32(n), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), next, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
+
+// controlByte decodes the type and size at offset and returns the offset of
+// the payload. For pointers, size is the pointer target.
+func (d *decoder) controlByte(offset uint) (typ, size, next uint, err error) {
+	if offset >= uint(len(d.buf)) {
+		return 0, 0, 0, errTruncated
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ = uint(ctrl >> 5)
+
+	if typ == typePointer {
+		n := uint(ctrl>>3) & 3
+		if offset+n+1 > uint(len(d.buf)) {
+			return 0, 0, 0, errTruncated
+		}
+		b := d.buf[offset : offset+n+1]
+		v := uint(ctrl & 7)
+		switch n {
+		case 0:
+			size = v<<8 | uint(b[0])
+		case 1:
+			size = (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			size = (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			size = uint(binary.BigEndian.Uint32(b))
+		}
+		return typ, size, offset + n + 1, nil
+	}
+
+	if typ == typeExtended {
+		if offset >= uint(len(d.buf)) {
+			return 0, 0, 0, errTruncated
+		}
+		typ = uint(d.buf[offset]) + 7
+		offset++
+	}
+
+	size = uint(ctrl & 0x1F)
+	if size >= 29 {
+		n := size - 28
+		if offset+n > uint(len(d.buf)) {
+			return 0, 0, 0, errTruncated
+		}
+		var v uint
+		for _, c := range d.buf[offset : offset+n] {
+			v = v<<8 | uint(c)
+		}
+		switch n {
+		case 1:
+			size = 29 + v
+		case 2:
+			size = 285 + v
+		default:
+			size = 65821 + v
+		}
+		offset += n
+	}
+	return typ, size, offset, nil
+}
@@ -0,0 +1,308 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ----------------------------------------------------------------------------
+// Test database writer
+// ----------------------------------------------------------------------------
+
+// testDB builds a MaxMind DB in memory: a search tree over the inserted
+// prefixes, a data section, and metadata.
+type testDB struct {
+	ipVersion  int
+	recordSize int
+	nodes      [][2]int // child node index; -1 for empty, <= -2 for data
+	data       bytes.Buffer
+	records    []int // data offset of record i is records[-(ref+2)]
+}
+
+func newTestDB(ipVersion, recordSize int) *testDB {
+	return &testDB{ipVersion: ipVersion, recordSize: recordSize, nodes: [][2]int{{-1, -1}}}
+}
+
+// addRecord appends an encoded value to the data section and returns a
+// reference for insert.
+func (db *testDB) addRecord(encoded []byte) int {
+	db.records = append(db.records, db.data.Len())
+	db.data.Write(encoded)
+	return -(len(db.records) + 1)
+}
+
+// insert maps prefix to the record ref. IPv4 prefixes in an IPv6 database are
+// placed under ::/96.
+func (db *testDB) insert(prefix string, ref int) {
+	p := netip.MustParsePrefix(prefix)
+	var ip []byte
+	bits := p.Bits()
+	if p.Addr().Is4() && db.ipVersion == 6 {
+		a := netip.AddrFrom16(netip.AddrFrom4(p.Addr().As4()).As16()).As16()
+		clear(a[10:12]) // ::a.b.c.d rather than ::ffff:a.b.c.d
+		ip = a[:]
+		bits += 96
+	} else {
+		ip = p.Addr().AsSlice()
+	}
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			db.nodes[node][bit] = ref
+			return
+		}
+		next := db.nodes[node][bit]
+		if next < 0 {
+			db.nodes = append(db.nodes, [2]int{-1, -1})
+			next = len(db.nodes) - 1
+			db.nodes[node][bit] = next
+		}
+		node = next
+	}
+}
+
+func (db *testDB) bytes() []byte {
+	n := len(db.nodes)
+	value := func(v int) uint32 {
+		switch {
+		case v == -1:
+			return uint32(n)
+		case v < -1:
+			return uint32(n + dataSectionSeparator + db.records[-(v+2)])
+		default:
+			return uint32(v)
+		}
+	}
+
+	var out bytes.Buffer
+	for _, node := range db.nodes {
+		l, r := value(node[0]), value(node[1])
+		switch db.recordSize {
+		case 24:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 28:
+			out.Write([]byte{byte(l >> 16), byte(l >> 8), byte(l), byte(l>>20&0xF0 | r>>24&0x0F), byte(r >> 16), byte(r >> 8), byte(r)})
+		case 32:
+			out.Write(binary.BigEndian.AppendUint32(nil, l))
+			out.Write(binary.BigEndian.AppendUint32(nil, r))
+		}
+	}
+	out.Write(make([]byte, dataSectionSeparator))
+	out.Write(db.data.Bytes())
+	out.Write(metadataMarker)
+	out.Write(encMap(
+		"node_count", encUint(uint64(n)),
+		"record_size", encUint(uint64(db.recordSize)),
+		"ip_version", encUint(uint64(db.ipVersion)),
+		"database_type", encString("Test-Country"),
+	))
+	return out.Bytes()
+}
+
+func encControl(typ, size int) []byte {
+	var b []byte
+	if typ > 7 {
+		b = []byte{0, byte(typ - 7)}
+	} else {
+		b = []byte{byte(typ << 5)}
+	}
+	switch {
+	case size < 29:
+		b[0] |= byte(size)
+	case size < 285:
+		b[0] |= 29
+		b = append(b, byte(size-29))
+	default:
+		b[0] |= 30
+		b = append(b, byte((size-285)>>8), byte(size-285))
+	}
+	return b
+}
+
+func encString(s string) []byte {
+	return append(encControl(typeString, len(s)), s...)
+}
+
+func encUint(v uint64) []byte {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	return append(encControl(typeUint32, len(b)), b...)
+}
+
+func encPointer(offset int) []byte {
+	return []byte{byte(typePointer<<5) | byte(offset>>8&7), byte(offset)}
+}
+
+// encMap encodes alternating string keys and encoded values.
+func encMap(kv ...any) []byte {
+	b := encControl(typeMap, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		b = append(b, encString(kv[i].(string))...)
+		b = append(b, kv[i+1].([]byte)...)
+	}
+	return b
+}
+
+func countryRecord(key, code string) []byte {
+	return encMap(key, encMap("iso_code", encString(code), "geoname_id", encUint(2921044)))
+}
+
+// buildDB returns a database with:
+//
+//	81.0.0.0/8     DE
+//	2001:db8::/32  FR
+//	192.0.2.0/24   registered_country US only
+//	203.0.113.0/24 a record without any country
+//	198.51.100.0/24 DE again, via a pointer to the first record
+func buildDB(t *testing.T, ipVersion, recordSize int) []byte {
+	t.Helper()
+	db := newTestDB(ipVersion, recordSize)
+	de := db.addRecord(countryRecord("country", "DE"))
+	db.insert("81.0.0.0/8", de)
+	db.insert("192.0.2.0/24", db.addRecord(countryRecord("registered_country", "US")))
+	db.insert("203.0.113.0/24", db.addRecord(encMap("continent", encMap("code", encString("EU")))))
+	db.insert("198.51.100.0/24", db.addRecord(encPointer(0)))
+	if ipVersion == 6 {
+		db.insert("2001:db8::/32", db.addRecord(countryRecord("country", "FR")))
+	}
+	return db.bytes()
+}
+
+// ----------------------------------------------------------------------------
+// Lookups
+// ----------------------------------------------------------------------------
+
+func TestCountry(t *testing.T) {
+	for _, recordSize := range []int{24, 28, 32} {
+		r, err := New(buildDB(t, 6, recordSize))
+		if err != nil {
+			t.Fatalf("record size %d: %v", recordSize, err)
+		}
+		tests := []struct {
+			addr string
+			want string
+		}{
+			{"81.2.69.142", "DE"},
+			{"::ffff:81.2.69.142", "DE"},
+			{"2001:db8::1", "FR"},
+			{"192.0.2.10", "US"},
+			{"203.0.113.5", ""},
+			{"198.51.100.7", "DE"},
+			{"10.0.0.1", ""},
+			{"2002::1", ""},
+		}
+		for _, tt := range tests {
+			got, err := r.Country(netip.MustParseAddr(tt.addr))
+			if err != nil {
+				t.Errorf("record size %d: Country(%s): %v", recordSize, tt.addr, err)
+				continue
+			}
+			if got != tt.want {
+				t.Errorf("record size %d: Country(%s) = %q, want %q", recordSize, tt.addr, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestCountry_IPv4Database(t *testing.T) {
+	r, err := New(buildDB(t, 4, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := r.Country(netip.MustParseAddr("81.2.69.142")); got != "DE" {
+		t.Errorf("Country(81.2.69.142) = %q, want DE", got)
+	}
+	if got, err := r.Country(netip.MustParseAddr("2001:db8::1")); got != "" || err != nil {
+		t.Errorf("IPv6 lookup in IPv4 database = %q, %v; want empty", got, err)
+	}
+}
+
+func TestCountry_Cached(t *testing.T) {
+	r, err := New(buildDB(t, 6, 24))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if got, _ := r.Country(netip.MustParseAddr("81.1.1.1")); got != "DE" {
+			t.Fatalf("Country = %q, want DE", got)
+		}
+	}
+	n := 0
+	r.countries.Range(func(any, any) bool { n++; return true })
+	if n != 1 {
+		t.Errorf("cache holds %d records, want 1", n)
+	}
+}
+
+// ----------------------------------------------------------------------------
+// Open errors
+// ----------------------------------------------------------------------------
+
+func TestOpen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, buildDB(t, 6, 28), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got, _ := r.Country(netip.MustParseAddr("81.2.69.142")); got != "DE" {
+		t.Errorf("Country = %q, want DE", got)
+	}
+}
+
+func TestOpen_Errors(t *testing.T) {
+	dir := t.TempDir()
+	valid := buildDB(t, 6, 24)
+	badRecordSize := bytes.Replace(valid, append(encString("record_size"), encUint(24)...), append(encString("record_size"), encUint(20)...), 1)
+	truncated := append(valid[:10:10], valid[bytes.LastIndex(valid, metadataMarker):]...)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    string
+	}{
+		{"not mmdb", []byte("hello"), "metadata marker not found"},
+		{"bad record size", badRecordSize, "unsupported record size 20"},
+		{"truncated tree", truncated, "search tree is larger than the file"},
+		{"bad metadata", append(bytes.Clone(metadataMarker), encString("x")...), "metadata is not a map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "_"))
+			if err := os.WriteFile(path, tt.content, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := Open(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Open error = %v, want containing %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := Open(filepath.Join(dir, "missing.mmdb")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
+
+func TestCountry_CorruptRecord(t *testing.T) {
+	db := newTestDB(6, 24)
+	db.insert("81.0.0.0/8", db.addRecord(encControl(typeString, 20))) // length past end of data
+	r, err := New(db.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Country(netip.MustParseAddr("81.1.1.1")); err == nil {
+		t.Error("expected error decoding truncated record")
+	}
+}
@@ -0,0 +1,83 @@
+// Package hashring implements a consistent hash ring mapping keys to a fixed
+// set of member indexes.
+package hashring
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// DefaultReplicas is the number of virtual nodes placed on the ring per
+// member. More replicas spread keys more evenly at the cost of a larger ring.
+const DefaultReplicas = 128
+
+// Ring maps keys to member indexes in [0, n). Adding or removing a member
+// only remaps the keys that hashed to that member. A Ring is immutable after
+// construction and safe for concurrent use.
+type Ring struct {
+	hashes  []uint64
+	members []int // members[i] owns hashes[i]
+}
+
+// New builds a ring for n members with the given number of virtual nodes per
+// member. replicas <= 0 uses DefaultReplicas.
+func New(n, replicas int) *Ring {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+
+	type point struct {
+		hash   uint64
+		member int
+	}
+	points := make([]point, 0, n*replicas)
+	for m := 0; m < n; m++ {
+		for r := 0; r < replicas; r++ {
+			points = append(points, point{hash: hash([]byte(strconv.Itoa(m) + "#" + strconv.Itoa(r))), member: m})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+
+	ring := &Ring{
+		hashes:  make([]uint64, len(points)),
+		members: make([]int, len(points)),
+	}
+	for i, p := range points {
+		ring.hashes[i] = p.hash
+		ring.members[i] = p.member
+	}
+	return ring
+}
+
+// Get returns the member owning key: the first virtual node clockwise from
+// the key's hash. It returns -1 for an empty ring.
+func (r *Ring) Get(key []byte) int {
+	if len(r.hashes) == 0 {
+		return -1
+	}
+	h := hash(key)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.members[i]
+}
+
+func hash(b []byte) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write(b)
+	// FNV-1a has weak avalanche on short, similar inputs such as "0#1" and
+	// "0#2"; a final mix spreads them across the whole ring.
+	return mix(h.Sum64())
+}
+
+// mix is the splitmix64 finaliser.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
@@ -0,0 +1,60 @@
+package hashring
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRing_Deterministic(t *testing.T) {
+	a, b := New(4, 0), New(4, 0)
+	for i := 0; i < 1000; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if a.Get(key) != b.Get(key) {
+			t.Fatalf("key %q maps to different members across identical rings", key)
+		}
+	}
+}
+
+func TestRing_Distribution(t *testing.T) {
+	const members, keys = 4, 10000
+	r := New(members, 0)
+
+	counts := make([]int, members)
+	for i := 0; i < keys; i++ {
+		counts[r.Get([]byte(fmt.Sprintf("key-%d", i)))]++
+	}
+
+	// Each member should own roughly a quarter; allow a generous margin.
+	for m, c := range counts {
+		if c < keys/members/2 || c > keys/members*2 {
+			t.Errorf("member %d owns %d of %d keys, distribution too skewed: %v", m, c, keys, counts)
+		}
+	}
+}
+
+func TestRing_MinimalRemapping(t *testing.T) {
+	const keys = 10000
+	before, after := New(4, 0), New(5, 0)
+
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := []byte(fmt.Sprintf("key-%d", i))
+		if b, a := before.Get(key), after.Get(key); b != a {
+			if a != 4 {
+				t.Fatalf("key %q moved between existing members %d -> %d", key, b, a)
+			}
+			moved++
+		}
+	}
+
+	// Ideally 1/5 of keys move to the new member.
+	if moved > keys/5*2 {
+		t.Errorf("%d of %d keys remapped when adding one member; expected about %d", moved, keys, keys/5)
+	}
+}
+
+func TestRing_Empty(t *testing.T) {
+	if got := New(0, 0).Get([]byte("k")); got != -1 {
+		t.Errorf("empty ring Get = %d, want -1", got)
+	}
+}
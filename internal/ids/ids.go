@@ -0,0 +1,128 @@
+// Package ids generates the request and message IDs kahook hands out, in one
+// of several schemes. UUIDv7, ULID, and KSUID start with a timestamp, so they
+// sort by creation time, which keeps indexes that key on them compact and
+// makes IDs from one incident easy to find together.
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ID schemes.
+const (
+	UUIDv4 = "uuidv4"
+	UUIDv7 = "uuidv7"
+	ULID   = "ulid"
+	KSUID  = "ksuid"
+)
+
+// Generator returns a new ID on each call. It is safe for concurrent use.
+type Generator func() string
+
+// New returns a Generator for scheme; empty means UUIDv4.
+//
+// UUIDv7 and ULID sort by millisecond and KSUID by second; IDs created
+// within the same tick are in random order.
+func New(scheme string) (Generator, error) {
+	switch scheme {
+	case "", UUIDv4:
+		return uuid.NewString, nil
+	case UUIDv7:
+		return func() string { return newUUIDv7(time.Now(), random(10)) }, nil
+	case ULID:
+		return func() string { return newULID(time.Now(), random(10)) }, nil
+	case KSUID:
+		return func() string { return newKSUID(time.Now(), random(16)) }, nil
+	default:
+		return nil, fmt.Errorf("unknown ID scheme %q (want uuidv4, uuidv7, ulid, or ksuid)", scheme)
+	}
+}
+
+func random(n int) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand only fails when the OS has no entropy source.
+		panic(fmt.Sprintf("ids: reading random bytes: %v", err))
+	}
+	return b
+}
+
+// newUUIDv7 builds an RFC 9562 version 7 UUID: a 48-bit Unix millisecond
+// timestamp followed by 74 random bits. rnd holds at least 10 bytes.
+func newUUIDv7(now time.Time, rnd []byte) string {
+	var u uuid.UUID
+	putMillis(u[:6], now)
+	copy(u[6:], rnd[:10])
+	u[6] = u[6]&0x0f | 0x70 // version 7
+	u[8] = u[8]&0x3f | 0x80 // RFC 9562 variant
+	return u.String()
+}
+
+// crockford is the Crockford base32 alphabet ULIDs are written in.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// newULID builds a ULID: a 48-bit Unix millisecond timestamp followed by 80
+// random bits, as 26 Crockford base32 characters. rnd holds at least 10
+// bytes.
+func newULID(now time.Time, rnd []byte) string {
+	var id [16]byte
+	putMillis(id[:6], now)
+	copy(id[6:], rnd[:10])
+
+	// 128 bits in 26 five-bit characters: the first character carries only
+	// the top three bits.
+	hi := binary.BigEndian.Uint64(id[:8])
+	lo := binary.BigEndian.Uint64(id[8:])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&0x1f]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+// ksuidEpoch is the KSUID timestamp origin, 2014-05-13T16:53:20Z.
+const ksuidEpoch = 1400000000
+
+// base62 is the alphabet KSUIDs are written in.
+const base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// newKSUID builds a KSUID: a 32-bit count of seconds since ksuidEpoch
+// followed by 128 random bits, as 27 base62 characters. rnd holds at least
+// 16 bytes.
+func newKSUID(now time.Time, rnd []byte) string {
+	var id [20]byte
+	binary.BigEndian.PutUint32(id[:4], uint32(now.Unix()-ksuidEpoch))
+	copy(id[4:], rnd[:16])
+
+	// Repeated division of the 160-bit number by 62, as five 32-bit words.
+	var words [5]uint32
+	for i := range words {
+		words[i] = binary.BigEndian.Uint32(id[i*4:])
+	}
+	out := [27]byte{}
+	for i := 26; i >= 0; i-- {
+		var rem uint64
+		for j := range words {
+			acc := rem<<32 | uint64(words[j])
+			words[j] = uint32(acc / 62)
+			rem = acc % 62
+		}
+		out[i] = base62[rem]
+	}
+	return string(out[:])
+}
+
+func putMillis(b []byte, now time.Time) {
+	ms := uint64(now.UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
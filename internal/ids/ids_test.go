@@ -0,0 +1,88 @@
+package ids
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestKnownValues(t *testing.T) {
+	ones := bytes.Repeat([]byte{0xff}, 16)
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		// RFC 9562 appendix A.6.
+		{"uuidv7", newUUIDv7(time.UnixMilli(0x017F22E279B0),
+			[]byte{0x0c, 0xc3, 0x18, 0xc4, 0xdc, 0x0c, 0x0c, 0x07, 0x39, 0x8f}),
+			"017f22e2-79b0-7cc3-98c4-dc0c0c07398f"},
+		{"ulid timestamp", newULID(time.UnixMilli(1469918176385), make([]byte, 10))[:10], "01ARYZ6S41"},
+		{"ulid max", newULID(time.UnixMilli(1<<48-1), ones), "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{"ksuid min", newKSUID(time.Unix(ksuidEpoch, 0), make([]byte, 16)), "000000000000000000000000000"},
+		{"ksuid max", newKSUID(time.Unix(ksuidEpoch+1<<32-1, 0), ones), "aWgEPTl1tmebfsQzFP4bxwgy80V"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		scheme  string
+		length  int
+		charset string
+	}{
+		{"", 36, "0123456789abcdef-"},
+		{UUIDv4, 36, "0123456789abcdef-"},
+		{UUIDv7, 36, "0123456789abcdef-"},
+		{ULID, 26, crockford},
+		{KSUID, 27, base62},
+	}
+	for _, tt := range tests {
+		gen, err := New(tt.scheme)
+		if err != nil {
+			t.Fatalf("New(%q): %v", tt.scheme, err)
+		}
+		a, b := gen(), gen()
+		if a == b {
+			t.Errorf("%s: generated %s twice", tt.scheme, a)
+		}
+		if len(a) != tt.length || strings.Trim(a, tt.charset) != "" {
+			t.Errorf("%s: malformed ID %q", tt.scheme, a)
+		}
+	}
+
+	gen, _ := New(UUIDv7)
+	if u, err := uuid.Parse(gen()); err != nil || u.Version() != 7 || u.Variant() != uuid.RFC4122 {
+		t.Errorf("uuidv7 = %v (version %d, variant %v)", u, u.Version(), u.Variant())
+	}
+
+	if _, err := New("snowflake"); err == nil {
+		t.Error("New accepted an unknown scheme")
+	}
+}
+
+func TestSortableSchemesOrderByTime(t *testing.T) {
+	base := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	schemes := map[string]func(time.Time) string{
+		UUIDv7: func(now time.Time) string { return newUUIDv7(now, random(10)) },
+		ULID:   func(now time.Time) string { return newULID(now, random(10)) },
+		KSUID:  func(now time.Time) string { return newKSUID(now, random(16)) },
+	}
+	for name, gen := range schemes {
+		var got []string
+		for i := range 50 {
+			got = append(got, gen(base.Add(time.Duration(i)*time.Second)))
+		}
+		if !sort.StringsAreSorted(got) {
+			t.Errorf("%s IDs do not sort by creation time: %v", name, got)
+		}
+	}
+}
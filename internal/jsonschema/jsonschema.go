@@ -0,0 +1,675 @@
+// Package jsonschema validates JSON documents against a JSON Schema. It
+// implements the assertions webhook payload schemas use in practice, from
+// draft-07 and 2020-12: type, enum, const, the numeric, string, array, and
+// object constraints, the allOf/anyOf/oneOf/not combinators, and $ref to
+// definitions within the same document. Annotations such as title, format,
+// and default are accepted and ignored. Assertions it does not implement are
+// rejected when the schema is compiled, so a schema is never silently
+// enforced only in part.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxProblems bounds the problems a single validation reports.
+const MaxProblems = 10
+
+// unsupported lists assertion keywords this package does not implement.
+var unsupported = []string{
+	"if", "then", "else", "dependentRequired", "dependentSchemas", "dependencies",
+	"patternProperties", "propertyNames", "unevaluatedProperties", "unevaluatedItems",
+	"contains", "minContains", "maxContains", "prefixItems", "additionalItems",
+	"$dynamicRef", "$recursiveRef",
+}
+
+// Schema is a compiled JSON Schema. It is safe for concurrent use.
+type Schema struct {
+	// always is set for the boolean schemas true and false.
+	always *bool
+
+	types    []string
+	enum     []any
+	constant any
+	hasConst bool
+
+	minimum, maximum                   *float64
+	exclusiveMinimum, exclusiveMaximum *float64
+	multipleOf                         *float64
+
+	minLength, maxLength *int
+	pattern              *regexp.Regexp
+
+	items              *Schema
+	minItems, maxItems *int
+	uniqueItems        bool
+
+	properties                   map[string]*Schema
+	required                     []string
+	additionalProperties         *Schema
+	minProperties, maxProperties *int
+
+	allOf, anyOf, oneOf []*Schema
+	not                 *Schema
+	ref                 *Schema
+}
+
+// Problem is one way a document fails its schema. Path is a JSON Pointer to
+// the offending value; "" is the document itself.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+func (p Problem) String() string {
+	path := p.Path
+	if path == "" {
+		path = "/"
+	}
+	return path + ": " + p.Message
+}
+
+// Compile parses a JSON Schema document.
+func Compile(data []byte) (*Schema, error) {
+	root, err := decode(data)
+	if err != nil {
+		return nil, fmt.Errorf("schema is not valid JSON: %w", err)
+	}
+	c := &compiler{root: root, refs: make(map[string]*Schema)}
+	return c.compile(root, "#")
+}
+
+// Validate checks the JSON document data, returning its problems, at most
+// MaxProblems of them. A document that is not JSON has one problem.
+func (s *Schema) Validate(data []byte) []Problem {
+	v, err := decode(data)
+	if err != nil {
+		return []Problem{{Message: "body is not valid JSON"}}
+	}
+	var problems []Problem
+	s.validate(v, "", &problems)
+	if len(problems) > MaxProblems {
+		problems = problems[:MaxProblems]
+	}
+	return problems
+}
+
+// decode parses data keeping numbers as json.Number, so integers beyond
+// float64 precision are still recognised as integers.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return v, nil
+}
+
+type compiler struct {
+	root any
+	refs map[string]*Schema
+}
+
+func (c *compiler) compile(v any, at string) (*Schema, error) {
+	if b, ok := v.(bool); ok {
+		return &Schema{always: &b}, nil
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s: a schema must be an object or a boolean", at)
+	}
+	for _, k := range unsupported {
+		if _, ok := m[k]; ok {
+			return nil, fmt.Errorf("%s: keyword %q is not supported", at, k)
+		}
+	}
+
+	s := &Schema{}
+	var err error
+	if ref, ok := m["$ref"]; ok {
+		r, ok := ref.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/$ref: must be a string", at)
+		}
+		if s.ref, err = c.resolve(r); err != nil {
+			return nil, fmt.Errorf("%s/$ref: %w", at, err)
+		}
+	}
+
+	if err := c.compileTypes(s, m, at); err != nil {
+		return nil, err
+	}
+	if e, ok := m["enum"]; ok {
+		list, ok := e.([]any)
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("%s/enum: must be a non-empty array", at)
+		}
+		s.enum = list
+	}
+	if v, ok := m["const"]; ok {
+		s.constant, s.hasConst = v, true
+	}
+
+	numbers := []struct {
+		name string
+		dst  **float64
+	}{
+		{"minimum", &s.minimum},
+		{"maximum", &s.maximum},
+		{"exclusiveMinimum", &s.exclusiveMinimum},
+		{"exclusiveMaximum", &s.exclusiveMaximum},
+		{"multipleOf", &s.multipleOf},
+	}
+	for _, n := range numbers {
+		if *n.dst, err = number(m, n.name, at); err != nil {
+			return nil, err
+		}
+	}
+	if s.multipleOf != nil && *s.multipleOf <= 0 {
+		return nil, fmt.Errorf("%s/multipleOf: must be greater than 0", at)
+	}
+
+	counts := []struct {
+		name string
+		dst  **int
+	}{
+		{"minLength", &s.minLength},
+		{"maxLength", &s.maxLength},
+		{"minItems", &s.minItems},
+		{"maxItems", &s.maxItems},
+		{"minProperties", &s.minProperties},
+		{"maxProperties", &s.maxProperties},
+	}
+	for _, n := range counts {
+		if *n.dst, err = count(m, n.name, at); err != nil {
+			return nil, err
+		}
+	}
+
+	if p, ok := m["pattern"]; ok {
+		str, ok := p.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s/pattern: must be a string", at)
+		}
+		if s.pattern, err = regexp.Compile(str); err != nil {
+			return nil, fmt.Errorf("%s/pattern: %w", at, err)
+		}
+	}
+	if u, ok := m["uniqueItems"]; ok {
+		b, ok := u.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%s/uniqueItems: must be a boolean", at)
+		}
+		s.uniqueItems = b
+	}
+
+	if r, ok := m["required"]; ok {
+		list, ok := r.([]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/required: must be an array of strings", at)
+		}
+		for _, name := range list {
+			str, ok := name.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s/required: must be an array of strings", at)
+			}
+			s.required = append(s.required, str)
+		}
+	}
+	if p, ok := m["properties"]; ok {
+		props, ok := p.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s/properties: must be an object", at)
+		}
+		s.properties = make(map[string]*Schema, len(props))
+		for name, sub := range props {
+			if s.properties[name], err = c.compile(sub, at+"/properties/"+escape(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if s.additionalProperties, err = c.subschema(m, "additionalProperties", at); err != nil {
+		return nil, err
+	}
+	if s.items, err = c.subschema(m, "items", at); err != nil {
+		return nil, err
+	}
+	if s.not, err = c.subschema(m, "not", at); err != nil {
+		return nil, err
+	}
+
+	lists := []struct {
+		name string
+		dst  *[]*Schema
+	}{
+		{"allOf", &s.allOf},
+		{"anyOf", &s.anyOf},
+		{"oneOf", &s.oneOf},
+	}
+	for _, l := range lists {
+		v, ok := m[l.name]
+		if !ok {
+			continue
+		}
+		list, ok := v.([]any)
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("%s/%s: must be a non-empty array", at, l.name)
+		}
+		for i, sub := range list {
+			compiled, err := c.compile(sub, fmt.Sprintf("%s/%s/%d", at, l.name, i))
+			if err != nil {
+				return nil, err
+			}
+			*l.dst = append(*l.dst, compiled)
+		}
+	}
+	return s, nil
+}
+
+func (c *compiler) compileTypes(s *Schema, m map[string]any, at string) error {
+	t, ok := m["type"]
+	if !ok {
+		return nil
+	}
+	var names []any
+	switch t := t.(type) {
+	case string:
+		names = []any{t}
+	case []any:
+		names = t
+	default:
+		return fmt.Errorf("%s/type: must be a string or an array of strings", at)
+	}
+	for _, n := range names {
+		name, ok := n.(string)
+		switch name {
+		case "null", "boolean", "object", "array", "number", "integer", "string":
+		default:
+			ok = false
+		}
+		if !ok {
+			return fmt.Errorf("%s/type: unknown type %v", at, n)
+		}
+		s.types = append(s.types, name)
+	}
+	return nil
+}
+
+func (c *compiler) subschema(m map[string]any, name, at string) (*Schema, error) {
+	v, ok := m[name]
+	if !ok {
+		return nil, nil
+	}
+	if _, ok := v.([]any); ok && name == "items" {
+		return nil, fmt.Errorf("%s/items: the array form is not supported", at)
+	}
+	return c.compile(v, at+"/"+name)
+}
+
+// resolve compiles the schema a $ref points to. Only references into the
+// same document ("#", "#/$defs/name", ...) are supported. Schemas are
+// cached by reference, and cached before they are compiled, so recursive
+// schemas terminate.
+func (c *compiler) resolve(ref string) (*Schema, error) {
+	if s, ok := c.refs[ref]; ok {
+		return s, nil
+	}
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("only references within the schema are supported, got %q", ref)
+	}
+	target := c.root
+	if ref != "#" {
+		for _, tok := range strings.Split(ref[2:], "/") {
+			tok = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+			switch t := target.(type) {
+			case map[string]any:
+				v, ok := t[tok]
+				if !ok {
+					return nil, fmt.Errorf("%q does not exist", ref)
+				}
+				target = v
+			case []any:
+				i, err := strconv.Atoi(tok)
+				if err != nil || i < 0 || i >= len(t) {
+					return nil, fmt.Errorf("%q does not exist", ref)
+				}
+				target = t[i]
+			default:
+				return nil, fmt.Errorf("%q does not exist", ref)
+			}
+		}
+	}
+
+	s := &Schema{}
+	c.refs[ref] = s
+	compiled, err := c.compile(target, ref)
+	if err != nil {
+		return nil, err
+	}
+	*s = *compiled
+	return s, nil
+}
+
+func number(m map[string]any, name, at string) (*float64, error) {
+	v, ok := m[name]
+	if !ok {
+		return nil, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be a number", at, name)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", at, name, err)
+	}
+	return &f, nil
+}
+
+func count(m map[string]any, name, at string) (*int, error) {
+	v, ok := m[name]
+	if !ok {
+		return nil, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return nil, fmt.Errorf("%s/%s: must be a non-negative integer", at, name)
+	}
+	i, err := strconv.Atoi(n.String())
+	if err != nil || i < 0 {
+		return nil, fmt.Errorf("%s/%s: must be a non-negative integer", at, name)
+	}
+	return &i, nil
+}
+
+func (s *Schema) validate(v any, path string, problems *[]Problem) {
+	if len(*problems) > MaxProblems {
+		return
+	}
+	report := func(format string, args ...any) {
+		*problems = append(*problems, Problem{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if s.always != nil {
+		if !*s.always {
+			report("no value is allowed here")
+		}
+		return
+	}
+	if s.ref != nil {
+		s.ref.validate(v, path, problems)
+	}
+
+	if len(s.types) > 0 && !s.hasType(v) {
+		report("must be %s, got %s", strings.Join(s.types, " or "), typeOf(v))
+		return
+	}
+	if s.enum != nil && !containsValue(s.enum, v) {
+		report("must be one of %s", describeValues(s.enum))
+	}
+	if s.hasConst && !equal(s.constant, v) {
+		report("must be %s", describe(s.constant))
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		s.validateNumber(v, report)
+	case string:
+		s.validateString(v, report)
+	case []any:
+		s.validateArray(v, path, problems, report)
+	case map[string]any:
+		s.validateObject(v, path, problems, report)
+	}
+
+	for _, sub := range s.allOf {
+		sub.validate(v, path, problems)
+	}
+	if len(s.anyOf) > 0 {
+		matched := false
+		for _, sub := range s.anyOf {
+			if sub.valid(v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			report("must match at least one schema in anyOf")
+		}
+	}
+	if len(s.oneOf) > 0 {
+		n := 0
+		for _, sub := range s.oneOf {
+			if sub.valid(v) {
+				n++
+			}
+		}
+		if n != 1 {
+			report("must match exactly one schema in oneOf, matched %d", n)
+		}
+	}
+	if s.not != nil && s.not.valid(v) {
+		report("must not match the schema in not")
+	}
+}
+
+func (s *Schema) valid(v any) bool {
+	var problems []Problem
+	s.validate(v, "", &problems)
+	return len(problems) == 0
+}
+
+func (s *Schema) validateNumber(n json.Number, report func(string, ...any)) {
+	f, err := n.Float64()
+	if err != nil {
+		report("is not a representable number")
+		return
+	}
+	if s.minimum != nil && f < *s.minimum {
+		report("must be >= %v", *s.minimum)
+	}
+	if s.maximum != nil && f > *s.maximum {
+		report("must be <= %v", *s.maximum)
+	}
+	if s.exclusiveMinimum != nil && f <= *s.exclusiveMinimum {
+		report("must be > %v", *s.exclusiveMinimum)
+	}
+	if s.exclusiveMaximum != nil && f >= *s.exclusiveMaximum {
+		report("must be < %v", *s.exclusiveMaximum)
+	}
+	if s.multipleOf != nil {
+		q := f / *s.multipleOf
+		if math.Abs(q-math.Round(q)) > 1e-9 {
+			report("must be a multiple of %v", *s.multipleOf)
+		}
+	}
+}
+
+func (s *Schema) validateString(str string, report func(string, ...any)) {
+	n := utf8.RuneCountInString(str)
+	if s.minLength != nil && n < *s.minLength {
+		report("must be at least %d characters long", *s.minLength)
+	}
+	if s.maxLength != nil && n > *s.maxLength {
+		report("must be at most %d characters long", *s.maxLength)
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		report("must match pattern %q", s.pattern.String())
+	}
+}
+
+func (s *Schema) validateArray(a []any, path string, problems *[]Problem, report func(string, ...any)) {
+	if s.minItems != nil && len(a) < *s.minItems {
+		report("must have at least %d items", *s.minItems)
+	}
+	if s.maxItems != nil && len(a) > *s.maxItems {
+		report("must have at most %d items", *s.maxItems)
+	}
+	if s.uniqueItems {
+		for i := 1; i < len(a); i++ {
+			if containsValue(a[:i], a[i]) {
+				report("items must be unique; item %d repeats an earlier one", i)
+				break
+			}
+		}
+	}
+	if s.items != nil {
+		for i, item := range a {
+			s.items.validate(item, path+"/"+strconv.Itoa(i), problems)
+		}
+	}
+}
+
+func (s *Schema) validateObject(o map[string]any, path string, problems *[]Problem, report func(string, ...any)) {
+	if s.minProperties != nil && len(o) < *s.minProperties {
+		report("must have at least %d properties", *s.minProperties)
+	}
+	if s.maxProperties != nil && len(o) > *s.maxProperties {
+		report("must have at most %d properties", *s.maxProperties)
+	}
+	for _, name := range s.required {
+		if _, ok := o[name]; !ok {
+			report("missing required property %q", name)
+		}
+	}
+
+	// Visit properties in order so problems are reported deterministically.
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sub, ok := s.properties[name]
+		if !ok {
+			sub = s.additionalProperties
+			if sub != nil && sub.always != nil && !*sub.always {
+				report("property %q is not allowed", name)
+				continue
+			}
+		}
+		if sub != nil {
+			sub.validate(o[name], path+"/"+escape(name), problems)
+		}
+	}
+}
+
+func (s *Schema) hasType(v any) bool {
+	for _, t := range s.types {
+		if t == typeOf(v) || t == "number" && typeOf(v) == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON Schema type of a decoded value. Numbers with no
+// fractional part are integers.
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// equal compares decoded JSON values, treating numbers by value (1 equals
+// 1.0).
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		bn, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if a == bn {
+			return true
+		}
+		af, err1 := a.Float64()
+		bf, err2 := bn.Float64()
+		return err1 == nil && err2 == nil && af == bf
+	case []any:
+		bl, ok := b.([]any)
+		if !ok || len(a) != len(bl) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], bl[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		bm, ok := b.(map[string]any)
+		if !ok || len(a) != len(bm) {
+			return false
+		}
+		for k, v := range a {
+			bv, ok := bm[k]
+			if !ok || !equal(v, bv) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b
+	}
+}
+
+func containsValue(list []any, v any) bool {
+	for _, item := range list {
+		if equal(item, v) {
+			return true
+		}
+	}
+	return false
+}
+
+func describe(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func describeValues(list []any) string {
+	parts := make([]string, len(list))
+	for i, v := range list {
+		parts[i] = describe(v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escape encodes a property name as a JSON Pointer token.
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
@@ -0,0 +1,114 @@
+package jsonschema
+
+import (
+	"strings"
+	"testing"
+)
+
+const orderSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "title": "Order",
+  "type": "object",
+  "required": ["id", "amount", "items"],
+  "additionalProperties": false,
+  "properties": {
+    "id": {"type": "string", "pattern": "^ord_[a-z0-9]+$"},
+    "amount": {"type": "integer", "minimum": 0},
+    "currency": {"enum": ["usd", "eur"]},
+    "status": {"oneOf": [{"const": "paid"}, {"const": "refunded"}]},
+    "items": {"type": "array", "minItems": 1, "items": {"$ref": "#/$defs/item"}},
+    "note": {"type": ["string", "null"], "maxLength": 5}
+  },
+  "$defs": {
+    "item": {
+      "type": "object",
+      "required": ["sku"],
+      "properties": {"sku": {"type": "string", "minLength": 1}, "qty": {"type": "number", "exclusiveMinimum": 0}}
+    }
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	s, err := Compile([]byte(orderSchema))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		doc  string
+		want []string
+	}{
+		{"valid", `{"id":"ord_1","amount":250,"currency":"usd","status":"paid","items":[{"sku":"a","qty":1.5}],"note":null}`, nil},
+		{"integral float is an integer", `{"id":"ord_1","amount":2.0,"items":[{"sku":"a"}]}`, nil},
+		{"missing required", `{"id":"ord_1","items":[{"sku":"a"}]}`, []string{`/: missing required property "amount"`}},
+		{"wrong type", `{"id":"ord_1","amount":"250","items":[{"sku":"a"}]}`, []string{"/amount: must be integer, got string"}},
+		{"not an integer", `{"id":"ord_1","amount":2.5,"items":[{"sku":"a"}]}`, []string{"/amount: must be integer, got number"}},
+		{"below minimum", `{"id":"ord_1","amount":-1,"items":[{"sku":"a"}]}`, []string{"/amount: must be >= 0"}},
+		{"pattern", `{"id":"x","amount":1,"items":[{"sku":"a"}]}`, []string{`/id: must match pattern "^ord_[a-z0-9]+$"`}},
+		{"enum", `{"id":"ord_1","amount":1,"currency":"gbp","items":[{"sku":"a"}]}`, []string{`/currency: must be one of "usd", "eur"`}},
+		{"oneOf", `{"id":"ord_1","amount":1,"status":"lost","items":[{"sku":"a"}]}`, []string{"/status: must match exactly one schema in oneOf, matched 0"}},
+		{"additional property", `{"id":"ord_1","amount":1,"items":[{"sku":"a"}],"extra":1}`, []string{`/: property "extra" is not allowed`}},
+		{"empty array", `{"id":"ord_1","amount":1,"items":[]}`, []string{"/items: must have at least 1 items"}},
+		{"ref", `{"id":"ord_1","amount":1,"items":[{"sku":"a"},{"qty":0}]}`, []string{`/items/1: missing required property "sku"`, "/items/1/qty: must be > 0"}},
+		{"max length", `{"id":"ord_1","amount":1,"items":[{"sku":"a"}],"note":"héllo!"}`, []string{"/note: must be at most 5 characters long"}},
+		{"not json", `{"id":`, []string{"/: body is not valid JSON"}},
+		{"trailing data", `{} {}`, []string{"/: body is not valid JSON"}},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, p := range s.Validate([]byte(tt.doc)) {
+			got = append(got, p.String())
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+			t.Errorf("%s: Validate() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidate_RecursiveRef(t *testing.T) {
+	s, err := Compile([]byte(`{
+	  "type": "object",
+	  "properties": {"name": {"type": "string"}, "children": {"type": "array", "items": {"$ref": "#"}}}
+	}`))
+	if err != nil {
+		t.Fatalf("Compile() error = %v", err)
+	}
+	problems := s.Validate([]byte(`{"name":"a","children":[{"name":"b","children":[{"name":3}]}]}`))
+	if len(problems) != 1 || problems[0].Path != "/children/0/children/0/name" {
+		t.Errorf("Validate() = %v, want one problem at the nested name", problems)
+	}
+}
+
+func TestValidate_LimitsProblems(t *testing.T) {
+	s, err := Compile([]byte(`{"type": "array", "items": {"type": "string"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(s.Validate([]byte(`[1,2,3,4,5,6,7,8,9,10,11,12]`))); got != MaxProblems {
+		t.Errorf("Validate() reported %d problems, want %d", got, MaxProblems)
+	}
+}
+
+func TestCompile_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr string
+	}{
+		{"not json", `{`, "not valid JSON"},
+		{"not a schema", `[]`, "must be an object or a boolean"},
+		{"unknown type", `{"type": "objekt"}`, `unknown type objekt`},
+		{"bad pattern", `{"pattern": "("}`, "#/pattern"},
+		{"unsupported keyword", `{"properties": {"a": {"if": {}}}}`, `#/properties/a: keyword "if" is not supported`},
+		{"remote ref", `{"$ref": "https://example.com/schema.json"}`, "only references within the schema"},
+		{"missing ref", `{"$ref": "#/$defs/nope"}`, "does not exist"},
+		{"negative count", `{"minLength": -1}`, "non-negative integer"},
+	}
+	for _, tt := range tests {
+		_, err := Compile([]byte(tt.schema))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: Compile() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
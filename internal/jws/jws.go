@@ -0,0 +1,342 @@
+// Package jws signs and verifies detached JSON Web Signatures (RFC 7515,
+// appendix F): the payload travels on its own, as an HTTP body, and the
+// signature is the compact serialization with the payload left out,
+// "header..signature".
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Errors returned by Verify.
+var (
+	ErrMalformed = errors.New("malformed detached JWS")
+	ErrMismatch  = errors.New("signature does not match")
+)
+
+// minRSABits is the smallest RSA key NewSigner accepts.
+const minRSABits = 2048
+
+// Header is the protected header of a signature. IssuedAt is when the
+// signature was made, in Unix seconds.
+type Header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Signer signs payloads with a private key: EdDSA for Ed25519 keys, ES256
+// or ES384 for ECDSA P-256 or P-384 keys, and RS256 for RSA keys.
+type Signer struct {
+	key   crypto.Signer
+	alg   string
+	keyID string
+	now   func() time.Time
+}
+
+// NewSigner parses a PEM private key (PKCS #8, SEC 1, or PKCS #1) and
+// returns a Signer for it. An empty keyID defaults to the key's RFC 7638
+// thumbprint.
+func NewSigner(keyPEM []byte, keyID string) (*Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	alg, err := algorithm(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	if keyID == "" {
+		if keyID, err = Thumbprint(key.Public()); err != nil {
+			return nil, err
+		}
+	}
+	return &Signer{key: key, alg: alg, keyID: keyID, now: time.Now}, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.Signer, error) {
+	if k, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		if s, ok := k.(crypto.Signer); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("unsupported private key type %T", k)
+	}
+	if k, err := x509.ParseECPrivateKey(der); err == nil {
+		return k, nil
+	}
+	if k, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return k, nil
+	}
+	return nil, errors.New("not a PKCS #8, SEC 1, or PKCS #1 private key")
+}
+
+// algorithm returns the JWS algorithm for a public key.
+func algorithm(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return "EdDSA", nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return "ES256", nil
+		case elliptic.P384():
+			return "ES384", nil
+		}
+		return "", fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+	case *rsa.PublicKey:
+		if k.N.BitLen() < minRSABits {
+			return "", fmt.Errorf("RSA keys must be at least %d bits, got %d", minRSABits, k.N.BitLen())
+		}
+		return "RS256", nil
+	}
+	return "", fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// Algorithm returns the JWS algorithm signatures are made with.
+func (s *Signer) Algorithm() string { return s.alg }
+
+// KeyID returns the kid signatures carry.
+func (s *Signer) KeyID() string { return s.keyID }
+
+// Public returns the public key signatures are verified with.
+func (s *Signer) Public() crypto.PublicKey { return s.key.Public() }
+
+// Sign returns the detached signature of payload.
+func (s *Signer) Sign(payload []byte) (string, error) {
+	header, err := json.Marshal(Header{Algorithm: s.alg, KeyID: s.keyID, IssuedAt: s.now().Unix()})
+	if err != nil {
+		return "", err
+	}
+	protected := base64.RawURLEncoding.EncodeToString(header)
+	sig, err := s.sign(signingInput(protected, payload))
+	if err != nil {
+		return "", err
+	}
+	return protected + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func (s *Signer) sign(input []byte) ([]byte, error) {
+	switch k := s.key.(type) {
+	case ed25519.PrivateKey:
+		return ed25519.Sign(k, input), nil
+	case *ecdsa.PrivateKey:
+		hash, size := ecHash(k.Curve)
+		r, ss, err := ecdsa.Sign(rand.Reader, k, digest(hash, input))
+		if err != nil {
+			return nil, err
+		}
+		// JWS encodes ECDSA signatures as R and S, each padded to the
+		// curve's size, rather than ASN.1.
+		sig := make([]byte, 2*size)
+		r.FillBytes(sig[:size])
+		ss.FillBytes(sig[size:])
+		return sig, nil
+	case *rsa.PrivateKey:
+		return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest(crypto.SHA256, input))
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", s.key)
+}
+
+// Verify checks a detached signature of payload against key and returns
+// its protected header.
+func Verify(signature string, payload []byte, key crypto.PublicKey) (Header, error) {
+	protected, rest, ok := strings.Cut(signature, "..")
+	if !ok || strings.Contains(rest, ".") {
+		return Header{}, ErrMalformed
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(protected)
+	if err != nil {
+		return Header{}, ErrMalformed
+	}
+	var h Header
+	if err := json.Unmarshal(raw, &h); err != nil {
+		return Header{}, ErrMalformed
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(rest)
+	if err != nil {
+		return Header{}, ErrMalformed
+	}
+	if alg, err := algorithm(key); err != nil || alg != h.Algorithm {
+		return Header{}, ErrMismatch
+	}
+
+	input := signingInput(protected, payload)
+	valid := false
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, input, sig)
+	case *ecdsa.PublicKey:
+		hash, size := ecHash(k.Curve)
+		if len(sig) == 2*size {
+			r := new(big.Int).SetBytes(sig[:size])
+			s := new(big.Int).SetBytes(sig[size:])
+			valid = ecdsa.Verify(k, digest(hash, input), r, s)
+		}
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(k, crypto.SHA256, digest(crypto.SHA256, input), sig) == nil
+	}
+	if !valid {
+		return Header{}, ErrMismatch
+	}
+	return h, nil
+}
+
+// signingInput is what is signed: the encoded header and payload joined
+// with a dot.
+func signingInput(protected string, payload []byte) []byte {
+	input := make([]byte, 0, len(protected)+1+base64.RawURLEncoding.EncodedLen(len(payload)))
+	input = append(input, protected...)
+	input = append(input, '.')
+	return base64.RawURLEncoding.AppendEncode(input, payload)
+}
+
+// ecHash returns the hash and coordinate size of ES256 or ES384.
+func ecHash(curve elliptic.Curve) (crypto.Hash, int) {
+	if curve == elliptic.P384() {
+		return crypto.SHA384, 48
+	}
+	return crypto.SHA256, 32
+}
+
+func digest(hash crypto.Hash, input []byte) []byte {
+	if hash == crypto.SHA384 {
+		sum := sha512.Sum384(input)
+		return sum[:]
+	}
+	sum := sha256.Sum256(input)
+	return sum[:]
+}
+
+// Thumbprint returns the RFC 7638 SHA-256 thumbprint of a public key,
+// base64url-encoded.
+func Thumbprint(pub crypto.PublicKey) (string, error) {
+	jwk, err := JWK(pub)
+	if err != nil {
+		return "", err
+	}
+	// JWK returns only the required members, and json.Marshal sorts map
+	// keys, which is the order RFC 7638 hashes them in.
+	b, err := json.Marshal(jwk)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// JWK returns the required members of a public key's JSON Web Key.
+func JWK(pub crypto.PublicKey) (map[string]string, error) {
+	enc := base64.RawURLEncoding.EncodeToString
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "crv": "Ed25519", "x": enc(k)}, nil
+	case *ecdsa.PublicKey:
+		_, size := ecHash(k.Curve)
+		x, y := make([]byte, size), make([]byte, size)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return map[string]string{"kty": "EC", "crv": k.Curve.Params().Name, "x": enc(x), "y": enc(y)}, nil
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "n": enc(k.N.Bytes()), "e": enc(big.NewInt(int64(k.E)).Bytes())}, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// ParseJWKS parses a JSON Web Key Set (RFC 7517) and returns its signing
+// keys by kid. A key without a kid is listed under its thumbprint. Keys of
+// an unsupported type or curve, and keys marked for encryption, are
+// skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Type  string `json:"kty"`
+			Use   string `json:"use"`
+			KeyID string `json:"kid"`
+			Curve string `json:"crv"`
+			N     string `json:"n"`
+			E     string `json:"e"`
+			X     string `json:"x"`
+			Y     string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	dec := base64.RawURLEncoding.DecodeString
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var pub crypto.PublicKey
+		switch k.Type {
+		case "RSA":
+			n, errN := dec(k.N)
+			e, errE := dec(k.E)
+			if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("invalid RSA key %q", k.KeyID)
+			}
+			pub = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Curve {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			default:
+				continue
+			}
+			x, errX := dec(k.X)
+			y, errY := dec(k.Y)
+			if errX != nil || errY != nil {
+				return nil, fmt.Errorf("invalid EC key %q", k.KeyID)
+			}
+			ec := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+			if _, err := ec.ECDH(); err != nil {
+				return nil, fmt.Errorf("invalid EC key %q: point is not on the curve", k.KeyID)
+			}
+			pub = ec
+		case "OKP":
+			if k.Curve != "Ed25519" {
+				continue
+			}
+			x, err := dec(k.X)
+			if err != nil || len(x) != ed25519.PublicKeySize {
+				return nil, fmt.Errorf("invalid Ed25519 key %q", k.KeyID)
+			}
+			pub = ed25519.PublicKey(x)
+		default:
+			continue
+		}
+		kid := k.KeyID
+		if kid == "" {
+			var err error
+			if kid, err = Thumbprint(pub); err != nil {
+				return nil, err
+			}
+		}
+		keys[kid] = pub
+	}
+	return keys, nil
+}
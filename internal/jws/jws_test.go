@@ -0,0 +1,179 @@
+package jws
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func pkcs8PEM(t *testing.T, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestSigner_RoundTrip(t *testing.T) {
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecDER, _ := x509.MarshalECPrivateKey(p256)
+
+	tests := []struct {
+		name string
+		pem  []byte
+		alg  string
+	}{
+		{"ed25519", pkcs8PEM(t, edKey), "EdDSA"},
+		{"p-256", pkcs8PEM(t, p256), "ES256"},
+		{"p-256 sec1", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}), "ES256"},
+		{"p-384", pkcs8PEM(t, p384), "ES384"},
+		{"rsa pkcs1", pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), "RS256"},
+	}
+	payload := []byte(`{"status":"accepted","request_id":"r1","message_id":"m1"}`)
+	for _, tt := range tests {
+		s, err := NewSigner(tt.pem, "")
+		if err != nil {
+			t.Fatalf("%s: NewSigner() error = %v", tt.name, err)
+		}
+		s.now = func() time.Time { return time.Unix(1700000000, 0) }
+		sig, err := s.Sign(payload)
+		if err != nil {
+			t.Fatalf("%s: Sign() error = %v", tt.name, err)
+		}
+		if strings.Count(sig, ".") != 2 || !strings.Contains(sig, "..") {
+			t.Errorf("%s: signature %q is not detached", tt.name, sig)
+		}
+		h, err := Verify(sig, payload, s.Public())
+		if err != nil {
+			t.Fatalf("%s: Verify() error = %v", tt.name, err)
+		}
+		if h.Algorithm != tt.alg || h.KeyID != s.KeyID() || h.IssuedAt != 1700000000 {
+			t.Errorf("%s: header = %+v", tt.name, h)
+		}
+		if _, err := Verify(sig, []byte(`{"status":"accepted","request_id":"r2"}`), s.Public()); !errors.Is(err, ErrMismatch) {
+			t.Errorf("%s: Verify() of another payload error = %v, want ErrMismatch", tt.name, err)
+		}
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	s, err := NewSigner(pkcs8PEM(t, key), "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, _ := s.Sign([]byte("{}"))
+	protected, _, _ := strings.Cut(sig, "..")
+
+	tests := []struct {
+		name string
+		sig  string
+		key  crypto.PublicKey
+		want error
+	}{
+		{"other key", sig, other, ErrMismatch},
+		{"attached payload", protected + ".e30." + strings.SplitN(sig, "..", 2)[1], s.Public(), ErrMalformed},
+		{"bad header", "!!.." + strings.SplitN(sig, "..", 2)[1], s.Public(), ErrMalformed},
+		{"no separator", protected, s.Public(), ErrMalformed},
+	}
+	for _, tt := range tests {
+		if _, err := Verify(tt.sig, []byte("{}"), tt.key); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() error = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestNewSigner_Rejects(t *testing.T) {
+	small, _ := rsa.GenerateKey(rand.Reader, 1024)
+	p224, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	tests := []struct {
+		name    string
+		pem     []byte
+		wantErr string
+	}{
+		{"not PEM", []byte("secret"), "no PEM block"},
+		{"small RSA", pkcs8PEM(t, small), "at least 2048 bits"},
+		{"P-224", pkcs8PEM(t, p224), "unsupported ECDSA curve"},
+		{"certificate", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{1, 2}}), "private key"},
+	}
+	for _, tt := range tests {
+		if _, err := NewSigner(tt.pem, ""); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: NewSigner() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 8037, appendix A.3.
+	x, _ := base64.RawURLEncoding.DecodeString("11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo")
+	got, err := Thumbprint(ed25519.PublicKey(x))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"; got != want {
+		t.Errorf("Thumbprint() = %s, want %s", got, want)
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	jwk := func(pub crypto.PublicKey, extra map[string]string) map[string]string {
+		k, err := JWK(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, v := range extra {
+			k[name] = v
+		}
+		return k
+	}
+	set, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		jwk(&rsaKey.PublicKey, map[string]string{"kid": "rsa", "use": "sig"}),
+		jwk(&p256.PublicKey, map[string]string{"kid": "ec"}),
+		jwk(edPub, nil),
+		jwk(&rsaKey.PublicKey, map[string]string{"kid": "enc", "use": "enc"}),
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}})
+
+	keys, err := ParseJWKS(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	thumb, _ := Thumbprint(edPub)
+	if len(keys) != 3 || keys["rsa"] == nil || keys["ec"] == nil || keys[thumb] == nil {
+		t.Fatalf("ParseJWKS() = %v, want the rsa, ec and Ed25519 signing keys", keys)
+	}
+	if !p256.PublicKey.Equal(keys["ec"]) || !rsaKey.PublicKey.Equal(keys["rsa"]) {
+		t.Error("ParseJWKS() keys do not match the encoded keys")
+	}
+
+	bad := []string{
+		`not json`,
+		`{"keys":[{"kty":"RSA","kid":"x","n":"!!","e":"AQAB"}]}`,
+		`{"keys":[{"kty":"EC","kid":"x","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+	}
+	for _, b := range bad {
+		if _, err := ParseJWKS([]byte(b)); err == nil {
+			t.Errorf("ParseJWKS(%s) error = nil", b)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/logctx"
+)
+
+// Client is implemented by Producer and by the types in this package that
+// compose producers (Pool, Serialized, TopicRouter). It matches the server's
+// KafkaProducer interface.
+type Client interface {
+	Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
+	IsConnected() bool
+	Close()
+}
+
+// debugDelivery logs the outcome of one produce at debug level, with the
+// log fields of the request it was made for, so a message can be followed
+// from the webhook to its partition and offset. A partition or offset of
+// -1 is unknown.
+func debugDelivery(ctx context.Context, logger *zap.Logger, topic string, partition int32, offset int64, err error) {
+	if !logger.Core().Enabled(zap.DebugLevel) {
+		return
+	}
+	fields := []zap.Field{zap.String("kafka_topic", topic)}
+	if partition >= 0 {
+		fields = append(fields, zap.Int32("partition", partition), zap.Int64("offset", offset))
+	}
+	if err != nil {
+		logctx.Logger(ctx, logger).Debug("kafka message delivery failed", append(fields, zap.Error(err))...)
+		return
+	}
+	logctx.Logger(ctx, logger).Debug("kafka message delivered", fields...)
+}
@@ -0,0 +1,66 @@
+//go:build cgo
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.uber.org/zap"
+)
+
+// BrokerClockConfig configures a BrokerClock.
+type BrokerClockConfig struct {
+	ConfigMap map[string]any
+	// Topic must be configured with message.timestamp.type=LogAppendTime,
+	// so the broker stamps each message with its own clock.
+	Topic  string
+	Logger *zap.Logger
+}
+
+// BrokerClock reads the Kafka brokers' clock by producing a small probe to a
+// LogAppendTime topic: the delivery report carries the time the broker
+// appended it. It is a clockcheck.Source.
+type BrokerClock struct {
+	producer *Producer
+	topic    string
+}
+
+// NewBrokerClock creates a BrokerClock with its own producer.
+func NewBrokerClock(cfg BrokerClockConfig) (*BrokerClock, error) {
+	producer, err := NewProducer(ProducerConfig{ConfigMap: withoutTransactions(cfg.ConfigMap), Logger: cfg.Logger})
+	if err != nil {
+		return nil, err
+	}
+	return &BrokerClock{producer: producer, topic: cfg.Topic}, nil
+}
+
+// Name returns "kafka".
+func (c *BrokerClock) Name() string { return "kafka" }
+
+// Offset produces a probe and compares the broker's append time with the
+// local time halfway through the round trip.
+func (c *BrokerClock) Offset(ctx context.Context) (time.Duration, error) {
+	sent := time.Now()
+	delivered, err := c.producer.deliver(ctx, &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &c.topic, Partition: kafka.PartitionAny},
+		Value:          []byte(`{"kahook_clock_probe":true}`),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("produce to %s: %w", c.topic, err)
+	}
+	received := time.Now()
+
+	if delivered.TimestampType != kafka.TimestampLogAppendTime {
+		return 0, fmt.Errorf("topic %s does not use LogAppendTime timestamps; set message.timestamp.type=LogAppendTime on it", c.topic)
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	return delivered.Timestamp.Sub(local), nil
+}
+
+// Close closes the probe producer.
+func (c *BrokerClock) Close() {
+	c.producer.Close()
+}
@@ -0,0 +1,78 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/filesink"
+	"github.com/kahook/internal/spool"
+)
+
+// DefaultFlushTimeout is how long Close waits for buffered messages to be
+// delivered when ProducerConfig.FlushTimeout is zero.
+const DefaultFlushTimeout = 5 * time.Second
+
+// errProducerClosed is returned for messages produced after Close.
+var errProducerClosed = errors.New("kafka producer is closed")
+
+// drainReport is what became of the messages a producer held when it was
+// closed.
+type drainReport struct {
+	pending   int // awaiting a delivery report when Close began
+	unflushed int // still undelivered when the flush timeout ran out
+	spilled   int // of those, written to spillFile
+	spillFile string
+	spillErr  error
+}
+
+// logDrain logs what became of a closed producer's messages.
+func logDrain(logger *zap.Logger, r drainReport, flushTimeout time.Duration, sp *spool.Spool) {
+	fields := []zap.Field{
+		zap.Int("pending", r.pending),
+		zap.Int("unflushed", r.unflushed),
+		zap.Duration("flush_timeout", flushTimeout),
+	}
+	switch {
+	case r.unflushed == 0:
+		if r.pending > 0 {
+			logger.Info("kafka producer flushed", fields...)
+		}
+	case sp == nil:
+		logger.Error("kafka producer closed with undelivered messages; they are lost", fields...)
+	case r.spillErr != nil:
+		logger.Error("failed to spill undelivered messages",
+			append(fields, zap.Int("spilled", r.spilled), zap.String("dir", sp.Dir()), zap.Error(r.spillErr))...)
+	default:
+		logger.Warn("spilled undelivered messages to disk",
+			append(fields, zap.Int("spilled", r.spilled), zap.String("file", r.spillFile))...)
+	}
+}
+
+// spilledMessage is an undelivered message as written to a spill file.
+type spilledMessage struct {
+	topic      string
+	key, value []byte
+	headers    map[string]string
+}
+
+// spill writes msgs to a new segment of sp, one JSON line each in the file
+// sink's format, and returns the segment's path and how many were written.
+// A message's delivery may have completed after it was selected, so
+// replaying a spill file can duplicate a few messages.
+func spill(sp *spool.Spool, msgs []spilledMessage) (string, int, error) {
+	seg, err := sp.Create("kahook-spill-")
+	if err != nil {
+		return "", 0, err
+	}
+	sink := filesink.NewWriterProducer(seg)
+	for i, m := range msgs {
+		if err := sink.Produce(context.Background(), m.topic, m.key, m.value, m.headers); err != nil {
+			seg.Close()
+			return seg.Name(), i, err
+		}
+	}
+	return seg.Name(), len(msgs), seg.Close()
+}
@@ -0,0 +1,56 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kahook/internal/filesink"
+	"github.com/kahook/internal/spool"
+)
+
+func TestSpill(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "spill")
+	msgs := []spilledMessage{
+		{topic: "orders", key: []byte("k1"), value: []byte(`{"id":1}`), headers: map[string]string{"Kahook-Message-Id": "m1"}},
+		{topic: "orders", value: []byte("plain text")},
+	}
+
+	sp, err := spool.New(spool.Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, n, err := spill(sp, msgs)
+	if err != nil {
+		t.Fatalf("spill() error = %v", err)
+	}
+	if n != 2 || filepath.Dir(path) != dir {
+		t.Fatalf("spill() = %q, %d, want a file in %q and 2", path, n, dir)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var got []filesink.Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec filesink.Record
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		got = append(got, rec)
+	}
+	if len(got) != 2 {
+		t.Fatalf("spill file has %d records, want 2", len(got))
+	}
+	if r := got[0]; r.Topic != "orders" || r.Key != "k1" || string(r.Value) != `{"id":1}` || r.Headers["Kahook-Message-Id"] != "m1" {
+		t.Errorf("first record = %+v", r)
+	}
+	if r := got[1]; r.ValueEncoding != "text" || string(r.Value) != `"plain text"` {
+		t.Errorf("second record = %+v", r)
+	}
+}
@@ -0,0 +1,77 @@
+package kafka
+
+import "sync/atomic"
+
+// Broker event kinds, as counted by BrokerEvents.
+const (
+	// EventBrokerDown is a lost or failed connection to one broker.
+	EventBrokerDown = "broker_down"
+	// EventAllBrokersDown means no broker is reachable.
+	EventAllBrokersDown = "all_brokers_down"
+	// EventBrokersUp is the first successful delivery or metadata request
+	// after a broker went down.
+	EventBrokersUp = "brokers_up"
+	// EventAuthFailure is a failed SASL authentication or a request the
+	// cluster refused for lack of authorization.
+	EventAuthFailure = "auth_failure"
+	// EventError is any other client error librdkafka reports.
+	EventError = "error"
+)
+
+// BrokerEvents counts the connection lifecycle events of one or more
+// producers, so broker-side trouble shows up in metrics rather than only as
+// failed produces. It also keeps the number of brokers in the latest
+// cluster metadata a producer fetched. The zero value is ready to use; a
+// nil *BrokerEvents counts nothing.
+type BrokerEvents struct {
+	brokerDown     atomic.Int64
+	allBrokersDown atomic.Int64
+	brokersUp      atomic.Int64
+	authFailure    atomic.Int64
+	other          atomic.Int64
+
+	brokers atomic.Int64 // plus one, so zero means no metadata yet
+}
+
+func (e *BrokerEvents) record(kind string) {
+	if e == nil {
+		return
+	}
+	switch kind {
+	case EventBrokerDown:
+		e.brokerDown.Add(1)
+	case EventAllBrokersDown:
+		e.allBrokersDown.Add(1)
+	case EventBrokersUp:
+		e.brokersUp.Add(1)
+	case EventAuthFailure:
+		e.authFailure.Add(1)
+	default:
+		e.other.Add(1)
+	}
+}
+
+// sawBrokers records the number of brokers in fetched cluster metadata.
+func (e *BrokerEvents) sawBrokers(n int) {
+	if e != nil {
+		e.brokers.Store(int64(n) + 1)
+	}
+}
+
+// Brokers returns the number of brokers in the latest cluster metadata,
+// and false until a producer has fetched some.
+func (e *BrokerEvents) Brokers() (int, bool) {
+	n := e.brokers.Load()
+	return int(n - 1), n > 0
+}
+
+// Snapshot returns the count of each event kind.
+func (e *BrokerEvents) Snapshot() map[string]int64 {
+	return map[string]int64{
+		EventBrokerDown:     e.brokerDown.Load(),
+		EventAllBrokersDown: e.allBrokersDown.Load(),
+		EventBrokersUp:      e.brokersUp.Load(),
+		EventAuthFailure:    e.authFailure.Load(),
+		EventError:          e.other.Load(),
+	}
+}
@@ -0,0 +1,48 @@
+package kafka
+
+import "testing"
+
+func TestBrokerEvents(t *testing.T) {
+	var e BrokerEvents
+	e.record(EventBrokerDown)
+	e.record(EventBrokerDown)
+	e.record(EventAllBrokersDown)
+	e.record(EventBrokersUp)
+	e.record(EventAuthFailure)
+	e.record("fatal")
+
+	want := map[string]int64{
+		EventBrokerDown:     2,
+		EventAllBrokersDown: 1,
+		EventBrokersUp:      1,
+		EventAuthFailure:    1,
+		EventError:          1,
+	}
+	got := e.Snapshot()
+	for kind, n := range want {
+		if got[kind] != n {
+			t.Errorf("%s = %d, want %d", kind, got[kind], n)
+		}
+	}
+
+	var nilEvents *BrokerEvents
+	nilEvents.record(EventBrokerDown) // must not panic
+}
+
+func TestBrokerEvents_Brokers(t *testing.T) {
+	var e BrokerEvents
+	if _, ok := e.Brokers(); ok {
+		t.Error("Brokers() reported a count before any metadata")
+	}
+	e.sawBrokers(0)
+	if n, ok := e.Brokers(); !ok || n != 0 {
+		t.Errorf("Brokers() = %d, %v, want 0, true", n, ok)
+	}
+	e.sawBrokers(3)
+	if n, ok := e.Brokers(); !ok || n != 3 {
+		t.Errorf("Brokers() = %d, %v, want 3, true", n, ok)
+	}
+
+	var nilEvents *BrokerEvents
+	nilEvents.sawBrokers(1) // must not panic
+}
@@ -0,0 +1,90 @@
+//go:build cgo
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// LagReader reads consumer group lag from the brokers: the committed
+// offsets of a group through the admin API, and each partition's high
+// watermark. It is a lag.Source.
+type LagReader struct {
+	handle *kafka.Producer // only used for metadata and watermarks
+	admin  *kafka.AdminClient
+}
+
+// NewLagReader connects a LagReader with the connection settings of
+// configMap.
+func NewLagReader(configMap map[string]any) (*LagReader, error) {
+	cm := connectionConfig(configMap)
+	handle, err := kafka.NewProducer(&cm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lag client: %w", err)
+	}
+	admin, err := kafka.NewAdminClientFromProducer(handle)
+	if err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("failed to create admin client: %w", err)
+	}
+	return &LagReader{handle: handle, admin: admin}, nil
+}
+
+// Lag returns the sum over topic's partitions of the high watermark minus
+// group's committed offset. Partitions the group has committed nothing on
+// count as caught up: a group that has never consumed a topic, or starts
+// from the latest offset, has no backlog to protect.
+func (r *LagReader) Lag(ctx context.Context, group, topic string) (int64, error) {
+	timeoutMs := 10000
+	if deadline, ok := ctx.Deadline(); ok {
+		timeoutMs = max(int(time.Until(deadline).Milliseconds()), 1)
+	}
+	md, err := r.admin.GetMetadata(&topic, false, timeoutMs)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read metadata of %s: %w", topic, err)
+	}
+	tm, ok := md.Topics[topic]
+	if !ok || tm.Error.Code() != kafka.ErrNoError {
+		return 0, fmt.Errorf("failed to read metadata of %s: %v", topic, tm.Error)
+	}
+
+	partitions := make([]kafka.TopicPartition, len(tm.Partitions))
+	for i, p := range tm.Partitions {
+		partitions[i] = kafka.TopicPartition{Topic: &topic, Partition: p.ID}
+	}
+	res, err := r.admin.ListConsumerGroupOffsets(ctx, []kafka.ConsumerGroupTopicPartitions{{Group: group, Partitions: partitions}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to list offsets of group %s: %w", group, err)
+	}
+	if len(res.ConsumerGroupsTopicPartitions) != 1 {
+		return 0, fmt.Errorf("failed to list offsets of group %s: no result", group)
+	}
+
+	var lag int64
+	for _, tp := range res.ConsumerGroupsTopicPartitions[0].Partitions {
+		if tp.Error != nil {
+			return 0, fmt.Errorf("failed to list offsets of group %s on %s[%d]: %w", group, topic, tp.Partition, tp.Error)
+		}
+		if tp.Offset < 0 {
+			continue
+		}
+		_, high, err := r.handle.QueryWatermarkOffsets(topic, tp.Partition, timeoutMs)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read watermarks of %s[%d]: %w", topic, tp.Partition, err)
+		}
+		if n := high - int64(tp.Offset); n > 0 {
+			lag += n
+		}
+	}
+	return lag, nil
+}
+
+// Close releases the reader's connections.
+func (r *LagReader) Close() {
+	r.admin.Close()
+	r.handle.Close()
+}
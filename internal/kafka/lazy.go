@@ -0,0 +1,160 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Default backoff between producer creation attempts.
+const (
+	DefaultConnectMinBackoff = time.Second
+	DefaultConnectMaxBackoff = 30 * time.Second
+)
+
+// ErrNotReady is returned by Lazy.Produce while the producer it wraps is
+// still being created. No message was sent; the caller can retry later.
+var ErrNotReady error = notReadyError{}
+
+type notReadyError struct{}
+
+func (notReadyError) Error() string { return "producer is not ready yet" }
+
+// Unavailable marks the error as temporary, so the server answers 503
+// instead of reporting a produce failure.
+func (notReadyError) Unavailable() bool { return true }
+
+// ConnectConfig configures Connect and NewLazy.
+type ConnectConfig struct {
+	// Connect creates the producer. It is called until it succeeds.
+	Connect func() (Client, error)
+
+	// MinBackoff and MaxBackoff bound the wait between failed attempts,
+	// which doubles after each one. Zero means the defaults above.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+
+	Logger *zap.Logger
+}
+
+func (cfg ConnectConfig) withDefaults() ConnectConfig {
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = DefaultConnectMinBackoff
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = max(DefaultConnectMaxBackoff, cfg.MinBackoff)
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	return cfg
+}
+
+// Connect calls cfg.Connect until it succeeds, logging each failure and
+// backing off between attempts. Once ctx ends it gives up and returns the
+// last error.
+func Connect(ctx context.Context, cfg ConnectConfig) (Client, error) {
+	cfg = cfg.withDefaults()
+	backoff := cfg.MinBackoff
+	for attempt := 1; ; attempt++ {
+		c, err := cfg.Connect()
+		if err == nil {
+			if attempt > 1 {
+				cfg.Logger.Info("producer created", zap.Int("attempt", attempt))
+			}
+			return c, nil
+		}
+		cfg.Logger.Warn("failed to create producer, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("gave up after %d attempts: %w", attempt, err)
+		case <-t.C:
+		}
+		backoff = min(2*backoff, cfg.MaxBackoff)
+	}
+}
+
+// Lazy is a Client whose producer is created in the background, so the
+// process can start serving while its broker is still coming up. Until the
+// producer exists Produce returns ErrNotReady and IsConnected is false.
+type Lazy struct {
+	client atomic.Pointer[Client]
+
+	cfg    ConnectConfig
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewLazy starts creating the producer and returns immediately.
+func NewLazy(cfg ConnectConfig) *Lazy {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Lazy{cfg: cfg.withDefaults(), cancel: cancel, done: make(chan struct{})}
+	go l.connect(ctx)
+	return l
+}
+
+func (l *Lazy) connect(ctx context.Context) {
+	defer close(l.done)
+
+	c, err := Connect(ctx, l.cfg)
+	if err != nil {
+		return // closed before the producer could be created
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		c.Close()
+		return
+	}
+	l.client.Store(&c)
+}
+
+// Ready reports whether the producer has been created.
+func (l *Lazy) Ready() bool {
+	return l.client.Load() != nil
+}
+
+// Produce sends the message once the producer exists and returns ErrNotReady
+// before then.
+func (l *Lazy) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	c := l.client.Load()
+	if c == nil {
+		return ErrNotReady
+	}
+	return (*c).Produce(ctx, topic, key, value, headers)
+}
+
+// IsConnected is false until the producer exists, then reports its state.
+func (l *Lazy) IsConnected() bool {
+	c := l.client.Load()
+	return c != nil && (*c).IsConnected()
+}
+
+// Close stops any further attempts, waiting for one in progress, and closes
+// the producer if it was created.
+func (l *Lazy) Close() {
+	l.mu.Lock()
+	l.closed = true
+	l.mu.Unlock()
+	l.cancel()
+	<-l.done
+
+	if c := l.client.Load(); c != nil {
+		(*c).Close()
+	}
+}
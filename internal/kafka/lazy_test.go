@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// closeCounter is a connected Client that counts Close calls.
+type closeCounter struct {
+	fakeMember
+	closed atomic.Int32
+}
+
+func (c *closeCounter) Close() { c.closed.Add(1) }
+
+func TestLazy_RetriesUntilConnected(t *testing.T) {
+	var attempts atomic.Int32
+	member := &closeCounter{fakeMember: fakeMember{connected: true}}
+	l := NewLazy(ConnectConfig{
+		Connect: func() (Client, error) {
+			if attempts.Add(1) < 3 {
+				return nil, errors.New("broker not reachable")
+			}
+			return member, nil
+		},
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 2 * time.Millisecond,
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !l.Ready() {
+		if time.Now().After(deadline) {
+			t.Fatalf("not ready after %d attempts", attempts.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if !l.IsConnected() {
+		t.Error("IsConnected() = false once ready")
+	}
+	if err := l.Produce(context.Background(), "events", []byte("k"), []byte("v"), nil); err != nil {
+		t.Errorf("Produce() error = %v", err)
+	}
+	if member.produced != 1 {
+		t.Errorf("produced = %d, want 1", member.produced)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+
+	l.Close()
+	if got := member.closed.Load(); got != 1 {
+		t.Errorf("Close() closed the producer %d times, want 1", got)
+	}
+}
+
+func TestLazy_NotReady(t *testing.T) {
+	l := NewLazy(ConnectConfig{
+		Connect:    func() (Client, error) { return nil, errors.New("broker not reachable") },
+		MinBackoff: time.Hour,
+	})
+
+	err := l.Produce(context.Background(), "events", nil, []byte("v"), nil)
+	if !errors.Is(err, ErrNotReady) {
+		t.Errorf("Produce() error = %v, want ErrNotReady", err)
+	}
+	var u interface{ Unavailable() bool }
+	if !errors.As(err, &u) || !u.Unavailable() {
+		t.Error("ErrNotReady does not report Unavailable")
+	}
+	if l.IsConnected() {
+		t.Error("IsConnected() = true before the producer exists")
+	}
+
+	// Close must not wait out the backoff.
+	closed := make(chan struct{})
+	go func() {
+		l.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close() blocked while waiting to retry")
+	}
+}
+
+func TestConnect_GivesUpWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	var attempts atomic.Int32
+	_, err := Connect(ctx, ConnectConfig{
+		Connect: func() (Client, error) {
+			attempts.Add(1)
+			return nil, errors.New("no such host")
+		},
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 4 * time.Millisecond,
+	})
+	if err == nil || !strings.Contains(err.Error(), "no such host") {
+		t.Fatalf("Connect() error = %v, want the last attempt's error", err)
+	}
+	if attempts.Load() < 2 {
+		t.Errorf("attempts = %d, want retries before giving up", attempts.Load())
+	}
+}
@@ -0,0 +1,658 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/delivery"
+	"github.com/kahook/internal/spool"
+)
+
+// Settings of the native client that have no ConfigMap key, and defaults
+// for those that do, matching librdkafka's.
+const (
+	nativeClientID         = "kahook"
+	nativeKeepAlive        = 15 * time.Second
+	nativeConnectedTimeout = 3 * time.Second
+	defaultLinger          = 5 * time.Millisecond
+	defaultMessageMaxBytes = 1000000
+	defaultRequestTimeout  = 30 * time.Second
+	defaultMessageTimeout  = 5 * time.Minute
+	defaultMetadataMaxAge  = 15 * time.Minute
+	defaultProduceRetries  = 2147483647
+)
+
+// SASL mechanisms the native client supports.
+const (
+	saslPlain       = "PLAIN"
+	saslScramSHA256 = "SCRAM-SHA-256"
+	saslScramSHA512 = "SCRAM-SHA-512"
+)
+
+// nativeOptions are the ConfigMap settings the native client understands.
+type nativeOptions struct {
+	bootstrap          []string
+	clientID           string
+	acks               kgo.Acks
+	acksNone           bool
+	retries            int
+	idempotent         bool
+	maxInFlight        int // zero keeps franz-go's default
+	compression        string
+	tls                bool
+	saslMechanism      string
+	saslUsername       string
+	saslPassword       string
+	transactionalID    string
+	transactionTimeout time.Duration
+	requestTimeout     time.Duration
+	messageTimeout     time.Duration
+	metadataMaxAge     time.Duration
+	linger             time.Duration
+	maxIdle            time.Duration // zero keeps idle connections open
+	keepAlive          time.Duration
+	maxMessageBytes    int
+}
+
+// nativeOptionsFrom reads cm, which holds librdkafka settings as built by
+// the config package. Settings the native client cannot honour, such as
+// OAUTHBEARER, are errors rather than being silently dropped; settings it
+// has no use for are ignored.
+func nativeOptionsFrom(cm map[string]any) (nativeOptions, error) {
+	opts := nativeOptions{
+		clientID:        nativeClientID,
+		acks:            kgo.AllISRAcks(),
+		retries:         defaultProduceRetries,
+		requestTimeout:  defaultRequestTimeout,
+		messageTimeout:  defaultMessageTimeout,
+		metadataMaxAge:  defaultMetadataMaxAge,
+		linger:          defaultLinger,
+		maxMessageBytes: defaultMessageMaxBytes,
+	}
+	var err error
+	setting := func(key string) string {
+		if v, ok := cm[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+	number := func(key string) (int, bool) {
+		v := setting(key)
+		if v == "" || err != nil {
+			return 0, false
+		}
+		n, perr := strconv.Atoi(v)
+		if perr != nil || n < 0 {
+			err = fmt.Errorf("invalid %s %q", key, v)
+			return 0, false
+		}
+		return n, true
+	}
+	millis := func(key string, dst *time.Duration) {
+		if ms, ok := number(key); ok {
+			*dst = time.Duration(ms) * time.Millisecond
+		}
+	}
+
+	for _, b := range strings.Split(setting("bootstrap.servers"), ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			opts.bootstrap = append(opts.bootstrap, b)
+		}
+	}
+	if len(opts.bootstrap) == 0 {
+		return opts, errors.New("bootstrap.servers is required")
+	}
+	if v := setting("client.id"); v != "" {
+		opts.clientID = v
+	}
+
+	switch v := strings.ToLower(setting("acks")); v {
+	case "", "all", "-1":
+	case "1":
+		opts.acks = kgo.LeaderAck()
+	case "0":
+		opts.acks, opts.acksNone = kgo.NoAck(), true
+	default:
+		return opts, fmt.Errorf("unsupported acks %q", v)
+	}
+	if n, ok := number("retries"); ok {
+		opts.retries = n
+	}
+	if n, ok := number("max.in.flight.requests.per.connection"); ok {
+		opts.maxInFlight = n
+	}
+
+	opts.compression = strings.ToLower(setting("compression.type"))
+	if _, ok := nativeCodec(opts.compression); !ok {
+		return opts, fmt.Errorf("unsupported compression.type %q", opts.compression)
+	}
+
+	switch v := strings.ToUpper(setting("security.protocol")); v {
+	case "", "PLAINTEXT":
+	case "SSL":
+		opts.tls = true
+	case "SASL_PLAINTEXT", "SASL_SSL":
+		opts.tls = v == "SASL_SSL"
+		opts.saslMechanism = strings.ToUpper(setting("sasl.mechanism"))
+		if opts.saslMechanism == "" {
+			opts.saslMechanism = saslPlain
+		}
+		switch opts.saslMechanism {
+		case saslPlain, saslScramSHA256, saslScramSHA512:
+		default:
+			return opts, fmt.Errorf("sasl.mechanism %q is not supported by the native client", opts.saslMechanism)
+		}
+		opts.saslUsername = setting("sasl.username")
+		opts.saslPassword = setting("sasl.password")
+	default:
+		return opts, fmt.Errorf("unsupported security.protocol %q", v)
+	}
+
+	opts.transactionalID = transactionalID(cm)
+	opts.idempotent = setting("enable.idempotence") == "true" || opts.transactionalID != ""
+	if opts.idempotent && opts.acks != kgo.AllISRAcks() {
+		return opts, errors.New("enable.idempotence requires acks=all")
+	}
+
+	millis(transactionTimeoutKey, &opts.transactionTimeout)
+	millis("request.timeout.ms", &opts.requestTimeout)
+	millis("message.timeout.ms", &opts.messageTimeout)
+	millis("metadata.max.age.ms", &opts.metadataMaxAge)
+	millis("linger.ms", &opts.linger)
+	millis("connections.max.idle.ms", &opts.maxIdle)
+	if n, ok := number("message.max.bytes"); ok {
+		opts.maxMessageBytes = n
+	}
+	if err != nil {
+		return opts, err
+	}
+	if setting("socket.keepalive.enable") == "true" {
+		opts.keepAlive = nativeKeepAlive
+	} else {
+		opts.keepAlive = -1
+	}
+	return opts, nil
+}
+
+// nativeCodec returns the franz-go codec for a librdkafka compression.type.
+func nativeCodec(name string) (kgo.CompressionCodec, bool) {
+	switch name {
+	case "", "none":
+		return kgo.NoCompression(), true
+	case "gzip":
+		return kgo.GzipCompression(), true
+	case "snappy":
+		return kgo.SnappyCompression(), true
+	case "lz4":
+		return kgo.Lz4Compression(), true
+	case "zstd":
+		return kgo.ZstdCompression(), true
+	}
+	return kgo.CompressionCodec{}, false
+}
+
+// connectionOpts returns the franz-go options that connect to the cluster
+// as the configured principal, shared by producers and the clients that
+// consume or administer topics.
+func (o nativeOptions) connectionOpts() []kgo.Opt {
+	dialer := &net.Dialer{Timeout: o.requestTimeout, KeepAlive: o.keepAlive}
+	dial := dialer.DialContext
+	if o.tls {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{MinVersion: tls.VersionTLS12}}
+		dial = tlsDialer.DialContext
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(o.bootstrap...),
+		kgo.ClientID(o.clientID),
+		kgo.Dialer(dial),
+		kgo.RequestTimeoutOverhead(o.requestTimeout),
+		kgo.MetadataMaxAge(o.metadataMaxAge),
+	}
+	if o.maxIdle > 0 {
+		opts = append(opts, kgo.ConnIdleTimeout(o.maxIdle))
+	}
+	if m := o.sasl(); m != nil {
+		opts = append(opts, kgo.SASL(m))
+	}
+	return opts
+}
+
+func (o nativeOptions) sasl() sasl.Mechanism {
+	switch o.saslMechanism {
+	case saslPlain:
+		return plain.Auth{User: o.saslUsername, Pass: o.saslPassword}.AsMechanism()
+	case saslScramSHA256:
+		return scram.Auth{User: o.saslUsername, Pass: o.saslPassword}.AsSha256Mechanism()
+	case saslScramSHA512:
+		return scram.Auth{User: o.saslUsername, Pass: o.saslPassword}.AsSha512Mechanism()
+	}
+	return nil
+}
+
+// producerOpts returns the franz-go options of a producer: the connection
+// options plus acks, retries, compression, batching, idempotence, and
+// transactions.
+func (o nativeOptions) producerOpts(roundRobin []string) []kgo.Opt {
+	codec, _ := nativeCodec(o.compression)
+	opts := append(o.connectionOpts(),
+		kgo.RequiredAcks(o.acks),
+		kgo.RecordRetries(o.retries),
+		kgo.RecordDeliveryTimeout(o.messageTimeout),
+		kgo.ProduceRequestTimeout(o.requestTimeout),
+		kgo.ProducerBatchCompression(codec),
+		kgo.ProducerBatchMaxBytes(int32(o.maxMessageBytes)),
+		kgo.ProducerLinger(o.linger),
+		kgo.RecordPartitioner(newNativePartitioner(roundRobin)),
+	)
+	if !o.idempotent {
+		opts = append(opts, kgo.DisableIdempotentWrite())
+		if o.maxInFlight > 0 {
+			opts = append(opts, kgo.MaxProduceRequestsInflightPerBroker(o.maxInFlight))
+		}
+	}
+	if o.transactionalID != "" {
+		opts = append(opts, kgo.TransactionalID(o.transactionalID))
+		if o.transactionTimeout > 0 {
+			opts = append(opts, kgo.TransactionTimeout(o.transactionTimeout))
+		}
+	}
+	return opts
+}
+
+// nativePartitioner places keyed messages on the partition librdkafka's
+// default consistent_random partitioner would pick, the CRC32 of the key
+// modulo the partition count, so switching clients keeps each key on its
+// partition. Keyless messages stick to one partition per batch, as with
+// librdkafka, except on round-robin topics, where they take turns.
+type nativePartitioner struct {
+	keyed      kgo.Partitioner
+	roundRobin map[string]bool
+}
+
+func newNativePartitioner(roundRobin []string) kgo.Partitioner {
+	p := nativePartitioner{
+		keyed: kgo.StickyKeyPartitioner(func(key []byte, n int) int {
+			return int(crc32.ChecksumIEEE(key) % uint32(n))
+		}),
+		roundRobin: make(map[string]bool, len(roundRobin)),
+	}
+	for _, t := range roundRobin {
+		p.roundRobin[t] = true
+	}
+	return p
+}
+
+func (p nativePartitioner) ForTopic(topic string) kgo.TopicPartitioner {
+	keyed := p.keyed.ForTopic(topic)
+	if !p.roundRobin[topic] {
+		return keyed
+	}
+	return &roundRobinPartitioner{keyed: keyed}
+}
+
+// roundRobinPartitioner cycles keyless messages over a topic's partitions.
+// franz-go calls a topic partitioner from one goroutine at a time.
+type roundRobinPartitioner struct {
+	keyed kgo.TopicPartitioner
+	next  int
+}
+
+func (p *roundRobinPartitioner) RequiresConsistency(r *kgo.Record) bool { return r.Key != nil }
+
+func (p *roundRobinPartitioner) Partition(r *kgo.Record, n int) int {
+	if r.Key != nil {
+		return p.keyed.Partition(r, n)
+	}
+	p.next = (p.next + 1) % n
+	return p.next
+}
+
+// NativeProducer is a pure-Go Kafka producer, for binaries built without
+// cgo, on franz-go. It reads the same ConfigMap as Producer: acks, retries,
+// every compression codec, idempotence, transactions, and SASL PLAIN or
+// SCRAM over plaintext or TLS.
+type NativeProducer struct {
+	client *kgo.Client
+	opts   nativeOptions
+	logger *zap.Logger
+	events *BrokerEvents
+	down   atomic.Bool // a broker went down and nothing has succeeded since
+	txn    *nativeTransactions
+
+	flushTimeout time.Duration
+	spill        *spool.Spool // nil drops undelivered messages
+
+	mu        sync.Mutex
+	closed    bool // no new messages are accepted
+	pending   int
+	unflushed []*kgo.Record // failed by the client closing
+
+	unfinished sync.WaitGroup // one per pending record
+}
+
+// NewNativeProducer creates a native producer from cfg. It connects to the
+// brokers lazily, on the first Produce or IsConnected, unless the producer
+// is transactional: then it registers its transactional ID first.
+func NewNativeProducer(cfg ProducerConfig) (*NativeProducer, error) {
+	opts, err := nativeOptionsFrom(cfg.ConfigMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
+	}
+	p := &NativeProducer{
+		opts:         opts,
+		logger:       cfg.Logger,
+		events:       cfg.Events,
+		flushTimeout: cfg.FlushTimeout,
+		spill:        cfg.Spill,
+	}
+	if p.logger == nil {
+		p.logger = zap.NewNop()
+	}
+	if p.flushTimeout <= 0 {
+		p.flushTimeout = DefaultFlushTimeout
+	}
+	kopts := append(opts.producerOpts(cfg.RoundRobinTopics),
+		kgo.WithHooks(nativeHooks{p}),
+		kgo.WithLogger(nativeLogger{logger: p.logger, authFailed: p.authFailed}),
+	)
+	if p.client, err = kgo.NewClient(kopts...); err != nil {
+		return nil, fmt.Errorf("failed to create kafka producer: %w", err)
+	}
+	if opts.transactionalID != "" {
+		if p.txn, err = initNativeTransactions(p, cfg.TransactionMaxMessages, cfg.TransactionTimeout); err != nil {
+			p.client.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Produce sends a message to the specified topic and waits for delivery
+// confirmation or context cancellation. The partition and offset it was
+// written to are recorded in ctx's delivery.Recorder, if it has one, unless
+// acks is 0. The message stays pending until delivered or failed, even if
+// ctx ends first, so Close knows what is still undelivered. The record
+// holds copies of key and value, since the caller may reuse them once
+// Produce returns.
+func (p *NativeProducer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	rec := &kgo.Record{
+		Topic:     topic,
+		Key:       bytes.Clone(key),
+		Value:     bytes.Clone(value),
+		Headers:   sortedHeaders(headers),
+		Timestamp: time.Now(),
+	}
+	var err error
+	if p.txn != nil {
+		rec, err = p.txn.deliver(ctx, rec)
+	} else {
+		rec, err = p.deliver(ctx, rec)
+	}
+	if err != nil {
+		debugDelivery(ctx, p.logger, topic, -1, -1, err)
+		return err
+	}
+	debugDelivery(ctx, p.logger, topic, rec.Partition, rec.Offset, nil)
+	if !p.opts.acksNone {
+		delivery.Record(ctx, delivery.Report{
+			Partition: rec.Partition,
+			Offset:    rec.Offset,
+			Timestamp: rec.Timestamp,
+		})
+	}
+	return nil
+}
+
+// deliver produces rec and waits for its delivery report or for ctx to
+// end, and returns rec as delivered.
+func (p *NativeProducer) deliver(ctx context.Context, rec *kgo.Record) (*kgo.Record, error) {
+	result, err := p.send(ctx, rec)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-result:
+		if err != nil {
+			return nil, fmt.Errorf("message delivery failed: %w", err)
+		}
+		return rec, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("produce cancelled: %w", ctx.Err())
+	}
+}
+
+// send hands rec to the client and returns the channel its outcome is
+// reported on. rec stays tied to ctx while it is buffered: if ctx ends,
+// the client may fail it, unless an idempotent request carrying it is
+// already in flight. The outcome is reported on the channel either way.
+func (p *NativeProducer) send(ctx context.Context, rec *kgo.Record) (<-chan error, error) {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("failed to produce message: %w", errProducerClosed)
+	}
+	p.pending++
+	p.unfinished.Add(1)
+	p.mu.Unlock()
+
+	result := make(chan error, 1)
+	p.client.Produce(ctx, rec, func(rec *kgo.Record, err error) {
+		result <- p.finish(rec, err)
+	})
+	return result, nil
+}
+
+// finish accounts for the outcome of one record and returns its error as
+// Produce reports it.
+func (p *NativeProducer) finish(rec *kgo.Record, err error) error {
+	defer p.unfinished.Done()
+	p.mu.Lock()
+	p.pending--
+	if errors.Is(err, kgo.ErrClientClosed) {
+		p.unflushed = append(p.unflushed, rec)
+		err = errProducerClosed
+	}
+	p.mu.Unlock()
+	if err != nil {
+		if authFailure(err) {
+			p.authFailed(err)
+		}
+		return nativeError{err}
+	}
+	p.brokersUp()
+	return nil
+}
+
+// sortedHeaders returns headers as record headers, sorted by key so a
+// message's encoding does not depend on map order.
+func sortedHeaders(headers map[string]string) []kgo.RecordHeader {
+	if len(headers) == 0 {
+		return nil
+	}
+	out := make([]kgo.RecordHeader, 0, len(headers))
+	for k, v := range headers {
+		out = append(out, kgo.RecordHeader{Key: k, Value: []byte(v)})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// nativeError is a franz-go error that reports, like librdkafkaError,
+// whether the topic was the problem.
+type nativeError struct {
+	err error
+}
+
+func (e nativeError) Error() string { return e.err.Error() }
+func (e nativeError) Unwrap() error { return e.err }
+
+// TopicAuthorizationFailed marks a produce refused because the client may
+// not write to the topic.
+func (e nativeError) TopicAuthorizationFailed() bool {
+	return errors.Is(e.err, kerr.TopicAuthorizationFailed)
+}
+
+// UnknownTopic marks a produce to a topic the cluster does not have.
+func (e nativeError) UnknownTopic() bool {
+	return errors.Is(e.err, kerr.UnknownTopicOrPartition)
+}
+
+// authFailure reports whether err is a failed SASL authentication or a
+// request refused for lack of authorization.
+func authFailure(err error) bool {
+	for _, e := range []error{
+		kerr.SaslAuthenticationFailed,
+		kerr.TopicAuthorizationFailed,
+		kerr.ClusterAuthorizationFailed,
+		kerr.TransactionalIDAuthorizationFailed,
+	} {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *NativeProducer) authFailed(err error) {
+	p.events.record(EventAuthFailure)
+	p.logger.Error("kafka authentication or authorization failed", zap.String("event", EventAuthFailure), zap.Error(err))
+}
+
+// brokersUp records that a broker answered after one went down.
+func (p *NativeProducer) brokersUp() {
+	if p.down.CompareAndSwap(true, false) {
+		p.events.record(EventBrokersUp)
+		p.logger.Info("kafka brokers reachable again", zap.String("event", EventBrokersUp))
+	}
+}
+
+// IsConnected fetches broker metadata, with a 3-second timeout so that the
+// /ready probe fails quickly when Kafka is unavailable.
+func (p *NativeProducer) IsConnected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), nativeConnectedTimeout)
+	defer cancel()
+	resp, err := kmsg.NewPtrMetadataRequest().RequestWith(ctx, p.client)
+	if err != nil {
+		if authFailure(err) {
+			p.authFailed(err)
+			return false
+		}
+		p.down.Store(true)
+		p.events.record(EventAllBrokersDown)
+		p.logger.Error("all kafka brokers are down", zap.String("event", EventAllBrokersDown), zap.Error(err))
+		return false
+	}
+	p.events.sawBrokers(len(resp.Brokers))
+	p.brokersUp()
+	return true
+}
+
+// Close waits up to the flush timeout for pending messages to be
+// delivered, then closes the client. Messages still undelivered are
+// written to the spill directory, if one is set, and are otherwise lost;
+// either way their number is logged.
+func (p *NativeProducer) Close() {
+	if p.txn != nil {
+		p.txn.close()
+	}
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.closed = true
+	r := drainReport{pending: p.pending}
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.flushTimeout)
+	_ = p.client.Flush(ctx)
+	cancel()
+	p.client.Close()
+	p.unfinished.Wait()
+
+	msgs := make([]spilledMessage, 0, len(p.unflushed))
+	for _, rec := range p.unflushed {
+		msgs = append(msgs, spilledRecord(rec))
+	}
+	r.unflushed = len(msgs)
+	if p.spill != nil && len(msgs) > 0 {
+		r.spillFile, r.spilled, r.spillErr = spill(p.spill, msgs)
+	}
+	logDrain(p.logger, r, p.flushTimeout, p.spill)
+}
+
+func spilledRecord(rec *kgo.Record) spilledMessage {
+	s := spilledMessage{topic: rec.Topic, key: rec.Key, value: rec.Value}
+	if len(rec.Headers) > 0 {
+		s.headers = make(map[string]string, len(rec.Headers))
+		for _, h := range rec.Headers {
+			s.headers[h.Key] = string(h.Value)
+		}
+	}
+	return s
+}
+
+// nativeHooks counts failed broker connections as BrokerEvents.
+type nativeHooks struct {
+	p *NativeProducer
+}
+
+var _ kgo.HookBrokerConnect = nativeHooks{}
+
+func (h nativeHooks) OnBrokerConnect(meta kgo.BrokerMetadata, _ time.Duration, _ net.Conn, err error) {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, kgo.ErrClientClosed) {
+		return
+	}
+	h.p.down.Store(true)
+	h.p.events.record(EventBrokerDown)
+	h.p.logger.Warn("kafka broker connection failed",
+		zap.String("event", EventBrokerDown),
+		zap.String("broker", net.JoinHostPort(meta.Host, strconv.Itoa(int(meta.Port)))),
+		zap.Error(err))
+}
+
+// nativeLogger passes franz-go's warnings and errors to zap. Its info and
+// debug logs are per-request chatter. A failed SASL handshake only shows
+// up here, as franz-go retries the request it was connecting for, so
+// errors logged with an authentication failure are also passed to
+// authFailed, if set.
+type nativeLogger struct {
+	logger     *zap.Logger
+	authFailed func(error)
+}
+
+func (l nativeLogger) Level() kgo.LogLevel { return kgo.LogLevelWarn }
+
+func (l nativeLogger) Log(level kgo.LogLevel, msg string, keyvals ...any) {
+	fields := make([]zap.Field, 0, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		fields = append(fields, zap.Any(fmt.Sprint(keyvals[i]), keyvals[i+1]))
+		if err, ok := keyvals[i+1].(error); ok && l.authFailed != nil && authFailure(err) {
+			l.authFailed(err)
+		}
+	}
+	if level == kgo.LogLevelError {
+		l.logger.Error("kafka client: "+msg, fields...)
+		return
+	}
+	l.logger.Warn("kafka client: "+msg, fields...)
+}
@@ -0,0 +1,283 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"go.uber.org/zap"
+)
+
+// The native client's counterparts of the checks that consume or
+// administer topics: Verifier, BrokerClock, LagReader, and
+// CheckWritePermissions. They connect with the same settings, and so as
+// the same principal, as the native producer.
+
+// nativeAuthorizedOperationsUnknown is the AuthorizedOperations value of a
+// broker that did not report them.
+const nativeAuthorizedOperationsUnknown = -2147483648
+
+// NativeVerifier is Verifier for the native client.
+type NativeVerifier struct {
+	producer *NativeProducer
+	opts     nativeOptions
+	topic    string
+	logger   *zap.Logger
+}
+
+// NewNativeVerifier creates a NativeVerifier with its own producer.
+func NewNativeVerifier(cfg VerifierConfig) (*NativeVerifier, error) {
+	producer, err := NewNativeProducer(ProducerConfig{ConfigMap: withoutTransactions(cfg.ConfigMap), Logger: cfg.Logger})
+	if err != nil {
+		return nil, err
+	}
+	return &NativeVerifier{producer: producer, opts: producer.opts, topic: cfg.Topic, logger: producer.logger}, nil
+}
+
+// Verify produces a probe to the verification topic and consumes it back
+// from the offset the broker reported, returning the produce latency and
+// the full round-trip time. It fails if either step fails or ctx expires
+// first.
+func (v *NativeVerifier) Verify(ctx context.Context) (produce, roundTrip time.Duration, err error) {
+	start := time.Now()
+	probe := []byte(uuid.NewString())
+	rec, err := v.producer.deliver(ctx, &kgo.Record{
+		Topic:     v.topic,
+		Key:       probe,
+		Value:     []byte(fmt.Sprintf(`{"kahook_probe":%q}`, probe)),
+		Timestamp: start,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("produce to %s: %w", v.topic, err)
+	}
+	produce = time.Since(start)
+	if _, err := readBack(ctx, v.opts, v.logger, rec); err != nil {
+		return produce, 0, fmt.Errorf("consume from %s: %w", v.topic, err)
+	}
+	return produce, time.Since(start), nil
+}
+
+// Close closes the verification producer.
+func (v *NativeVerifier) Close() {
+	v.producer.Close()
+}
+
+// readBack consumes the partition rec was delivered to from its offset
+// until it finds rec's key, and returns the record as stored.
+func readBack(ctx context.Context, opts nativeOptions, logger *zap.Logger, rec *kgo.Record) (*kgo.Record, error) {
+	client, err := kgo.NewClient(append(opts.connectionOpts(),
+		kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{
+			rec.Topic: {rec.Partition: kgo.NewOffset().At(rec.Offset)},
+		}),
+		kgo.WithLogger(nativeLogger{logger: logger}),
+	)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consumer: %w", err)
+	}
+	defer client.Close()
+	for {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			return nil, fmt.Errorf("probe not read back: %w", err)
+		}
+		for _, fe := range fetches.Errors() {
+			// Authorization errors will not clear up by polling again;
+			// transient ones are retried until ctx expires.
+			if authFailure(fe.Err) {
+				return nil, fe.Err
+			}
+			logger.Debug("verification consumer error", zap.Error(fe.Err))
+		}
+		var found *kgo.Record
+		fetches.EachRecord(func(r *kgo.Record) {
+			if found == nil && bytes.Equal(r.Key, rec.Key) {
+				found = r
+			}
+		})
+		if found != nil {
+			return found, nil
+		}
+	}
+}
+
+// NativeBrokerClock is BrokerClock for the native client. The produce
+// response does not carry the append time, so it reads the probe back.
+type NativeBrokerClock struct {
+	producer *NativeProducer
+	topic    string
+}
+
+// NewNativeBrokerClock creates a NativeBrokerClock with its own producer.
+func NewNativeBrokerClock(cfg BrokerClockConfig) (*NativeBrokerClock, error) {
+	producer, err := NewNativeProducer(ProducerConfig{ConfigMap: withoutTransactions(cfg.ConfigMap), Logger: cfg.Logger})
+	if err != nil {
+		return nil, err
+	}
+	return &NativeBrokerClock{producer: producer, topic: cfg.Topic}, nil
+}
+
+// Name returns "kafka".
+func (c *NativeBrokerClock) Name() string { return "kafka" }
+
+// Offset produces a probe and compares the broker's append time with the
+// local time halfway through the produce round trip.
+func (c *NativeBrokerClock) Offset(ctx context.Context) (time.Duration, error) {
+	sent := time.Now()
+	rec, err := c.producer.deliver(ctx, &kgo.Record{
+		Topic: c.topic,
+		Key:   []byte(uuid.NewString()),
+		Value: []byte(`{"kahook_clock_probe":true}`),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("produce to %s: %w", c.topic, err)
+	}
+	received := time.Now()
+	stored, err := readBack(ctx, c.producer.opts, c.producer.logger, rec)
+	if err != nil {
+		return 0, fmt.Errorf("consume from %s: %w", c.topic, err)
+	}
+	if stored.Attrs.TimestampType() != 1 {
+		return 0, fmt.Errorf("topic %s does not use LogAppendTime timestamps; set message.timestamp.type=LogAppendTime on it", c.topic)
+	}
+	local := sent.Add(received.Sub(sent) / 2)
+	return stored.Timestamp.Sub(local), nil
+}
+
+// Close closes the probe producer.
+func (c *NativeBrokerClock) Close() {
+	c.producer.Close()
+}
+
+// NativeLagReader is LagReader for the native client.
+type NativeLagReader struct {
+	client *kgo.Client
+	admin  *kadm.Client
+}
+
+// NewNativeLagReader connects a NativeLagReader with the connection
+// settings of configMap.
+func NewNativeLagReader(configMap map[string]any) (*NativeLagReader, error) {
+	client, err := newNativeClient(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lag client: %w", err)
+	}
+	return &NativeLagReader{client: client, admin: kadm.NewClient(client)}, nil
+}
+
+// Lag returns the sum over topic's partitions of the high watermark minus
+// group's committed offset. As with LagReader, partitions the group has
+// committed nothing on count as caught up, as do all of them if the group
+// does not exist.
+func (r *NativeLagReader) Lag(ctx context.Context, group, topic string) (int64, error) {
+	ends, err := r.admin.ListEndOffsets(ctx, topic)
+	if err == nil {
+		err = ends.Error()
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read watermarks of %s: %w", topic, err)
+	}
+	committed, err := r.admin.FetchOffsets(ctx, group)
+	if err == nil {
+		err = committed.Error()
+	}
+	if errors.Is(err, kerr.GroupIDNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to list offsets of group %s: %w", group, err)
+	}
+	var lag int64
+	ends.Each(func(end kadm.ListedOffset) {
+		c, ok := committed.Lookup(topic, end.Partition)
+		if !ok || c.At < 0 {
+			return
+		}
+		if n := end.Offset - c.At; n > 0 {
+			lag += n
+		}
+	})
+	return lag, nil
+}
+
+// Close releases the reader's connections.
+func (r *NativeLagReader) Close() {
+	r.client.Close()
+}
+
+// CheckNativeWritePermissions is CheckWritePermissions for the native
+// client.
+func CheckNativeWritePermissions(ctx context.Context, configMap map[string]any, topics []string) ([]TopicPermission, error) {
+	client, err := newNativeClient(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin client: %w", err)
+	}
+	defer client.Close()
+
+	req := kmsg.NewPtrMetadataRequest()
+	req.IncludeTopicAuthorizedOperations = true
+	for _, t := range topics {
+		rt := kmsg.NewMetadataRequestTopic()
+		rt.Topic = kmsg.StringPtr(t)
+		req.Topics = append(req.Topics, rt)
+	}
+	resp, err := req.RequestWith(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe topics: %w", err)
+	}
+	perms := make([]TopicPermission, 0, len(resp.Topics))
+	for _, t := range resp.Topics {
+		perms = append(perms, classifyNativeTopic(t))
+	}
+	return perms, nil
+}
+
+func classifyNativeTopic(t kmsg.MetadataResponseTopic) TopicPermission {
+	p := TopicPermission{}
+	if t.Topic != nil {
+		p.Topic = *t.Topic
+	}
+	switch err := kerr.ErrorForCode(t.ErrorCode); {
+	case err == nil:
+	case errors.Is(err, kerr.TopicAuthorizationFailed):
+		p.Status = PermissionDenied
+		p.Reason = "not authorized to access topic"
+		return p
+	case errors.Is(err, kerr.UnknownTopicOrPartition):
+		p.Status = PermissionMissing
+		p.Reason = "topic does not exist"
+		return p
+	default:
+		p.Status = PermissionUnknown
+		p.Reason = err.Error()
+		return p
+	}
+	ops := t.AuthorizedOperations
+	switch {
+	case ops == nativeAuthorizedOperationsUnknown:
+		p.Status = PermissionUnknown
+		p.Reason = "broker did not report authorized operations"
+	case ops&(1<<kmsg.ACLOperationWrite) != 0, ops&(1<<kmsg.ACLOperationAll) != 0:
+		p.Status = PermissionOK
+	default:
+		p.Status = PermissionDenied
+		p.Reason = "principal lacks WRITE on topic"
+	}
+	return p
+}
+
+// newNativeClient creates a franz-go client that connects with the
+// settings of configMap and neither produces nor consumes.
+func newNativeClient(configMap map[string]any) (*kgo.Client, error) {
+	opts, err := nativeOptionsFrom(withoutTransactions(configMap))
+	if err != nil {
+		return nil, err
+	}
+	return kgo.NewClient(opts.connectionOpts()...)
+}
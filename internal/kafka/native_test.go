@@ -0,0 +1,449 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+
+	"github.com/kahook/internal/delivery"
+	"github.com/kahook/internal/spool"
+)
+
+// newFakeCluster starts an in-process Kafka cluster with the topic
+// "orders" of the given number of partitions.
+func newFakeCluster(t *testing.T, partitions int32, opts ...kfake.Opt) *kfake.Cluster {
+	t.Helper()
+	c, err := kfake.NewCluster(append([]kfake.Opt{kfake.NumBrokers(1), kfake.SeedTopics(partitions, "orders")}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+	return c
+}
+
+func fakeConfigMap(c *kfake.Cluster) map[string]any {
+	return map[string]any{"bootstrap.servers": strings.Join(c.ListenAddrs(), ","), "acks": "all", "retries": 3, "compression.type": "none"}
+}
+
+// consumeAll reads every record of topic.
+func consumeAll(t *testing.T, c *kfake.Cluster, topic string, want int) []*kgo.Record {
+	t.Helper()
+	cl, err := kgo.NewClient(kgo.SeedBrokers(c.ListenAddrs()...), kgo.ConsumeTopics(topic), kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var out []*kgo.Record
+	for len(out) < want && ctx.Err() == nil {
+		cl.PollFetches(ctx).EachRecord(func(r *kgo.Record) { out = append(out, r) })
+	}
+	return out
+}
+
+// failProduces answers the first n produce requests c receives with code
+// and passes on the rest. It returns the number of produce requests seen.
+func failProduces(c *kfake.Cluster, code int16, n int64) *atomic.Int64 {
+	var seen atomic.Int64
+	c.ControlKey(int16(kmsg.Produce), func(r kmsg.Request) (kmsg.Response, error, bool) {
+		c.KeepControl()
+		if seen.Add(1) > n {
+			return nil, nil, false
+		}
+		req := r.(*kmsg.ProduceRequest)
+		resp := req.ResponseKind().(*kmsg.ProduceResponse)
+		for _, rt := range req.Topics {
+			st := kmsg.NewProduceResponseTopic()
+			st.Topic = rt.Topic
+			for _, rp := range rt.Partitions {
+				sp := kmsg.NewProduceResponseTopicPartition()
+				sp.Partition = rp.Partition
+				sp.ErrorCode = code
+				st.Partitions = append(st.Partitions, sp)
+			}
+			resp.Topics = append(resp.Topics, st)
+		}
+		return resp, nil, true
+	})
+	return &seen
+}
+
+func TestNativeProducer_Produce(t *testing.T) {
+	for _, compression := range []string{"none", "gzip", "snappy", "lz4", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			c := newFakeCluster(t, 4)
+			cm := fakeConfigMap(c)
+			cm["compression.type"] = compression
+			p, err := NewNativeProducer(ProducerConfig{ConfigMap: cm})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			ctx := context.Background()
+			for i := 0; i < 3; i++ {
+				rec := &delivery.Recorder{}
+				headers := map[string]string{"Kahook-Message-Id": "m" + strconv.Itoa(i)}
+				if err := p.Produce(delivery.WithRecorder(ctx, rec), "orders", []byte("customer-1"), []byte(`{"n":`+strconv.Itoa(i)+`}`), headers); err != nil {
+					t.Fatalf("Produce() error = %v", err)
+				}
+				report, ok := rec.Report()
+				wantPartition := int32(crc32.ChecksumIEEE([]byte("customer-1")) % 4)
+				if !ok || report.Partition != wantPartition || report.Offset != int64(i) {
+					t.Errorf("report = %+v, %v, want partition %d offset %d", report, ok, wantPartition, i)
+				}
+			}
+			if err := p.Produce(ctx, "orders", nil, []byte("keyless"), nil); err != nil {
+				t.Fatalf("Produce() error = %v", err)
+			}
+
+			got := consumeAll(t, c, "orders", 4)
+			if len(got) != 4 {
+				t.Fatalf("cluster has %d records, want 4", len(got))
+			}
+			var keyed []*kgo.Record
+			for _, r := range got {
+				if r.Key != nil {
+					keyed = append(keyed, r)
+				} else if string(r.Value) != "keyless" || len(r.Headers) != 0 {
+					t.Errorf("keyless record = %+v", r)
+				}
+			}
+			if len(keyed) != 3 {
+				t.Fatalf("keyed records = %d, want 3", len(keyed))
+			}
+			if r := keyed[1]; string(r.Value) != `{"n":1}` || len(r.Headers) != 1 || string(r.Headers[0].Value) != "m1" {
+				t.Errorf("record = %+v", r)
+			}
+		})
+	}
+}
+
+func TestNativeProducer_RoundRobinTopics(t *testing.T) {
+	c := newFakeCluster(t, 3)
+	p, err := NewNativeProducer(ProducerConfig{ConfigMap: fakeConfigMap(c), RoundRobinTopics: []string{"orders"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	seen := make(map[int32]bool)
+	for i := 0; i < 3; i++ {
+		rec := &delivery.Recorder{}
+		if err := p.Produce(delivery.WithRecorder(context.Background(), rec), "orders", nil, []byte("v"), nil); err != nil {
+			t.Fatalf("Produce() error = %v", err)
+		}
+		report, _ := rec.Report()
+		seen[report.Partition] = true
+	}
+	if len(seen) != 3 {
+		t.Errorf("keyless messages went to partitions %v, want all 3", seen)
+	}
+}
+
+func TestNativeProducer_RetriesNotLeader(t *testing.T) {
+	c := newFakeCluster(t, 1)
+	produces := failProduces(c, kerr.NotLeaderForPartition.Code, 1)
+	p, err := NewNativeProducer(ProducerConfig{ConfigMap: fakeConfigMap(c)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if err := p.Produce(context.Background(), "orders", []byte("k"), []byte("v"), nil); err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+	if got := consumeAll(t, c, "orders", 1); len(got) != 1 {
+		t.Errorf("cluster has %d records, want 1", len(got))
+	}
+	if n := produces.Load(); n != 2 {
+		t.Errorf("produce requests = %d, want 2", n)
+	}
+}
+
+func TestNativeProducer_TopicErrors(t *testing.T) {
+	c := newFakeCluster(t, 1)
+	produces := failProduces(c, kerr.TopicAuthorizationFailed.Code, 1)
+	events := &BrokerEvents{}
+	p, err := NewNativeProducer(ProducerConfig{ConfigMap: fakeConfigMap(c), Events: events})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	err = p.Produce(context.Background(), "orders", []byte("k"), []byte("v"), nil)
+	var forbidden interface{ TopicAuthorizationFailed() bool }
+	if !errors.As(err, &forbidden) || !forbidden.TopicAuthorizationFailed() {
+		t.Errorf("Produce() error = %v, want a topic authorization failure", err)
+	}
+	if n := produces.Load(); n != 1 {
+		t.Errorf("produce requests = %d, want 1, without retrying", n)
+	}
+	if n := events.Snapshot()[EventAuthFailure]; n != 1 {
+		t.Errorf("auth failures = %d, want 1", n)
+	}
+
+	err = p.Produce(context.Background(), "missing", []byte("k"), []byte("v"), nil)
+	var unknown interface{ UnknownTopic() bool }
+	if !errors.As(err, &unknown) || !unknown.UnknownTopic() {
+		t.Errorf("Produce() error = %v, want an unknown topic", err)
+	}
+}
+
+func TestNativeProducer_SASL(t *testing.T) {
+	c := newFakeCluster(t, 1, kfake.EnableSASL(), kfake.Superuser("SCRAM-SHA-256", "kahook", "secret"))
+
+	tests := []struct {
+		name     string
+		password string
+		wantErr  bool
+	}{
+		{name: "valid credentials", password: "secret"},
+		{name: "wrong password", password: "guess", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := fakeConfigMap(c)
+			cm["security.protocol"] = "SASL_PLAINTEXT"
+			cm["sasl.mechanism"] = "SCRAM-SHA-256"
+			cm["sasl.username"] = "kahook"
+			cm["sasl.password"] = tt.password
+			if tt.wantErr {
+				// kfake drops the connection on a wrong password; a
+				// broker answers with an authentication error.
+				c.ControlKey(int16(kmsg.SASLAuthenticate), func(r kmsg.Request) (kmsg.Response, error, bool) {
+					c.KeepControl()
+					resp := r.(*kmsg.SASLAuthenticateRequest).ResponseKind().(*kmsg.SASLAuthenticateResponse)
+					resp.ErrorCode = kerr.SaslAuthenticationFailed.Code
+					return resp, nil, true
+				})
+			}
+			events := &BrokerEvents{}
+			p, err := NewNativeProducer(ProducerConfig{ConfigMap: cm, Events: events})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer p.Close()
+
+			if got := p.IsConnected(); got == tt.wantErr {
+				t.Errorf("IsConnected() = %v", got)
+			}
+			if got := events.Snapshot()[EventAuthFailure]; (got > 0) != tt.wantErr {
+				t.Errorf("auth failures = %d", got)
+			}
+		})
+	}
+}
+
+func TestNativeProducer_CloseSpillsUndelivered(t *testing.T) {
+	c := newFakeCluster(t, 1)
+	release := make(chan struct{})
+	defer close(release)
+	var held atomic.Bool
+	c.ControlKey(int16(kmsg.Produce), func(kmsg.Request) (kmsg.Response, error, bool) {
+		c.KeepControl()
+		held.Store(true)
+		c.SleepControl(func() { <-release })
+		return nil, nil, false
+	})
+	dir := t.TempDir()
+	sp, err := spool.New(spool.Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewNativeProducer(ProducerConfig{ConfigMap: fakeConfigMap(c), FlushTimeout: 50 * time.Millisecond, Spill: sp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- p.Produce(context.Background(), "orders", []byte("k"), []byte("v"), nil)
+	}()
+	// The caller of a second message gives up and recycles its buffer.
+	value := []byte("second")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := make(chan error, 1)
+	go func() {
+		cancelled <- p.Produce(ctx, "orders", []byte("k2"), value, nil)
+	}()
+	for !held.Load() {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	if err := <-cancelled; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled Produce() error = %v, want %v", err, context.Canceled)
+	}
+	copy(value, "reused")
+	p.Close()
+
+	if err := <-done; !errors.Is(err, errProducerClosed) {
+		t.Errorf("Produce() error = %v, want %v", err, errProducerClosed)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "kahook-spill-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("spill files = %v, want 1", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !bytes.Contains(data, []byte(`"topic":"orders"`)) {
+		t.Errorf("spill file = %s", data)
+	}
+	if bytes.Contains(data, []byte("reused")) {
+		t.Errorf("spill file holds the recycled buffer: %s", data)
+	}
+}
+
+func TestNativeVerifier(t *testing.T) {
+	c := newFakeCluster(t, 2)
+	v, err := NewNativeVerifier(VerifierConfig{ConfigMap: fakeConfigMap(c), Topic: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	produce, roundTrip, err := v.Verify(ctx)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if produce <= 0 || roundTrip < produce {
+		t.Errorf("Verify() = %v, %v", produce, roundTrip)
+	}
+}
+
+func TestNativeBrokerClock_RequiresLogAppendTime(t *testing.T) {
+	c := newFakeCluster(t, 1)
+	clock, err := NewNativeBrokerClock(BrokerClockConfig{ConfigMap: fakeConfigMap(c), Topic: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clock.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := clock.Offset(ctx); err == nil || !strings.Contains(err.Error(), "LogAppendTime") {
+		t.Errorf("Offset() error = %v, want a LogAppendTime error", err)
+	}
+}
+
+func TestNativeLagReader(t *testing.T) {
+	c := newFakeCluster(t, 2)
+	p, err := NewNativeProducer(ProducerConfig{ConfigMap: fakeConfigMap(c)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	ctx := context.Background()
+	var last delivery.Report
+	for i := 0; i < 5; i++ {
+		rec := &delivery.Recorder{}
+		if err := p.Produce(delivery.WithRecorder(ctx, rec), "orders", []byte("k"), []byte("v"), nil); err != nil {
+			t.Fatal(err)
+		}
+		last, _ = rec.Report()
+	}
+
+	r, err := NewNativeLagReader(fakeConfigMap(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if lag, err := r.Lag(ctx, "billing", "orders"); err != nil || lag != 0 {
+		t.Errorf("Lag() before any commit = %d, %v, want 0", lag, err)
+	}
+
+	offsets := make(kadm.Offsets)
+	offsets.Add(kadm.Offset{Topic: "orders", Partition: last.Partition, At: 2, LeaderEpoch: -1})
+	if _, err := r.admin.CommitOffsets(ctx, "billing", offsets); err != nil {
+		t.Fatal(err)
+	}
+	if lag, err := r.Lag(ctx, "billing", "orders"); err != nil || lag != 3 {
+		t.Errorf("Lag() = %d, %v, want 3", lag, err)
+	}
+}
+
+func TestClassifyNativeTopic(t *testing.T) {
+	topic := func(code int16, ops int32) kmsg.MetadataResponseTopic {
+		t := kmsg.NewMetadataResponseTopic()
+		t.Topic = kmsg.StringPtr("orders")
+		t.ErrorCode = code
+		t.AuthorizedOperations = ops
+		return t
+	}
+	tests := []struct {
+		name string
+		t    kmsg.MetadataResponseTopic
+		want string
+	}{
+		{"write", topic(0, 1<<kmsg.ACLOperationRead|1<<kmsg.ACLOperationWrite), PermissionOK},
+		{"all", topic(0, 1<<kmsg.ACLOperationAll), PermissionOK},
+		{"read only", topic(0, 1<<kmsg.ACLOperationRead), PermissionDenied},
+		{"not reported", topic(0, nativeAuthorizedOperationsUnknown), PermissionUnknown},
+		{"forbidden", topic(kerr.TopicAuthorizationFailed.Code, 0), PermissionDenied},
+		{"missing", topic(kerr.UnknownTopicOrPartition.Code, 0), PermissionMissing},
+		{"other error", topic(kerr.LeaderNotAvailable.Code, 0), PermissionUnknown},
+	}
+	for _, tt := range tests {
+		if got := classifyNativeTopic(tt.t); got.Status != tt.want || got.Topic != "orders" {
+			t.Errorf("%s: classifyNativeTopic() = %+v, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestNativeOptionsFrom(t *testing.T) {
+	base := map[string]any{"bootstrap.servers": "a:9092, b:9092", "acks": "all", "retries": 5}
+	tests := []struct {
+		name    string
+		set     map[string]any
+		wantErr bool
+	}{
+		{name: "defaults"},
+		{name: "snappy", set: map[string]any{"compression.type": "snappy"}},
+		{name: "scram over tls", set: map[string]any{"security.protocol": "SASL_SSL", "sasl.mechanism": "SCRAM-SHA-512"}},
+		{name: "event hubs settings", set: map[string]any{"socket.keepalive.enable": true, "request.timeout.ms": 60000, "message.max.bytes": 1046528}},
+		{name: "idempotence", set: map[string]any{"enable.idempotence": true}},
+		{name: "transactions", set: map[string]any{"transactional.id": "kahook-0", "transaction.timeout.ms": 60000}},
+		{name: "no brokers", set: map[string]any{"bootstrap.servers": ""}, wantErr: true},
+		{name: "unknown codec", set: map[string]any{"compression.type": "brotli"}, wantErr: true},
+		{name: "idempotence without acks=all", set: map[string]any{"enable.idempotence": true, "acks": 1}, wantErr: true},
+		{name: "oauthbearer", set: map[string]any{"security.protocol": "SASL_SSL", "sasl.mechanism": "OAUTHBEARER"}, wantErr: true},
+		{name: "invalid timeout", set: map[string]any{"request.timeout.ms": "soon"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := make(map[string]any)
+			for k, v := range base {
+				cm[k] = v
+			}
+			for k, v := range tt.set {
+				cm[k] = v
+			}
+			opts, err := nativeOptionsFrom(cm)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nativeOptionsFrom() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.name == "defaults" && (len(opts.bootstrap) != 2 || opts.acks != kgo.AllISRAcks() || opts.retries != 5 || opts.idempotent) {
+				t.Errorf("nativeOptionsFrom() = %+v", opts)
+			}
+			if tt.name == "transactions" && (!opts.idempotent || opts.transactionTimeout != time.Minute) {
+				t.Errorf("nativeOptionsFrom() = %+v, want an idempotent producer with a one-minute transaction timeout", opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"go.uber.org/zap"
+)
+
+// nativeTransactions is the native client's counterpart of transactions:
+// messages queued while a transaction runs are committed together in the
+// next, up to max at a time, and are reported delivered only once their
+// transaction commits. If any of them fails, the transaction is aborted
+// and all of them fail.
+type nativeTransactions struct {
+	p       *NativeProducer
+	max     int
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *nativeTxnRequest
+	done   chan struct{}
+}
+
+// nativeTxnRequest is a record waiting to be produced in a transaction.
+type nativeTxnRequest struct {
+	ctx    context.Context
+	rec    *kgo.Record
+	result chan error
+}
+
+// initNativeTransactions registers the producer's transactional ID with
+// the brokers, fencing any earlier producer with the same ID, and starts
+// the transaction loop.
+func initNativeTransactions(p *NativeProducer, max int, timeout time.Duration) (*nativeTransactions, error) {
+	if max <= 0 {
+		max = defaultTransactionBatch
+	}
+	if timeout <= 0 {
+		timeout = DefaultTransactionTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, _, err := p.client.ProducerID(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize kafka transactions: %w", err)
+	}
+	t := &nativeTransactions{
+		p:       p,
+		max:     max,
+		timeout: timeout,
+		queue:   make(chan *nativeTxnRequest, max),
+		done:    make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// deliver queues rec for the next transaction and waits until it commits
+// or ctx ends. A record whose ctx ends before its transaction begins is
+// not produced.
+func (t *nativeTransactions) deliver(ctx context.Context, rec *kgo.Record) (*kgo.Record, error) {
+	req := &nativeTxnRequest{ctx: ctx, rec: rec, result: make(chan error, 1)}
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return nil, fmt.Errorf("failed to produce message: %w", errProducerClosed)
+	}
+	select {
+	case t.queue <- req:
+		t.mu.RUnlock()
+	case <-ctx.Done():
+		t.mu.RUnlock()
+		return nil, fmt.Errorf("produce cancelled: %w", ctx.Err())
+	}
+	select {
+	case err := <-req.result:
+		if err != nil {
+			return nil, err
+		}
+		return rec, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("produce cancelled: %w", ctx.Err())
+	}
+}
+
+func (t *nativeTransactions) run() {
+	defer close(t.done)
+	for req := range t.queue {
+		batch := []*nativeTxnRequest{req}
+	fill:
+		for len(batch) < t.max {
+			select {
+			case r, ok := <-t.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, r)
+			default:
+				break fill
+			}
+		}
+		t.commit(batch)
+	}
+}
+
+// commit produces the batch's live requests in one transaction and reports
+// the outcome to each.
+func (t *nativeTransactions) commit(batch []*nativeTxnRequest) {
+	live := batch[:0]
+	for _, r := range batch {
+		if err := r.ctx.Err(); err != nil {
+			r.result <- fmt.Errorf("produce cancelled: %w", err)
+			continue
+		}
+		live = append(live, r)
+	}
+	if len(live) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	err := t.transact(ctx, live)
+	for _, r := range live {
+		r.result <- err
+	}
+}
+
+// transact produces the requests' records in one transaction and commits
+// it.
+func (t *nativeTransactions) transact(ctx context.Context, batch []*nativeTxnRequest) error {
+	p := t.p
+	if err := p.client.BeginTransaction(); err != nil {
+		return fmt.Errorf("failed to begin kafka transaction: %w", err)
+	}
+	results := make([]<-chan error, 0, len(batch))
+	var err error
+	for _, r := range batch {
+		result, serr := p.send(ctx, r.rec)
+		if serr != nil {
+			err = serr
+			break
+		}
+		results = append(results, result)
+	}
+	for _, result := range results {
+		if derr := <-result; derr != nil && err == nil {
+			err = derr
+		}
+	}
+	if err == nil {
+		if err = p.client.EndTransaction(ctx, kgo.TryCommit); err == nil {
+			return nil
+		}
+	}
+	t.abort(ctx, err)
+	return fmt.Errorf("kafka transaction aborted: %w", err)
+}
+
+// abort aborts the current transaction after cause. An error franz-go
+// considers fatal leaves the producer unusable: every later transaction
+// fails until kahook is restarted.
+func (t *nativeTransactions) abort(ctx context.Context, cause error) {
+	p := t.p
+	if err := p.client.AbortBufferedRecords(ctx); err != nil {
+		p.logger.Error("failed to abort buffered kafka records", zap.NamedError("cause", cause), zap.Error(err))
+	}
+	if err := p.client.EndTransaction(ctx, kgo.TryAbort); err != nil {
+		if errors.Is(err, kgo.ErrClientClosed) {
+			return
+		}
+		p.logger.Error("failed to abort kafka transaction; restart if it keeps failing", zap.NamedError("cause", cause), zap.Error(err))
+	}
+}
+
+// close stops accepting messages and waits until those queued are
+// committed or have failed.
+func (t *nativeTransactions) close() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	<-t.done
+}
@@ -0,0 +1,164 @@
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+)
+
+// Serialized wraps a producer so that messages sharing a topic and key are
+// produced one at a time, in the order their Produce calls acquired the key.
+// Combined with a producer configured for idempotence or a single in-flight
+// request, this guarantees per-key ordering end to end: a webhook is only
+// sent once the previous one with the same key has been acknowledged.
+//
+// Keyless messages are serialized per topic.
+type Serialized struct {
+	next Client
+
+	mu    sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is a mutex with a reference count so that idle keys can be removed
+// from the map instead of accumulating forever.
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewSerialized wraps p.
+func NewSerialized(p Client) *Serialized {
+	return &Serialized{next: p, locks: make(map[string]*keyLock)}
+}
+
+// Produce waits for any in-flight produce with the same topic and key to
+// finish, then produces the message.
+//
+// If ctx ends while the message is in flight, Produce returns but the key
+// stays locked until the wrapped producer reports the delivery, which
+// message.timeout.ms bounds: a message produced behind it could otherwise
+// overtake it while it is retried. The delivery then carries on with
+// copies of key, value and headers, which the caller may reuse.
+func (s *Serialized) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	id := topic + "\x00" + string(key)
+	l := s.acquire(id)
+
+	// The caller may give up while queued behind a slow delivery.
+	if err := ctx.Err(); err != nil {
+		s.release(id, l)
+		return err
+	}
+
+	key, value, headers = bytes.Clone(key), bytes.Clone(value), maps.Clone(headers)
+	done := make(chan error, 1)
+	go func() {
+		err := s.next.Produce(context.WithoutCancel(ctx), topic, key, value, headers)
+		s.release(id, l)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("produce cancelled: %w", ctx.Err())
+	}
+}
+
+func (s *Serialized) acquire(id string) *keyLock {
+	s.mu.Lock()
+	l, ok := s.locks[id]
+	if !ok {
+		l = &keyLock{}
+		s.locks[id] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.mu.Lock()
+	return l
+}
+
+func (s *Serialized) release(id string, l *keyLock) {
+	l.mu.Unlock()
+
+	s.mu.Lock()
+	l.refs--
+	if l.refs == 0 {
+		delete(s.locks, id)
+	}
+	s.mu.Unlock()
+}
+
+// IsConnected delegates to the wrapped producer.
+func (s *Serialized) IsConnected() bool {
+	return s.next.IsConnected()
+}
+
+// Close closes the wrapped producer.
+func (s *Serialized) Close() {
+	s.next.Close()
+}
+
+// TopicRouter sends each topic to a dedicated producer when one is
+// configured, and to a default producer otherwise.
+type TopicRouter struct {
+	def    Client
+	topics map[string]Client
+}
+
+// NewTopicRouter creates a router. topics maps topic names to producers;
+// several topics may share one producer.
+func NewTopicRouter(def Client, topics map[string]Client) *TopicRouter {
+	return &TopicRouter{def: def, topics: topics}
+}
+
+// Produce sends the message through the producer for topic.
+func (r *TopicRouter) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	return r.route(topic).Produce(ctx, topic, key, value, headers)
+}
+
+func (r *TopicRouter) route(topic string) Client {
+	if p, ok := r.topics[topic]; ok {
+		return p
+	}
+	return r.def
+}
+
+// IsConnected reports whether the default and every dedicated producer are
+// connected.
+func (r *TopicRouter) IsConnected() bool {
+	if !r.def.IsConnected() {
+		return false
+	}
+	for _, p := range r.distinct() {
+		if !p.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close closes every producer exactly once.
+func (r *TopicRouter) Close() {
+	for _, p := range r.distinct() {
+		p.Close()
+	}
+	r.def.Close()
+}
+
+// distinct returns the dedicated producers, de-duplicated and excluding the
+// default.
+func (r *TopicRouter) distinct() []Client {
+	seen := map[Client]bool{r.def: true}
+	var out []Client
+	for _, p := range r.topics {
+		if !seen[p] {
+			seen[p] = true
+			out = append(out, p)
+		}
+	}
+	return out
+}
@@ -0,0 +1,159 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowClient tracks the maximum number of concurrent Produce calls per key.
+type slowClient struct {
+	mu       sync.Mutex
+	inflight map[string]int
+	maxSeen  atomic.Int32
+	closed   atomic.Int32
+}
+
+func (s *slowClient) Produce(_ context.Context, _ string, key, _ []byte, _ map[string]string) error {
+	s.mu.Lock()
+	s.inflight[string(key)]++
+	if n := int32(s.inflight[string(key)]); n > s.maxSeen.Load() {
+		s.maxSeen.Store(n)
+	}
+	s.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	s.mu.Lock()
+	s.inflight[string(key)]--
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *slowClient) IsConnected() bool { return true }
+func (s *slowClient) Close()            { s.closed.Add(1) }
+
+func TestSerialized_OneInFlightPerKey(t *testing.T) {
+	inner := &slowClient{inflight: make(map[string]int)}
+	s := NewSerialized(inner)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := []byte{'a' + byte(i%2)}
+			_ = s.Produce(context.Background(), "t", key, nil, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	if got := inner.maxSeen.Load(); got != 1 {
+		t.Errorf("max concurrent produces per key = %d, want 1", got)
+	}
+	if len(s.locks) != 0 {
+		t.Errorf("%d key locks left behind after all produces finished", len(s.locks))
+	}
+}
+
+func TestSerialized_CancelledWhileQueued(t *testing.T) {
+	s := NewSerialized(&slowClient{inflight: make(map[string]int)})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Produce(ctx, "t", []byte("k"), nil, nil); err == nil {
+		t.Error("Produce with a cancelled context should fail")
+	}
+}
+
+// gatedClient blocks each Produce until its delivery is released, ignoring
+// ctx the way a producer waiting for a delivery report does. It records the
+// value it was given once released.
+type gatedClient struct {
+	started   chan string
+	deliver   chan struct{}
+	delivered chan string
+}
+
+func (g *gatedClient) Produce(ctx context.Context, _ string, _, value []byte, _ map[string]string) error {
+	g.started <- string(value)
+	<-g.deliver
+	if g.delivered != nil {
+		g.delivered <- string(value)
+	}
+	return nil
+}
+
+func (g *gatedClient) IsConnected() bool { return true }
+func (g *gatedClient) Close()            {}
+
+func TestSerialized_CancelledInFlightKeepsKey(t *testing.T) {
+	inner := &gatedClient{started: make(chan string, 2), deliver: make(chan struct{})}
+	s := NewSerialized(inner)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- s.Produce(ctx, "t", []byte("k"), []byte("1"), nil) }()
+	<-inner.started
+
+	cancel()
+	if err := <-first; err == nil {
+		t.Fatal("Produce cancelled in flight should fail")
+	}
+
+	second := make(chan error, 1)
+	go func() { second <- s.Produce(context.Background(), "t", []byte("k"), []byte("2"), nil) }()
+	select {
+	case v := <-inner.started:
+		t.Fatalf("message %s produced before the cancelled one was delivered", v)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	inner.deliver <- struct{}{}
+	if v := <-inner.started; v != "2" {
+		t.Fatalf("started %q, want 2", v)
+	}
+	inner.deliver <- struct{}{}
+	if err := <-second; err != nil {
+		t.Errorf("second Produce: %v", err)
+	}
+}
+
+func TestSerialized_CancelledInFlightOwnsBuffers(t *testing.T) {
+	inner := &gatedClient{started: make(chan string, 1), deliver: make(chan struct{}), delivered: make(chan string, 1)}
+	s := NewSerialized(inner)
+
+	value := []byte("first")
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() { first <- s.Produce(ctx, "t", []byte("k"), value, nil) }()
+	<-inner.started
+	cancel()
+	<-first
+
+	// The caller recycles its buffer once Produce returns.
+	copy(value, "xxxxx")
+	inner.deliver <- struct{}{}
+	if got := <-inner.delivered; got != "first" {
+		t.Errorf("delivered %q, want the value as it was produced", got)
+	}
+}
+
+func TestTopicRouter(t *testing.T) {
+	def := &fakeMember{connected: true}
+	dedicated := &slowClient{inflight: make(map[string]int)}
+	r := NewTopicRouter(def, map[string]Client{"a": dedicated, "b": dedicated})
+
+	_ = r.Produce(context.Background(), "other", nil, nil, nil)
+	_ = r.Produce(context.Background(), "a", nil, nil, nil)
+	if def.produced != 1 {
+		t.Errorf("default producer got %d messages, want 1", def.produced)
+	}
+
+	r.Close()
+	if got := dedicated.closed.Load(); got != 1 {
+		t.Errorf("shared dedicated producer closed %d times, want 1", got)
+	}
+}
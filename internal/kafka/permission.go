@@ -0,0 +1,23 @@
+package kafka
+
+// Outcomes of a topic write-permission check.
+const (
+	PermissionOK      = "ok"
+	PermissionDenied  = "denied"
+	PermissionMissing = "missing"
+	// PermissionUnknown means the broker could not say, e.g. because it
+	// predates KIP-430 or returned an unexpected error.
+	PermissionUnknown = "unknown"
+)
+
+// TopicPermission is the result of checking write access to one topic.
+type TopicPermission struct {
+	Topic  string
+	Status string
+	Reason string
+}
+
+// Writable reports whether the check positively confirmed write access.
+func (p TopicPermission) Writable() bool {
+	return p.Status == PermissionOK
+}
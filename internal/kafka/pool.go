@@ -0,0 +1,127 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/kahook/internal/hashring"
+)
+
+// Pool assignment strategies.
+const (
+	// StrategyConsistentHash sends every message with the same key through
+	// the same producer, preserving per-key ordering. Keyless messages are
+	// spread round-robin.
+	StrategyConsistentHash = "consistent_hash"
+	// StrategyRoundRobin spreads all messages evenly regardless of key. It
+	// maximises throughput but gives up per-key ordering.
+	StrategyRoundRobin = "round_robin"
+)
+
+// Pool spreads produce calls over several producers, each with its own
+// librdkafka queues and broker connections, so a single producer's internal
+// locking doesn't cap throughput.
+type Pool struct {
+	members  []Client
+	ring     *hashring.Ring // nil for round-robin
+	next     atomic.Uint64
+	strategy string
+}
+
+// PoolConfig configures NewPool.
+type PoolConfig struct {
+	ProducerConfig
+	Size     int
+	Strategy string
+
+	// Native builds the pool of NativeProducers instead of librdkafka
+	// producers.
+	Native bool
+}
+
+// NewPool creates cfg.Size producers. On error any producers already created
+// are closed. Transactional producers get the transactional ID of
+// cfg.ConfigMap with their index appended.
+func NewPool(cfg PoolConfig) (*Pool, error) {
+	if cfg.Size < 1 {
+		return nil, fmt.Errorf("producer pool size must be at least 1, got %d", cfg.Size)
+	}
+
+	members := make([]Client, 0, cfg.Size)
+	for i := 0; i < cfg.Size; i++ {
+		p, err := newMember(memberConfig(cfg.ProducerConfig, i), cfg.Native)
+		if err != nil {
+			for _, m := range members {
+				m.Close()
+			}
+			return nil, fmt.Errorf("producer %d of %d: %w", i+1, cfg.Size, err)
+		}
+		members = append(members, p)
+	}
+
+	return newPool(members, cfg.Strategy)
+}
+
+// newMember creates a pool member, native or librdkafka.
+func newMember(cfg ProducerConfig, native bool) (Client, error) {
+	if native {
+		return NewNativeProducer(cfg)
+	}
+	return NewProducer(cfg)
+}
+
+func newPool(members []Client, strategy string) (*Pool, error) {
+	p := &Pool{members: members, strategy: strategy}
+	switch strategy {
+	case StrategyConsistentHash, "":
+		p.strategy = StrategyConsistentHash
+		p.ring = hashring.New(len(members), 0)
+	case StrategyRoundRobin:
+	default:
+		return nil, fmt.Errorf("unknown producer pool strategy %q", strategy)
+	}
+	return p, nil
+}
+
+// Produce sends the message through the producer selected by the pool's
+// strategy.
+func (p *Pool) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	return p.members[p.pick(key)].Produce(ctx, topic, key, value, headers)
+}
+
+func (p *Pool) pick(key []byte) int {
+	if p.ring != nil && len(key) > 0 {
+		return p.ring.Get(key)
+	}
+	return int(p.next.Add(1) % uint64(len(p.members)))
+}
+
+// IsConnected reports whether every producer in the pool can reach a broker.
+// A single disconnected member would fail all keys hashed to it, so the pool
+// is only ready when all members are.
+func (p *Pool) IsConnected() bool {
+	for _, m := range p.members {
+		if !m.IsConnected() {
+			return false
+		}
+	}
+	return true
+}
+
+// Close flushes and closes every producer.
+func (p *Pool) Close() {
+	for _, m := range p.members {
+		m.Close()
+	}
+}
+
+// Size returns the number of producers in the pool.
+func (p *Pool) Size() int {
+	return len(p.members)
+}
+
+// Strategy returns the assignment strategy in use.
+func (p *Pool) Strategy() string {
+	return p.strategy
+}
@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// fakeMember records how many messages were routed to it.
+type fakeMember struct {
+	keys      map[string]bool
+	produced  int
+	connected bool
+}
+
+func (f *fakeMember) Produce(_ context.Context, _ string, key, _ []byte, _ map[string]string) error {
+	f.produced++
+	if f.keys == nil {
+		f.keys = make(map[string]bool)
+	}
+	f.keys[string(key)] = true
+	return nil
+}
+
+func (f *fakeMember) IsConnected() bool { return f.connected }
+func (f *fakeMember) Close()            {}
+
+func newFakePool(t *testing.T, n int, strategy string) (*Pool, []*fakeMember) {
+	t.Helper()
+	fakes := make([]*fakeMember, n)
+	members := make([]Client, n)
+	for i := range fakes {
+		fakes[i] = &fakeMember{connected: true}
+		members[i] = fakes[i]
+	}
+	p, err := newPool(members, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, fakes
+}
+
+func TestPool_ConsistentHashIsSticky(t *testing.T) {
+	p, fakes := newFakePool(t, 4, StrategyConsistentHash)
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 100; i++ {
+			_ = p.Produce(context.Background(), "t", []byte(fmt.Sprintf("k%d", i)), nil, nil)
+		}
+	}
+
+	seen := make(map[string]int)
+	for i, f := range fakes {
+		for k := range f.keys {
+			if prev, ok := seen[k]; ok {
+				t.Fatalf("key %q went through producers %d and %d", k, prev, i)
+			}
+			seen[k] = i
+		}
+	}
+}
+
+func TestPool_KeylessRoundRobin(t *testing.T) {
+	for _, strategy := range []string{StrategyConsistentHash, StrategyRoundRobin} {
+		p, fakes := newFakePool(t, 3, strategy)
+		for i := 0; i < 30; i++ {
+			_ = p.Produce(context.Background(), "t", nil, nil, nil)
+		}
+		for i, f := range fakes {
+			if f.produced != 10 {
+				t.Errorf("%s: producer %d got %d messages, want 10", strategy, i, f.produced)
+			}
+		}
+	}
+}
+
+func TestPool_IsConnectedRequiresAll(t *testing.T) {
+	p, fakes := newFakePool(t, 2, "")
+	if !p.IsConnected() {
+		t.Error("pool should be connected when all members are")
+	}
+	fakes[1].connected = false
+	if p.IsConnected() {
+		t.Error("pool should not be connected when any Client is down")
+	}
+}
+
+func TestPool_UnknownStrategy(t *testing.T) {
+	if _, err := newPool([]Client{&fakeMember{}}, "random"); err == nil {
+		t.Error("unknown strategy should be rejected")
+	}
+}
+
+func TestMemberConfig_TransactionalID(t *testing.T) {
+	cfg := ProducerConfig{ConfigMap: map[string]any{"bootstrap.servers": "b:9092", transactionalIDKey: "kahook-web-0"}}
+	for i, want := range []string{"kahook-web-0-0", "kahook-web-0-1"} {
+		if got := memberConfig(cfg, i).ConfigMap[transactionalIDKey]; got != want {
+			t.Errorf("member %d transactional.id = %v, want %s", i, got, want)
+		}
+	}
+	if got := cfg.ConfigMap[transactionalIDKey]; got != "kahook-web-0" {
+		t.Errorf("memberConfig modified the shared config map: transactional.id = %v", got)
+	}
+	plain := ProducerConfig{ConfigMap: map[string]any{"bootstrap.servers": "b:9092"}}
+	if _, ok := memberConfig(plain, 1).ConfigMap[transactionalIDKey]; ok {
+		t.Error("non-transactional member got a transactional.id")
+	}
+	if _, ok := withoutTransactions(cfg.ConfigMap)[transactionalIDKey]; ok {
+		t.Error("withoutTransactions kept transactional.id")
+	}
+}
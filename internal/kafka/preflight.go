@@ -0,0 +1,71 @@
+//go:build cgo
+
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+// CheckWritePermissions asks the brokers which operations the configured
+// principal may perform on each topic (KIP-430 authorized operations, Kafka
+// 2.3+) and reports whether it can write to them. It only reads metadata and
+// produces nothing. The error is non-nil only when the check could not run.
+func CheckWritePermissions(ctx context.Context, configMap map[string]any, topics []string) ([]TopicPermission, error) {
+	cm := connectionConfig(configMap)
+	admin, err := kafka.NewAdminClient(&cm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin client: %w", err)
+	}
+	defer admin.Close()
+
+	res, err := admin.DescribeTopics(ctx,
+		kafka.NewTopicCollectionOfTopicNames(topics),
+		kafka.SetAdminOptionIncludeAuthorizedOperations(true),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe topics: %w", err)
+	}
+
+	perms := make([]TopicPermission, 0, len(res.TopicDescriptions))
+	for _, desc := range res.TopicDescriptions {
+		perms = append(perms, classifyTopic(desc))
+	}
+	return perms, nil
+}
+
+func classifyTopic(desc kafka.TopicDescription) TopicPermission {
+	p := TopicPermission{Topic: desc.Name}
+
+	switch desc.Error.Code() {
+	case kafka.ErrNoError:
+	case kafka.ErrTopicAuthorizationFailed:
+		p.Status = PermissionDenied
+		p.Reason = "not authorized to access topic"
+		return p
+	case kafka.ErrUnknownTopicOrPart, kafka.ErrUnknownTopic:
+		p.Status = PermissionMissing
+		p.Reason = "topic does not exist"
+		return p
+	default:
+		p.Status = PermissionUnknown
+		p.Reason = desc.Error.Error()
+		return p
+	}
+
+	switch {
+	case desc.AuthorizedOperations == nil:
+		p.Status = PermissionUnknown
+		p.Reason = "broker did not report authorized operations"
+	case slices.Contains(desc.AuthorizedOperations, kafka.ACLOperationWrite),
+		slices.Contains(desc.AuthorizedOperations, kafka.ACLOperationAll):
+		p.Status = PermissionOK
+	default:
+		p.Status = PermissionDenied
+		p.Reason = "principal lacks WRITE on topic"
+	}
+	return p
+}
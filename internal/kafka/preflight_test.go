@@ -0,0 +1,32 @@
+//go:build cgo
+
+package kafka
+
+import (
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+)
+
+func TestClassifyTopic(t *testing.T) {
+	tests := []struct {
+		name string
+		desc kafka.TopicDescription
+		want string
+	}{
+		{"write allowed", kafka.TopicDescription{AuthorizedOperations: []kafka.ACLOperation{kafka.ACLOperationDescribe, kafka.ACLOperationWrite}}, PermissionOK},
+		{"all allowed", kafka.TopicDescription{AuthorizedOperations: []kafka.ACLOperation{kafka.ACLOperationAll}}, PermissionOK},
+		{"read only", kafka.TopicDescription{AuthorizedOperations: []kafka.ACLOperation{kafka.ACLOperationDescribe, kafka.ACLOperationRead}}, PermissionDenied},
+		{"not authorized", kafka.TopicDescription{Error: kafka.NewError(kafka.ErrTopicAuthorizationFailed, "", false)}, PermissionDenied},
+		{"missing", kafka.TopicDescription{Error: kafka.NewError(kafka.ErrUnknownTopicOrPart, "", false)}, PermissionMissing},
+		{"not reported", kafka.TopicDescription{}, PermissionUnknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyTopic(tt.desc); got.Status != tt.want {
+				t.Errorf("classifyTopic() = %+v, want status %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,12 +1,21 @@
+//go:build cgo
+
 package kafka
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
 	"go.uber.org/zap"
+
+	"github.com/kahook/internal/delivery"
+	"github.com/kahook/internal/spool"
 )
 
 // Producer wraps a confluent-kafka-go producer with structured logging and
@@ -14,6 +23,24 @@ import (
 type Producer struct {
 	producer *kafka.Producer
 	logger   *zap.Logger
+	cycler   *partitionCycler // nil unless topics are round-robin
+	txn      *transactions    // nil unless the producer is transactional
+
+	events *BrokerEvents
+	down   atomic.Bool // a broker went down and nothing has succeeded since
+	done   chan struct{}
+
+	flushTimeout time.Duration
+	spill        *spool.Spool // nil drops undelivered messages
+
+	mu      sync.Mutex
+	pending map[*inflight]*kafka.Message // produced, awaiting a delivery report
+}
+
+// inflight carries a message's delivery report from the event loop to the
+// Produce call waiting for it, if it still is.
+type inflight struct {
+	report chan *kafka.Message
 }
 
 // ProducerConfig holds the configuration needed to create a Producer.
@@ -23,6 +50,29 @@ type ProducerConfig struct {
 	// outside of this package.
 	ConfigMap map[string]any
 	Logger    *zap.Logger
+
+	// RoundRobinTopics are topics whose keyless messages are spread over
+	// their partitions in turn rather than by the sticky partitioner.
+	RoundRobinTopics []string
+
+	// Events, if set, counts broker connection events. Producers may share
+	// one.
+	Events *BrokerEvents
+
+	// FlushTimeout bounds how long Close waits for buffered messages to be
+	// delivered. Zero means DefaultFlushTimeout.
+	FlushTimeout time.Duration
+
+	// Spill, if set, is where Close writes the messages still undelivered
+	// when FlushTimeout runs out, instead of dropping them.
+	Spill *spool.Spool
+
+	// TransactionMaxMessages caps how many messages are committed in one
+	// transaction when ConfigMap sets a transactional.id, and
+	// TransactionTimeout how long initializing or committing one may take.
+	// Zero means 100 and DefaultTransactionTimeout.
+	TransactionMaxMessages int
+	TransactionTimeout     time.Duration
 }
 
 // NewProducer creates a new Kafka producer.
@@ -37,22 +87,65 @@ func NewProducer(cfg ProducerConfig) (*Producer, error) {
 	}
 
 	p := &Producer{
-		producer: producer,
-		logger:   cfg.Logger,
+		producer:     producer,
+		logger:       cfg.Logger,
+		events:       cfg.Events,
+		done:         make(chan struct{}),
+		flushTimeout: cfg.FlushTimeout,
+		spill:        cfg.Spill,
+		pending:      make(map[*inflight]*kafka.Message),
+	}
+	if p.flushTimeout <= 0 {
+		p.flushTimeout = DefaultFlushTimeout
+	}
+	p.cycler = newPartitionCycler(cfg.RoundRobinTopics, p.partitionCount)
+	go p.watchEvents()
+
+	if transactionalID(cfg.ConfigMap) != "" {
+		if p.txn, err = initTransactions(p, cfg.TransactionMaxMessages, cfg.TransactionTimeout); err != nil {
+			producer.Close()
+			<-p.done
+			return nil, err
+		}
 	}
 
 	return p, nil
 }
 
+// partitionCount fetches topic's number of partitions from the brokers.
+func (p *Producer) partitionCount(topic string) (int, error) {
+	md, err := p.producer.GetMetadata(&topic, false, 3000)
+	if err != nil {
+		p.logger.Warn("failed to fetch partition count", zap.String("topic", topic), zap.Error(err))
+		return 0, err
+	}
+	t, ok := md.Topics[topic]
+	if !ok || t.Error.Code() != kafka.ErrNoError {
+		err := fmt.Errorf("no metadata for topic %q: %v", topic, t.Error)
+		p.logger.Warn("failed to fetch partition count", zap.String("topic", topic), zap.Error(err))
+		return 0, err
+	}
+	return len(t.Partitions), nil
+}
+
 // Produce sends a message to the specified topic and waits for delivery
-// confirmation or context cancellation.
+// confirmation or context cancellation. The partition and offset it was
+// written to are recorded in ctx's delivery.Recorder, if it has one. The
+// message holds copies of key and value: it stays pending, and may be
+// spilled by Close, after a cancelled Produce returns and the caller reuses
+// them.
 func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
 	msg := &kafka.Message{
 		TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: kafka.PartitionAny},
-		Key:            key,
-		Value:          value,
+		Key:            bytes.Clone(key),
+		Value:          bytes.Clone(value),
 		Timestamp:      time.Now(),
 	}
+	if len(key) == 0 {
+		if partition, ok := p.cycler.partition(topic); ok {
+			msg.TopicPartition.Partition = partition
+		}
+	}
 
 	if len(headers) > 0 {
 		msg.Headers = make([]kafka.Header, 0, len(headers))
@@ -61,33 +154,232 @@ func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte,
 		}
 	}
 
-	kafkaChan := make(chan kafka.Event, 1)
-	if err := p.producer.Produce(msg, kafkaChan); err != nil {
-		return fmt.Errorf("failed to produce message: %w", err)
+	delivered, err := p.deliver(ctx, msg)
+	if err != nil {
+		debugDelivery(ctx, p.logger, topic, -1, -1, err)
+		return err
+	}
+	debugDelivery(ctx, p.logger, topic, delivered.TopicPartition.Partition, int64(delivered.TopicPartition.Offset), nil)
+	delivery.Record(ctx, delivery.Report{
+		Partition: delivered.TopicPartition.Partition,
+		Offset:    int64(delivered.TopicPartition.Offset),
+		Timestamp: delivered.Timestamp,
+	})
+	return nil
+}
+
+// produce sends msg and waits for its delivery report, returning the
+// partition and offset the broker assigned.
+func (p *Producer) produce(ctx context.Context, msg *kafka.Message) (kafka.TopicPartition, error) {
+	delivered, err := p.deliver(ctx, msg)
+	if err != nil {
+		return kafka.TopicPartition{}, err
+	}
+	return delivered.TopicPartition, nil
+}
+
+// deliver produces msg and waits for its delivery report, returning the
+// message as delivered, with its partition, offset, and timestamp. The
+// message stays pending until its report arrives, even if ctx ends first,
+// so Close knows what is still undelivered. Transactional producers report
+// it delivered once its transaction commits.
+func (p *Producer) deliver(ctx context.Context, msg *kafka.Message) (*kafka.Message, error) {
+	if p.txn != nil {
+		return p.txn.deliver(ctx, msg)
+	}
+	f, err := p.send(msg)
+	if err != nil {
+		return nil, err
+	}
+	return p.await(ctx, f)
+}
+
+// send hands msg to librdkafka and tracks it as pending.
+func (p *Producer) send(msg *kafka.Message) (*inflight, error) {
+	f := &inflight{report: make(chan *kafka.Message, 1)}
+	msg.Opaque = f
+	p.mu.Lock()
+	p.pending[f] = msg
+	p.mu.Unlock()
+	if err := p.producer.Produce(msg, nil); err != nil {
+		p.delivered(f)
+		return nil, fmt.Errorf("failed to produce message: %w", topicError(err))
 	}
+	return f, nil
+}
 
+// await waits for the delivery report of a message sent with send.
+func (p *Producer) await(ctx context.Context, f *inflight) (*kafka.Message, error) {
 	select {
-	case e := <-kafkaChan:
-		switch ev := e.(type) {
-		case *kafka.Message:
-			if ev.TopicPartition.Error != nil {
-				return fmt.Errorf("message delivery failed: %w", ev.TopicPartition.Error)
+	case ev := <-f.report:
+		if ev.TopicPartition.Error != nil {
+			return nil, fmt.Errorf("message delivery failed: %w", topicError(ev.TopicPartition.Error))
+		}
+		p.brokersUp()
+		return ev, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("produce cancelled: %w", ctx.Err())
+	}
+}
+
+// librdkafkaError is a librdkafka error that reports, like the native
+// client's, whether the topic was the problem.
+type librdkafkaError struct {
+	err kafka.Error
+}
+
+// topicError wraps a librdkafka error in a librdkafkaError.
+func topicError(err error) error {
+	var ke kafka.Error
+	if errors.As(err, &ke) {
+		return librdkafkaError{ke}
+	}
+	return err
+}
+
+func (e librdkafkaError) Error() string { return e.err.Error() }
+func (e librdkafkaError) Unwrap() error { return e.err }
+
+// TopicAuthorizationFailed marks a produce refused because the client may
+// not write to the topic.
+func (e librdkafkaError) TopicAuthorizationFailed() bool {
+	return e.err.Code() == kafka.ErrTopicAuthorizationFailed
+}
+
+// UnknownTopic marks a produce to a topic the cluster does not have, as
+// reported by the broker or found missing from the metadata.
+func (e librdkafkaError) UnknownTopic() bool {
+	code := e.err.Code()
+	return code == kafka.ErrUnknownTopicOrPart || code == kafka.ErrUnknownTopic
+}
+
+// delivered removes f from the pending messages.
+func (p *Producer) delivered(f *inflight) {
+	p.mu.Lock()
+	delete(p.pending, f)
+	p.mu.Unlock()
+}
+
+// watchEvents hands delivery reports to the Produce calls waiting for them,
+// and logs and counts the client errors librdkafka reports, such as lost
+// broker connections and failed authentication, until the producer is
+// closed.
+func (p *Producer) watchEvents() {
+	defer close(p.done)
+	for e := range p.producer.Events() {
+		if m, ok := e.(*kafka.Message); ok {
+			if f, ok := m.Opaque.(*inflight); ok {
+				p.delivered(f)
+				f.report <- m
 			}
-			return nil
-		case kafka.Error:
-			return fmt.Errorf("kafka error: %w", ev)
+			continue
+		}
+		ev, ok := e.(kafka.Error)
+		if !ok {
+			continue
+		}
+		kind := brokerEventKind(ev.Code())
+		p.events.record(kind)
+		fields := []zap.Field{
+			zap.String("event", kind),
+			zap.String("code", ev.Code().String()),
+			zap.Bool("fatal", ev.IsFatal()),
+			zap.Error(ev),
+		}
+		switch kind {
+		case EventBrokerDown:
+			p.down.Store(true)
+			p.logger.Warn("kafka broker connection failed", fields...)
+		case EventAllBrokersDown:
+			p.down.Store(true)
+			p.logger.Error("all kafka brokers are down", fields...)
+		case EventAuthFailure:
+			p.logger.Error("kafka authentication or authorization failed", fields...)
 		default:
-			return fmt.Errorf("unexpected event type: %T", e)
+			p.logger.Warn("kafka client error", fields...)
 		}
-	case <-ctx.Done():
-		return fmt.Errorf("produce cancelled: %w", ctx.Err())
 	}
 }
 
-// Close flushes pending messages and closes the underlying producer.
+// brokerEventKind classifies a librdkafka error code.
+func brokerEventKind(code kafka.ErrorCode) string {
+	switch code {
+	case kafka.ErrTransport:
+		return EventBrokerDown
+	case kafka.ErrAllBrokersDown:
+		return EventAllBrokersDown
+	case kafka.ErrAuthentication, kafka.ErrSaslAuthenticationFailed,
+		kafka.ErrTopicAuthorizationFailed, kafka.ErrClusterAuthorizationFailed:
+		return EventAuthFailure
+	default:
+		return EventError
+	}
+}
+
+// brokersUp records that a broker answered after one went down.
+func (p *Producer) brokersUp() {
+	if p.down.CompareAndSwap(true, false) {
+		p.events.record(EventBrokersUp)
+		p.logger.Info("kafka brokers reachable again", zap.String("event", EventBrokersUp))
+	}
+}
+
+// Close waits up to the flush timeout for pending messages to be delivered,
+// then closes the underlying producer. Messages still undelivered are
+// written to the spill directory, if one is set, and are otherwise lost;
+// either way their number is logged. Transactional producers first commit
+// the messages already queued.
 func (p *Producer) Close() {
-	p.producer.Flush(5000)
+	if p.txn != nil {
+		p.txn.close()
+	}
+	r := p.drain()
+	p.cycler.wait()
 	p.producer.Close()
+	<-p.done
+
+	logDrain(p.logger, r, p.flushTimeout, p.spill)
+}
+
+// drain flushes the producer, then purges and spills what did not make it.
+func (p *Producer) drain() drainReport {
+	p.mu.Lock()
+	r := drainReport{pending: len(p.pending)}
+	p.mu.Unlock()
+
+	if p.producer.Flush(int(p.flushTimeout.Milliseconds())) == 0 {
+		return r
+	}
+
+	// Select the undelivered messages before purging, which reports each
+	// of them as failed.
+	p.mu.Lock()
+	msgs := make([]spilledMessage, 0, len(p.pending))
+	for _, m := range p.pending {
+		msgs = append(msgs, toSpilled(m))
+	}
+	p.mu.Unlock()
+	_ = p.producer.Purge(kafka.PurgeQueue | kafka.PurgeInFlight | kafka.PurgeNonBlocking)
+
+	r.unflushed = len(msgs)
+	if p.spill != nil && len(msgs) > 0 {
+		r.spillFile, r.spilled, r.spillErr = spill(p.spill, msgs)
+	}
+	return r
+}
+
+func toSpilled(m *kafka.Message) spilledMessage {
+	s := spilledMessage{key: m.Key, value: m.Value}
+	if m.TopicPartition.Topic != nil {
+		s.topic = *m.TopicPartition.Topic
+	}
+	if len(m.Headers) > 0 {
+		s.headers = make(map[string]string, len(m.Headers))
+		for _, h := range m.Headers {
+			s.headers[h.Key] = string(h.Value)
+		}
+	}
+	return s
 }
 
 // IsConnected performs a lightweight metadata fetch to verify the broker is
@@ -99,6 +391,11 @@ func (p *Producer) IsConnected() bool {
 	}
 	// GetMetadata with allTopics=false fetches only broker-level metadata.
 	// A successful call proves the TCP connection to at least one broker is live.
-	_, err := p.producer.GetMetadata(nil, false, 3000)
-	return err == nil
+	md, err := p.producer.GetMetadata(nil, false, 3000)
+	if err != nil {
+		return false
+	}
+	p.events.sawBrokers(len(md.Brokers))
+	p.brokersUp()
+	return true
 }
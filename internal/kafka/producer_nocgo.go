@@ -0,0 +1,121 @@
+//go:build !cgo
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/spool"
+)
+
+// ErrCgoRequired is returned by NewProducer in binaries built without cgo,
+// where the librdkafka-based client is unavailable.
+var ErrCgoRequired = errors.New("the kafka backend requires cgo (librdkafka); rebuild with CGO_ENABLED=1, set kafka.client: native, or choose another backend")
+
+// Producer is a placeholder in binaries built without cgo so that the rest of
+// the package, and callers selecting other backends, still compile.
+type Producer struct{}
+
+// ProducerConfig holds the configuration needed to create a Producer.
+type ProducerConfig struct {
+	ConfigMap              map[string]any
+	Logger                 *zap.Logger
+	RoundRobinTopics       []string
+	Events                 *BrokerEvents
+	FlushTimeout           time.Duration
+	Spill                  *spool.Spool
+	TransactionMaxMessages int
+	TransactionTimeout     time.Duration
+}
+
+// NewProducer always fails without cgo.
+func NewProducer(ProducerConfig) (*Producer, error) {
+	return nil, ErrCgoRequired
+}
+
+// Produce always fails without cgo.
+func (p *Producer) Produce(context.Context, string, []byte, []byte, map[string]string) error {
+	return ErrCgoRequired
+}
+
+// IsConnected always reports false without cgo.
+func (p *Producer) IsConnected() bool {
+	return false
+}
+
+// Close is a no-op without cgo.
+func (p *Producer) Close() {}
+
+// VerifierConfig configures a Verifier.
+type VerifierConfig struct {
+	ConfigMap map[string]any
+	Topic     string
+	Logger    *zap.Logger
+}
+
+// Verifier is a placeholder in binaries built without cgo.
+type Verifier struct{}
+
+// NewVerifier always fails without cgo.
+func NewVerifier(VerifierConfig) (*Verifier, error) {
+	return nil, ErrCgoRequired
+}
+
+// Verify always fails without cgo.
+func (v *Verifier) Verify(context.Context) (time.Duration, time.Duration, error) {
+	return 0, 0, ErrCgoRequired
+}
+
+// Close is a no-op without cgo.
+func (v *Verifier) Close() {}
+
+// CheckWritePermissions always fails without cgo.
+func CheckWritePermissions(context.Context, map[string]any, []string) ([]TopicPermission, error) {
+	return nil, ErrCgoRequired
+}
+
+// LagReader is a placeholder in binaries built without cgo.
+type LagReader struct{}
+
+// NewLagReader always fails without cgo.
+func NewLagReader(map[string]any) (*LagReader, error) {
+	return nil, ErrCgoRequired
+}
+
+// Lag always fails without cgo.
+func (r *LagReader) Lag(context.Context, string, string) (int64, error) {
+	return 0, ErrCgoRequired
+}
+
+// Close is a no-op without cgo.
+func (r *LagReader) Close() {}
+
+// BrokerClockConfig configures a BrokerClock.
+type BrokerClockConfig struct {
+	ConfigMap map[string]any
+	Topic     string
+	Logger    *zap.Logger
+}
+
+// BrokerClock is a placeholder in binaries built without cgo.
+type BrokerClock struct{}
+
+// NewBrokerClock always fails without cgo.
+func NewBrokerClock(BrokerClockConfig) (*BrokerClock, error) {
+	return nil, ErrCgoRequired
+}
+
+// Name returns "kafka".
+func (c *BrokerClock) Name() string { return "kafka" }
+
+// Offset always fails without cgo.
+func (c *BrokerClock) Offset(context.Context) (time.Duration, error) {
+	return 0, ErrCgoRequired
+}
+
+// Close is a no-op without cgo.
+func (c *BrokerClock) Close() {}
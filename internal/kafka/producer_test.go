@@ -0,0 +1,102 @@
+//go:build cgo
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/spool"
+)
+
+func TestBrokerEventKind(t *testing.T) {
+	tests := []struct {
+		code kafka.ErrorCode
+		want string
+	}{
+		{kafka.ErrTransport, EventBrokerDown},
+		{kafka.ErrAllBrokersDown, EventAllBrokersDown},
+		{kafka.ErrSaslAuthenticationFailed, EventAuthFailure},
+		{kafka.ErrTopicAuthorizationFailed, EventAuthFailure},
+		{kafka.ErrMsgTimedOut, EventError},
+	}
+	for _, tt := range tests {
+		if got := brokerEventKind(tt.code); got != tt.want {
+			t.Errorf("brokerEventKind(%v) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestTopicError(t *testing.T) {
+	tests := []struct {
+		code                  kafka.ErrorCode
+		authorization, absent bool
+	}{
+		{kafka.ErrTopicAuthorizationFailed, true, false},
+		{kafka.ErrUnknownTopicOrPart, false, true},
+		{kafka.ErrUnknownTopic, false, true},
+		{kafka.ErrMsgTimedOut, false, false},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("message delivery failed: %w", topicError(kafka.NewError(tt.code, "", false)))
+		var te librdkafkaError
+		if !errors.As(err, &te) {
+			t.Fatalf("%v: not a librdkafkaError", tt.code)
+		}
+		if te.TopicAuthorizationFailed() != tt.authorization || te.UnknownTopic() != tt.absent {
+			t.Errorf("%v: authorization failed = %v, unknown topic = %v", tt.code, te.TopicAuthorizationFailed(), te.UnknownTopic())
+		}
+	}
+}
+
+func TestProducerClose_SpillsUndelivered(t *testing.T) {
+	dir := t.TempDir()
+	sp, err := spool.New(spool.Config{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewProducer(ProducerConfig{
+		// Nothing listens here, so no message can be delivered.
+		ConfigMap:    map[string]any{"bootstrap.servers": "127.0.0.1:1", "log_level": 0},
+		Logger:       zap.NewNop(),
+		FlushTimeout: 200 * time.Millisecond,
+		Spill:        sp,
+	})
+	if err != nil {
+		t.Fatalf("NewProducer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	value := []byte(`{"id":1}`)
+	if err := p.Produce(ctx, "orders", []byte("k1"), value, nil); err == nil {
+		t.Fatal("Produce() succeeded without a broker")
+	}
+	// The caller recycles its buffer once Produce returns.
+	copy(value, `{"id":9}`)
+	p.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "kahook-spill-*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("spill files = %v, want one", files)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"topic":"orders","key":"k1"`) {
+		t.Errorf("spill file = %s", data)
+	}
+	if !strings.Contains(string(data), `"value":{"id":1}`) {
+		t.Errorf("spill file = %s, want the value as it was produced", data)
+	}
+}
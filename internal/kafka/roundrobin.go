@@ -0,0 +1,102 @@
+package kafka
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// partitionRefresh is how long a topic's partition count is trusted before
+// metadata is fetched again, so partitions added to a topic are picked up.
+const partitionRefresh = time.Minute
+
+// partitionCycler assigns keyless messages of selected topics to partitions
+// in turn, instead of leaving them to librdkafka's sticky partitioner, which
+// sends whole batches to one partition and makes it hot during bursts.
+type partitionCycler struct {
+	// count returns the topic's number of partitions, from broker metadata.
+	count func(topic string) (int, error)
+	now   func() time.Time
+
+	topics    map[string]*partitionCycle
+	refreshes sync.WaitGroup
+}
+
+// partitionCycle is one topic's counter and cached partition count.
+type partitionCycle struct {
+	next atomic.Uint64
+
+	mu         sync.Mutex
+	partitions int
+	fetched    time.Time
+	refreshing bool
+}
+
+// newPartitionCycler returns nil when no topic is cycled.
+func newPartitionCycler(topics []string, count func(string) (int, error)) *partitionCycler {
+	if len(topics) == 0 {
+		return nil
+	}
+	c := &partitionCycler{count: count, now: time.Now, topics: make(map[string]*partitionCycle, len(topics))}
+	for _, t := range topics {
+		c.topics[t] = &partitionCycle{}
+	}
+	return c
+}
+
+// partition returns the partition for the next keyless message to topic, and
+// false when the topic is not cycled or its partition count is unknown, in
+// which case the message is left to the partitioner. It never waits for
+// metadata: the count is fetched in the background, so messages before the
+// first fetch completes are left to the partitioner too.
+func (c *partitionCycler) partition(topic string) (int32, bool) {
+	if c == nil {
+		return 0, false
+	}
+	cycle, ok := c.topics[topic]
+	if !ok {
+		return 0, false
+	}
+	n := cycle.partitionCount(c, topic)
+	if n <= 0 {
+		return 0, false
+	}
+	return int32((cycle.next.Add(1) - 1) % uint64(n)), true
+}
+
+// partitionCount returns the cached partition count, starting a background
+// refresh when it is stale and none is running.
+func (p *partitionCycle) partitionCount(c *partitionCycler, topic string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.refreshing && (p.fetched.IsZero() || c.now().Sub(p.fetched) >= partitionRefresh) {
+		p.refreshing = true
+		c.refreshes.Add(1)
+		go p.refresh(c, topic)
+	}
+	return p.partitions
+}
+
+// refresh fetches the partition count without holding p.mu, so produces keep
+// the cached count meanwhile. A failed refresh keeps the last known count.
+func (p *partitionCycle) refresh(c *partitionCycler, topic string) {
+	defer c.refreshes.Done()
+	n, err := c.count(topic)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil && n > 0 {
+		p.partitions = n
+	}
+	// Failures are retried no sooner than successes, so an unreachable
+	// broker is not asked for metadata on every message.
+	p.fetched = c.now()
+	p.refreshing = false
+}
+
+// wait waits for running refreshes, which use the producer, to finish.
+func (c *partitionCycler) wait() {
+	if c != nil {
+		c.refreshes.Wait()
+	}
+}
@@ -0,0 +1,127 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPartitionCycler(t *testing.T) {
+	partitions := 3
+	var fetches int
+	var fail bool
+	c := newPartitionCycler([]string{"clicks"}, func(topic string) (int, error) {
+		fetches++
+		if fail {
+			return 0, errors.New("broker down")
+		}
+		return partitions, nil
+	})
+	now := time.Unix(0, 0)
+	c.now = func() time.Time { return now }
+
+	// The count is fetched in the background; until then the message is
+	// left to the partitioner.
+	if _, ok := c.partition("clicks"); ok {
+		t.Error("partition() assigned before the partition count was fetched")
+	}
+	c.wait()
+
+	var got []int32
+	for range 7 {
+		p, ok := c.partition("clicks")
+		if !ok {
+			t.Fatal("partition() not assigned for a round-robin topic")
+		}
+		got = append(got, p)
+	}
+	want := []int32{0, 1, 2, 0, 1, 2, 0}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("partitions = %v, want %v", got, want)
+		}
+	}
+	c.wait()
+	if fetches != 1 {
+		t.Errorf("metadata fetched %d times, want once while fresh", fetches)
+	}
+
+	if _, ok := c.partition("orders"); ok {
+		t.Error("partition() assigned for a topic that is not round-robin")
+	}
+
+	// A grown topic is picked up after the refresh interval. The stale
+	// count is served while the refresh runs.
+	partitions = 4
+	now = now.Add(partitionRefresh)
+	if p, ok := c.partition("clicks"); !ok || p > 2 {
+		t.Errorf("partition() during refresh = %d, %v, want one of the 3 known", p, ok)
+	}
+	c.wait()
+	seen := map[int32]bool{}
+	for range 4 {
+		p, _ := c.partition("clicks")
+		seen[p] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("partitions after refresh = %v, want all 4", seen)
+	}
+
+	// A failed refresh keeps the last known count.
+	fail = true
+	now = now.Add(partitionRefresh)
+	c.partition("clicks")
+	c.wait()
+	if p, ok := c.partition("clicks"); !ok || p > 3 {
+		t.Errorf("partition() after failed refresh = %d, %v, want one of the 4 known", p, ok)
+	}
+
+	var nilCycler *partitionCycler
+	if _, ok := nilCycler.partition("clicks"); ok {
+		t.Error("nil cycler assigned a partition")
+	}
+	nilCycler.wait()
+}
+
+func TestPartitionCycler_UnknownCount(t *testing.T) {
+	var fetches int
+	c := newPartitionCycler([]string{"clicks"}, func(string) (int, error) {
+		fetches++
+		return 0, errors.New("broker down")
+	})
+	for range 3 {
+		if _, ok := c.partition("clicks"); ok {
+			t.Error("partition() assigned without a partition count")
+		}
+		c.wait()
+	}
+	if fetches != 1 {
+		t.Errorf("metadata fetched %d times, want once until the refresh interval", fetches)
+	}
+}
+
+func TestPartitionCycler_RefreshDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	c := newPartitionCycler([]string{"clicks"}, func(string) (int, error) {
+		<-release
+		return 2, nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			c.partition("clicks")
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("partition() blocked on a metadata fetch")
+	}
+	close(release)
+	c.wait()
+	if _, ok := c.partition("clicks"); !ok {
+		t.Error("partition() not assigned once the count was fetched")
+	}
+}
@@ -0,0 +1,68 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Swappable is a Client whose producer can be replaced while it serves, so a
+// config reload can rebuild producers for new broker settings without
+// refusing webhooks. Produce calls in flight during a Swap finish on the
+// producer they started on, which is closed once they have.
+type Swappable struct {
+	current atomic.Pointer[swapEntry]
+}
+
+// swapEntry is one producer of a Swappable. Produce calls hold mu for
+// reading, so Swap can wait for them before closing it.
+type swapEntry struct {
+	client  Client
+	mu      sync.RWMutex
+	retired bool
+}
+
+// NewSwappable returns a Swappable producing through c.
+func NewSwappable(c Client) *Swappable {
+	s := &Swappable{}
+	s.current.Store(&swapEntry{client: c})
+	return s
+}
+
+// Produce sends the message through the current producer.
+func (s *Swappable) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	for {
+		e := s.current.Load()
+		e.mu.RLock()
+		if e.retired {
+			// Swapped out between the load and the lock; the new producer is
+			// already current.
+			e.mu.RUnlock()
+			continue
+		}
+		err := e.client.Produce(ctx, topic, key, value, headers)
+		e.mu.RUnlock()
+		return err
+	}
+}
+
+// IsConnected reports whether the current producer is connected.
+func (s *Swappable) IsConnected() bool {
+	return s.current.Load().client.IsConnected()
+}
+
+// Swap makes c the producer messages are sent through, then waits for the
+// Produce calls in flight on the previous producer and closes it, which
+// flushes the messages it still holds.
+func (s *Swappable) Swap(c Client) {
+	old := s.current.Swap(&swapEntry{client: c})
+	old.mu.Lock()
+	old.retired = true
+	old.mu.Unlock()
+	old.client.Close()
+}
+
+// Close closes the current producer.
+func (s *Swappable) Close() {
+	s.current.Load().client.Close()
+}
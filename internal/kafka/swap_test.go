@@ -0,0 +1,79 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// blockingMember holds Produce calls until release is closed.
+type blockingMember struct {
+	closeCounter
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingMember) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	close(b.started)
+	<-b.release
+	return b.closeCounter.Produce(ctx, topic, key, value, headers)
+}
+
+func TestSwappable_Swap(t *testing.T) {
+	old := &blockingMember{
+		closeCounter: closeCounter{fakeMember: fakeMember{connected: true}},
+		started:      make(chan struct{}),
+		release:      make(chan struct{}),
+	}
+	next := &closeCounter{fakeMember: fakeMember{connected: false}}
+	s := NewSwappable(old)
+
+	inFlight := make(chan error, 1)
+	go func() {
+		inFlight <- s.Produce(context.Background(), "events", []byte("k"), []byte("v"), nil)
+	}()
+	<-old.started
+
+	swapped := make(chan struct{})
+	go func() {
+		s.Swap(next)
+		close(swapped)
+	}()
+
+	// New messages go to the new producer while the old one drains.
+	deadline := time.Now().Add(5 * time.Second)
+	for s.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("IsConnected() still reports the old producer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.Produce(context.Background(), "events", nil, []byte("v"), nil); err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+	if next.produced != 1 {
+		t.Errorf("new producer produced %d, want 1", next.produced)
+	}
+	select {
+	case <-swapped:
+		t.Fatal("Swap() returned before the produce in flight finished")
+	case <-time.After(10 * time.Millisecond):
+	}
+	if got := old.closed.Load(); got != 0 {
+		t.Fatalf("old producer closed %d times while a produce was in flight", got)
+	}
+
+	close(old.release)
+	if err := <-inFlight; err != nil {
+		t.Errorf("in-flight Produce() error = %v", err)
+	}
+	<-swapped
+	if got := old.closed.Load(); got != 1 {
+		t.Errorf("old producer closed %d times, want 1", got)
+	}
+
+	s.Close()
+	if got := next.closed.Load(); got != 1 {
+		t.Errorf("Close() closed the new producer %d times, want 1", got)
+	}
+}
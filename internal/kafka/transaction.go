@@ -0,0 +1,219 @@
+//go:build cgo
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"go.uber.org/zap"
+)
+
+// transactions produces messages in Kafka transactions from one goroutine.
+// Messages queued while a transaction runs are committed together in the
+// next, up to max at a time. A message is reported delivered only once its
+// transaction commits; if any message of a transaction fails, the
+// transaction is aborted and all of them fail, and read_committed consumers
+// never see them.
+type transactions struct {
+	p       *Producer
+	max     int
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *txnRequest
+	done   chan struct{}
+}
+
+// txnRequest is a message waiting to be produced in a transaction.
+type txnRequest struct {
+	ctx    context.Context
+	msg    *kafka.Message
+	result chan txnResult
+}
+
+type txnResult struct {
+	msg *kafka.Message
+	err error
+}
+
+// initTransactions registers the producer's transactional ID with the
+// brokers, fencing any earlier producer with the same ID, and starts the
+// transaction loop.
+func initTransactions(p *Producer, max int, timeout time.Duration) (*transactions, error) {
+	if max <= 0 {
+		max = defaultTransactionBatch
+	}
+	if timeout <= 0 {
+		timeout = DefaultTransactionTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := p.producer.InitTransactions(ctx); err != nil {
+		return nil, fmt.Errorf("failed to initialize kafka transactions: %w", err)
+	}
+	t := &transactions{
+		p:       p,
+		max:     max,
+		timeout: timeout,
+		queue:   make(chan *txnRequest, max),
+		done:    make(chan struct{}),
+	}
+	go t.run()
+	return t, nil
+}
+
+// deliver queues msg for the next transaction and waits until it commits
+// or ctx ends. A message whose ctx ends before its transaction begins is
+// not produced.
+func (t *transactions) deliver(ctx context.Context, msg *kafka.Message) (*kafka.Message, error) {
+	req := &txnRequest{ctx: ctx, msg: msg, result: make(chan txnResult, 1)}
+	t.mu.RLock()
+	if t.closed {
+		t.mu.RUnlock()
+		return nil, errProducerClosed
+	}
+	select {
+	case t.queue <- req:
+		t.mu.RUnlock()
+	case <-ctx.Done():
+		t.mu.RUnlock()
+		return nil, fmt.Errorf("produce cancelled: %w", ctx.Err())
+	}
+
+	select {
+	case res := <-req.result:
+		return res.msg, res.err
+	case <-ctx.Done():
+		return nil, fmt.Errorf("produce cancelled: %w", ctx.Err())
+	}
+}
+
+func (t *transactions) run() {
+	defer close(t.done)
+	for req := range t.queue {
+		batch := []*txnRequest{req}
+	fill:
+		for len(batch) < t.max {
+			select {
+			case r, ok := <-t.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, r)
+			default:
+				break fill
+			}
+		}
+		t.commit(batch)
+	}
+}
+
+// commit produces the batch's live requests in one transaction and reports
+// the outcome to each.
+func (t *transactions) commit(batch []*txnRequest) {
+	live := batch[:0]
+	for _, r := range batch {
+		if err := r.ctx.Err(); err != nil {
+			r.result <- txnResult{err: fmt.Errorf("produce cancelled: %w", err)}
+			continue
+		}
+		live = append(live, r)
+	}
+	if len(live) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), t.timeout)
+	defer cancel()
+	delivered, err := t.transact(ctx, live)
+	for i, r := range live {
+		if err != nil {
+			r.result <- txnResult{err: err}
+			continue
+		}
+		r.result <- txnResult{msg: delivered[i]}
+	}
+}
+
+// transact produces the requests' messages in one transaction and commits
+// it, returning the messages as delivered.
+func (t *transactions) transact(ctx context.Context, batch []*txnRequest) ([]*kafka.Message, error) {
+	p := t.p
+	if err := p.producer.BeginTransaction(); err != nil {
+		var kerr kafka.Error
+		if errors.As(err, &kerr) && kerr.TxnRequiresAbort() {
+			t.abort(ctx, err)
+		}
+		return nil, fmt.Errorf("failed to begin kafka transaction: %w", err)
+	}
+
+	flights := make([]*inflight, 0, len(batch))
+	var err error
+	for _, r := range batch {
+		f, serr := p.send(r.msg)
+		if serr != nil {
+			err = serr
+			break
+		}
+		flights = append(flights, f)
+	}
+	delivered := make([]*kafka.Message, len(batch))
+	for i, f := range flights {
+		m, derr := p.await(ctx, f)
+		if derr != nil && err == nil {
+			err = derr
+		}
+		delivered[i] = m
+	}
+	if err == nil {
+		if err = t.commitTransaction(ctx); err == nil {
+			return delivered, nil
+		}
+	}
+	t.abort(ctx, err)
+	return nil, fmt.Errorf("kafka transaction aborted: %w", err)
+}
+
+// commitTransaction commits the current transaction, retrying errors
+// librdkafka reports as retriable until ctx ends.
+func (t *transactions) commitTransaction(ctx context.Context) error {
+	for {
+		err := t.p.producer.CommitTransaction(ctx)
+		var kerr kafka.Error
+		if err == nil || !errors.As(err, &kerr) || !kerr.IsRetriable() || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// abort aborts the current transaction after cause. A fatal error leaves
+// the producer unusable: every later transaction fails until kahook is
+// restarted.
+func (t *transactions) abort(ctx context.Context, cause error) {
+	var kerr kafka.Error
+	if errors.As(cause, &kerr) && kerr.IsFatal() {
+		t.p.logger.Error("kafka transactional producer failed fatally; restart to recover", zap.Error(cause))
+		return
+	}
+	if err := t.p.producer.AbortTransaction(ctx); err != nil {
+		t.p.logger.Error("failed to abort kafka transaction", zap.NamedError("cause", cause), zap.Error(err))
+	}
+}
+
+// close stops accepting messages and waits until those queued are
+// committed or have failed.
+func (t *transactions) close() {
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	<-t.done
+}
@@ -0,0 +1,55 @@
+package kafka
+
+import (
+	"fmt"
+	"time"
+)
+
+// Settings that make a producer transactional.
+const (
+	transactionalIDKey      = "transactional.id"
+	transactionTimeoutKey   = "transaction.timeout.ms"
+	defaultTransactionBatch = 100
+)
+
+// DefaultTransactionTimeout bounds a transaction when
+// ProducerConfig.TransactionTimeout is zero.
+const DefaultTransactionTimeout = time.Minute
+
+// transactionalID returns the transactional.id of cm, or "" for producers
+// that do not use transactions.
+func transactionalID(cm map[string]any) string {
+	id, _ := cm[transactionalIDKey].(string)
+	return id
+}
+
+// withoutTransactions returns a copy of cm without the transaction
+// settings, for producers outside the webhook path, such as probes. They
+// must not reuse the webhook producers' transactional ID, which would fence
+// them.
+func withoutTransactions(cm map[string]any) map[string]any {
+	out := make(map[string]any, len(cm))
+	for k, v := range cm {
+		if k != transactionalIDKey && k != transactionTimeoutKey {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// memberConfig returns the settings of the ith producer of a pool. Each
+// member of a transactional pool needs its own transactional ID, so the
+// index is appended to it.
+func memberConfig(cfg ProducerConfig, i int) ProducerConfig {
+	id := transactionalID(cfg.ConfigMap)
+	if id == "" {
+		return cfg
+	}
+	cm := make(map[string]any, len(cfg.ConfigMap))
+	for k, v := range cfg.ConfigMap {
+		cm[k] = v
+	}
+	cm[transactionalIDKey] = fmt.Sprintf("%s-%d", id, i)
+	cfg.ConfigMap = cm
+	return cfg
+}
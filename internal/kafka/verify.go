@@ -0,0 +1,139 @@
+//go:build cgo
+
+package kafka
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/v2/kafka"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// verifyGroupID is the consumer group used by verification consumers. They
+// assign partitions directly and never commit, so the group holds no state.
+const verifyGroupID = "kahook-verify"
+
+// VerifierConfig configures a Verifier.
+type VerifierConfig struct {
+	// ConfigMap holds the producer settings. The consumer reuses the
+	// connection and security settings from it, so both run as the same
+	// principal as the webhook producer. Its transaction settings are
+	// dropped: the probe is not produced in a transaction.
+	ConfigMap map[string]any
+	Topic     string
+	Logger    *zap.Logger
+}
+
+// Verifier checks the produce and consume path end to end by writing a probe
+// message to a verification topic and reading it back.
+type Verifier struct {
+	producer *Producer
+	consumer kafka.ConfigMap
+	topic    string
+	logger   *zap.Logger
+}
+
+// NewVerifier creates a Verifier with its own producer.
+func NewVerifier(cfg VerifierConfig) (*Verifier, error) {
+	producer, err := NewProducer(ProducerConfig{ConfigMap: withoutTransactions(cfg.ConfigMap), Logger: cfg.Logger})
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{
+		producer: producer,
+		consumer: consumerConfig(cfg.ConfigMap),
+		topic:    cfg.Topic,
+		logger:   cfg.Logger,
+	}, nil
+}
+
+// consumerConfig returns the settings for a verification consumer.
+func consumerConfig(producer map[string]any) kafka.ConfigMap {
+	cm := connectionConfig(producer)
+	cm["group.id"] = verifyGroupID
+	cm["enable.auto.commit"] = false
+	return cm
+}
+
+// connectionConfig keeps the connection, security, and identity settings of a
+// producer config and drops producer-only properties, so consumers and admin
+// clients connect as the same principal without configuration warnings.
+func connectionConfig(producer map[string]any) kafka.ConfigMap {
+	cm := kafka.ConfigMap{}
+	for k, v := range producer {
+		for _, prefix := range []string{"bootstrap.", "security.", "sasl.", "ssl.", "socket.", "client.", "broker."} {
+			if strings.HasPrefix(k, prefix) {
+				cm[k] = v
+				break
+			}
+		}
+	}
+	return cm
+}
+
+// Verify produces a probe to the verification topic and consumes it back from
+// the offset the broker reported, returning the produce latency and the full
+// round-trip time. It fails if either step fails or ctx expires first.
+func (v *Verifier) Verify(ctx context.Context) (produce, roundTrip time.Duration, err error) {
+	start := time.Now()
+	probe := []byte(uuid.NewString())
+
+	tp, err := v.producer.produce(ctx, &kafka.Message{
+		TopicPartition: kafka.TopicPartition{Topic: &v.topic, Partition: kafka.PartitionAny},
+		Key:            probe,
+		Value:          []byte(fmt.Sprintf(`{"kahook_probe":%q}`, probe)),
+		Timestamp:      start,
+	})
+	if err != nil {
+		return 0, 0, fmt.Errorf("produce to %s: %w", v.topic, err)
+	}
+	produce = time.Since(start)
+
+	if err := v.consume(ctx, tp, probe); err != nil {
+		return produce, 0, fmt.Errorf("consume from %s: %w", v.topic, err)
+	}
+	return produce, time.Since(start), nil
+}
+
+// consume reads tp from its offset until it finds the probe.
+func (v *Verifier) consume(ctx context.Context, tp kafka.TopicPartition, probe []byte) error {
+	consumer, err := kafka.NewConsumer(&v.consumer)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %w", err)
+	}
+	defer consumer.Close()
+
+	tp.Error = nil
+	if err := consumer.Assign([]kafka.TopicPartition{tp}); err != nil {
+		return fmt.Errorf("failed to assign partition: %w", err)
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("probe not read back: %w", err)
+		}
+		switch ev := consumer.Poll(100).(type) {
+		case *kafka.Message:
+			if bytes.Equal(ev.Key, probe) {
+				return nil
+			}
+		case kafka.Error:
+			// Authorization and other fatal errors will not clear up by
+			// polling again; transient ones are retried until ctx expires.
+			if ev.IsFatal() || ev.Code() == kafka.ErrTopicAuthorizationFailed || ev.Code() == kafka.ErrGroupAuthorizationFailed {
+				return ev
+			}
+			v.logger.Debug("verification consumer error", zap.Error(ev))
+		}
+	}
+}
+
+// Close closes the verification producer.
+func (v *Verifier) Close() {
+	v.producer.Close()
+}
@@ -0,0 +1,29 @@
+//go:build cgo
+
+package kafka
+
+import "testing"
+
+func TestConsumerConfig_KeepsConnectionSettingsOnly(t *testing.T) {
+	cm := consumerConfig(map[string]any{
+		"bootstrap.servers": "b:9092",
+		"security.protocol": "SASL_SSL",
+		"sasl.username":     "u",
+		"acks":              "all",
+		"compression.type":  "snappy",
+	})
+
+	for _, k := range []string{"bootstrap.servers", "security.protocol", "sasl.username", "group.id"} {
+		if _, ok := cm[k]; !ok {
+			t.Errorf("consumer config missing %s", k)
+		}
+	}
+	for _, k := range []string{"acks", "compression.type"} {
+		if _, ok := cm[k]; ok {
+			t.Errorf("consumer config should drop producer property %s", k)
+		}
+	}
+	if cm["enable.auto.commit"] != false {
+		t.Error("verification consumer must not commit offsets")
+	}
+}
@@ -0,0 +1,187 @@
+// Package keyexpr derives message keys from webhook payloads, so a topic
+// can be partitioned by a field of the event (a repository, a customer)
+// without the sender setting a key header it may not control. A key is
+// either the value at a JSONPath into the body or the output of a Go
+// template over the body and request headers.
+package keyexpr
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// MaxKeyBytes is the longest key an Extractor returns; longer keys are
+// treated as not found rather than truncated, which would merge
+// partitions silently.
+const MaxKeyBytes = 1024
+
+// Extractor derives a message key from a request. It is safe for
+// concurrent use.
+type Extractor struct {
+	path []segment          // set for a JSONPath
+	tmpl *template.Template // set for a template
+}
+
+// segment is one step of a JSONPath: an object member, or an array index
+// when index is non-negative.
+type segment struct {
+	name  string
+	index int
+}
+
+// Data is what a key template is executed with: .Body is the decoded JSON
+// body, with numbers kept exact, and .Headers the request headers, so
+// {{.Body.repository.id}} and {{.Headers.Get "X-GitHub-Event"}} both work.
+type Data struct {
+	Body    any
+	Headers http.Header
+}
+
+// Compile returns the Extractor for a JSONPath or a template; set exactly
+// one. Paths support the subset that selects a single value: $, .name,
+// ['name'], and [index], e.g. $.pull_request.head.repo['full_name'].
+func Compile(path, tmpl string) (*Extractor, error) {
+	switch {
+	case (path == "") == (tmpl == ""):
+		return nil, errors.New("set exactly one of path and template")
+	case path != "":
+		segs, err := parsePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("path %q: %w", path, err)
+		}
+		return &Extractor{path: segs}, nil
+	default:
+		t, err := template.New("key").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("template: %w", err)
+		}
+		return &Extractor{tmpl: t}, nil
+	}
+}
+
+// Extract returns the key for a request with header and body, and false
+// when the body is not JSON, the path or a template field is missing or
+// null, or the key is empty or longer than MaxKeyBytes. Strings are used
+// as is, other scalars in their JSON form, and objects and arrays as
+// compact JSON.
+func (e *Extractor) Extract(header http.Header, body []byte) (string, bool) {
+	var doc any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if dec.Decode(&doc) != nil {
+		return "", false
+	}
+
+	var key string
+	if e.tmpl != nil {
+		var buf strings.Builder
+		if e.tmpl.Execute(&buf, Data{Body: doc, Headers: header}) != nil {
+			return "", false
+		}
+		key = strings.TrimSpace(buf.String())
+	} else {
+		v, ok := lookup(doc, e.path)
+		if !ok || v == nil {
+			return "", false
+		}
+		key = format(v)
+	}
+	if key == "" || len(key) > MaxKeyBytes {
+		return "", false
+	}
+	return key, true
+}
+
+func lookup(v any, path []segment) (any, bool) {
+	for _, s := range path {
+		if s.index >= 0 {
+			arr, ok := v.([]any)
+			if !ok || s.index >= len(arr) {
+				return nil, false
+			}
+			v = arr[s.index]
+			continue
+		}
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[s.name]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func format(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+}
+
+// parsePath parses the supported JSONPath subset.
+func parsePath(p string) ([]segment, error) {
+	if !strings.HasPrefix(p, "$") {
+		return nil, errors.New("must start with $")
+	}
+	var segs []segment
+	for rest := p[1:]; rest != ""; {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, errors.New("recursive descent (..) is not supported")
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if name == "" || name == "*" {
+				return nil, fmt.Errorf("invalid member %q", name)
+			}
+			segs = append(segs, segment{name: name, index: -1})
+			rest = rest[end+1:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, errors.New("unterminated [")
+			}
+			seg, err := parseBracket(rest[1:end])
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected %q", rest)
+		}
+	}
+	if len(segs) == 0 {
+		return nil, errors.New("selects the whole body; name a field")
+	}
+	return segs, nil
+}
+
+func parseBracket(s string) (segment, error) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return segment{name: s[1 : len(s)-1], index: -1}, nil
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 {
+		return segment{}, fmt.Errorf("[%s] must be a quoted name or a non-negative index; wildcards, slices, and filters are not supported", s)
+	}
+	return segment{index: i}, nil
+}
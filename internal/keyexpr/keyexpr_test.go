@@ -0,0 +1,101 @@
+package keyexpr
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const pushEvent = `{
+  "ref": "refs/heads/main",
+  "repository": {"id": 1296269, "full_name": "octocat/Hello-World", "private": false, "owner.login": "octocat"},
+  "commits": [{"id": "6dcb09b"}, {"id": "7a8f3e1"}],
+  "labels": {"team": "core"},
+  "deleted": null
+}`
+
+func TestExtract_Path(t *testing.T) {
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"$.repository.id", "1296269", true},
+		{"$.repository.full_name", "octocat/Hello-World", true},
+		{"$.repository['owner.login']", "octocat", true},
+		{`$["ref"]`, "refs/heads/main", true},
+		{"$.repository.private", "false", true},
+		{"$.commits[1].id", "7a8f3e1", true},
+		{"$.labels", `{"team":"core"}`, true},
+		{"$.commits[2].id", "", false},
+		{"$.repository.missing", "", false},
+		{"$.ref.id", "", false},
+		{"$.deleted", "", false},
+	}
+	for _, tt := range tests {
+		e, err := Compile(tt.path, "")
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v", tt.path, err)
+		}
+		got, ok := e.Extract(nil, []byte(pushEvent))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: Extract() = %q, %v, want %q, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestExtract_Template(t *testing.T) {
+	header := http.Header{"X-Github-Event": {"push"}}
+	tests := []struct {
+		tmpl   string
+		want   string
+		wantOK bool
+	}{
+		{`{{.Body.repository.id}}`, "1296269", true},
+		{`{{.Headers.Get "X-GitHub-Event"}}:{{.Body.repository.full_name}}`, "push:octocat/Hello-World", true},
+		{` {{index .Body.commits 0 "id"}}` + "\n", "6dcb09b", true},
+		{`{{.Body.repository.missing}}`, "", false},
+		{`{{.Headers.Get "X-Missing"}}`, "", false},
+	}
+	for _, tt := range tests {
+		e, err := Compile("", tt.tmpl)
+		if err != nil {
+			t.Fatalf("Compile(%q) error = %v", tt.tmpl, err)
+		}
+		got, ok := e.Extract(header, []byte(pushEvent))
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("%s: Extract() = %q, %v, want %q, %v", tt.tmpl, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestExtract_Limits(t *testing.T) {
+	e, _ := Compile("$.id", "")
+	if _, ok := e.Extract(nil, []byte("not json")); ok {
+		t.Error("Extract() found a key in a non-JSON body")
+	}
+	long := `{"id":"` + strings.Repeat("x", MaxKeyBytes+1) + `"}`
+	if _, ok := e.Extract(nil, []byte(long)); ok {
+		t.Error("Extract() returned a key over MaxKeyBytes")
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	tests := []struct{ path, tmpl, wantErr string }{
+		{"", "", "exactly one"},
+		{"$.id", "{{.Body.id}}", "exactly one"},
+		{"repository.id", "", "must start with $"},
+		{"$", "", "whole body"},
+		{"$..id", "", "recursive descent"},
+		{"$.commits[*]", "", "wildcards"},
+		{"$.commits[0", "", "unterminated"},
+		{"$.a.", "", "invalid member"},
+		{"", "{{.Body.id", "template"},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.path, tt.tmpl)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("Compile(%q, %q) error = %v, want it to contain %q", tt.path, tt.tmpl, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Package lag watches how far consumer groups are behind on the topics
+// kahook produces to, so ingestion can push back on senders while a
+// downstream consumer catches up instead of burying it deeper.
+package lag
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultInterval is how often lag is checked when Config.Interval is zero.
+const DefaultInterval = 30 * time.Second
+
+// Source reads consumer group lag.
+type Source interface {
+	// Lag returns how many messages of topic group has not yet consumed.
+	Lag(ctx context.Context, group, topic string) (int64, error)
+}
+
+// Threshold is the lag a consumer group may build up on a topic. Once its
+// lag is over MaxLag the topic is lagging, until the lag falls to ResumeLag
+// or below; the gap keeps admission from flapping around one value.
+// ResumeLag defaults to half of MaxLag.
+type Threshold struct {
+	Topic     string
+	Group     string
+	MaxLag    int64
+	ResumeLag int64
+}
+
+// Config configures a Monitor.
+type Config struct {
+	Source     Source
+	Thresholds []Threshold
+	// Interval between checks after the first; zero means DefaultInterval.
+	Interval time.Duration
+	// Timeout bounds each group's check; zero means 10s.
+	Timeout time.Duration
+	Logger  *zap.Logger
+}
+
+// Monitor periodically checks consumer group lag against thresholds.
+type Monitor struct {
+	cfg Config
+
+	mu    sync.Mutex
+	state []groupState // by index into cfg.Thresholds
+}
+
+type groupState struct {
+	lag      int64
+	measured bool
+	lagging  bool
+}
+
+// New returns a Monitor; call Run to start checking.
+func New(cfg Config) *Monitor {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	cfg.Thresholds = slices.Clone(cfg.Thresholds)
+	for i, t := range cfg.Thresholds {
+		if t.ResumeLag <= 0 || t.ResumeLag >= t.MaxLag {
+			cfg.Thresholds[i].ResumeLag = t.MaxLag / 2
+		}
+	}
+	return &Monitor{cfg: cfg, state: make([]groupState, len(cfg.Thresholds))}
+}
+
+// Interval returns how often lag is checked.
+func (m *Monitor) Interval() time.Duration { return m.cfg.Interval }
+
+// Run checks immediately, then every Interval until ctx is done.
+func (m *Monitor) Run(ctx context.Context) {
+	m.Check(ctx)
+	ticker := time.NewTicker(m.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// Check reads every group's lag once. A group whose lag cannot be read
+// stops counting as lagging, so a monitoring failure never blocks
+// ingestion on its own.
+func (m *Monitor) Check(ctx context.Context) {
+	for i, t := range m.cfg.Thresholds {
+		checkCtx, cancel := context.WithTimeout(ctx, m.cfg.Timeout)
+		lag, err := m.cfg.Source.Lag(checkCtx, t.Group, t.Topic)
+		cancel()
+
+		fields := []zap.Field{zap.String("topic", t.Topic), zap.String("group", t.Group)}
+		m.mu.Lock()
+		s := &m.state[i]
+		was := s.lagging
+		if err != nil {
+			*s = groupState{}
+		} else {
+			s.lag, s.measured = lag, true
+			switch {
+			case lag > t.MaxLag:
+				s.lagging = true
+			case lag <= t.ResumeLag:
+				s.lagging = false
+			}
+		}
+		now := s.lagging
+		m.mu.Unlock()
+
+		if err != nil {
+			m.cfg.Logger.Warn("consumer lag check failed", append(fields, zap.Error(err))...)
+		}
+		fields = append(fields, zap.Int64("lag", lag), zap.Int64("max_lag", t.MaxLag))
+		switch {
+		case now && !was:
+			m.cfg.Logger.Warn("consumer group lagging; pushing back on webhooks to its topic", fields...)
+		case was && !now && err == nil:
+			m.cfg.Logger.Info("consumer group caught up; admitting webhooks to its topic", fields...)
+		case err == nil:
+			m.cfg.Logger.Debug("consumer lag check", fields...)
+		}
+	}
+}
+
+// Lagging reports whether any consumer group of topic is over its
+// threshold.
+func (m *Monitor) Lagging(topic string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t := range m.cfg.Thresholds {
+		if t.Topic == topic && m.state[i].lagging {
+			return true
+		}
+	}
+	return false
+}
+
+// LaggingTopics returns the topics with a consumer group over its
+// threshold, sorted.
+func (m *Monitor) LaggingTopics() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make(map[string]bool)
+	var topics []string
+	for i, t := range m.cfg.Thresholds {
+		if m.state[i].lagging && !seen[t.Topic] {
+			seen[t.Topic] = true
+			topics = append(topics, t.Topic)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// Lags returns the latest lag measured of each topic's consumer groups, by
+// topic and group.
+func (m *Monitor) Lags() map[string]map[string]int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lags := make(map[string]map[string]int64)
+	for i, t := range m.cfg.Thresholds {
+		if !m.state[i].measured {
+			continue
+		}
+		if lags[t.Topic] == nil {
+			lags[t.Topic] = make(map[string]int64)
+		}
+		lags[t.Topic][t.Group] = m.state[i].lag
+	}
+	return lags
+}
@@ -0,0 +1,88 @@
+package lag
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeSource returns lags by group, or err.
+type fakeSource struct {
+	lags map[string]int64
+	err  error
+}
+
+func (f *fakeSource) Lag(_ context.Context, group, _ string) (int64, error) {
+	return f.lags[group], f.err
+}
+
+func TestMonitor_Hysteresis(t *testing.T) {
+	src := &fakeSource{lags: map[string]int64{}}
+	m := New(Config{
+		Source: src,
+		Thresholds: []Threshold{
+			{Topic: "orders", Group: "billing", MaxLag: 1000},
+			{Topic: "orders", Group: "search", MaxLag: 100, ResumeLag: 80},
+			{Topic: "events", Group: "audit", MaxLag: 10},
+		},
+		Logger: zap.NewNop(),
+	})
+	ctx := context.Background()
+
+	steps := []struct {
+		name           string
+		billing, audit int64
+		err            error
+		want           []string
+	}{
+		{"under thresholds", 500, 10, nil, nil},
+		{"over max", 1001, 11, nil, []string{"events", "orders"}},
+		{"between resume and max", 600, 6, nil, []string{"events", "orders"}},
+		{"at resume", 500, 5, nil, nil},
+		{"check fails", 5000, 50, errors.New("broker down"), nil},
+	}
+	for _, st := range steps {
+		src.lags["billing"], src.lags["audit"], src.err = st.billing, st.audit, st.err
+		m.Check(ctx)
+		if got := m.LaggingTopics(); !slices.Equal(got, st.want) {
+			t.Errorf("%s: LaggingTopics() = %v, want %v", st.name, got, st.want)
+		}
+		if got := m.Lagging("orders"); got != slices.Contains(st.want, "orders") {
+			t.Errorf("%s: Lagging(orders) = %v", st.name, got)
+		}
+	}
+	if lags := m.Lags(); len(lags) != 0 {
+		t.Errorf("Lags() = %v after a failed check, want none", lags)
+	}
+
+	src.err = nil
+	m.Check(ctx)
+	if got := m.Lags()["orders"]; got["billing"] != 5000 || got["search"] != 0 {
+		t.Errorf("Lags()[orders] = %v", got)
+	}
+}
+
+func TestMonitor_RunStopsWithContext(t *testing.T) {
+	m := New(Config{
+		Source:     &fakeSource{},
+		Thresholds: []Threshold{{Topic: "orders", Group: "billing", MaxLag: 1}},
+		Interval:   time.Millisecond,
+		Logger:     zap.NewNop(),
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
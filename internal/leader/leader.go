@@ -0,0 +1,173 @@
+// Package leader runs background tasks that must run on exactly one replica
+// of a fleet, such as spool replay or a canary producer. Replicas compete for
+// a Lock; the holder runs every registered Task until it loses the lock.
+package leader
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// releaseTimeout bounds releasing the lock on shutdown, so a successor can
+// take over without waiting for the lease to expire.
+const releaseTimeout = 5 * time.Second
+
+// Task is a singleton background job. ctx is cancelled when this replica
+// stops being leader, and the task must return promptly when it is.
+type Task func(ctx context.Context)
+
+// Lock is a fleet-wide mutual exclusion lock with a lease.
+type Lock interface {
+	// TryAcquire acquires the lock, or renews it if already held, and
+	// reports whether this replica holds it afterwards.
+	TryAcquire(ctx context.Context) (bool, error)
+
+	// Release gives up the lock if this replica holds it.
+	Release(ctx context.Context) error
+}
+
+// Config holds the configuration needed to create a Coordinator.
+type Config struct {
+	Lock Lock
+
+	// RenewDeadline is how long the leader keeps running tasks while renewals
+	// fail. It must be shorter than the lock's lease, so a leader that cannot
+	// reach the lock stops before another replica can take it over.
+	RenewDeadline time.Duration
+
+	// RetryPeriod is how often the lock is acquired or renewed.
+	RetryPeriod time.Duration
+
+	Logger *zap.Logger
+}
+
+// Coordinator elects this replica leader through a Lock and runs the
+// registered tasks while it is.
+type Coordinator struct {
+	lock          Lock
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+	logger        *zap.Logger
+	now           func() time.Time
+
+	mu    sync.Mutex
+	tasks map[string]Task
+
+	leader atomic.Bool
+}
+
+// New creates a Coordinator. Nothing happens until Run is called.
+func New(cfg Config) *Coordinator {
+	return &Coordinator{
+		lock:          cfg.Lock,
+		renewDeadline: cfg.RenewDeadline,
+		retryPeriod:   cfg.RetryPeriod,
+		logger:        cfg.Logger,
+		now:           time.Now,
+		tasks:         make(map[string]Task),
+	}
+}
+
+// Register adds a task to run while this replica is leader. Tasks registered
+// after Run has started run from the next time leadership is acquired.
+func (c *Coordinator) Register(name string, task Task) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tasks[name] = task
+}
+
+// IsLeader reports whether this replica currently holds the lock.
+func (c *Coordinator) IsLeader() bool {
+	return c.leader.Load()
+}
+
+// Run competes for the lock until ctx is cancelled, then stops any running
+// tasks and releases the lock.
+func (c *Coordinator) Run(ctx context.Context) {
+	var (
+		term      *term
+		lastRenew time.Time
+	)
+	ticker := time.NewTicker(c.retryPeriod)
+	defer ticker.Stop()
+
+	for {
+		held, err := c.tryAcquire(ctx)
+		switch {
+		case held:
+			lastRenew = c.now()
+			if term == nil {
+				term = c.lead()
+			}
+		case term != nil && err == nil:
+			c.logger.Warn("leadership lost to another replica")
+			term = c.stepDown(term)
+		case term != nil && c.now().Sub(lastRenew) > c.renewDeadline:
+			c.logger.Warn("leadership lost: lock not renewed before deadline", zap.Error(err))
+			term = c.stepDown(term)
+		case err != nil && ctx.Err() == nil:
+			c.logger.Warn("leader lock unavailable", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if term != nil {
+				c.stepDown(term)
+				releaseCtx, cancel := context.WithTimeout(context.Background(), releaseTimeout)
+				if err := c.lock.Release(releaseCtx); err != nil {
+					c.logger.Warn("failed to release leader lock", zap.Error(err))
+				}
+				cancel()
+			}
+			return
+		}
+	}
+}
+
+func (c *Coordinator) tryAcquire(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.retryPeriod)
+	defer cancel()
+	return c.lock.TryAcquire(ctx)
+}
+
+// term is one period of leadership and the tasks started for it.
+type term struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// lead starts every registered task under a new term.
+func (c *Coordinator) lead() *term {
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &term{cancel: cancel}
+
+	c.mu.Lock()
+	names := make([]string, 0, len(c.tasks))
+	for name, task := range c.tasks {
+		names = append(names, name)
+		t.wg.Add(1)
+		go func(task Task) {
+			defer t.wg.Done()
+			task(ctx)
+		}(task)
+	}
+	c.mu.Unlock()
+
+	c.leader.Store(true)
+	c.logger.Info("elected leader", zap.Strings("tasks", names))
+	return t
+}
+
+// stepDown cancels t's tasks and waits for them to return. It returns nil
+// for the caller to store as the current term.
+func (c *Coordinator) stepDown(t *term) *term {
+	c.leader.Store(false)
+	t.cancel()
+	t.wg.Wait()
+	return nil
+}
@@ -0,0 +1,110 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeLock answers TryAcquire from a settable state.
+type fakeLock struct {
+	mu       sync.Mutex
+	held     bool
+	err      error
+	released bool
+}
+
+func (f *fakeLock) TryAcquire(context.Context) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.held && f.err == nil, f.err
+}
+
+func (f *fakeLock) Release(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.released = true
+	return nil
+}
+
+func (f *fakeLock) set(held bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.held, f.err = held, err
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestCoordinator_RunsTasksOnlyWhileLeader(t *testing.T) {
+	lock := &fakeLock{}
+	c := New(Config{Lock: lock, RenewDeadline: time.Hour, RetryPeriod: time.Millisecond, Logger: zap.NewNop()})
+
+	started, stopped := make(chan struct{}, 2), make(chan struct{}, 2)
+	c.Register("replay", func(ctx context.Context) {
+		started <- struct{}{}
+		<-ctx.Done()
+		stopped <- struct{}{}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx)
+		close(done)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if c.IsLeader() || len(started) != 0 {
+		t.Fatal("task started without holding the lock")
+	}
+
+	lock.set(true, nil)
+	<-started
+	waitFor(t, "leadership", c.IsLeader)
+
+	// Another replica takes the lock: the task is cancelled.
+	lock.set(false, nil)
+	<-stopped
+	waitFor(t, "step down", func() bool { return !c.IsLeader() })
+
+	lock.set(true, nil)
+	<-started
+	cancel()
+	<-done
+	<-stopped
+
+	if !lock.released {
+		t.Error("lock not released on shutdown")
+	}
+}
+
+func TestCoordinator_KeepsLeadingThroughBriefLockErrors(t *testing.T) {
+	lock := &fakeLock{held: true}
+	c := New(Config{Lock: lock, RenewDeadline: 200 * time.Millisecond, RetryPeriod: time.Millisecond, Logger: zap.NewNop()})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Run(ctx)
+	waitFor(t, "leadership", c.IsLeader)
+
+	lock.set(true, errors.New("api server unavailable"))
+	time.Sleep(10 * time.Millisecond)
+	if !c.IsLeader() {
+		t.Error("stepped down on a lock error within the renew deadline")
+	}
+
+	waitFor(t, "step down after the renew deadline", func() bool { return !c.IsLeader() })
+}
@@ -0,0 +1,300 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// serviceAccountDir holds the credentials Kubernetes mounts into every pod.
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// microTime is the layout of Kubernetes MicroTime fields.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// LeaseLock is a Lock backed by a coordination.k8s.io/v1 Lease, the same
+// mechanism Kubernetes controllers use. It talks to the API server directly
+// and needs get, create, and update on leases in its namespace.
+type LeaseLock struct {
+	name      string
+	namespace string
+	identity  string
+	duration  time.Duration
+
+	baseURL string
+	token   func() (string, error)
+	client  *http.Client
+	now     func() time.Time
+
+	// The lease is only considered expired once it has gone unchanged for
+	// its duration by this replica's clock, so clock skew between replicas
+	// cannot make a live lease look expired.
+	mu         sync.Mutex
+	observed   leaseSpec
+	observedAt time.Time
+}
+
+// LeaseConfig holds the configuration needed to create a LeaseLock.
+type LeaseConfig struct {
+	// Name and Namespace identify the Lease object. An empty Namespace means
+	// the pod's own namespace.
+	Name      string
+	Namespace string
+
+	// Identity names this replica in the lease; it must be unique in the
+	// fleet, so the pod name is the usual choice.
+	Identity string
+
+	// Duration is how long other replicas wait after the last renewal before
+	// taking the lease over.
+	Duration time.Duration
+}
+
+// NewInClusterLeaseLock creates a LeaseLock that authenticates with the
+// pod's service account.
+func NewInClusterLeaseLock(cfg LeaseConfig) (*LeaseLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes cluster: KUBERNETES_SERVICE_HOST is not set")
+	}
+
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("service account CA contains no certificates")
+	}
+
+	if cfg.Namespace == "" {
+		ns, err := os.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read service account namespace: %w", err)
+		}
+		cfg.Namespace = strings.TrimSpace(string(ns))
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+	}}
+	// Projected service account tokens rotate, so read the token per request.
+	token := func() (string, error) {
+		b, err := os.ReadFile(serviceAccountDir + "/token")
+		return strings.TrimSpace(string(b)), err
+	}
+	return newLeaseLock(cfg, "https://"+net.JoinHostPort(host, port), token, client), nil
+}
+
+func newLeaseLock(cfg LeaseConfig, baseURL string, token func() (string, error), client *http.Client) *LeaseLock {
+	return &LeaseLock{
+		name:      cfg.Name,
+		namespace: cfg.Namespace,
+		identity:  cfg.Identity,
+		duration:  cfg.Duration,
+		baseURL:   baseURL,
+		token:     token,
+		client:    client,
+		now:       time.Now,
+	}
+}
+
+// lease is the subset of a coordination.k8s.io/v1 Lease that LeaseLock uses.
+type lease struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Metadata   leaseMeta `json:"metadata"`
+	Spec       leaseSpec `json:"spec"`
+}
+
+type leaseMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// errConflict is returned when another replica wrote the lease first.
+var errConflict = errors.New("lease was modified concurrently")
+
+// TryAcquire implements Lock.
+func (l *LeaseLock) TryAcquire(ctx context.Context) (bool, error) {
+	now := l.now()
+	current, found, err := l.get(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		created := l.newLease(now)
+		err := l.write(ctx, http.MethodPost, l.collectionURL(), created)
+		if errors.Is(err, errConflict) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	spec := current.Spec
+	if spec.HolderIdentity != l.identity && spec.HolderIdentity != "" && !l.expired(spec, now) {
+		return false, nil
+	}
+
+	if spec.HolderIdentity != l.identity {
+		spec.HolderIdentity = l.identity
+		spec.AcquireTime = now.UTC().Format(microTime)
+		spec.LeaseTransitions++
+	}
+	spec.LeaseDurationSeconds = int(l.duration / time.Second)
+	spec.RenewTime = now.UTC().Format(microTime)
+	current.Spec = spec
+
+	err = l.write(ctx, http.MethodPut, l.objectURL(), current)
+	if errors.Is(err, errConflict) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Release implements Lock. It clears the holder so another replica can
+// acquire the lease on its next attempt rather than after it expires.
+func (l *LeaseLock) Release(ctx context.Context) error {
+	current, found, err := l.get(ctx)
+	if err != nil || !found || current.Spec.HolderIdentity != l.identity {
+		return err
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	current.Spec.RenewTime = l.now().UTC().Format(microTime)
+	err = l.write(ctx, http.MethodPut, l.objectURL(), current)
+	if errors.Is(err, errConflict) {
+		return nil
+	}
+	return err
+}
+
+// expired reports whether spec has gone unrenewed for its lease duration
+// since this replica first saw it.
+func (l *LeaseLock) expired(spec leaseSpec, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if spec != l.observed {
+		l.observed, l.observedAt = spec, now
+	}
+	return now.Sub(l.observedAt) > time.Duration(spec.LeaseDurationSeconds)*time.Second
+}
+
+func (l *LeaseLock) newLease(now time.Time) *lease {
+	ts := now.UTC().Format(microTime)
+	return &lease{
+		APIVersion: "coordination.k8s.io/v1",
+		Kind:       "Lease",
+		Metadata:   leaseMeta{Name: l.name, Namespace: l.namespace},
+		Spec: leaseSpec{
+			HolderIdentity:       l.identity,
+			LeaseDurationSeconds: int(l.duration / time.Second),
+			AcquireTime:          ts,
+			RenewTime:            ts,
+		},
+	}
+}
+
+func (l *LeaseLock) collectionURL() string {
+	return fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.baseURL, l.namespace)
+}
+
+func (l *LeaseLock) objectURL() string {
+	return l.collectionURL() + "/" + l.name
+}
+
+// get fetches the lease; found is false if it does not exist yet.
+func (l *LeaseLock) get(ctx context.Context) (current *lease, found bool, err error) {
+	resp, err := l.do(ctx, http.MethodGet, l.objectURL(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		current = &lease{}
+		if err := json.NewDecoder(resp.Body).Decode(current); err != nil {
+			return nil, false, fmt.Errorf("failed to decode lease: %w", err)
+		}
+		return current, true, nil
+	case http.StatusNotFound:
+		return nil, false, nil
+	default:
+		return nil, false, statusError(resp)
+	}
+}
+
+// write creates (POST) or updates (PUT) the lease. Updates carry the
+// resourceVersion that was read, so a concurrent writer makes it fail with
+// errConflict instead of being overwritten.
+func (l *LeaseLock) write(ctx context.Context, method, url string, body *lease) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := l.do(ctx, method, url, b)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return nil
+	case http.StatusConflict:
+		return errConflict
+	default:
+		return statusError(resp)
+	}
+}
+
+func (l *LeaseLock) do(ctx context.Context, method, url string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	token, err := l.token()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account token: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("lease request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("lease request failed: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
@@ -0,0 +1,155 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPIServer stores a single Lease and enforces resourceVersion on
+// updates, like the Kubernetes API server.
+type fakeAPIServer struct {
+	mu      sync.Mutex
+	lease   *lease
+	version int
+	tokens  []string
+}
+
+func (f *fakeAPIServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.tokens = append(f.tokens, r.Header.Get("Authorization"))
+
+	if !strings.HasPrefix(r.URL.Path, "/apis/coordination.k8s.io/v1/namespaces/ns/leases") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if f.lease == nil {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.lease)
+	case http.MethodPost:
+		if f.lease != nil {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.store(r, http.StatusCreated, w)
+	case http.MethodPut:
+		var l lease
+		_ = json.NewDecoder(r.Body).Decode(&l)
+		if f.lease == nil || l.Metadata.ResourceVersion != f.lease.Metadata.ResourceVersion {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.version++
+		l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.lease = &l
+	}
+}
+
+func (f *fakeAPIServer) store(r *http.Request, status int, w http.ResponseWriter) {
+	var l lease
+	_ = json.NewDecoder(r.Body).Decode(&l)
+	f.version++
+	l.Metadata.ResourceVersion = strconv.Itoa(f.version)
+	f.lease = &l
+	w.WriteHeader(status)
+}
+
+func (f *fakeAPIServer) holder() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.lease == nil {
+		return ""
+	}
+	return f.lease.Spec.HolderIdentity
+}
+
+func newTestLease(t *testing.T, api *httptest.Server, identity string, now *time.Time) *LeaseLock {
+	t.Helper()
+	l := newLeaseLock(LeaseConfig{Name: "kahook-leader", Namespace: "ns", Identity: identity, Duration: 15 * time.Second},
+		api.URL, func() (string, error) { return "sa-token", nil }, api.Client())
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestLeaseLock_AcquireRenewAndTakeOver(t *testing.T) {
+	fake := &fakeAPIServer{}
+	api := httptest.NewServer(fake)
+	defer api.Close()
+	ctx := context.Background()
+
+	now := time.Unix(1_700_000_000, 0)
+	a := newTestLease(t, api, "pod-a", &now)
+	b := newTestLease(t, api, "pod-b", &now)
+
+	if held, err := a.TryAcquire(ctx); !held || err != nil {
+		t.Fatalf("a.TryAcquire() = %v, %v; want it to create the lease", held, err)
+	}
+	if held, err := b.TryAcquire(ctx); held || err != nil {
+		t.Fatalf("b.TryAcquire() = %v, %v; want the lease held by a", held, err)
+	}
+
+	now = now.Add(10 * time.Second)
+	if held, err := a.TryAcquire(ctx); !held || err != nil {
+		t.Fatalf("a renew = %v, %v", held, err)
+	}
+
+	// b first saw a's renewal now; it must wait a full duration from here.
+	if held, _ := b.TryAcquire(ctx); held {
+		t.Fatal("b acquired a freshly renewed lease")
+	}
+	now = now.Add(16 * time.Second)
+	if held, err := b.TryAcquire(ctx); !held || err != nil {
+		t.Fatalf("b.TryAcquire() after expiry = %v, %v; want takeover", held, err)
+	}
+	if got := fake.holder(); got != "pod-b" {
+		t.Errorf("holder = %q, want pod-b", got)
+	}
+	if fake.lease.Spec.LeaseTransitions != 1 {
+		t.Errorf("LeaseTransitions = %d, want 1", fake.lease.Spec.LeaseTransitions)
+	}
+
+	if held, _ := a.TryAcquire(ctx); held {
+		t.Error("a still holds the lease after b took it over")
+	}
+	if fake.tokens[0] != "Bearer sa-token" {
+		t.Errorf("Authorization = %q, want the service account token", fake.tokens[0])
+	}
+}
+
+func TestLeaseLock_Release(t *testing.T) {
+	fake := &fakeAPIServer{}
+	api := httptest.NewServer(fake)
+	defer api.Close()
+	ctx := context.Background()
+
+	now := time.Unix(1_700_000_000, 0)
+	a := newTestLease(t, api, "pod-a", &now)
+	b := newTestLease(t, api, "pod-b", &now)
+
+	if held, err := a.TryAcquire(ctx); !held || err != nil {
+		t.Fatalf("a.TryAcquire() = %v, %v", held, err)
+	}
+	if err := b.Release(ctx); err != nil || fake.holder() != "pod-a" {
+		t.Fatalf("b.Release() = %v, holder %q; want a non-holder release to do nothing", err, fake.holder())
+	}
+	if err := a.Release(ctx); err != nil {
+		t.Fatalf("a.Release() = %v", err)
+	}
+
+	// A released lease is free immediately, without waiting for expiry.
+	if held, err := b.TryAcquire(ctx); !held || err != nil {
+		t.Errorf("b.TryAcquire() after release = %v, %v", held, err)
+	}
+}
@@ -0,0 +1,64 @@
+// Package logctx carries a request's log fields through the context, so
+// every layer that handles the request, down to the producer, logs with
+// them and each line can be traced back to the request that caused it.
+package logctx
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// fields are the log fields of one request. They are added to as the
+// request is handled, once its route and sender are known.
+type fields struct {
+	mu     sync.Mutex
+	fields []zap.Field
+}
+
+type fieldsKey struct{}
+
+// New returns a context carrying fs, to which Add appends.
+func New(ctx context.Context, fs ...zap.Field) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, &fields{fields: fs})
+}
+
+// Add appends fs to the fields ctx carries, replacing any of the same key.
+// It does nothing if ctx is not from New.
+func Add(ctx context.Context, fs ...zap.Field) {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, field := range fs {
+		replaced := false
+		for i := range f.fields {
+			if f.fields[i].Key == field.Key {
+				f.fields[i], replaced = field, true
+				break
+			}
+		}
+		if !replaced {
+			f.fields = append(f.fields, field)
+		}
+	}
+}
+
+// Logger returns base with the fields ctx carries, or base itself if it
+// carries none. The fields are only encoded if the logger writes a line.
+func Logger(ctx context.Context, base *zap.Logger) *zap.Logger {
+	f, ok := ctx.Value(fieldsKey{}).(*fields)
+	if !ok {
+		return base
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.fields) == 0 {
+		return base
+	}
+	return base.WithLazy(slices.Clone(f.fields)...)
+}
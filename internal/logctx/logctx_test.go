@@ -0,0 +1,40 @@
+package logctx
+
+import (
+	"context"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLogger(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	base := zap.New(core)
+
+	// Without fields, the base logger is used as it is.
+	if Logger(context.Background(), base) != base {
+		t.Error("Logger() without fields did not return the base logger")
+	}
+	Add(context.Background(), zap.String("topic", "orders")) // no-op
+
+	ctx := New(context.Background(), zap.String("request_id", "req-1"))
+	Add(ctx, zap.String("topic", "orders"), zap.String("route", "shop"))
+	Add(ctx, zap.String("topic", "invoices"))
+	Logger(ctx, base).Info("produced")
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d entries, want 1", len(entries))
+	}
+	got := entries[0].ContextMap()
+	want := map[string]any{"request_id": "req-1", "topic": "invoices", "route": "shop"}
+	if len(got) != len(want) {
+		t.Fatalf("fields = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
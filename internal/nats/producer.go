@@ -0,0 +1,186 @@
+// Package nats implements the server's producer interface on NATS JetStream
+// with the nats.go client. Produce waits for the JetStream publish
+// acknowledgement, so a successful return means the message is persisted in
+// a stream.
+package nats
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/redact"
+)
+
+// dialTimeout bounds connection establishment, including the CONNECT/PING
+// handshake.
+const dialTimeout = 5 * time.Second
+
+// pingTimeout bounds IsConnected so /ready fails fast.
+const pingTimeout = 3 * time.Second
+
+// KeyHeader carries the message key, which NATS has no native notion of.
+const KeyHeader = "Kahook-Key"
+
+// ErrNoStream is returned when no JetStream stream captures the subject.
+var ErrNoStream = errors.New("no jetstream stream for subject")
+
+// Producer publishes to JetStream subjects derived from topic names.
+type Producer struct {
+	url           *url.URL
+	subjectPrefix string
+	user, pass    string
+	token         string
+	tlsConfig     *tls.Config
+	logger        *zap.Logger
+
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// ProducerConfig holds the configuration needed to create a Producer.
+type ProducerConfig struct {
+	// URL is nats://host:port or tls://host:port. Credentials may be given
+	// in the URL user info (user:pass or a bare token).
+	URL string
+	// SubjectPrefix is prepended to the topic to form the subject, e.g.
+	// "webhooks." publishes topic "orders" to "webhooks.orders".
+	SubjectPrefix string
+	Username      string
+	Password      string
+	Token         string
+	// TLS forces a TLS connection even for nats:// URLs.
+	TLS    bool
+	Logger *zap.Logger
+}
+
+// NewProducer validates the configuration and starts connecting. A server
+// that cannot be reached yet does not fail it: the client keeps
+// reconnecting in the background, and IsConnected reports when it is up.
+func NewProducer(cfg ProducerConfig) (*Producer, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "nats" && u.Scheme != "tls") {
+		return nil, fmt.Errorf("invalid nats url %q: want nats://host:port or tls://host:port", redact.URL(cfg.URL))
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	p := &Producer{
+		url:           u,
+		subjectPrefix: cfg.SubjectPrefix,
+		user:          cfg.Username,
+		pass:          cfg.Password,
+		token:         cfg.Token,
+		logger:        logger,
+	}
+	if u.User != nil {
+		if pw, ok := u.User.Password(); ok {
+			p.user, p.pass = u.User.Username(), pw
+		} else {
+			p.token = u.User.Username()
+		}
+	}
+	if u.Scheme == "tls" || cfg.TLS {
+		p.tlsConfig = &tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}
+	}
+
+	// Credentials are passed as options, so the URL the client logs and
+	// reports carries none.
+	server := *u
+	server.User = nil
+	p.conn, err = nats.Connect(server.String(), p.options()...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create nats connection: %w", err)
+	}
+	p.js, err = jetstream.New(p.conn)
+	if err != nil {
+		p.conn.Close()
+		return nil, fmt.Errorf("failed to create jetstream context: %w", err)
+	}
+	return p, nil
+}
+
+// options returns the nats.go options for p's settings.
+func (p *Producer) options() []nats.Option {
+	opts := []nats.Option{
+		nats.Name("kahook"),
+		nats.Timeout(dialTimeout),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ConnectHandler(func(c *nats.Conn) {
+			p.logger.Info("connected to nats", zap.String("server", c.ConnectedAddr()))
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			p.logger.Info("connected to nats", zap.String("server", c.ConnectedAddr()))
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				p.logger.Warn("nats connection lost", zap.Error(err))
+			}
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, _ *nats.Subscription, err error) {
+			p.logger.Warn("nats server error", zap.Error(err))
+		}),
+	}
+	switch {
+	case p.user != "" || p.pass != "":
+		opts = append(opts, nats.UserInfo(p.user, p.pass))
+	case p.token != "":
+		opts = append(opts, nats.Token(p.token))
+	}
+	if p.tlsConfig != nil {
+		opts = append(opts, nats.Secure(p.tlsConfig))
+	}
+	return opts
+}
+
+// Subject returns the subject a topic is published to.
+func (p *Producer) Subject(topic string) string {
+	return p.subjectPrefix + topic
+}
+
+// Produce publishes the message and waits for the JetStream acknowledgement.
+// The key travels in KeyHeader. Header values are written as nats.go writes
+// them, with CR and LF replaced by spaces, so a key or header taken from the
+// request cannot add headers of its own.
+func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	msg := nats.NewMsg(p.Subject(topic))
+	msg.Data = value
+	if len(key) > 0 {
+		msg.Header.Set(KeyHeader, string(key))
+	}
+	for k, v := range headers {
+		msg.Header.Set(k, v)
+	}
+
+	if _, err := p.js.PublishMsg(ctx, msg); err != nil {
+		switch {
+		case errors.Is(err, jetstream.ErrNoStreamResponse):
+			return fmt.Errorf("message delivery failed: %w", ErrNoStream)
+		case ctx.Err() != nil:
+			return fmt.Errorf("produce cancelled: %w", ctx.Err())
+		}
+		return fmt.Errorf("message delivery failed: %w", err)
+	}
+	return nil
+}
+
+// IsConnected reports whether the connection is up and round-trips a PING.
+func (p *Producer) IsConnected() bool {
+	return p.conn.IsConnected() && p.conn.FlushTimeout(pingTimeout) == nil
+}
+
+// Close closes the connection. Publishes are acknowledged synchronously, so
+// nothing is left to flush.
+func (p *Producer) Close() {
+	p.conn.Close()
+}
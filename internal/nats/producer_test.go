@@ -0,0 +1,200 @@
+package nats
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// newTestServer runs an in-process NATS server with JetStream and a stream
+// WEBHOOKS capturing "webhooks.>" and "events". Subjects outside it have no
+// stream.
+func newTestServer(t *testing.T) (*server.Server, jetstream.Stream) {
+	t.Helper()
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	js, err := jetstream.New(nc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := js.CreateStream(context.Background(), jetstream.StreamConfig{
+		Name:     "WEBHOOKS",
+		Subjects: []string{"webhooks.>", "events"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, stream
+}
+
+func newTestProducer(t *testing.T, url, prefix string) *Producer {
+	t.Helper()
+	p, err := NewProducer(ProducerConfig{URL: url, SubjectPrefix: prefix, Logger: zap.NewNop()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestProduce(t *testing.T) {
+	srv, stream := newTestServer(t)
+	p := newTestProducer(t, srv.ClientURL(), "webhooks.")
+
+	err := p.Produce(context.Background(), "orders", []byte("k1"), []byte(`{"a":1}`), map[string]string{"X-Source": "test"})
+	if err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+
+	m, err := stream.GetMsg(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetMsg() error = %v", err)
+	}
+	if m.Subject != "webhooks.orders" {
+		t.Errorf("subject = %q, want webhooks.orders", m.Subject)
+	}
+	if string(m.Data) != `{"a":1}` {
+		t.Errorf("payload = %q", m.Data)
+	}
+	if m.Header.Get(KeyHeader) != "k1" || m.Header.Get("X-Source") != "test" {
+		t.Errorf("headers = %v", m.Header)
+	}
+}
+
+func TestProduce_HeaderInjection(t *testing.T) {
+	srv, stream := newTestServer(t)
+	p := newTestProducer(t, srv.ClientURL(), "webhooks.")
+
+	key := []byte("k1\r\nNats-Msg-Id: forged")
+	headers := map[string]string{"X-Source": "test\r\nX-Injected: yes"}
+	if err := p.Produce(context.Background(), "orders", key, []byte("x"), headers); err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+
+	m, err := stream.GetMsg(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetMsg() error = %v", err)
+	}
+	if _, ok := m.Header["Nats-Msg-Id"]; ok {
+		t.Errorf("key injected a header: %v", m.Header)
+	}
+	if _, ok := m.Header["X-Injected"]; ok {
+		t.Errorf("header value injected a header: %v", m.Header)
+	}
+	if got := m.Header.Get(KeyHeader); got != "k1  Nats-Msg-Id: forged" {
+		t.Errorf("key header = %q, want CR and LF replaced by spaces", got)
+	}
+}
+
+func TestProduce_Concurrent(t *testing.T) {
+	srv, stream := newTestServer(t)
+	p := newTestProducer(t, srv.ClientURL(), "")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- p.Produce(context.Background(), "events", nil, []byte("x"), nil)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Produce() error = %v", err)
+		}
+	}
+	info, err := stream.Info(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 50 {
+		t.Errorf("stream holds %d messages, want 50", info.State.Msgs)
+	}
+}
+
+func TestProduce_NoStream(t *testing.T) {
+	srv, _ := newTestServer(t)
+	p := newTestProducer(t, srv.ClientURL(), "nostream.")
+
+	err := p.Produce(context.Background(), "orders", nil, []byte("x"), nil)
+	if !errors.Is(err, ErrNoStream) {
+		t.Errorf("error = %v, want ErrNoStream", err)
+	}
+}
+
+func TestProduce_Cancelled(t *testing.T) {
+	srv, _ := newTestServer(t)
+	p := newTestProducer(t, srv.ClientURL(), "webhooks.")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := p.Produce(ctx, "orders", nil, []byte("x"), nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestIsConnected(t *testing.T) {
+	srv, _ := newTestServer(t)
+	if !newTestProducer(t, srv.ClientURL(), "").IsConnected() {
+		t.Error("IsConnected() = false with a live server")
+	}
+
+	// With nothing listening the producer is still created, and keeps
+	// trying in the background.
+	if newTestProducer(t, "nats://127.0.0.1:1", "").IsConnected() {
+		t.Error("IsConnected() = true with nothing listening")
+	}
+}
+
+func TestNewProducer_Credentials(t *testing.T) {
+	p := newTestProducer(t, "nats://alice:pw@127.0.0.1:1", "")
+	if p.user != "alice" || p.pass != "pw" {
+		t.Errorf("user/pass = %q/%q", p.user, p.pass)
+	}
+
+	p = newTestProducer(t, "tls://s3cr3t@127.0.0.1:1", "")
+	if p.token != "s3cr3t" || p.tlsConfig == nil {
+		t.Errorf("token URL should set token and TLS, got token=%q tls=%v", p.token, p.tlsConfig != nil)
+	}
+
+	if _, err := NewProducer(ProducerConfig{URL: "http://localhost:4222"}); err == nil {
+		t.Error("http scheme should be rejected")
+	}
+}
+
+func TestNewProducer_Auth(t *testing.T) {
+	opts := natstest.DefaultTestOptions
+	opts.Port = -1
+	opts.Username, opts.Password = "alice", "pw"
+	srv := natstest.RunServer(&opts)
+	t.Cleanup(srv.Shutdown)
+
+	ok := newTestProducer(t, "nats://alice:pw@"+srv.Addr().String(), "")
+	if !ok.IsConnected() {
+		t.Error("IsConnected() = false with valid credentials")
+	}
+	bad := newTestProducer(t, "nats://alice:wrong@"+srv.Addr().String(), "")
+	if bad.IsConnected() {
+		t.Error("IsConnected() = true with a wrong password")
+	}
+}
@@ -0,0 +1,190 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// LogRecord is a log entry. TraceID and SpanID, lowercase hex like a
+// Span's, tie it to the span it was logged under and may be empty.
+type LogRecord struct {
+	Time       time.Time
+	Level      zapcore.Level
+	Message    string
+	Attributes []Attribute
+	TraceID    string
+	SpanID     string
+}
+
+// LogExporter sends log records to a collector. It is safe for concurrent
+// use.
+type LogExporter struct {
+	*queue[LogRecord]
+	cfg      Config
+	resource []byte
+}
+
+// NewLogs validates cfg and starts a log exporter. Its Logger reports
+// failed exports, so it must not be a logger that exports through it.
+func NewLogs(cfg Config) (*LogExporter, error) {
+	cfg, u, err := setup(cfg, logsPath)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resourceOf(cfg)
+	if err != nil {
+		return nil, err
+	}
+	e := &LogExporter{cfg: cfg, resource: res}
+	e.queue = newQueue(cfg, u, "logs", e.encode)
+	return e, nil
+}
+
+// Export queues a log record. It never blocks: when the queue is full, or
+// the exporter has been shut down, the record is dropped.
+func (e *LogExporter) Export(r LogRecord) { e.queue.add(r) }
+
+// Core returns a zap core exporting the entries enab enables, for teeing
+// with the core that writes them locally. Fields become attributes, except
+// trace_id and span_id, which tie the record to its span. A fatal entry
+// flushes the records queued before the process exits.
+func (e *LogExporter) Core(enab zapcore.LevelEnabler) zapcore.Core {
+	return &logCore{LevelEnabler: enab, exporter: e}
+}
+
+type logCore struct {
+	zapcore.LevelEnabler
+	exporter *LogExporter
+	fields   []zapcore.Field
+}
+
+func (c *logCore) With(fields []zapcore.Field) zapcore.Core {
+	return &logCore{
+		LevelEnabler: c.LevelEnabler,
+		exporter:     c.exporter,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+	}
+}
+
+func (c *logCore) Check(e zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(e.Level) {
+		return ce.AddCore(e, c)
+	}
+	return ce
+}
+
+func (c *logCore) Write(e zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.fields {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	r := LogRecord{Time: e.Time, Level: e.Level, Message: e.Message}
+	if id, ok := enc.Fields["trace_id"].(string); ok {
+		r.TraceID = id
+		delete(enc.Fields, "trace_id")
+	}
+	if id, ok := enc.Fields["span_id"].(string); ok {
+		r.SpanID = id
+		delete(enc.Fields, "span_id")
+	}
+	if e.LoggerName != "" {
+		enc.Fields["logger"] = e.LoggerName
+	}
+	if e.Stack != "" {
+		enc.Fields["exception.stacktrace"] = e.Stack
+	}
+	keys := make([]string, 0, len(enc.Fields))
+	for k := range enc.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		r.Attributes = append(r.Attributes, Attribute{k, enc.Fields[k]})
+	}
+	c.exporter.Export(r)
+
+	if e.Level == zapcore.FatalLevel {
+		ctx, cancel := context.WithTimeout(context.Background(), c.exporter.cfg.Timeout)
+		defer cancel()
+		return c.exporter.Shutdown(ctx)
+	}
+	return nil
+}
+
+func (c *logCore) Sync() error { return nil }
+
+// The OTLP/JSON encoding of a batch of log records.
+type (
+	exportLogsRequest struct {
+		ResourceLogs []resourceLogs `json:"resourceLogs"`
+	}
+	resourceLogs struct {
+		Resource  json.RawMessage `json:"resource"`
+		ScopeLogs []scopeLogs     `json:"scopeLogs"`
+	}
+	scopeLogs struct {
+		Scope      scope           `json:"scope"`
+		LogRecords []jsonLogRecord `json:"logRecords"`
+	}
+	jsonLogRecord struct {
+		TimeUnixNano         string     `json:"timeUnixNano"`
+		ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+		SeverityNumber       int        `json:"severityNumber"`
+		SeverityText         string     `json:"severityText"`
+		Body                 anyValue   `json:"body"`
+		Attributes           []keyValue `json:"attributes,omitempty"`
+		TraceID              string     `json:"traceId,omitempty"`
+		SpanID               string     `json:"spanId,omitempty"`
+	}
+)
+
+// severityNumber maps a zap level to the OTLP severity number of its range.
+func severityNumber(l zapcore.Level) int {
+	switch {
+	case l <= zapcore.DebugLevel:
+		return 5
+	case l == zapcore.InfoLevel:
+		return 9
+	case l == zapcore.WarnLevel:
+		return 13
+	case l == zapcore.ErrorLevel:
+		return 17
+	default:
+		return 21
+	}
+}
+
+func (e *LogExporter) encode(batch []LogRecord) ([]byte, error) {
+	observed := strconv.FormatInt(time.Now().UnixNano(), 10)
+	records := make([]jsonLogRecord, len(batch))
+	for i, r := range batch {
+		jr := jsonLogRecord{
+			TimeUnixNano:         strconv.FormatInt(r.Time.UnixNano(), 10),
+			ObservedTimeUnixNano: observed,
+			SeverityNumber:       severityNumber(r.Level),
+			SeverityText:         r.Level.CapitalString(),
+			Body:                 anyValueOf(r.Message),
+			TraceID:              r.TraceID,
+			SpanID:               r.SpanID,
+		}
+		for _, a := range r.Attributes {
+			jr.Attributes = append(jr.Attributes, keyValue{Key: a.Key, Value: anyValueOf(a.Value)})
+		}
+		records[i] = jr
+	}
+	return json.Marshal(exportLogsRequest{ResourceLogs: []resourceLogs{{
+		Resource: e.resource,
+		ScopeLogs: []scopeLogs{{
+			Scope:      scope{Name: "kahook", Version: e.cfg.ServiceVersion},
+			LogRecords: records,
+		}},
+	}}})
+}
@@ -0,0 +1,80 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLogExporter_Core(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []map[string]any
+		paths    []string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		mu.Lock()
+		requests = append(requests, body)
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	// An endpoint given as the traces URL serves logs from the same base.
+	e, err := NewLogs(Config{Endpoint: collector.URL + "/v1/traces", ServiceName: "kahook", Interval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := zap.New(e.Core(zapcore.InfoLevel)).With(zap.String("topic", "orders"))
+	logger.Debug("not exported")
+	logger.Warn("produce failed",
+		zap.Error(errors.New("broker down")),
+		zap.Int("attempts", 3),
+		zap.String("trace_id", "4bf92f3577b34da6a3ce929d0e0e4736"),
+		zap.String("span_id", "00f067aa0ba902b7"),
+	)
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 1 || paths[0] != "/v1/logs" {
+		t.Fatalf("collector got %d requests at %v, want one at /v1/logs", len(requests), paths)
+	}
+	rl := requests[0]["resourceLogs"].([]any)[0].(map[string]any)
+	records := rl["scopeLogs"].([]any)[0].(map[string]any)["logRecords"].([]any)
+	if len(records) != 1 {
+		t.Fatalf("got %d log records, want the warning only", len(records))
+	}
+	r := records[0].(map[string]any)
+	if r["severityNumber"] != float64(13) || r["severityText"] != "WARN" ||
+		r["body"].(map[string]any)["stringValue"] != "produce failed" {
+		t.Errorf("record = %v, want the warning", r)
+	}
+	if r["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || r["spanId"] != "00f067aa0ba902b7" {
+		t.Errorf("record = %v, want it tied to its span", r)
+	}
+	attrs := make(map[string]map[string]any)
+	for _, a := range r["attributes"].([]any) {
+		kv := a.(map[string]any)
+		attrs[kv["key"].(string)] = kv["value"].(map[string]any)
+	}
+	if len(attrs) != 3 || attrs["topic"]["stringValue"] != "orders" ||
+		attrs["error"]["stringValue"] != "broker down" || attrs["attempts"]["intValue"] != "3" {
+		t.Errorf("attributes = %v, want topic, error, and attempts", attrs)
+	}
+	if exported, dropped := e.Stats(); exported != 1 || dropped != 0 {
+		t.Errorf("Stats() = %d, %d, want 1 exported", exported, dropped)
+	}
+}
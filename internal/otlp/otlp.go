@@ -0,0 +1,420 @@
+// Package otlp exports spans and logs to an OpenTelemetry collector with
+// OTLP/HTTP, using its JSON encoding, so kahook's request and produce spans
+// and its logs reach the collector without linking the OpenTelemetry SDK.
+// Spans and log records are queued and sent in batches from a background
+// goroutine; when the queue is full new ones are dropped rather than
+// slowing down requests.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// OTLP/HTTP paths spans and log records are posted to.
+const (
+	tracesPath = "/v1/traces"
+	logsPath   = "/v1/logs"
+)
+
+var signalPaths = []string{tracesPath, logsPath}
+
+// Defaults for the zero values of Config.
+const (
+	DefaultBatchSize = 512
+	DefaultQueueSize = 2048
+	DefaultInterval  = 5 * time.Second
+	DefaultTimeout   = 10 * time.Second
+)
+
+// SpanKind is the OTLP span kind.
+type SpanKind int
+
+// Span kinds kahook records.
+const (
+	KindServer   SpanKind = 2
+	KindProducer SpanKind = 4
+)
+
+// Span is a finished span. IDs are lowercase hex: 32 digits for TraceID,
+// 16 for SpanID and ParentSpanID. A non-empty Error marks the span failed.
+type Span struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   []Attribute
+	Error        string
+}
+
+// Attribute is a span or log record attribute. Value is a string, bool,
+// int, int64, or float64; other values are sent as strings, with maps and
+// slices encoded as JSON.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute { return Attribute{key, value} }
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute { return Attribute{key, value} }
+
+// Config configures an Exporter.
+type Config struct {
+	// Endpoint is the collector's base URL, e.g. http://otel-collector:4318.
+	// Spans are posted to its /v1/traces path and log records to /v1/logs;
+	// an Endpoint already ending with either is taken as the base URL
+	// followed by it.
+	Endpoint string
+
+	// Headers are sent with every export, e.g. a vendor's API key.
+	Headers map[string]string
+
+	// ServiceName and ServiceVersion identify kahook as the resource the
+	// spans belong to.
+	ServiceName    string
+	ServiceVersion string
+
+	// BatchSize is the most spans sent in one request, QueueSize the most
+	// waiting to be sent, and Interval how often a partial batch is sent.
+	// Zero means the defaults above.
+	BatchSize int
+	QueueSize int
+	Interval  time.Duration
+
+	// Timeout bounds each export request. Zero means DefaultTimeout.
+	Timeout time.Duration
+
+	Client *http.Client
+	Logger *zap.Logger
+}
+
+// Exporter sends spans to a collector. It is safe for concurrent use.
+type Exporter struct {
+	*queue[Span]
+	cfg      Config
+	resource []byte
+}
+
+// New validates cfg and starts the exporter.
+func New(cfg Config) (*Exporter, error) {
+	cfg, u, err := setup(cfg, tracesPath)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resourceOf(cfg)
+	if err != nil {
+		return nil, err
+	}
+	e := &Exporter{cfg: cfg, resource: res}
+	e.queue = newQueue(cfg, u, "spans", e.encode)
+	return e, nil
+}
+
+// Export queues a finished span. It never blocks: when the queue is full,
+// or the exporter has been shut down, the span is dropped.
+func (e *Exporter) Export(s Span) { e.queue.add(s) }
+
+// setup validates cfg, fills in its defaults, and returns the URL of the
+// signal posted to path.
+func setup(cfg Config, path string) (Config, string, error) {
+	u, err := url.Parse(cfg.Endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cfg, "", fmt.Errorf("otlp endpoint %q must be an http or https URL", cfg.Endpoint)
+	}
+	// An endpoint given as one signal's URL is used for the others too.
+	for _, p := range signalPaths {
+		u.Path = strings.TrimSuffix(u.Path, p)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultBatchSize
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = zap.NewNop()
+	}
+	return cfg, u.String(), nil
+}
+
+// resourceOf encodes the resource cfg describes.
+func resourceOf(cfg Config) ([]byte, error) {
+	resource := []keyValue{{Key: "service.name", Value: anyValueOf(cfg.ServiceName)}}
+	if cfg.ServiceVersion != "" {
+		resource = append(resource, keyValue{Key: "service.version", Value: anyValueOf(cfg.ServiceVersion)})
+	}
+	return json.Marshal(map[string]any{"attributes": resource})
+}
+
+// queue batches one signal's items and posts them to the collector from a
+// background goroutine. The signal ("spans", "logs") names them in errors
+// and logs.
+type queue[T any] struct {
+	cfg    Config
+	url    string
+	signal string
+	encode func([]T) ([]byte, error)
+
+	mu     sync.Mutex
+	closed bool
+	items  chan T
+	done   chan struct{}
+
+	exported atomic.Int64
+	dropped  atomic.Int64
+}
+
+func newQueue[T any](cfg Config, url, signal string, encode func([]T) ([]byte, error)) *queue[T] {
+	q := &queue[T]{
+		cfg:    cfg,
+		url:    url,
+		signal: signal,
+		encode: encode,
+		items:  make(chan T, cfg.QueueSize),
+		done:   make(chan struct{}),
+	}
+	go q.run()
+	return q
+}
+
+// add queues an item, or drops it when the queue is full or shut down.
+func (q *queue[T]) add(item T) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		q.dropped.Add(1)
+		return
+	}
+	select {
+	case q.items <- item:
+	default:
+		q.dropped.Add(1)
+	}
+}
+
+// Stats returns the number of items exported and dropped, including those
+// lost to failed exports.
+func (q *queue[T]) Stats() (exported, dropped int64) {
+	return q.exported.Load(), q.dropped.Load()
+}
+
+// Shutdown stops accepting items and waits until those queued are sent or
+// ctx ends.
+func (q *queue[T]) Shutdown(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.items)
+	}
+	q.mu.Unlock()
+
+	select {
+	case <-q.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("otlp: %d %s not exported: %w", len(q.items), q.signal, ctx.Err())
+	}
+}
+
+func (q *queue[T]) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.cfg.Interval)
+	defer ticker.Stop()
+
+	batch := make([]T, 0, q.cfg.BatchSize)
+	for {
+		select {
+		case item, ok := <-q.items:
+			if !ok {
+				q.send(batch)
+				return
+			}
+			batch = append(batch, item)
+			if len(batch) < q.cfg.BatchSize {
+				continue
+			}
+		case <-ticker.C:
+		}
+		q.send(batch)
+		batch = batch[:0]
+	}
+}
+
+// send posts batch to the collector. Failed batches are dropped, not
+// retried: telemetry is diagnostics, and retrying would hold up newer items.
+func (q *queue[T]) send(batch []T) {
+	if len(batch) == 0 {
+		return
+	}
+	err := q.post(batch)
+	if err != nil {
+		q.dropped.Add(int64(len(batch)))
+		q.cfg.Logger.Warn("failed to export "+q.signal,
+			zap.Int(q.signal, len(batch)),
+			zap.Error(err),
+		)
+		return
+	}
+	q.exported.Add(int64(len(batch)))
+}
+
+func (q *queue[T]) post(batch []T) error {
+	body, err := q.encode(batch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), q.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, q.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range q.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := q.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/JSON encoding of a batch: IDs are hex, timestamps and 64-bit
+// integers are decimal strings.
+type (
+	exportRequest struct {
+		ResourceSpans []resourceSpans `json:"resourceSpans"`
+	}
+	resourceSpans struct {
+		Resource   json.RawMessage `json:"resource"`
+		ScopeSpans []scopeSpans    `json:"scopeSpans"`
+	}
+	scopeSpans struct {
+		Scope scope      `json:"scope"`
+		Spans []jsonSpan `json:"spans"`
+	}
+	scope struct {
+		Name    string `json:"name"`
+		Version string `json:"version,omitempty"`
+	}
+	jsonSpan struct {
+		TraceID           string     `json:"traceId"`
+		SpanID            string     `json:"spanId"`
+		ParentSpanID      string     `json:"parentSpanId,omitempty"`
+		Name              string     `json:"name"`
+		Kind              SpanKind   `json:"kind"`
+		StartTimeUnixNano string     `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+		Attributes        []keyValue `json:"attributes,omitempty"`
+		Status            *status    `json:"status,omitempty"`
+	}
+	keyValue struct {
+		Key   string   `json:"key"`
+		Value anyValue `json:"value"`
+	}
+	anyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+	status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// statusError is the OTLP status code of a failed span.
+const statusError = 2
+
+func (e *Exporter) encode(batch []Span) ([]byte, error) {
+	spans := make([]jsonSpan, len(batch))
+	for i, s := range batch {
+		js := jsonSpan{
+			TraceID:           s.TraceID,
+			SpanID:            s.SpanID,
+			ParentSpanID:      s.ParentSpanID,
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		for _, a := range s.Attributes {
+			js.Attributes = append(js.Attributes, keyValue{Key: a.Key, Value: anyValueOf(a.Value)})
+		}
+		if s.Error != "" {
+			js.Status = &status{Code: statusError, Message: s.Error}
+		}
+		spans[i] = js
+	}
+	return json.Marshal(exportRequest{ResourceSpans: []resourceSpans{{
+		Resource: e.resource,
+		ScopeSpans: []scopeSpans{{
+			Scope: scope{Name: "kahook", Version: e.cfg.ServiceVersion},
+			Spans: spans,
+		}},
+	}}})
+}
+
+func anyValueOf(v any) anyValue {
+	switch v := v.(type) {
+	case string:
+		return anyValue{StringValue: &v}
+	case bool:
+		return anyValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return anyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return anyValue{IntValue: &s}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	case time.Time:
+		s := v.Format(time.RFC3339Nano)
+		return anyValue{StringValue: &s}
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return anyValueOf(fmt.Sprint(v))
+		}
+		return anyValueOf(string(b))
+	default:
+		s := fmt.Sprint(v)
+		return anyValue{StringValue: &s}
+	}
+}
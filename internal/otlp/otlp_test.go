@@ -0,0 +1,122 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExporter_SendsBatches(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []map[string]any
+		paths    []string
+	)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decode export: %v", err)
+		}
+		if r.Header.Get("Authorization") != "Bearer k" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		mu.Lock()
+		requests = append(requests, body)
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer collector.Close()
+
+	e, err := New(Config{
+		Endpoint:    collector.URL,
+		Headers:     map[string]string{"Authorization": "Bearer k"},
+		ServiceName: "kahook",
+		BatchSize:   2,
+		Interval:    time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(1700000000, 0)
+	for i := 0; i < 3; i++ {
+		e.Export(Span{
+			TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+			SpanID:     "00f067aa0ba902b7",
+			Name:       "POST /{topic}",
+			Kind:       KindServer,
+			Start:      start,
+			End:        start.Add(time.Millisecond),
+			Attributes: []Attribute{String("url.path", "/orders"), Int("http.response.status_code", 202)},
+			Error:      "failed",
+		})
+	}
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requests) != 2 {
+		t.Fatalf("collector got %d requests, want a full batch and the rest at shutdown", len(requests))
+	}
+	if paths[0] != "/v1/traces" {
+		t.Errorf("path = %q, want /v1/traces", paths[0])
+	}
+	rs := requests[0]["resourceSpans"].([]any)[0].(map[string]any)
+	service := rs["resource"].(map[string]any)["attributes"].([]any)[0].(map[string]any)
+	if service["key"] != "service.name" || service["value"].(map[string]any)["stringValue"] != "kahook" {
+		t.Errorf("resource attribute = %v, want service.name", service)
+	}
+	spans := rs["scopeSpans"].([]any)[0].(map[string]any)["spans"].([]any)
+	if len(spans) != 2 {
+		t.Fatalf("first batch has %d spans, want 2", len(spans))
+	}
+	span := spans[0].(map[string]any)
+	if span["traceId"] != "4bf92f3577b34da6a3ce929d0e0e4736" || span["kind"] != float64(KindServer) || span["startTimeUnixNano"] != "1700000000000000000" {
+		t.Errorf("span = %v", span)
+	}
+	code := span["attributes"].([]any)[1].(map[string]any)["value"].(map[string]any)["intValue"]
+	if code != "202" {
+		t.Errorf("intValue = %v, want \"202\"", code)
+	}
+	if span["status"].(map[string]any)["code"] != float64(statusError) {
+		t.Errorf("status = %v, want an error", span["status"])
+	}
+	if exported, dropped := e.Stats(); exported != 3 || dropped != 0 {
+		t.Errorf("Stats() = %d, %d, want 3 exported", exported, dropped)
+	}
+
+	e.Export(Span{})
+	if _, dropped := e.Stats(); dropped != 1 {
+		t.Errorf("dropped = %d after shutdown, want 1", dropped)
+	}
+}
+
+func TestExporter_CountsFailedExports(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer collector.Close()
+
+	e, err := New(Config{Endpoint: collector.URL + "/v1/traces"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Export(Span{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"})
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if exported, dropped := e.Stats(); exported != 0 || dropped != 1 {
+		t.Errorf("Stats() = %d, %d, want the span dropped", exported, dropped)
+	}
+}
+
+func TestNew_RejectsBadEndpoint(t *testing.T) {
+	for _, endpoint := range []string{"", "otel-collector:4318", "grpc://otel:4317"} {
+		if _, err := New(Config{Endpoint: endpoint}); err == nil {
+			t.Errorf("New(%q) error = nil, want an invalid endpoint", endpoint)
+		}
+	}
+}
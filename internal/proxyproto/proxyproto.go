@@ -0,0 +1,275 @@
+// Package proxyproto implements the receiving side of the HAProxy PROXY
+// protocol (versions 1 and 2), which TCP load balancers such as AWS NLB use
+// to pass the original client address to the backend.
+//
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt.
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// v2Signature starts every version 2 header.
+var v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// v1MaxLen is the longest valid version 1 header, CRLF included.
+const v1MaxLen = 107
+
+// ErrNoHeader is returned when a trusted connection that must carry a header
+// does not start with one.
+var ErrNoHeader = errors.New("proxyproto: missing PROXY protocol header")
+
+// Config controls which connections may carry a header.
+type Config struct {
+	// Trusted lists the networks of the load balancers allowed to send
+	// headers. Headers are only parsed on connections from these networks;
+	// on others, the bytes are left for HTTP, which rejects them. This keeps
+	// clients that reach the listener directly from spoofing their address.
+	Trusted []*net.IPNet
+	// Required rejects trusted connections that do not start with a header.
+	// Otherwise such connections are served with their own address.
+	Required bool
+	// HeaderTimeout bounds the wait for the header; zero means 5 seconds.
+	HeaderTimeout time.Duration
+}
+
+// ParseCIDRs parses networks in CIDR notation. Bare IPs are accepted as
+// single-address networks.
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP or CIDR %q", c)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP or CIDR %q: %w", c, err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// Listener wraps a net.Listener and returns connections that report the
+// client address from the PROXY header.
+type Listener struct {
+	net.Listener
+	cfg Config
+}
+
+// NewListener wraps ln.
+func NewListener(ln net.Listener, cfg Config) *Listener {
+	if cfg.HeaderTimeout <= 0 {
+		cfg.HeaderTimeout = 5 * time.Second
+	}
+	return &Listener{Listener: ln, cfg: cfg}
+}
+
+// Accept returns the next connection. The header is read lazily, on the
+// first Read or RemoteAddr, so a slow client cannot stall the accept loop.
+func (l *Listener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{
+		Conn:    c,
+		br:      bufio.NewReader(c),
+		trusted: l.trusted(c.RemoteAddr()),
+		cfg:     l.cfg,
+	}, nil
+}
+
+func (l *Listener) trusted(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, n := range l.cfg.Trusted {
+		if n.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Conn is a connection whose addresses come from its PROXY header, if any.
+type Conn struct {
+	net.Conn
+	br      *bufio.Reader
+	trusted bool
+	cfg     Config
+
+	once     sync.Once
+	err      error
+	src, dst net.Addr
+}
+
+func (c *Conn) init() {
+	c.once.Do(func() {
+		if !c.trusted {
+			return
+		}
+		_ = c.Conn.SetReadDeadline(time.Now().Add(c.cfg.HeaderTimeout))
+		c.src, c.dst, c.err = readHeader(c.br, c.cfg.Required)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			_ = c.Conn.Close()
+		}
+	})
+}
+
+// Read reads from the connection after the header.
+func (c *Conn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.br.Read(b)
+}
+
+// RemoteAddr returns the client address from the header, or the peer address
+// when there is none.
+func (c *Conn) RemoteAddr() net.Addr {
+	c.init()
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address from the header, or the local
+// address when there is none.
+func (c *Conn) LocalAddr() net.Addr {
+	c.init()
+	if c.dst != nil {
+		return c.dst
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readHeader consumes a v1 or v2 header from br. It returns nil addresses for
+// headers that carry none (v1 UNKNOWN, v2 LOCAL, non-TCP families) and, when
+// required is false, for connections without a header.
+func readHeader(br *bufio.Reader, required bool) (src, dst net.Addr, err error) {
+	peek, err := br.Peek(len(v2Signature))
+	switch {
+	case err == nil && bytes.Equal(peek, v2Signature):
+		return readV2(br)
+	case err == nil && bytes.HasPrefix(peek, []byte("PROXY ")):
+		return readV1(br)
+	case required:
+		return nil, nil, ErrNoHeader
+	default:
+		// Short first reads are fine: the connection carries no header.
+		return nil, nil, nil
+	}
+}
+
+func readV1(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	var line []byte
+	for len(line) < v1MaxLen {
+		b, err := br.ReadByte()
+		if err != nil {
+			return nil, nil, fmt.Errorf("proxyproto: reading v1 header: %w", err)
+		}
+		line = append(line, b)
+		if bytes.HasSuffix(line, []byte("\r\n")) {
+			return parseV1(string(line[:len(line)-2]))
+		}
+	}
+	return nil, nil, errors.New("proxyproto: v1 header too long")
+}
+
+func parseV1(line string) (net.Addr, net.Addr, error) {
+	f := strings.Split(line, " ")
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return nil, nil, nil
+	}
+	if len(f) != 6 || (f[1] != "TCP4" && f[1] != "TCP6") {
+		return nil, nil, fmt.Errorf("proxyproto: malformed v1 header %q", line)
+	}
+
+	src, err := v1Addr(f[2], f[4], f[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	dst, err := v1Addr(f[3], f[5], f[1] == "TCP4")
+	if err != nil {
+		return nil, nil, err
+	}
+	return src, dst, nil
+}
+
+func v1Addr(host, port string, v4 bool) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	if ip == nil || (ip.To4() != nil) != v4 {
+		return nil, fmt.Errorf("proxyproto: invalid v1 address %q", host)
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("proxyproto: invalid v1 port %q", port)
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+func readV2(br *bufio.Reader) (net.Addr, net.Addr, error) {
+	var hdr [16]byte
+	if _, err := io.ReadFull(br, hdr[:]); err != nil {
+		return nil, nil, fmt.Errorf("proxyproto: reading v2 header: %w", err)
+	}
+	if hdr[12]>>4 != 2 {
+		return nil, nil, fmt.Errorf("proxyproto: unsupported version %d", hdr[12]>>4)
+	}
+	cmd := hdr[12] & 0x0f
+	fam := hdr[13]
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+	if _, err := io.ReadFull(br, body); err != nil {
+		return nil, nil, fmt.Errorf("proxyproto: reading v2 addresses: %w", err)
+	}
+
+	switch cmd {
+	case 0x0: // LOCAL: health checks from the proxy itself
+		return nil, nil, nil
+	case 0x1: // PROXY
+	default:
+		return nil, nil, fmt.Errorf("proxyproto: unsupported v2 command %d", cmd)
+	}
+
+	switch fam {
+	case 0x11: // TCP over IPv4
+		if len(body) < 12 {
+			return nil, nil, errors.New("proxyproto: short v2 IPv4 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:10]))},
+			&net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:12]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(body) < 36 {
+			return nil, nil, errors.New("proxyproto: short v2 IPv6 address block")
+		}
+		return &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:34]))},
+			&net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:36]))}, nil
+	default:
+		// UNSPEC, UDP, and UNIX: keep the connection's own addresses.
+		return nil, nil, nil
+	}
+}
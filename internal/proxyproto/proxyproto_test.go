@@ -0,0 +1,138 @@
+package proxyproto
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func v2Header(cmd, fam byte, addrs []byte) []byte {
+	h := append([]byte{}, v2Signature...)
+	h = append(h, 0x20|cmd, fam, 0, 0)
+	binary.BigEndian.PutUint16(h[14:], uint16(len(addrs)))
+	return append(h, addrs...)
+}
+
+func TestReadHeader(t *testing.T) {
+	v4 := []byte{203, 0, 113, 7, 10, 0, 0, 5, 0x30, 0x39, 0x1f, 0x90} // 203.0.113.7:12345 -> 10.0.0.5:8080
+
+	tests := []struct {
+		name     string
+		input    string
+		required bool
+		wantSrc  string
+		wantRest string
+		wantErr  bool
+	}{
+		{"v1 tcp4", "PROXY TCP4 203.0.113.7 10.0.0.5 12345 8080\r\nGET /", false, "203.0.113.7:12345", "GET /", false},
+		{"v1 tcp6", "PROXY TCP6 2001:db8::1 2001:db8::2 443 8080\r\nGET /", false, "[2001:db8::1]:443", "GET /", false},
+		{"v1 unknown", "PROXY UNKNOWN\r\nGET /", false, "", "GET /", false},
+		{"v1 malformed", "PROXY TCP4 nonsense\r\nGET /", false, "", "", true},
+		{"v1 family mismatch", "PROXY TCP4 2001:db8::1 10.0.0.5 1 2\r\n", false, "", "", true},
+		{"v2 tcp4", string(v2Header(1, 0x11, v4)) + "POST /x", false, "203.0.113.7:12345", "POST /x", false},
+		{"v2 local", string(v2Header(0, 0x00, nil)) + "GET /health", false, "", "GET /health", false},
+		{"v2 with TLVs", string(v2Header(1, 0x11, append(v4, 0x04, 0x00, 0x01, 0xff))) + "GET /", false, "203.0.113.7:12345", "GET /", false},
+		{"no header optional", "GET /health HTTP/1.1\r\n", false, "", "GET /health HTTP/1.1\r\n", false},
+		{"no header required", "GET /health HTTP/1.1\r\n", true, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			br := bufio.NewReader(strings.NewReader(tt.input))
+			src, _, err := readHeader(br, tt.required)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := ""
+			if src != nil {
+				got = src.String()
+			}
+			if got != tt.wantSrc {
+				t.Errorf("src = %q, want %q", got, tt.wantSrc)
+			}
+			rest, _ := io.ReadAll(br)
+			if string(rest) != tt.wantRest {
+				t.Errorf("remaining = %q, want %q", rest, tt.wantRest)
+			}
+		})
+	}
+}
+
+func TestListener_OnlyTrustedPeersMaySendHeaders(t *testing.T) {
+	loopback, _ := ParseCIDRs([]string{"127.0.0.1"})
+	other, _ := ParseCIDRs([]string{"10.0.0.0/8"})
+
+	tests := []struct {
+		name     string
+		trusted  []*net.IPNet
+		wantHost string
+	}{
+		{"trusted peer", loopback, "203.0.113.7"},
+		{"untrusted peer", other, "127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inner, err := net.Listen("tcp4", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ln := NewListener(inner, Config{Trusted: tt.trusted, HeaderTimeout: time.Second})
+			defer ln.Close()
+
+			go func() {
+				c, err := net.Dial("tcp4", inner.Addr().String())
+				if err != nil {
+					return
+				}
+				defer c.Close()
+				_, _ = c.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.5 12345 8080\r\nhello"))
+				time.Sleep(100 * time.Millisecond)
+			}()
+
+			c, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			host, _, _ := net.SplitHostPort(c.RemoteAddr().String())
+			if host != tt.wantHost {
+				t.Errorf("RemoteAddr host = %q, want %q", host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestConn_RequiredHeaderMissing(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+
+	c := &Conn{Conn: server, br: bufio.NewReader(server), trusted: true, cfg: Config{Required: true, HeaderTimeout: time.Second}}
+	go func() { _, _ = client.Write([]byte("GET / HTTP/1.1\r\n\r\n")) }()
+
+	if _, err := c.Read(make([]byte, 16)); !errors.Is(err, ErrNoHeader) {
+		t.Errorf("Read() error = %v, want ErrNoHeader", err)
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := ParseCIDRs([]string{"10.0.0.0/8", "192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nets[1].Contains(net.ParseIP("192.0.2.1")) || nets[1].Contains(net.ParseIP("192.0.2.2")) {
+		t.Error("bare IP should parse as a single-address network")
+	}
+	if _, err := ParseCIDRs([]string{"not-an-ip"}); err == nil {
+		t.Error("ParseCIDRs should reject invalid input")
+	}
+}
@@ -0,0 +1,210 @@
+// Package pulsar implements the server's producer interface on top of Apache
+// Pulsar's REST producer API (PIP-64), so kahook can publish to Pulsar
+// without a native client library.
+package pulsar
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/redact"
+)
+
+// healthTimeout bounds IsConnected so /ready fails fast when the broker is
+// unreachable, mirroring the Kafka producer's metadata probe.
+const healthTimeout = 3 * time.Second
+
+// defaultHealthTopic is the topic IsConnected looks up when none is
+// configured and nothing has been produced yet.
+const defaultHealthTopic = "kahook-health"
+
+// Producer publishes messages to Pulsar topics over HTTP.
+type Producer struct {
+	baseURL      string
+	tenant       string
+	namespace    string
+	domain       string // "persistent" or "non-persistent"
+	token        string
+	producerName string
+	healthTopic  string
+	client       *http.Client
+	logger       *zap.Logger
+
+	lastTopic atomic.Pointer[string] // last topic produced to
+}
+
+// ProducerConfig holds the configuration needed to create a Producer.
+type ProducerConfig struct {
+	// ServiceURL is the broker (or proxy) HTTP service URL, e.g.
+	// http://pulsar:8080.
+	ServiceURL string
+	Tenant     string
+	Namespace  string
+	// NonPersistent publishes to non-persistent:// topics.
+	NonPersistent bool
+	// Token is sent as a Bearer token when set (Pulsar JWT authentication).
+	Token string
+	// HealthTopic is the topic IsConnected looks up. The token needs
+	// produce or consume permission on it. When empty, the topic last
+	// produced to is used, or "kahook-health" before the first produce.
+	HealthTopic string
+	Logger      *zap.Logger
+}
+
+// publishRequest is the body of POST /topics/{domain}/{tenant}/{ns}/{topic}.
+type publishRequest struct {
+	ProducerName string           `json:"producerName"`
+	Messages     []publishMessage `json:"messages"`
+}
+
+type publishMessage struct {
+	Key        string            `json:"key,omitempty"`
+	Payload    string            `json:"payload"`
+	Properties map[string]string `json:"properties,omitempty"`
+	EventTime  int64             `json:"eventTime"`
+}
+
+type publishResponse struct {
+	MessagePublishResults []struct {
+		MessageID    string `json:"messageId"`
+		ErrorCode    int    `json:"errorCode"`
+		ErrorMessage string `json:"errorMsg"`
+	} `json:"messagePublishResults"`
+}
+
+// NewProducer creates a Pulsar producer. No connection is made until the
+// first Produce or IsConnected call.
+func NewProducer(cfg ProducerConfig) (*Producer, error) {
+	u, err := url.Parse(cfg.ServiceURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid pulsar service url %q: want http(s)://host:port", redact.URL(cfg.ServiceURL))
+	}
+
+	domain := "persistent"
+	if cfg.NonPersistent {
+		domain = "non-persistent"
+	}
+
+	host, _ := os.Hostname()
+	return &Producer{
+		baseURL:      strings.TrimRight(cfg.ServiceURL, "/"),
+		tenant:       cfg.Tenant,
+		namespace:    cfg.Namespace,
+		domain:       domain,
+		token:        cfg.Token,
+		producerName: "kahook-" + host,
+		healthTopic:  cfg.HealthTopic,
+		client:       &http.Client{},
+		logger:       cfg.Logger,
+	}, nil
+}
+
+// Produce publishes a single message and waits for the broker to acknowledge
+// it. The key becomes the Pulsar message key and headers become properties.
+func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	body, err := json.Marshal(publishRequest{
+		ProducerName: p.producerName,
+		Messages: []publishMessage{{
+			Key:        string(key),
+			Payload:    base64.StdEncoding.EncodeToString(value),
+			Properties: headers,
+			EventTime:  time.Now().UnixMilli(),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode pulsar message: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/topics/%s/%s/%s/%s", p.baseURL, p.domain,
+		url.PathEscape(p.tenant), url.PathEscape(p.namespace), url.PathEscape(topic))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to build pulsar request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	p.authorize(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("message delivery failed: pulsar returned %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	var result publishResponse
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return fmt.Errorf("unexpected pulsar response: %w", err)
+	}
+	for _, r := range result.MessagePublishResults {
+		if r.ErrorCode != 0 {
+			return fmt.Errorf("message delivery failed: pulsar error %d: %s", r.ErrorCode, r.ErrorMessage)
+		}
+	}
+	p.lastTopic.Store(&topic)
+	return nil
+}
+
+// IsConnected looks the health topic up with the topic lookup API, which a
+// token allowed only to produce may call, unlike the broker admin endpoints.
+// A 404, for a topic that does not exist while auto-creation is off, still
+// shows the broker is up and accepted the token.
+func (p *Producer) IsConnected() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+
+	endpoint := fmt.Sprintf("%s/lookup/v2/topic/%s/%s/%s/%s", p.baseURL, p.domain,
+		url.PathEscape(p.tenant), url.PathEscape(p.namespace), url.PathEscape(p.probeTopic()))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false
+	}
+	p.authorize(req)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound
+}
+
+// probeTopic returns the topic IsConnected looks up: the configured health
+// topic, else the topic last produced to, else defaultHealthTopic.
+func (p *Producer) probeTopic() string {
+	if p.healthTopic != "" {
+		return p.healthTopic
+	}
+	if t := p.lastTopic.Load(); t != nil {
+		return *t
+	}
+	return defaultHealthTopic
+}
+
+// Close releases idle HTTP connections. Produce calls are synchronous, so
+// there is nothing buffered to flush.
+func (p *Producer) Close() {
+	p.client.CloseIdleConnections()
+}
+
+func (p *Producer) authorize(req *http.Request) {
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+}
@@ -0,0 +1,138 @@
+package pulsar
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func newTestProducer(t *testing.T, handler http.HandlerFunc) *Producer {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	p, err := NewProducer(ProducerConfig{
+		ServiceURL: ts.URL,
+		Tenant:     "public",
+		Namespace:  "default",
+		Token:      "jwt",
+		Logger:     zap.NewNop(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProduce(t *testing.T) {
+	var got publishRequest
+	p := newTestProducer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/topics/persistent/public/default/orders" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer jwt" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"messagePublishResults":[{"messageId":"1:2:-1","errorCode":0}]}`))
+	})
+
+	err := p.Produce(context.Background(), "orders", []byte("k1"), []byte(`{"a":1}`), map[string]string{"X-Source": "test"})
+	if err != nil {
+		t.Fatalf("Produce() error = %v", err)
+	}
+
+	if len(got.Messages) != 1 {
+		t.Fatalf("sent %d messages, want 1", len(got.Messages))
+	}
+	msg := got.Messages[0]
+	payload, _ := base64.StdEncoding.DecodeString(msg.Payload)
+	if msg.Key != "k1" || string(payload) != `{"a":1}` || msg.Properties["X-Source"] != "test" {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
+func TestProduce_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{"http error", http.StatusNotFound, `{"reason":"Topic not found"}`, "404"},
+		{"per-message error", http.StatusOK, `{"messagePublishResults":[{"errorCode":2,"errorMsg":"schema mismatch"}]}`, "schema mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newTestProducer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			})
+			err := p.Produce(context.Background(), "orders", nil, []byte("x"), nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want mention of %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsConnected(t *testing.T) {
+	status := http.StatusOK
+	var path string
+	p := newTestProducer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			path = r.URL.Path
+			w.WriteHeader(status)
+			return
+		}
+		_, _ = w.Write([]byte(`{"messagePublishResults":[{"messageId":"1:0:0"}]}`))
+	})
+
+	if !p.IsConnected() {
+		t.Error("IsConnected() = false, want true")
+	}
+	if path != "/lookup/v2/topic/persistent/public/default/kahook-health" {
+		t.Errorf("probe path = %q, want a lookup of the default health topic", path)
+	}
+
+	// Once a produce succeeds, its topic is the one looked up.
+	if err := p.Produce(context.Background(), "orders", nil, []byte("x"), nil); err != nil {
+		t.Fatal(err)
+	}
+	p.IsConnected()
+	if path != "/lookup/v2/topic/persistent/public/default/orders" {
+		t.Errorf("probe path = %q, want a lookup of the topic produced to", path)
+	}
+
+	p.healthTopic = "health"
+	p.IsConnected()
+	if path != "/lookup/v2/topic/persistent/public/default/health" {
+		t.Errorf("probe path = %q, want a lookup of the configured health topic", path)
+	}
+
+	for code, want := range map[int]bool{
+		http.StatusNotFound:           true,
+		http.StatusUnauthorized:       false,
+		http.StatusForbidden:          false,
+		http.StatusServiceUnavailable: false,
+	} {
+		status = code
+		if got := p.IsConnected(); got != want {
+			t.Errorf("IsConnected() with lookup status %d = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestNewProducer_InvalidURL(t *testing.T) {
+	for _, u := range []string{"", "pulsar://broker:6650", "http://"} {
+		if _, err := NewProducer(ProducerConfig{ServiceURL: u}); err == nil {
+			t.Errorf("NewProducer(%q) should fail", u)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package ratelimit provides token-bucket admission control keyed by an
+// arbitrary string (topic, principal, ...).
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// maxIdleKeys is the number of tracked keys above which a Limiter prunes
+// buckets that have refilled completely. A full bucket carries no state worth
+// keeping, so dropping it is indistinguishable from keeping it.
+const maxIdleKeys = 10000
+
+// Bucket is a token bucket refilled continuously at Rate tokens per second up
+// to Burst tokens. It is not safe for concurrent use on its own; Limiter
+// serialises access.
+type Bucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket returns a full bucket.
+func NewBucket(rate, burst float64, now time.Time) *Bucket {
+	return &Bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+// AllowN takes n tokens if available. When it cannot, it reports how long the
+// caller should wait before the same request could succeed.
+//
+// A request larger than the burst size would otherwise never be admitted, so
+// its cost is capped at the burst: it goes through only when the bucket is
+// full, and empties it.
+func (b *Bucket) AllowN(now time.Time, n float64) (bool, time.Duration) {
+	b.refill(now)
+
+	if n > b.burst {
+		n = b.burst
+	}
+	if b.tokens >= n {
+		b.tokens -= n
+		return true, 0
+	}
+
+	wait := (n - b.tokens) / b.rate
+	return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+}
+
+// Refund returns n tokens taken by an earlier AllowN, up to the burst. It
+// lets a caller that checks several buckets undo a charge when a later one
+// rejects the request.
+func (b *Bucket) Refund(now time.Time, n float64) {
+	b.refill(now)
+	b.tokens = math.Min(b.burst, b.tokens+math.Min(n, b.burst))
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+func (b *Bucket) full(now time.Time) bool {
+	b.refill(now)
+	return b.tokens >= b.burst
+}
+
+// Limit is the rate and burst applied to one key.
+type Limit struct {
+	Rate  float64 // tokens per second; <= 0 means unlimited
+	Burst float64 // bucket size; defaults to Rate when <= 0
+}
+
+// Unlimited reports whether l admits everything.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// Limiter maintains one Bucket per key. Keys without a specific override use
+// the default limit.
+type Limiter struct {
+	def       Limit
+	overrides map[string]Limit
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*Bucket
+}
+
+// NewLimiter creates a Limiter. overrides may be nil.
+func NewLimiter(def Limit, overrides map[string]Limit) *Limiter {
+	o := make(map[string]Limit, len(overrides))
+	for k, v := range overrides {
+		o[k] = v
+	}
+	return &Limiter{
+		def:       def,
+		overrides: o,
+		now:       time.Now,
+		buckets:   make(map[string]*Bucket),
+	}
+}
+
+// WithClock makes l read the time from now instead of time.Now, and returns
+// l. It must be called before l is used.
+func (l *Limiter) WithClock(now func() time.Time) *Limiter {
+	if now != nil {
+		l.now = now
+	}
+	return l
+}
+
+// Enabled reports whether any key can ever be limited.
+func (l *Limiter) Enabled() bool {
+	if !l.def.Unlimited() {
+		return true
+	}
+	for _, o := range l.overrides {
+		if !o.Unlimited() {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowN takes n tokens from the bucket for key.
+func (l *Limiter) AllowN(key string, n float64) (bool, time.Duration) {
+	return l.allowAt(key, n, l.now())
+}
+
+// Refund returns n tokens to the bucket for key; see Bucket.Refund.
+func (l *Limiter) Refund(key string, n float64) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.Refund(now, n)
+	}
+}
+
+func (l *Limiter) allowAt(key string, n float64, now time.Time) (bool, time.Duration) {
+	limit, ok := l.overrides[key]
+	if !ok {
+		limit = l.def
+	}
+	if limit.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= maxIdleKeys {
+			l.prune(now)
+		}
+		burst := limit.Burst
+		if burst <= 0 {
+			burst = limit.Rate
+		}
+		b = NewBucket(limit.Rate, burst, now)
+		l.buckets[key] = b
+	}
+	return b.AllowN(now, n)
+}
+
+// prune drops buckets that have fully refilled. Callers must hold l.mu.
+func (l *Limiter) prune(now time.Time) {
+	for k, b := range l.buckets {
+		if b.full(now) {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucket_AllowN(t *testing.T) {
+	start := time.Unix(0, 0)
+	b := NewBucket(100, 200, start)
+
+	if ok, _ := b.AllowN(start, 150); !ok {
+		t.Fatal("first 150 of 200 should be allowed")
+	}
+
+	ok, wait := b.AllowN(start, 100)
+	if ok {
+		t.Fatal("100 more with 50 remaining should be rejected")
+	}
+	if wait != 500*time.Millisecond {
+		t.Errorf("wait = %v, want 500ms", wait)
+	}
+
+	if ok, _ := b.AllowN(start.Add(500*time.Millisecond), 100); !ok {
+		t.Error("should be allowed after refilling for the reported wait")
+	}
+}
+
+func TestBucket_RefillCapsAtBurst(t *testing.T) {
+	start := time.Unix(0, 0)
+	b := NewBucket(100, 200, start)
+	b.AllowN(start, 200)
+
+	later := start.Add(time.Hour)
+	if ok, _ := b.AllowN(later, 200); !ok {
+		t.Fatal("full burst should be allowed after a long idle period")
+	}
+	if ok, _ := b.AllowN(later, 1); ok {
+		t.Error("bucket should not hold more than its burst")
+	}
+}
+
+func TestBucket_OversizedRequestCappedAtBurst(t *testing.T) {
+	start := time.Unix(0, 0)
+	b := NewBucket(10, 100, start)
+
+	if ok, _ := b.AllowN(start, 1000); !ok {
+		t.Fatal("request larger than burst should be admitted when the bucket is full")
+	}
+	ok, wait := b.AllowN(start, 1000)
+	if ok {
+		t.Fatal("second oversized request should wait for a full bucket")
+	}
+	if wait != 10*time.Second {
+		t.Errorf("wait = %v, want 10s", wait)
+	}
+}
+
+func TestBucket_Refund(t *testing.T) {
+	start := time.Unix(0, 0)
+	b := NewBucket(10, 100, start)
+
+	b.AllowN(start, 1000)
+	b.Refund(start, 1000)
+	if ok, _ := b.AllowN(start, 100); !ok {
+		t.Fatal("refunded oversized request should leave the bucket full")
+	}
+	b.Refund(start, 30)
+	b.Refund(start, 500)
+	if ok, _ := b.AllowN(start, 100); !ok {
+		t.Fatal("refunds should restore the burst")
+	}
+	if ok, _ := b.AllowN(start, 1); ok {
+		t.Error("refunds should not fill the bucket past its burst")
+	}
+}
+
+func TestLimiter_OverridesAndDefault(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(Limit{}, map[string]Limit{"audit": {Rate: 10, Burst: 10}})
+
+	if !l.Enabled() {
+		t.Fatal("limiter with an override should be enabled")
+	}
+	if ok, _ := l.allowAt("other", 1e9, now); !ok {
+		t.Error("keys without an override use the unlimited default")
+	}
+	if ok, _ := l.allowAt("audit", 10, now); !ok {
+		t.Error("first 10 tokens should be allowed")
+	}
+	if ok, _ := l.allowAt("audit", 1, now); ok {
+		t.Error("override bucket should be exhausted")
+	}
+}
+
+func TestLimiter_KeysAreIndependent(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(Limit{Rate: 5}, nil)
+
+	if ok, _ := l.allowAt("a", 5, now); !ok {
+		t.Fatal("a should be allowed")
+	}
+	if ok, _ := l.allowAt("b", 5, now); !ok {
+		t.Error("b has its own bucket and should be allowed")
+	}
+	if ok, _ := l.allowAt("a", 1, now); ok {
+		t.Error("a should be exhausted")
+	}
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	if NewLimiter(Limit{}, map[string]Limit{"x": {}}).Enabled() {
+		t.Error("limiter without any positive rate should be disabled")
+	}
+}
+
+func TestLimiter_WithClock(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := NewLimiter(Limit{Rate: 1}, nil).WithClock(func() time.Time { return now })
+
+	if ok, _ := l.AllowN("a", 1); !ok {
+		t.Fatal("first token should be allowed")
+	}
+	if ok, wait := l.AllowN("a", 1); ok || wait != time.Second {
+		t.Errorf("AllowN() = %v, %v while the clock stands still, want false, 1s", ok, wait)
+	}
+	now = now.Add(time.Second)
+	if ok, _ := l.AllowN("a", 1); !ok {
+		t.Error("bucket should refill as the clock advances")
+	}
+}
@@ -0,0 +1,136 @@
+// Package redis keeps the state kahook shares between replicas in Redis,
+// with the go-redis client. It offers the few operations the server needs:
+// GET, SET with NX, and compare-and-set and compare-and-delete scripts.
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"github.com/kahook/internal/redact"
+)
+
+const (
+	// defaultTimeout bounds a command, including dialing, when its context
+	// has no deadline.
+	defaultTimeout = 2 * time.Second
+	// defaultIdle is the number of idle connections kept for reuse.
+	defaultIdle = 8
+)
+
+// Config configures a Client.
+type Config struct {
+	// URL is redis://[[user]:password@]host:port[/db], or rediss:// for
+	// TLS.
+	URL string
+	// KeyPrefix is prepended to every key.
+	KeyPrefix string
+	// MaxIdle is the number of idle connections kept (default 8).
+	MaxIdle int
+}
+
+// Client runs commands over go-redis's connection pool. Connections are
+// dialed on demand.
+type Client struct {
+	rdb       *goredis.Client
+	keyPrefix string
+}
+
+// New validates cfg. Connections are dialed when first needed.
+func New(cfg Config) (*Client, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "redis" && u.Scheme != "rediss") {
+		return nil, fmt.Errorf("invalid redis url %q: want redis://host:port or rediss://host:port", redact.URL(cfg.URL))
+	}
+	opts, err := goredis.ParseURL(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid redis url %q: %w", redact.URL(cfg.URL), err)
+	}
+	opts.MaxIdleConns = cfg.MaxIdle
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = defaultIdle
+	}
+	// Commands are bounded by their context, or by defaultTimeout.
+	opts.ContextTimeoutEnabled = true
+	opts.DialTimeout = defaultTimeout
+	opts.ReadTimeout = defaultTimeout
+	opts.WriteTimeout = defaultTimeout
+	// Errors are reported to callers, which decide what to retry.
+	opts.MaxRetries = -1
+	return &Client{rdb: goredis.NewClient(opts), keyPrefix: cfg.KeyPrefix}, nil
+}
+
+// Get returns the value of key, and false if it does not exist.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	value, err := c.rdb.Get(ctx, c.keyPrefix+key).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// SetNX sets key to value, expiring after ttl, unless it exists. It
+// reports whether it was set.
+func (c *Client) SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return c.rdb.SetNX(ctx, c.keyPrefix+key, value, ttl).Result()
+}
+
+// setIfEqual sets KEYS[1] to ARGV[2], expiring after ARGV[3] milliseconds,
+// if its value is ARGV[1], atomically, and returns 1 if it did.
+var setIfEqual = goredis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3]) return 1 end return 0`)
+
+// SetIfEqual sets key to value, expiring after ttl, if its value is still
+// old, so a client does not overwrite a key that expired and was set again
+// by another. It reports whether it set the key.
+func (c *Client) SetIfEqual(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	n, err := setIfEqual.Run(ctx, c.rdb, []string{c.keyPrefix + key}, old, value, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// delIfEqual deletes KEYS[1] if its value is ARGV[1], atomically, and
+// returns the number of keys deleted.
+var delIfEqual = goredis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// DelIfEqual deletes key if its value is still value, so a client does not
+// delete a key that expired and was set again by another. It reports
+// whether it deleted the key.
+func (c *Client) DelIfEqual(ctx context.Context, key string, value []byte) (bool, error) {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	n, err := delIfEqual.Run(ctx, c.rdb, []string{c.keyPrefix + key}, value).Int()
+	return n == 1, err
+}
+
+// Ping checks that the server answers.
+func (c *Client) Ping(ctx context.Context) error {
+	ctx, cancel := withTimeout(ctx)
+	defer cancel()
+	return c.rdb.Ping(ctx).Err()
+}
+
+// Close closes the connections.
+func (c *Client) Close() {
+	_ = c.rdb.Close()
+}
+
+// withTimeout bounds ctx by defaultTimeout if it has no deadline.
+func withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, defaultTimeout)
+}
@@ -0,0 +1,103 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestClient(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireAuth("hunter2")
+	c, err := New(Config{URL: "redis://:hunter2@" + s.Addr() + "/3", KeyPrefix: "kahook:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if _, ok, err := c.Get(ctx, "k"); ok || err != nil {
+		t.Errorf("Get() of a missing key = %v, %v", ok, err)
+	}
+	if set, err := c.SetNX(ctx, "k", []byte("first"), time.Minute); !set || err != nil {
+		t.Errorf("SetNX() = %v, %v, want set", set, err)
+	}
+	if set, err := c.SetNX(ctx, "k", []byte("second"), time.Minute); set || err != nil {
+		t.Errorf("SetNX() of an existing key = %v, %v, want not set", set, err)
+	}
+	if set, err := c.SetIfEqual(ctx, "k", []byte("other"), []byte("third"), time.Minute); set || err != nil {
+		t.Errorf("SetIfEqual() of another value = %v, %v, want not set", set, err)
+	}
+	if set, err := c.SetIfEqual(ctx, "k", []byte("first"), []byte("third\r\nline"), 1500*time.Millisecond); !set || err != nil {
+		t.Fatalf("SetIfEqual() = %v, %v, want set", set, err)
+	}
+	if v, ok, err := c.Get(ctx, "k"); !ok || err != nil || string(v) != "third\r\nline" {
+		t.Errorf("Get() = %q, %v, %v", v, ok, err)
+	}
+	if ttl := s.DB(3).TTL("kahook:k"); ttl != 1500*time.Millisecond {
+		t.Errorf("ttl = %v, want 1.5s on database 3", ttl)
+	}
+
+	if deleted, err := c.DelIfEqual(ctx, "k", []byte("first")); deleted || err != nil {
+		t.Errorf("DelIfEqual() of another value = %v, %v, want not deleted", deleted, err)
+	}
+	if deleted, err := c.DelIfEqual(ctx, "k", []byte("third\r\nline")); !deleted || err != nil {
+		t.Errorf("DelIfEqual() = %v, %v, want deleted", deleted, err)
+	}
+	if _, ok, _ := c.Get(ctx, "k"); ok {
+		t.Error("key still set after DelIfEqual()")
+	}
+	if set, err := c.SetIfEqual(ctx, "k", []byte("first"), []byte("again"), time.Minute); set || err != nil {
+		t.Errorf("SetIfEqual() of a missing key = %v, %v, want not set", set, err)
+	}
+}
+
+func TestClient_WrongPassword(t *testing.T) {
+	s := miniredis.RunT(t)
+	s.RequireAuth("hunter2")
+	c, err := New(Config{URL: "redis://:wrong@" + s.Addr()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Errorf("Ping() error = %v, want WRONGPASS", err)
+	}
+}
+
+func TestClient_Unreachable(t *testing.T) {
+	s := miniredis.RunT(t)
+	addr := s.Addr()
+	s.Close()
+	c, err := New(Config{URL: "redis://" + addr})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, _, err := c.Get(ctx, "k"); err == nil {
+		t.Error("Get() succeeded with the server down")
+	}
+}
+
+func TestNew_InvalidURL(t *testing.T) {
+	for _, raw := range []string{"", "localhost:6379", "http://localhost:6379", "redis://localhost:6379/db", "redis://:secret@/0"} {
+		_, err := New(Config{URL: raw})
+		if err == nil {
+			t.Errorf("New(%q) succeeded", raw)
+			continue
+		}
+		if strings.Contains(err.Error(), "secret") {
+			t.Errorf("New(%q) error leaks the password: %v", raw, err)
+		}
+	}
+}
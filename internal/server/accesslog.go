@@ -0,0 +1,213 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Defaults of AccessLog's batching and buffer.
+const (
+	defaultAccessLogBatch  = 100
+	defaultAccessLogFlush  = time.Second
+	defaultAccessLogBuffer = 8192
+)
+
+// accessLogContentType is the media type of access log messages.
+const accessLogContentType = "application/x-ndjson"
+
+// AccessLog produces an AccessRecord of every HTTP request to Topic, so
+// access logs can be shipped and queried like any other stream instead of
+// scraped from stdout. Records are produced in the background, up to
+// BatchSize (default 100) to a message as newline-delimited JSON, at least
+// every FlushInterval (default 1s). SampleRatio is the fraction of
+// successful requests recorded, zero meaning all of them; responses of 400
+// and above are always recorded. Up to Buffer (default 8192) records are
+// queued, and records that do not fit are dropped and counted. Replace
+// stops logging requests to stdout. An empty Topic disables it.
+type AccessLog struct {
+	Topic         string
+	SampleRatio   float64
+	BatchSize     int
+	FlushInterval time.Duration
+	Buffer        int
+	Replace       bool
+}
+
+// AccessRecord describes one HTTP request. RequestBytes is the request's
+// Content-Length, omitted when unknown, and ResponseBytes the length of
+// the body written.
+type AccessRecord struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Method        string    `json:"method"`
+	Path          string    `json:"path"`
+	Status        int       `json:"status"`
+	DurationMs    float64   `json:"duration_ms"`
+	RequestBytes  int64     `json:"request_bytes,omitempty"`
+	ResponseBytes int64     `json:"response_bytes"`
+	RemoteAddr    string    `json:"remote_addr"`
+	UserAgent     string    `json:"user_agent,omitempty"`
+}
+
+// accessLog queues access records and produces them in batches from one
+// goroutine.
+type accessLog struct {
+	topic     string
+	sample    float64
+	batchSize int
+	flush     time.Duration
+	replace   bool
+	producer  KafkaProducer
+	logger    *zap.Logger
+	metrics   *Metrics
+
+	mu      sync.RWMutex
+	closed  bool
+	records chan AccessRecord
+	done    chan struct{}
+}
+
+// newAccessLog returns nil when the access log is disabled.
+func newAccessLog(cfg AccessLog, producer KafkaProducer, logger *zap.Logger, metrics *Metrics) *accessLog {
+	if cfg.Topic == "" {
+		return nil
+	}
+	a := &accessLog{
+		topic:     cfg.Topic,
+		sample:    cfg.SampleRatio,
+		batchSize: cfg.BatchSize,
+		flush:     cfg.FlushInterval,
+		replace:   cfg.Replace,
+		producer:  producer,
+		logger:    logger,
+		metrics:   metrics,
+		done:      make(chan struct{}),
+	}
+	if a.sample <= 0 || a.sample > 1 {
+		a.sample = 1
+	}
+	if a.batchSize <= 0 {
+		a.batchSize = defaultAccessLogBatch
+	}
+	if a.flush <= 0 {
+		a.flush = defaultAccessLogFlush
+	}
+	buffer := cfg.Buffer
+	if buffer <= 0 {
+		buffer = defaultAccessLogBuffer
+	}
+	a.records = make(chan AccessRecord, buffer)
+	go a.run()
+	return a
+}
+
+// record queues the record of a request that started at start and took
+// elapsed, unless it is sampled out.
+func (a *accessLog) record(r *http.Request, rw *responseWriter, requestID string, start time.Time, elapsed time.Duration) {
+	if rw.statusCode < 400 && a.sample < 1 && rand.Float64() >= a.sample {
+		return
+	}
+	rec := AccessRecord{
+		Time:          start.UTC(),
+		RequestID:     requestID,
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Status:        rw.statusCode,
+		DurationMs:    float64(elapsed.Microseconds()) / 1000,
+		ResponseBytes: rw.written,
+		RemoteAddr:    r.RemoteAddr,
+		UserAgent:     r.UserAgent(),
+	}
+	if r.ContentLength > 0 {
+		rec.RequestBytes = r.ContentLength
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.metrics.AccessLogDropped.Add(1)
+		return
+	}
+	select {
+	case a.records <- rec:
+	default:
+		a.metrics.AccessLogDropped.Add(1)
+	}
+}
+
+func (a *accessLog) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(a.flush)
+	defer ticker.Stop()
+
+	var batch bytes.Buffer
+	enc := json.NewEncoder(&batch)
+	enc.SetEscapeHTML(false)
+	n := 0
+	flush := func() {
+		if n > 0 {
+			a.produce(bytes.Clone(batch.Bytes()), n)
+		}
+		batch.Reset()
+		n = 0
+	}
+	for {
+		select {
+		case rec, ok := <-a.records:
+			if !ok {
+				flush()
+				return
+			}
+			if err := enc.Encode(rec); err != nil {
+				a.logger.Error("failed to encode access record", zap.Error(err))
+				continue
+			}
+			if n++; n >= a.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// produce produces a batch of n records as one message.
+func (a *accessLog) produce(value []byte, n int) {
+	headers := map[string]string{contentTypeHeader: accessLogContentType}
+	ctx, cancel := context.WithTimeout(context.Background(), produceTimeout)
+	defer cancel()
+	if err := a.producer.Produce(ctx, a.topic, nil, value, headers); err != nil {
+		a.metrics.AccessLogDropped.Add(int64(n))
+		a.logger.Warn("failed to produce access records",
+			zap.String("topic", a.topic),
+			zap.Int("records", n),
+			zap.Error(err),
+		)
+		return
+	}
+	a.metrics.AccessLogRecords.Add(int64(n))
+}
+
+// close stops accepting records and waits until those queued are produced
+// or ctx ends.
+func (a *accessLog) close(ctx context.Context) {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.records)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		a.logger.Warn("access records not produced before shutdown", zap.Int("queued", len(a.records)))
+	}
+}
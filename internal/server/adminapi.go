@@ -0,0 +1,495 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+)
+
+// AdminAPI serves runtime inspection and control on a listener of its own,
+// so it can stay on a private interface while webhooks are served publicly:
+//
+//	GET    /routes                  routes, topics, and the topic allowlist
+//	GET    /topics                  per-topic counters and ingestion state
+//	POST   /topics/{topic}/disable  reject webhooks to the topic with 503
+//	POST   /topics/{topic}/enable   accept them again
+//	POST   /tokens                  add a publish token
+//	DELETE /tokens/{principal}      remove a publish token
+//	GET    /config                  the effective config, secrets redacted
+//	GET    /replay                  progress of the spill replay
+//	POST   /replay/pause            pause the spill replay
+//	POST   /replay/resume           resume it
+//	GET    /error-budgets           per-topic failures and throttles
+//	DELETE /error-budgets/{topic}   lift a topic's throttle
+//
+// Addr is the host:port to listen on; empty disables the API. Requests need
+// a token Auth or ReadOnlyAuth accepts; with both nil the API is open.
+// Auth's tokens are operators, who may use every endpoint. ReadOnlyAuth's
+// may only make GET requests, and are answered 403 otherwise.
+// EffectiveConfig returns the config /config serves; nil leaves /config
+// unregistered. Replay controls the replay of spilled messages at startup;
+// nil leaves /replay unregistered. /error-budgets is registered when
+// ServerConfig.ErrorBudget is enabled. Disabled topics and token changes
+// last until the next restart or config reload.
+type AdminAPI struct {
+	Addr            string
+	Auth            *auth.BearerAuth
+	ReadOnlyAuth    *auth.BearerAuth
+	EffectiveConfig func() (any, error)
+	Replay          ReplayControl
+}
+
+// ReplayControl is a replay of spilled messages the admin API can inspect,
+// pause, and resume.
+type ReplayControl interface {
+	Status() ReplayStatus
+	Pause()
+	Resume()
+}
+
+// ReplayStatus is the body of the /replay endpoints: State is pending,
+// running, paused, or done, Segments how many spill segments were found,
+// and Failed how many could not be read and were left in place.
+type ReplayStatus struct {
+	State    string `json:"state"`
+	Segments int    `json:"segments"`
+	Replayed int    `json:"replayed_segments"`
+	Failed   int    `json:"failed_segments"`
+	Messages int64  `json:"messages"`
+	Skipped  int64  `json:"skipped_messages"`
+	Current  string `json:"current,omitempty"`
+}
+
+// AdminRole is what an admin API credential may do.
+type AdminRole string
+
+const (
+	// AdminRoleReadOnly may view routes, topics, and the config.
+	AdminRoleReadOnly AdminRole = "read_only"
+	// AdminRoleOperator may also switch topics off and on, rotate publish
+	// tokens, pause the spill replay, and lift error budget throttles.
+	AdminRoleOperator AdminRole = "operator"
+)
+
+// AdminRoute is a route in the /routes listing.
+type AdminRoute struct {
+	Path    string            `json:"path"`
+	Topic   string            `json:"topic"`
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// AdminRoutesResponse is the body of GET /routes. Topics lists the topics
+// with options of their own.
+type AdminRoutesResponse struct {
+	Routes        []AdminRoute `json:"routes"`
+	Topics        []string     `json:"topics"`
+	AllowedTopics []string     `json:"allowed_topics,omitempty"`
+	StrictRoutes  bool         `json:"strict_routes"`
+}
+
+// AdminTopic is a topic's counters and ingestion state in GET /topics.
+type AdminTopic struct {
+	TopicMetricsResponse
+	Disabled      bool       `json:"disabled"`
+	DisabledSince *time.Time `json:"disabled_since,omitempty"`
+}
+
+// AdminTokenResponse is the body of POST /tokens. Token is only returned
+// when kahook generated it.
+type AdminTokenResponse struct {
+	Principal string `json:"principal"`
+	Token     string `json:"token,omitempty"`
+}
+
+// adminTokenRequest is the optional body of POST /tokens; without a token,
+// one is generated.
+type adminTokenRequest struct {
+	Token string `json:"token"`
+}
+
+// disabledTopics are the topics switched off through the admin API, with
+// when they were.
+type disabledTopics struct {
+	mu     sync.RWMutex
+	topics map[string]time.Time
+}
+
+func (d *disabledTopics) since(topic string) (time.Time, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	t, ok := d.topics[topic]
+	return t, ok
+}
+
+// set disables or enables topic at now and reports whether that changed it.
+func (d *disabledTopics) set(topic string, disabled bool, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, was := d.topics[topic]
+	if disabled && !was {
+		if d.topics == nil {
+			d.topics = make(map[string]time.Time)
+		}
+		d.topics[topic] = now
+	} else if !disabled {
+		delete(d.topics, topic)
+	}
+	return was != disabled
+}
+
+func (d *disabledTopics) snapshot() map[string]time.Time {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make(map[string]time.Time, len(d.topics))
+	for topic, t := range d.topics {
+		out[topic] = t
+	}
+	return out
+}
+
+// newAdminServer builds the admin listener's server, or returns nil when
+// the API is disabled.
+func (s *Server) newAdminServer(cfg AdminAPI) *http.Server {
+	if cfg.Addr == "" {
+		return nil
+	}
+	s.adminAuth, s.adminReadOnlyAuth = cfg.Auth, cfg.ReadOnlyAuth
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /routes", s.adminRoutesHandler)
+	mux.HandleFunc("GET /topics", s.adminTopicsHandler)
+	mux.HandleFunc("POST /topics/{topic}/disable", s.adminTopicStateHandler)
+	mux.HandleFunc("POST /topics/{topic}/enable", s.adminTopicStateHandler)
+	mux.HandleFunc("POST /tokens", s.adminAddTokenHandler)
+	mux.HandleFunc("DELETE /tokens/{principal}", s.adminRemoveTokenHandler)
+	if s.errorBudgets != nil {
+		mux.HandleFunc("GET /error-budgets", func(w http.ResponseWriter, r *http.Request) {
+			s.writeJSON(w, http.StatusOK, s.errorBudgets.snapshot())
+		})
+		mux.HandleFunc("DELETE /error-budgets/{topic}", s.adminLiftErrorBudgetHandler)
+	}
+	if cfg.EffectiveConfig != nil {
+		effective := cfg.EffectiveConfig
+		mux.HandleFunc("GET /config", func(w http.ResponseWriter, r *http.Request) {
+			cfg, err := effective()
+			if err != nil {
+				s.logger.Error("failed to render effective config", zap.Error(err))
+				s.writeError(w, http.StatusInternalServerError, "internal_error", "failed to render the config")
+				return
+			}
+			s.writeJSON(w, http.StatusOK, cfg)
+		})
+	}
+	if cfg.Replay != nil {
+		replay := cfg.Replay
+		mux.HandleFunc("GET /replay", func(w http.ResponseWriter, r *http.Request) {
+			s.writeJSON(w, http.StatusOK, replay.Status())
+		})
+		mux.HandleFunc("POST /replay/pause", func(w http.ResponseWriter, r *http.Request) {
+			replay.Pause()
+			s.loggerFor(r.Context()).Warn("spill replay paused", zap.String("principal", s.adminPrincipal(r)))
+			s.writeJSON(w, http.StatusOK, replay.Status())
+		})
+		mux.HandleFunc("POST /replay/resume", func(w http.ResponseWriter, r *http.Request) {
+			replay.Resume()
+			s.loggerFor(r.Context()).Info("spill replay resumed", zap.String("principal", s.adminPrincipal(r)))
+			s.writeJSON(w, http.StatusOK, replay.Status())
+		})
+	}
+	return &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           requestIDMiddleware(s.newID, s.authorizeAdmin(mux)),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
+}
+
+// AdminHandler returns the admin API's handler, or nil when it is disabled.
+func (s *Server) AdminHandler() http.Handler {
+	if s.adminServer == nil {
+		return nil
+	}
+	return s.adminServer.Handler
+}
+
+// startAdmin binds the admin listener and serves it in the background.
+func (s *Server) startAdmin() error {
+	ln, err := net.Listen("tcp", s.adminServer.Addr)
+	if err != nil {
+		return fmt.Errorf("admin listener: %w", err)
+	}
+	s.logger.Info("admin API listening",
+		zap.String("addr", ln.Addr().String()),
+		zap.Bool("auth", !s.adminOpen()),
+	)
+	go func() {
+		if err := s.adminServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error("admin listener failed", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
+// adminOpen reports whether the admin API accepts requests without a
+// token.
+func (s *Server) adminOpen() bool {
+	return s.adminAuth == nil && s.adminReadOnlyAuth == nil
+}
+
+// adminRole returns the role of the admin caller, and false when its token
+// is not accepted. Every caller of an open API is an operator.
+func (s *Server) adminRole(r *http.Request) (AdminRole, bool) {
+	switch {
+	case s.adminOpen():
+		return AdminRoleOperator, true
+	case s.adminAuth != nil && s.adminAuth.Authenticate(r):
+		return AdminRoleOperator, true
+	case s.adminReadOnlyAuth != nil && s.adminReadOnlyAuth.Authenticate(r):
+		return AdminRoleReadOnly, true
+	}
+	return "", false
+}
+
+func (s *Server) authorizeAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		role, ok := s.adminRole(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer realm="+s.authRealm)
+			s.writeError(w, http.StatusUnauthorized, "unauthorized", "invalid or missing admin token")
+			return
+		}
+		if role == AdminRoleReadOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			s.loggerFor(r.Context()).Warn("admin request denied to read-only token",
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("principal", s.adminPrincipal(r)),
+			)
+			s.writeError(w, http.StatusForbidden, "forbidden", "the admin token is read-only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminPrincipal names the admin caller in logs.
+func (s *Server) adminPrincipal(r *http.Request) string {
+	for _, a := range []*auth.BearerAuth{s.adminAuth, s.adminReadOnlyAuth} {
+		if a == nil {
+			continue
+		}
+		if principal, ok := a.Identify(r); ok {
+			return principal
+		}
+	}
+	return ""
+}
+
+func (s *Server) adminRoutesHandler(w http.ResponseWriter, r *http.Request) {
+	rt := s.current()
+	resp := AdminRoutesResponse{
+		Routes:        make([]AdminRoute, 0, len(rt.routePaths)),
+		Topics:        make([]string, 0, len(rt.topics)),
+		AllowedTopics: rt.reloadable.AllowedTopics,
+		StrictRoutes:  s.strictRoutes,
+	}
+	for path, topic := range rt.routePaths {
+		resp.Routes = append(resp.Routes, AdminRoute{Path: path, Topic: topic, Headers: rt.routeHeaders[path]})
+	}
+	sort.Slice(resp.Routes, func(i, j int) bool { return resp.Routes[i].Path < resp.Routes[j].Path })
+	for topic := range rt.topics {
+		resp.Topics = append(resp.Topics, topic)
+	}
+	sort.Strings(resp.Topics)
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) adminTopicsHandler(w http.ResponseWriter, r *http.Request) {
+	counters := newMetricsSnapshot(s.metrics).Topics
+	disabled := s.disabled.snapshot()
+	topics := make(map[string]AdminTopic, len(counters)+len(disabled))
+	for topic, c := range counters {
+		topics[topic] = AdminTopic{TopicMetricsResponse: c}
+	}
+	for topic, since := range disabled {
+		t := topics[topic]
+		t.Disabled, t.DisabledSince = true, &since
+		topics[topic] = t
+	}
+	s.writeJSON(w, http.StatusOK, topics)
+}
+
+// adminTopicStateHandler switches a topic's ingestion off or on, like a
+// manually operated circuit breaker.
+func (s *Server) adminTopicStateHandler(w http.ResponseWriter, r *http.Request) {
+	topic := r.PathValue("topic")
+	if !validTopicName.MatchString(topic) {
+		s.writeError(w, http.StatusBadRequest, "invalid_topic", "topic must match [a-zA-Z0-9._-] and be 1-249 characters")
+		return
+	}
+	disable := r.URL.Path == "/topics/"+topic+"/disable"
+	if s.disabled.set(topic, disable, s.now()) {
+		fields := []zap.Field{zap.String("topic", topic), zap.String("principal", s.adminPrincipal(r))}
+		if disable {
+			s.loggerFor(r.Context()).Warn("topic ingestion disabled", fields...)
+		} else {
+			s.loggerFor(r.Context()).Info("topic ingestion enabled", fields...)
+		}
+	}
+	t := AdminTopic{TopicMetricsResponse: newMetricsSnapshot(s.metrics).Topics[topic]}
+	if since, ok := s.disabled.since(topic); ok {
+		t.Disabled, t.DisabledSince = true, &since
+	}
+	s.writeJSON(w, http.StatusOK, t)
+}
+
+// adminLiftErrorBudgetHandler lifts a topic's error budget throttle and
+// suspends it for ?hold= seconds (default: one throttle duration).
+func (s *Server) adminLiftErrorBudgetHandler(w http.ResponseWriter, r *http.Request) {
+	topic := r.PathValue("topic")
+	if !validTopicName.MatchString(topic) {
+		s.writeError(w, http.StatusBadRequest, "invalid_topic", "topic must match [a-zA-Z0-9._-] and be 1-249 characters")
+		return
+	}
+	hold := s.errorBudgets.cfg.Duration
+	if v := r.URL.Query().Get("hold"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			s.writeError(w, http.StatusBadRequest, "invalid_hold", "hold must be a non-negative number of seconds")
+			return
+		}
+		hold = time.Duration(secs) * time.Second
+	}
+	s.errorBudgets.lift(topic, hold)
+	s.loggerFor(r.Context()).Info("topic error budget throttle lifted",
+		zap.String("topic", topic),
+		zap.String("principal", s.adminPrincipal(r)),
+		zap.Duration("hold", hold),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTopicDisabled rejects a webhook to a topic switched off through the
+// admin API.
+func (s *Server) writeTopicDisabled(w http.ResponseWriter, topic string) {
+	s.metrics.TopicDisabledRejected.Add(1)
+	s.writeError(w, http.StatusServiceUnavailable, "topic_disabled",
+		fmt.Sprintf("ingestion to topic %q is disabled", topic))
+}
+
+func (s *Server) adminAddTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req adminTokenRequest
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64<<10)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		s.writeError(w, http.StatusBadRequest, "invalid_body", "body must be a JSON object with an optional token")
+		return
+	}
+	resp := AdminTokenResponse{}
+	if req.Token == "" {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			s.writeError(w, http.StatusInternalServerError, "internal_error", "failed to generate a token")
+			return
+		}
+		req.Token = base64.RawURLEncoding.EncodeToString(b)
+		resp.Token = req.Token
+	}
+	resp.Principal = auth.TokenFingerprint(req.Token)
+
+	err := s.updateAuth(func(a *auth.MultiAuth) (*auth.MultiAuth, error) {
+		if a == nil || !a.HasAuth() {
+			return nil, errAuthDisabled
+		}
+		for _, c := range a.Credentials() {
+			if c.Principal == resp.Principal {
+				return nil, errTokenExists
+			}
+		}
+		return a.WithToken(req.Token), nil
+	})
+	switch {
+	case errors.Is(err, errAuthDisabled):
+		s.writeError(w, http.StatusConflict, "auth_disabled", "publish authentication is not configured")
+		return
+	case errors.Is(err, errTokenExists):
+		s.writeError(w, http.StatusConflict, "token_exists", "the token is already accepted")
+		return
+	}
+	s.loggerFor(r.Context()).Info("publish token added",
+		zap.String("token", resp.Principal),
+		zap.String("principal", s.adminPrincipal(r)),
+	)
+	s.writeJSON(w, http.StatusCreated, resp)
+}
+
+func (s *Server) adminRemoveTokenHandler(w http.ResponseWriter, r *http.Request) {
+	principal := r.PathValue("principal")
+	err := s.updateAuth(func(a *auth.MultiAuth) (*auth.MultiAuth, error) {
+		if a == nil {
+			return nil, errTokenUnknown
+		}
+		next, ok := a.WithoutToken(principal)
+		if !ok {
+			return nil, errTokenUnknown
+		}
+		if !next.HasAuth() {
+			return nil, errLastCredential
+		}
+		return next, nil
+	})
+	switch {
+	case errors.Is(err, errTokenUnknown):
+		s.writeError(w, http.StatusNotFound, "unknown_token", fmt.Sprintf("no publish token %q", principal))
+		return
+	case errors.Is(err, errLastCredential):
+		s.writeError(w, http.StatusConflict, "last_credential", "removing the last credential would open publishing to anyone")
+		return
+	}
+	s.loggerFor(r.Context()).Info("publish token removed",
+		zap.String("token", principal),
+		zap.String("principal", s.adminPrincipal(r)),
+	)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Reasons updateAuth leaves the credentials as they are.
+var (
+	errAuthDisabled   = errors.New("publish authentication is not configured")
+	errTokenExists    = errors.New("token already accepted")
+	errTokenUnknown   = errors.New("unknown token")
+	errLastCredential = errors.New("last credential")
+)
+
+// updateAuth replaces the publish credentials with what update makes of
+// them, unless it returns an error.
+func (s *Server) updateAuth(update func(*auth.MultiAuth) (*auth.MultiAuth, error)) error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	old := s.current()
+	next, err := update(old.auth)
+	if err != nil {
+		return err
+	}
+	r := old.reloadable
+	r.Auth = next
+	s.routing.Store(s.newRouting(r, old.credentials.withPublish(next.Credentials())))
+	return nil
+}
+
+// shutdownAdmin stops the admin listener.
+func (s *Server) shutdownAdmin(ctx context.Context) {
+	if err := s.adminServer.Shutdown(ctx); err != nil {
+		s.logger.Warn("admin listener shutdown error", zap.Error(err))
+	}
+}
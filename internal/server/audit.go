@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// defaultAuditBuffer is the number of audit records queued for producing
+// when AuditLog.Buffer is zero.
+const defaultAuditBuffer = 4096
+
+// Outcomes of a produce attempt, as recorded in audit records.
+const (
+	auditProduced     = "produced"
+	auditFailed       = "failed"
+	auditDeadLettered = "dead_lettered"
+	auditQuarantined  = "quarantined"
+	auditQueueFull    = "queue_full"
+	auditNotReady     = "not_ready"
+)
+
+// AuditLog produces a compact AuditRecord of every webhook produce attempt
+// to Topic, separate from the payload topics, so who wrote what and when
+// can be answered without reading payloads. Records are produced in the
+// background; up to Buffer (default 4096) are queued, and records that do
+// not fit are dropped and counted. An empty Topic disables it.
+type AuditLog struct {
+	Topic  string
+	Buffer int
+}
+
+// AuditRecord describes one produce attempt. KeyHash is the hex SHA-256 of
+// the message key, empty for keyless messages, and Size the message value's
+// length. Outcome is produced, failed, dead_lettered, quarantined,
+// queue_full, or not_ready.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	MessageID string    `json:"message_id"`
+	Principal string    `json:"principal,omitempty"`
+	Topic     string    `json:"topic"`
+	KeyHash   string    `json:"key_hash,omitempty"`
+	Size      int       `json:"size"`
+	Outcome   string    `json:"outcome"`
+	Attempts  int       `json:"attempts"`
+	LatencyMs float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// auditLog queues audit records and produces them from one goroutine.
+type auditLog struct {
+	topic    string
+	producer KafkaProducer
+	logger   *zap.Logger
+	metrics  *Metrics
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	closed  bool
+	records chan AuditRecord
+	done    chan struct{}
+}
+
+// newAuditLog returns nil when the audit log is disabled.
+func newAuditLog(cfg AuditLog, producer KafkaProducer, logger *zap.Logger, metrics *Metrics, now func() time.Time) *auditLog {
+	if cfg.Topic == "" {
+		return nil
+	}
+	buffer := cfg.Buffer
+	if buffer <= 0 {
+		buffer = defaultAuditBuffer
+	}
+	a := &auditLog{
+		topic:    cfg.Topic,
+		producer: producer,
+		logger:   logger,
+		metrics:  metrics,
+		now:      now,
+		records:  make(chan AuditRecord, buffer),
+		done:     make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// begin starts the record of a produce attempt; end completes and queues
+// it. Both are no-ops on a nil auditLog.
+func (a *auditLog) begin(requestID, principal, topic, messageID string, key []byte, size int) AuditRecord {
+	if a == nil {
+		return AuditRecord{}
+	}
+	rec := AuditRecord{
+		Time:      a.now().UTC(),
+		RequestID: requestID,
+		MessageID: messageID,
+		Principal: principal,
+		Topic:     topic,
+		Size:      size,
+	}
+	if len(key) > 0 {
+		sum := sha256.Sum256(key)
+		rec.KeyHash = hex.EncodeToString(sum[:])
+	}
+	return rec
+}
+
+func (a *auditLog) end(rec AuditRecord, outcome string, attempts int, err error) {
+	if a == nil {
+		return
+	}
+	rec.Outcome = outcome
+	rec.Attempts = attempts
+	rec.LatencyMs = float64(a.now().Sub(rec.Time).Microseconds()) / 1000
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		a.metrics.AuditDropped.Add(1)
+		return
+	}
+	select {
+	case a.records <- rec:
+	default:
+		a.metrics.AuditDropped.Add(1)
+	}
+}
+
+func (a *auditLog) run() {
+	defer close(a.done)
+	headers := map[string]string{contentTypeHeader: "application/json"}
+	for rec := range a.records {
+		value, err := json.Marshal(rec)
+		if err != nil {
+			a.logger.Error("failed to encode audit record", zap.Error(err))
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), produceTimeout)
+		err = a.producer.Produce(ctx, a.topic, []byte(rec.Topic), value, headers)
+		cancel()
+		if err != nil {
+			a.metrics.AuditDropped.Add(1)
+			a.logger.Warn("failed to produce audit record",
+				zap.String("topic", a.topic),
+				zap.String("message_id", rec.MessageID),
+				zap.Error(err),
+			)
+			continue
+		}
+		a.metrics.AuditRecords.Add(1)
+	}
+}
+
+// close stops accepting records and waits until those queued are produced
+// or ctx ends.
+func (a *auditLog) close(ctx context.Context) {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.records)
+	}
+	a.mu.Unlock()
+
+	select {
+	case <-a.done:
+	case <-ctx.Done():
+		a.logger.Warn("audit records not produced before shutdown", zap.Int("queued", len(a.records)))
+	}
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/upcast"
+)
+
+// Defaults for the zero values of BatchIngest.
+const (
+	defaultBatchMaxRecords = 1000
+	defaultBatchMaxBytes   = 10 << 20
+)
+
+// BatchIngest serves /batch/{topic}, where one request carries many
+// records, as NDJSON (application/x-ndjson) or a JSON array
+// (application/json), each produced as its own message. Records are
+// checked and produced concurrently, and the response reports each one's
+// outcome. MaxRecords (default 1000) and MaxBytes (default 10 MiB) bound a
+// batch. Batch ingestion is off unless Enabled.
+type BatchIngest struct {
+	Enabled    bool
+	MaxRecords int
+	MaxBytes   int64
+}
+
+// BatchResponse answers a batch: 202 when every record was accepted, and
+// 207 otherwise, with Records saying which were not and why.
+type BatchResponse struct {
+	Status    string        `json:"status"`
+	Topic     string        `json:"topic"`
+	RequestID string        `json:"request_id"`
+	Accepted  int           `json:"accepted"`
+	Failed    int           `json:"failed"`
+	Records   []BatchRecord `json:"records"`
+}
+
+// BatchRecord is the outcome of one record of a batch, by its position.
+// Status is accepted or dead_lettered, like a webhook's, or rejected (the
+// record broke a payload policy) or failed (it could not be produced), with
+// the error code and message a webhook would get.
+type BatchRecord struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"`
+	MessageID string `json:"message_id,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// Batch statuses, of the whole batch and of its records.
+const (
+	batchAccepted     = "accepted"
+	batchPartial      = "partial"
+	batchFailed       = "failed"
+	batchRejected     = "rejected"
+	batchDeadLettered = "dead_lettered"
+)
+
+// batchIngest is a BatchIngest with its defaults applied.
+type batchIngest struct {
+	maxRecords int
+	maxBytes   int64
+}
+
+// newBatchIngest returns nil when batch ingestion is disabled.
+func newBatchIngest(cfg BatchIngest) *batchIngest {
+	if !cfg.Enabled {
+		return nil
+	}
+	b := &batchIngest{maxRecords: cfg.MaxRecords, maxBytes: cfg.MaxBytes}
+	if b.maxRecords <= 0 {
+		b.maxRecords = defaultBatchMaxRecords
+	}
+	if b.maxBytes <= 0 {
+		b.maxBytes = defaultBatchMaxBytes
+	}
+	return b
+}
+
+// batchFormat returns how a batch sent with contentType is split: "ndjson"
+// or "array", or "" when it is neither.
+func batchFormat(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl", "application/json-seq":
+		return "ndjson"
+	case "application/json":
+		return "array"
+	default:
+		return ""
+	}
+}
+
+// splitBatch splits body into records: one per non-blank line for NDJSON,
+// one per element for a JSON array. NDJSON lines are not parsed here, so
+// one bad line fails only its own record.
+func splitBatch(format string, body []byte) ([][]byte, error) {
+	if format == "ndjson" {
+		var records [][]byte
+		for _, line := range bytes.Split(body, []byte("\n")) {
+			// RFC 7464 JSON text sequences prefix each record with RS.
+			line = bytes.TrimSpace(bytes.TrimPrefix(bytes.TrimSpace(line), []byte{0x1e}))
+			if len(line) > 0 {
+				records = append(records, line)
+			}
+		}
+		return records, nil
+	}
+	var elems []json.RawMessage
+	if err := json.Unmarshal(body, &elems); err != nil {
+		return nil, errors.New("request body must be a JSON array of records")
+	}
+	records := make([][]byte, len(elems))
+	for i, e := range elems {
+		records[i] = e
+	}
+	return records, nil
+}
+
+// batchHandler serves /batch/{path}. It admits the request like a webhook to
+// the same path, then checks and produces each record on its own.
+func (s *Server) batchHandler(w http.ResponseWriter, r *http.Request) {
+	received := s.now()
+	path := r.PathValue("path")
+	topic := path
+	t, route := s.current().routePaths[path]
+	if route {
+		topic = t
+	}
+
+	w = s.signingWriter(w)
+	req, ok := s.admitWebhook(w, r, path, topic, route)
+	if !ok {
+		return
+	}
+	defer req.release()
+	defer s.load.begin()()
+
+	if v := s.headerViolation(r); v != nil {
+		s.writeError(w, v.status, v.code, v.message)
+		return
+	}
+
+	format := batchFormat(r.Header.Get("Content-Type"))
+	if format == "" {
+		s.writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type",
+			"batch bodies must be NDJSON (application/x-ndjson) or a JSON array (application/json)")
+		return
+	}
+
+	s.limitBodyRate(w, r)
+	r.Body = http.MaxBytesReader(w, r.Body, s.batch.maxBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, "body_too_large",
+				fmt.Sprintf("batch body exceeds maximum size of %d bytes", s.batch.maxBytes))
+			return
+		}
+		if errors.Is(err, errBodyTooSlow) {
+			s.metrics.SlowBodyRejected.Add(1)
+			w.Header().Set("Connection", "close")
+			s.writeError(w, http.StatusRequestTimeout, "body_too_slow",
+				fmt.Sprintf("request body arrived slower than %d bytes per second", s.minBodyRate))
+			return
+		}
+		s.writeError(w, http.StatusBadRequest, "read_error", "failed to read request body")
+		return
+	}
+
+	s.metrics.RecordReceived(topic, len(body))
+	if s.usage != nil {
+		s.usage.received(req.principal, topic, len(body))
+	}
+
+	if !s.verifySignature(w, r, topic, body) {
+		return
+	}
+
+	if !req.exempt {
+		if ok, retryAfter := s.admitBandwidth(topic, req.principal, len(body)); !ok {
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			s.writeError(w, http.StatusTooManyRequests, "bandwidth_exceeded",
+				"bandwidth limit exceeded, retry later")
+			return
+		}
+	}
+
+	plain, compression, releasePlain, ok := s.decodeBody(w, r, body, s.maxBodyBytes)
+	if !ok {
+		return
+	}
+	defer releasePlain()
+
+	records, err := splitBatch(format, plain)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_batch", err.Error())
+		return
+	}
+	if len(records) == 0 {
+		s.writeError(w, http.StatusBadRequest, "empty_body", "batch contains no records")
+		return
+	}
+	if len(records) > s.batch.maxRecords {
+		s.writeError(w, http.StatusRequestEntityTooLarge, "too_many_records",
+			fmt.Sprintf("batch has %d records, more than the maximum of %d", len(records), s.batch.maxRecords))
+		return
+	}
+	s.metrics.BatchRequests.Add(1)
+	s.metrics.BatchRecords.Add(int64(len(records)))
+
+	headers := forwardedHeaders.messageHeaders(r.Header)
+	defer putHeaderMap(headers)
+	s.setRouteHeaders(headers, path)
+	headers[contentTypeHeader] = "application/json"
+	headers[payloadEncodingHeader] = encodingRaw
+	s.setClockHeaders(headers, received)
+	s.setCountryHeader(headers, req.country)
+	setSubjectHeader(headers, req.principal)
+	span := s.setTraceHeaders(headers, r)
+	if s.usage != nil {
+		headers[s.usage.header] = tenant(req.principal)
+	}
+
+	produceCtx, cancel := context.WithTimeout(r.Context(), produceTimeout)
+	defer cancel()
+
+	requestID := requestIDFrom(r.Context())
+	results := make([]BatchRecord, len(records))
+	var wg sync.WaitGroup
+	for i, record := range records {
+		results[i].Index = i
+		payload, extractedKey, v := s.recordViolation(r, topic, path, requestID, received, record)
+		if v != nil {
+			results[i].Status = batchRejected
+			results[i].Error = v.code
+			results[i].Message = v.message
+			continue
+		}
+
+		m := message{topic: topic, id: s.newID(), value: payload.Body, headers: maps.Clone(headers)}
+		m.headers[messageIDHeader] = m.id
+		s.setUpcastHeaders(m.headers, topic, payload)
+		m.key = s.messageKey(m.headers, r, topic, extractedKey)
+		results[i].MessageID = m.id
+		value, valueType, err := s.toCloudEvent(m.headers, r, topic, path, m.id, received, "application/json", m.value)
+		if err != nil {
+			results[i].Status, results[i].Error = batchFailed, "encode_error"
+			results[i].Message = "failed to encode payload"
+			continue
+		}
+		if m.value, err = s.setCompression(m.headers, topic, compression, body, plain, value); err != nil {
+			results[i].Status, results[i].Error = batchFailed, "encode_error"
+			results[i].Message = "failed to encode payload"
+			continue
+		}
+
+		wg.Add(1)
+		go func(res *BatchRecord) {
+			defer wg.Done()
+			s.deliverRecord(produceCtx, r, req, requestID, m, res)
+			if res.Status == batchAccepted && s.tail != nil {
+				s.tail.publish(TailEvent{
+					Time:        received.UTC(),
+					Topic:       topic,
+					MessageID:   m.id,
+					RequestID:   requestID,
+					Principal:   req.principal,
+					Key:         string(m.key),
+					ContentType: valueType,
+					Encoding:    encodingRaw,
+					Size:        len(m.value),
+				}, m.value)
+			}
+		}(&results[i])
+	}
+	wg.Wait()
+
+	resp := BatchResponse{Topic: topic, RequestID: requestID, Records: results}
+	for i := range results {
+		switch results[i].Status {
+		case batchAccepted, batchDeadLettered:
+			resp.Accepted++
+		default:
+			resp.Failed++
+			s.metrics.BatchRecordsFailed.Add(1)
+		}
+		if s.terseErrors {
+			results[i].Message = ""
+		}
+	}
+	code := http.StatusAccepted
+	switch {
+	case resp.Failed == 0:
+		resp.Status = batchAccepted
+	case resp.Accepted == 0:
+		resp.Status = batchFailed
+		code = http.StatusMultiStatus
+	default:
+		resp.Status = batchPartial
+		code = http.StatusMultiStatus
+	}
+
+	s.loggerFor(r.Context()).Info("batch received", append([]zap.Field{
+		zap.Int("size", len(body)),
+		zap.Int("records", len(records)),
+		zap.Int("failed", resp.Failed),
+		zap.String("remote_addr", r.RemoteAddr),
+	}, traceFields(span)...)...)
+
+	s.writeJSON(w, code, resp)
+}
+
+// recordViolation applies a webhook's payload checks to one record of a
+// batch: it must be JSON, be upcast if needed, match the topic's schema,
+// have a key if the topic requires one, and take the topic's transforms.
+// Quarantine does not apply to batch records; the violation is reported in
+// the record's outcome.
+func (s *Server) recordViolation(r *http.Request, topic, path, requestID string, received time.Time, record []byte) (upcast.Result, []byte, *violation) {
+	if !json.Valid(record) {
+		return upcast.Result{}, nil, &violation{
+			kind:    ViolationInvalidJSON,
+			status:  http.StatusBadRequest,
+			code:    "invalid_json",
+			message: "record is not valid JSON",
+		}
+	}
+	payload, v := s.upcastPayload(r, topic, record)
+	if v != nil {
+		return upcast.Result{}, nil, v
+	}
+	if v := s.schemaViolation(topic, payload.Body); v != nil {
+		return upcast.Result{}, nil, v
+	}
+	key, v := s.extractKey(r, topic, payload.Body)
+	if v != nil {
+		return upcast.Result{}, nil, v
+	}
+	if payload.Body, v = s.transformPayload(r, topic, path, requestID, received, payload.Body); v != nil {
+		return upcast.Result{}, nil, v
+	}
+	return payload, key, nil
+}
+
+// deliverRecord produces one record of a batch and sets its outcome.
+func (s *Server) deliverRecord(ctx context.Context, r *http.Request, req webhookRequest, requestID string, m message, res *BatchRecord) {
+	outcome, err := s.deliver(ctx, r, req, requestID, m)
+	switch outcome {
+	case auditProduced:
+		res.Status = batchAccepted
+	case auditDeadLettered:
+		res.Status = batchDeadLettered
+	case auditQueueFull:
+		res.Status, res.Error = batchFailed, "queue_full"
+		res.Message = fmt.Sprintf("produce queue for topic %q is full, retry later", m.topic)
+	case auditNotReady:
+		s.metrics.NotReadyRejected.Add(1)
+		res.Status, res.Error = batchFailed, "not_ready"
+		res.Message = "kafka producer not available yet, retry later"
+	default:
+		_, code, message := produceFailure(m.topic, err)
+		res.Status, res.Error, res.Message = batchFailed, code, message
+	}
+}
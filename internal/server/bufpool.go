@@ -0,0 +1,112 @@
+package server
+
+import (
+	"io"
+	"sync"
+)
+
+// bodyBufferClasses are the capacities of pooled request body buffers. A body
+// is read into the smallest class that fits its Content-Length, so a 2 KiB
+// webhook does not pin a 1 MiB buffer. The largest class has one byte beyond
+// defaultMaxBodyBytes so that reading a maximum-size body still observes EOF
+// in place. Topics allowed larger bodies read them into unpooled buffers.
+var bodyBufferClasses = []int{4 << 10, 16 << 10, 64 << 10, 256 << 10, defaultMaxBodyBytes + 1}
+
+// bodyPool recycles request body buffers by size class.
+type bodyPool struct {
+	classes []int
+	pools   []sync.Pool
+}
+
+var bodyBuffers = newBodyPool(bodyBufferClasses)
+
+func newBodyPool(classes []int) *bodyPool {
+	p := &bodyPool{classes: classes, pools: make([]sync.Pool, len(classes))}
+	for i, size := range classes {
+		size := size
+		p.pools[i].New = func() any {
+			b := make([]byte, 0, size)
+			return &b
+		}
+	}
+	return p
+}
+
+// class returns the index of the smallest class holding n bytes, or the
+// largest class if none does.
+func (p *bodyPool) class(n int) int {
+	for i, size := range p.classes {
+		if n <= size {
+			return i
+		}
+	}
+	return len(p.classes) - 1
+}
+
+// get returns an empty buffer with capacity for at least n bytes, up to the
+// largest class.
+func (p *bodyPool) get(n int) *[]byte {
+	b := p.pools[p.class(n)].Get().(*[]byte)
+	*b = (*b)[:0]
+	return b
+}
+
+// put recycles b. Buffers that grew past their class are dropped.
+func (p *bodyPool) put(b *[]byte) {
+	i := p.class(cap(*b))
+	if p.classes[i] != cap(*b) {
+		return
+	}
+	p.pools[i].Put(b)
+}
+
+// readBody reads r to EOF into a pooled buffer, sized up front from
+// contentLength (-1 if unknown) so a body of known length is read without any
+// intermediate copies. Bodies of known length up to limit but beyond the
+// largest class get a buffer of their own. The caller must put the buffer
+// back once nothing references the body; producers must not retain it after
+// Produce returns.
+func (p *bodyPool) readBody(r io.Reader, contentLength, limit int64) (*[]byte, error) {
+	hint := 0
+	if contentLength > 0 && contentLength <= limit {
+		// One spare byte lets the final Read observe EOF without growing.
+		hint = int(contentLength) + 1
+	}
+	var b *[]byte
+	if hint > p.classes[len(p.classes)-1] {
+		buf := make([]byte, 0, hint)
+		b = &buf
+	} else {
+		b = p.get(hint)
+	}
+
+	for {
+		if len(*b) == cap(*b) {
+			b = p.grow(b)
+		}
+		n, err := r.Read((*b)[len(*b):cap(*b)])
+		*b = (*b)[:len(*b)+n]
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			p.put(b)
+			return nil, err
+		}
+	}
+}
+
+// grow moves b into the next class, or extends it beyond the pool if it is
+// already in the largest class (such bodies are rejected by the size limit
+// unless their topic allows more).
+func (p *bodyPool) grow(b *[]byte) *[]byte {
+	i := p.class(cap(*b))
+	if p.classes[i] == cap(*b) && i+1 < len(p.classes) {
+		nb := p.pools[i+1].Get().(*[]byte)
+		*nb = append((*nb)[:0], *b...)
+		p.put(b)
+		return nb
+	}
+	grown := append(*b, 0)[:len(*b)]
+	return &grown
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// defaultClientIPHeader is the header ClientIP reads when Header is empty.
+const defaultClientIPHeader = "X-Forwarded-For"
+
+// ClientIP takes the client address of requests that arrive through trusted
+// HTTP proxies from a header they set, for the checks of topics' allowed
+// networks. The header (default X-Forwarded-For) holds one address or a
+// comma-separated chain; it is read from the right, skipping proxies in
+// TrustedProxies, so a client cannot spoof its address by sending the
+// header itself. Requests from other peers, and every request without
+// TrustedProxies, use the connection's address.
+type ClientIP struct {
+	Header         string
+	TrustedProxies []netip.Prefix
+}
+
+// trusts reports whether addr is a trusted proxy.
+func (c ClientIP) trusts(addr netip.Addr) bool {
+	for _, p := range c.TrustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// addr returns the request's client address.
+func (c ClientIP) addr(r *http.Request) (netip.Addr, bool) {
+	peer, ok := clientAddr(r)
+	if !ok || !c.trusts(peer) {
+		return peer, ok
+	}
+	header := c.Header
+	if header == "" {
+		header = defaultClientIPHeader
+	}
+	values := r.Header.Values(header)
+	// The hop nearest kahook was appended last, possibly on a line of its own.
+	for i := len(values) - 1; i >= 0; i-- {
+		hops := strings.Split(values[i], ",")
+		for j := len(hops) - 1; j >= 0; j-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(hops[j]))
+			if err != nil {
+				// Whatever lies beyond a malformed hop cannot be trusted,
+				// so the last proxy that was stands in for the client.
+				return peer, true
+			}
+			peer = addr.Unmap()
+			if !c.trusts(peer) {
+				return peer, true
+			}
+		}
+	}
+	return peer, true
+}
+
+// networksPermit reports whether addr falls in one of networks; a topic
+// without networks accepts every address.
+func networksPermit(networks []netip.Prefix, addr netip.Addr, ok bool) bool {
+	if len(networks) == 0 {
+		return true
+	}
+	if !ok {
+		return false
+	}
+	for _, n := range networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
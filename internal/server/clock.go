@@ -0,0 +1,29 @@
+package server
+
+import (
+	"strconv"
+	"time"
+)
+
+// Message headers stamped when clock checks are enabled.
+const (
+	receivedAtHeader  = "Kahook-Received-At"
+	clockOffsetHeader = "Kahook-Clock-Offset-Ms"
+)
+
+// setClockHeaders records when the webhook was received by the local clock
+// and, once a clock check has measured it, how far a reference clock is
+// ahead of the local one; received plus the offset is the corrected time.
+// Values the client sent under the same names are replaced or removed.
+func (s *Server) setClockHeaders(headers map[string]string, received time.Time) {
+	if s.clockOffset == nil {
+		return
+	}
+	headers[receivedAtHeader] = received.UTC().Format(time.RFC3339Nano)
+	offset, ok := s.clockOffset()
+	if !ok {
+		delete(headers, clockOffsetHeader)
+		return
+	}
+	headers[clockOffsetHeader] = strconv.FormatInt(offset.Milliseconds(), 10)
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CloudEventsMode is how a topic's messages are emitted as CloudEvents 1.0
+// under the Kafka protocol binding. The empty mode emits plain messages.
+type CloudEventsMode string
+
+const (
+	// CloudEventsStructured produces the whole event, attributes and data,
+	// as an application/cloudevents+json value.
+	CloudEventsStructured CloudEventsMode = "structured"
+	// CloudEventsBinary produces the body unchanged, with the attributes in
+	// ce_ headers and its media type in content-type.
+	CloudEventsBinary CloudEventsMode = "binary"
+)
+
+// defaultCloudEventType is the event type when a topic sets none and the
+// request does not carry one.
+const defaultCloudEventType = "dev.kahook.webhook"
+
+// Headers and media type of the CloudEvents Kafka protocol binding.
+const (
+	cloudEventsContentTypeHeader = "content-type"
+	cloudEventsHeaderPrefix      = "ce_"
+	cloudEventsJSON              = "application/cloudevents+json; charset=UTF-8"
+)
+
+// CloudEvents emits a topic's messages as CloudEvents. Each event's id is
+// the request ID (the message ID for batch records, which share a request),
+// its time is when the webhook was received, and its datacontenttype the
+// request's Content-Type. Source defaults to the path the webhook was sent
+// to ("/github"). The type is the value of TypeHeader when the request has
+// it (X-GitHub-Event), then Type, then "dev.kahook.webhook".
+type CloudEvents struct {
+	Mode       CloudEventsMode
+	Source     string
+	Type       string
+	TypeHeader string
+}
+
+// cloudEvent is a structured-mode event. Data holds JSON payloads as they
+// are; other payloads go in DataBase64.
+type cloudEvent struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Time            string          `json:"time"`
+	DataContentType string          `json:"datacontenttype,omitempty"`
+	Data            json.RawMessage `json:"data,omitempty"`
+	DataBase64      string          `json:"data_base64,omitempty"`
+}
+
+// toCloudEvent rewrites value and headers into the topic's CloudEvents mode
+// and returns the value to produce and its media type. Messages of topics
+// without a mode are returned as they are.
+func (s *Server) toCloudEvent(headers map[string]string, r *http.Request, topic, path, id string, received time.Time, contentType string, value []byte) ([]byte, string, error) {
+	ce := s.current().topics[topic].CloudEvents
+	if ce.Mode == "" {
+		return value, contentType, nil
+	}
+	event := cloudEvent{
+		SpecVersion:     "1.0",
+		ID:              id,
+		Source:          ce.Source,
+		Type:            ce.Type,
+		Time:            received.UTC().Format(time.RFC3339Nano),
+		DataContentType: contentType,
+	}
+	if event.Source == "" {
+		event.Source = "/" + path
+	}
+	if t := r.Header.Get(ce.TypeHeader); ce.TypeHeader != "" && t != "" {
+		event.Type = t
+	}
+	if event.Type == "" {
+		event.Type = defaultCloudEventType
+	}
+	if event.DataContentType == "" && isJSON("", value) {
+		event.DataContentType = "application/json"
+	}
+	// The binding's lowercase content-type replaces the one kahook forwards,
+	// and ce_ headers are kahook's to set.
+	delete(headers, contentTypeHeader)
+	for name := range headers {
+		if strings.HasPrefix(strings.ToLower(name), cloudEventsHeaderPrefix) {
+			delete(headers, name)
+		}
+	}
+
+	if ce.Mode == CloudEventsBinary {
+		prefix := cloudEventsHeaderPrefix
+		headers[prefix+"specversion"] = event.SpecVersion
+		headers[prefix+"id"] = event.ID
+		headers[prefix+"source"] = event.Source
+		headers[prefix+"type"] = event.Type
+		headers[prefix+"time"] = event.Time
+		if event.DataContentType != "" {
+			headers[cloudEventsContentTypeHeader] = event.DataContentType
+		}
+		return value, event.DataContentType, nil
+	}
+
+	if isJSON(contentType, value) && json.Valid(value) {
+		event.Data = value
+	} else {
+		event.DataBase64 = base64.StdEncoding.EncodeToString(value)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(event); err != nil {
+		return nil, "", err
+	}
+	headers[cloudEventsContentTypeHeader] = cloudEventsJSON
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), cloudEventsJSON, nil
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connAgeJitter spreads connection expiry by ±10% so connections opened
+// together (e.g. after a deploy) are not all recycled at the same moment.
+const connAgeJitter = 0.1
+
+type connCtxKey struct{}
+
+// connAger recycles connections older than a maximum age. A busy connection
+// is told to close after its current response ("Connection: close", or
+// GOAWAY on HTTP/2); an idle one is closed by a periodic sweep. Either way no
+// in-flight request is cut off, and the client reconnects, possibly through a
+// different load balancer backend.
+type connAger struct {
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu    sync.Mutex
+	conns map[net.Conn]*connInfo
+
+	// recycled counts connections closed for age.
+	recycled *atomic.Int64
+}
+
+type connInfo struct {
+	expires time.Time
+	idle    bool
+}
+
+func newConnAger(maxAge time.Duration, recycled *atomic.Int64, now func() time.Time) *connAger {
+	return &connAger{
+		maxAge:   maxAge,
+		now:      now,
+		conns:    make(map[net.Conn]*connInfo),
+		recycled: recycled,
+	}
+}
+
+// connContext stores the connection in the request context so the handler
+// can look up its age. It is installed as http.Server.ConnContext.
+func (a *connAger) connContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connCtxKey{}, c)
+}
+
+// connState tracks connection lifecycle. It is installed as
+// http.Server.ConnState.
+func (a *connAger) connState(c net.Conn, state http.ConnState) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch state {
+	case http.StateNew:
+		jitter := 1 + connAgeJitter*(2*rand.Float64()-1)
+		a.conns[c] = &connInfo{expires: a.now().Add(time.Duration(float64(a.maxAge) * jitter))}
+	case http.StateActive:
+		if ci, ok := a.conns[c]; ok {
+			ci.idle = false
+		}
+	case http.StateIdle:
+		if ci, ok := a.conns[c]; ok {
+			ci.idle = true
+		}
+	case http.StateHijacked, http.StateClosed:
+		delete(a.conns, c)
+	}
+}
+
+// middleware marks responses on expired connections as the last one.
+func (a *connAger) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, ok := r.Context().Value(connCtxKey{}).(net.Conn); ok && a.expired(c) {
+			w.Header().Set("Connection", "close")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *connAger) expired(c net.Conn) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ci, ok := a.conns[c]
+	if ok && !a.now().Before(ci.expires) {
+		// Count once: the connection closes after this response.
+		delete(a.conns, c)
+		a.recycled.Add(1)
+		return true
+	}
+	return false
+}
+
+// sweep closes idle connections past their age and returns how many.
+func (a *connAger) sweep() int {
+	now := a.now()
+
+	a.mu.Lock()
+	var stale []net.Conn
+	for c, ci := range a.conns {
+		if ci.idle && !now.Before(ci.expires) {
+			stale = append(stale, c)
+			delete(a.conns, c)
+		}
+	}
+	a.mu.Unlock()
+
+	a.recycled.Add(int64(len(stale)))
+
+	for _, c := range stale {
+		_ = c.Close()
+	}
+	return len(stale)
+}
+
+// run sweeps until ctx is done. The interval is a tenth of the maximum age,
+// bounded to [1s, 30s].
+func (a *connAger) run(ctx context.Context) {
+	interval := min(max(a.maxAge/10, time.Second), 30*time.Second)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			a.sweep()
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// limitListener accepts at most max connections at a time. Once that many
+// are open, Accept waits for one to close, leaving new clients in the
+// kernel's backlog rather than refusing them.
+type limitListener struct {
+	net.Listener
+	slots   chan struct{}
+	waiting *atomic.Int64 // counts accepts that had to wait for a slot
+	done    chan struct{}
+	close   sync.Once
+}
+
+func newLimitListener(ln net.Listener, max int, waiting *atomic.Int64) *limitListener {
+	return &limitListener{
+		Listener: ln,
+		slots:    make(chan struct{}, max),
+		waiting:  waiting,
+		done:     make(chan struct{}),
+	}
+}
+
+// acquire takes a slot, and reports false if the listener closed first.
+func (l *limitListener) acquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	default:
+	}
+	l.waiting.Add(1)
+	select {
+	case l.slots <- struct{}{}:
+		return true
+	case <-l.done:
+		return false
+	}
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if !l.acquire() {
+		return nil, net.ErrClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.slots
+		return nil, err
+	}
+	return &limitedConn{Conn: c, release: func() { <-l.slots }}, nil
+}
+
+func (l *limitListener) Close() error {
+	l.close.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// limitedConn frees its listener slot when it is first closed.
+type limitedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *limitedConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+// consolePath serves the webhook test console in the dev profile.
+const consolePath = "/_kahook/console"
+
+// consoleCSP lets the console load its own script and call the send
+// endpoint; everything else stays as locked down as the JSON endpoints.
+const consoleCSP = "default-src 'none'; script-src 'self'; style-src 'unsafe-inline'; connect-src 'self'; frame-ancestors 'none'"
+
+// maxConsoleRequestBytes bounds a console send request: the webhook body
+// plus room for the topic and headers.
+const maxConsoleRequestBytes = defaultMaxBodyBytes + 64<<10
+
+var (
+	//go:embed console.html
+	consoleHTML []byte
+	//go:embed console.js
+	consoleJS []byte
+)
+
+// ConsoleRequest is the body of POST /_kahook/console/send: a webhook to
+// run through the full request pipeline.
+type ConsoleRequest struct {
+	Topic   string            `json:"topic"`
+	Headers map[string]string `json:"headers"`
+	Body    string            `json:"body"`
+}
+
+// ConsoleMessage is the message the pipeline handed to the producer.
+// ValueEncoding is "utf-8", or "base64" for binary values. DeliveryError is
+// empty when the producer accepted the message.
+type ConsoleMessage struct {
+	Topic         string            `json:"topic"`
+	Key           string            `json:"key,omitempty"`
+	Value         string            `json:"value"`
+	ValueEncoding string            `json:"value_encoding"`
+	Headers       map[string]string `json:"headers"`
+	DeliveryError string            `json:"delivery_error,omitempty"`
+}
+
+// ConsoleResponse reports the webhook response and, if the request got as
+// far as producing, the message that was produced.
+type ConsoleResponse struct {
+	Status   int               `json:"status"`
+	Headers  map[string]string `json:"headers"`
+	Response json.RawMessage   `json:"response"`
+	Message  *ConsoleMessage   `json:"message,omitempty"`
+}
+
+// consoleCaptureKey carries a *ConsoleMessage through the request context
+// so produce can record what it sends.
+type consoleCaptureKey struct{}
+
+// captureProduced records a produced message for a console request. It is
+// only called in the dev profile.
+func captureProduced(ctx context.Context, topic string, key, value []byte, headers map[string]string, err error) {
+	msg, ok := ctx.Value(consoleCaptureKey{}).(*ConsoleMessage)
+	if !ok {
+		return
+	}
+	*msg = ConsoleMessage{
+		Topic:         topic,
+		Key:           string(key),
+		Value:         string(value),
+		ValueEncoding: "utf-8",
+		Headers:       maps.Clone(headers),
+	}
+	if !utf8.Valid(value) {
+		msg.Value = base64.StdEncoding.EncodeToString(value)
+		msg.ValueEncoding = "base64"
+	}
+	if err != nil {
+		msg.DeliveryError = err.Error()
+	}
+}
+
+// consoleHandler serves the console page and its script.
+func (s *Server) consoleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
+		return
+	}
+	w.Header().Set("Content-Security-Policy", consoleCSP)
+	switch r.URL.Path {
+	case consolePath:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(consoleHTML)
+	case consolePath + "/console.js":
+		w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+		w.Write(consoleJS)
+	default:
+		s.writeError(w, http.StatusNotFound, "not_found", "not found")
+	}
+}
+
+// consoleSendHandler runs a webhook described by a ConsoleRequest through
+// the server's full handler chain, as if it had arrived from the caller's
+// address, and reports the response and the produced message.
+func (s *Server) consoleSendHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST is allowed")
+		return
+	}
+	// Requiring JSON makes cross-origin pages go through a CORS preflight,
+	// which kahook never answers.
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		s.writeError(w, http.StatusUnsupportedMediaType, "unsupported_media_type", "Content-Type must be application/json")
+		return
+	}
+
+	var creq ConsoleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxConsoleRequestBytes)).Decode(&creq); err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", "request body must be a JSON console request")
+		return
+	}
+	// Checking the topic here also keeps the request from being routed back
+	// to the console.
+	if !validTopicName.MatchString(creq.Topic) {
+		s.writeError(w, http.StatusBadRequest, "invalid_topic",
+			"topic must match [a-zA-Z0-9._-] and be 1-249 characters")
+		return
+	}
+
+	var msg ConsoleMessage
+	ctx := context.WithValue(r.Context(), consoleCaptureKey{}, &msg)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/"+creq.Topic, strings.NewReader(creq.Body))
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_request", "failed to build webhook request")
+		return
+	}
+	for k, v := range creq.Headers {
+		req.Header.Set(k, v)
+	}
+	req.RemoteAddr = r.RemoteAddr
+
+	rec := &consoleRecorder{header: make(http.Header), status: http.StatusOK}
+	s.httpServer.Handler.ServeHTTP(rec, req)
+
+	resp := ConsoleResponse{
+		Status:   rec.status,
+		Headers:  make(map[string]string, len(rec.header)),
+		Response: json.RawMessage(bytes.TrimSpace(rec.body.Bytes())),
+	}
+	for k, v := range rec.header {
+		resp.Headers[k] = strings.Join(v, ", ")
+	}
+	if !json.Valid(resp.Response) {
+		resp.Response, _ = json.Marshal(rec.body.String())
+	}
+	if msg.Topic != "" {
+		resp.Message = &msg
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// consoleRecorder collects the response to a console webhook.
+type consoleRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (c *consoleRecorder) Header() http.Header         { return c.header }
+func (c *consoleRecorder) Write(b []byte) (int, error) { return c.body.Write(b) }
+func (c *consoleRecorder) WriteHeader(status int)      { c.status = status }
@@ -0,0 +1,46 @@
+"use strict";
+
+function parseHeaders(text) {
+  const headers = {};
+  for (const line of text.split("\n")) {
+    const i = line.indexOf(":");
+    if (i > 0) {
+      headers[line.slice(0, i).trim()] = line.slice(i + 1).trim();
+    }
+  }
+  return headers;
+}
+
+document.getElementById("form").addEventListener("submit", async (event) => {
+  event.preventDefault();
+  const status = document.getElementById("status");
+  const response = document.getElementById("response");
+  const message = document.getElementById("message");
+
+  let result;
+  try {
+    const res = await fetch("/_kahook/console/send", {
+      method: "POST",
+      headers: { "Content-Type": "application/json" },
+      body: JSON.stringify({
+        topic: document.getElementById("topic").value.trim(),
+        headers: parseHeaders(document.getElementById("headers").value),
+        body: document.getElementById("body").value,
+      }),
+    });
+    result = await res.json();
+    if (!res.ok) {
+      result = { status: res.status, headers: {}, response: result };
+    }
+  } catch (err) {
+    result = { status: 0, headers: {}, response: String(err) };
+  }
+
+  document.getElementById("result").hidden = false;
+  status.textContent = result.status;
+  status.className = result.status >= 200 && result.status < 300 ? "ok" : "fail";
+  response.textContent = JSON.stringify({ headers: result.headers, body: result.response }, null, 2);
+  message.textContent = result.message
+    ? JSON.stringify(result.message, null, 2)
+    : "Nothing was produced: the request was rejected before reaching the producer.";
+});
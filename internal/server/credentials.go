@@ -0,0 +1,167 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+)
+
+// Credential roles reported by /admin/credentials.
+const (
+	rolePublish = "publish"
+	roleMetrics = "metrics"
+)
+
+// CredentialUsage is one configured credential in /admin/credentials.
+// LastUsed is omitted for credentials not used since tracking started.
+type CredentialUsage struct {
+	Principal string     `json:"principal"`
+	Scheme    string     `json:"scheme"`
+	Role      string     `json:"role"`
+	Requests  int64      `json:"requests"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+}
+
+// CredentialsResponse is the body returned by /admin/credentials. Counts are
+// kept in memory since Since, when the server started.
+type CredentialsResponse struct {
+	Since       time.Time         `json:"since"`
+	Credentials []CredentialUsage `json:"credentials"`
+}
+
+type credentialKey struct {
+	role      string
+	principal string
+}
+
+type credentialStats struct {
+	scheme   string
+	requests atomic.Int64
+	lastUsed atomic.Int64 // unix nanoseconds; 0 until first use
+}
+
+// credentialUsage counts authenticated requests per configured credential.
+// The set of credentials is fixed when it is built, so recording needs no
+// lock.
+type credentialUsage struct {
+	stats        map[credentialKey]*credentialStats
+	since        time.Time
+	dormantAfter time.Duration
+	logger       *zap.Logger
+	now          func() time.Time
+}
+
+func newCredentialUsage(publish, metrics []auth.Credential, dormantAfter time.Duration, logger *zap.Logger, now func() time.Time) *credentialUsage {
+	u := &credentialUsage{
+		stats:        make(map[credentialKey]*credentialStats, len(publish)+len(metrics)),
+		since:        now(),
+		dormantAfter: dormantAfter,
+		logger:       logger,
+		now:          now,
+	}
+	for _, c := range publish {
+		u.stats[credentialKey{rolePublish, c.Principal}] = &credentialStats{scheme: c.Scheme}
+	}
+	for _, c := range metrics {
+		u.stats[credentialKey{roleMetrics, c.Principal}] = &credentialStats{scheme: c.Scheme}
+	}
+	return u
+}
+
+// withPublish returns usage tracking publish as the publish credentials,
+// for a reload. Credentials in both keep their counts and last use.
+func (u *credentialUsage) withPublish(publish []auth.Credential) *credentialUsage {
+	next := &credentialUsage{
+		stats:        make(map[credentialKey]*credentialStats, len(u.stats)),
+		since:        u.since,
+		dormantAfter: u.dormantAfter,
+		logger:       u.logger,
+		now:          u.now,
+	}
+	for key, st := range u.stats {
+		if key.role != rolePublish {
+			next.stats[key] = st
+		}
+	}
+	for _, c := range publish {
+		key := credentialKey{rolePublish, c.Principal}
+		if st, ok := u.stats[key]; ok && st.scheme == c.Scheme {
+			next.stats[key] = st
+			continue
+		}
+		next.stats[key] = &credentialStats{scheme: c.Scheme}
+	}
+	return next
+}
+
+// record counts a request authenticated as principal in role. A credential
+// used again after going unused for dormantAfter is logged, since a dormant
+// credential coming back to life is a common sign of a leak.
+func (u *credentialUsage) record(role, principal string) {
+	st, ok := u.stats[credentialKey{role, principal}]
+	if !ok {
+		return
+	}
+	st.requests.Add(1)
+	now := u.now().UnixNano()
+	prev := st.lastUsed.Swap(now)
+	if u.dormantAfter > 0 && prev != 0 && time.Duration(now-prev) >= u.dormantAfter {
+		u.logger.Warn("dormant credential used",
+			zap.String("principal", principal),
+			zap.String("role", role),
+			zap.Duration("unused_for", time.Duration(now-prev)),
+		)
+	}
+}
+
+// snapshot returns every credential's usage, sorted by role and principal.
+func (u *credentialUsage) snapshot() CredentialsResponse {
+	resp := CredentialsResponse{Since: u.since, Credentials: make([]CredentialUsage, 0, len(u.stats))}
+	for key, st := range u.stats {
+		c := CredentialUsage{
+			Principal: key.principal,
+			Scheme:    st.scheme,
+			Role:      key.role,
+			Requests:  st.requests.Load(),
+		}
+		if ns := st.lastUsed.Load(); ns != 0 {
+			t := time.Unix(0, ns).UTC()
+			c.LastUsed = &t
+		}
+		resp.Credentials = append(resp.Credentials, c)
+	}
+	sort.Slice(resp.Credentials, func(i, j int) bool {
+		a, b := resp.Credentials[i], resp.Credentials[j]
+		if a.Role != b.Role {
+			return a.Role > b.Role // publish before metrics
+		}
+		return a.Principal < b.Principal
+	})
+	return resp
+}
+
+// credentialsHandler lists configured credentials with their request counts
+// and last use, so unused ones can be found and revoked. Principals are
+// usernames and token fingerprints; secrets are never included. It requires
+// publish credentials.
+func (s *Server) credentialsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
+		return
+	}
+
+	rt := s.current()
+	principal, ok := rt.auth.Identify(r)
+	if !ok {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	rt.credentials.record(rolePublish, principal)
+
+	s.writeJSON(w, http.StatusOK, rt.credentials.snapshot())
+}
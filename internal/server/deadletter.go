@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Message headers on dead-lettered webhooks, besides Kahook-Original-Topic.
+const (
+	deadLetterErrorHeader    = "Kahook-Dead-Letter-Error"
+	deadLetterAttemptsHeader = "Kahook-Dead-Letter-Attempts"
+)
+
+// DeadLetter retries failed produces and then produces the message to
+// Topic, with the error, the number of attempts, and the topic it was sent
+// to as message headers, so a webhook is not lost when its topic cannot be
+// written. Retries is the number of extra attempts, waiting Backoff before
+// the first and doubling the wait after each. An empty Topic only retries.
+type DeadLetter struct {
+	Topic   string
+	Retries int
+	Backoff time.Duration
+}
+
+// retryProduce retries a message whose first produce failed with err. It
+// returns the number of attempts made, including the first, and the last
+// error, or nil once an attempt succeeds. It stops early when ctx ends.
+func (s *Server) retryProduce(ctx context.Context, topic string, key, value []byte, headers map[string]string, err error) (int, error) {
+	s.retrying.Add(1)
+	defer s.retrying.Add(-1)
+	attempts := 1
+	backoff := s.deadLetter.Backoff
+	for attempts <= s.deadLetter.Retries {
+		t := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return attempts, err
+		case <-t.C:
+		}
+		backoff *= 2
+		attempts++
+
+		s.metrics.ProduceRetries.Add(1)
+		produceCtx, cancel := context.WithTimeout(ctx, produceTimeout)
+		err = s.produce(produceCtx, topic, key, value, headers)
+		cancel()
+		if err == nil {
+			return attempts, nil
+		}
+		s.loggerFor(ctx).Warn("produce retry failed",
+			zap.Int("attempt", attempts),
+			zap.Error(err),
+		)
+	}
+	return attempts, err
+}
+
+// produceDeadLetter produces a message that could not be written to topic
+// to the dead letter topic, and reports whether it was. It runs even when
+// the sender has gone away, so the message is kept either way.
+func (s *Server) produceDeadLetter(ctx context.Context, topic string, key, value []byte, headers map[string]string, attempts int, cause error) bool {
+	if s.deadLetter.Topic == "" {
+		return false
+	}
+	headers[originalTopicHeader] = topic
+	headers[deadLetterErrorHeader] = cause.Error()
+	headers[deadLetterAttemptsHeader] = strconv.Itoa(attempts)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), produceTimeout)
+	defer cancel()
+	if err := s.produce(ctx, s.deadLetter.Topic, key, value, headers); err != nil {
+		s.loggerFor(ctx).Error("failed to produce dead letter",
+			zap.String("dead_letter_topic", s.deadLetter.Topic),
+			zap.Error(err),
+		)
+		return false
+	}
+	s.metrics.DeadLettered.Add(1)
+	return true
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// contentEncodingHeader names the encoding of a request body and, on topics
+// that keep payloads compressed, of the message value.
+const contentEncodingHeader = "Content-Encoding"
+
+// Body encodings kahook decompresses, as named in Content-Encoding.
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+// errDecompressedTooLarge is returned for bodies that decompress to more
+// than the server's limit.
+var errDecompressedTooLarge = errors.New("decompressed body too large")
+
+// bodyEncoding returns the encoding of a request body: encodingGzip,
+// encodingDeflate, or "" for an uncompressed body. Stacked encodings are not
+// supported.
+func bodyEncoding(h http.Header) (string, error) {
+	enc := strings.ToLower(strings.TrimSpace(h.Get(contentEncodingHeader)))
+	switch enc {
+	case "", "identity":
+		return "", nil
+	case "gzip", "x-gzip":
+		return encodingGzip, nil
+	case "deflate":
+		return encodingDeflate, nil
+	}
+	return "", fmt.Errorf("unsupported Content-Encoding %q (want gzip or deflate)", enc)
+}
+
+// decompress decodes a body compressed with encoding into a pooled buffer,
+// which the caller puts back. Deflate bodies are zlib-wrapped per RFC 9110,
+// but raw DEFLATE streams, which some senders send instead, are accepted
+// too.
+func decompress(encoding string, body []byte, limit int) (*[]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch encoding {
+	case encodingGzip:
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case encodingDeflate:
+		r, err = zlib.NewReader(bytes.NewReader(body))
+		if errors.Is(err, zlib.ErrHeader) {
+			r, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	buf, err := bodyBuffers.readBody(io.LimitReader(r, int64(limit)+1), -1, int64(limit))
+	if err != nil {
+		return nil, err
+	}
+	if len(*buf) > limit {
+		bodyBuffers.put(buf)
+		return nil, errDecompressedTooLarge
+	}
+	return buf, nil
+}
+
+// compress encodes value with encoding, for topics that keep payloads
+// compressed but changed them after decompressing.
+func compress(encoding string, value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case encodingGzip:
+		w = gzip.NewWriter(&buf)
+	case encodingDeflate:
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeBody returns the decompressed body of a request sent with a
+// Content-Encoding, and the encoding, normalized. It may decompress to
+// MaxDecompressedBytes, or to bodyLimit when that is unset. Uncompressed
+// bodies are returned as they are. The caller must call release once nothing
+// references the body. On failure it writes the error response and returns
+// ok=false.
+func (s *Server) decodeBody(w http.ResponseWriter, r *http.Request, body []byte, bodyLimit int64) (plain []byte, encoding string, release func(), ok bool) {
+	release = func() {}
+	encoding, err := bodyEncoding(r.Header)
+	if err != nil {
+		s.writeError(w, http.StatusUnsupportedMediaType, "unsupported_encoding", err.Error())
+		return nil, "", release, false
+	}
+	if encoding == "" {
+		return body, "", release, true
+	}
+	limit := s.maxDecompressedBytes
+	if limit <= 0 {
+		limit = int(bodyLimit)
+	}
+	buf, err := decompress(encoding, body, limit)
+	if errors.Is(err, errDecompressedTooLarge) {
+		s.writeError(w, http.StatusRequestEntityTooLarge, "body_too_large",
+			fmt.Sprintf("request body decompresses to more than the maximum size of %d bytes", limit))
+		return nil, "", release, false
+	}
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid_encoding",
+			fmt.Sprintf("request body is not valid %s data", encoding))
+		return nil, "", release, false
+	}
+	s.metrics.BodiesDecompressed.Add(1)
+	return *buf, encoding, func() { bodyBuffers.put(buf) }, true
+}
+
+// setCompression sets what the message value is encoded with. Topics that
+// keep payloads compressed produce the body as it arrived when the value
+// is the decompressed body unchanged, and recompress it otherwise. The
+// request's Content-Encoding is never forwarded as is, so consumers do not
+// decode a value that is no longer compressed.
+func (s *Server) setCompression(headers map[string]string, topic, encoding string, compressed, plain, value []byte) ([]byte, error) {
+	delete(headers, contentEncodingHeader)
+	if encoding == "" || !s.current().topics[topic].KeepCompressed {
+		return value, nil
+	}
+	if !bytes.Equal(value, plain) {
+		var err error
+		if value, err = compress(encoding, value); err != nil {
+			return nil, err
+		}
+	} else {
+		value = compressed
+	}
+	headers[contentEncodingHeader] = encoding
+	return value, nil
+}
@@ -0,0 +1,276 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/ratelimit"
+)
+
+// errorBudgetBuckets is how many slices the failure window is kept in; the
+// ratio is over the last Window, give or take one slice.
+const errorBudgetBuckets = 10
+
+// Defaults for the zero values of ErrorBudget.
+const (
+	defaultErrorBudgetMinRequests = 20
+	defaultErrorBudgetWindow      = time.Minute
+	defaultErrorBudgetDuration    = time.Minute
+	defaultErrorBudgetRate        = 1
+)
+
+// ErrorBudget throttles a topic whose produces keep failing, so a broken
+// topic does not tie up producer queues and in-flight slots that healthy
+// topics need. Once more than FailureRatio of at least MinRequests
+// produces over Window fail, the topic is held to Throttle for Duration,
+// and further webhooks to it get 429s. Webhooks still admitted keep
+// probing the topic; if they keep failing it is throttled again.
+//
+// TopicRatios overrides FailureRatio by topic; a ratio of zero exempts a
+// topic. MinRequests defaults to 20, Window and Duration to a minute, and
+// Throttle to one request per second.
+type ErrorBudget struct {
+	FailureRatio float64
+	TopicRatios  map[string]float64
+	MinRequests  int
+	Window       time.Duration
+	Duration     time.Duration
+	Throttle     ratelimit.Limit
+}
+
+func (b ErrorBudget) enabled() bool {
+	if b.FailureRatio > 0 {
+		return true
+	}
+	for _, r := range b.TopicRatios {
+		if r > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TopicBudget is one topic's state in /admin/error-budgets. Requests and
+// Failures cover the current window. OverrideUntil is set while an admin
+// has suspended throttling of the topic.
+type TopicBudget struct {
+	Topic          string     `json:"topic"`
+	FailureRatio   float64    `json:"failure_ratio"`
+	Threshold      float64    `json:"threshold"`
+	Requests       int64      `json:"requests"`
+	Failures       int64      `json:"failures"`
+	Throttled      bool       `json:"throttled"`
+	ThrottledUntil *time.Time `json:"throttled_until,omitempty"`
+	OverrideUntil  *time.Time `json:"override_until,omitempty"`
+}
+
+// ErrorBudgetsResponse is the body returned by /admin/error-budgets.
+type ErrorBudgetsResponse struct {
+	Topics []TopicBudget `json:"topics"`
+}
+
+// errorBudgets tracks produce outcomes per topic and throttles topics that
+// exhaust their budget.
+type errorBudgets struct {
+	cfg     ErrorBudget
+	slice   time.Duration
+	limiter *ratelimit.Limiter
+	trips   *atomic.Int64
+	logger  *zap.Logger
+	now     func() time.Time
+
+	mu     sync.Mutex
+	topics map[string]*topicBudget
+}
+
+type topicBudget struct {
+	buckets        [errorBudgetBuckets]budgetBucket
+	throttledUntil time.Time
+	overrideUntil  time.Time
+}
+
+type budgetBucket struct {
+	slice           int64 // index of the slice of time the counts belong to
+	total, failures int64
+}
+
+// newErrorBudgets returns nil when no topic has a budget.
+func newErrorBudgets(cfg ErrorBudget, trips *atomic.Int64, logger *zap.Logger, now func() time.Time) *errorBudgets {
+	if !cfg.enabled() {
+		return nil
+	}
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = defaultErrorBudgetMinRequests
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = defaultErrorBudgetWindow
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = defaultErrorBudgetDuration
+	}
+	if cfg.Throttle.Unlimited() {
+		cfg.Throttle = ratelimit.Limit{Rate: defaultErrorBudgetRate}
+	}
+	return &errorBudgets{
+		cfg:     cfg,
+		slice:   cfg.Window / errorBudgetBuckets,
+		limiter: ratelimit.NewLimiter(cfg.Throttle, nil).WithClock(now),
+		trips:   trips,
+		logger:  logger,
+		now:     now,
+		topics:  make(map[string]*topicBudget),
+	}
+}
+
+// threshold returns topic's failure ratio; zero means it has no budget.
+func (b *errorBudgets) threshold(topic string) float64 {
+	if r, ok := b.cfg.TopicRatios[topic]; ok {
+		return r
+	}
+	return b.cfg.FailureRatio
+}
+
+// observe records the outcome of a produce to topic and throttles the topic
+// when it has used up its budget.
+func (b *errorBudgets) observe(topic string, ok bool) {
+	threshold := b.threshold(topic)
+	if threshold <= 0 {
+		return
+	}
+	now := b.now()
+	slice := now.UnixNano() / int64(b.slice)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, found := b.topics[topic]
+	if !found {
+		t = &topicBudget{}
+		b.topics[topic] = t
+	}
+	bk := &t.buckets[slice%errorBudgetBuckets]
+	if bk.slice != slice {
+		*bk = budgetBucket{slice: slice}
+	}
+	bk.total++
+	if !ok {
+		bk.failures++
+	}
+
+	if now.Before(t.throttledUntil) || now.Before(t.overrideUntil) {
+		return
+	}
+	total, failures := t.counts(slice)
+	if total < int64(b.cfg.MinRequests) || float64(failures)/float64(total) <= threshold {
+		return
+	}
+	t.throttledUntil = now.Add(b.cfg.Duration)
+	b.trips.Add(1)
+	b.logger.Warn("topic throttled: produce error budget exhausted",
+		zap.String("topic", topic),
+		zap.Int64("requests", total),
+		zap.Int64("failures", failures),
+		zap.Float64("threshold", threshold),
+		zap.Duration("duration", b.cfg.Duration),
+	)
+}
+
+// counts sums the buckets within the window ending in slice.
+func (t *topicBudget) counts(slice int64) (total, failures int64) {
+	for _, bk := range t.buckets {
+		if slice-bk.slice < errorBudgetBuckets {
+			total += bk.total
+			failures += bk.failures
+		}
+	}
+	return total, failures
+}
+
+// admit reports whether a webhook to topic may proceed, and how long to
+// wait if not. Topics that are not throttled are always admitted.
+func (b *errorBudgets) admit(topic string) (bool, time.Duration) {
+	now := b.now()
+	b.mu.Lock()
+	t, ok := b.topics[topic]
+	throttled := ok && now.Before(t.throttledUntil)
+	b.mu.Unlock()
+	if !throttled {
+		return true, 0
+	}
+	return b.limiter.AllowN(topic, 1)
+}
+
+// lift ends topic's throttle, if any, and suspends throttling it for hold,
+// for an operator who knows the failures are over or wants them to reach
+// the dead letter topic at full rate. The failures so far are forgotten.
+func (b *errorBudgets) lift(topic string, hold time.Duration) {
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topics[topic] = &topicBudget{overrideUntil: now.Add(hold)}
+}
+
+// throttled returns the topics throttled now, sorted.
+func (b *errorBudgets) throttled() []string {
+	now := b.now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var topics []string
+	for name, t := range b.topics {
+		if now.Before(t.throttledUntil) {
+			topics = append(topics, name)
+		}
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// snapshot returns every tracked topic's budget, sorted by topic.
+func (b *errorBudgets) snapshot() ErrorBudgetsResponse {
+	now := b.now()
+	slice := now.UnixNano() / int64(b.slice)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	resp := ErrorBudgetsResponse{Topics: make([]TopicBudget, 0, len(b.topics))}
+	for name, t := range b.topics {
+		tb := TopicBudget{Topic: name, Threshold: b.threshold(name)}
+		tb.Requests, tb.Failures = t.counts(slice)
+		if tb.Requests > 0 {
+			tb.FailureRatio = float64(tb.Failures) / float64(tb.Requests)
+		}
+		if now.Before(t.throttledUntil) {
+			until := t.throttledUntil.UTC()
+			tb.Throttled, tb.ThrottledUntil = true, &until
+		}
+		if now.Before(t.overrideUntil) {
+			until := t.overrideUntil.UTC()
+			tb.OverrideUntil = &until
+		}
+		resp.Topics = append(resp.Topics, tb)
+	}
+	sort.Slice(resp.Topics, func(i, j int) bool { return resp.Topics[i].Topic < resp.Topics[j].Topic })
+	return resp
+}
+
+// errorBudgetsHandler serves GET /admin/error-budgets, each topic's failures
+// and throttle. It requires publish credentials. Throttles are lifted
+// through the admin API.
+func (s *Server) errorBudgetsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
+		return
+	}
+
+	rt := s.current()
+	principal, ok := rt.auth.Identify(r)
+	if !ok {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	rt.credentials.record(rolePublish, principal)
+	s.writeJSON(w, http.StatusOK, s.errorBudgets.snapshot())
+}
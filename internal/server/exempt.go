@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// RateLimitExemptions lists traffic that bypasses bandwidth limits, such as
+// internal backfills that legitimately exceed limits meant for external
+// senders. A request is exempt if any of its principal, client address, topic,
+// or route path is listed.
+type RateLimitExemptions struct {
+	// Principals are Basic usernames or bearer token fingerprints.
+	Principals []string
+	Networks   []netip.Prefix
+	// Topics are topic names or route paths, without slashes.
+	Topics []string
+}
+
+// rateLimitExemptions is the lookup form of RateLimitExemptions.
+type rateLimitExemptions struct {
+	callers callerSet
+	topics  map[string]bool
+}
+
+// newRateLimitExemptions returns nil when nothing is exempt.
+func newRateLimitExemptions(e RateLimitExemptions) *rateLimitExemptions {
+	if len(e.Principals) == 0 && len(e.Networks) == 0 && len(e.Topics) == 0 {
+		return nil
+	}
+	out := &rateLimitExemptions{
+		callers: newCallerSet(e.Principals, e.Networks),
+		topics:  make(map[string]bool, len(e.Topics)),
+	}
+	for _, t := range e.Topics {
+		out.topics[t] = true
+	}
+	return out
+}
+
+// exempt reports whether a request for path, producing to topic, skips
+// bandwidth limits.
+func (e *rateLimitExemptions) exempt(r *http.Request, principal, path, topic string) bool {
+	if e == nil {
+		return false
+	}
+	return e.topics[path] || e.topics[topic] || e.callers.contains(r, principal)
+}
+
+// callerSet matches requests by authenticated principal or client network.
+type callerSet struct {
+	principals map[string]bool
+	networks   []netip.Prefix
+}
+
+func newCallerSet(principals []string, networks []netip.Prefix) callerSet {
+	c := callerSet{principals: make(map[string]bool, len(principals)), networks: networks}
+	for _, p := range principals {
+		c.principals[p] = true
+	}
+	return c
+}
+
+// contains reports whether the request's principal is listed or its client
+// address falls in a listed network.
+func (c callerSet) contains(r *http.Request, principal string) bool {
+	if principal != "" && c.principals[principal] {
+		return true
+	}
+	if len(c.networks) == 0 {
+		return false
+	}
+	addr, ok := clientAddr(r)
+	if !ok {
+		return false
+	}
+	for _, n := range c.networks {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the request's client address, with IPv4-mapped IPv6
+// addresses unmapped.
+func clientAddr(r *http.Request) (netip.Addr, bool) {
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ap.Addr().Unmap(), true
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+	"net/netip"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+// unknownCountry labels requests whose country could not be resolved in
+// /metrics.
+const unknownCountry = "unknown"
+
+// CountryResolver maps client addresses to ISO 3166-1 alpha-2 country codes.
+// It returns "" when the address has no known country.
+type CountryResolver interface {
+	Country(addr netip.Addr) (string, error)
+}
+
+// CountryPolicy restricts a topic to clients from the countries in Allow, or
+// from anywhere but those in Deny. Codes are uppercase.
+type CountryPolicy struct {
+	Allow []string
+	Deny  []string
+}
+
+// permits reports whether a client from country may publish. An allow list
+// rejects clients whose country is unknown ("").
+func (p CountryPolicy) permits(country string) bool {
+	if len(p.Allow) > 0 {
+		return country != "" && slices.Contains(p.Allow, country)
+	}
+	return country == "" || !slices.Contains(p.Deny, country)
+}
+
+// clientCountry resolves the country of the request's client address. It
+// returns "" when GeoIP is disabled or the country is unknown.
+func (s *Server) clientCountry(r *http.Request) string {
+	if s.geoip == nil {
+		return ""
+	}
+	ap, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+	country, err := s.geoip.Country(ap.Addr())
+	if err != nil {
+		s.loggerFor(r.Context()).Warn("geoip lookup failed", zap.String("remote_addr", r.RemoteAddr), zap.Error(err))
+		return ""
+	}
+	return country
+}
+
+// setCountryHeader records country on the message headers, replacing any
+// value the client sent under the same name so it cannot be spoofed.
+func (s *Server) setCountryHeader(headers map[string]string, country string) {
+	if s.geoip == nil {
+		return
+	}
+	if country == "" {
+		delete(headers, s.countryHeader)
+		return
+	}
+	headers[s.countryHeader] = country
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// maxPooledHeaders bounds the size of header maps returned to the pool. Maps
+// never shrink when cleared, so one request with hundreds of headers would
+// otherwise pin that capacity for every later request.
+const maxPooledHeaders = 64
+
+// headerFilter decides which request headers are forwarded as message headers.
+// Decisions are precomputed against the canonical header keys net/http
+// produces, so the common case is a single map lookup with no lowercasing.
+type headerFilter struct {
+	drop map[string]bool
+}
+
+// newHeaderFilter returns a filter that drops the given headers, matched
+// case-insensitively.
+func newHeaderFilter(names map[string]bool) *headerFilter {
+	f := &headerFilter{drop: make(map[string]bool, 2*len(names))}
+	for name := range names {
+		f.drop[http.CanonicalHeaderKey(name)] = true
+		f.drop[strings.ToLower(name)] = true
+	}
+	return f
+}
+
+// forward reports whether the header named key should be forwarded.
+func (f *headerFilter) forward(key string) bool {
+	if drop, ok := f.drop[key]; ok {
+		return !drop
+	}
+	// Keys set directly on the map rather than parsed off the wire may not be
+	// canonical; they are rare enough to pay for the conversion.
+	if key == http.CanonicalHeaderKey(key) {
+		return true
+	}
+	return !f.drop[http.CanonicalHeaderKey(key)]
+}
+
+// messageHeaders builds the forwarded message headers for h into a pooled
+// map. The caller returns it with putHeaderMap once Produce has returned.
+func (f *headerFilter) messageHeaders(h http.Header) map[string]string {
+	m := headerMaps.Get().(map[string]string)
+	for k, v := range h {
+		if len(v) > 0 && f.forward(k) {
+			m[k] = v[0]
+		}
+	}
+	return m
+}
+
+var headerMaps = sync.Pool{
+	New: func() any { return make(map[string]string, 16) },
+}
+
+func putHeaderMap(m map[string]string) {
+	if len(m) > maxPooledHeaders {
+		return
+	}
+	clear(m)
+	headerMaps.Put(m)
+}
+
+// setRouteHeaders adds the static headers configured for the route at path,
+// replacing forwarded request headers of the same name.
+func (s *Server) setRouteHeaders(headers map[string]string, path string) {
+	for name, value := range s.current().routeHeaders[path] {
+		delete(headers, http.CanonicalHeaderKey(name))
+		headers[name] = value
+	}
+}
+
+// forwardedHeaders is the filter applied to every webhook request.
+var forwardedHeaders = newHeaderFilter(internalHeaders)
+
+func isInternalHeader(key string) bool {
+	return !forwardedHeaders.forward(key)
+}
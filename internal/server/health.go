@@ -0,0 +1,91 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HealthReport is what /health?verbose=1 returns, for debugging an
+// instance. Status is "healthy", or "degraded" while the producer is not
+// connected or webhooks are being spooled; /health answers 200 either way,
+// since restarting the instance would not help.
+type HealthReport struct {
+	Status        string         `json:"status"`
+	Producer      ProducerHealth `json:"producer"`
+	ProduceQueues map[string]int `json:"produce_queues,omitempty"`
+	Spool         *SpoolStats    `json:"spool,omitempty"`
+	Reload        *ReloadStatus  `json:"reload,omitempty"`
+}
+
+// ProducerHealth is the state of the producer. Brokers is the number of
+// brokers in the latest cluster metadata, omitted for backends without
+// brokers, and LastError the latest failed produce since startup.
+type ProducerHealth struct {
+	Connected bool          `json:"connected"`
+	Brokers   *int          `json:"brokers,omitempty"`
+	LastError *ProduceError `json:"last_error,omitempty"`
+}
+
+// ProduceError describes a failed produce.
+type ProduceError struct {
+	Time  time.Time `json:"time"`
+	Topic string    `json:"topic"`
+	Error string    `json:"error"`
+}
+
+// ReloadStatus describes the config reloads since startup: how many were
+// applied and failed, and when the latest of each happened. LastError is
+// the error of the latest failure.
+type ReloadStatus struct {
+	Reloads     int64      `json:"reloads"`
+	LastReload  *time.Time `json:"last_reload,omitempty"`
+	Failures    int64      `json:"failures"`
+	LastFailure *time.Time `json:"last_failure,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// recordProduceError keeps err as the latest failed produce to topic. A
+// full produce queue is not the producer's failure and is not kept.
+func (s *Server) recordProduceError(topic string, err error) {
+	if err == nil || errors.Is(err, errQueueFull) {
+		return
+	}
+	s.lastProduceError.Store(&ProduceError{Time: s.now().UTC(), Topic: topic, Error: err.Error()})
+}
+
+// wantsVerboseHealth reports whether r asks /health for a HealthReport.
+func wantsVerboseHealth(r *http.Request) bool {
+	verbose, _ := strconv.ParseBool(r.URL.Query().Get("verbose"))
+	return verbose
+}
+
+// healthReport checks the producer, which fetches broker metadata, and
+// gathers the rest of the report.
+func (s *Server) healthReport() HealthReport {
+	report := HealthReport{Status: "healthy"}
+	report.Producer.Connected = s.producer != nil && s.producer.IsConnected()
+	if s.brokers != nil {
+		if n, ok := s.brokers(); ok {
+			report.Producer.Brokers = &n
+		}
+	}
+	report.Producer.LastError = s.lastProduceError.Load()
+	if s.dispatcher != nil {
+		report.ProduceQueues = s.dispatcher.depths()
+	}
+	if s.spool != nil {
+		if st, ok := s.spool(); ok {
+			report.Spool = &st
+		}
+	}
+	if s.reloadStatus != nil {
+		st := s.reloadStatus()
+		report.Reload = &st
+	}
+	if !report.Producer.Connected || report.Spool != nil && report.Spool.Outage != nil && report.Spool.Outage.Spooling {
+		report.Status = "degraded"
+	}
+	return report
+}
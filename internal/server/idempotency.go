@@ -0,0 +1,267 @@
+package server
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/signature"
+)
+
+const (
+	// defaultIdempotencyHeader names the idempotency key when
+	// Idempotency.Header is empty.
+	defaultIdempotencyHeader = "Idempotency-Key"
+	// defaultIdempotencyEntries is the number of responses cached when
+	// Idempotency.MaxEntries is zero.
+	defaultIdempotencyEntries = 10000
+	// replayedHeader marks a response replayed from the cache.
+	replayedHeader = "Idempotent-Replayed"
+)
+
+// Idempotency caches the response to a webhook for Window, so a sender
+// retrying the same delivery gets the original response back, message ID
+// and all, instead of the message being produced again. A delivery is
+// identified by its Header (default Idempotency-Key), or, when it has none
+// and its topic verifies signatures or HashBodies is set, by its body. Keys
+// are scoped to the principal and topic. Duplicates are answered with the
+// original status, or DuplicateStatus if set. A zero Window disables it.
+//
+// Responses are kept in memory, up to MaxEntries (default 10000), the
+// oldest dropped first; or, with Store set, in a store shared between
+// replicas, so a retry reaching another replica is recognised too. If the
+// store cannot be reached, webhooks are handled as if they had no key.
+//
+// Only accepted and dead-lettered webhooks are cached; a webhook that fails
+// can be retried. A retry that arrives while the original is being
+// produced is answered 409, and a key reused with a different body 422.
+type Idempotency struct {
+	Window          time.Duration
+	Header          string
+	MaxEntries      int
+	HashBodies      bool
+	DuplicateStatus int
+	Store           IdempotencyStore
+}
+
+// deduper identifies retried webhooks and holds their responses in a
+// backend.
+type deduper struct {
+	header          string
+	hashBodies      bool
+	duplicateStatus int
+	backend         idempotencyBackend
+}
+
+// idempotencyBackend holds the responses to recent webhooks by key.
+type idempotencyBackend interface {
+	// claim looks key up for a webhook whose body hashes to sum. For
+	// idempotentNew it returns the entry the caller must store or release;
+	// for idempotentReplay, the cached result.
+	claim(key string, sum [sha256.Size]byte) (*idempotentResult, int)
+	// store caches the response to the webhook holding res.
+	store(res *idempotentResult, status int, response map[string]string)
+	// release frees the key res holds, unless its response was stored.
+	release(res *idempotentResult)
+}
+
+// newDeduper returns nil when caching is disabled.
+func newDeduper(cfg Idempotency, now func() time.Time, logger *zap.Logger, storeErrors *atomic.Int64) *deduper {
+	if cfg.Window <= 0 {
+		return nil
+	}
+	header := cfg.Header
+	if header == "" {
+		header = defaultIdempotencyHeader
+	}
+	d := &deduper{header: header, hashBodies: cfg.HashBodies, duplicateStatus: cfg.DuplicateStatus}
+	if cfg.Store != nil {
+		d.backend = &sharedIdempotency{kv: cfg.Store, window: cfg.Window, logger: logger, errors: storeErrors}
+	} else {
+		d.backend = newIdempotencyCache(cfg.Window, cfg.MaxEntries, now)
+	}
+	return d
+}
+
+// idempotencyCache is the in-memory idempotencyBackend.
+type idempotencyCache struct {
+	window time.Duration
+	max    int
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*list.Element // of *idempotentResult
+	order   *list.List               // oldest first
+}
+
+// idempotentResult is the response to a webhook, or, until done, a hold on
+// its key while it is handled.
+type idempotentResult struct {
+	key     string
+	sum     [sha256.Size]byte // of the body
+	expires time.Time
+	pending []byte // the claim's entry in an IdempotencyStore
+
+	done     bool
+	status   int
+	response map[string]string
+}
+
+func newIdempotencyCache(window time.Duration, maxEntries int, now func() time.Time) *idempotencyCache {
+	limit := maxEntries
+	if limit <= 0 {
+		limit = defaultIdempotencyEntries
+	}
+	return &idempotencyCache{
+		window:  window,
+		max:     limit,
+		now:     now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Outcomes of idempotencyBackend.claim.
+const (
+	idempotentNew         = iota // the key is now held by the caller
+	idempotentReplay             // the key has a response for the same body
+	idempotentPending            // the key is held by a webhook still being handled
+	idempotentMismatch           // the key was used with a different body
+	idempotentUnavailable        // the store failed; handle the webhook without a key
+)
+
+func (c *idempotencyCache) claim(key string, sum [sha256.Size]byte) (*idempotentResult, int) {
+	now := c.now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.expire(now)
+	if e, ok := c.entries[key]; ok {
+		res := e.Value.(*idempotentResult)
+		switch {
+		case res.sum != sum:
+			return nil, idempotentMismatch
+		case !res.done:
+			return nil, idempotentPending
+		}
+		replay := *res
+		return &replay, idempotentReplay
+	}
+
+	for c.order.Len() >= c.max {
+		c.remove(c.order.Front())
+	}
+	res := &idempotentResult{key: key, sum: sum, expires: now.Add(c.window)}
+	c.entries[key] = c.order.PushBack(res)
+	return res, idempotentNew
+}
+
+func (c *idempotencyCache) store(res *idempotentResult, status int, response map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[res.key]
+	if !ok || e.Value != res {
+		return // evicted while the webhook was handled
+	}
+	res.done, res.status, res.response = true, status, response
+	res.expires = c.now().Add(c.window)
+	c.order.MoveToBack(e)
+}
+
+func (c *idempotencyCache) release(res *idempotentResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[res.key]; ok && e.Value == res && !res.done {
+		c.remove(e)
+	}
+}
+
+// expire drops the entries that expired by now. Entries are ordered by
+// when they were last set, so those are at the front.
+func (c *idempotencyCache) expire(now time.Time) {
+	for e := c.order.Front(); e != nil && !now.Before(e.Value.(*idempotentResult).expires); e = c.order.Front() {
+		c.remove(e)
+	}
+}
+
+func (c *idempotencyCache) remove(e *list.Element) {
+	delete(c.entries, e.Value.(*idempotentResult).key)
+	c.order.Remove(e)
+}
+
+// idempotentClaim is a webhook's hold on its idempotency key. Its methods
+// are no-ops on a nil claim, as for webhooks without a key.
+type idempotentClaim struct {
+	backend idempotencyBackend
+	res     *idempotentResult
+}
+
+// store caches the webhook's response.
+func (cl *idempotentClaim) store(status int, response map[string]string) {
+	if cl != nil {
+		cl.backend.store(cl.res, status, response)
+	}
+}
+
+// release frees the key if no response was stored, so a retry is handled
+// afresh. It must be called once the webhook is handled.
+func (cl *idempotentClaim) release() {
+	if cl != nil {
+		cl.backend.release(cl.res)
+	}
+}
+
+// admitIdempotent looks up the idempotency key of a webhook to topic with
+// the body of digest. A retry of a webhook already answered gets the
+// original response, with Idempotent-Replayed: true, and a key that is in
+// use or was used with a different body an error; both return ok=false.
+// Otherwise it returns the claim the handler stores its response in, nil if
+// the webhook has no key or the store failed.
+func (s *Server) admitIdempotent(w http.ResponseWriter, r *http.Request, principal, topic string, digest *signature.BodyDigest) (*idempotentClaim, bool) {
+	d := s.idempotency
+	if d == nil {
+		return nil, true
+	}
+	id := r.Header.Get(d.header)
+	if id == "" {
+		if !d.hashBodies && s.current().topics[topic].Signature == nil {
+			return nil, true
+		}
+		sum := digest.Sum()
+		id = "body:" + hex.EncodeToString(sum[:])
+	}
+
+	res, state := d.backend.claim(principal+"\x00"+topic+"\x00"+id, digest.Sum())
+	switch state {
+	case idempotentReplay:
+		s.metrics.IdempotentReplays.Add(1)
+		status := res.status
+		if d.duplicateStatus != 0 {
+			status = d.duplicateStatus
+		}
+		w.Header().Set(replayedHeader, "true")
+		s.writeJSON(w, status, res.response)
+		return nil, false
+	case idempotentPending:
+		s.metrics.IdempotencyConflicts.Add(1)
+		w.Header().Set("Retry-After", "1")
+		s.writeError(w, http.StatusConflict, "request_in_progress",
+			"a webhook with this idempotency key is still being handled, retry later")
+		return nil, false
+	case idempotentMismatch:
+		s.metrics.IdempotencyConflicts.Add(1)
+		s.writeError(w, http.StatusUnprocessableEntity, "idempotency_key_reused",
+			fmt.Sprintf("%s was already used with a different body", d.header))
+		return nil, false
+	case idempotentUnavailable:
+		return nil, true
+	}
+	return &idempotentClaim{backend: d.backend, res: res}, true
+}
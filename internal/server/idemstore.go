@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// idempotencyStoreTimeout bounds each call to an IdempotencyStore, so
+	// a slow store delays webhooks by at most this much before they are
+	// handled without a key.
+	idempotencyStoreTimeout = time.Second
+	// idempotencyPendingTTL is how long a claim on a key lasts before its
+	// webhook's response is stored. It outlasts the produce, so a replica
+	// that dies mid-request blocks retries for this long rather than for
+	// the whole window.
+	idempotencyPendingTTL = 2 * produceTimeout
+)
+
+// IdempotencyStore is a key-value store shared between replicas, such as
+// Redis, that Idempotency keeps responses in. Values expire after ttl.
+type IdempotencyStore interface {
+	// SetNX sets key unless it exists, and reports whether it did.
+	SetNX(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	// Get returns the value of key, and false if it does not exist.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// SetIfEqual sets key to value if its value is old, atomically, and
+	// reports whether it did.
+	SetIfEqual(ctx context.Context, key string, old, value []byte, ttl time.Duration) (bool, error)
+	// DelIfEqual deletes key if its value is value, atomically, and
+	// reports whether it did.
+	DelIfEqual(ctx context.Context, key string, value []byte) (bool, error)
+}
+
+// sharedIdempotency is the idempotencyBackend over an IdempotencyStore. A
+// key is claimed by setting it, with SetNX, to a pending entry holding a
+// token unique to the claim, which the response then replaces. The response
+// is stored, and a claim released, only while the key still holds its
+// pending entry, so a webhook whose claim expired does not overwrite or free
+// a key another has since claimed.
+type sharedIdempotency struct {
+	kv     IdempotencyStore
+	window time.Duration
+	logger *zap.Logger
+	errors *atomic.Int64
+}
+
+// sharedEntry is the stored form of an idempotentResult.
+type sharedEntry struct {
+	Sum      string            `json:"sum"`
+	Token    string            `json:"token,omitempty"`
+	Done     bool              `json:"done,omitempty"`
+	Status   int               `json:"status,omitempty"`
+	Response map[string]string `json:"response,omitempty"`
+}
+
+// storeKey names key in the store. Keys hold principals and header values,
+// so they are hashed into something short and safe.
+func storeKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "idempotency:" + hex.EncodeToString(sum[:])
+}
+
+func (b *sharedIdempotency) claim(key string, sum [sha256.Size]byte) (*idempotentResult, int) {
+	ctx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+	defer cancel()
+	pending, _ := json.Marshal(sharedEntry{Sum: hex.EncodeToString(sum[:]), Token: uuid.NewString()})
+	res := &idempotentResult{key: storeKey(key), sum: sum, pending: pending}
+
+	// A key that expires between SetNX and Get is claimed again, once.
+	for attempt := 0; attempt < 2; attempt++ {
+		set, err := b.kv.SetNX(ctx, res.key, pending, min(idempotencyPendingTTL, b.window))
+		if err != nil {
+			b.failed("claim", err)
+			return nil, idempotentUnavailable
+		}
+		if set {
+			return res, idempotentNew
+		}
+		value, found, err := b.kv.Get(ctx, res.key)
+		if err != nil {
+			b.failed("lookup", err)
+			return nil, idempotentUnavailable
+		}
+		if !found {
+			continue
+		}
+		var e sharedEntry
+		if err := json.Unmarshal(value, &e); err != nil {
+			b.failed("decode", err)
+			return nil, idempotentUnavailable
+		}
+		switch {
+		case e.Sum != hex.EncodeToString(sum[:]):
+			return nil, idempotentMismatch
+		case !e.Done:
+			return nil, idempotentPending
+		}
+		res.done, res.status, res.response = true, e.Status, e.Response
+		return res, idempotentReplay
+	}
+	return nil, idempotentPending
+}
+
+func (b *sharedIdempotency) store(res *idempotentResult, status int, response map[string]string) {
+	ctx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+	defer cancel()
+	res.done = true
+	value, _ := json.Marshal(sharedEntry{Sum: hex.EncodeToString(res.sum[:]), Done: true, Status: status, Response: response})
+	set, err := b.kv.SetIfEqual(ctx, res.key, res.pending, value, b.window)
+	if err != nil {
+		b.failed("store", err)
+		return
+	}
+	if !set {
+		b.logger.Warn("idempotency claim expired before the response was stored; retries are not deduplicated against it",
+			zap.Duration("claim_ttl", min(idempotencyPendingTTL, b.window)))
+	}
+}
+
+func (b *sharedIdempotency) release(res *idempotentResult) {
+	if res.done {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+	defer cancel()
+	if _, err := b.kv.DelIfEqual(ctx, res.key, res.pending); err != nil {
+		b.failed("release", err)
+	}
+}
+
+// failed logs and counts a failed call to the store.
+func (b *sharedIdempotency) failed(op string, err error) {
+	b.errors.Add(1)
+	b.logger.Warn("idempotency store request failed", zap.String("op", op), zap.Error(err))
+}
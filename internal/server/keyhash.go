@@ -0,0 +1,88 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/kahook/internal/signature"
+)
+
+// webhookKeyHeader carries the message key a sender chose.
+const webhookKeyHeader = "X-Webhook-Key"
+
+// KeyHasher replaces message keys with the hex SHA-256 of the key, or its
+// HMAC-SHA256 under a pepper, for topics whose natural key is PII such as
+// an email address. Equal keys still hash to the same partition, but record
+// keys hold no raw identifiers, and with a pepper they cannot be reversed
+// by hashing candidate values. It is safe for concurrent use.
+type KeyHasher struct {
+	mac *signature.HMAC // nil without a pepper
+}
+
+// NewKeyHasher returns a KeyHasher; an empty pepper hashes with plain
+// SHA-256.
+func NewKeyHasher(pepper []byte) *KeyHasher {
+	if len(pepper) == 0 {
+		return &KeyHasher{}
+	}
+	return &KeyHasher{mac: signature.NewSHA256(pepper)}
+}
+
+func (k *KeyHasher) hash(key []byte) []byte {
+	var sum []byte
+	if k.mac != nil {
+		sum = k.mac.Sum(make([]byte, 0, sha256.Size), key)
+	} else {
+		s := sha256.Sum256(key)
+		sum = s[:]
+	}
+	return hex.AppendEncode(nil, sum)
+}
+
+// messageKey returns the message key for a webhook to topic: X-Webhook-Key,
+// or else extracted, the key found in the payload, hashed if the topic
+// hashes keys; nil when there is neither. When it hashes the key it also
+// drops the forwarded X-Webhook-Key from headers, so the raw key does not
+// reach Kafka that way either.
+func (s *Server) messageKey(headers map[string]string, r *http.Request, topic string, extracted []byte) []byte {
+	h := s.current().topics[topic].KeyHash
+	if h != nil {
+		delete(headers, webhookKeyHeader)
+	}
+	k := []byte(r.Header.Get(webhookKeyHeader))
+	if len(k) == 0 {
+		k = extracted
+	}
+	if len(k) == 0 {
+		return nil
+	}
+	if h != nil {
+		return h.hash(k)
+	}
+	return k
+}
+
+// extractKey applies the topic's key rule to body when the sender did not
+// choose a key. A sender's X-Webhook-Key wins, so senders that can set it
+// keep control of their partitioning.
+func (s *Server) extractKey(r *http.Request, topic string, body []byte) ([]byte, *violation) {
+	opts := s.current().topics[topic]
+	if opts.Key == nil || r.Header.Get(webhookKeyHeader) != "" {
+		return nil, nil
+	}
+	if k, ok := opts.Key.Extract(r.Header, body); ok {
+		return []byte(k), nil
+	}
+	s.metrics.KeyMissing.Add(1)
+	if !opts.KeyRequired {
+		return nil, nil
+	}
+	return nil, &violation{
+		kind:    ViolationKeyMissing,
+		status:  http.StatusUnprocessableEntity,
+		code:    "key_missing",
+		message: fmt.Sprintf("payload has no message key for topic %q", topic),
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/proxyproto"
+)
+
+// Address families the listener can be restricted to.
+const (
+	// AddressFamilyDual accepts IPv4 and IPv6 on one socket (IPv4 arrives as
+	// IPv4-mapped IPv6). It is the default and matches a plain ":port" bind.
+	AddressFamilyDual = "dual"
+	AddressFamilyIPv4 = "ipv4"
+	// AddressFamilyIPv6 sets IPV6_V6ONLY, so IPv4 clients are refused even
+	// where the host would otherwise map them.
+	AddressFamilyIPv6 = "ipv6"
+)
+
+// listenNetwork maps an address family to the net.Listen network name.
+func listenNetwork(family string) (string, error) {
+	switch family {
+	case "", AddressFamilyDual:
+		return "tcp", nil
+	case AddressFamilyIPv4:
+		return "tcp4", nil
+	case AddressFamilyIPv6:
+		return "tcp6", nil
+	default:
+		return "", fmt.Errorf("invalid address family %q", family)
+	}
+}
+
+// listen opens the listener for the configured host, port, and family.
+func (s *Server) listen() (net.Listener, error) {
+	network, err := listenNetwork(s.addressFamily)
+	if err != nil {
+		return nil, err
+	}
+	ln, err := net.Listen(network, s.httpServer.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("listen %s %s: %w", network, s.httpServer.Addr, err)
+	}
+	if s.maxConnections > 0 {
+		ln = newLimitListener(ln, s.maxConnections, &s.metrics.ConnectionLimitWaits)
+	}
+	if s.proxyProtocol != nil {
+		return proxyproto.NewListener(ln, *s.proxyProtocol), nil
+	}
+	return ln, nil
+}
+
+// logListening logs the bound address and, for wildcard binds, the interface
+// addresses it can be reached on, so it is clear which families are served.
+func (s *Server) logListening(ln net.Listener) {
+	addr, ok := ln.Addr().(*net.TCPAddr)
+	if !ok {
+		s.logger.Info("listening", zap.String("addr", ln.Addr().String()))
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("addr", addr.String()),
+		zap.String("address_family", familyOrDefault(s.addressFamily)),
+		zap.Bool("proxy_protocol", s.proxyProtocol != nil),
+	}
+	if addr.IP.IsUnspecified() {
+		fields = append(fields, zap.Strings("reachable", reachableAddrs(s.addressFamily, addr.Port)))
+	}
+	s.logger.Info("listening", fields...)
+}
+
+func familyOrDefault(family string) string {
+	if family == "" {
+		return AddressFamilyDual
+	}
+	return family
+}
+
+// reachableAddrs lists host:port for every interface address a wildcard bind
+// of the given family accepts connections on.
+func reachableAddrs(family string, port int) []string {
+	ifaddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, a := range ifaddrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		is4 := ipnet.IP.To4() != nil
+		if (family == AddressFamilyIPv4 && !is4) || (family == AddressFamilyIPv6 && is4) {
+			continue
+		}
+		out = append(out, net.JoinHostPort(ipnet.IP.String(), strconv.Itoa(port)))
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package server
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// loadWindowSeconds is how far back the produce latency in the load signal
+// looks. The tracker keeps one bucket per second.
+const loadWindowSeconds = 30
+
+// LoadSignal sets the targets the load signal measures saturation against,
+// for autoscaling on something better than CPU. Each component is a
+// fraction of its target, 1 meaning at target:
+//
+//   - "queue", the fullest topic's produce queue, when produce queues are
+//     configured (its target is a full queue);
+//   - "in_flight", the webhooks being handled, over TargetInFlight;
+//   - "latency", the mean produce latency over the last 30 seconds, over
+//     TargetLatency.
+//
+// The load is the largest component, so an autoscaler targeting 1 scales
+// out on whichever is the bottleneck. A zero target leaves its component
+// out.
+type LoadSignal struct {
+	TargetInFlight int
+	TargetLatency  time.Duration
+}
+
+// LoadReport is what /admin/load returns. Load and Components are described
+// by LoadSignal; InFlight and LatencyMs are the raw measurements.
+type LoadReport struct {
+	Load       float64            `json:"load"`
+	Components map[string]float64 `json:"components"`
+	InFlight   int64              `json:"in_flight"`
+	LatencyMs  float64            `json:"latency_ms"`
+}
+
+// loadTracker counts the webhooks in flight and the latency of recent
+// produces.
+type loadTracker struct {
+	signal LoadSignal
+	now    func() time.Time
+
+	inFlight atomic.Int64
+
+	mu      sync.Mutex
+	buckets [loadWindowSeconds]latencyBucket
+}
+
+type latencyBucket struct {
+	second int64 // Unix second the sums belong to
+	count  int64
+	total  time.Duration
+}
+
+func newLoadTracker(signal LoadSignal, now func() time.Time) *loadTracker {
+	return &loadTracker{signal: signal, now: now}
+}
+
+// begin counts a webhook in flight until the returned func is called.
+func (t *loadTracker) begin() func() {
+	t.inFlight.Add(1)
+	return func() { t.inFlight.Add(-1) }
+}
+
+// observe records the latency of one produce.
+func (t *loadTracker) observe(latency time.Duration) {
+	second := t.now().Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[second%loadWindowSeconds]
+	if b.second != second {
+		*b = latencyBucket{second: second}
+	}
+	b.count++
+	b.total += latency
+}
+
+// latency returns the mean produce latency over the window, zero without
+// produces.
+func (t *loadTracker) latency() time.Duration {
+	now := t.now().Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var count int64
+	var total time.Duration
+	for _, b := range t.buckets {
+		if b.second > now-loadWindowSeconds && b.second <= now {
+			count += b.count
+			total += b.total
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / time.Duration(count)
+}
+
+func (s *Server) loadReport() LoadReport {
+	t := s.load
+	latency := t.latency()
+	report := LoadReport{
+		Components: map[string]float64{},
+		InFlight:   t.inFlight.Load(),
+		LatencyMs:  milliseconds(latency),
+	}
+	if s.dispatcher != nil {
+		_, report.Components["queue"] = s.dispatcher.saturation()
+	}
+	if t.signal.TargetInFlight > 0 {
+		report.Components["in_flight"] = float64(report.InFlight) / float64(t.signal.TargetInFlight)
+	}
+	if t.signal.TargetLatency > 0 {
+		report.Components["latency"] = float64(latency) / float64(t.signal.TargetLatency)
+	}
+	for _, v := range report.Components {
+		report.Load = max(report.Load, v)
+	}
+	return report
+}
+
+// loadHandler serves /admin/load to the callers /metrics admits, for
+// autoscalers that poll a JSON value, such as KEDA's metrics-api scaler.
+func (s *Server) loadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
+		return
+	}
+	if !s.authorizeMetrics(r) {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.loadReport())
+}
@@ -2,22 +2,212 @@ package server
 
 import (
 	"runtime"
+	"sort"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// bodySizeBuckets are the upper bounds (in bytes) of the request body size
+// histogram. They grow by 4x from 256 B up to the 1 MiB default body limit,
+// with a final +Inf bucket implied for anything larger.
+var bodySizeBuckets = []int64{256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+
 // Metrics holds atomic counters and start time for the server.
 type Metrics struct {
 	StartTime        time.Time
 	RequestsTotal    atomic.Int64
 	RequestsSuccess  atomic.Int64
-	RequestsError    atomic.Int64
+	RequestsError    atomic.Int64 // ClientErrors + ServerErrors
+	MessagesProduced atomic.Int64
+	BytesReceived    atomic.Int64
+	BytesProduced    atomic.Int64
+
+	// ClientErrors counts 4xx responses, caused by the sender (bad payloads,
+	// wrong credentials); ServerErrors counts 5xx responses, caused by
+	// kahook or the broker. Only server errors reflect availability.
+	ClientErrors atomic.Int64
+	ServerErrors atomic.Int64
+
+	// ConnectionsRecycled counts connections closed for exceeding the
+	// maximum connection age.
+	ConnectionsRecycled atomic.Int64
+
+	// ConnectionsCapped counts connections closed after serving the maximum
+	// number of requests per connection; SlowBodyRejected counts requests
+	// whose body arrived below the minimum transfer rate.
+	ConnectionsCapped atomic.Int64
+	SlowBodyRejected  atomic.Int64
+
+	// ConnectionLimitWaits counts connections that waited in the backlog
+	// because MaxConnections were open.
+	ConnectionLimitWaits atomic.Int64
+
+	// QueueRejected counts messages rejected because their topic's produce
+	// queue was full.
+	QueueRejected atomic.Int64
+
+	// NotReadyRejected counts messages rejected because the producer was
+	// still being created.
+	NotReadyRejected atomic.Int64
+
+	// CountryRejected counts webhooks rejected by a topic's country policy.
+	CountryRejected atomic.Int64
+
+	// NetworkRejected counts webhooks from addresses outside a topic's
+	// allowed networks.
+	NetworkRejected atomic.Int64
+
+	// ScopeRejected counts webhooks to topics outside their principal's
+	// scope.
+	ScopeRejected atomic.Int64
+
+	// TopicDisabledRejected counts webhooks to topics whose ingestion is
+	// disabled through the admin API.
+	TopicDisabledRejected atomic.Int64
+
+	// ScannerRejected counts requests for scanner paths. They are not
+	// included in the request counters.
+	ScannerRejected atomic.Int64
+
+	// ThrottledGlobal, ThrottledTopic, and ThrottledPrincipal count webhooks
+	// rejected by the request rate limit of each scope.
+	ThrottledGlobal    atomic.Int64
+	ThrottledTopic     atomic.Int64
+	ThrottledPrincipal atomic.Int64
+
+	// ErrorBudgetTrips counts topics throttled for exhausting their produce
+	// error budget, and ThrottledErrorBudget the webhooks rejected while
+	// their topic was throttled.
+	ErrorBudgetTrips     atomic.Int64
+	ThrottledErrorBudget atomic.Int64
+
+	// ThrottledConsumerLag counts webhooks rejected while their topic's
+	// consumers were too far behind.
+	ThrottledConsumerLag atomic.Int64
+
+	// RateLimitExempt counts webhooks that skipped rate limits because
+	// their principal, client address, or topic is exempt.
+	RateLimitExempt atomic.Int64
+
+	// BodiesDecompressed counts gzip and deflate webhook bodies
+	// decompressed.
+	BodiesDecompressed atomic.Int64
+
+	// ShedLow, ShedNormal, and ShedHigh count webhooks shed by priority
+	// admission, by class. High-priority webhooks are only shed once every
+	// in-flight slot is taken.
+	ShedLow    atomic.Int64
+	ShedNormal atomic.Int64
+	ShedHigh   atomic.Int64
+
+	// PayloadsUpcast counts payloads rewritten from an older version.
+	PayloadsUpcast atomic.Int64
+
+	// PayloadsTransformed counts payloads reshaped by a topic's transforms.
+	PayloadsTransformed atomic.Int64
+
+	// SchemaInvalid counts payloads that did not match their topic's
+	// schema, whether rejected or quarantined.
+	SchemaInvalid atomic.Int64
+
+	// KeyMissing counts payloads a topic's key rule found no key in, whether
+	// produced without a key, rejected, or quarantined.
+	KeyMissing atomic.Int64
+
+	// BatchRequests and BatchRecords count batches and the records in them;
+	// BatchRecordsFailed counts records rejected or not produced.
+	BatchRequests      atomic.Int64
+	BatchRecords       atomic.Int64
+	BatchRecordsFailed atomic.Int64
+
+	// Quarantined counts webhooks produced to the quarantine topic instead
+	// of being rejected for a soft policy violation.
+	Quarantined atomic.Int64
+
+	// ProduceRetries counts produce attempts after a first failure, and
+	// DeadLettered the messages produced to the dead letter topic.
+	ProduceRetries atomic.Int64
+	DeadLettered   atomic.Int64
+
+	// ProduceForbidden counts webhooks that failed because Kafka refused
+	// the producer write access to their topic, and ProduceTopicMissing
+	// those whose topic does not exist.
+	ProduceForbidden    atomic.Int64
+	ProduceTopicMissing atomic.Int64
+
+	// AuditRecords counts audit records produced, and AuditDropped those
+	// lost because the queue was full or the produce failed.
+	AuditRecords atomic.Int64
+	AuditDropped atomic.Int64
+
+	// ReceiptsProduced counts delivery receipts produced, and
+	// ReceiptsDropped those lost because the queue was full or the produce
+	// failed.
+	ReceiptsProduced atomic.Int64
+	ReceiptsDropped  atomic.Int64
+
+	// IdempotentReplays counts retried webhooks answered with the cached
+	// response, and IdempotencyConflicts those refused because their key
+	// was in use or reused with a different body.
+	IdempotentReplays    atomic.Int64
+	IdempotencyConflicts atomic.Int64
+	// IdempotencyStoreErrors counts failed requests to the shared
+	// idempotency store.
+	IdempotencyStoreErrors atomic.Int64
+
+	// AccessLogRecords counts access records produced, and AccessLogDropped
+	// those dropped because the queue was full or the produce failed.
+	AccessLogRecords atomic.Int64
+	AccessLogDropped atomic.Int64
+
+	// SignatureRejected counts webhooks rejected for a missing or invalid
+	// provider signature.
+	SignatureRejected atomic.Int64
+
+	bodySizes *histogram
+	slo       *sloTracker // nil unless a latency SLO is configured
+	now       func() time.Time
+
+	// listed reports whether the config names a topic; nil means none
+	// does. Listed topics are always counted on their own.
+	listed func(topic string) bool
+
+	mu       sync.RWMutex
+	topics   map[string]*topicMetrics
+	unlisted int // entries in topics that listed did not report
+}
+
+// maxUnlistedTopics bounds the topics the config does not name that are
+// counted on their own. Webhooks to further topics are counted under
+// OtherTopics, so senders cannot grow memory and /metrics without bound.
+const maxUnlistedTopics = 100
+
+// OtherTopics is the per-topic entry counting topics beyond
+// maxUnlistedTopics. It is not a valid topic name, so it cannot collide
+// with one.
+const OtherTopics = "(other)"
+
+// topicMetrics holds the per-topic byte and message counters.
+type topicMetrics struct {
+	BytesReceived    atomic.Int64
+	BytesProduced    atomic.Int64
 	MessagesProduced atomic.Int64
+
+	countries sync.Map // country code -> *atomic.Int64; only with GeoIP
 }
 
 func NewMetrics() *Metrics {
+	return newMetrics(time.Now)
+}
+
+func newMetrics(now func() time.Time) *Metrics {
 	return &Metrics{
-		StartTime: time.Now(),
+		StartTime: now(),
+		now:       now,
+		bodySizes: newHistogram(bodySizeBuckets),
+		topics:    make(map[string]*topicMetrics),
 	}
 }
 
@@ -29,34 +219,376 @@ func (m *Metrics) IncrementSuccess() {
 	m.RequestsSuccess.Add(1)
 }
 
-func (m *Metrics) IncrementError() {
+// IncrementError counts an error response with the given status, as a
+// client error for 4xx and a server error for 5xx.
+func (m *Metrics) IncrementError(status int) {
 	m.RequestsError.Add(1)
+	if status >= 500 {
+		m.ServerErrors.Add(1)
+	} else {
+		m.ClientErrors.Add(1)
+	}
 }
 
 func (m *Metrics) IncrementMessages() {
 	m.MessagesProduced.Add(1)
 }
 
+// RecordReceived accounts for a request body of size n read for topic. It is
+// called before producing, so bytes received minus bytes produced is the
+// volume rejected or lost on the way to Kafka.
+func (m *Metrics) RecordReceived(topic string, n int) {
+	m.BytesReceived.Add(int64(n))
+	m.bodySizes.observe(int64(n))
+	m.topic(topic).BytesReceived.Add(int64(n))
+}
+
+// RecordProduced accounts for a message of size n successfully delivered to
+// topic. Size is key plus value, which is what counts towards broker storage.
+func (m *Metrics) RecordProduced(topic string, n int) {
+	m.MessagesProduced.Add(1)
+	m.BytesProduced.Add(int64(n))
+	tm := m.topic(topic)
+	tm.MessagesProduced.Add(1)
+	tm.BytesProduced.Add(int64(n))
+}
+
+// RecordThrottled counts a webhook rejected by the request rate limit of
+// scope.
+func (m *Metrics) RecordThrottled(scope string) {
+	switch scope {
+	case scopeGlobal:
+		m.ThrottledGlobal.Add(1)
+	case scopeTopic:
+		m.ThrottledTopic.Add(1)
+	case scopeErrorBudget:
+		m.ThrottledErrorBudget.Add(1)
+	case scopeConsumerLag:
+		m.ThrottledConsumerLag.Add(1)
+	default:
+		m.ThrottledPrincipal.Add(1)
+	}
+}
+
+// RecordShed counts a webhook of class p shed by priority admission.
+func (m *Metrics) RecordShed(p Priority) {
+	switch p {
+	case PriorityHigh:
+		m.ShedHigh.Add(1)
+	case PriorityLow:
+		m.ShedLow.Add(1)
+	default:
+		m.ShedNormal.Add(1)
+	}
+}
+
+// RecordCountry counts a message produced to topic from a client in country,
+// or from an unresolved location when country is "".
+func (m *Metrics) RecordCountry(topic, country string) {
+	if country == "" {
+		country = unknownCountry
+	}
+	tm := m.topic(topic)
+	n, ok := tm.countries.Load(country)
+	if !ok {
+		n, _ = tm.countries.LoadOrStore(country, new(atomic.Int64))
+	}
+	n.(*atomic.Int64).Add(1)
+}
+
+// RecordProduceLatency accounts a produce attempt against the latency SLO, if
+// one is configured. Failed produces always count as bad events.
+func (m *Metrics) RecordProduceLatency(d time.Duration, ok bool) {
+	if m.slo != nil {
+		m.slo.observe(d, ok)
+	}
+}
+
+// topic returns the counters for name, creating them on first use. Once
+// maxUnlistedTopics topics the config does not name have entries, other
+// such topics share the OtherTopics entry.
+func (m *Metrics) topic(name string) *topicMetrics {
+	m.mu.RLock()
+	tm, ok := m.topics[name]
+	m.mu.RUnlock()
+	if ok {
+		return tm
+	}
+
+	listed := m.listed != nil && m.listed(name)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if tm, ok = m.topics[name]; ok {
+		return tm
+	}
+	if !listed {
+		if m.unlisted >= maxUnlistedTopics {
+			name = OtherTopics
+			if tm, ok = m.topics[name]; ok {
+				return tm
+			}
+		} else {
+			m.unlisted++
+		}
+	}
+	tm = &topicMetrics{}
+	m.topics[name] = tm
+	return tm
+}
+
+// histogram is a fixed-bucket cumulative histogram safe for concurrent use.
+type histogram struct {
+	bounds []int64
+	counts []atomic.Int64 // len(bounds)+1; the last slot is the +Inf bucket
+	count  atomic.Int64
+	sum    atomic.Int64
+}
+
+func newHistogram(bounds []int64) *histogram {
+	return &histogram{
+		bounds: bounds,
+		counts: make([]atomic.Int64, len(bounds)+1),
+	}
+}
+
+func (h *histogram) observe(v int64) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return v <= h.bounds[i] })
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(v)
+}
+
+// HistogramBucket is one cumulative bucket of a histogram snapshot.
+type HistogramBucket struct {
+	LE    string `json:"le"`
+	Count int64  `json:"count"`
+}
+
+// HistogramSnapshot is the JSON-serialisable form of a histogram.
+type HistogramSnapshot struct {
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   int64             `json:"count"`
+	Sum     int64             `json:"sum"`
+}
+
+func (h *histogram) snapshot() HistogramSnapshot {
+	buckets := make([]HistogramBucket, 0, len(h.counts))
+	var cumulative int64
+	for i := range h.counts {
+		cumulative += h.counts[i].Load()
+		le := "+Inf"
+		if i < len(h.bounds) {
+			le = strconv.FormatInt(h.bounds[i], 10)
+		}
+		buckets = append(buckets, HistogramBucket{LE: le, Count: cumulative})
+	}
+	return HistogramSnapshot{
+		Buckets: buckets,
+		Count:   h.count.Load(),
+		Sum:     h.sum.Load(),
+	}
+}
+
+// TopicMetricsResponse is the per-topic section of the /metrics snapshot.
+type TopicMetricsResponse struct {
+	BytesReceived    int64 `json:"bytes_received"`
+	BytesProduced    int64 `json:"bytes_produced"`
+	MessagesProduced int64 `json:"messages_produced"`
+
+	// Countries counts messages produced by client country when GeoIP is
+	// enabled.
+	Countries map[string]int64 `json:"countries,omitempty"`
+}
+
+// DeliverySemantics describes how messages are produced: Mode is
+// "default", "idempotent", or "transactional", and Semantics what that
+// guarantees consumers, in words.
+type DeliverySemantics struct {
+	Mode      string `json:"mode"`
+	Semantics string `json:"semantics"`
+}
+
+// SpoolStats describes the messages kept on local disk, shown as "spool"
+// in /metrics. Outage is set when webhooks are spooled during broker
+// outages.
+type SpoolStats struct {
+	Segments         int     `json:"segments"`
+	Bytes            int64   `json:"bytes"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+
+	Outage *SpoolOutageStats `json:"outage,omitempty"`
+}
+
+// SpoolOutageStats describes the webhooks spooled while the brokers were
+// down: whether they are being spooled now, how many segments await replay,
+// and how many messages were spooled and replayed since startup.
+type SpoolOutageStats struct {
+	Spooling         bool  `json:"spooling"`
+	PendingSegments  int   `json:"pending_segments"`
+	MessagesSpooled  int64 `json:"messages_spooled"`
+	MessagesReplayed int64 `json:"messages_replayed"`
+}
+
 // MetricsResponse is the JSON-serialisable snapshot returned by /metrics.
 type MetricsResponse struct {
-	Uptime           string `json:"uptime"`
-	RequestsTotal    int64  `json:"requests_total"`
-	RequestsSuccess  int64  `json:"requests_success"`
-	RequestsError    int64  `json:"requests_error"`
-	MessagesProduced int64  `json:"messages_produced"`
-	GoVersion        string `json:"go_version"`
-	Goroutines       int    `json:"goroutines"`
+	Uptime                 string                          `json:"uptime"`
+	RequestsTotal          int64                           `json:"requests_total"`
+	RequestsSuccess        int64                           `json:"requests_success"`
+	RequestsError          int64                           `json:"requests_error"`
+	ClientErrors           int64                           `json:"client_errors"`
+	ServerErrors           int64                           `json:"server_errors"`
+	MessagesProduced       int64                           `json:"messages_produced"`
+	BytesReceived          int64                           `json:"bytes_received"`
+	BytesProduced          int64                           `json:"bytes_produced"`
+	BodySizeHistogram      HistogramSnapshot               `json:"body_size_bytes"`
+	Topics                 map[string]TopicMetricsResponse `json:"topics"`
+	SLO                    *SLOSnapshot                    `json:"slo,omitempty"`
+	ConnectionsRecycled    int64                           `json:"connections_recycled"`
+	ConnectionsCapped      int64                           `json:"connections_capped"`
+	ConnectionLimitWaits   int64                           `json:"connection_limit_waits"`
+	SlowBodyRejected       int64                           `json:"slow_body_rejected"`
+	QueueRejected          int64                           `json:"queue_rejected"`
+	NotReadyRejected       int64                           `json:"not_ready_rejected"`
+	CountryRejected        int64                           `json:"country_rejected"`
+	NetworkRejected        int64                           `json:"network_rejected"`
+	ScopeRejected          int64                           `json:"scope_rejected"`
+	TopicDisabledRejected  int64                           `json:"topic_disabled_rejected"`
+	ScannerRejected        int64                           `json:"scanner_rejected"`
+	RateLimitExempt        int64                           `json:"rate_limit_exempt"`
+	BodiesDecompressed     int64                           `json:"bodies_decompressed"`
+	Throttled              map[string]int64                `json:"throttled"`
+	ErrorBudgetTrips       int64                           `json:"error_budget_trips"`
+	ThrottledTopics        []string                        `json:"throttled_topics,omitempty"`
+	ConsumerLag            map[string]map[string]int64     `json:"consumer_lag,omitempty"`
+	LaggingTopics          []string                        `json:"lagging_topics,omitempty"`
+	LoadShed               map[Priority]int64              `json:"load_shed"`
+	PayloadsUpcast         int64                           `json:"payloads_upcast"`
+	PayloadsTransformed    int64                           `json:"payloads_transformed"`
+	SchemaInvalid          int64                           `json:"schema_invalid"`
+	KeyMissing             int64                           `json:"key_missing"`
+	BatchRequests          int64                           `json:"batch_requests"`
+	BatchRecords           int64                           `json:"batch_records"`
+	BatchRecordsFailed     int64                           `json:"batch_records_failed"`
+	Quarantined            int64                           `json:"quarantined"`
+	ProduceRetries         int64                           `json:"produce_retries"`
+	DeadLettered           int64                           `json:"dead_lettered"`
+	ProduceForbidden       int64                           `json:"produce_forbidden"`
+	ProduceTopicMissing    int64                           `json:"produce_topic_missing"`
+	AuditRecords           int64                           `json:"audit_records"`
+	AuditDropped           int64                           `json:"audit_dropped"`
+	ReceiptsProduced       int64                           `json:"receipts_produced"`
+	ReceiptsDropped        int64                           `json:"receipts_dropped"`
+	IdempotentReplays      int64                           `json:"idempotent_replays"`
+	IdempotencyConflicts   int64                           `json:"idempotency_conflicts"`
+	IdempotencyStoreErrors int64                           `json:"idempotency_store_errors"`
+	AccessLogRecords       int64                           `json:"access_log_records"`
+	AccessLogDropped       int64                           `json:"access_log_dropped"`
+	SignatureRejected      int64                           `json:"signature_rejected"`
+	InFlight               *int64                          `json:"in_flight,omitempty"`
+	ProduceQueues          map[string]int                  `json:"produce_queues,omitempty"`
+	Leader                 *bool                           `json:"leader,omitempty"`
+	Delivery               *DeliverySemantics              `json:"delivery,omitempty"`
+	ClockOffsetMs          *int64                          `json:"clock_offset_ms,omitempty"`
+	ConfigDrift            *bool                           `json:"config_drift,omitempty"`
+	BrokerEvents           map[string]int64                `json:"broker_events,omitempty"`
+	Spool                  *SpoolStats                     `json:"spool,omitempty"`
+	Load                   *LoadReport                     `json:"load,omitempty"`
+	GoVersion              string                          `json:"go_version"`
+	Goroutines             int                             `json:"goroutines"`
 }
 
 // newMetricsSnapshot builds a point-in-time snapshot from the live Metrics.
 func newMetricsSnapshot(m *Metrics) MetricsResponse {
+	m.mu.RLock()
+	topics := make(map[string]TopicMetricsResponse, len(m.topics))
+	for name, tm := range m.topics {
+		resp := TopicMetricsResponse{
+			BytesReceived:    tm.BytesReceived.Load(),
+			BytesProduced:    tm.BytesProduced.Load(),
+			MessagesProduced: tm.MessagesProduced.Load(),
+		}
+		tm.countries.Range(func(k, v any) bool {
+			if resp.Countries == nil {
+				resp.Countries = make(map[string]int64)
+			}
+			resp.Countries[k.(string)] = v.(*atomic.Int64).Load()
+			return true
+		})
+		topics[name] = resp
+	}
+	m.mu.RUnlock()
+
+	var slo *SLOSnapshot
+	if m.slo != nil {
+		snap := m.slo.snapshot()
+		slo = &snap
+	}
+
+	throttled := map[string]int64{
+		scopeGlobal:      m.ThrottledGlobal.Load(),
+		scopeTopic:       m.ThrottledTopic.Load(),
+		scopePrincipal:   m.ThrottledPrincipal.Load(),
+		scopeErrorBudget: m.ThrottledErrorBudget.Load(),
+		scopeConsumerLag: m.ThrottledConsumerLag.Load(),
+	}
+	loadShed := map[Priority]int64{
+		PriorityHigh:   m.ShedHigh.Load(),
+		PriorityNormal: m.ShedNormal.Load(),
+		PriorityLow:    m.ShedLow.Load(),
+	}
+
 	return MetricsResponse{
-		Uptime:           time.Since(m.StartTime).String(),
-		RequestsTotal:    m.RequestsTotal.Load(),
-		RequestsSuccess:  m.RequestsSuccess.Load(),
-		RequestsError:    m.RequestsError.Load(),
-		MessagesProduced: m.MessagesProduced.Load(),
-		GoVersion:        runtime.Version(),
-		Goroutines:       runtime.NumGoroutine(),
+		Uptime:                 m.now().Sub(m.StartTime).String(),
+		RequestsTotal:          m.RequestsTotal.Load(),
+		RequestsSuccess:        m.RequestsSuccess.Load(),
+		RequestsError:          m.RequestsError.Load(),
+		ClientErrors:           m.ClientErrors.Load(),
+		ServerErrors:           m.ServerErrors.Load(),
+		MessagesProduced:       m.MessagesProduced.Load(),
+		BytesReceived:          m.BytesReceived.Load(),
+		BytesProduced:          m.BytesProduced.Load(),
+		BodySizeHistogram:      m.bodySizes.snapshot(),
+		Topics:                 topics,
+		SLO:                    slo,
+		ConnectionsRecycled:    m.ConnectionsRecycled.Load(),
+		ConnectionsCapped:      m.ConnectionsCapped.Load(),
+		ConnectionLimitWaits:   m.ConnectionLimitWaits.Load(),
+		SlowBodyRejected:       m.SlowBodyRejected.Load(),
+		QueueRejected:          m.QueueRejected.Load(),
+		NotReadyRejected:       m.NotReadyRejected.Load(),
+		CountryRejected:        m.CountryRejected.Load(),
+		NetworkRejected:        m.NetworkRejected.Load(),
+		ScopeRejected:          m.ScopeRejected.Load(),
+		TopicDisabledRejected:  m.TopicDisabledRejected.Load(),
+		ScannerRejected:        m.ScannerRejected.Load(),
+		RateLimitExempt:        m.RateLimitExempt.Load(),
+		BodiesDecompressed:     m.BodiesDecompressed.Load(),
+		Throttled:              throttled,
+		ErrorBudgetTrips:       m.ErrorBudgetTrips.Load(),
+		LoadShed:               loadShed,
+		PayloadsUpcast:         m.PayloadsUpcast.Load(),
+		PayloadsTransformed:    m.PayloadsTransformed.Load(),
+		SchemaInvalid:          m.SchemaInvalid.Load(),
+		KeyMissing:             m.KeyMissing.Load(),
+		BatchRequests:          m.BatchRequests.Load(),
+		BatchRecords:           m.BatchRecords.Load(),
+		BatchRecordsFailed:     m.BatchRecordsFailed.Load(),
+		Quarantined:            m.Quarantined.Load(),
+		ProduceRetries:         m.ProduceRetries.Load(),
+		DeadLettered:           m.DeadLettered.Load(),
+		ProduceForbidden:       m.ProduceForbidden.Load(),
+		ProduceTopicMissing:    m.ProduceTopicMissing.Load(),
+		AuditRecords:           m.AuditRecords.Load(),
+		AuditDropped:           m.AuditDropped.Load(),
+		ReceiptsProduced:       m.ReceiptsProduced.Load(),
+		ReceiptsDropped:        m.ReceiptsDropped.Load(),
+		IdempotentReplays:      m.IdempotentReplays.Load(),
+		IdempotencyConflicts:   m.IdempotencyConflicts.Load(),
+		IdempotencyStoreErrors: m.IdempotencyStoreErrors.Load(),
+		AccessLogRecords:       m.AccessLogRecords.Load(),
+		AccessLogDropped:       m.AccessLogDropped.Load(),
+		SignatureRejected:      m.SignatureRejected.Load(),
+		GoVersion:              runtime.Version(),
+		Goroutines:             runtime.NumGoroutine(),
 	}
 }
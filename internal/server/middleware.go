@@ -1,20 +1,51 @@
 package server
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/ids"
+	"github.com/kahook/internal/logctx"
 )
 
 const RequestIDHeader = "X-Request-ID"
 
 func RequestIDMiddleware(next http.Handler) http.Handler {
+	return requestIDMiddleware(uuid.NewString, next)
+}
+
+// requestIDKey carries the request ID through the request context.
+type requestIDKey struct{}
+
+// requestIDMiddleware keeps the client's X-Request-ID, or sets one from
+// newID, and echoes it on the response. The ID is also put in the request
+// context, with the log fields every layer handling the request adds to
+// its lines (see logctx).
+func requestIDMiddleware(newID ids.Generator, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		requestID := r.Header.Get(RequestIDHeader)
 		if requestID == "" {
-			requestID = uuid.New().String()
+			requestID = newID()
 		}
 		w.Header().Set(RequestIDHeader, requestID)
-		next.ServeHTTP(w, r)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, requestID)
+		ctx = logctx.New(ctx, zap.String("request_id", requestID))
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// requestIDFrom returns the ID of the request ctx belongs to, or "" outside
+// requestIDMiddleware.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// loggerFor returns the server's logger with the log fields of the request
+// ctx belongs to.
+func (s *Server) loggerFor(ctx context.Context) *zap.Logger {
+	return logctx.Logger(ctx, s.logger)
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ResponseFormat is how webhook responses are written.
+type ResponseFormat string
+
+// Response formats. The empty ResponseFormat is ResponseJSON.
+const (
+	// ResponseJSON writes the JSON bodies documented for each response.
+	ResponseJSON ResponseFormat = "json"
+	// ResponseText writes the same fields as "key: value" lines of
+	// text/plain.
+	ResponseText ResponseFormat = "text"
+	// ResponseNone writes no body, answering success with 204 No Content,
+	// for legacy senders that choke on any response body.
+	ResponseNone ResponseFormat = "none"
+)
+
+// formatWriter carries the response format negotiated for a webhook
+// request, and the signer of its responses when they are signed;
+// writeJSON and writeError check for it.
+type formatWriter struct {
+	http.ResponseWriter
+	format ResponseFormat
+	signer ResponseSigner
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (fw *formatWriter) Unwrap() http.ResponseWriter {
+	return fw.ResponseWriter
+}
+
+// negotiateFormat wraps w with the response format for a webhook request
+// to topic, or returns w itself for unsigned JSON.
+func (s *Server) negotiateFormat(w http.ResponseWriter, r *http.Request, topic string) http.ResponseWriter {
+	format := acceptedFormat(r.Header.Get("Accept"), s.current().topics[topic].Response)
+	if format == ResponseJSON {
+		return s.signingWriter(w)
+	}
+	return &formatWriter{ResponseWriter: w, format: format, signer: s.responseSigner}
+}
+
+// acceptedFormat picks JSON or text from an Accept header. Only media
+// ranges that name a type count: a missing Accept, wildcards, and ranges
+// naming neither format leave the topic's format, def, in place. A tie goes
+// to def when it is JSON or text, and to JSON otherwise.
+func acceptedFormat(accept string, def ResponseFormat) ResponseFormat {
+	if def == "" {
+		def = ResponseJSON
+	}
+	var qJSON, qText float64
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(part, ";")
+		q := acceptQuality(params)
+		switch strings.ToLower(strings.TrimSpace(mediaRange)) {
+		case "application/json", "application/*":
+			qJSON = max(qJSON, q)
+		case "text/plain", "text/*":
+			qText = max(qText, q)
+		}
+	}
+	switch {
+	case qJSON == 0 && qText == 0:
+		return def
+	case qJSON > qText:
+		return ResponseJSON
+	case qText > qJSON:
+		return ResponseText
+	case def == ResponseText:
+		return ResponseText
+	default:
+		return ResponseJSON
+	}
+}
+
+// acceptQuality returns the q parameter of a media range, 1 when absent or
+// malformed.
+func acceptQuality(params string) float64 {
+	for _, p := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(p), "=")
+		if !ok || strings.ToLower(strings.TrimSpace(name)) != "q" {
+			continue
+		}
+		q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || q < 0 || q > 1 {
+			return 1
+		}
+		return q
+	}
+	return 1
+}
+
+// write writes v, an ErrorResponse or a map of fields, in fw's format,
+// with the ResponseSignatureHeader of the body when fw has a signer. A
+// body that cannot be signed is written unsigned, and the error returned.
+func (fw *formatWriter) write(code int, v any) error {
+	if fw.format == ResponseNone {
+		if code >= 200 && code < 300 {
+			code = http.StatusNoContent
+		}
+		fw.WriteHeader(code)
+		return nil
+	}
+	var body bytes.Buffer
+	if fw.format == ResponseText {
+		fw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		body.WriteString(textBody(v))
+	} else {
+		fw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(&body).Encode(v)
+	}
+	var err error
+	if fw.signer != nil {
+		var sig string
+		if sig, err = fw.signer.Sign(body.Bytes()); err == nil {
+			fw.Header().Set(ResponseSignatureHeader, sig)
+		}
+	}
+	fw.WriteHeader(code)
+	_, _ = fw.Write(body.Bytes())
+	return err
+}
+
+// textBody formats v as "key: value" lines: an ErrorResponse's fields in
+// order, or a map's fields sorted by key.
+func textBody(v any) string {
+	var b strings.Builder
+	switch v := v.(type) {
+	case ErrorResponse:
+		fmt.Fprintf(&b, "error: %s\nmessage: %s\n", v.Error, v.Message)
+		for _, s := range v.Suggestions {
+			fmt.Fprintf(&b, "suggestion: %s\n", s)
+		}
+		for _, d := range v.Details {
+			fmt.Fprintf(&b, "detail: %s\n", d)
+		}
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(&b, "%s: %s\n", k, v[k])
+		}
+	default:
+		fmt.Fprintf(&b, "%v\n", v)
+	}
+	return b.String()
+}
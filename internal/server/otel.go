@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"github.com/kahook/internal/otlp"
+)
+
+// SpanExporter receives finished spans; *otlp.Exporter implements it.
+type SpanExporter interface {
+	Export(otlp.Span)
+}
+
+// requestSpan is the server span of a webhook request, recorded when
+// ServerConfig.Spans is set. producer is its child span for the produce,
+// set once the message's trace headers are.
+type requestSpan struct {
+	traceContext
+	parentID string
+	start    time.Time
+	producer traceContext
+}
+
+type requestSpanKey struct{}
+
+// requestSpanFrom returns the request's span, or nil when spans are not
+// recorded.
+func requestSpanFrom(ctx context.Context) *requestSpan {
+	span, _ := ctx.Value(requestSpanKey{}).(*requestSpan)
+	return span
+}
+
+// startSpan returns a new span continuing the trace context in h, or
+// starting a trace when h has none, and the ID of its parent span, if any.
+func startSpan(h http.Header) (traceContext, string) {
+	span := traceContext{spanID: randomHex(8), sampled: true}
+	parent, ok := parseTraceContext(h)
+	if !ok {
+		span.traceID = randomHex(16)
+		return span, ""
+	}
+	span.traceID, span.sampled = parent.traceID, parent.sampled
+	return span, parent.spanID
+}
+
+// traceRequests records a server span for each webhook request. Requests
+// continuing a sender's trace keep its sampling decision; new traces are
+// sampled at SpanSampleRatio.
+func (s *Server) traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		span := &requestSpan{start: s.now()}
+		span.traceContext, span.parentID = startSpan(r.Header)
+		if span.parentID == "" && s.spanSampleRatio > 0 && s.spanSampleRatio < 1 {
+			span.sampled = rand.Float64() < s.spanSampleRatio
+		}
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), requestSpanKey{}, span)))
+		if !span.sampled {
+			return
+		}
+
+		exported := otlp.Span{
+			TraceID:      span.traceID,
+			SpanID:       span.spanID,
+			ParentSpanID: span.parentID,
+			Name:         r.Method + " /{topic}",
+			Kind:         otlp.KindServer,
+			Start:        span.start,
+			End:          s.now(),
+			Attributes: []otlp.Attribute{
+				otlp.String("http.request.method", r.Method),
+				otlp.String("http.route", "/{topic}"),
+				otlp.String("url.path", r.URL.Path),
+				otlp.Int("http.response.status_code", wrapped.statusCode),
+				otlp.String("kahook.request_id", requestIDFrom(r.Context())),
+			},
+		}
+		if ua := r.UserAgent(); ua != "" {
+			exported.Attributes = append(exported.Attributes, otlp.String("user_agent.original", ua))
+		}
+		if wrapped.statusCode >= 500 {
+			exported.Error = http.StatusText(wrapped.statusCode)
+		}
+		s.spans.Export(exported)
+	})
+}
+
+// endProduceSpan records the producer span of a request's produce to
+// topic, which started at start and took attempts tries.
+func (s *Server) endProduceSpan(r *http.Request, topic string, start time.Time, size, attempts int, err error) {
+	span := requestSpanFrom(r.Context())
+	if span == nil || !span.sampled || span.producer.spanID == "" {
+		return
+	}
+	exported := otlp.Span{
+		TraceID:      span.traceID,
+		SpanID:       span.producer.spanID,
+		ParentSpanID: span.spanID,
+		Name:         "send " + topic,
+		Kind:         otlp.KindProducer,
+		Start:        start,
+		End:          s.now(),
+		Attributes: []otlp.Attribute{
+			otlp.String("messaging.operation.type", "send"),
+			otlp.String("messaging.destination.name", topic),
+			otlp.Int("messaging.message.body.size", size),
+			otlp.Int("kahook.produce.attempts", attempts),
+		},
+	}
+	if err != nil {
+		exported.Error = err.Error()
+	}
+	s.spans.Export(exported)
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"strings"
+)
+
+// PayloadMode controls how a route handles request bodies that are not JSON.
+type PayloadMode string
+
+const (
+	// PayloadRaw forwards the body bytes unchanged, whatever their type.
+	PayloadRaw PayloadMode = "raw"
+	// PayloadBase64 forwards JSON unchanged but wraps any other body in a JSON
+	// envelope with the bytes base64-encoded.
+	PayloadBase64 PayloadMode = "base64"
+	// PayloadJSONOnly rejects bodies that are not JSON.
+	PayloadJSONOnly PayloadMode = "json_only"
+)
+
+// Kafka headers describing how to decode the message value.
+const (
+	contentTypeHeader     = "Content-Type"
+	payloadEncodingHeader = "Kahook-Payload-Encoding"
+)
+
+// messageIDHeader carries the ID kahook assigns each message.
+const messageIDHeader = "Kahook-Message-Id"
+
+// Values of the Kahook-Payload-Encoding header.
+const (
+	encodingRaw            = "raw"
+	encodingBase64Envelope = "base64-envelope"
+)
+
+// binaryEnvelope is the JSON document produced for non-JSON bodies in
+// PayloadBase64 mode.
+type binaryEnvelope struct {
+	ContentType string `json:"content_type"`
+	Encoding    string `json:"encoding"`
+	Data        string `json:"data"`
+}
+
+// isJSON reports whether a body should be treated as JSON. A declared media
+// type decides; without one, the body itself is checked.
+func isJSON(contentType string, body []byte) bool {
+	if contentType == "" {
+		return json.Valid(body)
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// encodeBase64Envelope wraps body in a binaryEnvelope.
+func encodeBase64Envelope(contentType string, body []byte) ([]byte, error) {
+	return json.Marshal(binaryEnvelope{
+		ContentType: contentType,
+		Encoding:    "base64",
+		Data:        base64.StdEncoding.EncodeToString(body),
+	})
+}
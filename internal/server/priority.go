@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+	"net/netip"
+	"sync/atomic"
+)
+
+// Priority is a webhook's admission class. Under saturation low-priority
+// webhooks are shed first, then normal ones; high-priority webhooks are only
+// refused once every slot is taken.
+type Priority string
+
+// Priority classes. The empty Priority is PriorityNormal.
+const (
+	PriorityHigh   Priority = "high"
+	PriorityNormal Priority = "normal"
+	PriorityLow    Priority = "low"
+)
+
+// defaultPriorityHeader is the request header trusted callers set a
+// webhook's priority with when none is configured.
+const defaultPriorityHeader = "Kahook-Priority"
+
+// PriorityAdmission bounds the webhooks handled at once and sheds them by
+// priority as that bound is approached. It is disabled when MaxInFlight is
+// zero.
+type PriorityAdmission struct {
+	// MaxInFlight is the number of webhooks handled concurrently, from
+	// admission until the produce completes.
+	MaxInFlight int
+
+	// ShedLowAt and ShedNormalAt are the fractions (0-1] of MaxInFlight in
+	// use at which low- and normal-priority webhooks are answered 429.
+	ShedLowAt    float64
+	ShedNormalAt float64
+
+	// Header, sent by a trusted caller, overrides the topic's priority
+	// (default Kahook-Priority). Callers are trusted when their principal is
+	// in TrustedPrincipals or their client address in TrustedNetworks;
+	// anyone else's header is ignored.
+	Header            string
+	TrustedPrincipals []string
+	TrustedNetworks   []netip.Prefix
+}
+
+// priorityAdmitter counts webhooks in flight and admits them by priority.
+type priorityAdmitter struct {
+	header  string
+	trusted callerSet
+
+	// limits holds the in-flight count at which each class is shed.
+	lowLimit, normalLimit, highLimit int64
+	inFlight                         atomic.Int64
+}
+
+// newPriorityAdmitter returns nil when admission by priority is disabled.
+func newPriorityAdmitter(p PriorityAdmission) *priorityAdmitter {
+	if p.MaxInFlight <= 0 {
+		return nil
+	}
+	header := p.Header
+	if header == "" {
+		header = defaultPriorityHeader
+	}
+	slots := int64(p.MaxInFlight)
+	return &priorityAdmitter{
+		header:      http.CanonicalHeaderKey(header),
+		trusted:     newCallerSet(p.TrustedPrincipals, p.TrustedNetworks),
+		lowLimit:    shedLimit(slots, p.ShedLowAt),
+		normalLimit: shedLimit(slots, p.ShedNormalAt),
+		highLimit:   slots,
+	}
+}
+
+// shedLimit converts a fraction of slots into a slot count; zero or
+// out-of-range fractions shed only when every slot is taken.
+func shedLimit(slots int64, fraction float64) int64 {
+	if fraction <= 0 || fraction > 1 {
+		return slots
+	}
+	if n := int64(fraction * float64(slots)); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// priority returns the request's class: the header's for trusted callers,
+// the topic's otherwise. ok is false when a trusted caller sent an unknown
+// class.
+func (a *priorityAdmitter) priority(r *http.Request, principal string, topic Priority) (Priority, bool) {
+	if v := r.Header.Get(a.header); v != "" && a.trusted.contains(r, principal) {
+		switch p := Priority(v); p {
+		case PriorityHigh, PriorityNormal, PriorityLow:
+			return p, true
+		default:
+			return "", false
+		}
+	}
+	if topic == "" {
+		return PriorityNormal, true
+	}
+	return topic, true
+}
+
+// admit takes an in-flight slot for a webhook of class p, or reports false
+// when p is being shed. Admitted webhooks must call release.
+func (a *priorityAdmitter) admit(p Priority) bool {
+	limit := a.normalLimit
+	switch p {
+	case PriorityHigh:
+		limit = a.highLimit
+	case PriorityLow:
+		limit = a.lowLimit
+	}
+	if a.inFlight.Add(1) > limit {
+		a.inFlight.Add(-1)
+		return false
+	}
+	return true
+}
+
+func (a *priorityAdmitter) release() {
+	a.inFlight.Add(-1)
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+	"net/netip"
+)
+
+// ProbeAccess controls access to /health and /ready.
+type ProbeAccess struct {
+	// Auth requires the credentials /metrics accepts: publish credentials
+	// or a metrics token.
+	Auth bool
+	// BypassNetworks are client networks, such as the kubelet's, whose
+	// probes are let through without credentials.
+	BypassNetworks []netip.Prefix
+}
+
+// authorizeProbe reports whether r may read /health or /ready.
+func (s *Server) authorizeProbe(r *http.Request) bool {
+	if !s.probes.Auth {
+		return true
+	}
+	if s.probeBypass.contains(r, "") {
+		return true
+	}
+	return s.authorizeMetrics(r)
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prometheusContentType is the Prometheus text exposition format.
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// wantsPrometheus reports whether a /metrics request asks for the
+// Prometheus text format, with ?format=prometheus or an Accept header
+// naming it the way scrapers do. Plain Accept: text/plain, and browsers,
+// still get JSON.
+func wantsPrometheus(r *http.Request) bool {
+	switch r.URL.Query().Get("format") {
+	case "prometheus":
+		return true
+	case "json":
+		return false
+	}
+	for _, mediaRange := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, _ := strings.Cut(mediaRange, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		if mediaType == "application/openmetrics-text" {
+			return acceptQuality(params) > 0
+		}
+		if mediaType == "text/plain" && strings.Contains(strings.ReplaceAll(params, " ", ""), "version=0.0.4") {
+			return acceptQuality(params) > 0
+		}
+	}
+	return false
+}
+
+// promWriter writes metric families in the Prometheus text format.
+type promWriter struct {
+	w *bufio.Writer
+}
+
+// family writes the HELP and TYPE lines of a metric family.
+func (p promWriter) family(name, typ, help string) {
+	fmt.Fprintf(p.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one sample; labels alternate names and values.
+func (p promWriter) sample(name string, value float64, labels ...string) {
+	p.w.WriteString(name)
+	if len(labels) > 0 {
+		p.w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				p.w.WriteByte(',')
+			}
+			fmt.Fprintf(p.w, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+		}
+		p.w.WriteByte('}')
+	}
+	p.w.WriteByte(' ')
+	p.w.WriteString(formatFloat(value))
+	p.w.WriteByte('\n')
+}
+
+// single writes a family with one unlabelled sample.
+func (p promWriter) single(name, typ, help string, value float64) {
+	p.family(name, typ, help)
+	p.sample(name, value)
+}
+
+// labelEscaper escapes label values as the text format requires.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// writePrometheus writes snap, the /metrics snapshot, in the Prometheus
+// text format. Counters are named kahook_<json name>_total; per-topic and
+// per-kind maps become labels.
+func writePrometheus(out io.Writer, snap MetricsResponse, start time.Time) error {
+	bw := bufio.NewWriter(out)
+	p := promWriter{w: bw}
+
+	p.single("kahook_start_time_seconds", "gauge", "Unix time the server started.", float64(start.UnixNano())/1e9)
+	p.family("kahook_build_info", "gauge", "Always 1, labelled with the Go version.")
+	p.sample("kahook_build_info", 1, "go_version", snap.GoVersion)
+	p.single("kahook_goroutines", "gauge", "Goroutines running.", float64(snap.Goroutines))
+
+	counters := []struct {
+		name, help string
+		value      int64
+	}{
+		{"requests", "Webhook requests handled.", snap.RequestsTotal},
+		{"requests_success", "Webhook requests answered with 2xx.", snap.RequestsSuccess},
+		{"client_errors", "Requests answered with 4xx.", snap.ClientErrors},
+		{"server_errors", "Requests answered with 5xx.", snap.ServerErrors},
+		{"messages_produced", "Messages produced.", snap.MessagesProduced},
+		{"received_bytes", "Request body bytes received.", snap.BytesReceived},
+		{"produced_bytes", "Message key and value bytes produced.", snap.BytesProduced},
+		{"connections_recycled", "Connections closed for exceeding the maximum age.", snap.ConnectionsRecycled},
+		{"connections_capped", "Connections closed after the maximum requests.", snap.ConnectionsCapped},
+		{"connection_limit_waits", "Connections that waited because the maximum were open.", snap.ConnectionLimitWaits},
+		{"slow_body_rejected", "Requests rejected for a body below the minimum rate.", snap.SlowBodyRejected},
+		{"queue_rejected", "Messages rejected because a produce queue was full.", snap.QueueRejected},
+		{"not_ready_rejected", "Messages rejected while the producer was not ready.", snap.NotReadyRejected},
+		{"country_rejected", "Webhooks rejected by a country policy.", snap.CountryRejected},
+		{"network_rejected", "Webhooks rejected from addresses outside a topic's allowed networks.", snap.NetworkRejected},
+		{"scope_rejected", "Webhooks rejected for a topic outside their principal's scope.", snap.ScopeRejected},
+		{"topic_disabled_rejected", "Webhooks rejected because their topic's ingestion is disabled.", snap.TopicDisabledRejected},
+		{"scanner_rejected", "Requests for scanner paths.", snap.ScannerRejected},
+		{"rate_limit_exempt", "Webhooks exempt from rate and bandwidth limits.", snap.RateLimitExempt},
+		{"bodies_decompressed", "Gzip and deflate webhook bodies decompressed.", snap.BodiesDecompressed},
+		{"error_budget_trips", "Topics throttled for exhausting their produce error budget.", snap.ErrorBudgetTrips},
+		{"payloads_upcast", "Payloads upcast from an older version.", snap.PayloadsUpcast},
+		{"payloads_transformed", "Payloads reshaped by a topic's transforms.", snap.PayloadsTransformed},
+		{"schema_invalid", "Payloads that did not match their schema.", snap.SchemaInvalid},
+		{"key_missing", "Payloads a key rule found no key in.", snap.KeyMissing},
+		{"batch_requests", "Batch requests.", snap.BatchRequests},
+		{"batch_records", "Records in batch requests.", snap.BatchRecords},
+		{"batch_records_failed", "Batch records rejected or not produced.", snap.BatchRecordsFailed},
+		{"quarantined", "Webhooks produced to the quarantine topic.", snap.Quarantined},
+		{"produce_retries", "Produce attempts retried.", snap.ProduceRetries},
+		{"dead_lettered", "Messages written to the dead letter topic.", snap.DeadLettered},
+		{"produce_forbidden", "Webhooks not produced because Kafka denied write access to their topic.", snap.ProduceForbidden},
+		{"produce_topic_missing", "Webhooks not produced because their topic does not exist.", snap.ProduceTopicMissing},
+		{"audit_records", "Audit records produced.", snap.AuditRecords},
+		{"audit_dropped", "Audit records dropped.", snap.AuditDropped},
+		{"receipts_produced", "Delivery receipts produced.", snap.ReceiptsProduced},
+		{"receipts_dropped", "Delivery receipts dropped.", snap.ReceiptsDropped},
+		{"idempotent_replays", "Retried webhooks answered with the cached response.", snap.IdempotentReplays},
+		{"idempotency_conflicts", "Webhooks refused because their idempotency key was in use or reused.", snap.IdempotencyConflicts},
+		{"idempotency_store_errors", "Failed requests to the shared idempotency store.", snap.IdempotencyStoreErrors},
+		{"access_log_records", "Access log records produced.", snap.AccessLogRecords},
+		{"access_log_dropped", "Access log records dropped.", snap.AccessLogDropped},
+		{"signature_rejected", "Webhooks rejected for a missing or invalid signature.", snap.SignatureRejected},
+	}
+	for _, c := range counters {
+		name := "kahook_" + c.name + "_total"
+		p.single(name, "counter", c.help, float64(c.value))
+	}
+
+	p.family("kahook_throttled_total", "counter", "Webhooks rejected by request rate limits, by scope.")
+	for _, scope := range sortedKeys(snap.Throttled) {
+		p.sample("kahook_throttled_total", float64(snap.Throttled[scope]), "scope", scope)
+	}
+	p.family("kahook_load_shed_total", "counter", "Webhooks shed under load, by priority.")
+	for _, pri := range []Priority{PriorityHigh, PriorityNormal, PriorityLow} {
+		p.sample("kahook_load_shed_total", float64(snap.LoadShed[pri]), "priority", string(pri))
+	}
+
+	h := snap.BodySizeHistogram
+	p.family("kahook_body_size_bytes", "histogram", "Request body sizes.")
+	for _, b := range h.Buckets {
+		p.sample("kahook_body_size_bytes_bucket", float64(b.Count), "le", b.LE)
+	}
+	p.sample("kahook_body_size_bytes_sum", float64(h.Sum))
+	p.sample("kahook_body_size_bytes_count", float64(h.Count))
+
+	topics := sortedKeys(snap.Topics)
+	p.family("kahook_topic_received_bytes_total", "counter", "Request body bytes received, by topic.")
+	for _, t := range topics {
+		p.sample("kahook_topic_received_bytes_total", float64(snap.Topics[t].BytesReceived), "topic", t)
+	}
+	p.family("kahook_topic_produced_bytes_total", "counter", "Message bytes produced, by topic.")
+	for _, t := range topics {
+		p.sample("kahook_topic_produced_bytes_total", float64(snap.Topics[t].BytesProduced), "topic", t)
+	}
+	p.family("kahook_topic_messages_produced_total", "counter", "Messages produced, by topic.")
+	for _, t := range topics {
+		p.sample("kahook_topic_messages_produced_total", float64(snap.Topics[t].MessagesProduced), "topic", t)
+	}
+	if snap.hasCountries() {
+		p.family("kahook_topic_country_messages_total", "counter", "Messages produced, by topic and client country.")
+		for _, t := range topics {
+			countries := snap.Topics[t].Countries
+			for _, c := range sortedKeys(countries) {
+				p.sample("kahook_topic_country_messages_total", float64(countries[c]), "topic", t, "country", c)
+			}
+		}
+	}
+
+	if slo := snap.SLO; slo != nil {
+		p.single("kahook_slo_threshold_seconds", "gauge", "Produce latency SLO threshold.", slo.ThresholdMs/1000)
+		p.single("kahook_slo_target", "gauge", "Fraction of produces the SLO requires under the threshold.", slo.Target)
+		p.single("kahook_slo_compliance", "gauge", "Fraction of produces under the threshold.", slo.Compliance)
+		p.single("kahook_slo_error_budget_remaining", "gauge", "Fraction of the error budget left.", slo.ErrorBudgetRemaining)
+		p.family("kahook_slo_burn_rate", "gauge", "Error budget burn rate, by window.")
+		p.sample("kahook_slo_burn_rate", slo.BurnRate5m, "window", "5m")
+		p.sample("kahook_slo_burn_rate", slo.BurnRate1h, "window", "1h")
+	}
+	if snap.InFlight != nil {
+		p.single("kahook_in_flight", "gauge", "Webhooks being handled.", float64(*snap.InFlight))
+	}
+	if snap.ThrottledTopics != nil {
+		p.family("kahook_topic_throttled", "gauge", "1 for each topic throttled by its produce error budget.")
+		for _, t := range snap.ThrottledTopics {
+			p.sample("kahook_topic_throttled", 1, "topic", t)
+		}
+	}
+	if snap.ConsumerLag != nil {
+		p.family("kahook_consumer_lag", "gauge", "Messages a consumer group has not consumed, by topic and group.")
+		for _, t := range sortedKeys(snap.ConsumerLag) {
+			for _, g := range sortedKeys(snap.ConsumerLag[t]) {
+				p.sample("kahook_consumer_lag", float64(snap.ConsumerLag[t][g]), "topic", t, "group", g)
+			}
+		}
+		p.family("kahook_topic_lagging", "gauge", "1 for each topic pushed back on because its consumers are too far behind.")
+		for _, t := range snap.LaggingTopics {
+			p.sample("kahook_topic_lagging", 1, "topic", t)
+		}
+	}
+	if snap.ProduceQueues != nil {
+		p.family("kahook_produce_queue_depth", "gauge", "Messages waiting in each topic's produce queue.")
+		for _, t := range sortedKeys(snap.ProduceQueues) {
+			p.sample("kahook_produce_queue_depth", float64(snap.ProduceQueues[t]), "topic", t)
+		}
+	}
+	if snap.Leader != nil {
+		p.single("kahook_leader", "gauge", "1 while this replica is the leader.", boolValue(*snap.Leader))
+	}
+	if snap.Delivery != nil {
+		p.family("kahook_producer_mode", "gauge", "1 for the producer's delivery mode.")
+		p.sample("kahook_producer_mode", 1, "mode", snap.Delivery.Mode)
+	}
+	if snap.ClockOffsetMs != nil {
+		p.single("kahook_clock_offset_seconds", "gauge", "How far the reference clock is ahead of the local clock.", float64(*snap.ClockOffsetMs)/1000)
+	}
+	if snap.ConfigDrift != nil {
+		p.single("kahook_config_drift", "gauge", "1 while the running config differs from its reference.", boolValue(*snap.ConfigDrift))
+	}
+	if snap.BrokerEvents != nil {
+		p.family("kahook_broker_events_total", "counter", "Kafka connection events, by kind.")
+		for _, kind := range sortedKeys(snap.BrokerEvents) {
+			p.sample("kahook_broker_events_total", float64(snap.BrokerEvents[kind]), "kind", kind)
+		}
+	}
+	if snap.Spool != nil {
+		p.single("kahook_spool_segments", "gauge", "Segment files kept on local disk.", float64(snap.Spool.Segments))
+		p.single("kahook_spool_bytes", "gauge", "Total size of the segment files on local disk.", float64(snap.Spool.Bytes))
+		p.single("kahook_spool_oldest_age_seconds", "gauge", "Time since the oldest segment file was last written.", snap.Spool.OldestAgeSeconds)
+		if o := snap.Spool.Outage; o != nil {
+			spooling := 0.0
+			if o.Spooling {
+				spooling = 1
+			}
+			p.single("kahook_spool_spooling", "gauge", "1 while webhooks are spooled because the brokers are down.", spooling)
+			p.single("kahook_spool_pending_segments", "gauge", "Outage segment files waiting to be replayed.", float64(o.PendingSegments))
+			p.single("kahook_spool_messages_spooled_total", "counter", "Webhooks spooled while the brokers were down.", float64(o.MessagesSpooled))
+			p.single("kahook_spool_messages_replayed_total", "counter", "Spooled webhooks produced once the brokers were back.", float64(o.MessagesReplayed))
+		}
+	}
+	if l := snap.Load; l != nil {
+		p.single("kahook_load", "gauge", "Saturation to autoscale on; 1 is at target.", l.Load)
+		p.family("kahook_load_component", "gauge", "Saturation by component: queue, in_flight, and latency.")
+		for _, c := range sortedKeys(l.Components) {
+			p.sample("kahook_load_component", l.Components[c], "component", c)
+		}
+		p.single("kahook_webhooks_in_flight", "gauge", "Webhooks being handled, for the load signal.", float64(l.InFlight))
+		p.single("kahook_produce_latency_mean_seconds", "gauge", "Mean produce latency over the last 30 seconds.", l.LatencyMs/1000)
+	}
+	return bw.Flush()
+}
+
+// hasCountries reports whether any topic counts messages by country.
+func (m MetricsResponse) hasCountries() bool {
+	for _, t := range m.Topics {
+		if len(t.Countries) > 0 {
+			return true
+		}
+	}
+	return false
+}
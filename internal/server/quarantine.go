@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Soft policy violations. A webhook that breaks one is rejected, or, when
+// the violation is quarantined, produced to the quarantine topic instead.
+const (
+	// ViolationHeaderSize is a request whose headers exceed MaxHeaderBytes.
+	ViolationHeaderSize = "header_size"
+	// ViolationNotJSON is a non-JSON body sent to a json_only topic.
+	ViolationNotJSON = "not_json"
+	// ViolationInvalidJSON is a body declared or required to be JSON that
+	// does not parse.
+	ViolationInvalidJSON = "invalid_json"
+	// ViolationUpcast is a payload that must be upcast but cannot be.
+	ViolationUpcast = "upcast_failed"
+	// ViolationSchema is a payload that does not match its topic's schema.
+	ViolationSchema = "schema_invalid"
+	// ViolationKeyMissing is a payload a topic that requires a key finds
+	// none in.
+	ViolationKeyMissing = "key_missing"
+	// ViolationTransform is a payload a topic's transforms cannot apply to.
+	ViolationTransform = "transform_failed"
+)
+
+// Message headers on quarantined webhooks.
+const (
+	violationHeader       = "Kahook-Violation"
+	violationDetailHeader = "Kahook-Violation-Detail"
+	originalTopicHeader   = "Kahook-Original-Topic"
+)
+
+// Quarantine produces webhooks that break soft policies to Topic, with the
+// violation and the topic they were sent to as message headers, instead of
+// rejecting them, so nothing is lost while a sender's issues are
+// investigated. Violations lists the Violation* kinds quarantined; empty
+// means every kind. An empty Topic disables quarantine.
+type Quarantine struct {
+	Topic      string
+	Violations []string
+}
+
+func (q Quarantine) covers(kind string) bool {
+	return q.Topic != "" && (len(q.Violations) == 0 || slices.Contains(q.Violations, kind))
+}
+
+// violation is a soft policy a webhook broke, with the error it is rejected
+// with when not quarantined. Details, when set, are listed in the error
+// response.
+type violation struct {
+	kind    string
+	status  int
+	code    string
+	message string
+	details []string
+}
+
+// headerViolation checks the request's header size against MaxHeaderBytes.
+func (s *Server) headerViolation(r *http.Request) *violation {
+	if s.maxHeaderBytes <= 0 {
+		return nil
+	}
+	if n := headerSize(r.Header); n > s.maxHeaderBytes {
+		return &violation{
+			kind:    ViolationHeaderSize,
+			status:  http.StatusRequestHeaderFieldsTooLarge,
+			code:    "headers_too_large",
+			message: fmt.Sprintf("request headers are %d bytes, more than the limit of %d", n, s.maxHeaderBytes),
+		}
+	}
+	return nil
+}
+
+// headerSize approximates the bytes h takes on the wire: each line is
+// "Name: value\r\n".
+func headerSize(h http.Header) int {
+	n := 0
+	for name, values := range h {
+		for _, v := range values {
+			n += len(name) + len(v) + 4
+		}
+	}
+	return n
+}
+
+// contentViolation checks body against the topic's payload mode and, with
+// StrictContentType, the JSON its Content-Type declares.
+func (s *Server) contentViolation(topic, contentType string, body []byte) *violation {
+	bodyIsJSON := isJSON(contentType, body)
+	jsonOnly := s.current().topics[topic].Payload == PayloadJSONOnly
+	if jsonOnly && !bodyIsJSON {
+		return &violation{
+			kind:    ViolationNotJSON,
+			status:  http.StatusUnsupportedMediaType,
+			code:    "unsupported_media_type",
+			message: fmt.Sprintf("topic %q only accepts JSON payloads", topic),
+		}
+	}
+	if (jsonOnly || s.strictContentType && bodyIsJSON) && !json.Valid(body) {
+		return &violation{
+			kind:    ViolationInvalidJSON,
+			status:  http.StatusBadRequest,
+			code:    "invalid_json",
+			message: "request body is not valid JSON",
+		}
+	}
+	return nil
+}
+
+// rejectOrQuarantine answers a webhook that broke a soft policy: it is
+// produced to the quarantine topic when its violation is quarantined, and
+// rejected with the violation's error otherwise.
+func (s *Server) rejectOrQuarantine(w http.ResponseWriter, r *http.Request, principal, topic, contentType string, body []byte, v *violation) {
+	if !s.quarantine.covers(v.kind) {
+		if len(v.details) == 0 || s.terseErrors {
+			s.writeError(w, v.status, v.code, v.message)
+			return
+		}
+		s.writeJSON(w, v.status, ErrorResponse{Error: v.code, Message: v.message, Details: v.details})
+		return
+	}
+
+	headers := forwardedHeaders.messageHeaders(r.Header)
+	defer putHeaderMap(headers)
+	s.setRouteHeaders(headers, strings.Trim(r.URL.Path, "/"))
+	if contentType != "" {
+		headers[contentTypeHeader] = contentType
+	}
+	headers[payloadEncodingHeader] = encodingRaw
+	messageID := s.newID()
+	headers[messageIDHeader] = messageID
+	headers[violationHeader] = v.kind
+	headers[violationDetailHeader] = strings.Join(append([]string{v.message}, v.details...), "; ")
+	headers[originalTopicHeader] = topic
+	span := s.setTraceHeaders(headers, r)
+
+	key := s.messageKey(headers, r, topic, nil)
+
+	requestID := requestIDFrom(r.Context())
+	audit := s.audit.begin(requestID, principal, topic, messageID, key, len(body))
+	ctx, cancel := context.WithTimeout(r.Context(), produceTimeout)
+	defer cancel()
+	produceStart := s.now()
+	err := s.produce(ctx, s.quarantine.Topic, key, body, headers)
+	s.endProduceSpan(r, s.quarantine.Topic, produceStart, len(body), 1, err)
+	if unavailable(err) {
+		s.audit.end(audit, auditNotReady, 1, err)
+		s.writeNotReady(w)
+		return
+	}
+	if err != nil {
+		s.audit.end(audit, auditFailed, 1, err)
+		s.loggerFor(r.Context()).Error("failed to produce quarantined message",
+			zap.String("quarantine_topic", s.quarantine.Topic),
+			zap.Error(err),
+		)
+		s.writeError(w, http.StatusInternalServerError, "produce_error", "failed to send message to kafka")
+		return
+	}
+	s.audit.end(audit, auditQuarantined, 1, nil)
+
+	s.metrics.Quarantined.Add(1)
+	s.loggerFor(r.Context()).Warn("webhook quarantined", append([]zap.Field{
+		zap.String("violation", v.kind),
+		zap.String("detail", v.message),
+	}, traceFields(span)...)...)
+	s.writeJSON(w, http.StatusAccepted, map[string]string{
+		"status":     "quarantined",
+		"topic":      topic,
+		"violation":  v.kind,
+		"request_id": requestID,
+		"message_id": messageID,
+	})
+}
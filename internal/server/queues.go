@@ -0,0 +1,84 @@
+package server
+
+import "net/http"
+
+// QueueReport is what /admin/queues returns: the state of every queue a
+// webhook or its records can wait in, for deciding whether to scale out.
+// Sections for features that are off are omitted.
+type QueueReport struct {
+	// ProduceQueues is the state of each active topic's produce queue.
+	ProduceQueues map[string]ProduceQueueStats `json:"produce_queues,omitempty"`
+	// Workers sums the produce queues' workers.
+	Workers *WorkerStats `json:"workers,omitempty"`
+	// Retrying is the number of messages waiting to retry a failed
+	// produce (see DeadLetter).
+	Retrying int64 `json:"retrying"`
+	// Spool is the backlog kept on local disk.
+	Spool *SpoolStats `json:"spool,omitempty"`
+	// Records is the backlog of each background record producer: "audit",
+	// "receipts", and "access_log".
+	Records map[string]BacklogStats `json:"records,omitempty"`
+}
+
+// WorkerStats is the number of produce workers, how many are producing,
+// and the fraction that is.
+type WorkerStats struct {
+	Total       int     `json:"total"`
+	Busy        int     `json:"busy"`
+	Utilization float64 `json:"utilization"`
+}
+
+// BacklogStats is the number of records queued for producing and the most
+// that fit.
+type BacklogStats struct {
+	Queued   int `json:"queued"`
+	Capacity int `json:"capacity"`
+}
+
+func (s *Server) queueReport() QueueReport {
+	report := QueueReport{Retrying: s.retrying.Load()}
+	if s.dispatcher != nil {
+		report.ProduceQueues = s.dispatcher.stats()
+		workers := WorkerStats{}
+		for _, q := range report.ProduceQueues {
+			workers.Total += q.Workers
+			workers.Busy += q.BusyWorkers
+		}
+		if workers.Total > 0 {
+			workers.Utilization = float64(workers.Busy) / float64(workers.Total)
+		}
+		report.Workers = &workers
+	}
+	if s.spool != nil {
+		if st, ok := s.spool(); ok {
+			report.Spool = &st
+		}
+	}
+	records := map[string]BacklogStats{}
+	if s.audit != nil {
+		records["audit"] = BacklogStats{Queued: len(s.audit.records), Capacity: cap(s.audit.records)}
+	}
+	if s.receipts != nil {
+		records["receipts"] = BacklogStats{Queued: len(s.receipts.receipts), Capacity: cap(s.receipts.receipts)}
+	}
+	if s.accessLog != nil {
+		records["access_log"] = BacklogStats{Queued: len(s.accessLog.records), Capacity: cap(s.accessLog.records)}
+	}
+	if len(records) > 0 {
+		report.Records = records
+	}
+	return report
+}
+
+// queuesHandler serves /admin/queues to the callers /metrics admits.
+func (s *Server) queuesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
+		return
+	}
+	if !s.authorizeMetrics(r) {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.queueReport())
+}
@@ -0,0 +1,130 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// errorWindowSeconds is the window the produce error rate is measured over,
+// kept as one bucket per second.
+const errorWindowSeconds = 60
+
+// defaultOverloadMinRequests is the number of produce attempts the error
+// window must hold before its error rate is trusted.
+const defaultOverloadMinRequests = 20
+
+// OverloadThresholds make /ready fail while the instance is overloaded, so
+// it is taken out of rotation before requests start timing out. A zero
+// threshold is not checked.
+type OverloadThresholds struct {
+	// QueueSaturation is the fraction (0-1] of any topic's produce queue in
+	// use at which the instance counts as overloaded.
+	QueueSaturation float64
+
+	// ErrorRate is the fraction (0-1] of produce attempts over the last
+	// minute that may fail, counting queue-full rejections. It only applies
+	// once MinRequests attempts have been seen (default 20).
+	ErrorRate   float64
+	MinRequests int64
+
+	// SustainFor is how long a threshold must stay exceeded before /ready
+	// fails, so a momentary spike does not pull the instance. Conditions are
+	// evaluated on each /ready call.
+	SustainFor time.Duration
+}
+
+func (t OverloadThresholds) enabled() bool {
+	return t.QueueSaturation > 0 || t.ErrorRate > 0
+}
+
+// overloadDetector evaluates OverloadThresholds against the produce queues
+// and a rolling window of produce outcomes.
+type overloadDetector struct {
+	thresholds OverloadThresholds
+	dispatcher *produceDispatcher // nil without produce queues
+	now        func() time.Time
+
+	mu      sync.Mutex
+	buckets [errorWindowSeconds]outcomeBucket
+	since   time.Time // when the current overload began; zero if none
+}
+
+type outcomeBucket struct {
+	second        int64 // Unix second the counts belong to
+	total, failed int64
+}
+
+func newOverloadDetector(t OverloadThresholds, d *produceDispatcher, now func() time.Time) *overloadDetector {
+	if t.MinRequests <= 0 {
+		t.MinRequests = defaultOverloadMinRequests
+	}
+	return &overloadDetector{thresholds: t, dispatcher: d, now: now}
+}
+
+// observe records the outcome of one produce attempt.
+func (o *overloadDetector) observe(ok bool) {
+	second := o.now().Unix()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	b := &o.buckets[second%errorWindowSeconds]
+	if b.second != second {
+		*b = outcomeBucket{second: second}
+	}
+	b.total++
+	if !ok {
+		b.failed++
+	}
+}
+
+// check reports whether the instance has been over a threshold for at least
+// SustainFor, and which threshold.
+func (o *overloadDetector) check() (reason string, overloaded bool) {
+	now := o.now()
+	reason = o.exceeded(now)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if reason == "" {
+		o.since = time.Time{}
+		return "", false
+	}
+	if o.since.IsZero() {
+		o.since = now
+	}
+	return reason, now.Sub(o.since) >= o.thresholds.SustainFor
+}
+
+// exceeded describes the first threshold currently exceeded, or returns "".
+func (o *overloadDetector) exceeded(now time.Time) string {
+	if limit := o.thresholds.QueueSaturation; limit > 0 && o.dispatcher != nil {
+		if topic, used := o.dispatcher.saturation(); used >= limit {
+			return fmt.Sprintf("produce queue for topic %q is %.0f%% full", topic, used*100)
+		}
+	}
+	if limit := o.thresholds.ErrorRate; limit > 0 {
+		total, failed := o.window(now.Unix())
+		if total >= o.thresholds.MinRequests {
+			if rate := float64(failed) / float64(total); rate >= limit {
+				return fmt.Sprintf("%.0f%% of produces failed in the last minute", rate*100)
+			}
+		}
+	}
+	return ""
+}
+
+// window sums the outcome buckets of the last errorWindowSeconds.
+func (o *overloadDetector) window(now int64) (total, failed int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, b := range o.buckets {
+		if b.second > now-errorWindowSeconds && b.second <= now {
+			total += b.total
+			failed += b.failed
+		}
+	}
+	return total, failed
+}
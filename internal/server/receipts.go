@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/delivery"
+)
+
+// defaultReceiptsBuffer is the number of receipts queued for producing
+// when Receipts.Buffer is zero.
+const defaultReceiptsBuffer = 4096
+
+// Receipts produces a Receipt to Topic for every webhook message delivered,
+// so senders that consume the topic can reconcile their requests against
+// what was written. Receipts are produced in the background, keyed by
+// request ID; up to Buffer (default 4096) are queued, and receipts that do
+// not fit are dropped and counted. An empty Topic disables them.
+type Receipts struct {
+	Topic  string
+	Buffer int
+}
+
+// Receipt records where a message was written. Partition and Offset are
+// omitted for backends that do not report them. Timestamp is the message
+// timestamp the broker stored, or when the delivery was acknowledged if it
+// reported none.
+type Receipt struct {
+	RequestID string    `json:"request_id,omitempty"`
+	MessageID string    `json:"message_id"`
+	Topic     string    `json:"topic"`
+	Partition *int32    `json:"partition,omitempty"`
+	Offset    *int64    `json:"offset,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// receipts queues receipts and produces them from one goroutine.
+type receipts struct {
+	topic    string
+	producer KafkaProducer
+	logger   *zap.Logger
+	metrics  *Metrics
+	now      func() time.Time
+
+	mu       sync.RWMutex
+	closed   bool
+	receipts chan Receipt
+	done     chan struct{}
+}
+
+// newReceipts returns nil when receipts are disabled.
+func newReceipts(cfg Receipts, producer KafkaProducer, logger *zap.Logger, metrics *Metrics, now func() time.Time) *receipts {
+	if cfg.Topic == "" {
+		return nil
+	}
+	buffer := cfg.Buffer
+	if buffer <= 0 {
+		buffer = defaultReceiptsBuffer
+	}
+	rc := &receipts{
+		topic:    cfg.Topic,
+		producer: producer,
+		logger:   logger,
+		metrics:  metrics,
+		now:      now,
+		receipts: make(chan Receipt, buffer),
+		done:     make(chan struct{}),
+	}
+	go rc.run()
+	return rc
+}
+
+// recorder returns ctx with a delivery.Recorder for the producer to report
+// the message's partition and offset in. A nil receipts returns ctx as is.
+func (rc *receipts) recorder(ctx context.Context) (context.Context, *delivery.Recorder) {
+	if rc == nil {
+		return ctx, nil
+	}
+	rec := &delivery.Recorder{}
+	return delivery.WithRecorder(ctx, rec), rec
+}
+
+// issue queues the receipt of a delivered message. It is a no-op on a nil
+// receipts.
+func (rc *receipts) issue(requestID string, m message, rec *delivery.Recorder) {
+	if rc == nil {
+		return
+	}
+	receipt := Receipt{
+		RequestID: requestID,
+		MessageID: m.id,
+		Topic:     m.topic,
+		Timestamp: rc.now().UTC(),
+	}
+	if report, ok := rec.Report(); ok {
+		receipt.Partition = &report.Partition
+		receipt.Offset = &report.Offset
+		if !report.Timestamp.IsZero() {
+			receipt.Timestamp = report.Timestamp.UTC()
+		}
+	}
+
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	if rc.closed {
+		rc.metrics.ReceiptsDropped.Add(1)
+		return
+	}
+	select {
+	case rc.receipts <- receipt:
+	default:
+		rc.metrics.ReceiptsDropped.Add(1)
+	}
+}
+
+func (rc *receipts) run() {
+	defer close(rc.done)
+	headers := map[string]string{contentTypeHeader: "application/json"}
+	for receipt := range rc.receipts {
+		value, err := json.Marshal(receipt)
+		if err != nil {
+			rc.logger.Error("failed to encode receipt", zap.Error(err))
+			continue
+		}
+		key := receipt.RequestID
+		if key == "" {
+			key = receipt.MessageID
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), produceTimeout)
+		err = rc.producer.Produce(ctx, rc.topic, []byte(key), value, headers)
+		cancel()
+		if err != nil {
+			rc.metrics.ReceiptsDropped.Add(1)
+			rc.logger.Warn("failed to produce receipt",
+				zap.String("topic", rc.topic),
+				zap.String("message_id", receipt.MessageID),
+				zap.Error(err),
+			)
+			continue
+		}
+		rc.metrics.ReceiptsProduced.Add(1)
+	}
+}
+
+// close stops accepting receipts and waits until those queued are produced
+// or ctx ends.
+func (rc *receipts) close(ctx context.Context) {
+	rc.mu.Lock()
+	if !rc.closed {
+		rc.closed = true
+		close(rc.receipts)
+	}
+	rc.mu.Unlock()
+
+	select {
+	case <-rc.done:
+	case <-ctx.Done():
+		rc.logger.Warn("receipts not produced before shutdown", zap.Int("queued", len(rc.receipts)))
+	}
+}
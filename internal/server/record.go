@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/fixture"
+	"github.com/kahook/internal/redact"
+)
+
+// unrecordedHeaders carry credentials or client identity and are left out
+// of fixtures.
+var unrecordedHeaders = newHeaderFilter(map[string]bool{
+	"authorization":       true,
+	"proxy-authorization": true,
+	"cookie":              true,
+	"x-api-key":           true,
+	"x-forwarded-for":     true,
+	"x-real-ip":           true,
+	"forwarded":           true,
+})
+
+// fixtureRecorder writes webhook requests to fixture files.
+type fixtureRecorder struct {
+	dir      string
+	secrets  *strings.Replacer // nil when there is nothing to mask
+	maxBytes int64             // larger bodies are not recorded
+	seq      atomic.Int64
+	logger   *zap.Logger
+	now      func() time.Time
+}
+
+func newFixtureRecorder(dir string, secrets []string, maxBytes int64, logger *zap.Logger, now func() time.Time) *fixtureRecorder {
+	return &fixtureRecorder{dir: dir, secrets: redact.NewReplacer(secrets), maxBytes: maxBytes, logger: logger, now: now}
+}
+
+func (fr *fixtureRecorder) sanitize(s string) string {
+	if fr.secrets == nil {
+		return s
+	}
+	return fr.secrets.Replace(s)
+}
+
+// middleware records each webhook with its response status once it has been
+// handled. Bodies over the server's body limit are not recorded; the
+// handler rejects them unless their topic allows more.
+func (fr *fixtureRecorder) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, fr.maxBytes+1))
+		tooLarge := int64(len(body)) > fr.maxBytes
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		if err != nil || tooLarge {
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.ContentLength = int64(len(body))
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(wrapped, r)
+		fr.record(r, body, wrapped.statusCode)
+	})
+}
+
+func (fr *fixtureRecorder) record(r *http.Request, body []byte, status int) {
+	f := &fixture.Fixture{
+		RecordedAt: fr.now().UTC(),
+		Method:     r.Method,
+		Path:       r.URL.Path,
+		Headers:    make(http.Header, len(r.Header)),
+		Status:     status,
+	}
+	for k, v := range r.Header {
+		if !unrecordedHeaders.forward(k) {
+			continue
+		}
+		values := make([]string, len(v))
+		for i, s := range v {
+			values[i] = fr.sanitize(s)
+		}
+		f.Headers[k] = values
+	}
+	f.SetBody([]byte(fr.sanitize(string(body))))
+
+	name := fmt.Sprintf("%s-%06d-%s.json",
+		f.RecordedAt.Format("20060102T150405.000000000Z"),
+		fr.seq.Add(1),
+		fixtureName(r.URL.Path),
+	)
+	if err := fixture.Write(filepath.Join(fr.dir, name), f); err != nil {
+		fr.logger.Warn("failed to record fixture", zap.String("path", r.URL.Path), zap.Error(err))
+	}
+}
+
+// fixtureName derives a file name component from a request path, keeping
+// only characters that are safe in file names.
+func fixtureName(path string) string {
+	name := strings.Map(func(c rune) rune {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+			return c
+		}
+		return '_'
+	}, strings.Trim(path, "/"))
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return "root"
+	}
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/ratelimit"
+)
+
+// Reloadable is the part of a Server's configuration that Reload replaces
+// while it serves: credentials, the topics and routes it accepts with their
+// options (signature secrets included), and request rate and bandwidth
+// limits. Its fields mean what the ServerConfig fields of the same names
+// do.
+type Reloadable struct {
+	Auth          *auth.MultiAuth
+	AllowedTopics []string
+
+	RequestRate        RequestRates
+	TopicBandwidth     *ratelimit.Limiter
+	PrincipalBandwidth *ratelimit.Limiter
+
+	Topics        map[string]TopicOptions
+	RoutePaths    map[string]string
+	RouteHeaders  map[string]map[string]string
+	AliasedTopics []string
+}
+
+// routing is a Reloadable in lookup form. A Server swaps it whole, so
+// handlers read it without locks; a request that spans a reload may see the
+// old settings in one step and the new ones in the next.
+type routing struct {
+	reloadable Reloadable
+
+	auth          *auth.MultiAuth
+	credentials   *credentialUsage
+	allowedTopics map[string]bool
+
+	requestRate        RequestRates
+	topicBandwidth     *ratelimit.Limiter
+	principalBandwidth *ratelimit.Limiter
+
+	topics        map[string]TopicOptions
+	routePaths    map[string]string
+	routeHeaders  map[string]map[string]string
+	aliasedTopics map[string]bool
+
+	scannerPaths scannerPaths
+}
+
+func (s *Server) newRouting(r Reloadable, credentials *credentialUsage) *routing {
+	rt := &routing{
+		reloadable:         r,
+		auth:               r.Auth,
+		credentials:        credentials,
+		allowedTopics:      make(map[string]bool, len(r.AllowedTopics)),
+		requestRate:        r.RequestRate,
+		topicBandwidth:     r.TopicBandwidth,
+		principalBandwidth: r.PrincipalBandwidth,
+		topics:             r.Topics,
+		routePaths:         r.RoutePaths,
+		routeHeaders:       r.RouteHeaders,
+		aliasedTopics:      make(map[string]bool, len(r.AliasedTopics)),
+	}
+	for _, t := range r.AllowedTopics {
+		rt.allowedTopics[t] = true
+	}
+	for _, t := range r.AliasedTopics {
+		rt.aliasedTopics[t] = true
+	}
+	rt.scannerPaths = newScannerPaths(s.scannerList, func(path string) bool {
+		_, route := rt.routePaths[path]
+		_, topic := rt.topics[path]
+		return rt.allowedTopics[path] || route || topic
+	})
+	return rt
+}
+
+// listsTopic reports whether the config names topic: as allowed, with
+// per-topic options, as an alias, or as the target of a route.
+func (rt *routing) listsTopic(topic string) bool {
+	if _, ok := rt.topics[topic]; ok || rt.allowedTopics[topic] || rt.aliasedTopics[topic] {
+		return true
+	}
+	for _, target := range rt.routePaths {
+		if target == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// current returns the routing requests are served with.
+func (s *Server) current() *routing {
+	return s.routing.Load()
+}
+
+// Reload replaces the server's credentials, topics and routes, and rate
+// limits without dropping connections. Requests in flight finish with the
+// settings they started with, or with the new ones for steps they have yet
+// to take. Credentials kept across the reload keep their usage counts.
+func (s *Server) Reload(r Reloadable) {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	old := s.current()
+	var publish []auth.Credential
+	if r.Auth != nil {
+		publish = r.Auth.Credentials()
+	}
+	s.routing.Store(s.newRouting(r, old.credentials.withPublish(publish)))
+	s.logReloaded()
+}
@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/kahook/internal/redact"
+)
+
+// Request log formats.
+const (
+	// RequestLogJSON logs each request through the server's logger, as the
+	// rest of its logs.
+	RequestLogJSON = "json"
+	// RequestLogConsole logs each request as a tab-separated line with the
+	// same fields, for reading in a terminal.
+	RequestLogConsole = "console"
+	// RequestLogCommon logs each request as an Apache Common Log Format
+	// line, for tools that parse web server logs.
+	RequestLogCommon = "common"
+)
+
+// clfTime is the timestamp layout of the Common Log Format.
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+// redactedHeaders carry credentials and are never logged.
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+}
+
+// RequestLog configures the line logged for each request. Format is
+// RequestLogJSON (default), RequestLogConsole, or RequestLogCommon, the
+// last two written to Output (default stdout). Query, UserAgent, and
+// Principal add the query string, the User-Agent header, and the
+// authenticated principal, and Headers adds those request headers, with
+// credentials redacted; Common Log Format lines have fixed fields and
+// always carry the principal. SampleRatio is the fraction of successful
+// requests logged, zero meaning all of them; responses of 400 and above
+// are always logged.
+type RequestLog struct {
+	Format      string
+	Query       bool
+	UserAgent   bool
+	Principal   bool
+	Headers     []string
+	SampleRatio float64
+	Output      io.Writer
+}
+
+// requestLogger writes the request log.
+type requestLogger struct {
+	cfg     RequestLog
+	headers []string // canonical names
+	logger  *zap.Logger
+
+	mu  sync.Mutex // serialises Common Log Format lines
+	out io.Writer
+}
+
+func newRequestLogger(cfg RequestLog, logger *zap.Logger) *requestLogger {
+	l := &requestLogger{cfg: cfg, logger: logger, out: cfg.Output}
+	if l.out == nil {
+		l.out = os.Stdout
+	}
+	for _, h := range cfg.Headers {
+		l.headers = append(l.headers, http.CanonicalHeaderKey(h))
+	}
+	if cfg.Format == RequestLogConsole {
+		enc := zap.NewProductionEncoderConfig()
+		enc.EncodeTime = zapcore.ISO8601TimeEncoder
+		enc.EncodeLevel = zapcore.CapitalLevelEncoder
+		l.logger = zap.New(zapcore.NewCore(zapcore.NewConsoleEncoder(enc), zapcore.AddSync(l.out), zap.InfoLevel))
+	}
+	return l
+}
+
+// wantsPrincipal reports whether requests must record who sent them.
+func (l *requestLogger) wantsPrincipal() bool {
+	return l.cfg.Principal || l.cfg.Format == RequestLogCommon
+}
+
+// sampled reports whether a request answered with status is logged.
+func (l *requestLogger) sampled(status int) bool {
+	return status >= 400 || l.cfg.SampleRatio <= 0 || l.cfg.SampleRatio >= 1 || rand.Float64() < l.cfg.SampleRatio
+}
+
+func (l *requestLogger) log(r *http.Request, rw *responseWriter, requestID, principal string, start time.Time, elapsed time.Duration) {
+	if !l.sampled(rw.statusCode) {
+		return
+	}
+	if l.cfg.Format == RequestLogCommon {
+		l.logCommon(r, rw, principal, start)
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.Int("status", rw.statusCode),
+		zap.Duration("duration", elapsed),
+		zap.String("remote_addr", r.RemoteAddr),
+		zap.String("request_id", requestID),
+	}
+	if l.cfg.Query && r.URL.RawQuery != "" {
+		fields = append(fields, zap.String("query", r.URL.RawQuery))
+	}
+	if l.cfg.UserAgent {
+		fields = append(fields, zap.String("user_agent", r.UserAgent()))
+	}
+	if l.cfg.Principal && principal != "" {
+		fields = append(fields, zap.String("principal", principal))
+	}
+	for _, h := range l.headers {
+		v := r.Header.Get(h)
+		if v == "" {
+			continue
+		}
+		if redactedHeaders[h] {
+			v = redact.Mask(v)
+		}
+		fields = append(fields, zap.String("header."+strings.ToLower(h), v))
+	}
+
+	// Server errors are logged at warn so they stand out from the 4xx
+	// responses senders cause.
+	level := zap.InfoLevel
+	if rw.statusCode >= 500 {
+		level = zap.WarnLevel
+	}
+	l.logger.Log(level, "request", fields...)
+}
+
+// logCommon writes a Common Log Format line:
+// host ident authuser [time] "request line" status bytes.
+func (l *requestLogger) logCommon(r *http.Request, rw *responseWriter, principal string, start time.Time) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	target := r.URL.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	size := "-"
+	if rw.written > 0 {
+		size = strconv.FormatInt(rw.written, 10)
+	}
+	line := fmt.Sprintf("%s - %s [%s] %s %d %s\n",
+		clfField(host), clfField(principal), start.Format(clfTime),
+		strconv.Quote(r.Method+" "+target+" "+r.Proto), rw.statusCode, size)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, _ = io.WriteString(l.out, line)
+}
+
+// clfField returns s, or "-" when it is empty, with spaces escaped so the
+// line keeps its fields.
+func clfField(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(s, " ", "%20")
+}
+
+// requestPrincipalKey carries a *string through the request context, so
+// the handler that authenticates a request can tell the request log who
+// sent it.
+type requestPrincipalKey struct{}
+
+// notePrincipal records the authenticated principal of r for the request
+// log, if it wants one.
+func notePrincipal(r *http.Request, principal string) {
+	if p, ok := r.Context().Value(requestPrincipalKey{}).(*string); ok {
+		*p = principal
+	}
+}
+
+// withPrincipal returns r with room to record its principal.
+func withPrincipal(r *http.Request) (*http.Request, *string) {
+	p := new(string)
+	return r.WithContext(context.WithValue(r.Context(), requestPrincipalKey{}, p)), p
+}
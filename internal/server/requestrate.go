@@ -0,0 +1,56 @@
+package server
+
+import (
+	"time"
+
+	"github.com/kahook/internal/ratelimit"
+)
+
+// Request rate limit scopes, as reported in the throttled metrics.
+const (
+	scopeGlobal    = "global"
+	scopeTopic     = "topic"
+	scopePrincipal = "principal"
+
+	// scopeErrorBudget counts webhooks to topics throttled by their
+	// produce error budget.
+	scopeErrorBudget = "error_budget"
+
+	// scopeConsumerLag counts webhooks to topics whose consumers are too
+	// far behind.
+	scopeConsumerLag = "consumer_lag"
+)
+
+// RequestRates limits webhook requests per second. Global has a single
+// bucket, keyed by ""; Topic and Principal are keyed by topic and by
+// authenticated principal. Nil disables a limit.
+type RequestRates struct {
+	Global    *ratelimit.Limiter
+	Topic     *ratelimit.Limiter
+	Principal *ratelimit.Limiter
+}
+
+// admitRequest takes one token from each applicable bucket and returns the
+// scope of the first that is empty, with how long to wait, or "" if the
+// request is admitted. The sender's own bucket is checked first, so a
+// storm from one sender is throttled before it drains the shared ones.
+// Anonymous requests are not subject to the principal limit.
+func (s *Server) admitRequest(topic, principal string) (string, time.Duration) {
+	rt := s.current()
+	if rt.requestRate.Principal != nil && principal != "" {
+		if ok, wait := rt.requestRate.Principal.AllowN(principal, 1); !ok {
+			return scopePrincipal, wait
+		}
+	}
+	if rt.requestRate.Topic != nil {
+		if ok, wait := rt.requestRate.Topic.AllowN(topic, 1); !ok {
+			return scopeTopic, wait
+		}
+	}
+	if rt.requestRate.Global != nil {
+		if ok, wait := rt.requestRate.Global.AllowN("", 1); !ok {
+			return scopeGlobal, wait
+		}
+	}
+	return "", 0
+}
@@ -0,0 +1,23 @@
+package server
+
+import "net/http"
+
+// ResponseSignatureHeader carries the detached JWS of a signed webhook
+// response's body.
+const ResponseSignatureHeader = "X-JWS-Signature"
+
+// ResponseSigner signs webhook response bodies, so callers can prove after
+// the fact that kahook acknowledged a delivery. jws.Signer implements it.
+type ResponseSigner interface {
+	// Sign returns the detached JWS ("header..signature") of payload.
+	Sign(payload []byte) (string, error)
+}
+
+// signingWriter wraps w so the JSON responses written through it are
+// signed, or returns w itself when responses are not signed.
+func (s *Server) signingWriter(w http.ResponseWriter) http.ResponseWriter {
+	if s.responseSigner == nil {
+		return w
+	}
+	return &formatWriter{ResponseWriter: w, format: ResponseJSON, signer: s.responseSigner}
+}
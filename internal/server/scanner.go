@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// scannerPaths matches request paths probed by vulnerability scanners and
+// bots. Entries are path prefixes matched case-insensitively on segment
+// boundaries, so "/wp-admin" matches /wp-admin and /WP-Admin/install.php but
+// not /wp-administrators.
+type scannerPaths []string
+
+// newScannerPaths builds the matcher, leaving out paths that are served
+// topics or routes: configuration naming an endpoint wins over the list.
+func newScannerPaths(paths []string, served func(path string) bool) scannerPaths {
+	var sp scannerPaths
+	for _, p := range paths {
+		p = strings.Trim(p, "/")
+		if p != "" && !served(p) {
+			sp = append(sp, "/"+p)
+		}
+	}
+	return sp
+}
+
+func (sp scannerPaths) match(path string) bool {
+	for _, p := range sp {
+		if len(path) < len(p) || !strings.EqualFold(path[:len(p)], p) {
+			continue
+		}
+		if len(path) == len(p) || path[len(p)] == '/' {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectScanners answers requests for scanner paths with a bare 404 before
+// authentication, request logging, and request metrics, so bot traffic does
+// not drown real errors on dashboards. Rejections are counted separately
+// and logged at debug level.
+func (s *Server) rejectScanners(next http.Handler) http.Handler {
+	if len(s.scannerList) == 0 {
+		return next
+	}
+	reject := s.securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.writeError(w, http.StatusNotFound, "not_found", "not found")
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.current().scannerPaths.match(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.metrics.ScannerRejected.Add(1)
+		if ce := s.logger.Check(zap.DebugLevel, "scanner request rejected"); ce != nil {
+			ce.Write(
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+				zap.String("remote_addr", r.RemoteAddr),
+			)
+		}
+		reject.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// schemaViolation checks body against the topic's schema, if it has one.
+// The violation lists what does not match, so the sender can fix the
+// payload from the response alone.
+func (s *Server) schemaViolation(topic string, body []byte) *violation {
+	schema := s.current().topics[topic].Schema
+	if schema == nil {
+		return nil
+	}
+	problems := schema.Validate(body)
+	if len(problems) == 0 {
+		return nil
+	}
+	s.metrics.SchemaInvalid.Add(1)
+	details := make([]string, len(problems))
+	for i, p := range problems {
+		details[i] = p.String()
+	}
+	return &violation{
+		kind:    ViolationSchema,
+		status:  http.StatusUnprocessableEntity,
+		code:    "schema_validation_failed",
+		message: fmt.Sprintf("payload does not match the schema of topic %q", topic),
+		details: details,
+	}
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"mime"
+	"net/http"
+)
+
+// hstsValue is sent on TLS responses: one year, covering subdomains.
+const hstsValue = "max-age=31536000; includeSubDomains"
+
+// securityHeaders sets response headers that stop browsers from sniffing,
+// framing, or caching kahook's JSON responses, plus HSTS when the request
+// arrived over TLS or TLS is terminated upstream.
+func (s *Server) securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("X-Content-Type-Options", "nosniff")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("Cache-Control", "no-store")
+		if r.TLS != nil || s.hsts {
+			h.Set("Strict-Transport-Security", hstsValue)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkContentType enforces StrictContentType before the body is read: the
+// request must declare a well-formed media type. It writes the error
+// response and returns false on rejection.
+func (s *Server) checkContentType(w http.ResponseWriter, contentType string) bool {
+	if contentType == "" {
+		s.writeError(w, http.StatusUnsupportedMediaType, "missing_content_type", "Content-Type header is required")
+		return false
+	}
+	if _, _, err := mime.ParseMediaType(contentType); err != nil {
+		s.writeError(w, http.StatusUnsupportedMediaType, "invalid_content_type", "Content-Type header is not a valid media type")
+		return false
+	}
+	return true
+}
@@ -2,22 +2,42 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"math"
+	"net"
 	"net/http"
+	"net/netip"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/delivery"
+	"github.com/kahook/internal/ids"
+	"github.com/kahook/internal/jsonschema"
+	"github.com/kahook/internal/keyexpr"
+	"github.com/kahook/internal/lag"
+	"github.com/kahook/internal/logctx"
+	"github.com/kahook/internal/proxyproto"
+	"github.com/kahook/internal/ratelimit"
+	"github.com/kahook/internal/signature"
+	"github.com/kahook/internal/transform"
+	"github.com/kahook/internal/upcast"
 )
 
-// maxBodyBytes is the maximum request body size accepted by the webhook handler (1 MiB).
-const maxBodyBytes = 1 << 20 // 1 MiB
+// defaultMaxBodyBytes is the maximum request body size accepted by the
+// webhook handler unless ServerConfig.MaxBodyBytes or the topic's
+// TopicOptions.MaxBodyBytes says otherwise (1 MiB).
+const defaultMaxBodyBytes = 1 << 20 // 1 MiB
 
 // produceTimeout is the per-request deadline for Kafka produce calls.
 const produceTimeout = 10 * time.Second
@@ -27,8 +47,8 @@ const produceTimeout = 10 * time.Second
 var validTopicName = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
 
 // internalHeaders is the set of hop-by-hop / framework headers that are NOT
-// forwarded to Kafka as message headers. Using a package-level map avoids
-// allocating a new slice on every call to isInternalHeader.
+// forwarded to Kafka as message headers. See forwardedHeaders for the
+// precomputed lookup used on the request path.
 var internalHeaders = map[string]bool{
 	"authorization":   true,
 	"content-type":    true,
@@ -43,20 +63,216 @@ var internalHeaders = map[string]bool{
 // KafkaProducer is the interface the server requires from a Kafka producer.
 // Using an interface keeps the server decoupled from the concrete implementation
 // and makes it straightforward to inject mocks in tests.
+//
+// Produce must not retain key, value or headers after it returns: the server
+// recycles the request body buffer backing value and the headers map for
+// later requests.
 type KafkaProducer interface {
 	Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
 	IsConnected() bool
 	Close()
 }
 
+// unavailable reports whether err means the producer cannot take messages
+// yet, as with a lazily created producer that is still connecting. Such
+// errors implement Unavailable() bool.
+func unavailable(err error) bool {
+	var u interface{ Unavailable() bool }
+	return errors.As(err, &u) && u.Unavailable()
+}
+
+// topicAuthorizationFailed reports whether err means Kafka refused the
+// producer write access to the topic. Such errors implement
+// TopicAuthorizationFailed() bool.
+func topicAuthorizationFailed(err error) bool {
+	var e interface{ TopicAuthorizationFailed() bool }
+	return errors.As(err, &e) && e.TopicAuthorizationFailed()
+}
+
+// unknownTopic reports whether err means the topic does not exist in Kafka.
+// Such errors implement UnknownTopic() bool.
+func unknownTopic(err error) bool {
+	var e interface{ UnknownTopic() bool }
+	return errors.As(err, &e) && e.UnknownTopic()
+}
+
+// produceFailure returns the status, error code, and message a webhook to
+// topic is answered with when its produce failed with err. Kafka refusing
+// the topic is a configuration problem rather than an outage, and answered
+// 403 or 404 so senders and dashboards can tell them apart.
+func produceFailure(topic string, err error) (status int, code, message string) {
+	switch {
+	case topicAuthorizationFailed(err):
+		return http.StatusForbidden, "topic_authorization_failed",
+			fmt.Sprintf("kafka denied write access to topic %q", topic)
+	case unknownTopic(err):
+		return http.StatusNotFound, "topic_not_found",
+			fmt.Sprintf("topic %q does not exist in kafka", topic)
+	}
+	return http.StatusInternalServerError, "produce_error", "failed to send message to kafka"
+}
+
 // Server is the HTTP server that bridges incoming webhooks to Kafka.
 type Server struct {
-	httpServer    *http.Server
-	producer      KafkaProducer
-	auth          *auth.MultiAuth
-	logger        *zap.Logger
-	metrics       *Metrics
-	allowedTopics map[string]bool
+	httpServer   *http.Server
+	producer     KafkaProducer
+	metricsAuth  *auth.BearerAuth // nil unless metrics tokens are configured
+	logger       *zap.Logger
+	metrics      *Metrics
+	strictRoutes bool
+	devProfile   bool
+
+	// routing holds the settings Reload replaces; read it with current.
+	// reloadMu serializes its writers.
+	routing  atomic.Pointer[routing]
+	reloadMu sync.Mutex
+
+	adminServer       *http.Server     // nil without AdminAPI
+	adminAuth         *auth.BearerAuth // operators; nil without operator tokens
+	adminReadOnlyAuth *auth.BearerAuth // nil without read-only tokens
+	responseSigner    ResponseSigner   // nil unless responses are signed
+	disabled          disabledTopics
+
+	rateLimitExempt *rateLimitExemptions // nil when nothing is exempt
+	priority        *priorityAdmitter    // nil without PriorityAdmission
+	errorBudgets    *errorBudgets        // nil without ErrorBudget
+	consumerLag     *lag.Monitor         // nil without ConsumerLag
+	usage           *usageTracker        // nil without UsageReports
+	audit           *auditLog            // nil without AuditLog
+	receipts        *receipts            // nil without Receipts
+	idempotency     *deduper             // nil without Idempotency
+	accessLog       *accessLog           // nil without AccessLog
+	load            *loadTracker         // never nil
+	requestLog      *requestLogger       // never nil
+	tail            *tailHub             // nil without LiveTail
+
+	verifier      Verifier
+	verifyTimeout time.Duration
+
+	connAger  *connAger
+	stopSweep context.CancelFunc
+	stopUsage context.CancelFunc
+
+	minBodyRate  int
+	minBodyGrace time.Duration
+
+	batch *batchIngest
+
+	addressFamily  string
+	maxConnections int
+	proxyProtocol  *proxyproto.Config
+
+	isLeader func() bool // nil unless leader election is enabled
+
+	clockOffset func() (time.Duration, bool) // nil unless clock checks are enabled
+
+	configDrift func() (bool, bool) // nil unless drift checks are enabled
+
+	delivery DeliverySemantics
+
+	brokerEvents func() map[string]int64 // nil for backends without broker events
+	brokers      func() (int, bool)      // nil for backends without brokers
+
+	reloadStatus     func() ReloadStatus // nil unless config reloads are reported
+	lastProduceError atomic.Pointer[ProduceError]
+	retrying         atomic.Int64 // messages between produce retries
+
+	spool func() (SpoolStats, bool) // nil unless a spill directory is configured
+
+	geoip         CountryResolver // nil unless GeoIP is enabled
+	clientIP      ClientIP
+	countryHeader string
+
+	scannerList []string // as configured; routing holds those not served
+
+	recorder *fixtureRecorder // nil unless recording fixtures
+
+	newID ids.Generator
+	now   func() time.Time
+
+	authRealm     string // quoted for WWW-Authenticate
+	authChallenge string
+
+	tlsCertFile          string
+	tlsKeyFile           string
+	hsts                 bool
+	terseErrors          bool
+	strictContentType    bool
+	maxHeaderBytes       int
+	maxDecompressedBytes int
+	maxBodyBytes         int64
+	quarantine           Quarantine
+	deadLetter           DeadLetter
+	traceHeaders         TraceHeaders
+	spans                SpanExporter
+	spanSampleRatio      float64
+
+	probes      ProbeAccess
+	probeBypass callerSet
+
+	dispatcher *produceDispatcher // nil unless a produce queue is configured
+	overload   *overloadDetector  // nil unless overload thresholds are set
+}
+
+// TopicOptions holds per-topic behaviour. Topics without an entry use the
+// zero value, which means default behaviour for every option.
+type TopicOptions struct {
+	// Payload selects non-JSON body handling; empty means PayloadRaw.
+	Payload PayloadMode
+
+	// Countries restricts the client countries the topic accepts. Without
+	// ServerConfig.GeoIP every client's country is unknown.
+	Countries CountryPolicy
+
+	// Networks, when set, are the only client networks the topic accepts,
+	// such as a provider's published source ranges. The client address is
+	// resolved with ServerConfig.ClientIP.
+	Networks []netip.Prefix
+
+	// Priority is the topic's admission class under PriorityAdmission;
+	// empty means PriorityNormal.
+	Priority Priority
+
+	// Upcast, when set, rewrites payloads sent in older versions to the
+	// current one before producing.
+	Upcast *upcast.Upcaster
+
+	// Schema, when set, rejects payloads that do not match it with 422
+	// before producing. Payloads are checked after upcasting.
+	Schema *jsonschema.Schema
+
+	// Transform, when set, reshapes payloads just before producing, after
+	// they are checked against Schema and their key is extracted.
+	Transform *transform.Pipeline
+
+	// CloudEvents, when its Mode is set, emits messages as CloudEvents.
+	CloudEvents CloudEvents
+
+	// KeepCompressed produces gzip and deflate bodies compressed, with a
+	// Content-Encoding header, rather than decompressed. They are checked
+	// and transformed decompressed either way.
+	KeepCompressed bool
+
+	// Response is the format of webhook responses when the Accept header
+	// does not ask for JSON or text; empty means ResponseJSON.
+	Response ResponseFormat
+
+	// KeyHash, when set, replaces message keys with their hash.
+	KeyHash *KeyHasher
+
+	// Key, when set, derives the message key from the payload of webhooks
+	// sent without X-Webhook-Key. With KeyRequired, payloads it finds no
+	// key in are rejected with 422, or quarantined as key_missing.
+	Key         *keyexpr.Extractor
+	KeyRequired bool
+
+	// Signature, when set, rejects webhooks without a valid provider
+	// signature with 401 before producing.
+	Signature signature.Scheme
+
+	// MaxBodyBytes, when positive, replaces ServerConfig.MaxBodyBytes for
+	// the topic's webhooks.
+	MaxBodyBytes int64
 }
 
 // ServerConfig holds all dependencies and configuration needed to build a Server.
@@ -69,43 +285,543 @@ type ServerConfig struct {
 	Auth          *auth.MultiAuth
 	Logger        *zap.Logger
 	AllowedTopics []string
+
+	// MetricsAuth, when set, holds read-only tokens that are accepted on
+	// /metrics but cannot publish, so monitoring systems need no publish
+	// credentials. With MetricsAuth set, /metrics is never anonymous.
+	MetricsAuth *auth.BearerAuth
+
+	// CredentialDormancy logs a warning when a credential is used after
+	// going unused this long. Zero disables the warning; per-credential
+	// usage is tracked and served on /admin/credentials either way.
+	CredentialDormancy time.Duration
+
+	// StrictRoutes answers 404 rather than 400/403 for any path that is not
+	// an allowed topic, so "no such endpoint" is distinguishable from a bad
+	// request. DevProfile adds close-match suggestions to those 404s.
+	StrictRoutes bool
+	DevProfile   bool
+
+	// RequestRate limits webhook requests per second, globally, per topic,
+	// and per authenticated principal. Throttled requests get 429s.
+	RequestRate RequestRates
+
+	// TopicBandwidth and PrincipalBandwidth limit body bytes per second per
+	// topic and per authenticated principal. Nil disables the limit.
+	TopicBandwidth     *ratelimit.Limiter
+	PrincipalBandwidth *ratelimit.Limiter
+
+	// RateLimitExempt lists principals, client networks, and topics or
+	// route paths that bypass the request rate and bandwidth limits.
+	RateLimitExempt RateLimitExemptions
+
+	// Priority sheds low-priority webhooks with 429s as the number in
+	// flight approaches its bound, so high-priority topics keep being
+	// accepted under saturation.
+	Priority PriorityAdmission
+
+	// ErrorBudget throttles topics whose produces keep failing, with 429s,
+	// so they do not starve healthy topics. /admin/error-budgets shows the
+	// throttles, and the admin API lifts them.
+	ErrorBudget ErrorBudget
+
+	// ConsumerLag, when set, answers webhooks to topics whose consumer
+	// groups are too far behind with 429 until they catch up. The caller
+	// runs it.
+	ConsumerLag *lag.Monitor
+
+	// Usage emits per-tenant, per-topic traffic summaries every Interval
+	// and stamps messages with their tenant.
+	Usage UsageReports
+
+	// Tail serves a live Server-Sent Events view of produced messages on
+	// /admin/tail, for debugging integrations.
+	Tail LiveTail
+
+	// Topics holds per-topic options keyed by topic name.
+	Topics map[string]TopicOptions
+
+	// RoutePaths maps request paths to the topic they produce to. Paths
+	// without an entry produce to the topic of the same name.
+	RoutePaths map[string]string
+
+	// RouteHeaders maps request paths to static headers added to every
+	// message from that path, replacing request headers of the same name.
+	RouteHeaders map[string]map[string]string
+
+	// AliasedTopics are served only at their RoutePaths: a request to
+	// /<topic> is rejected as if the topic were not allowed.
+	AliasedTopics []string
+
+	// Host is the address to bind; empty binds every interface.
+	// AddressFamily is AddressFamilyDual (default), AddressFamilyIPv4, or
+	// AddressFamilyIPv6.
+	Host          string
+	AddressFamily string
+
+	// ProxyProtocol, when set, accepts PROXY protocol v1/v2 headers from
+	// trusted load balancers so RemoteAddr is the real client address.
+	ProxyProtocol *proxyproto.Config
+
+	// MaxConnectionAge recycles keep-alive connections older than this so
+	// load balancers can rebalance and drains converge. Zero disables it.
+	MaxConnectionAge time.Duration
+
+	// ReadHeaderTimeout bounds reading a request's headers, so clients
+	// trickling headers are cut off long before ReadTimeout. Zero means
+	// ReadTimeout applies to the headers too.
+	ReadHeaderTimeout time.Duration
+
+	// MinBodyRate, in bytes per second, closes requests whose body arrives
+	// slower than this on average, after a short grace period, with 408.
+	// Zero disables it.
+	MinBodyRate int
+
+	// MaxRequestsPerConnection closes keep-alive connections after this
+	// many requests. Zero allows any number.
+	MaxRequestsPerConnection int
+
+	// HTTPMaxHeaderBytes is the most request header bytes read; larger
+	// requests are refused with 431 before they reach a handler, unlike
+	// those over MaxHeaderBytes. Zero means http.DefaultMaxHeaderBytes
+	// (1 MiB).
+	HTTPMaxHeaderBytes int
+
+	// MaxConnections is the most connections served at once. Further
+	// clients wait in the listen backlog until a connection closes. Zero
+	// allows any number.
+	MaxConnections int
+
+	// DisableHTTP2 serves HTTPS over HTTP/1.1 only; by default clients may
+	// negotiate HTTP/2. DisableKeepAlives closes each connection after its
+	// response.
+	DisableHTTP2      bool
+	DisableKeepAlives bool
+
+	// Batch, when enabled, serves /batch/{topic} for NDJSON and JSON array
+	// bodies of many records.
+	Batch BatchIngest
+
+	// ProduceQueue, when its Depth is positive, produces through per-topic
+	// worker goroutines with bounded queues; full queues answer 503.
+	ProduceQueue ProduceQueue
+
+	// Overload makes /ready fail while produce queues or error rates stay
+	// above its thresholds. The zero value only checks broker connectivity.
+	Overload OverloadThresholds
+
+	// LatencySLO enables produce latency SLO tracking in /metrics when its
+	// Threshold is positive.
+	LatencySLO LatencySLO
+
+	// IsLeader reports whether this replica is the elected leader, shown as
+	// "leader" in /metrics. Nil when leader election is disabled.
+	IsLeader func() bool
+
+	// ClockOffset reports the latest measured offset of a reference clock
+	// from the local clock, and false until one has been measured. When set,
+	// messages carry Kahook-Received-At and, once measured,
+	// Kahook-Clock-Offset-Ms, so consumers can correct event times from a
+	// skewed node; /metrics shows clock_offset_ms. Nil disables both.
+	ClockOffset func() (time.Duration, bool)
+
+	// ConfigDrift reports whether the running config differs from its
+	// reference copy, and false as its second result until a drift check
+	// has succeeded; /metrics shows config_drift. Nil when drift checks are
+	// disabled.
+	ConfigDrift func() (drifted, checked bool)
+
+	// Delivery describes the producer's delivery guarantee, shown as
+	// "delivery" in /metrics. The zero value omits it.
+	Delivery DeliverySemantics
+
+	// BrokerEvents returns counts of broker connection events by kind
+	// (broker_down, all_brokers_down, ...), shown as broker_events in
+	// /metrics. Nil for backends that do not report them.
+	BrokerEvents func() map[string]int64
+
+	// Brokers reports the number of brokers in the latest cluster
+	// metadata, and false until some has been fetched; /health?verbose=1
+	// shows it. Nil for backends without brokers.
+	Brokers func() (int, bool)
+
+	// ReloadStatus reports the config reloads since startup, shown in
+	// /health?verbose=1. Nil omits it.
+	ReloadStatus func() ReloadStatus
+
+	// Spool reports the size and age of the messages kept on local disk,
+	// and false as its second result when the directory cannot be read;
+	// /metrics shows spool. Nil when nothing is spooled to disk.
+	Spool func() (SpoolStats, bool)
+
+	// TLSCertFile and TLSKeyFile, when set, serve HTTPS. HSTS sends
+	// Strict-Transport-Security on plain HTTP responses too, for TLS
+	// terminated by a load balancer.
+	TLSCertFile string
+	TLSKeyFile  string
+	HSTS        bool
+
+	// TerseErrors replaces error messages with the HTTP status text, so
+	// responses do not describe configuration such as allowed topics.
+	TerseErrors bool
+
+	// StrictContentType rejects webhooks without a valid Content-Type and
+	// bodies declared as JSON that do not parse.
+	StrictContentType bool
+
+	// MaxHeaderBytes is a soft limit on the size of a webhook's headers:
+	// larger requests are rejected with 431, or quarantined. Zero disables
+	// it.
+	MaxHeaderBytes int
+
+	// MaxDecompressedBytes bounds what a gzip or deflate webhook body may
+	// decompress to; larger bodies are rejected with 413. Zero means the
+	// webhook's body limit.
+	MaxDecompressedBytes int
+
+	// MaxBodyBytes bounds webhook bodies; larger ones are rejected with
+	// 413. Zero means 1 MiB. Topics may set their own limit.
+	MaxBodyBytes int64
+
+	// Quarantine produces webhooks that break soft policies to a quarantine
+	// topic instead of rejecting them.
+	Quarantine Quarantine
+
+	// DeadLetter retries failed produces and then produces the message to
+	// a dead letter topic instead of failing the request.
+	DeadLetter DeadLetter
+
+	// Audit produces a record of every produce attempt to an audit topic.
+	Audit AuditLog
+
+	// Receipts produces a receipt of every delivered message to a receipts
+	// topic.
+	Receipts Receipts
+
+	// Idempotency caches the responses to webhooks, so retries of a
+	// delivery get the original response instead of producing it again.
+	Idempotency Idempotency
+
+	// Load sets the targets of the load signal autoscalers scale on.
+	Load LoadSignal
+
+	// AccessLog produces a record of every HTTP request to a logging topic.
+	AccessLog AccessLog
+
+	// RequestLog is the format and fields of the line logged for each
+	// request.
+	RequestLog RequestLog
+
+	// TraceHeaders is how inbound tracing headers are handled; empty means
+	// TraceForward.
+	TraceHeaders TraceHeaders
+
+	// Spans, when set, receives a server span for each webhook request and
+	// a producer span for its produce, and inbound tracing headers are
+	// handled as with TraceParent. SpanSampleRatio is the fraction of new
+	// traces recorded; zero means all of them.
+	Spans           SpanExporter
+	SpanSampleRatio float64
+
+	// Probes controls access to /health and /ready, which are open by
+	// default.
+	Probes ProbeAccess
+
+	// ScannerPaths lists path prefixes probed by bots and vulnerability
+	// scanners (/.env, /wp-admin). They get a 404 without request logging or
+	// request metrics, counted only as scanner_rejected. Paths that are
+	// allowed topics, routes, or configured topics are never rejected.
+	ScannerPaths []string
+
+	// RecordDir, when set, records every webhook request and the status it
+	// was answered with as a fixture file in this directory, for replay with
+	// testkit.ReplayFixtures. Credential and client address headers are left
+	// out, and RecordSecrets are masked in the remaining headers and body.
+	RecordDir     string
+	RecordSecrets []string
+
+	// AuthRealm is the realm in WWW-Authenticate challenges (default
+	// "kahook"). AuthChallenge selects the challenge sent with 401s:
+	// ChallengeAuto (default), ChallengeBasic, ChallengeBearer, or
+	// ChallengeNone.
+	AuthRealm     string
+	AuthChallenge string
+
+	// GeoIP, when set, resolves each webhook's client country. The country
+	// is sent as the CountryHeader message header (default Kahook-Country),
+	// counted per topic in /metrics, and checked against topic
+	// CountryPolicies.
+	GeoIP         CountryResolver
+	CountryHeader string
+
+	// ClientIP resolves the client address of requests relayed by trusted
+	// proxies, for topic Networks.
+	ClientIP ClientIP
+
+	// AdminAPI serves runtime inspection and control on its own listener.
+	AdminAPI AdminAPI
+
+	// ResponseSigner, when set, signs webhook and batch response bodies,
+	// sent in ResponseSignatureHeader. Responses without a body are not
+	// signed.
+	ResponseSigner ResponseSigner
+
+	// Verifier enables /admin/verify; nil leaves the endpoint unregistered.
+	// VerifyTimeout bounds each check; zero means the request's own deadline.
+	Verifier      Verifier
+	VerifyTimeout time.Duration
+
+	// NewID generates the request ID of requests that arrive without an
+	// X-Request-ID, and the Kahook-Message-Id of every message. Nil uses
+	// UUIDv4; see the ids package for time-sortable schemes.
+	NewID ids.Generator
+
+	// Now is the server's clock. It stamps received webhooks and drives
+	// uptime, SLO and error budget windows, usage reports, credential
+	// dormancy, and connection ages. Nil uses time.Now; tests set it to
+	// control time. Rate limiters, signature verifiers, and JWT
+	// validation, here and in Reloadable, are built by the caller, who
+	// gives them the same clock with ratelimit.Limiter.WithClock and their
+	// own Now settings. Durations of network I/O, such as request latency
+	// and body rates, use the real clock.
+	Now func() time.Time
+}
+
+// Challenges sent with 401 responses.
+const (
+	// ChallengeAuto answers with the scheme the request tried, Bearer for
+	// bearer tokens and Basic otherwise.
+	ChallengeAuto   = "auto"
+	ChallengeBasic  = "basic"
+	ChallengeBearer = "bearer"
+	// ChallengeNone omits WWW-Authenticate, for clients such as dashboards
+	// proxied through a browser, where a Basic challenge pops up a login
+	// dialog.
+	ChallengeNone = "none"
+)
+
+// defaultAuthRealm is the realm used when none is configured.
+const defaultAuthRealm = "kahook"
+
+// quoteRealm formats realm as an RFC 7230 quoted-string.
+func quoteRealm(realm string) string {
+	if realm == "" {
+		realm = defaultAuthRealm
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(realm) + `"`
 }
 
 // ErrorResponse is the JSON body returned on errors.
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Message string `json:"message"`
+	Error       string   `json:"error"`
+	Message     string   `json:"message"`
+	Suggestions []string `json:"suggestions,omitempty"`
+	Details     []string `json:"details,omitempty"`
 }
 
 // NewServer constructs and configures the HTTP server.
 func NewServer(cfg ServerConfig) *Server {
-	allowed := make(map[string]bool, len(cfg.AllowedTopics))
-	for _, t := range cfg.AllowedTopics {
-		allowed[t] = true
+	now := cfg.Now
+	if now == nil {
+		now = time.Now
 	}
-
 	s := &Server{
-		producer:      cfg.Producer,
-		auth:          cfg.Auth,
-		logger:        cfg.Logger,
-		metrics:       NewMetrics(),
-		allowedTopics: allowed,
+		producer:     cfg.Producer,
+		metricsAuth:  cfg.MetricsAuth,
+		logger:       cfg.Logger,
+		metrics:      newMetrics(now),
+		strictRoutes: cfg.StrictRoutes,
+		devProfile:   cfg.DevProfile,
+
+		rateLimitExempt: newRateLimitExemptions(cfg.RateLimitExempt),
+		priority:        newPriorityAdmitter(cfg.Priority),
+		usage:           newUsageTracker(cfg.Usage, cfg.Producer, cfg.Logger, now),
+		tail:            newTailHub(cfg.Tail),
+
+		verifier:      cfg.Verifier,
+		verifyTimeout: cfg.VerifyTimeout,
+
+		minBodyRate:    cfg.MinBodyRate,
+		minBodyGrace:   defaultMinBodyRateGrace,
+		batch:          newBatchIngest(cfg.Batch),
+		addressFamily:  cfg.AddressFamily,
+		maxConnections: cfg.MaxConnections,
+		proxyProtocol:  cfg.ProxyProtocol,
+
+		isLeader:     cfg.IsLeader,
+		clockOffset:  cfg.ClockOffset,
+		configDrift:  cfg.ConfigDrift,
+		delivery:     cfg.Delivery,
+		brokerEvents: cfg.BrokerEvents,
+		brokers:      cfg.Brokers,
+		reloadStatus: cfg.ReloadStatus,
+		spool:        cfg.Spool,
+
+		geoip:         cfg.GeoIP,
+		clientIP:      cfg.ClientIP,
+		countryHeader: http.CanonicalHeaderKey(cfg.CountryHeader),
+
+		authRealm:     quoteRealm(cfg.AuthRealm),
+		authChallenge: cfg.AuthChallenge,
+
+		tlsCertFile:          cfg.TLSCertFile,
+		tlsKeyFile:           cfg.TLSKeyFile,
+		hsts:                 cfg.HSTS,
+		terseErrors:          cfg.TerseErrors,
+		strictContentType:    cfg.StrictContentType,
+		maxHeaderBytes:       cfg.MaxHeaderBytes,
+		maxDecompressedBytes: cfg.MaxDecompressedBytes,
+		maxBodyBytes:         cfg.MaxBodyBytes,
+		quarantine:           cfg.Quarantine,
+		deadLetter:           cfg.DeadLetter,
+		traceHeaders:         cfg.TraceHeaders,
+		spans:                cfg.Spans,
+		spanSampleRatio:      cfg.SpanSampleRatio,
+
+		probes:      cfg.Probes,
+		probeBypass: newCallerSet(nil, cfg.Probes.BypassNetworks),
+
+		scannerList: cfg.ScannerPaths,
+
+		newID:          cfg.NewID,
+		now:            now,
+		responseSigner: cfg.ResponseSigner,
+	}
+	if s.newID == nil {
+		s.newID = uuid.NewString
+	}
+	if s.maxBodyBytes <= 0 {
+		s.maxBodyBytes = defaultMaxBodyBytes
+	}
+
+	if cfg.RecordDir != "" {
+		s.recorder = newFixtureRecorder(cfg.RecordDir, cfg.RecordSecrets, s.maxBodyBytes, cfg.Logger, now)
+	}
+	s.audit = newAuditLog(cfg.Audit, cfg.Producer, cfg.Logger, s.metrics, now)
+	s.receipts = newReceipts(cfg.Receipts, cfg.Producer, cfg.Logger, s.metrics, now)
+	s.idempotency = newDeduper(cfg.Idempotency, now, cfg.Logger, &s.metrics.IdempotencyStoreErrors)
+	s.load = newLoadTracker(cfg.Load, now)
+	s.accessLog = newAccessLog(cfg.AccessLog, cfg.Producer, cfg.Logger, s.metrics)
+	s.requestLog = newRequestLogger(cfg.RequestLog, cfg.Logger)
+	s.errorBudgets = newErrorBudgets(cfg.ErrorBudget, &s.metrics.ErrorBudgetTrips, cfg.Logger, now)
+	s.consumerLag = cfg.ConsumerLag
+
+	var publishCreds, metricsCreds []auth.Credential
+	if cfg.Auth != nil {
+		publishCreds = cfg.Auth.Credentials()
+	}
+	if cfg.MetricsAuth != nil {
+		metricsCreds = cfg.MetricsAuth.Credentials()
 	}
+	s.routing.Store(s.newRouting(Reloadable{
+		Auth:               cfg.Auth,
+		AllowedTopics:      cfg.AllowedTopics,
+		RequestRate:        cfg.RequestRate,
+		TopicBandwidth:     cfg.TopicBandwidth,
+		PrincipalBandwidth: cfg.PrincipalBandwidth,
+		Topics:             cfg.Topics,
+		RoutePaths:         cfg.RoutePaths,
+		RouteHeaders:       cfg.RouteHeaders,
+		AliasedTopics:      cfg.AliasedTopics,
+	}, newCredentialUsage(publishCreds, metricsCreds, cfg.CredentialDormancy, cfg.Logger, now)))
+
+	s.adminServer = s.newAdminServer(cfg.AdminAPI)
+
+	if cfg.ProduceQueue.Depth > 0 {
+		s.dispatcher = newProduceDispatcher(cfg.Producer, cfg.ProduceQueue, now)
+	}
+	if cfg.Overload.enabled() {
+		s.overload = newOverloadDetector(cfg.Overload, s.dispatcher, now)
+	}
+
+	if cfg.LatencySLO.Threshold > 0 {
+		s.metrics.slo = newSLOTracker(cfg.LatencySLO, now)
+	}
+	s.metrics.listed = func(topic string) bool { return s.current().listsTopic(topic) }
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/health", s.healthHandler)
 	mux.HandleFunc("/ready", s.readyHandler)
 	mux.HandleFunc("/metrics", s.metricsHandler)
-	mux.HandleFunc("/", s.webhookHandler)
+	if s.verifier != nil {
+		mux.HandleFunc("/admin/verify", s.verifyHandler)
+	}
+	if len(publishCreds) > 0 {
+		mux.HandleFunc("/admin/credentials", s.credentialsHandler)
+	}
+	if s.usage != nil {
+		mux.HandleFunc("/admin/usage", s.usageHandler)
+	}
+	if s.tail != nil {
+		mux.HandleFunc("/admin/tail", s.tailHandler)
+	}
+	mux.HandleFunc("/admin/queues", s.queuesHandler)
+	mux.HandleFunc("/admin/load", s.loadHandler)
+	if s.errorBudgets != nil {
+		mux.HandleFunc("/admin/error-budgets", s.errorBudgetsHandler)
+	}
+	if s.devProfile {
+		mux.HandleFunc(consolePath, s.consoleHandler)
+		mux.HandleFunc(consolePath+"/console.js", s.consoleHandler)
+		mux.HandleFunc(consolePath+"/send", s.consoleSendHandler)
+	}
+	var webhook http.Handler = http.HandlerFunc(s.webhookHandler)
+	if s.recorder != nil {
+		webhook = s.recorder.middleware(webhook)
+	}
+	if s.spans != nil {
+		webhook = s.traceRequests(webhook)
+	}
+	mux.Handle("/", webhook)
+	if s.batch != nil {
+		var batch http.Handler = http.HandlerFunc(s.batchHandler)
+		if s.spans != nil {
+			batch = s.traceRequests(batch)
+		}
+		mux.Handle("/batch/{path}", batch)
+	}
 
-	handler := RequestIDMiddleware(s.loggingMiddleware(mux))
+	var handler http.Handler = requestIDMiddleware(s.newID, s.rejectScanners(s.loggingMiddleware(s.securityHeaders(mux))))
+	if cfg.MaxConnectionAge > 0 {
+		s.connAger = newConnAger(cfg.MaxConnectionAge, &s.metrics.ConnectionsRecycled, now)
+		handler = s.connAger.middleware(handler)
+	}
+	if cfg.MaxRequestsPerConnection > 0 {
+		handler = s.limitConnRequests(cfg.MaxRequestsPerConnection, handler)
+	}
 
 	s.httpServer = &http.Server{
-		Addr:         fmt.Sprintf(":%d", cfg.Port),
-		Handler:      handler,
-		ReadTimeout:  cfg.ReadTimeout,
-		WriteTimeout: cfg.WriteTimeout,
-		IdleTimeout:  cfg.IdleTimeout,
+		Addr:              net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.HTTPMaxHeaderBytes,
+	}
+	if s.tlsCertFile != "" {
+		s.httpServer.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if cfg.DisableHTTP2 {
+		// A non-nil, empty TLSNextProto keeps net/http from enabling HTTP/2.
+		s.httpServer.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+	if cfg.DisableKeepAlives {
+		s.httpServer.SetKeepAlivesEnabled(false)
+	}
+	if s.connAger != nil {
+		s.httpServer.ConnState = s.connAger.connState
+		s.httpServer.ConnContext = s.connAger.connContext
+	}
+	if cfg.MaxRequestsPerConnection > 0 {
+		connContext := s.httpServer.ConnContext
+		s.httpServer.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+			if connContext != nil {
+				ctx = connContext(ctx, c)
+			}
+			return connRequests(ctx, c)
+		}
 	}
 
 	return s
@@ -114,46 +830,123 @@ func NewServer(cfg ServerConfig) *Server {
 // Start begins listening for HTTP requests. It blocks until the server stops.
 func (s *Server) Start() error {
 	s.logger.Info("starting server", zap.String("addr", s.httpServer.Addr))
-	return s.httpServer.ListenAndServe()
+	ln, err := s.listen()
+	if err != nil {
+		return err
+	}
+	if s.adminServer != nil {
+		if err := s.startAdmin(); err != nil {
+			ln.Close()
+			return err
+		}
+	}
+	s.logListening(ln)
+	s.logSummary(ln)
+	if s.devProfile {
+		s.logger.Info("webhook test console enabled", zap.String("path", consolePath))
+	}
+	if s.recorder != nil {
+		s.logger.Warn("recording webhook fixtures", zap.String("dir", s.recorder.dir))
+	}
+
+	if s.connAger != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopSweep = cancel
+		go s.connAger.run(ctx)
+	}
+	if s.usage != nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		s.stopUsage = cancel
+		go s.usage.run(ctx)
+	}
+	if s.tlsCertFile != "" {
+		return s.httpServer.ServeTLS(ln, s.tlsCertFile, s.tlsKeyFile)
+	}
+	return s.httpServer.Serve(ln)
+}
+
+// Handler returns the server's HTTP handler, including middleware, for
+// embedding kahook in another server or driving it from tests.
+func (s *Server) Handler() http.Handler {
+	return s.httpServer.Handler
 }
 
 // Shutdown gracefully drains in-flight requests.
 func (s *Server) Shutdown(ctx context.Context) error {
 	s.logger.Info("shutting down server")
-	return s.httpServer.Shutdown(ctx)
+	if s.stopSweep != nil {
+		s.stopSweep()
+	}
+	if s.tail != nil {
+		// Tail streams never finish on their own.
+		s.tail.close()
+	}
+	err := s.httpServer.Shutdown(ctx)
+	if s.adminServer != nil {
+		s.shutdownAdmin(ctx)
+	}
+	if s.usage != nil {
+		// Report the partial window so its traffic is not lost.
+		if s.stopUsage != nil {
+			s.stopUsage()
+		}
+		s.usage.flush(ctx)
+	}
+	if s.audit != nil {
+		s.audit.close(ctx)
+	}
+	if s.receipts != nil {
+		s.receipts.close(ctx)
+	}
+	if s.accessLog != nil {
+		s.accessLog.close(ctx)
+	}
+	if s.dispatcher != nil {
+		s.dispatcher.close()
+	}
+	return err
 }
 
 func (s *Server) loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+		start := s.now()
 
 		s.metrics.IncrementRequests()
 
+		var principal *string
+		if s.requestLog.wantsPrincipal() {
+			r, principal = withPrincipal(r)
+		}
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next.ServeHTTP(wrapped, r)
+		elapsed := s.now().Sub(start)
 
 		if wrapped.statusCode >= 400 {
-			s.metrics.IncrementError()
+			s.metrics.IncrementError(wrapped.statusCode)
 		} else {
 			s.metrics.IncrementSuccess()
 		}
 
-		requestID := w.Header().Get(RequestIDHeader)
+		requestID := requestIDFrom(r.Context())
+		if s.accessLog != nil {
+			s.accessLog.record(r, wrapped, requestID, start, elapsed)
+			if s.accessLog.replace {
+				return
+			}
+		}
 
-		s.logger.Info("request",
-			zap.String("method", r.Method),
-			zap.String("path", r.URL.Path),
-			zap.Int("status", wrapped.statusCode),
-			zap.Duration("duration", time.Since(start)),
-			zap.String("remote_addr", r.RemoteAddr),
-			zap.String("request_id", requestID),
-		)
+		var who string
+		if principal != nil {
+			who = *principal
+		}
+		s.requestLog.log(r, wrapped, requestID, who, start, elapsed)
 	})
 }
 
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	written    int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -161,11 +954,36 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.written += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, for
+// handlers that flush or extend deadlines.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet && r.Method != http.MethodHead {
 		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
 		return
 	}
+	if !s.authorizeProbe(r) {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	if wantsVerboseHealth(r) {
+		// The report shows what /metrics does, so it needs the same access.
+		if !s.authorizeMetrics(r) {
+			s.writeUnauthorized(w, r)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, s.healthReport())
+		return
+	}
 	s.writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
 }
 
@@ -174,12 +992,23 @@ func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
 		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
 		return
 	}
+	if !s.authorizeProbe(r) {
+		s.writeUnauthorized(w, r)
+		return
+	}
 
 	if s.producer == nil || !s.producer.IsConnected() {
 		s.writeError(w, http.StatusServiceUnavailable, "not_ready", "kafka producer not available")
 		return
 	}
 
+	if s.overload != nil {
+		if reason, overloaded := s.overload.check(); overloaded {
+			s.writeError(w, http.StatusServiceUnavailable, "overloaded", reason)
+			return
+		}
+	}
+
 	s.writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
 }
 
@@ -191,75 +1020,241 @@ func (s *Server) metricsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !s.auth.Authenticate(r) {
+	if !s.authorizeMetrics(r) {
 		s.writeUnauthorized(w, r)
 		return
 	}
 
 	response := newMetricsSnapshot(s.metrics)
+	if s.dispatcher != nil {
+		response.ProduceQueues = s.dispatcher.depths()
+	}
+	if s.priority != nil {
+		inFlight := s.priority.inFlight.Load()
+		response.InFlight = &inFlight
+	}
+	if s.errorBudgets != nil {
+		response.ThrottledTopics = s.errorBudgets.throttled()
+	}
+	if s.consumerLag != nil {
+		response.ConsumerLag = s.consumerLag.Lags()
+		response.LaggingTopics = s.consumerLag.LaggingTopics()
+	}
+	if s.isLeader != nil {
+		leader := s.isLeader()
+		response.Leader = &leader
+	}
+	if s.delivery.Mode != "" {
+		delivery := s.delivery
+		response.Delivery = &delivery
+	}
+	if s.clockOffset != nil {
+		if offset, ok := s.clockOffset(); ok {
+			ms := offset.Milliseconds()
+			response.ClockOffsetMs = &ms
+		}
+	}
+	if s.configDrift != nil {
+		if drifted, ok := s.configDrift(); ok {
+			response.ConfigDrift = &drifted
+		}
+	}
+	if s.brokerEvents != nil {
+		response.BrokerEvents = s.brokerEvents()
+	}
+	if s.spool != nil {
+		if st, ok := s.spool(); ok {
+			response.Spool = &st
+		}
+	}
+	load := s.loadReport()
+	response.Load = &load
+	w.Header().Add("Vary", "Accept")
+	if wantsPrometheus(r) {
+		w.Header().Set("Content-Type", prometheusContentType)
+		_ = writePrometheus(w, response, s.metrics.StartTime)
+		return
+	}
 	s.writeJSON(w, http.StatusOK, response)
 }
 
-func (s *Server) webhookHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST is allowed")
-		return
+// authorizeMetrics reports whether r may read /metrics: with a metrics token
+// or with publish credentials. Without either configured, /metrics is open.
+func (s *Server) authorizeMetrics(r *http.Request) bool {
+	rt := s.current()
+	if s.metricsAuth != nil {
+		if principal, ok := s.metricsAuth.Identify(r); ok {
+			rt.credentials.record(roleMetrics, principal)
+			return true
+		}
+		if !rt.auth.HasAuth() {
+			return false
+		}
 	}
+	principal, ok := rt.auth.Identify(r)
+	if ok {
+		rt.credentials.record(rolePublish, principal)
+	}
+	return ok
+}
 
-	if !s.auth.Authenticate(r) {
-		s.writeUnauthorized(w, r)
-		return
+func (s *Server) webhookHandler(w http.ResponseWriter, r *http.Request) {
+	received := s.now()
+	path := strings.Trim(r.URL.Path, "/")
+	topic := path
+	t, route := s.current().routePaths[path]
+	if route {
+		topic = t
 	}
+	w = s.negotiateFormat(w, r, topic)
 
-	topic := strings.Trim(r.URL.Path, "/")
-	if topic == "" || !validTopicName.MatchString(topic) {
-		s.writeError(w, http.StatusBadRequest, "invalid_topic",
-			"topic must match [a-zA-Z0-9._-] and be 1-249 characters")
+	req, ok := s.admitWebhook(w, r, path, topic, route)
+	if !ok {
 		return
 	}
+	defer req.release()
+	defer s.load.begin()()
+	principal, country, exempt := req.principal, req.country, req.exempt
 
-	if topic == "health" || topic == "ready" || topic == "metrics" {
-		s.writeError(w, http.StatusBadRequest, "reserved_topic", "cannot use reserved topic name")
+	// A header violation is only answered once the body is read, so a
+	// quarantined webhook keeps its payload.
+	headerViolation := s.headerViolation(r)
+	if headerViolation != nil && !s.quarantine.covers(headerViolation.kind) {
+		s.writeError(w, headerViolation.status, headerViolation.code, headerViolation.message)
 		return
 	}
 
-	if len(s.allowedTopics) > 0 && !s.allowedTopics[topic] {
-		s.writeError(w, http.StatusForbidden, "topic_not_allowed",
-			fmt.Sprintf("topic %q is not in the allowed topics list", topic))
+	contentType := r.Header.Get("Content-Type")
+	if s.strictContentType && !s.checkContentType(w, contentType) {
 		return
 	}
 
 	// Limit body size to prevent unbounded memory allocation from malicious senders.
-	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
-	body, err := io.ReadAll(r.Body)
+	// The body is read into a pooled buffer sized from Content-Length and handed
+	// to the producer as-is; it is recycled once Produce has returned.
+	s.limitBodyRate(w, r)
+	limit := s.bodyLimit(topic)
+	r.Body = http.MaxBytesReader(w, r.Body, limit)
+	buf, err := bodyBuffers.readBody(r.Body, r.ContentLength, limit)
 	if err != nil {
 		var maxBytesErr *http.MaxBytesError
 		if errors.As(err, &maxBytesErr) {
 			s.writeError(w, http.StatusRequestEntityTooLarge, "body_too_large",
-				fmt.Sprintf("request body exceeds maximum size of %d bytes", maxBodyBytes))
+				fmt.Sprintf("request body exceeds maximum size of %d bytes", limit))
+			return
+		}
+		if errors.Is(err, errBodyTooSlow) {
+			s.metrics.SlowBodyRejected.Add(1)
+			w.Header().Set("Connection", "close")
+			s.writeError(w, http.StatusRequestTimeout, "body_too_slow",
+				fmt.Sprintf("request body arrived slower than %d bytes per second", s.minBodyRate))
 			return
 		}
 		s.writeError(w, http.StatusBadRequest, "read_error", "failed to read request body")
 		return
 	}
 	defer r.Body.Close()
+	defer bodyBuffers.put(buf)
+	body := *buf
 
 	if len(body) == 0 {
 		s.writeError(w, http.StatusBadRequest, "empty_body", "request body cannot be empty")
 		return
 	}
 
-	headers := make(map[string]string)
-	for k, v := range r.Header {
-		if !isInternalHeader(k) {
-			headers[k] = v[0]
+	s.metrics.RecordReceived(topic, len(body))
+	if s.usage != nil {
+		s.usage.received(principal, topic, len(body))
+	}
+
+	if !s.verifySignature(w, r, topic, body) {
+		return
+	}
+
+	idempotent, ok := s.admitIdempotent(w, r, principal, topic, signature.NewBodyDigest(body))
+	if !ok {
+		return
+	}
+	defer idempotent.release()
+
+	if !exempt {
+		if ok, retryAfter := s.admitBandwidth(topic, principal, len(body)); !ok {
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			s.writeError(w, http.StatusTooManyRequests, "bandwidth_exceeded",
+				"bandwidth limit exceeded, retry later")
+			return
 		}
 	}
 
-	webhookKey := r.Header.Get("X-Webhook-Key")
-	var key []byte
-	if webhookKey != "" {
-		key = []byte(webhookKey)
+	// Signatures cover the body as sent; everything after sees it
+	// decompressed.
+	plain, compression, releasePlain, ok := s.decodeBody(w, r, body, limit)
+	if !ok {
+		return
+	}
+	defer releasePlain()
+
+	v := headerViolation
+	if v == nil {
+		v = s.contentViolation(topic, contentType, plain)
+	}
+	var payload upcast.Result
+	if v == nil {
+		payload, v = s.upcastPayload(r, topic, plain)
+	}
+	if v == nil {
+		v = s.schemaViolation(topic, payload.Body)
+	}
+	var extractedKey []byte
+	if v == nil {
+		extractedKey, v = s.extractKey(r, topic, payload.Body)
+	}
+	requestID := requestIDFrom(r.Context())
+	if v == nil {
+		payload.Body, v = s.transformPayload(r, topic, path, requestID, received, payload.Body)
+	}
+	if v != nil {
+		s.rejectOrQuarantine(w, r, principal, topic, contentType, plain, v)
+		return
+	}
+
+	value, encoding, ok := s.encodePayload(w, topic, contentType, payload.Body)
+	if !ok {
+		return
+	}
+
+	headers := forwardedHeaders.messageHeaders(r.Header)
+	defer putHeaderMap(headers)
+	s.setRouteHeaders(headers, path)
+	if contentType != "" {
+		headers[contentTypeHeader] = contentType
+	}
+	headers[payloadEncodingHeader] = encoding
+	messageID := s.newID()
+	headers[messageIDHeader] = messageID
+	s.setClockHeaders(headers, received)
+	s.setCountryHeader(headers, country)
+	setSubjectHeader(headers, principal)
+	s.setUpcastHeaders(headers, topic, payload)
+	span := s.setTraceHeaders(headers, r)
+	if s.usage != nil {
+		headers[s.usage.header] = tenant(principal)
+	}
+
+	key := s.messageKey(headers, r, topic, extractedKey)
+
+	eventID := requestID
+	if eventID == "" {
+		eventID = messageID
+	}
+	value, valueType, err := s.toCloudEvent(headers, r, topic, path, eventID, received, contentType, value)
+	if err != nil {
+		s.writeError(w, http.StatusInternalServerError, "encode_error", "failed to encode payload")
+		return
+	}
+	if value, err = s.setCompression(headers, topic, compression, body, plain, value); err != nil {
+		s.writeError(w, http.StatusInternalServerError, "encode_error", "failed to encode payload")
+		return
 	}
 
 	// Apply a per-request produce timeout so a hung Kafka broker doesn't block
@@ -267,69 +1262,457 @@ func (s *Server) webhookHandler(w http.ResponseWriter, r *http.Request) {
 	produceCtx, cancel := context.WithTimeout(r.Context(), produceTimeout)
 	defer cancel()
 
-	if err := s.producer.Produce(produceCtx, topic, key, body, headers); err != nil {
-		s.logger.Error("failed to produce message",
-			zap.String("topic", topic),
-			zap.Error(err),
-		)
-		s.writeError(w, http.StatusInternalServerError, "produce_error", "failed to send message to kafka")
+	outcome, produceErr := s.deliver(produceCtx, r, req, requestID, message{
+		topic:   topic,
+		id:      messageID,
+		key:     key,
+		value:   value,
+		headers: headers,
+	})
+	switch outcome {
+	case auditQueueFull:
+		w.Header().Set("Retry-After", "1")
+		s.writeError(w, http.StatusServiceUnavailable, "queue_full",
+			fmt.Sprintf("produce queue for topic %q is full, retry later", topic))
+		return
+	case auditNotReady:
+		s.writeNotReady(w)
+		return
+	case auditDeadLettered:
+		s.loggerFor(r.Context()).Warn("webhook dead-lettered", append([]zap.Field{
+			zap.String("dead_letter_topic", s.deadLetter.Topic),
+		}, traceFields(span)...)...)
+		response := map[string]string{
+			"status":     "dead_lettered",
+			"topic":      topic,
+			"request_id": requestID,
+			"message_id": messageID,
+		}
+		idempotent.store(http.StatusAccepted, response)
+		s.writeJSON(w, http.StatusAccepted, response)
+		return
+	case auditFailed:
+		status, code, message := produceFailure(topic, produceErr)
+		s.writeError(w, status, code, message)
 		return
 	}
 
-	s.metrics.IncrementMessages()
-
-	requestID := w.Header().Get(RequestIDHeader)
+	if s.tail != nil {
+		s.tail.publish(TailEvent{
+			Time:        received.UTC(),
+			Topic:       topic,
+			MessageID:   messageID,
+			RequestID:   requestID,
+			Principal:   principal,
+			Key:         string(key),
+			ContentType: valueType,
+			Encoding:    encoding,
+			Size:        len(value),
+		}, value)
+	}
 
-	s.logger.Info("webhook received",
-		zap.String("topic", topic),
+	s.loggerFor(r.Context()).Info("webhook received", append([]zap.Field{
 		zap.Int("size", len(body)),
 		zap.String("remote_addr", r.RemoteAddr),
-		zap.String("request_id", requestID),
-	)
+	}, traceFields(span)...)...)
 
-	s.writeJSON(w, http.StatusAccepted, map[string]string{
+	response := map[string]string{
 		"status":     "accepted",
 		"topic":      topic,
 		"request_id": requestID,
-	})
+		"message_id": messageID,
+	}
+	idempotent.store(http.StatusAccepted, response)
+	s.writeJSON(w, http.StatusAccepted, response)
+}
+
+// webhookRequest is what admitWebhook establishes about a request before
+// its body is read.
+type webhookRequest struct {
+	principal string
+	country   string
+	exempt    bool
+
+	// release must be called once the request is handled.
+	release func()
+}
+
+// bodyLimit returns the largest body a webhook to topic may send.
+func (s *Server) bodyLimit(topic string) int64 {
+	if n := s.current().topics[topic].MaxBodyBytes; n > 0 {
+		return n
+	}
+	return s.maxBodyBytes
+}
+
+// admitWebhook runs the checks a request to topic, sent to path, must pass
+// before its body is read: method, authentication, routing, client
+// country, rate limits, and priority admission. On failure it writes the
+// error response and returns ok=false.
+func (s *Server) admitWebhook(w http.ResponseWriter, r *http.Request, path, topic string, route bool) (req webhookRequest, ok bool) {
+	req.release = func() {}
+	logctx.Add(r.Context(), zap.String("route", path), zap.String("topic", topic))
+	if r.Method != http.MethodPost {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only POST is allowed")
+		return req, false
+	}
+
+	rt := s.current()
+	principal, scope, ok := rt.auth.Authorize(r)
+	if !ok {
+		s.writeUnauthorized(w, r)
+		return req, false
+	}
+	rt.credentials.record(rolePublish, principal)
+	notePrincipal(r, principal)
+	req.principal = principal
+	logctx.Add(r.Context(), zap.String("tenant", tenant(principal)))
+
+	if s.strictRoutes && (!rt.allowedTopics[topic] || !route && rt.aliasedTopics[topic]) {
+		s.writeUnknownRoute(w, path)
+		return req, false
+	}
+
+	if topic == "" || !validTopicName.MatchString(topic) {
+		s.writeError(w, http.StatusBadRequest, "invalid_topic",
+			"topic must match [a-zA-Z0-9._-] and be 1-249 characters")
+		return req, false
+	}
+
+	if topic == "health" || topic == "ready" || topic == "metrics" {
+		s.writeError(w, http.StatusBadRequest, "reserved_topic", "cannot use reserved topic name")
+		return req, false
+	}
+
+	if len(rt.allowedTopics) > 0 && !rt.allowedTopics[topic] {
+		s.writeError(w, http.StatusForbidden, "topic_not_allowed",
+			fmt.Sprintf("topic %q is not in the allowed topics list", topic))
+		return req, false
+	}
+
+	if !route && rt.aliasedTopics[topic] {
+		s.writeError(w, http.StatusForbidden, "topic_not_allowed",
+			fmt.Sprintf("topic %q is only accepted at its route paths", topic))
+		return req, false
+	}
+
+	if !scope.Allows(topic) {
+		s.metrics.ScopeRejected.Add(1)
+		s.writeError(w, http.StatusForbidden, "topic_forbidden",
+			fmt.Sprintf("these credentials may not publish to topic %q", topic))
+		return req, false
+	}
+
+	if _, disabled := s.disabled.since(topic); disabled {
+		s.writeTopicDisabled(w, topic)
+		return req, false
+	}
+
+	if networks := rt.topics[topic].Networks; len(networks) > 0 {
+		addr, ok := s.clientIP.addr(r)
+		if !networksPermit(networks, addr, ok) {
+			s.metrics.NetworkRejected.Add(1)
+			s.writeError(w, http.StatusForbidden, "ip_not_allowed",
+				fmt.Sprintf("topic %q does not accept requests from this address", topic))
+			return req, false
+		}
+	}
+
+	req.country = s.clientCountry(r)
+	if !rt.topics[topic].Countries.permits(req.country) {
+		s.metrics.CountryRejected.Add(1)
+		s.writeError(w, http.StatusForbidden, "country_not_allowed",
+			fmt.Sprintf("topic %q does not accept requests from this location", topic))
+		return req, false
+	}
+
+	req.exempt = s.rateLimitExempt.exempt(r, principal, path, topic)
+	if req.exempt {
+		s.metrics.RateLimitExempt.Add(1)
+	} else if scope, retryAfter := s.admitRequest(topic, principal); scope != "" {
+		s.metrics.RecordThrottled(scope)
+		w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+		s.writeError(w, http.StatusTooManyRequests, "rate_limited",
+			fmt.Sprintf("%s request rate limit exceeded, retry later", scope))
+		return req, false
+	}
+
+	if s.errorBudgets != nil {
+		if ok, retryAfter := s.errorBudgets.admit(topic); !ok {
+			s.metrics.RecordThrottled(scopeErrorBudget)
+			w.Header().Set("Retry-After", retryAfterSeconds(retryAfter))
+			s.writeError(w, http.StatusTooManyRequests, "topic_throttled",
+				fmt.Sprintf("topic %q is throttled after repeated produce failures, retry later", topic))
+			return req, false
+		}
+	}
+
+	if s.consumerLag != nil && s.consumerLag.Lagging(topic) {
+		s.metrics.RecordThrottled(scopeConsumerLag)
+		w.Header().Set("Retry-After", retryAfterSeconds(s.consumerLag.Interval()))
+		s.writeError(w, http.StatusTooManyRequests, "consumer_lag",
+			fmt.Sprintf("consumers of topic %q are too far behind, retry later", topic))
+		return req, false
+	}
+
+	if s.priority != nil {
+		pri, ok := s.priority.priority(r, principal, rt.topics[topic].Priority)
+		if !ok {
+			s.writeError(w, http.StatusBadRequest, "invalid_priority",
+				fmt.Sprintf("%s must be high, normal, or low", s.priority.header))
+			return req, false
+		}
+		if !s.priority.admit(pri) {
+			s.metrics.RecordShed(pri)
+			w.Header().Set("Retry-After", "1")
+			s.writeError(w, http.StatusTooManyRequests, "load_shed",
+				fmt.Sprintf("shedding %s-priority webhooks under load, retry later", pri))
+			return req, false
+		}
+		req.release = s.priority.release
+	}
+	return req, true
 }
 
-// writeUnauthorized sends a 401 with the correct WWW-Authenticate header (RFC 7235).
-// It inspects the request's Authorization header to determine which challenge to send.
+// message is a Kafka message ready to produce.
+type message struct {
+	topic   string
+	id      string
+	key     []byte
+	value   []byte
+	headers map[string]string
+}
+
+// deliver produces m for the request req admitted, retrying and
+// dead-lettering it as configured, and records the attempt in metrics, the
+// audit log, and spans, and its delivery in receipts. It returns the
+// outcome, one of the audit outcomes, and for auditFailed the produce
+// error; only failures and dead-lettered messages are logged.
+func (s *Server) deliver(ctx context.Context, r *http.Request, req webhookRequest, requestID string, m message) (string, error) {
+	audit := s.audit.begin(requestID, req.principal, m.topic, m.id, m.key, len(m.value))
+	ctx, receipt := s.receipts.recorder(ctx)
+	produceStart := s.now()
+	err := s.produce(ctx, m.topic, m.key, m.value, m.headers)
+	if s.overload != nil {
+		s.overload.observe(err == nil)
+	}
+	if errors.Is(err, errQueueFull) {
+		s.endProduceSpan(r, m.topic, produceStart, len(m.value), 1, err)
+		s.audit.end(audit, auditQueueFull, 1, err)
+		s.metrics.QueueRejected.Add(1)
+		return auditQueueFull, nil
+	}
+	if unavailable(err) {
+		s.endProduceSpan(r, m.topic, produceStart, len(m.value), 1, err)
+		s.audit.end(audit, auditNotReady, 1, err)
+		return auditNotReady, nil
+	}
+	latency := s.now().Sub(produceStart)
+	s.metrics.RecordProduceLatency(latency, err == nil)
+	s.load.observe(latency)
+	attempts := 1
+	if err != nil && s.deadLetter.Retries > 0 {
+		retryCtx := r.Context()
+		if receipt != nil {
+			retryCtx = delivery.WithRecorder(retryCtx, receipt)
+		}
+		attempts, err = s.retryProduce(retryCtx, m.topic, m.key, m.value, m.headers, err)
+	}
+	s.endProduceSpan(r, m.topic, produceStart, len(m.value), attempts, err)
+	if s.errorBudgets != nil {
+		s.errorBudgets.observe(m.topic, err == nil)
+	}
+	if err != nil {
+		s.loggerFor(r.Context()).Error("failed to produce message",
+			zap.Int("attempts", attempts),
+			zap.Error(err),
+		)
+		if s.produceDeadLetter(r.Context(), m.topic, m.key, m.value, m.headers, attempts, err) {
+			s.audit.end(audit, auditDeadLettered, attempts, err)
+			return auditDeadLettered, nil
+		}
+		s.audit.end(audit, auditFailed, attempts, err)
+		switch {
+		case topicAuthorizationFailed(err):
+			s.metrics.ProduceForbidden.Add(1)
+		case unknownTopic(err):
+			s.metrics.ProduceTopicMissing.Add(1)
+		}
+		return auditFailed, err
+	}
+	s.audit.end(audit, auditProduced, attempts, nil)
+	s.receipts.issue(requestID, m, receipt)
+
+	s.metrics.RecordProduced(m.topic, len(m.key)+len(m.value))
+	if s.usage != nil {
+		s.usage.produced(req.principal, m.topic)
+	}
+	if s.geoip != nil {
+		s.metrics.RecordCountry(m.topic, req.country)
+	}
+	return auditProduced, nil
+}
+
+// encodePayload applies the topic's PayloadMode to body, returning the Kafka
+// message value and its Kahook-Payload-Encoding. PayloadJSONOnly bodies have
+// already been checked by contentViolation. On failure it writes the error
+// response and returns ok=false.
+func (s *Server) encodePayload(w http.ResponseWriter, topic, contentType string, body []byte) (value []byte, encoding string, ok bool) {
+	switch s.current().topics[topic].Payload {
+	case PayloadBase64:
+		if !isJSON(contentType, body) {
+			value, err := encodeBase64Envelope(contentType, body)
+			if err != nil {
+				s.writeError(w, http.StatusInternalServerError, "encode_error", "failed to encode payload")
+				return nil, "", false
+			}
+			return value, encodingBase64Envelope, true
+		}
+	}
+
+	return body, encodingRaw, true
+}
+
+// produce sends a message through the per-topic produce queue when one is
+// configured, or straight to the producer otherwise. In the dev profile it
+// also records the message for test console requests.
+func (s *Server) produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	var err error
+	if s.dispatcher != nil {
+		err = s.dispatcher.Produce(ctx, topic, key, value, headers)
+	} else {
+		err = s.producer.Produce(ctx, topic, key, value, headers)
+	}
+	s.recordProduceError(topic, err)
+	if s.devProfile {
+		captureProduced(ctx, topic, key, value, headers, err)
+	}
+	return err
+}
+
+// admitBandwidth charges n body bytes against the topic and principal
+// bandwidth buckets. Anonymous requests are only subject to the topic limit.
+// A request the principal bucket rejects gets its bytes back from the topic
+// bucket, so one principal over its limit cannot use up a shared topic.
+func (s *Server) admitBandwidth(topic, principal string, n int) (bool, time.Duration) {
+	rt := s.current()
+	if rt.topicBandwidth != nil {
+		if ok, wait := rt.topicBandwidth.AllowN(topic, float64(n)); !ok {
+			return false, wait
+		}
+	}
+	if rt.principalBandwidth != nil && principal != "" {
+		if ok, wait := rt.principalBandwidth.AllowN(principal, float64(n)); !ok {
+			if rt.topicBandwidth != nil {
+				rt.topicBandwidth.Refund(topic, float64(n))
+			}
+			return false, wait
+		}
+	}
+	return true, 0
+}
+
+// retryAfterSeconds formats d as a Retry-After value, rounding up to whole
+// seconds so clients never retry early.
+func retryAfterSeconds(d time.Duration) string {
+	secs := int64(math.Ceil(d.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	return strconv.FormatInt(secs, 10)
+}
+
+// writeUnknownRoute sends the strict-mode 404, listing close matches from the
+// configured topics and route paths when running in the dev profile.
+func (s *Server) writeUnknownRoute(w http.ResponseWriter, topic string) {
+	if s.terseErrors {
+		s.writeError(w, http.StatusNotFound, "unknown_route", "")
+		return
+	}
+	resp := ErrorResponse{
+		Error:   "unknown_route",
+		Message: fmt.Sprintf("no route configured for topic %q", topic),
+	}
+	if s.devProfile {
+		rt := s.current()
+		known := rt.allowedTopics
+		if len(rt.routePaths) > 0 {
+			known = make(map[string]bool, len(rt.allowedTopics)+len(rt.routePaths))
+			for t := range rt.allowedTopics {
+				if !rt.aliasedTopics[t] {
+					known[t] = true
+				}
+			}
+			for p := range rt.routePaths {
+				known[p] = true
+			}
+		}
+		resp.Suggestions = suggestTopics(topic, known)
+	}
+	s.writeJSON(w, http.StatusNotFound, resp)
+}
+
+// writeUnauthorized sends a 401 with the WWW-Authenticate header (RFC 7235)
+// selected by the configured challenge. In ChallengeAuto mode it inspects the
+// request's Authorization header to determine which challenge to send.
 func (s *Server) writeUnauthorized(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	parts := strings.SplitN(authHeader, " ", 2)
+	challenge := s.authChallenge
+	if challenge == "" || challenge == ChallengeAuto {
+		authHeader := r.Header.Get("Authorization")
+		parts := strings.SplitN(authHeader, " ", 2)
+
+		scheme := ""
+		if len(parts) >= 1 {
+			scheme = strings.ToLower(parts[0])
+		}
 
-	scheme := ""
-	if len(parts) >= 1 {
-		scheme = strings.ToLower(parts[0])
+		switch scheme {
+		case "bearer":
+			challenge = ChallengeBearer
+		default:
+			// Default to Basic challenge — covers "basic", empty header, and unknown schemes.
+			challenge = ChallengeBasic
+		}
 	}
 
-	switch scheme {
-	case "bearer":
-		w.Header().Set("WWW-Authenticate", `Bearer realm="kahook"`)
-	default:
-		// Default to Basic challenge — covers "basic", empty header, and unknown schemes.
-		w.Header().Set("WWW-Authenticate", `Basic realm="kahook"`)
+	switch challenge {
+	case ChallengeBearer:
+		w.Header().Set("WWW-Authenticate", "Bearer realm="+s.authRealm)
+	case ChallengeBasic:
+		w.Header().Set("WWW-Authenticate", "Basic realm="+s.authRealm)
+	case ChallengeNone:
+		// No challenge, so browsers do not show a login prompt.
 	}
 	s.writeError(w, http.StatusUnauthorized, "unauthorized", "invalid or missing credentials")
 }
 
+// writeNotReady rejects a message the producer could not take yet.
+func (s *Server) writeNotReady(w http.ResponseWriter) {
+	s.metrics.NotReadyRejected.Add(1)
+	w.Header().Set("Retry-After", "5")
+	s.writeError(w, http.StatusServiceUnavailable, "not_ready", "kafka producer not available yet, retry later")
+}
+
 func (s *Server) writeError(w http.ResponseWriter, code int, errorType, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(ErrorResponse{
+	if s.terseErrors {
+		message = http.StatusText(code)
+	}
+	s.writeJSON(w, code, ErrorResponse{
 		Error:   errorType,
 		Message: message,
 	})
 }
 
+// writeJSON writes v as JSON, or in the negotiated format when w is a
+// webhook response with another, signed when webhook responses are.
 func (s *Server) writeJSON(w http.ResponseWriter, code int, v any) {
+	if fw, ok := w.(*formatWriter); ok {
+		if err := fw.write(code, v); err != nil {
+			s.logger.Error("failed to sign response", zap.Error(err))
+		}
+		return
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(code)
 	_ = json.NewEncoder(w).Encode(v)
 }
-
-func isInternalHeader(key string) bool {
-	return internalHeaders[strings.ToLower(key)]
-}
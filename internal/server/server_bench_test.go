@@ -0,0 +1,109 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+)
+
+// Run with: make bench, or
+//
+//	go test -run '^$' -bench . -benchmem -cpuprofile cpu.out -memprofile mem.out ./internal/server
+//
+// and inspect the profiles with go tool pprof. ReadAll is the pre-pooling way
+// of reading the body and is kept as a baseline for ReadBody.
+
+var bodyBenchSizes = []int{512, 8 << 10, 128 << 10, 1 << 20}
+
+// discardProducer accepts every message without copying it, so handler
+// benchmarks measure the server rather than the mock.
+type discardProducer struct{}
+
+func (discardProducer) Produce(context.Context, string, []byte, []byte, map[string]string) error {
+	return nil
+}
+func (discardProducer) IsConnected() bool { return true }
+func (discardProducer) Close()            {}
+
+func BenchmarkReadBody_ReadAll(b *testing.B) {
+	for _, size := range bodyBenchSizes {
+		body := bytes.Repeat([]byte("x"), size)
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := io.ReadAll(bytes.NewReader(body)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadBody_Pooled(b *testing.B) {
+	for _, size := range bodyBenchSizes {
+		body := bytes.Repeat([]byte("x"), size)
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				buf, err := bodyBuffers.readBody(bytes.NewReader(body), int64(size), defaultMaxBodyBytes)
+				if err != nil {
+					b.Fatal(err)
+				}
+				bodyBuffers.put(buf)
+			}
+		})
+	}
+}
+
+func BenchmarkMessageHeaders(b *testing.B) {
+	h := http.Header{
+		"Authorization":     {"Bearer token"},
+		"Content-Type":      {"application/json"},
+		"Content-Length":    {"512"},
+		"User-Agent":        {"GitHub-Hookshot/abc123"},
+		"Accept":            {"*/*"},
+		"X-Github-Event":    {"push"},
+		"X-Github-Delivery": {"72d3162e-cc78-11e3-81ab-4c9367dc0958"},
+		"X-Hub-Signature":   {"sha256=deadbeef"},
+		"X-Request-Id":      {"req-1"},
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		putHeaderMap(forwardedHeaders.messageHeaders(h))
+	}
+}
+
+func BenchmarkWebhookHandler(b *testing.B) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: discardProducer{},
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+	})
+	for _, size := range bodyBenchSizes[:3] {
+		body := bytes.Repeat([]byte("x"), size)
+		b.Run(fmt.Sprintf("%dB", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/events", bytes.NewReader(body))
+				req.Header.Set("Content-Type", "text/plain")
+				w := httptest.NewRecorder()
+				srv.webhookHandler(w, req)
+				if w.Code != http.StatusAccepted {
+					b.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+				}
+			}
+		})
+	}
+}
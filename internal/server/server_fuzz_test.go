@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+)
+
+// Run with: make fuzz, or
+//
+//	go test -run '^$' -fuzz FuzzWebhookHandler -fuzztime 1m ./internal/server
+//
+// Without -fuzz the seed corpus runs as a normal test. Inputs that fail are
+// saved under testdata/fuzz and replayed by every later go test run.
+
+// fuzzServers are built the way a deployment would configure kahook, one
+// lenient and one strict, so every input runs through topic validation,
+// routes, payload modes and content type checks.
+func fuzzServers(producer KafkaProducer) []*Server {
+	topics := map[string]TopicOptions{
+		"orders":  {Payload: PayloadJSONOnly},
+		"uploads": {Payload: PayloadBase64},
+	}
+	routes := map[string]string{"hooks/github": "github"}
+	return []*Server{
+		NewServer(ServerConfig{
+			Port:         8080,
+			Producer:     producer,
+			Auth:         auth.NewMultiAuth(nil, nil),
+			Logger:       zap.NewNop(),
+			Topics:       topics,
+			RoutePaths:   routes,
+			ScannerPaths: []string{"/.env", "/wp-admin"},
+		}),
+		NewServer(ServerConfig{
+			Port:              8080,
+			Producer:          producer,
+			Auth:              auth.NewMultiAuth(nil, []string{"token"}),
+			Logger:            zap.NewNop(),
+			AllowedTopics:     []string{"orders", "uploads", "events", "github"},
+			StrictRoutes:      true,
+			StrictContentType: true,
+			Topics:            topics,
+			RoutePaths:        routes,
+		}),
+	}
+}
+
+func FuzzWebhookHandler(f *testing.F) {
+	seeds := []struct {
+		path, contentType, header, value string
+		body                             []byte
+	}{
+		{"/events", "application/json", "X-Github-Event", "push", []byte(`{"a":1}`)},
+		{"/orders", "application/json; charset=utf-8", "Authorization", "Bearer token", []byte(`{"id":1}`)},
+		{"/orders", "application/json", "Authorization", "Bearer token", []byte(`{"id":`)},
+		{"/uploads", "image/png", "", "", []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}},
+		{"/hooks/github", "application/json", "X-Hub-Signature-256", "sha256=00", []byte(`[]`)},
+		{"/", "", "", "", nil},
+		{"//", "text/plain", "X-Request-ID", strings.Repeat("r", 512), []byte("x")},
+		{"/../../etc/passwd", "application/json", "X-Forwarded-For", "not-an-ip, ::ffff:", []byte(`{}`)},
+		{"/topic\x00name", "application/json; charset=\"", "Content-Encoding", "gzip", []byte(`{}`)},
+		{"/" + strings.Repeat("t", 250), ";;;", "Authorization", "Basic !!!", []byte(`{}`)},
+		{"/.env/../orders", "multipart/form-data; boundary=", "", "", []byte("--\r\n")},
+		{"/health", "application/json", "Kahook-Country", "ZZ", []byte(`{}`)},
+		{"/orders", "application/json", "Accept", "text/plain;q=0.9, application/*;q=bad", []byte(`{}`)},
+		{"/events", "application/cloudevents+json", "X-Kahook-Encoding", "base64", bytes.Repeat([]byte("["), 10000)},
+	}
+	for _, s := range seeds {
+		f.Add(s.path, s.contentType, s.header, s.value, s.body)
+	}
+
+	producer := &mockProducer{isHealthy: true}
+	servers := fuzzServers(producer)
+
+	f.Fuzz(func(t *testing.T, path, contentType, header, value string, body []byte) {
+		for _, srv := range servers {
+			producer.value = nil
+
+			// Build the request directly: the fuzzed path and headers need not
+			// survive URL parsing or header validation in net/http.
+			req := &http.Request{
+				Method:        http.MethodPost,
+				URL:           &url.URL{Path: path},
+				RequestURI:    path,
+				Proto:         "HTTP/1.1",
+				ProtoMajor:    1,
+				ProtoMinor:    1,
+				Header:        make(http.Header),
+				Body:          io.NopCloser(bytes.NewReader(body)),
+				ContentLength: int64(len(body)),
+				RemoteAddr:    "192.0.2.1:1234",
+				Host:          "kahook.test",
+			}
+			req.Header.Set("Content-Type", contentType)
+			if header != "" {
+				req.Header[header] = []string{value}
+			}
+
+			w := httptest.NewRecorder()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				srv.Handler().ServeHTTP(w, req)
+			}()
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("handler hung on POST %q", path)
+			}
+
+			if w.Code < 200 || w.Code >= 500 {
+				t.Fatalf("POST %q: status = %d: %s", path, w.Code, w.Body)
+			}
+			// Accept may negotiate text; anything labelled JSON must be JSON.
+			if w.Header().Get("Content-Type") == "application/json" && !json.Valid(w.Body.Bytes()) {
+				t.Fatalf("POST %q: response is not JSON: %q", path, w.Body)
+			}
+			if w.Code == http.StatusAccepted && producer.value == nil {
+				t.Fatalf("POST %q: accepted without producing", path)
+			}
+		}
+	})
+}
@@ -1,26 +1,75 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 
 	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/delivery"
+	"github.com/kahook/internal/fixture"
+	"github.com/kahook/internal/jsonschema"
+	"github.com/kahook/internal/jws"
+	"github.com/kahook/internal/keyexpr"
+	"github.com/kahook/internal/lag"
+	"github.com/kahook/internal/otlp"
+	"github.com/kahook/internal/proxyproto"
+	"github.com/kahook/internal/ratelimit"
+	"github.com/kahook/internal/redact"
+	"github.com/kahook/internal/signature"
+	"github.com/kahook/internal/transform"
+	"github.com/kahook/internal/upcast"
 )
 
 // mockProducer satisfies the KafkaProducer interface for testing.
 type mockProducer struct {
 	produceErr error
 	isHealthy  bool
+
+	// Last produced message, for assertions.
+	topic   string
+	key     []byte
+	value   []byte
+	headers map[string]string
 }
 
-func (m *mockProducer) Produce(_ context.Context, _ string, _, _ []byte, _ map[string]string) error {
+func (m *mockProducer) Produce(_ context.Context, topic string, key, value []byte, headers map[string]string) error {
+	// Copy everything: the server recycles the body buffer and headers map
+	// once Produce returns.
+	m.topic, m.key, m.value, m.headers = topic, bytes.Clone(key), bytes.Clone(value), maps.Clone(headers)
 	return m.produceErr
 }
 
@@ -89,6 +138,46 @@ func TestHealthHandler_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestProbeAuth(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(map[string]string{"admin": "secret"}, nil),
+		Logger:   zap.NewNop(),
+		Probes: ProbeAccess{
+			Auth:           true,
+			BypassNetworks: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("169.254.0.0/16")},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		basicAuth  bool
+		want       int
+	}{
+		{"kubelet range", "10.1.2.3:5000", false, http.StatusOK},
+		{"link-local", "169.254.1.1:5000", false, http.StatusOK},
+		{"ipv4-mapped kubelet", "[::ffff:10.1.2.3]:5000", false, http.StatusOK},
+		{"outside, anonymous", "203.0.113.7:5000", false, http.StatusUnauthorized},
+		{"outside, authenticated", "203.0.113.7:5000", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		for path, handler := range map[string]http.HandlerFunc{"/health": srv.healthHandler, "/ready": srv.readyHandler} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.basicAuth {
+				req.SetBasicAuth("admin", "secret")
+			}
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if w.Code != tt.want {
+				t.Errorf("%s: GET %s = %d, want %d", tt.name, path, w.Code, tt.want)
+			}
+		}
+	}
+}
+
 // -------------------------------------------------------------------
 // /ready
 // -------------------------------------------------------------------
@@ -181,6 +270,61 @@ func TestMetricsHandler_NoneAuth(t *testing.T) {
 	}
 }
 
+func TestMetricsHandler_MetricsTokens(t *testing.T) {
+	tests := []struct {
+		name       string
+		publish    *auth.MultiAuth
+		authz      string
+		wantStatus int
+	}{
+		{"metrics token", auth.NewMultiAuth(nil, []string{"publish"}), "Bearer scrape", http.StatusOK},
+		{"publish token", auth.NewMultiAuth(nil, []string{"publish"}), "Bearer publish", http.StatusOK},
+		{"wrong token", auth.NewMultiAuth(nil, []string{"publish"}), "Bearer nope", http.StatusUnauthorized},
+		{"anonymous without publish auth", auth.NewMultiAuth(nil, nil), "", http.StatusUnauthorized},
+		{"metrics token without publish auth", auth.NewMultiAuth(nil, nil), "Bearer scrape", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				Port:        8080,
+				Producer:    &mockProducer{isHealthy: true},
+				Auth:        tt.publish,
+				MetricsAuth: auth.NewBearerAuth([]string{"scrape"}),
+				Logger:      zap.NewNop(),
+			})
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authz != "" {
+				req.Header.Set("Authorization", tt.authz)
+			}
+			w := httptest.NewRecorder()
+			srv.metricsHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_MetricsTokenCannotPublish(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:        8080,
+		Producer:    &mockProducer{isHealthy: true},
+		Auth:        auth.NewMultiAuth(nil, []string{"publish"}),
+		MetricsAuth: auth.NewBearerAuth([]string{"scrape"}),
+		Logger:      zap.NewNop(),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer scrape")
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
+
 func TestMetricsHandler_MethodNotAllowed(t *testing.T) {
 	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true})
 
@@ -193,6 +337,76 @@ func TestMetricsHandler_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestMetricsHandler_Prometheus(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		accept   string
+		wantProm bool
+	}{
+		{"default", "/metrics", "", false},
+		{"browser", "/metrics", "text/html,application/xhtml+xml,*/*;q=0.8", false},
+		{"plain text", "/metrics", "text/plain", false},
+		{"format param", "/metrics?format=prometheus", "", true},
+		{"prometheus scraper", "/metrics", "application/openmetrics-text;version=1.0.0;q=0.5,text/plain;version=0.0.4;q=0.3,*/*;q=0.1", true},
+		{"text format 0.0.4", "/metrics", "text/plain; version=0.0.4", true},
+		{"format=json wins", "/metrics?format=json", "text/plain;version=0.0.4", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true})
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			srv.metricsHandler(w, req)
+
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+			}
+			gotProm := w.Header().Get("Content-Type") == prometheusContentType
+			if gotProm != tt.wantProm {
+				t.Fatalf("Content-Type = %q, want Prometheus = %v", w.Header().Get("Content-Type"), tt.wantProm)
+			}
+			if gotProm && !strings.Contains(w.Body.String(), "# TYPE kahook_requests_total counter\nkahook_requests_total 0\n") {
+				t.Errorf("body does not contain kahook_requests_total:\n%s", w.Body.String())
+			}
+			if w.Header().Get("Vary") != "Accept" {
+				t.Errorf("Vary = %q, want %q", w.Header().Get("Vary"), "Accept")
+			}
+		})
+	}
+}
+
+func TestWritePrometheus_Labels(t *testing.T) {
+	snap := MetricsResponse{
+		RequestsTotal: 3,
+		Topics: map[string]TopicMetricsResponse{
+			"orders": {MessagesProduced: 2, Countries: map[string]int64{"DE": 2}},
+		},
+		BrokerEvents: map[string]int64{"a\"b\\c\nd": 1},
+	}
+	var buf strings.Builder
+	if err := writePrometheus(&buf, snap, time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("writePrometheus() error = %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"kahook_start_time_seconds 1.7e+09\n",
+		"kahook_requests_total 3\n",
+		`kahook_topic_messages_produced_total{topic="orders"} 2` + "\n",
+		`kahook_topic_country_messages_total{topic="orders",country="DE"} 2` + "\n",
+		`kahook_broker_events_total{kind="a\"b\\c\nd"} 1` + "\n",
+		`kahook_body_size_bytes_count 0` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
 // -------------------------------------------------------------------
 // webhookHandler — method
 // -------------------------------------------------------------------
@@ -300,6 +514,55 @@ func TestWebhookHandler_Authentication(t *testing.T) {
 	}
 }
 
+func TestWriteUnauthorized_Challenge(t *testing.T) {
+	tests := []struct {
+		challenge string
+		realm     string
+		authz     string
+		want      string
+	}{
+		{"", "", "", `Basic realm="kahook"`},
+		{ChallengeAuto, "", "Bearer wrong", `Bearer realm="kahook"`},
+		{ChallengeBearer, "webhooks", "", `Bearer realm="webhooks"`},
+		{ChallengeBasic, "", "Bearer wrong", `Basic realm="kahook"`},
+		{ChallengeBasic, `say "hi"`, "", `Basic realm="say \"hi\""`},
+		{ChallengeNone, "webhooks", "Basic x", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.challenge+"/"+tt.authz, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				Port:          8080,
+				Producer:      &mockProducer{isHealthy: true},
+				Auth:          auth.NewMultiAuth(nil, []string{"token123"}),
+				Logger:        zap.NewNop(),
+				AuthRealm:     tt.realm,
+				AuthChallenge: tt.challenge,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`))
+			if tt.authz != "" {
+				req.Header.Set("Authorization", tt.authz)
+			}
+			w := httptest.NewRecorder()
+			srv.webhookHandler(w, req)
+
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+			}
+			got, present := w.Header()["Www-Authenticate"]
+			if tt.want == "" {
+				if present {
+					t.Errorf("WWW-Authenticate = %q, want none", got)
+				}
+				return
+			}
+			if w.Header().Get("WWW-Authenticate") != tt.want {
+				t.Errorf("WWW-Authenticate = %q, want %q", w.Header().Get("WWW-Authenticate"), tt.want)
+			}
+		})
+	}
+}
+
 // -------------------------------------------------------------------
 // webhookHandler — topic validation
 // -------------------------------------------------------------------
@@ -406,8 +669,8 @@ func TestWebhookHandler_EmptyBody(t *testing.T) {
 func TestWebhookHandler_BodyTooLarge(t *testing.T) {
 	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true})
 
-	// Send a body that exceeds maxBodyBytes (1 MiB).
-	oversized := strings.Repeat("x", maxBodyBytes+1)
+	// Send a body that exceeds defaultMaxBodyBytes (1 MiB).
+	oversized := strings.Repeat("x", defaultMaxBodyBytes+1)
 	req := httptest.NewRequest(http.MethodPost, "/test-topic", strings.NewReader(oversized))
 	w := httptest.NewRecorder()
 
@@ -424,6 +687,35 @@ func TestWebhookHandler_BodyTooLarge(t *testing.T) {
 	}
 }
 
+func TestWebhookHandler_TopicBodyLimit(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     &mockProducer{isHealthy: true},
+		Auth:         auth.NewMultiAuth(nil, nil),
+		Logger:       zap.NewNop(),
+		MaxBodyBytes: 64,
+		Topics:       map[string]TopicOptions{"audit-uploads": {MaxBodyBytes: 2 * defaultMaxBodyBytes}},
+	})
+	send := func(topic string, size int) (int, string) {
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(strings.Repeat("x", size))))
+		return w.Code, w.Body.String()
+	}
+
+	if code, body := send("orders", 65); code != http.StatusRequestEntityTooLarge || !strings.Contains(body, "maximum size of 64 bytes") {
+		t.Errorf("orders: status = %d, body = %s, want 413 at the server limit", code, body)
+	}
+	if code, _ := send("orders", 64); code != http.StatusAccepted {
+		t.Errorf("orders: status = %d for a body at the limit, want 202", code)
+	}
+	if code, _ := send("audit-uploads", defaultMaxBodyBytes+1); code != http.StatusAccepted {
+		t.Errorf("audit-uploads: status = %d above the default limit, want 202", code)
+	}
+	if code, _ := send("audit-uploads", 2*defaultMaxBodyBytes+1); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("audit-uploads: status = %d above the topic limit, want 413", code)
+	}
+}
+
 // -------------------------------------------------------------------
 // webhookHandler — success
 // -------------------------------------------------------------------
@@ -453,6 +745,52 @@ func TestWebhookHandler_Success(t *testing.T) {
 	}
 }
 
+func TestWebhookHandler_IDs(t *testing.T) {
+	var n int
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		NewID: func() string {
+			n++
+			return "id-" + strconv.Itoa(n)
+		},
+	})
+
+	send := func(requestID string) (*httptest.ResponseRecorder, map[string]string) {
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`))
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var resp map[string]string
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("response is not JSON: %v", err)
+		}
+		return w, resp
+	}
+
+	w, resp := send("")
+	if got := w.Header().Get(RequestIDHeader); got != "id-1" || resp["request_id"] != "id-1" {
+		t.Errorf("generated request ID = %q (response %q), want id-1", got, resp["request_id"])
+	}
+	if got := producer.headers[messageIDHeader]; got != "id-2" || resp["message_id"] != "id-2" {
+		t.Errorf("%s = %q (response %q), want id-2", messageIDHeader, got, resp["message_id"])
+	}
+
+	// A client's request ID is kept; the message still gets a new ID.
+	w, resp = send("client-id")
+	if got := w.Header().Get(RequestIDHeader); got != "client-id" {
+		t.Errorf("request ID = %q, want the client's", got)
+	}
+	if got := producer.headers[messageIDHeader]; got != "id-3" || resp["message_id"] != "id-3" {
+		t.Errorf("%s = %q, want id-3", messageIDHeader, got)
+	}
+}
+
 // -------------------------------------------------------------------
 // NewServer — via ServerConfig (producer interface injection)
 // -------------------------------------------------------------------
@@ -472,6 +810,46 @@ func TestNewServer_UsesInterface(t *testing.T) {
 	}
 }
 
+func TestNewServer_Clock(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	clock := func() time.Time { return now }
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		RequestRate: RequestRates{
+			Global: ratelimit.NewLimiter(ratelimit.Limit{Rate: 1, Burst: 1}, nil).WithClock(clock),
+		},
+		ClockOffset: func() (time.Duration, bool) { return 0, true },
+		Now:         clock,
+	})
+	send := func() int {
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`)))
+		return w.Code
+	}
+
+	if code := send(); code != http.StatusAccepted {
+		t.Fatalf("first request status = %d, want %d", code, http.StatusAccepted)
+	}
+	if got, want := producer.headers[receivedAtHeader], now.UTC().Format(time.RFC3339Nano); got != want {
+		t.Errorf("%s = %q, want the injected time %q", receivedAtHeader, got, want)
+	}
+	if code := send(); code != http.StatusTooManyRequests {
+		t.Errorf("second request status = %d, want %d while the clock stands still", code, http.StatusTooManyRequests)
+	}
+
+	now = now.Add(time.Second)
+	if code := send(); code != http.StatusAccepted {
+		t.Errorf("status a second later = %d, want %d", code, http.StatusAccepted)
+	}
+	if got := newMetricsSnapshot(srv.metrics).Uptime; got != "1s" {
+		t.Errorf("uptime = %q, want 1s", got)
+	}
+}
+
 // -------------------------------------------------------------------
 // isInternalHeader
 // -------------------------------------------------------------------
@@ -501,3 +879,5418 @@ func TestIsInternalHeader(t *testing.T) {
 		})
 	}
 }
+
+func TestHeaderFilter_MessageHeaders(t *testing.T) {
+	h := http.Header{
+		"Authorization":  {"Bearer secret"},
+		"X-Github-Event": {"push", "ignored"},
+		"x-raw-key":      {"set directly"},
+		"content-type":   {"application/json"},
+		"X-Empty":        {},
+	}
+
+	got := forwardedHeaders.messageHeaders(h)
+	defer putHeaderMap(got)
+
+	want := map[string]string{"X-Github-Event": "push", "x-raw-key": "set directly"}
+	if !maps.Equal(got, want) {
+		t.Errorf("messageHeaders = %v, want %v", got, want)
+	}
+}
+
+func TestPutHeaderMap_ClearsAndBoundsPooledMaps(t *testing.T) {
+	m := map[string]string{"X-A": "1"}
+	putHeaderMap(m)
+	if len(m) != 0 {
+		t.Errorf("pooled map still has %d entries", len(m))
+	}
+
+	big := make(map[string]string, maxPooledHeaders+1)
+	for i := 0; i <= maxPooledHeaders; i++ {
+		big["X-"+strconv.Itoa(i)] = "v"
+	}
+	putHeaderMap(big)
+	if len(big) != maxPooledHeaders+1 {
+		t.Error("oversized map was cleared and pooled, want it dropped")
+	}
+}
+
+// -------------------------------------------------------------------
+// Metrics — byte throughput and body size histogram
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_RecordsByteMetrics(t *testing.T) {
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true})
+
+	payload := `{"event": "test"}`
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(payload))
+	req.Header.Set("X-Webhook-Key", "k1")
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.BytesReceived != int64(len(payload)) {
+		t.Errorf("BytesReceived = %d, want %d", snap.BytesReceived, len(payload))
+	}
+	if snap.BytesProduced != int64(len(payload)+2) {
+		t.Errorf("BytesProduced = %d, want %d (key + value)", snap.BytesProduced, len(payload)+2)
+	}
+
+	topic, ok := snap.Topics["orders"]
+	if !ok {
+		t.Fatal("expected per-topic metrics for \"orders\"")
+	}
+	if topic.MessagesProduced != 1 || topic.BytesReceived != int64(len(payload)) {
+		t.Errorf("topic metrics = %+v", topic)
+	}
+
+	if snap.BodySizeHistogram.Count != 1 {
+		t.Errorf("histogram count = %d, want 1", snap.BodySizeHistogram.Count)
+	}
+	// A 17-byte body lands in the first (256 B) bucket and every bucket after it.
+	for _, b := range snap.BodySizeHistogram.Buckets {
+		if b.Count != 1 {
+			t.Errorf("bucket le=%s count = %d, want 1", b.LE, b.Count)
+		}
+	}
+}
+
+func TestWebhookHandler_FailedProduceCountsReceivedOnly(t *testing.T) {
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true, produceErr: context.DeadlineExceeded})
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.BytesReceived != 2 || snap.BytesProduced != 0 {
+		t.Errorf("received=%d produced=%d, want 2 and 0", snap.BytesReceived, snap.BytesProduced)
+	}
+}
+
+func TestWebhookHandler_BoundsTopicMetrics(t *testing.T) {
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true})
+	srv.Reload(Reloadable{
+		Auth:   auth.NewMultiAuth(nil, nil),
+		Topics: map[string]TopicOptions{"orders": {}},
+	})
+
+	post := func(topic string) {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("POST /%s status = %d, want %d", topic, w.Code, http.StatusAccepted)
+		}
+	}
+	for i := 0; i < maxUnlistedTopics+5; i++ {
+		post(fmt.Sprintf("spam-%d", i))
+	}
+	post("orders")
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if len(snap.Topics) != maxUnlistedTopics+2 {
+		t.Errorf("topics counted = %d, want %d", len(snap.Topics), maxUnlistedTopics+2)
+	}
+	if got := snap.Topics[OtherTopics].MessagesProduced; got != 5 {
+		t.Errorf("%s messages = %d, want 5", OtherTopics, got)
+	}
+	if got := snap.Topics["orders"].MessagesProduced; got != 1 {
+		t.Errorf("configured topic messages = %d, want 1 past the cap", got)
+	}
+}
+
+// notReadyError mimics kafka.ErrNotReady, returned while a lazily created
+// producer is still connecting.
+type notReadyError struct{}
+
+func (notReadyError) Error() string     { return "producer is not ready yet" }
+func (notReadyError) Unavailable() bool { return true }
+
+func TestWebhookHandler_ProducerNotReady(t *testing.T) {
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{produceErr: fmt.Errorf("produce: %w", notReadyError{})})
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got := w.Header().Get("Retry-After"); got == "" {
+		t.Error("missing Retry-After")
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error != "not_ready" {
+		t.Errorf("error = %q (%v), want not_ready", resp.Error, err)
+	}
+	if n := srv.metrics.NotReadyRejected.Load(); n != 1 {
+		t.Errorf("not_ready_rejected = %d, want 1", n)
+	}
+}
+
+// topicError mimics the kafka package's errors for a topic the producer may
+// not write to, or that does not exist.
+type topicError struct{ forbidden bool }
+
+func (e topicError) Error() string                  { return "broker: topic error" }
+func (e topicError) TopicAuthorizationFailed() bool { return e.forbidden }
+func (e topicError) UnknownTopic() bool             { return !e.forbidden }
+
+func TestWebhookHandler_TopicErrors(t *testing.T) {
+	tests := []struct {
+		name               string
+		err                error
+		wantStatus         int
+		wantCode           string
+		forbidden, missing int64
+	}{
+		{"authorization failed", topicError{forbidden: true}, http.StatusForbidden, "topic_authorization_failed", 1, 0},
+		{"unknown topic", topicError{}, http.StatusNotFound, "topic_not_found", 0, 1},
+		{"outage", errors.New("broker: request timed out"), http.StatusInternalServerError, "produce_error", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true, produceErr: fmt.Errorf("message delivery failed: %w", tt.err)})
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+			w := httptest.NewRecorder()
+			srv.webhookHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error != tt.wantCode {
+				t.Errorf("error = %q (%v), want %s", resp.Error, err, tt.wantCode)
+			}
+			if n := srv.metrics.ProduceForbidden.Load(); n != tt.forbidden {
+				t.Errorf("produce_forbidden = %d, want %d", n, tt.forbidden)
+			}
+			if n := srv.metrics.ProduceTopicMissing.Load(); n != tt.missing {
+				t.Errorf("produce_topic_missing = %d, want %d", n, tt.missing)
+			}
+		})
+	}
+}
+
+func TestLoggingMiddleware_SeparatesClientAndServerErrors(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.New(core),
+	})
+	h := srv.Handler()
+
+	send := func(body string) {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body)))
+	}
+	send(`{}`) // 202
+	send(``)   // 400 empty_body
+	send(``)
+	producer.produceErr = context.DeadlineExceeded
+	send(`{}`) // 500 produce_error
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.RequestsSuccess != 1 || snap.ClientErrors != 2 || snap.ServerErrors != 1 || snap.RequestsError != 3 {
+		t.Errorf("success=%d client=%d server=%d error=%d, want 1, 2, 1, 3",
+			snap.RequestsSuccess, snap.ClientErrors, snap.ServerErrors, snap.RequestsError)
+	}
+
+	requests := logs.FilterMessage("request")
+	if n := requests.FilterLevelExact(zap.WarnLevel).Len(); n != 1 {
+		t.Errorf("%d requests logged at warn, want only the 500", n)
+	}
+	if n := requests.FilterLevelExact(zap.InfoLevel).Len(); n != 3 {
+		t.Errorf("%d requests logged at info, want 3", n)
+	}
+}
+
+func TestLoggingMiddleware_RequestLogFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(map[string]string{"alice": "pw"}, nil),
+		Logger:   zap.New(core),
+		RequestLog: RequestLog{
+			Query:       true,
+			UserAgent:   true,
+			Principal:   true,
+			Headers:     []string{"x-tenant", "Authorization"},
+			SampleRatio: 0.0001,
+		},
+	})
+	send := func(user string) {
+		req := httptest.NewRequest(http.MethodPost, "/orders?source=shop", strings.NewReader(`{}`))
+		req.SetBasicAuth(user, "pw")
+		req.Header.Set("User-Agent", "shop/2.0")
+		req.Header.Set("X-Tenant", "acme")
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	// Successful requests are all but certainly sampled out; the 401 is
+	// always logged.
+	for i := 0; i < 3; i++ {
+		send("alice")
+	}
+	send("mallory")
+
+	requests := logs.FilterMessage("request").All()
+	if len(requests) != 1 {
+		t.Fatalf("logged %d requests, want only the 401", len(requests))
+	}
+	fields := requests[0].ContextMap()
+	want := map[string]any{
+		"status":               int64(http.StatusUnauthorized),
+		"query":                "source=shop",
+		"user_agent":           "shop/2.0",
+		"header.x-tenant":      "acme",
+		"header.authorization": redact.Placeholder,
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %v, want %v", k, fields[k], v)
+		}
+	}
+	if _, ok := fields["principal"]; ok {
+		t.Error("principal logged for an unauthenticated request")
+	}
+
+	logs.TakeAll()
+	srv.requestLog.cfg.SampleRatio = 0
+	send("alice")
+	if got := logs.FilterMessage("request").All(); len(got) != 1 || got[0].ContextMap()["principal"] != "alice" {
+		t.Errorf("logged %v, want one request from alice", got)
+	}
+}
+
+func TestLoggingMiddleware_CommonLogFormat(t *testing.T) {
+	var out bytes.Buffer
+	srv := NewServer(ServerConfig{
+		Port:       8080,
+		Producer:   &mockProducer{isHealthy: true},
+		Auth:       auth.NewMultiAuth(map[string]string{"alice": "pw"}, nil),
+		Logger:     zap.NewNop(),
+		RequestLog: RequestLog{Format: RequestLogCommon, Output: &out},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/orders?v=1", strings.NewReader(`{}`))
+	req.RemoteAddr = "192.0.2.7:51000"
+	req.SetBasicAuth("alice", "pw")
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	line := out.String()
+	prefix := "192.0.2.7 - alice ["
+	suffix := `] "POST /orders?v=1 HTTP/1.1" 202 `
+	if !strings.HasPrefix(line, prefix) || !strings.Contains(line, suffix) || !strings.HasSuffix(line, "\n") {
+		t.Errorf("line = %q, want a Common Log Format line for alice's POST", line)
+	}
+}
+
+func TestLoggingMiddleware_Console(t *testing.T) {
+	var out bytes.Buffer
+	srv := NewServer(ServerConfig{
+		Port:       8080,
+		Producer:   &mockProducer{isHealthy: true},
+		Auth:       auth.NewMultiAuth(nil, nil),
+		Logger:     zap.NewNop(),
+		RequestLog: RequestLog{Format: RequestLogConsole, Output: &out},
+	})
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`)))
+
+	line := out.String()
+	if !strings.Contains(line, "\tINFO\trequest\t") || !strings.Contains(line, `"path": "/orders"`) {
+		t.Errorf("line = %q, want a console request line", line)
+	}
+}
+
+func TestHistogram_Buckets(t *testing.T) {
+	h := newHistogram([]int64{10, 100})
+	for _, v := range []int64{5, 10, 50, 1000} {
+		h.observe(v)
+	}
+
+	snap := h.snapshot()
+	want := []int64{2, 3, 4}
+	for i, b := range snap.Buckets {
+		if b.Count != want[i] {
+			t.Errorf("bucket %s = %d, want %d", b.LE, b.Count, want[i])
+		}
+	}
+	if snap.Sum != 1065 {
+		t.Errorf("sum = %d, want 1065", snap.Sum)
+	}
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — bandwidth limits
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_RequestRateLimit(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(map[string]string{"alice": "pw", "bob": "pw", "carol": "pw", "ci": "pw"}, nil),
+		Logger:   zap.NewNop(),
+		RequestRate: RequestRates{
+			Principal: ratelimit.NewLimiter(ratelimit.Limit{Rate: 0.01, Burst: 1}, nil),
+			Topic: ratelimit.NewLimiter(ratelimit.Limit{}, map[string]ratelimit.Limit{
+				"github": {Rate: 0.01, Burst: 1},
+			}),
+		},
+		RateLimitExempt: RateLimitExemptions{Principals: []string{"ci"}},
+	})
+
+	send := func(user, topic string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{}`))
+		req.SetBasicAuth(user, "pw")
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		return w
+	}
+
+	if w := send("alice", "orders"); w.Code != http.StatusAccepted {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	w := send("alice", "orders")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if got := w.Header().Get("Retry-After"); got != "100" {
+		t.Errorf("Retry-After = %q, want %q", got, "100")
+	}
+	var resp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Error != "rate_limited" || !strings.Contains(resp.Message, "principal") {
+		t.Errorf("error = %q (%q), want rate_limited naming the principal scope", resp.Error, resp.Message)
+	}
+
+	// Everyone shares the github topic bucket.
+	if w := send("bob", "github"); w.Code != http.StatusAccepted {
+		t.Fatalf("bob first github request status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if w := send("ci", "github"); w.Code != http.StatusAccepted {
+		t.Errorf("exempt principal status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.Throttled["principal"] != 1 || snap.Throttled["topic"] != 0 {
+		t.Errorf("throttled = %v, want one principal rejection", snap.Throttled)
+	}
+
+	if w := send("carol", "github"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second github request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if snap := newMetricsSnapshot(srv.metrics); snap.Throttled["topic"] != 1 {
+		t.Errorf("throttled = %v, want one topic rejection", snap.Throttled)
+	}
+}
+
+func TestWebhookHandler_BandwidthLimit(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(map[string]string{"alice": "pw", "bob": "pw"}, nil),
+		Logger:   zap.NewNop(),
+		PrincipalBandwidth: ratelimit.NewLimiter(
+			ratelimit.Limit{Rate: 1, Burst: 20}, nil,
+		),
+	})
+
+	send := func(user string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"payload":"0123456"}`))
+		req.SetBasicAuth(user, "pw")
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		return w
+	}
+
+	if w := send("alice"); w.Code != http.StatusAccepted {
+		t.Fatalf("first request status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	w := send("alice")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 response should carry Retry-After")
+	}
+	var resp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if resp.Error != "bandwidth_exceeded" {
+		t.Errorf("error type = %q, want %q", resp.Error, "bandwidth_exceeded")
+	}
+
+	if w := send("bob"); w.Code != http.StatusAccepted {
+		t.Errorf("other principal status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+}
+
+func TestWebhookHandler_BandwidthPrincipalRejectionKeepsTopicBytes(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(map[string]string{"alice": "pw", "bob": "pw"}, nil),
+		Logger:   zap.NewNop(),
+		TopicBandwidth: ratelimit.NewLimiter(
+			ratelimit.Limit{Rate: 0.01, Burst: 50}, nil,
+		),
+		PrincipalBandwidth: ratelimit.NewLimiter(
+			ratelimit.Limit{Rate: 0.01, Burst: 20}, nil,
+		),
+	})
+
+	send := func(user string) int {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"payload":"0123456"}`))
+		req.SetBasicAuth(user, "pw")
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		return w.Code
+	}
+
+	if code := send("alice"); code != http.StatusAccepted {
+		t.Fatalf("first request status = %d, want %d", code, http.StatusAccepted)
+	}
+	for i := 0; i < 3; i++ {
+		if code := send("alice"); code != http.StatusTooManyRequests {
+			t.Fatalf("alice over her limit: status = %d, want %d", code, http.StatusTooManyRequests)
+		}
+	}
+	// alice's rejected requests must not have drained the topic bucket.
+	if code := send("bob"); code != http.StatusAccepted {
+		t.Errorf("bob status = %d, want %d", code, http.StatusAccepted)
+	}
+}
+
+func TestWebhookHandler_BandwidthExemptions(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:           8080,
+		Producer:       &mockProducer{isHealthy: true},
+		Auth:           auth.NewMultiAuth(map[string]string{"backfill": "pw", "stripe": "pw"}, nil),
+		Logger:         zap.NewNop(),
+		TopicBandwidth: ratelimit.NewLimiter(ratelimit.Limit{Rate: 1, Burst: 20}, nil),
+		RoutePaths:     map[string]string{"internal/replay": "orders"},
+		RateLimitExempt: RateLimitExemptions{
+			Principals: []string{"backfill"},
+			Networks:   []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+			Topics:     []string{"internal/replay", "audit"},
+		},
+	})
+
+	send := func(path, user, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"payload":"0123456"}`))
+		req.SetBasicAuth(user, "pw")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		return w.Code
+	}
+
+	// Use up the orders bucket.
+	if code := send("/orders", "stripe", "203.0.113.7:443"); code != http.StatusAccepted {
+		t.Fatalf("first request status = %d, want %d", code, http.StatusAccepted)
+	}
+	if code := send("/orders", "stripe", "203.0.113.7:443"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	tests := []struct {
+		name, path, user, remoteAddr string
+	}{
+		{"exempt principal", "/orders", "backfill", "203.0.113.7:443"},
+		{"exempt network", "/orders", "stripe", "10.1.2.3:443"},
+		{"exempt IPv4-mapped address", "/orders", "stripe", "[::ffff:10.1.2.3]:443"},
+		{"exempt route path", "/internal/replay", "stripe", "203.0.113.7:443"},
+	}
+	for _, tt := range tests {
+		for range 3 {
+			if code := send(tt.path, tt.user, tt.remoteAddr); code != http.StatusAccepted {
+				t.Fatalf("%s: status = %d, want %d", tt.name, code, http.StatusAccepted)
+			}
+		}
+	}
+	if got := srv.metrics.RateLimitExempt.Load(); got != 12 {
+		t.Errorf("rate_limit_exempt = %d, want 12", got)
+	}
+}
+
+func TestWebhookHandler_PriorityShedding(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(map[string]string{"ops": "pw", "stripe": "pw"}, nil),
+		Logger:   zap.NewNop(),
+		Topics: map[string]TopicOptions{
+			"payments":  {Priority: PriorityHigh},
+			"analytics": {Priority: PriorityLow},
+		},
+		Priority: PriorityAdmission{
+			MaxInFlight:       10,
+			ShedLowAt:         0.5,
+			ShedNormalAt:      0.8,
+			TrustedPrincipals: []string{"ops"},
+		},
+	})
+
+	send := func(path, user, priority string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"amount":1}`))
+		req.SetBasicAuth(user, "pw")
+		if priority != "" {
+			req.Header.Set("Kahook-Priority", priority)
+		}
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name               string
+		inFlight           int64
+		path, user, header string
+		want               int
+	}{
+		{"idle low", 0, "/analytics", "stripe", "", http.StatusAccepted},
+		{"low at low threshold", 5, "/analytics", "stripe", "", http.StatusTooManyRequests},
+		{"normal below normal threshold", 5, "/events", "stripe", "", http.StatusAccepted},
+		{"normal at normal threshold", 8, "/events", "stripe", "", http.StatusTooManyRequests},
+		{"high at normal threshold", 8, "/payments", "stripe", "", http.StatusAccepted},
+		{"high when full", 10, "/payments", "stripe", "", http.StatusTooManyRequests},
+		{"untrusted header ignored", 8, "/events", "stripe", "high", http.StatusTooManyRequests},
+		{"trusted header raises", 8, "/events", "ops", "high", http.StatusAccepted},
+		{"trusted header lowers", 5, "/payments", "ops", "low", http.StatusTooManyRequests},
+		{"trusted invalid header", 0, "/events", "ops", "urgent", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		srv.priority.inFlight.Store(tt.inFlight)
+		w := send(tt.path, tt.user, tt.header)
+		if w.Code != tt.want {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.want, w.Body)
+		}
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: 429 without Retry-After", tt.name)
+		}
+		if got := srv.priority.inFlight.Load(); got != tt.inFlight {
+			t.Errorf("%s: in flight after request = %d, want %d", tt.name, got, tt.inFlight)
+		}
+	}
+
+	snap := newMetricsSnapshot(srv.metrics)
+	want := map[Priority]int64{PriorityHigh: 1, PriorityNormal: 2, PriorityLow: 2}
+	if !maps.Equal(snap.LoadShed, want) {
+		t.Errorf("load_shed = %v, want %v", snap.LoadShed, want)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "1"},
+		{300 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+	}
+	for _, tt := range tests {
+		if got := retryAfterSeconds(tt.d); got != tt.want {
+			t.Errorf("retryAfterSeconds(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — strict routes
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_StrictRoutes(t *testing.T) {
+	tests := []struct {
+		name            string
+		path            string
+		dev             bool
+		wantStatus      int
+		wantSuggestions []string
+	}{
+		{"known route", "/orders", false, http.StatusAccepted, nil},
+		{"unknown route", "/payments", false, http.StatusNotFound, nil},
+		{"malformed path is unknown, not bad request", "/a/b", false, http.StatusNotFound, nil},
+		{"reserved name is unknown", "/health", false, http.StatusNotFound, nil},
+		{"no suggestions outside dev profile", "/ordrs", false, http.StatusNotFound, nil},
+		{"dev profile suggests close match", "/ordrs", true, http.StatusNotFound, []string{"orders"}},
+		{"dev profile omits distant names", "/xyz", true, http.StatusNotFound, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				Port:          8080,
+				Producer:      &mockProducer{isHealthy: true},
+				Auth:          auth.NewMultiAuth(nil, nil),
+				Logger:        zap.NewNop(),
+				AllowedTopics: []string{"orders", "events"},
+				StrictRoutes:  true,
+				DevProfile:    tt.dev,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{}`))
+			w := httptest.NewRecorder()
+			srv.webhookHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if w.Code != http.StatusNotFound {
+				return
+			}
+
+			var resp ErrorResponse
+			json.NewDecoder(w.Body).Decode(&resp)
+			if resp.Error != "unknown_route" {
+				t.Errorf("error type = %q, want %q", resp.Error, "unknown_route")
+			}
+			if strings.Join(resp.Suggestions, ",") != strings.Join(tt.wantSuggestions, ",") {
+				t.Errorf("suggestions = %v, want %v", resp.Suggestions, tt.wantSuggestions)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_RoutePaths(t *testing.T) {
+	mock := &mockProducer{}
+	srv := NewServer(ServerConfig{
+		Port:          8080,
+		Producer:      mock,
+		Auth:          auth.NewMultiAuth(nil, nil),
+		Logger:        zap.NewNop(),
+		AllowedTopics: []string{"scm.github.events"},
+		StrictRoutes:  true,
+		DevProfile:    true,
+		RoutePaths:    map[string]string{"github": "scm.github.events"},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/github", strings.NewReader(`{}`))
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if mock.topic != "scm.github.events" {
+		t.Errorf("produced to %q, want the route's topic", mock.topic)
+	}
+
+	// Route paths are suggested alongside topics.
+	req = httptest.NewRequest(http.MethodPost, "/githb", strings.NewReader(`{}`))
+	w = httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+
+	var resp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusNotFound || strings.Join(resp.Suggestions, ",") != "github" {
+		t.Errorf("status = %d, suggestions = %v; want 404 suggesting github", w.Code, resp.Suggestions)
+	}
+}
+
+func TestWebhookHandler_AliasedTopics(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		mock := &mockProducer{}
+		cfg := ServerConfig{
+			Port:          8080,
+			Producer:      mock,
+			Auth:          auth.NewMultiAuth(nil, nil),
+			Logger:        zap.NewNop(),
+			RoutePaths:    map[string]string{"github": "events.github.raw"},
+			AliasedTopics: []string{"events.github.raw"},
+		}
+		want := http.StatusForbidden
+		if strict {
+			cfg.AllowedTopics = []string{"events.github.raw", "orders"}
+			cfg.StrictRoutes = true
+			cfg.DevProfile = true
+			want = http.StatusNotFound
+		}
+		srv := NewServer(cfg)
+
+		for path, code := range map[string]int{"/github": http.StatusAccepted, "/orders": http.StatusAccepted, "/events.github.raw": want} {
+			w := httptest.NewRecorder()
+			srv.webhookHandler(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`)))
+			if w.Code != code {
+				t.Errorf("strict=%v: POST %s = %d, want %d", strict, path, w.Code, code)
+			}
+			if strict && code == http.StatusNotFound {
+				var resp ErrorResponse
+				json.NewDecoder(w.Body).Decode(&resp)
+				if slices.Contains(resp.Suggestions, "events.github.raw") {
+					t.Errorf("suggestions = %v, want the aliased topic left out", resp.Suggestions)
+				}
+			}
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"orders", "orders", 0},
+		{"ordrs", "orders", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, tt := range tests {
+		if got := levenshtein(tt.a, tt.b); got != tt.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — payload modes
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_PayloadModes(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+
+	tests := []struct {
+		name         string
+		mode         PayloadMode
+		contentType  string
+		body         []byte
+		wantStatus   int
+		wantEncoding string
+	}{
+		{"raw forwards binary", PayloadRaw, "image/png", binary, http.StatusAccepted, "raw"},
+		{"default is raw", "", "image/png", binary, http.StatusAccepted, "raw"},
+		{"base64 wraps binary", PayloadBase64, "image/png", binary, http.StatusAccepted, "base64-envelope"},
+		{"base64 passes JSON through", PayloadBase64, "application/json", []byte(`{"a":1}`), http.StatusAccepted, "raw"},
+		{"json_only accepts JSON", PayloadJSONOnly, "application/json; charset=utf-8", []byte(`{"a":1}`), http.StatusAccepted, "raw"},
+		{"json_only accepts +json", PayloadJSONOnly, "application/cloudevents+json", []byte(`{"a":1}`), http.StatusAccepted, "raw"},
+		{"json_only sniffs missing content type", PayloadJSONOnly, "", []byte(`[1,2]`), http.StatusAccepted, "raw"},
+		{"json_only rejects binary", PayloadJSONOnly, "image/png", binary, http.StatusUnsupportedMediaType, ""},
+		{"json_only rejects malformed JSON", PayloadJSONOnly, "application/json", []byte(`{"a":`), http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &mockProducer{isHealthy: true}
+			srv := NewServer(ServerConfig{
+				Port:     8080,
+				Producer: producer,
+				Auth:     auth.NewMultiAuth(nil, nil),
+				Logger:   zap.NewNop(),
+				Topics:   map[string]TopicOptions{"uploads": {Payload: tt.mode}},
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/uploads", bytes.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			srv.webhookHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantEncoding == "" {
+				return
+			}
+
+			if got := producer.headers[payloadEncodingHeader]; got != tt.wantEncoding {
+				t.Errorf("%s = %q, want %q", payloadEncodingHeader, got, tt.wantEncoding)
+			}
+			if got := producer.headers[contentTypeHeader]; got != tt.contentType {
+				t.Errorf("%s = %q, want %q", contentTypeHeader, got, tt.contentType)
+			}
+
+			if tt.wantEncoding == encodingRaw {
+				if !bytes.Equal(producer.value, tt.body) {
+					t.Errorf("raw value = %q, want body unchanged", producer.value)
+				}
+				return
+			}
+
+			var env binaryEnvelope
+			if err := json.Unmarshal(producer.value, &env); err != nil {
+				t.Fatalf("envelope is not JSON: %v", err)
+			}
+			decoded, err := base64.StdEncoding.DecodeString(env.Data)
+			if err != nil || !bytes.Equal(decoded, tt.body) {
+				t.Errorf("envelope data does not round-trip: %v", err)
+			}
+			if env.ContentType != tt.contentType {
+				t.Errorf("envelope content_type = %q, want %q", env.ContentType, tt.contentType)
+			}
+		})
+	}
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — payload upcasting
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_Upcast(t *testing.T) {
+	up, err := upcast.New(upcast.Config{
+		VersionHeader: "Stripe-Version",
+		Steps: []upcast.Step{
+			{From: "2023-10-16", To: "2024-06-20", Rename: map[string]string{"amount_cents": "amount"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Topics:   map[string]TopicOptions{"payments": {Upcast: up}},
+	})
+
+	tests := []struct {
+		name, version, body string
+		wantStatus          int
+		wantValue           string
+		wantVersion         string
+		wantFrom            string
+	}{
+		{"old version", "2023-10-16", `{"amount_cents":100}`, http.StatusAccepted, `{"amount":100}`, "2024-06-20", "2023-10-16"},
+		{"current version", "2024-06-20", `{"amount":100}`, http.StatusAccepted, `{"amount":100}`, "2024-06-20", ""},
+		{"no version", "", `{"amount":100}`, http.StatusAccepted, `{"amount":100}`, "", ""},
+		{"old version, not JSON", "2023-10-16", `amount=100`, http.StatusBadRequest, "", "", ""},
+	}
+	for _, tt := range tests {
+		producer.value, producer.headers = nil, nil
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Kahook-Upcast-From", "spoofed")
+		if tt.version != "" {
+			req.Header.Set("Stripe-Version", tt.version)
+		}
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.wantStatus, w.Body)
+			continue
+		}
+		if w.Code != http.StatusAccepted {
+			continue
+		}
+		if string(producer.value) != tt.wantValue {
+			t.Errorf("%s: value = %s, want %s", tt.name, producer.value, tt.wantValue)
+		}
+		if got := producer.headers["Stripe-Version"]; got != tt.wantVersion {
+			t.Errorf("%s: Stripe-Version = %q, want %q", tt.name, got, tt.wantVersion)
+		}
+		if got := producer.headers["Kahook-Upcast-From"]; got != tt.wantFrom {
+			t.Errorf("%s: Kahook-Upcast-From = %q, want %q", tt.name, got, tt.wantFrom)
+		}
+	}
+	if got := srv.metrics.PayloadsUpcast.Load(); got != 1 {
+		t.Errorf("payloads_upcast = %d, want 1", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — payload schemas
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_Schema(t *testing.T) {
+	schema, err := jsonschema.Compile([]byte(`{
+		"type": "object",
+		"required": ["id"],
+		"properties": {"id": {"type": "string"}, "amount": {"type": "integer", "minimum": 0}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newServer := func(producer *mockProducer, q Quarantine) *Server {
+		return NewServer(ServerConfig{
+			Port:       8080,
+			Producer:   producer,
+			Auth:       auth.NewMultiAuth(nil, nil),
+			Logger:     zap.NewNop(),
+			Topics:     map[string]TopicOptions{"orders": {Schema: schema}},
+			Quarantine: q,
+		})
+	}
+
+	t.Run("valid payloads are produced", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		srv := newServer(producer, Quarantine{})
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":"o1","amount":5}`))
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+		}
+		if producer.topic != "orders" {
+			t.Errorf("produced to %q, want orders", producer.topic)
+		}
+	})
+
+	t.Run("invalid payloads get 422 with details", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		srv := newServer(producer, Quarantine{})
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"amount":-1}`))
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		if w.Code != http.StatusUnprocessableEntity {
+			t.Fatalf("status = %d, want 422: %s", w.Code, w.Body)
+		}
+		var resp ErrorResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{`/: missing required property "id"`, "/amount: must be >= 0"}
+		if resp.Error != "schema_validation_failed" || !slices.Equal(resp.Details, want) {
+			t.Errorf("response = %+v, want schema_validation_failed with %q", resp, want)
+		}
+		if producer.topic != "" {
+			t.Errorf("produced to %q, want nothing produced", producer.topic)
+		}
+		if got := srv.metrics.SchemaInvalid.Load(); got != 1 {
+			t.Errorf("schema_invalid = %d, want 1", got)
+		}
+	})
+
+	t.Run("invalid payloads can be quarantined", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		srv := newServer(producer, Quarantine{Topic: "kahook.quarantine", Violations: []string{ViolationSchema}})
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`not json`))
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+		}
+		if producer.topic != "kahook.quarantine" || producer.headers["Kahook-Violation"] != ViolationSchema {
+			t.Errorf("produced to %q with violation %q, want the quarantine topic", producer.topic, producer.headers["Kahook-Violation"])
+		}
+		if got := producer.headers["Kahook-Violation-Detail"]; !strings.Contains(got, "body is not valid JSON") {
+			t.Errorf("Kahook-Violation-Detail = %q, want the schema problem", got)
+		}
+	})
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — payload transforms
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_Transform(t *testing.T) {
+	pipeline, err := transform.New([]transform.Step{
+		{Remove: []string{"card"}},
+		{Envelope: "data", Metadata: map[string]string{"source": "{path}", "topic": "{topic}"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := keyexpr.Compile("$.id", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:       8080,
+		Producer:   producer,
+		Auth:       auth.NewMultiAuth(nil, nil),
+		Logger:     zap.NewNop(),
+		Topics:     map[string]TopicOptions{"orders": {Transform: pipeline, Key: key}},
+		RoutePaths: map[string]string{"shop": "orders"},
+		Quarantine: Quarantine{Topic: "kahook.quarantine", Violations: []string{ViolationTransform}},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/shop", strings.NewReader(`{"id":"o1","card":"4242"}`))
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	if want := `{"data":{"id":"o1"},"source":"shop","topic":"orders"}`; string(producer.value) != want {
+		t.Errorf("value = %s, want %s", producer.value, want)
+	}
+	if string(producer.key) != "o1" {
+		t.Errorf("key = %q, want it extracted before transforming", producer.key)
+	}
+	if got := srv.metrics.PayloadsTransformed.Load(); got != 1 {
+		t.Errorf("payloads_transformed = %d, want 1", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/shop", strings.NewReader(`[1,2]`))
+	w = httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+	if producer.topic != "kahook.quarantine" || producer.headers["Kahook-Violation"] != ViolationTransform {
+		t.Errorf("produced to %q with violation %q, want the quarantine topic", producer.topic, producer.headers["Kahook-Violation"])
+	}
+	if string(producer.value) != `[1,2]` {
+		t.Errorf("quarantined value = %s, want the body as sent", producer.value)
+	}
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — CloudEvents
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_CloudEvents(t *testing.T) {
+	newServer := func(producer *mockProducer, ce CloudEvents) *Server {
+		return NewServer(ServerConfig{
+			Port:       8080,
+			Producer:   producer,
+			Auth:       auth.NewMultiAuth(nil, nil),
+			Logger:     zap.NewNop(),
+			Topics:     map[string]TopicOptions{"scm.github.events": {CloudEvents: ce}},
+			RoutePaths: map[string]string{"github": "scm.github.events"},
+		})
+	}
+	send := func(srv *Server, body, contentType string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/github", strings.NewReader(body))
+		req.Header.Set(RequestIDHeader, "req-1")
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("X-GitHub-Event", "push")
+		req.Header.Set("Ce_id", "spoofed")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("binary mode sets ce_ headers", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		srv := newServer(producer, CloudEvents{Mode: CloudEventsBinary, Type: "com.github.event", TypeHeader: "X-GitHub-Event"})
+		if w := send(srv, `{"ref":"main"}`, "application/json"); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+		}
+		if string(producer.value) != `{"ref":"main"}` {
+			t.Errorf("value = %s, want the body unchanged", producer.value)
+		}
+		want := map[string]string{
+			"ce_specversion": "1.0",
+			"ce_id":          "req-1",
+			"ce_source":      "/github",
+			"ce_type":        "push",
+			"content-type":   "application/json",
+		}
+		for name, v := range want {
+			if got := producer.headers[name]; got != v {
+				t.Errorf("%s = %q, want %q", name, got, v)
+			}
+		}
+		if _, err := time.Parse(time.RFC3339Nano, producer.headers["ce_time"]); err != nil {
+			t.Errorf("ce_time = %q: %v", producer.headers["ce_time"], err)
+		}
+		for _, name := range []string{"Content-Type", "Ce_id"} {
+			if _, ok := producer.headers[name]; ok {
+				t.Errorf("header %s is set, want it replaced by the binding's", name)
+			}
+		}
+	})
+
+	t.Run("structured mode wraps the body", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		srv := newServer(producer, CloudEvents{Mode: CloudEventsStructured, Source: "https://github.com/acme"})
+		if w := send(srv, `{"ref":"<main>"}`, "application/json"); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+		}
+		var event map[string]any
+		if err := json.Unmarshal(producer.value, &event); err != nil {
+			t.Fatalf("value is not JSON: %s", producer.value)
+		}
+		if event["specversion"] != "1.0" || event["id"] != "req-1" || event["source"] != "https://github.com/acme" ||
+			event["type"] != defaultCloudEventType || event["datacontenttype"] != "application/json" {
+			t.Errorf("event = %v", event)
+		}
+		if !strings.Contains(string(producer.value), `"data":{"ref":"<main>"}`) {
+			t.Errorf("value = %s, want the body as data", producer.value)
+		}
+		if got := producer.headers["content-type"]; got != cloudEventsJSON {
+			t.Errorf("content-type = %q, want %q", got, cloudEventsJSON)
+		}
+	})
+
+	t.Run("structured mode base64-encodes other bodies", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		srv := newServer(producer, CloudEvents{Mode: CloudEventsStructured})
+		if w := send(srv, "a=1", "application/x-www-form-urlencoded"); w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+		}
+		var event struct {
+			DataContentType string `json:"datacontenttype"`
+			DataBase64      string `json:"data_base64"`
+		}
+		if err := json.Unmarshal(producer.value, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.DataContentType != "application/x-www-form-urlencoded" || event.DataBase64 != "YT0x" {
+			t.Errorf("event = %+v, want the form body base64-encoded", event)
+		}
+	})
+}
+
+// -------------------------------------------------------------------
+// webhookHandler — response content negotiation
+// -------------------------------------------------------------------
+
+func TestAcceptedFormat(t *testing.T) {
+	tests := []struct {
+		accept string
+		def    ResponseFormat
+		want   ResponseFormat
+	}{
+		{"", "", ResponseJSON},
+		{"", ResponseNone, ResponseNone},
+		{"*/*", ResponseText, ResponseText},
+		{"application/json", ResponseNone, ResponseJSON},
+		{"text/plain", "", ResponseText},
+		{"TEXT/PLAIN; charset=utf-8", "", ResponseText},
+		{"text/*", ResponseNone, ResponseText},
+		{"application/json;q=0.5, text/plain", "", ResponseText},
+		{"text/plain;q=0.2, application/*;q=0.8", "", ResponseJSON},
+		{"text/plain, application/json", ResponseText, ResponseText},
+		{"text/plain, application/json", ResponseNone, ResponseJSON},
+		{"application/xml", ResponseNone, ResponseNone},
+		{"text/plain;q=oops", "", ResponseText},
+	}
+	for _, tt := range tests {
+		if got := acceptedFormat(tt.accept, tt.def); got != tt.want {
+			t.Errorf("acceptedFormat(%q, %q) = %q, want %q", tt.accept, tt.def, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookHandler_ResponseFormat(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Topics:   map[string]TopicOptions{"legacy": {Response: ResponseNone}},
+		NewID:    func() string { return "id-1" },
+	})
+	h := srv.Handler()
+
+	tests := []struct {
+		name, path, accept, body string
+		wantStatus               int
+		wantType                 string
+		wantBody                 string
+	}{
+		{"json by default", "/events", "", `{}`, http.StatusAccepted, "application/json", `"status":"accepted"`},
+		{"text accepted", "/events", "text/plain", `{}`, http.StatusAccepted, "text/plain; charset=utf-8",
+			"message_id: id-1\nrequest_id: id-1\nstatus: accepted\ntopic: events\n"},
+		{"text error", "/events", "text/plain", ``, http.StatusBadRequest, "text/plain; charset=utf-8",
+			"error: empty_body\nmessage: request body cannot be empty\n"},
+		{"route without body", "/legacy", "*/*", `{}`, http.StatusNoContent, "", ""},
+		{"route error without body", "/legacy", "", ``, http.StatusBadRequest, "", ""},
+		{"route overridden by Accept", "/legacy", "application/json", `{}`, http.StatusAccepted, "application/json", `"status":"accepted"`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+		if got := w.Header().Get("Content-Type"); got != tt.wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, got, tt.wantType)
+		}
+		if tt.wantType == "application/json" {
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s: body = %s, want it to contain %s", tt.name, w.Body, tt.wantBody)
+			}
+		} else if w.Body.String() != tt.wantBody {
+			t.Errorf("%s: body = %q, want %q", tt.name, w.Body, tt.wantBody)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// /admin/verify
+// -------------------------------------------------------------------
+
+type mockVerifier struct {
+	err error
+}
+
+func (m *mockVerifier) Verify(context.Context) (time.Duration, time.Duration, error) {
+	return 4 * time.Millisecond, 25 * time.Millisecond, m.err
+}
+
+func TestVerifyHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		verifier   *mockVerifier
+		user, pass string
+		wantStatus int
+	}{
+		{"unauthenticated", &mockVerifier{}, "", "", http.StatusUnauthorized},
+		{"success", &mockVerifier{}, "admin", "secret", http.StatusOK},
+		{"verification fails", &mockVerifier{err: errors.New("TOPIC_AUTHORIZATION_FAILED")}, "admin", "secret", http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				Producer: &mockProducer{isHealthy: true},
+				Auth:     auth.NewMultiAuth(map[string]string{"admin": "secret"}, nil),
+				Logger:   zap.NewNop(),
+				Verifier: tt.verifier,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/admin/verify", nil)
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d (%s)", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK {
+				var resp VerifyResponse
+				_ = json.NewDecoder(w.Body).Decode(&resp)
+				if resp.ProduceMs != 4 || resp.RoundTripMs != 25 {
+					t.Errorf("response = %+v", resp)
+				}
+			}
+			if tt.verifier.err != nil && !strings.Contains(w.Body.String(), "TOPIC_AUTHORIZATION_FAILED") {
+				t.Errorf("body should carry the broker error, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestVerifyHandler_NotRegisteredWithoutVerifier(t *testing.T) {
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true})
+
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/verify", strings.NewReader("{}")))
+
+	if w.Code == http.StatusOK {
+		t.Error("/admin/verify should not be served when no verifier is configured")
+	}
+}
+
+// -------------------------------------------------------------------
+// latency SLO
+// -------------------------------------------------------------------
+
+func TestSLOTracker_BurnRate(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	tr := newSLOTracker(LatencySLO{Threshold: 250 * time.Millisecond, Target: 0.99}, func() time.Time { return now })
+
+	// An hour ago: 100 good produces, outside the 5m window.
+	now = now.Add(-50 * time.Minute)
+	for i := 0; i < 100; i++ {
+		tr.observe(10*time.Millisecond, true)
+	}
+
+	// Now: 98 good, 1 slow, 1 failed.
+	now = now.Add(50 * time.Minute)
+	for i := 0; i < 98; i++ {
+		tr.observe(10*time.Millisecond, true)
+	}
+	tr.observe(time.Second, true)
+	tr.observe(10*time.Millisecond, false)
+
+	s := tr.snapshot()
+	if s.Total != 200 || s.Good != 198 {
+		t.Fatalf("total/good = %d/%d, want 200/198", s.Total, s.Good)
+	}
+	// 5m window: 2 bad of 100 = 2% against a 1% budget.
+	if math.Abs(s.BurnRate5m-2) > 1e-9 {
+		t.Errorf("BurnRate5m = %v, want 2", s.BurnRate5m)
+	}
+	// 1h window: 2 bad of 200 = 1%.
+	if math.Abs(s.BurnRate1h-1) > 1e-9 {
+		t.Errorf("BurnRate1h = %v, want 1", s.BurnRate1h)
+	}
+	if math.Abs(s.ErrorBudgetRemaining) > 1e-9 {
+		t.Errorf("ErrorBudgetRemaining = %v, want 0", s.ErrorBudgetRemaining)
+	}
+
+	// Two hours later nothing is in either window.
+	now = now.Add(2 * time.Hour)
+	if s := tr.snapshot(); s.BurnRate5m != 0 || s.BurnRate1h != 0 {
+		t.Errorf("stale buckets counted: %+v", s)
+	}
+}
+
+func TestWebhookHandler_SLOInMetrics(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Producer:   &mockProducer{isHealthy: true},
+		Auth:       auth.NewMultiAuth(nil, nil),
+		Logger:     zap.NewNop(),
+		LatencySLO: LatencySLO{Threshold: time.Second, Target: 0.99},
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+	srv.webhookHandler(httptest.NewRecorder(), req)
+
+	w := httptest.NewRecorder()
+	srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	var resp MetricsResponse
+	_ = json.NewDecoder(w.Body).Decode(&resp)
+	if resp.SLO == nil || resp.SLO.Total != 1 || resp.SLO.Good != 1 {
+		t.Errorf("SLO = %+v, want one good produce", resp.SLO)
+	}
+}
+
+// -------------------------------------------------------------------
+// connection age limits
+// -------------------------------------------------------------------
+
+func TestConnAger_ClosesBusyConnectionAfterResponse(t *testing.T) {
+	var recycled atomic.Int64
+	now := time.Now()
+	a := newConnAger(time.Minute, &recycled, func() time.Time { return now })
+
+	c, peer := net.Pipe()
+	defer c.Close()
+	defer peer.Close()
+	a.connState(c, http.StateNew)
+	a.connState(c, http.StateActive)
+
+	h := a.middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	serve := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		req = req.WithContext(a.connContext(req.Context(), c))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Header().Get("Connection")
+	}
+
+	if got := serve(); got != "" {
+		t.Errorf("young connection: Connection = %q, want unset", got)
+	}
+
+	// Past the maximum age plus jitter.
+	now = now.Add(time.Minute + time.Minute/5)
+	if got := serve(); got != "close" {
+		t.Errorf("old connection: Connection = %q, want close", got)
+	}
+	if recycled.Load() != 1 {
+		t.Errorf("recycled = %d, want 1", recycled.Load())
+	}
+}
+
+func TestConnAger_SweepClosesIdleConnections(t *testing.T) {
+	var recycled atomic.Int64
+	now := time.Now()
+	a := newConnAger(time.Minute, &recycled, func() time.Time { return now })
+
+	idle, idlePeer := net.Pipe()
+	busy, busyPeer := net.Pipe()
+	defer busy.Close()
+	defer idlePeer.Close()
+	defer busyPeer.Close()
+
+	a.connState(idle, http.StateNew)
+	a.connState(idle, http.StateIdle)
+	a.connState(busy, http.StateNew)
+	a.connState(busy, http.StateActive)
+
+	if n := a.sweep(); n != 0 {
+		t.Errorf("sweep() closed %d young connections", n)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if n := a.sweep(); n != 1 {
+		t.Fatalf("sweep() = %d, want 1 (only the idle connection)", n)
+	}
+	if _, err := idlePeer.Read(make([]byte, 1)); err == nil {
+		t.Error("idle connection should have been closed")
+	}
+	if recycled.Load() != 1 {
+		t.Errorf("recycled = %d, want 1", recycled.Load())
+	}
+}
+
+// -------------------------------------------------------------------
+// listener address family
+// -------------------------------------------------------------------
+
+func TestListenNetwork(t *testing.T) {
+	tests := []struct {
+		family  string
+		want    string
+		wantErr bool
+	}{
+		{"", "tcp", false},
+		{AddressFamilyDual, "tcp", false},
+		{AddressFamilyIPv4, "tcp4", false},
+		{AddressFamilyIPv6, "tcp6", false},
+		{"ipx", "", true},
+	}
+	for _, tt := range tests {
+		got, err := listenNetwork(tt.family)
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("listenNetwork(%q) = %q, %v", tt.family, got, err)
+		}
+	}
+}
+
+func TestListen_AddressFamily(t *testing.T) {
+	ln6, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 loopback unavailable")
+	}
+	ln6.Close()
+
+	tests := []struct {
+		family   string
+		accepts4 bool
+		accepts6 bool
+	}{
+		{AddressFamilyDual, true, true},
+		{AddressFamilyIPv4, true, false},
+		{AddressFamilyIPv6, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.family, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				Port:          0,
+				AddressFamily: tt.family,
+				Producer:      &mockProducer{},
+				Auth:          auth.NewMultiAuth(nil, nil),
+				Logger:        zap.NewNop(),
+			})
+			ln, err := srv.listen()
+			if err != nil {
+				t.Fatalf("listen() error = %v", err)
+			}
+			defer ln.Close()
+			go func() {
+				for {
+					c, err := ln.Accept()
+					if err != nil {
+						return
+					}
+					c.Close()
+				}
+			}()
+
+			port := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+			dial := func(host string) bool {
+				c, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), time.Second)
+				if err == nil {
+					c.Close()
+				}
+				return err == nil
+			}
+			if got := dial("127.0.0.1"); got != tt.accepts4 {
+				t.Errorf("IPv4 connect = %v, want %v", got, tt.accepts4)
+			}
+			if got := dial("::1"); got != tt.accepts6 {
+				t.Errorf("IPv6 connect = %v, want %v", got, tt.accepts6)
+			}
+		})
+	}
+}
+
+func TestServer_ProxyProtocolRemoteAddr(t *testing.T) {
+	trusted, _ := proxyproto.ParseCIDRs([]string{"127.0.0.1"})
+	srv := NewServer(ServerConfig{
+		Host:          "127.0.0.1",
+		Producer:      &mockProducer{isHealthy: true},
+		Auth:          auth.NewMultiAuth(nil, nil),
+		Logger:        zap.NewNop(),
+		ProxyProtocol: &proxyproto.Config{Trusted: trusted},
+	})
+
+	var remote string
+	srv.httpServer.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remote = r.RemoteAddr
+	})
+
+	ln, err := srv.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.httpServer.Serve(ln) //nolint:errcheck // closed below
+	defer srv.httpServer.Close()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_, _ = c.Write([]byte("PROXY TCP4 203.0.113.7 10.0.0.5 40000 8080\r\nGET /health HTTP/1.1\r\nHost: x\r\n\r\n"))
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if remote != "203.0.113.7:40000" {
+		t.Errorf("RemoteAddr = %q, want the proxied client address", remote)
+	}
+}
+
+// -------------------------------------------------------------------
+// Slow and greedy clients
+// -------------------------------------------------------------------
+
+func TestServer_MaxRequestsPerConnection(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Host:                     "127.0.0.1",
+		Producer:                 &mockProducer{isHealthy: true},
+		Auth:                     auth.NewMultiAuth(nil, nil),
+		Logger:                   zap.NewNop(),
+		MaxRequestsPerConnection: 2,
+	})
+	ln, err := srv.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.httpServer.Serve(ln) //nolint:errcheck // closed below
+	defer srv.httpServer.Close()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for i, wantClose := range []bool{false, true} {
+		_, _ = c.Write([]byte("GET /health HTTP/1.1\r\nHost: x\r\n\r\n"))
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+		resp.Body.Close()
+		if resp.Close != wantClose {
+			t.Errorf("request %d: Connection: close = %v, want %v", i+1, resp.Close, wantClose)
+		}
+	}
+	if got := srv.metrics.ConnectionsCapped.Load(); got != 1 {
+		t.Errorf("connections_capped = %d, want 1", got)
+	}
+}
+
+func TestWebhookHandler_SlowBodyRejected(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Host:        "127.0.0.1",
+		Producer:    producer,
+		Auth:        auth.NewMultiAuth(nil, nil),
+		Logger:      zap.NewNop(),
+		ReadTimeout: 10 * time.Second,
+		MinBodyRate: 1000,
+	})
+	srv.minBodyGrace = 50 * time.Millisecond
+	ln, err := srv.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.httpServer.Serve(ln) //nolint:errcheck // closed below
+	defer srv.httpServer.Close()
+
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// 10 of 100 bytes, then nothing: the deadline is 50ms + 10ms away.
+	_, _ = c.Write([]byte("POST /orders HTTP/1.1\r\nHost: x\r\nContent-Length: 100\r\n\r\n{\"id\":1234"))
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(c), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestTimeout || !resp.Close {
+		t.Errorf("status = %d, close = %v, want 408 and Connection: close", resp.StatusCode, resp.Close)
+	}
+	if producer.value != nil {
+		t.Error("a partial body was produced")
+	}
+	if got := srv.metrics.SlowBodyRejected.Load(); got != 1 {
+		t.Errorf("slow_body_rejected = %d, want 1", got)
+	}
+}
+
+func TestWebhookHandler_MinBodyRateAllowsPromptBodies(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:        8080,
+		Producer:    producer,
+		Auth:        auth.NewMultiAuth(nil, nil),
+		Logger:      zap.NewNop(),
+		MinBodyRate: 1000,
+	})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/orders", "application/json", strings.NewReader(`{"id":1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("status = %d, want 202", resp.StatusCode)
+	}
+}
+
+// -------------------------------------------------------------------
+// pooled body buffers
+// -------------------------------------------------------------------
+
+func TestReadBody_SizesFromContentLength(t *testing.T) {
+	body := bytes.Repeat([]byte("a"), 10<<10)
+
+	buf, err := bodyBuffers.readBody(bytes.NewReader(body), int64(len(body)), defaultMaxBodyBytes)
+	if err != nil {
+		t.Fatalf("readBody: %v", err)
+	}
+	defer bodyBuffers.put(buf)
+
+	if !bytes.Equal(*buf, body) {
+		t.Fatal("readBody returned a different body")
+	}
+	if cap(*buf) != 16<<10 {
+		t.Errorf("cap = %d, want the 16 KiB class", cap(*buf))
+	}
+}
+
+func TestReadBody_GrowsPastWrongContentLength(t *testing.T) {
+	// Unknown or understated lengths start small and move up through the
+	// classes without losing data.
+	body := bytes.Repeat([]byte("b"), 100<<10)
+
+	for _, contentLength := range []int64{-1, 10} {
+		buf, err := bodyBuffers.readBody(bytes.NewReader(body), contentLength, defaultMaxBodyBytes)
+		if err != nil {
+			t.Fatalf("readBody(%d): %v", contentLength, err)
+		}
+		if !bytes.Equal(*buf, body) {
+			t.Errorf("readBody(%d) returned a different body", contentLength)
+		}
+		if cap(*buf) != 256<<10 {
+			t.Errorf("readBody(%d) cap = %d, want the 256 KiB class", contentLength, cap(*buf))
+		}
+		bodyBuffers.put(buf)
+	}
+}
+
+func TestReadBody_MaxSizeBodyFitsLargestClass(t *testing.T) {
+	body := bytes.Repeat([]byte("c"), defaultMaxBodyBytes)
+
+	buf, err := bodyBuffers.readBody(bytes.NewReader(body), int64(len(body)), defaultMaxBodyBytes)
+	if err != nil {
+		t.Fatalf("readBody: %v", err)
+	}
+	defer bodyBuffers.put(buf)
+
+	if len(*buf) != defaultMaxBodyBytes || cap(*buf) != defaultMaxBodyBytes+1 {
+		t.Errorf("len = %d, cap = %d, want a full largest class", len(*buf), cap(*buf))
+	}
+}
+
+func TestBodyPool_PutDropsOffClassBuffers(t *testing.T) {
+	p := newBodyPool([]int{8})
+	odd := make([]byte, 0, 9)
+	p.put(&odd)
+
+	if got := p.get(1); cap(*got) != 8 {
+		t.Errorf("get cap = %d, want a fresh 8-byte buffer", cap(*got))
+	}
+}
+
+func TestWebhookHandler_ProducerSeesWholeBodyAcrossRequests(t *testing.T) {
+	// Back-to-back requests reuse the same pooled buffer; each message must
+	// carry its own body.
+	mock := &mockProducer{}
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), mock)
+
+	for _, body := range []string{`{"n":"first-and-longer"}`, `{"n":2}`} {
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		srv.webhookHandler(w, req)
+
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+		if string(mock.value) != body {
+			t.Errorf("produced value = %q, want %q", mock.value, body)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// produce queues
+// -------------------------------------------------------------------
+
+// gatedProducer blocks produce calls for one topic until release is closed.
+type gatedProducer struct {
+	gatedTopic string
+	started    chan string
+	release    chan struct{}
+	produced   atomic.Int64
+}
+
+func (g *gatedProducer) Produce(_ context.Context, topic string, _, _ []byte, _ map[string]string) error {
+	if topic == g.gatedTopic {
+		g.started <- topic
+		<-g.release
+	}
+	g.produced.Add(1)
+	return nil
+}
+
+func (g *gatedProducer) IsConnected() bool { return true }
+func (g *gatedProducer) Close()            {}
+
+func postAsync(srv *Server, topic string) <-chan *httptest.ResponseRecorder {
+	out := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{"a":1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		out <- w
+	}()
+	return out
+}
+
+func TestWebhookHandler_ProduceQueue(t *testing.T) {
+	mock := &mockProducer{}
+	srv := NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     mock,
+		Auth:         auth.NewMultiAuth(nil, nil),
+		Logger:       zap.NewNop(),
+		ProduceQueue: ProduceQueue{Depth: 4},
+	})
+	defer srv.dispatcher.close()
+
+	w := <-postAsync(srv, "events")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if mock.topic != "events" || string(mock.value) != `{"a":1}` {
+		t.Errorf("produced %q to %q, want the request body on events", mock.value, mock.topic)
+	}
+	if depths := srv.dispatcher.depths(); len(depths) != 1 || depths["events"] != 0 {
+		t.Errorf("depths = %v, want one empty events queue", depths)
+	}
+}
+
+func TestWebhookHandler_ProduceQueueFullIsolatedPerTopic(t *testing.T) {
+	gate := &gatedProducer{gatedTopic: "hot", started: make(chan string, 1), release: make(chan struct{})}
+	srv := NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     gate,
+		Auth:         auth.NewMultiAuth(nil, nil),
+		Logger:       zap.NewNop(),
+		ProduceQueue: ProduceQueue{Depth: 1, Workers: 1},
+	})
+	defer srv.dispatcher.close()
+
+	// The first message occupies the only worker, the second fills the queue.
+	inFlight := postAsync(srv, "hot")
+	<-gate.started
+	queued := postAsync(srv, "hot")
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.dispatcher.depths()["hot"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second message never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	w := <-postAsync(srv, "hot")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if !strings.Contains(w.Body.String(), "queue_full") || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("body = %s, Retry-After = %q, want queue_full and 1", w.Body.String(), w.Header().Get("Retry-After"))
+	}
+	if got := srv.metrics.QueueRejected.Load(); got != 1 {
+		t.Errorf("QueueRejected = %d, want 1", got)
+	}
+
+	// Another topic is served while hot is saturated.
+	if w := <-postAsync(srv, "cold"); w.Code != http.StatusAccepted {
+		t.Errorf("cold status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	close(gate.release)
+	<-gate.started
+	for _, ch := range []<-chan *httptest.ResponseRecorder{inFlight, queued} {
+		if w := <-ch; w.Code != http.StatusAccepted {
+			t.Errorf("hot status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+	}
+	if got := gate.produced.Load(); got != 3 {
+		t.Errorf("produced = %d, want 3", got)
+	}
+}
+
+func TestProduceDispatcher_RetireAndClose(t *testing.T) {
+	mock := &mockProducer{}
+	d := newProduceDispatcher(mock, ProduceQueue{Depth: 1}, time.Now)
+	ctx := context.Background()
+
+	if err := d.Produce(ctx, "events", nil, []byte("1"), nil); err != nil {
+		t.Fatalf("Produce: %v", err)
+	}
+	d.mu.RLock()
+	q := d.topics["events"]
+	d.mu.RUnlock()
+
+	d.retire("events", q)
+	if len(d.depths()) != 0 {
+		t.Errorf("depths after retire = %v, want none", d.depths())
+	}
+	if err := d.Produce(ctx, "events", nil, []byte("2"), nil); err != nil {
+		t.Fatalf("Produce after retire: %v", err)
+	}
+
+	d.close()
+	if err := d.Produce(ctx, "events", nil, []byte("3"), nil); !errors.Is(err, errQueueFull) {
+		t.Errorf("Produce after close = %v, want errQueueFull", err)
+	}
+}
+
+// -------------------------------------------------------------------
+// /ready — overload thresholds
+// -------------------------------------------------------------------
+
+func TestReadyHandler_ErrorRateSustained(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Overload: OverloadThresholds{ErrorRate: 0.5, MinRequests: 4, SustainFor: 30 * time.Second},
+		Now:      func() time.Time { return now },
+	})
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		srv.readyHandler(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+
+	// Too few attempts for the rate to count.
+	srv.overload.observe(false)
+	srv.overload.observe(false)
+	if code := ready(); code != http.StatusOK {
+		t.Fatalf("ready with 2 failures = %d, want %d", code, http.StatusOK)
+	}
+
+	srv.overload.observe(false)
+	srv.overload.observe(true)
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("ready at the start of an overload = %d, want %d until it is sustained", code, http.StatusOK)
+	}
+
+	now = now.Add(30 * time.Second)
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("ready after 30s overloaded = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	// The failures age out of the one-minute window.
+	now = now.Add(time.Minute)
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("ready after recovery = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestReadyHandler_QueueSaturation(t *testing.T) {
+	gate := &gatedProducer{gatedTopic: "hot", started: make(chan string, 1), release: make(chan struct{})}
+	srv := NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     gate,
+		Auth:         auth.NewMultiAuth(nil, nil),
+		Logger:       zap.NewNop(),
+		ProduceQueue: ProduceQueue{Depth: 1, Workers: 1},
+		Overload:     OverloadThresholds{QueueSaturation: 1},
+	})
+	defer srv.dispatcher.close()
+
+	inFlight := postAsync(srv, "hot")
+	<-gate.started
+	queued := postAsync(srv, "hot")
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.dispatcher.depths()["hot"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second message never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	srv.readyHandler(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "overloaded") {
+		t.Errorf("ready with a full queue = %d %s, want 503 overloaded", w.Code, w.Body.String())
+	}
+
+	close(gate.release)
+	<-gate.started
+	<-inFlight
+	<-queued
+
+	w = httptest.NewRecorder()
+	srv.readyHandler(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("ready with drained queues = %d, want %d", w.Code, http.StatusOK)
+	}
+}
+
+// -------------------------------------------------------------------
+// /metrics — leader election
+// -------------------------------------------------------------------
+
+func TestMetricsHandler_Leader(t *testing.T) {
+	var leader atomic.Bool
+	for _, tt := range []struct {
+		isLeader func() bool
+		want     string
+	}{
+		{nil, ""},
+		{leader.Load, `"leader":false`},
+	} {
+		srv := NewServer(ServerConfig{
+			Port:     8080,
+			Producer: &mockProducer{isHealthy: true},
+			Auth:     auth.NewMultiAuth(nil, nil),
+			Logger:   zap.NewNop(),
+			IsLeader: tt.isLeader,
+		})
+		w := httptest.NewRecorder()
+		srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body := w.Body.String()
+		if tt.want == "" && strings.Contains(body, `"leader"`) {
+			t.Errorf("leader reported without leader election: %s", body)
+		}
+		if tt.want != "" && !strings.Contains(body, tt.want) {
+			t.Errorf("metrics = %s, want %s", body, tt.want)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// /metrics — delivery semantics
+// -------------------------------------------------------------------
+
+func TestMetricsHandler_Delivery(t *testing.T) {
+	for _, tt := range []struct {
+		delivery DeliverySemantics
+		want     string
+	}{
+		{DeliverySemantics{}, ""},
+		{DeliverySemantics{Mode: "transactional", Semantics: "at-least-once"}, `"delivery":{"mode":"transactional","semantics":"at-least-once"}`},
+	} {
+		srv := NewServer(ServerConfig{
+			Port:     8080,
+			Producer: &mockProducer{isHealthy: true},
+			Auth:     auth.NewMultiAuth(nil, nil),
+			Logger:   zap.NewNop(),
+			Delivery: tt.delivery,
+		})
+		w := httptest.NewRecorder()
+		srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := w.Body.String()
+		if tt.want == "" && strings.Contains(body, `"delivery"`) {
+			t.Errorf("delivery reported without a producer mode: %s", body)
+		}
+		if tt.want != "" && !strings.Contains(body, tt.want) {
+			t.Errorf("metrics = %s, want %s", body, tt.want)
+		}
+
+		w = httptest.NewRecorder()
+		srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics?format=prometheus", nil))
+		if got := strings.Contains(w.Body.String(), `kahook_producer_mode{mode="transactional"} 1`); got != (tt.want != "") {
+			t.Errorf("prometheus producer mode reported = %v: %s", got, w.Body.String())
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// /metrics — spool
+// -------------------------------------------------------------------
+
+func TestMetricsHandler_Spool(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		spool func() (SpoolStats, bool)
+		want  string
+	}{
+		{"disabled", nil, ""},
+		{"unreadable", func() (SpoolStats, bool) { return SpoolStats{}, false }, ""},
+		{"spooled", func() (SpoolStats, bool) {
+			return SpoolStats{Segments: 2, Bytes: 4096, OldestAgeSeconds: 90}, true
+		}, `"spool":{"segments":2,"bytes":4096,"oldest_age_seconds":90}`},
+		{"outage", func() (SpoolStats, bool) {
+			return SpoolStats{Segments: 1, Bytes: 4096, Outage: &SpoolOutageStats{Spooling: true, PendingSegments: 1, MessagesSpooled: 7}}, true
+		}, `"outage":{"spooling":true,"pending_segments":1,"messages_spooled":7,"messages_replayed":0}`},
+	} {
+		srv := NewServer(ServerConfig{
+			Port:     8080,
+			Producer: &mockProducer{isHealthy: true},
+			Auth:     auth.NewMultiAuth(nil, nil),
+			Logger:   zap.NewNop(),
+			Spool:    tt.spool,
+		})
+		w := httptest.NewRecorder()
+		srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		body := w.Body.String()
+		if tt.want == "" && strings.Contains(body, `"spool"`) {
+			t.Errorf("%s: spool reported: %s", tt.name, body)
+		}
+		if tt.want != "" && !strings.Contains(body, tt.want) {
+			t.Errorf("%s: metrics = %s, want %s", tt.name, body, tt.want)
+		}
+
+		w = httptest.NewRecorder()
+		srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics?format=prometheus", nil))
+		if got := strings.Contains(w.Body.String(), "kahook_spool_bytes 4096"); got != (tt.want != "") {
+			t.Errorf("%s: prometheus spool bytes reported = %v: %s", tt.name, got, w.Body.String())
+		}
+		if got := strings.Contains(w.Body.String(), "kahook_spool_messages_spooled_total 7"); got != (tt.name == "outage") {
+			t.Errorf("%s: prometheus spooled messages reported = %v: %s", tt.name, got, w.Body.String())
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// /metrics — config drift
+// -------------------------------------------------------------------
+
+func TestMetricsHandler_ConfigDrift(t *testing.T) {
+	for _, tt := range []struct {
+		configDrift func() (bool, bool)
+		want        string
+	}{
+		{nil, ""},
+		{func() (bool, bool) { return false, false }, ""},
+		{func() (bool, bool) { return true, true }, `"config_drift":true`},
+	} {
+		srv := NewServer(ServerConfig{
+			Port:        8080,
+			Producer:    &mockProducer{isHealthy: true},
+			Auth:        auth.NewMultiAuth(nil, nil),
+			Logger:      zap.NewNop(),
+			ConfigDrift: tt.configDrift,
+		})
+		w := httptest.NewRecorder()
+		srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body := w.Body.String()
+		if tt.want == "" && strings.Contains(body, `"config_drift"`) {
+			t.Errorf("config_drift reported before a drift check: %s", body)
+		}
+		if tt.want != "" && !strings.Contains(body, tt.want) {
+			t.Errorf("metrics = %s, want %s", body, tt.want)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// /metrics — broker events
+// -------------------------------------------------------------------
+
+func TestMetricsHandler_BrokerEvents(t *testing.T) {
+	for _, tt := range []struct {
+		brokerEvents func() map[string]int64
+		want         string
+	}{
+		{nil, ""},
+		{func() map[string]int64 { return map[string]int64{"all_brokers_down": 2} }, `"broker_events":{"all_brokers_down":2}`},
+	} {
+		srv := NewServer(ServerConfig{
+			Port:         8080,
+			Producer:     &mockProducer{isHealthy: true},
+			Auth:         auth.NewMultiAuth(nil, nil),
+			Logger:       zap.NewNop(),
+			BrokerEvents: tt.brokerEvents,
+		})
+		w := httptest.NewRecorder()
+		srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		body := w.Body.String()
+		if tt.want == "" && strings.Contains(body, `"broker_events"`) {
+			t.Errorf("broker_events reported without a kafka backend: %s", body)
+		}
+		if tt.want != "" && !strings.Contains(body, tt.want) {
+			t.Errorf("metrics = %s, want %s", body, tt.want)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// Clock skew — receive time and offset headers
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_ClockHeaders(t *testing.T) {
+	var (
+		offset   time.Duration
+		measured bool
+	)
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:        8080,
+		Producer:    producer,
+		Auth:        auth.NewMultiAuth(nil, nil),
+		Logger:      zap.NewNop(),
+		ClockOffset: func() (time.Duration, bool) { return offset, measured },
+	})
+	send := func() {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`))
+		req.Header.Set(clockOffsetHeader, "999999") // spoofed
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+	}
+
+	before := time.Now()
+	send()
+	received, err := time.Parse(time.RFC3339Nano, producer.headers[receivedAtHeader])
+	if err != nil || received.Before(before.Add(-time.Second)) || received.After(time.Now()) {
+		t.Errorf("%s = %q, want the receive time", receivedAtHeader, producer.headers[receivedAtHeader])
+	}
+	if got, ok := producer.headers[clockOffsetHeader]; ok {
+		t.Errorf("%s = %q before any measurement, want it removed", clockOffsetHeader, got)
+	}
+
+	offset, measured = -1500*time.Millisecond, true
+	send()
+	if got := producer.headers[clockOffsetHeader]; got != "-1500" {
+		t.Errorf("%s = %q, want -1500", clockOffsetHeader, got)
+	}
+
+	w := httptest.NewRecorder()
+	srv.metricsHandler(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `"clock_offset_ms":-1500`) {
+		t.Errorf("metrics = %s, want clock_offset_ms", w.Body)
+	}
+}
+
+func TestWebhookHandler_NoClockHeadersWithoutChecks(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), producer)
+	srv.webhookHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`)))
+	if _, ok := producer.headers[receivedAtHeader]; ok {
+		t.Errorf("%s set without clock checks", receivedAtHeader)
+	}
+}
+
+// -------------------------------------------------------------------
+// Security headers and hardened options
+// -------------------------------------------------------------------
+
+func TestSecurityHeaders(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		hsts     bool
+		tls      bool
+		wantHSTS bool
+	}{
+		{"plain http", false, false, false},
+		{"tls", false, true, true},
+		{"tls offloaded", true, false, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				Port:     8080,
+				Producer: &mockProducer{isHealthy: true},
+				Auth:     auth.NewMultiAuth(nil, nil),
+				Logger:   zap.NewNop(),
+				HSTS:     tt.hsts,
+			})
+			req := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if got := w.Header().Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q, want nosniff", got)
+			}
+			if got := w.Header().Get("Cache-Control"); got != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", got)
+			}
+			if got := w.Header().Get("Strict-Transport-Security"); (got != "") != tt.wantHSTS {
+				t.Errorf("Strict-Transport-Security = %q, want set: %v", got, tt.wantHSTS)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_TerseErrors(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:          8080,
+		Producer:      &mockProducer{isHealthy: true},
+		Auth:          auth.NewMultiAuth(nil, nil),
+		Logger:        zap.NewNop(),
+		AllowedTopics: []string{"orders"},
+		TerseErrors:   true,
+	})
+
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(`{}`)))
+
+	var resp ErrorResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusForbidden || resp.Error != "topic_not_allowed" {
+		t.Fatalf("response = %d %+v, want 403 topic_not_allowed", w.Code, resp)
+	}
+	if resp.Message != "Forbidden" {
+		t.Errorf("message = %q, want the status text only", resp.Message)
+	}
+}
+
+func TestWebhookHandler_StrictContentType(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantError   string
+	}{
+		{"json", "application/json", `{"a":1}`, http.StatusAccepted, ""},
+		{"binary", "application/octet-stream", "\x00\x01", http.StatusAccepted, ""},
+		{"missing content type", "", `{"a":1}`, http.StatusUnsupportedMediaType, "missing_content_type"},
+		{"malformed content type", "application/json;;", `{"a":1}`, http.StatusUnsupportedMediaType, "invalid_content_type"},
+		{"declared json that does not parse", "application/cloudevents+json", `{"a":`, http.StatusBadRequest, "invalid_json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer(ServerConfig{
+				Port:              8080,
+				Producer:          &mockProducer{isHealthy: true},
+				Auth:              auth.NewMultiAuth(nil, nil),
+				Logger:            zap.NewNop(),
+				StrictContentType: true,
+			})
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			srv.webhookHandler(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if tt.wantError != "" && !strings.Contains(w.Body.String(), tt.wantError) {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantError)
+			}
+		})
+	}
+}
+
+// -------------------------------------------------------------------
+// /admin/credentials — credential usage
+// -------------------------------------------------------------------
+
+func TestCredentialsHandler(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:        8080,
+		Producer:    &mockProducer{isHealthy: true},
+		Auth:        auth.NewMultiAuth(map[string]string{"alice": "pw", "bob": "pw"}, []string{"publish-secret"}),
+		MetricsAuth: auth.NewBearerAuth([]string{"scrape-secret"}),
+		Logger:      zap.NewNop(),
+	})
+	h := srv.Handler()
+
+	for range 2 {
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`))
+		req.SetBasicAuth("alice", "pw")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Metrics tokens cannot read credential usage.
+	req = httptest.NewRequest(http.MethodGet, "/admin/credentials", nil)
+	req.Header.Set("Authorization", "Bearer scrape-secret")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("metrics token status = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/credentials", nil)
+	req.Header.Set("Authorization", "Bearer publish-secret")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusOK)
+	}
+	if strings.Contains(w.Body.String(), "-secret") {
+		t.Errorf("response leaks a token: %s", w.Body.String())
+	}
+
+	var resp CredentialsResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]CredentialUsage)
+	for _, c := range resp.Credentials {
+		got[c.Role+"/"+c.Principal] = c
+	}
+	if len(got) != 4 {
+		t.Fatalf("credentials = %+v, want 4", resp.Credentials)
+	}
+	if c := got["publish/alice"]; c.Requests != 2 || c.LastUsed == nil || c.Scheme != auth.SchemeBasic {
+		t.Errorf("alice = %+v, want 2 basic requests", c)
+	}
+	if c := got["publish/bob"]; c.Requests != 0 || c.LastUsed != nil {
+		t.Errorf("bob = %+v, want unused", c)
+	}
+	if c := got["metrics/"+auth.TokenFingerprint("scrape-secret")]; c.Requests != 1 {
+		t.Errorf("metrics token = %+v, want 1 request", c)
+	}
+	// The listing request itself is counted.
+	if c := got["publish/"+auth.TokenFingerprint("publish-secret")]; c.Requests != 1 {
+		t.Errorf("publish token = %+v, want 1 request", c)
+	}
+}
+
+func TestCredentialUsage_WarnsOnDormantCredential(t *testing.T) {
+	core, logs := observer.New(zap.WarnLevel)
+	now := time.Unix(1_700_000_000, 0)
+	u := newCredentialUsage([]auth.Credential{{Principal: "alice", Scheme: auth.SchemeBasic}}, nil, time.Hour, zap.New(core), func() time.Time { return now })
+
+	u.record(rolePublish, "alice")
+	now = now.Add(30 * time.Minute)
+	u.record(rolePublish, "alice")
+	if logs.Len() != 0 {
+		t.Fatalf("warned after %d uses within the dormancy period", logs.Len())
+	}
+
+	now = now.Add(2 * time.Hour)
+	u.record(rolePublish, "alice")
+	if logs.FilterMessage("dormant credential used").Len() != 1 {
+		t.Errorf("no warning for a credential used after 2h unused")
+	}
+
+	u.record(rolePublish, "mallory") // not configured: ignored
+	if len(u.snapshot().Credentials) != 1 {
+		t.Error("snapshot includes an unconfigured principal")
+	}
+}
+
+// -------------------------------------------------------------------
+// /admin/usage — usage reports
+// -------------------------------------------------------------------
+
+func TestUsageReports(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(map[string]string{"alice": "pw", "bob": "pw"}, nil),
+		Logger:   zap.NewNop(),
+		Usage:    UsageReports{Interval: time.Hour, Topic: "kahook-usage", Instance: "kahook-0"},
+	})
+	h := srv.Handler()
+
+	send := func(user, path, body string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.SetBasicAuth(user, "pw")
+		// A sender cannot pick its own tenant.
+		req.Header.Set("Kahook-Tenant", "someone-else")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	getUsage := func() UsageResponse {
+		req := httptest.NewRequest(http.MethodGet, "/admin/usage", nil)
+		req.SetBasicAuth("alice", "pw")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("/admin/usage status = %d, want %d", w.Code, http.StatusOK)
+		}
+		var resp UsageResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	send("alice", "/orders", `{"id":1}`)
+	if got := producer.headers["Kahook-Tenant"]; got != "alice" {
+		t.Errorf("Kahook-Tenant = %q, want alice", got)
+	}
+	send("alice", "/orders", `{"id":22}`)
+	producer.produceErr = errors.New("broker down")
+	send("bob", "/events", `{}`)
+	producer.produceErr = nil
+
+	want := []UsageRecord{
+		{Tenant: "alice", Topic: "orders", Requests: 2, Bytes: 17, Messages: 2},
+		{Tenant: "bob", Topic: "events", Requests: 1, Bytes: 2, Messages: 0},
+	}
+	resp := getUsage()
+	if !slices.Equal(resp.Current.Usage, want) {
+		t.Errorf("current usage = %+v, want %+v", resp.Current.Usage, want)
+	}
+	if resp.Last != nil {
+		t.Errorf("last = %+v before any report, want none", resp.Last)
+	}
+
+	srv.usage.flush(context.Background())
+	if producer.topic != "kahook-usage" || string(producer.key) != "kahook-0" {
+		t.Fatalf("report produced to %q with key %q, want kahook-usage keyed by instance", producer.topic, producer.key)
+	}
+	var report UsageReport
+	if err := json.Unmarshal(producer.value, &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Instance != "kahook-0" || !slices.Equal(report.Usage, want) || report.End.Before(report.Start) {
+		t.Errorf("report = %+v, want instance kahook-0 and usage %+v", report, want)
+	}
+
+	resp = getUsage()
+	if len(resp.Current.Usage) != 0 {
+		t.Errorf("current usage after report = %+v, want empty", resp.Current.Usage)
+	}
+	if resp.Last == nil || !slices.Equal(resp.Last.Usage, want) {
+		t.Errorf("last = %+v, want the emitted report", resp.Last)
+	}
+}
+
+// -------------------------------------------------------------------
+// GeoIP — country header, metrics, and per-topic policy
+// -------------------------------------------------------------------
+
+// mockCountries resolves addresses from a fixed table.
+type mockCountries map[string]string
+
+func (m mockCountries) Country(addr netip.Addr) (string, error) {
+	return m[addr.String()], nil
+}
+
+func TestWebhookHandler_GeoIP(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:          8080,
+		Producer:      producer,
+		Auth:          auth.NewMultiAuth(nil, nil),
+		Logger:        zap.NewNop(),
+		GeoIP:         mockCountries{"81.2.69.142": "DE", "2001:db8::1": "FR", "198.51.100.7": "US"},
+		CountryHeader: "kahook-country",
+		Topics: map[string]TopicOptions{
+			"payments.eu": {Countries: CountryPolicy{Allow: []string{"DE", "FR"}}},
+			"orders":      {Countries: CountryPolicy{Deny: []string{"US"}}},
+		},
+	})
+
+	tests := []struct {
+		topic       string
+		remoteAddr  string
+		wantStatus  int
+		wantCountry string
+	}{
+		{"payments.eu", "81.2.69.142:40000", http.StatusAccepted, "DE"},
+		{"payments.eu", "[2001:db8::1]:40000", http.StatusAccepted, "FR"},
+		{"payments.eu", "198.51.100.7:40000", http.StatusForbidden, ""},
+		{"payments.eu", "10.0.0.1:40000", http.StatusForbidden, ""}, // unknown country
+		{"orders", "198.51.100.7:40000", http.StatusForbidden, ""},
+		{"orders", "10.0.0.1:40000", http.StatusAccepted, ""},
+		{"events", "198.51.100.7:40000", http.StatusAccepted, "US"},
+	}
+	for _, tt := range tests {
+		producer.headers = nil
+		req := httptest.NewRequest(http.MethodPost, "/"+tt.topic, strings.NewReader(`{}`))
+		req.RemoteAddr = tt.remoteAddr
+		req.Header.Set("Kahook-Country", "XX") // spoofed by the client
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s from %s: status = %d, want %d: %s", tt.topic, tt.remoteAddr, w.Code, tt.wantStatus, w.Body.String())
+			continue
+		}
+		if w.Code == http.StatusForbidden {
+			if !strings.Contains(w.Body.String(), "country_not_allowed") {
+				t.Errorf("%s from %s: body = %s, want country_not_allowed", tt.topic, tt.remoteAddr, w.Body.String())
+			}
+			continue
+		}
+		got, ok := producer.headers["Kahook-Country"]
+		if tt.wantCountry == "" && ok {
+			t.Errorf("%s from %s: Kahook-Country = %q, want none", tt.topic, tt.remoteAddr, got)
+		} else if got != tt.wantCountry {
+			t.Errorf("%s from %s: Kahook-Country = %q, want %q", tt.topic, tt.remoteAddr, got, tt.wantCountry)
+		}
+	}
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.CountryRejected != 3 {
+		t.Errorf("country_rejected = %d, want 3", snap.CountryRejected)
+	}
+	if got := snap.Topics["payments.eu"].Countries; got["DE"] != 1 || got["FR"] != 1 {
+		t.Errorf("payments.eu countries = %v, want DE and FR once each", got)
+	}
+	if got := snap.Topics["orders"].Countries; got[unknownCountry] != 1 {
+		t.Errorf("orders countries = %v, want one unknown", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Allowed networks — per-topic source CIDRs behind trusted proxies
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_AllowedNetworks(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		ClientIP: ClientIP{TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+		Topics: map[string]TopicOptions{
+			"github": {Networks: []netip.Prefix{netip.MustParsePrefix("192.30.252.0/22"), netip.MustParsePrefix("2001:db8::/32")}},
+		},
+	})
+
+	tests := []struct {
+		name       string
+		topic      string
+		remoteAddr string
+		forwarded  []string
+		wantStatus int
+	}{
+		{"direct from range", "github", "192.30.252.10:40000", nil, http.StatusAccepted},
+		{"direct IPv6 from range", "github", "[2001:db8::1]:40000", nil, http.StatusAccepted},
+		{"direct from elsewhere", "github", "198.51.100.7:40000", nil, http.StatusForbidden},
+		{"untrusted peer spoofing the header", "github", "198.51.100.7:40000", []string{"192.30.252.10"}, http.StatusForbidden},
+		{"through trusted proxies", "github", "10.0.0.2:40000", []string{"203.0.113.9, 192.30.252.10, 10.0.0.5"}, http.StatusAccepted},
+		{"client prepending a spoofed hop", "github", "10.0.0.2:40000", []string{"192.30.252.10, 198.51.100.7"}, http.StatusForbidden},
+		{"hops on separate lines", "github", "10.0.0.2:40000", []string{"198.51.100.7", "192.30.252.10"}, http.StatusAccepted},
+		{"malformed hop", "github", "10.0.0.2:40000", []string{"192.30.252.10, unknown"}, http.StatusForbidden},
+		{"trusted proxy without the header", "github", "10.0.0.2:40000", nil, http.StatusForbidden},
+		{"topic without networks", "orders", "198.51.100.7:40000", nil, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/"+tt.topic, strings.NewReader(`{}`))
+		req.RemoteAddr = tt.remoteAddr
+		for _, v := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, w.Code, tt.wantStatus, w.Body.String())
+			continue
+		}
+		if w.Code == http.StatusForbidden && !strings.Contains(w.Body.String(), "ip_not_allowed") {
+			t.Errorf("%s: body = %s, want ip_not_allowed", tt.name, w.Body.String())
+		}
+	}
+	if got := srv.metrics.NetworkRejected.Load(); got != 5 {
+		t.Errorf("network_rejected = %d, want 5", got)
+	}
+}
+
+func TestWebhookHandler_GeoIPDisabled(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), producer)
+
+	req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`))
+	req.Header.Set("Kahook-Country", "XX")
+	w := httptest.NewRecorder()
+	srv.webhookHandler(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	// Without GeoIP the header is an ordinary client header.
+	if got := producer.headers["Kahook-Country"]; got != "XX" {
+		t.Errorf("Kahook-Country = %q, want the client's value", got)
+	}
+	if c := newMetricsSnapshot(srv.metrics).Topics["events"].Countries; c != nil {
+		t.Errorf("countries = %v, want none without GeoIP", c)
+	}
+}
+
+// -------------------------------------------------------------------
+// Scanner noise suppression
+// -------------------------------------------------------------------
+
+func TestScannerPaths_Match(t *testing.T) {
+	sp := newScannerPaths([]string{"/.env", "/wp-admin/", "/vendor/phpunit", "orders"}, func(p string) bool { return p == "orders" })
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/.env", true},
+		{"/.env/", true},
+		{"/wp-admin", true},
+		{"/WP-Admin/install.php", true},
+		{"/vendor/phpunit/src/Util/PHP/eval-stdin.php", true},
+		{"/wp-administrators", false},
+		{"/.environment", false},
+		{"/vendor", false},
+		{"/orders", false}, // a served topic is never rejected
+		{"/events", false},
+	}
+	for _, tt := range tests {
+		if got := sp.match(tt.path); got != tt.want {
+			t.Errorf("match(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestRejectScanners(t *testing.T) {
+	core, logs := observer.New(zap.DebugLevel)
+	srv := NewServer(ServerConfig{
+		Port:          8080,
+		Producer:      &mockProducer{isHealthy: true},
+		Auth:          auth.NewMultiAuth(nil, []string{"tok"}),
+		Logger:        zap.New(core),
+		AllowedTopics: []string{"robots.txt"},
+		ScannerPaths:  []string{"/.env", "/wp-admin", "/robots.txt"},
+	})
+	h := srv.Handler()
+
+	for _, path := range []string{"/.env", "/wp-admin/setup-config.php"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", path, w.Code, http.StatusNotFound)
+		}
+		if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%s: missing security headers", path)
+		}
+	}
+
+	// An allowed topic on the list is served as usual.
+	req := httptest.NewRequest(http.MethodPost, "/robots.txt", strings.NewReader(`{}`))
+	req.Header.Set("Authorization", "Bearer tok")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("/robots.txt: status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.ScannerRejected != 2 {
+		t.Errorf("scanner_rejected = %d, want 2", snap.ScannerRejected)
+	}
+	if snap.RequestsTotal != 1 || snap.RequestsError != 0 {
+		t.Errorf("requests_total = %d, requests_error = %d; want only the webhook counted", snap.RequestsTotal, snap.RequestsError)
+	}
+	if n := logs.FilterLevelExact(zap.InfoLevel).FilterMessage("request").Len(); n != 1 {
+		t.Errorf("logged %d requests at info, want 1", n)
+	}
+	if n := logs.FilterMessage("scanner request rejected").FilterLevelExact(zap.DebugLevel).Len(); n != 2 {
+		t.Errorf("logged %d scanner rejections at debug, want 2", n)
+	}
+}
+
+// -------------------------------------------------------------------
+// /_kahook/console — dev profile test console
+// -------------------------------------------------------------------
+
+func sendConsole(t *testing.T, h http.Handler, creq ConsoleRequest) ConsoleResponse {
+	t.Helper()
+	body, _ := json.Marshal(creq)
+	req := httptest.NewRequest(http.MethodPost, "/_kahook/console/send", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("console send status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+	var resp ConsoleResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestConsole(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:       8080,
+		Producer:   producer,
+		Auth:       auth.NewMultiAuth(nil, []string{"tok"}),
+		Logger:     zap.NewNop(),
+		DevProfile: true,
+		Topics:     map[string]TopicOptions{"files": {Payload: PayloadBase64}},
+	})
+	h := srv.Handler()
+
+	req := httptest.NewRequest(http.MethodGet, "/_kahook/console", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "console.js") {
+		t.Fatalf("console page status = %d: %s", w.Code, w.Body.String())
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self'") {
+		t.Errorf("console CSP = %q, want its own script allowed", csp)
+	}
+
+	resp := sendConsole(t, h, ConsoleRequest{
+		Topic:   "orders",
+		Headers: map[string]string{"Authorization": "Bearer tok", "Content-Type": "application/json", "X-Webhook-Key": "order-1"},
+		Body:    `{"id":1}`,
+	})
+	if resp.Status != http.StatusAccepted || resp.Message == nil {
+		t.Fatalf("response = %+v, want 202 with a message", resp)
+	}
+	if m := resp.Message; m.Topic != "orders" || m.Key != "order-1" || m.Value != `{"id":1}` || m.Headers[payloadEncodingHeader] != encodingRaw {
+		t.Errorf("message = %+v", m)
+	}
+	if resp.Headers[http.CanonicalHeaderKey(RequestIDHeader)] == "" {
+		t.Error("response headers lack the request ID")
+	}
+
+	// Rejected before producing: no message.
+	resp = sendConsole(t, h, ConsoleRequest{Topic: "orders", Body: `{}`})
+	if resp.Status != http.StatusUnauthorized || resp.Message != nil || !strings.Contains(string(resp.Response), "unauthorized") {
+		t.Errorf("unauthenticated response = %+v, want 401 without a message", resp)
+	}
+
+	// Binary values are shown base64-encoded; delivery failures are reported.
+	producer.produceErr = errors.New("broker down")
+	resp = sendConsole(t, h, ConsoleRequest{
+		Topic:   "files",
+		Headers: map[string]string{"Authorization": "Bearer tok", "Content-Type": "application/octet-stream"},
+		Body:    "\xff\xfe",
+	})
+	if resp.Status != http.StatusInternalServerError || resp.Message == nil || resp.Message.DeliveryError != "broker down" {
+		t.Fatalf("failed delivery response = %+v", resp)
+	}
+	if resp.Message.ValueEncoding != "utf-8" {
+		t.Errorf("base64 envelope value encoding = %q, want utf-8", resp.Message.ValueEncoding)
+	}
+}
+
+func TestConsole_Validation(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:       8080,
+		Producer:   &mockProducer{isHealthy: true},
+		Auth:       auth.NewMultiAuth(nil, nil),
+		Logger:     zap.NewNop(),
+		DevProfile: true,
+	})
+	h := srv.Handler()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+	}{
+		{"form post", "application/x-www-form-urlencoded", `topic=orders`, http.StatusUnsupportedMediaType},
+		{"malformed", "application/json", `{`, http.StatusBadRequest},
+		{"path topic", "application/json", `{"topic":"_kahook/console/send","body":"{}"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/_kahook/console/send", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantStatus)
+		}
+	}
+}
+
+func TestConsole_OnlyInDevProfile(t *testing.T) {
+	srv := setupTestServer(auth.NewMultiAuth(nil, nil), &mockProducer{isHealthy: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/_kahook/console", nil)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code == http.StatusOK {
+		t.Errorf("console served outside the dev profile")
+	}
+}
+
+// -------------------------------------------------------------------
+// Fixture recording
+// -------------------------------------------------------------------
+
+func TestRecordFixtures(t *testing.T) {
+	dir := t.TempDir()
+	srv := NewServer(ServerConfig{
+		Port:          8080,
+		Producer:      &mockProducer{isHealthy: true},
+		Auth:          auth.NewMultiAuth(nil, []string{"tok-secret"}),
+		Logger:        zap.NewNop(),
+		RecordDir:     dir,
+		RecordSecrets: []string{"tok-secret", "hunter22"},
+	})
+	h := srv.Handler()
+
+	req := httptest.NewRequest(http.MethodPost, "/github", strings.NewReader(`{"password":"hunter22","ref":"main"}`))
+	req.Header.Set("Authorization", "Bearer tok-secret")
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set("X-Github-Event", "push")
+	req.Header.Set("X-Echo", "hunter22")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/github", strings.NewReader(`{}`)) // unauthenticated
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+
+	fixtures, err := fixture.LoadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 2 {
+		t.Fatalf("recorded %d fixtures, want 2", len(fixtures))
+	}
+	f := fixtures[0]
+	if f.Path != "/github" || f.Status != http.StatusAccepted || f.Headers.Get("X-Github-Event") != "push" {
+		t.Errorf("fixture = %+v", f)
+	}
+	if f.Headers.Get("Authorization") != "" || f.Headers.Get("X-Forwarded-For") != "" {
+		t.Errorf("fixture keeps credential or address headers: %v", f.Headers)
+	}
+	if strings.Contains(f.Body, "hunter22") || f.Headers.Get("X-Echo") != redact.Placeholder {
+		t.Errorf("fixture keeps a secret: body %s, headers %v", f.Body, f.Headers)
+	}
+	if fixtures[1].Status != http.StatusUnauthorized {
+		t.Errorf("second fixture status = %d, want %d", fixtures[1].Status, http.StatusUnauthorized)
+	}
+}
+
+func TestFixtureName(t *testing.T) {
+	tests := map[string]string{
+		"/github":                      "github",
+		"/a/../../etc":                 "a_.._.._etc",
+		"/":                            "root",
+		"/..":                          "root",
+		"/scm.events":                  "scm.events",
+		"/" + strings.Repeat("x", 100): strings.Repeat("x", 64),
+	}
+	for path, want := range tests {
+		if got := fixtureName(path); got != want {
+			t.Errorf("fixtureName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// Live tail — /admin/tail event stream
+// -------------------------------------------------------------------
+
+func TestTail(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth: auth.NewMultiAuth(map[string]string{"alice": "pw", "shop": "pw"}, nil).
+			WithScopes(map[string][]string{"shop": {"orders"}}, false),
+		Logger: zap.NewNop(),
+		Tail:   LiveTail{MaxSubscribers: 1, MaxBodyBytes: 8},
+	})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	getAs := func(user, query string) *http.Response {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/admin/tail"+query, nil)
+		if user != "" {
+			req.SetBasicAuth(user, "pw")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	get := func(query string, authed bool) *http.Response {
+		if authed {
+			return getAs("alice", query)
+		}
+		return getAs("", query)
+	}
+
+	for _, tc := range []struct {
+		user  string
+		query string
+		want  int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"alice", "?sample=0", http.StatusBadRequest},
+		{"alice", "?sample=1.5", http.StatusBadRequest},
+		{"alice", "?body=9", http.StatusBadRequest},
+		{"alice", "?topic=bad/topic", http.StatusBadRequest},
+		// Scoped credentials tail only their own topics, by name.
+		{"shop", "", http.StatusForbidden},
+		{"shop", "?topic=payments", http.StatusForbidden},
+	} {
+		resp := getAs(tc.user, tc.query)
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("GET /admin/tail%s as %q status = %d, want %d", tc.query, tc.user, resp.StatusCode, tc.want)
+		}
+	}
+
+	stream := get("?topic=orders&body=4", true)
+	defer stream.Body.Close()
+	if stream.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", stream.StatusCode, http.StatusOK)
+	}
+	if ct := stream.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Content-Type = %q, want text/event-stream", ct)
+	}
+	events := bufio.NewReader(stream.Body)
+	if line, _ := events.ReadString('\n'); !strings.HasPrefix(line, ": tailing orders") {
+		t.Fatalf("first line = %q, want the tailing comment", line)
+	}
+
+	busy := get("", true)
+	busy.Body.Close()
+	if busy.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("second stream status = %d, want %d", busy.StatusCode, http.StatusServiceUnavailable)
+	}
+
+	send := func(path, body string) {
+		req, _ := http.NewRequest(http.MethodPost, ts.URL+path, strings.NewReader(body))
+		req.SetBasicAuth("alice", "pw")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Webhook-Key", "k1")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// Only the tailed topic is streamed.
+	send("/events", `{"skip":true}`)
+	send("/orders", `{"id":1}`)
+
+	var event, data string
+	for data == "" {
+		line, err := events.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = strings.TrimSpace(v)
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	if event != "message" {
+		t.Errorf("event = %q, want message", event)
+	}
+	var ev TailEvent
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Topic != "orders" || ev.Principal != "alice" || ev.Key != "k1" || ev.MessageID == "" {
+		t.Errorf("event = %+v, want orders from alice keyed k1", ev)
+	}
+	if ev.Body != `{"id` || !ev.BodyTruncated || ev.Size != 8 {
+		t.Errorf("body = %q (truncated %v, size %d), want first 4 of 8 bytes", ev.Body, ev.BodyTruncated, ev.Size)
+	}
+
+	// Shutdown ends open streams rather than waiting on them.
+	srv.tail.close()
+	if _, err := io.ReadAll(events); err != nil {
+		t.Errorf("reading closed stream: %v", err)
+	}
+}
+
+// -------------------------------------------------------------------
+// Startup summary
+// -------------------------------------------------------------------
+
+func TestLogSummary(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	srv := NewServer(ServerConfig{
+		Port:          8080,
+		Producer:      &mockProducer{isHealthy: true},
+		Auth:          auth.NewMultiAuth(map[string]string{"alice": "pw"}, []string{"tok"}),
+		Logger:        zap.New(core),
+		AllowedTopics: []string{"github-events", "orders"},
+		RoutePaths:    map[string]string{"github": "github-events"},
+		Topics: map[string]TopicOptions{
+			"orders":  {Payload: PayloadBase64, Priority: PriorityHigh},
+			"payment": {Response: ResponseText},
+		},
+		Usage: UsageReports{Interval: time.Hour},
+	})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	srv.logSummary(ln)
+
+	entries := logs.FilterMessage("startup summary").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d startup summaries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if got := fields["listener"]; got != "http://"+ln.Addr().String() {
+		t.Errorf("listener = %v", got)
+	}
+	wantRoutes := []any{
+		"/github -> github-events (auth=basic|bearer)",
+		"/github-events -> github-events (auth=basic|bearer)",
+		"/orders -> orders (auth=basic|bearer, payload=base64, priority=high)",
+	}
+	if got, _ := fields["routes"].([]any); !slices.Equal(got, wantRoutes) {
+		t.Errorf("routes = %v, want %v", got, wantRoutes)
+	}
+	wantEndpoints := []any{"/admin/credentials", "/admin/usage"}
+	if got, _ := fields["endpoints"].([]any); !slices.Equal(got, wantEndpoints) {
+		t.Errorf("endpoints = %v, want %v", got, wantEndpoints)
+	}
+	if got, _ := fields["features"].([]any); !slices.Equal(got, []any{"usage_reports"}) {
+		t.Errorf("features = %v, want [usage_reports]", got)
+	}
+
+	// "payment" has options but the allowlist rejects it, likely a typo.
+	warned := logs.FilterMessage("topic options configured for a topic no path accepts").All()
+	if len(warned) != 1 || warned[0].ContextMap()["topic"] != "payment" {
+		t.Errorf("unreachable topic warnings = %v, want one for payment", warned)
+	}
+}
+
+func TestRouteSummary_AnyTopic(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+	})
+	if got := srv.routeSummary(); !slices.Equal(got, []string{"/{topic} -> {topic} (auth=none)"}) {
+		t.Errorf("routeSummary() = %v", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Quarantine — soft policy violations
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_Quarantine(t *testing.T) {
+	newServer := func(producer *mockProducer, q Quarantine) http.Handler {
+		return NewServer(ServerConfig{
+			Port:           8080,
+			Producer:       producer,
+			Auth:           auth.NewMultiAuth(nil, nil),
+			Logger:         zap.NewNop(),
+			MaxHeaderBytes: 256,
+			Quarantine:     q,
+			Topics:         map[string]TopicOptions{"orders": {Payload: PayloadJSONOnly}},
+		}).Handler()
+	}
+	send := func(h http.Handler, path, contentType, body string, bigHeaders bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		if bigHeaders {
+			req.Header.Set("X-Trace-Blob", strings.Repeat("a", 300))
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("rejected without quarantine", func(t *testing.T) {
+		h := newServer(&mockProducer{isHealthy: true}, Quarantine{})
+		if w := send(h, "/events", "application/json", `{}`, true); w.Code != http.StatusRequestHeaderFieldsTooLarge {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusRequestHeaderFieldsTooLarge)
+		}
+		if w := send(h, "/events", "application/json", `{}`, false); w.Code != http.StatusAccepted {
+			t.Errorf("status under the limit = %d, want %d", w.Code, http.StatusAccepted)
+		}
+	})
+
+	t.Run("oversized headers quarantined", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		srv := NewServer(ServerConfig{
+			Port:           8080,
+			Producer:       producer,
+			Auth:           auth.NewMultiAuth(nil, nil),
+			Logger:         zap.NewNop(),
+			MaxHeaderBytes: 256,
+			Quarantine:     Quarantine{Topic: "kahook.quarantine"},
+		})
+		w := send(srv.Handler(), "/events", "application/json", `{"id":1}`, true)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusAccepted)
+		}
+		var resp map[string]string
+		_ = json.NewDecoder(w.Body).Decode(&resp)
+		if resp["status"] != "quarantined" || resp["violation"] != ViolationHeaderSize {
+			t.Errorf("response = %v, want quarantined for header_size", resp)
+		}
+		if producer.topic != "kahook.quarantine" || string(producer.value) != `{"id":1}` {
+			t.Errorf("produced %q to %q, want the body on the quarantine topic", producer.value, producer.topic)
+		}
+		if producer.headers[violationHeader] != ViolationHeaderSize || producer.headers[originalTopicHeader] != "events" {
+			t.Errorf("headers = %v, want violation and original topic", producer.headers)
+		}
+		if !strings.Contains(producer.headers[violationDetailHeader], "256") {
+			t.Errorf("violation detail = %q, want the limit", producer.headers[violationDetailHeader])
+		}
+		if got := srv.metrics.Quarantined.Load(); got != 1 {
+			t.Errorf("quarantined = %d, want 1", got)
+		}
+	})
+
+	t.Run("only listed violations quarantined", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		h := newServer(producer, Quarantine{Topic: "kahook.quarantine", Violations: []string{ViolationHeaderSize}})
+		if w := send(h, "/orders", "text/plain", "hello", false); w.Code != http.StatusUnsupportedMediaType {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusUnsupportedMediaType)
+		}
+		if producer.topic != "" {
+			t.Errorf("produced to %q, want nothing", producer.topic)
+		}
+	})
+
+	t.Run("content violations quarantined", func(t *testing.T) {
+		producer := &mockProducer{isHealthy: true}
+		h := newServer(producer, Quarantine{Topic: "kahook.quarantine"})
+		for body, want := range map[string]string{"hello": ViolationNotJSON, `{"id":`: ViolationInvalidJSON} {
+			contentType := "text/plain"
+			if want == ViolationInvalidJSON {
+				contentType = "application/json"
+			}
+			if w := send(h, "/orders", contentType, body, false); w.Code != http.StatusAccepted {
+				t.Errorf("%s: status = %d, want %d", want, w.Code, http.StatusAccepted)
+			}
+			if producer.headers[violationHeader] != want || string(producer.value) != body {
+				t.Errorf("%s: produced %q with violation %q", want, producer.value, producer.headers[violationHeader])
+			}
+		}
+	})
+}
+
+// -------------------------------------------------------------------
+// Tracing headers — forward, strip, parent
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_TraceHeaders(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		inbound = "00-" + traceID + "-00f067aa0ba902b7-01"
+	)
+	send := func(policy TraceHeaders, h map[string]string) map[string]string {
+		producer := &mockProducer{isHealthy: true}
+		srv := NewServer(ServerConfig{
+			Port:         8080,
+			Producer:     producer,
+			Auth:         auth.NewMultiAuth(nil, nil),
+			Logger:       zap.NewNop(),
+			TraceHeaders: policy,
+		})
+		req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Source", "github")
+		for k, v := range h {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("%s: status = %d, want %d", policy, w.Code, http.StatusAccepted)
+		}
+		return producer.headers
+	}
+
+	inboundHeaders := map[string]string{"traceparent": inbound, "tracestate": "vendor=1", "b3": traceID + "-00f067aa0ba902b7-1"}
+	if got := send("", inboundHeaders); got["Traceparent"] != inbound || got["B3"] == "" {
+		t.Errorf("forward: headers = %v, want tracing headers forwarded", got)
+	}
+
+	got := send(TraceStrip, inboundHeaders)
+	for _, name := range []string{"Traceparent", "Tracestate", "B3", traceparentHeader} {
+		if _, ok := got[name]; ok {
+			t.Errorf("strip: header %s forwarded", name)
+		}
+	}
+	if got["X-Source"] != "github" {
+		t.Errorf("strip: headers = %v, want other headers kept", got)
+	}
+
+	got = send(TraceParent, inboundHeaders)
+	parent, ok := parseTraceparent(got[traceparentHeader])
+	if !ok || parent.traceID != traceID || parent.spanID == "00f067aa0ba902b7" || !parent.sampled {
+		t.Errorf("parent: traceparent = %q, want a child span of %s", got[traceparentHeader], inbound)
+	}
+	if got["tracestate"] != "vendor=1" || got["Traceparent"] != "" || got["B3"] != "" {
+		t.Errorf("parent: headers = %v, want only traceparent and tracestate", got)
+	}
+
+	got = send(TraceParent, nil)
+	if root, ok := parseTraceparent(got[traceparentHeader]); !ok || root.traceID == traceID {
+		t.Errorf("parent without inbound context: traceparent = %q, want a new trace", got[traceparentHeader])
+	}
+}
+
+// spanRecorder collects exported spans.
+type spanRecorder struct {
+	spans []otlp.Span
+}
+
+func (r *spanRecorder) Export(s otlp.Span) { r.spans = append(r.spans, s) }
+
+func TestWebhookHandler_Spans(t *testing.T) {
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		inbound = "00-" + traceID + "-00f067aa0ba902b7-01"
+	)
+	producer := &mockProducer{isHealthy: true}
+	spans := &spanRecorder{}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Spans:    spans,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{"id":1}`))
+	req.Header.Set("traceparent", inbound)
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", w.Code)
+	}
+
+	if len(spans.spans) != 2 {
+		t.Fatalf("exported %d spans, want a producer and a server span", len(spans.spans))
+	}
+	produce, server := spans.spans[0], spans.spans[1]
+	if server.Kind != otlp.KindServer || server.TraceID != traceID || server.ParentSpanID != "00f067aa0ba902b7" || server.Name != "POST /{topic}" {
+		t.Errorf("server span = %+v, want a child of the inbound context", server)
+	}
+	if produce.Kind != otlp.KindProducer || produce.TraceID != traceID || produce.ParentSpanID != server.SpanID || produce.Name != "send events" || produce.Error != "" {
+		t.Errorf("producer span = %+v, want a child of the server span", produce)
+	}
+	if !slices.Contains(server.Attributes, otlp.Int("http.response.status_code", http.StatusAccepted)) {
+		t.Errorf("server span attributes = %v, want the status code", server.Attributes)
+	}
+	if got := producer.headers[traceparentHeader]; got != "00-"+traceID+"-"+produce.SpanID+"-01" {
+		t.Errorf("traceparent = %q, want the producer span", got)
+	}
+	if _, ok := producer.headers["Traceparent"]; ok {
+		t.Error("inbound traceparent forwarded alongside kahook's")
+	}
+
+	// Unsampled traces are propagated but not recorded.
+	spans.spans = nil
+	req = httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{"id":1}`))
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-00")
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if len(spans.spans) != 0 {
+		t.Errorf("exported %d spans for an unsampled trace", len(spans.spans))
+	}
+	if tc, ok := parseTraceparent(producer.headers[traceparentHeader]); !ok || tc.sampled || tc.traceID != traceID {
+		t.Errorf("traceparent = %q, want the unsampled trace continued", producer.headers[traceparentHeader])
+	}
+
+	// Produce failures mark both spans failed.
+	spans.spans = nil
+	producer.produceErr = errors.New("broker: topic authorization failed")
+	req = httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{"id":1}`))
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if len(spans.spans) != 2 || spans.spans[0].Error == "" || spans.spans[1].Error == "" || spans.spans[1].ParentSpanID != "" {
+		t.Errorf("spans = %+v, want a new trace with both spans failed", spans.spans)
+	}
+}
+
+func TestParseTraceContext(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    traceContext
+		ok      bool
+	}{
+		{
+			"traceparent unsampled",
+			map[string]string{"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"},
+			traceContext{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false}, true,
+		},
+		{
+			"b3 single with 64-bit trace id",
+			map[string]string{"b3": "a3ce929d0e0e4736-00F067AA0BA902B7-1"},
+			traceContext{"0000000000000000a3ce929d0e0e4736", "00f067aa0ba902b7", true}, true,
+		},
+		{
+			"b3 multi",
+			map[string]string{"X-B3-TraceId": "4bf92f3577b34da6a3ce929d0e0e4736", "X-B3-SpanId": "00f067aa0ba902b7", "X-B3-Sampled": "0"},
+			traceContext{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false}, true,
+		},
+		{
+			"cloud trace",
+			map[string]string{"X-Cloud-Trace-Context": "4bf92f3577b34da6a3ce929d0e0e4736/1;o=1"},
+			traceContext{"4bf92f3577b34da6a3ce929d0e0e4736", "0000000000000001", true}, true,
+		},
+		{
+			"invalid traceparent falls back to b3",
+			map[string]string{"traceparent": "00-0000-bad", "b3": "4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7"},
+			traceContext{"4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true}, true,
+		},
+		{"all-zero trace id", map[string]string{"traceparent": "00-00000000000000000000000000000000-00f067aa0ba902b7-01"}, traceContext{}, false},
+		{"b3 sampling only", map[string]string{"b3": "1"}, traceContext{}, false},
+		{"none", nil, traceContext{}, false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		for k, v := range tt.headers {
+			h.Set(k, v)
+		}
+		got, ok := parseTraceContext(h)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: parseTraceContext() = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// Webhook signatures
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_Signature(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Topics: map[string]TopicOptions{
+			"github": {Signature: signature.NewGitHub([]byte("It's a Secret to Everybody"))},
+		},
+	})
+	const valid = "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+
+	for _, tt := range []struct {
+		path, sig string
+		want      int
+	}{
+		{"/github", valid, http.StatusAccepted},
+		{"/github", "sha256=00", http.StatusUnauthorized},
+		{"/github", "", http.StatusUnauthorized},
+		{"/other", "", http.StatusAccepted},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader("Hello, World!"))
+		if tt.sig != "" {
+			req.Header.Set("X-Hub-Signature-256", tt.sig)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != tt.want {
+			t.Errorf("POST %s with signature %q = %d, want %d", tt.path, tt.sig, w.Code, tt.want)
+		}
+		if tt.want == http.StatusUnauthorized && !strings.Contains(w.Body.String(), "invalid_signature") {
+			t.Errorf("body = %s, want invalid_signature", w.Body.String())
+		}
+	}
+	if got := srv.metrics.SignatureRejected.Load(); got != 2 {
+		t.Errorf("signature_rejected = %d, want 2", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Route headers — static message headers per path
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_RouteHeaders(t *testing.T) {
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:       8080,
+		Producer:   producer,
+		Auth:       auth.NewMultiAuth(nil, nil),
+		Logger:     zap.NewNop(),
+		RoutePaths: map[string]string{"github": "scm.events", "gitlab": "scm.events"},
+		RouteHeaders: map[string]map[string]string{
+			"github": {"source": "github", "env": "prod"},
+			"gitlab": {"source": "gitlab"},
+		},
+	})
+
+	for _, tt := range []struct{ path, want string }{{"/github", "github"}, {"/gitlab", "gitlab"}} {
+		path, want := tt.path, tt.want
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{}`))
+		req.Header.Set("Source", "spoofed")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("POST %s = %d, want %d", path, w.Code, http.StatusAccepted)
+		}
+		if producer.headers["source"] != want || producer.headers["Source"] != "" {
+			t.Errorf("POST %s: headers = %v, want source=%s replacing the request's", path, producer.headers, want)
+		}
+		if producer.headers[messageIDHeader] == "" {
+			t.Errorf("POST %s: headers = %v, want kahook's headers kept", path, producer.headers)
+		}
+	}
+	if producer.headers["env"] != "" {
+		t.Errorf("gitlab message carries github's env header: %v", producer.headers)
+	}
+}
+
+// -------------------------------------------------------------------
+// Key hashing — PII message keys
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_KeyHash(t *testing.T) {
+	const (
+		email = "alice@example.com"
+		// printf alice@example.com | sha256sum
+		plain = "ff8d9819fc0e12bf0d24892e45987e249a28dce836a85cad60e28eaaa8c6d976"
+	)
+	peppered := NewKeyHasher([]byte("pepper"))
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Topics: map[string]TopicOptions{
+			"users":  {KeyHash: NewKeyHasher(nil)},
+			"signup": {KeyHash: peppered},
+		},
+	})
+	send := func(topic string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{}`))
+		req.Header.Set("X-Webhook-Key", email)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("POST /%s = %d, want %d", topic, w.Code, http.StatusAccepted)
+		}
+	}
+
+	send("users")
+	if string(producer.key) != plain {
+		t.Errorf("key = %q, want the SHA-256 of the email", producer.key)
+	}
+	if v, ok := producer.headers["X-Webhook-Key"]; ok {
+		t.Errorf("raw key forwarded as a header: %q", v)
+	}
+
+	send("signup")
+	if string(producer.key) == plain || len(producer.key) != 64 || string(producer.key) != string(peppered.hash([]byte(email))) {
+		t.Errorf("key = %q, want a stable peppered hash", producer.key)
+	}
+
+	send("orders")
+	if string(producer.key) != email || producer.headers["X-Webhook-Key"] != email {
+		t.Errorf("key = %q, want the raw key on topics without hashing", producer.key)
+	}
+}
+
+func TestWebhookHandler_KeyFromPayload(t *testing.T) {
+	byRepo, _ := keyexpr.Compile("$.repository.id", "")
+	byCustomer, _ := keyexpr.Compile("", `{{.Body.customer}}`)
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Topics: map[string]TopicOptions{
+			"github":   {Key: byRepo},
+			"payments": {Key: byCustomer, KeyRequired: true, KeyHash: NewKeyHasher(nil)},
+		},
+	})
+	send := func(topic, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("X-Webhook-Key", key)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name, topic, header, body string
+		wantCode                  int
+		wantKey                   string
+	}{
+		{"extracted", "github", "", `{"repository":{"id":1296269}}`, http.StatusAccepted, "1296269"},
+		{"sender key wins", "github", "override", `{"repository":{"id":1296269}}`, http.StatusAccepted, "override"},
+		{"missing key produced keyless", "github", "", `{"zen":"hi"}`, http.StatusAccepted, ""},
+		{"extracted then hashed", "payments", "", `{"customer":"cus_1"}`, http.StatusAccepted, string(NewKeyHasher(nil).hash([]byte("cus_1")))},
+		{"required key missing", "payments", "", `{"amount":5}`, http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		producer.key = nil
+		w := send(tt.topic, tt.header, tt.body)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.wantCode)
+			continue
+		}
+		if string(producer.key) != tt.wantKey {
+			t.Errorf("%s: key = %q, want %q", tt.name, producer.key, tt.wantKey)
+		}
+		if tt.wantCode != http.StatusAccepted && !strings.Contains(w.Body.String(), "key_missing") {
+			t.Errorf("%s: body = %s, want key_missing", tt.name, w.Body)
+		}
+	}
+	if got := srv.metrics.KeyMissing.Load(); got != 2 {
+		t.Errorf("key_missing = %d, want 2", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Dead letter — retries and the dead letter topic
+// -------------------------------------------------------------------
+
+// flakyProducer fails the first failures produces to failTopic.
+type flakyProducer struct {
+	mockProducer
+	failTopic string
+	failures  int
+	attempts  int
+}
+
+func (f *flakyProducer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	if topic == f.failTopic {
+		f.attempts++
+		if f.attempts <= f.failures {
+			return errors.New("broker: topic partition leader not available")
+		}
+	}
+	return f.mockProducer.Produce(ctx, topic, key, value, headers)
+}
+
+func TestWebhookHandler_DeadLetter(t *testing.T) {
+	tests := []struct {
+		name       string
+		deadLetter DeadLetter
+		failures   int
+		wantCode   int
+		wantStatus string
+		wantTopic  string
+		attempts   string
+	}{
+		{"retry succeeds", DeadLetter{Retries: 2}, 2, http.StatusAccepted, "accepted", "orders", ""},
+		{"retries exhausted", DeadLetter{Retries: 1}, 2, http.StatusInternalServerError, "", "", ""},
+		{"dead-lettered", DeadLetter{Topic: "kahook.dlq", Retries: 1}, 5, http.StatusAccepted, "dead_lettered", "kahook.dlq", "2"},
+		{"dead-lettered without retries", DeadLetter{Topic: "kahook.dlq"}, 5, http.StatusAccepted, "dead_lettered", "kahook.dlq", "1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &flakyProducer{mockProducer: mockProducer{isHealthy: true}, failTopic: "orders", failures: tt.failures}
+			tt.deadLetter.Backoff = time.Millisecond
+			srv := NewServer(ServerConfig{
+				Port:       8080,
+				Producer:   producer,
+				Auth:       auth.NewMultiAuth(nil, nil),
+				Logger:     zap.NewNop(),
+				DeadLetter: tt.deadLetter,
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`))
+			req.Header.Set("X-Webhook-Key", "order-1")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+			if tt.wantCode != http.StatusAccepted {
+				return
+			}
+			var resp map[string]string
+			json.Unmarshal(w.Body.Bytes(), &resp)
+			if resp["status"] != tt.wantStatus || resp["topic"] != "orders" {
+				t.Errorf("response = %v, want status %q for topic orders", resp, tt.wantStatus)
+			}
+			if producer.topic != tt.wantTopic || string(producer.key) != "order-1" || string(producer.value) != `{"id":1}` {
+				t.Errorf("produced %q key=%q value=%q, want the message on %q", producer.topic, producer.key, producer.value, tt.wantTopic)
+			}
+			if tt.attempts == "" {
+				return
+			}
+			h := producer.headers
+			if h[originalTopicHeader] != "orders" || h[deadLetterAttemptsHeader] != tt.attempts || !strings.Contains(h[deadLetterErrorHeader], "leader not available") {
+				t.Errorf("dead letter headers = %v", h)
+			}
+			if n := srv.metrics.DeadLettered.Load(); n != 1 {
+				t.Errorf("dead_lettered = %d, want 1", n)
+			}
+		})
+	}
+}
+
+// -------------------------------------------------------------------
+// Error budgets — throttling failing topics
+// -------------------------------------------------------------------
+
+func TestWebhookHandler_ErrorBudget(t *testing.T) {
+	producer := &flakyProducer{mockProducer: mockProducer{isHealthy: true}, failTopic: "orders", failures: 100}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(map[string]string{"admin": "secret"}, nil),
+		Logger:   zap.NewNop(),
+		AdminAPI: AdminAPI{
+			Addr:         "127.0.0.1:0",
+			Auth:         auth.NewBearerAuth([]string{"admin-secret"}),
+			ReadOnlyAuth: auth.NewBearerAuth([]string{"noc-secret"}),
+		},
+		ErrorBudget: ErrorBudget{
+			FailureRatio: 0.5,
+			MinRequests:  4,
+			// One webhook gets through, then none for the rest of the test.
+			Throttle: ratelimit.Limit{Rate: 0.001, Burst: 1},
+		},
+	})
+	send := func(method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"id":1}`))
+		req.SetBasicAuth("admin", "secret")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 4; i++ {
+		if w := send(http.MethodPost, "/orders"); w.Code != http.StatusInternalServerError {
+			t.Fatalf("failing produce %d: status = %d, want 500", i, w.Code)
+		}
+	}
+	if n := srv.metrics.ErrorBudgetTrips.Load(); n != 1 {
+		t.Fatalf("error_budget_trips = %d, want 1", n)
+	}
+	if w := send(http.MethodPost, "/orders"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("probe while throttled: status = %d, want 500 from the burst", w.Code)
+	}
+	w := send(http.MethodPost, "/orders")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "topic_throttled") || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("throttled topic: status = %d, body = %s, want 429 topic_throttled with Retry-After", w.Code, w.Body)
+	}
+	if w := send(http.MethodPost, "/payments"); w.Code != http.StatusAccepted {
+		t.Errorf("healthy topic: status = %d, want 202", w.Code)
+	}
+
+	var budgets ErrorBudgetsResponse
+	w = send(http.MethodGet, "/admin/error-budgets")
+	if err := json.Unmarshal(w.Body.Bytes(), &budgets); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("GET /admin/error-budgets = %d %s", w.Code, w.Body)
+	}
+	if len(budgets.Topics) != 2 || budgets.Topics[0].Topic != "orders" || !budgets.Topics[0].Throttled || budgets.Topics[0].Failures != 5 || budgets.Topics[1].Throttled {
+		t.Errorf("budgets = %+v, want orders throttled after 5 failures and payments not", budgets.Topics)
+	}
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.Throttled[scopeErrorBudget] != 1 {
+		t.Errorf("throttled[error_budget] = %d, want 1", snap.Throttled[scopeErrorBudget])
+	}
+	w = send(http.MethodGet, "/metrics")
+	if !strings.Contains(w.Body.String(), `"throttled_topics":["orders"]`) {
+		t.Errorf("/metrics does not list orders as throttled: %s", w.Body)
+	}
+
+	// Publish credentials cannot lift a throttle, nor can read-only admin
+	// tokens.
+	if w := send(http.MethodDelete, "/admin/error-budgets/orders"); w.Code == http.StatusNoContent {
+		t.Fatal("publish credentials lifted the throttle on the webhook listener")
+	}
+	req := httptest.NewRequest(http.MethodDelete, "/error-budgets/orders", nil)
+	req.Header.Set("Authorization", "Bearer noc-secret")
+	w = httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("read-only DELETE = %d, want 403", w.Code)
+	}
+	if w := send(http.MethodPost, "/orders"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("topic after refused lifts: status = %d, want 429", w.Code)
+	}
+	if w := adminRequest(srv, http.MethodGet, "/error-budgets", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"topic":"orders"`) {
+		t.Errorf("admin GET /error-budgets = %d %s", w.Code, w.Body)
+	}
+
+	if w := adminRequest(srv, http.MethodDelete, "/error-budgets/orders?hold=60", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d %s, want 204", w.Code, w.Body)
+	}
+	for i := 0; i < 6; i++ {
+		if w := send(http.MethodPost, "/orders"); w.Code != http.StatusInternalServerError {
+			t.Fatalf("after override %d: status = %d, want 500", i, w.Code)
+		}
+	}
+	if n := srv.metrics.ErrorBudgetTrips.Load(); n != 1 {
+		t.Errorf("error_budget_trips = %d during the override, want 1", n)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/error-budgets", nil)
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous GET = %d, want 401", w.Code)
+	}
+}
+
+func TestErrorBudgets_Window(t *testing.T) {
+	var trips atomic.Int64
+	now := time.Unix(1700000000, 0)
+	b := newErrorBudgets(ErrorBudget{
+		FailureRatio: 0.5,
+		TopicRatios:  map[string]float64{"legacy": 0},
+		MinRequests:  4,
+		Window:       10 * time.Second,
+		Duration:     5 * time.Second,
+	}, &trips, zap.NewNop(), func() time.Time { return now })
+
+	// Two failures, then they age out of the window before two more.
+	b.observe("orders", false)
+	b.observe("orders", false)
+	now = now.Add(11 * time.Second)
+	b.observe("orders", true)
+	b.observe("orders", false)
+	b.observe("orders", false)
+	if trips.Load() != 0 {
+		t.Fatal("throttled on failures outside the window")
+	}
+	b.observe("orders", false)
+	if trips.Load() != 1 || len(b.throttled()) != 1 {
+		t.Fatalf("trips = %d, throttled = %v, want orders throttled", trips.Load(), b.throttled())
+	}
+
+	now = now.Add(6 * time.Second)
+	if ok, _ := b.admit("orders"); !ok || len(b.throttled()) != 0 {
+		t.Error("orders still throttled after the duration")
+	}
+
+	for i := 0; i < 10; i++ {
+		b.observe("legacy", false)
+	}
+	if ok, _ := b.admit("legacy"); !ok {
+		t.Error("topic with a zero ratio was throttled")
+	}
+}
+
+// -------------------------------------------------------------------
+// admitWebhook — consumer lag
+// -------------------------------------------------------------------
+
+// lagSource reports a fixed lag for every group.
+type lagSource struct{ lag int64 }
+
+func (l *lagSource) Lag(context.Context, string, string) (int64, error) { return l.lag, nil }
+
+func TestWebhookHandler_ConsumerLag(t *testing.T) {
+	src := &lagSource{lag: 5000}
+	monitor := lag.New(lag.Config{
+		Source:     src,
+		Thresholds: []lag.Threshold{{Topic: "orders", Group: "billing", MaxLag: 1000}},
+		Interval:   15 * time.Second,
+		Logger:     zap.NewNop(),
+	})
+	monitor.Check(context.Background())
+
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:        8080,
+		Producer:    producer,
+		Auth:        auth.NewMultiAuth(nil, nil),
+		Logger:      zap.NewNop(),
+		ConsumerLag: monitor,
+	})
+	send := func(topic string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{}`))
+		w := httptest.NewRecorder()
+		srv.webhookHandler(w, req)
+		return w
+	}
+
+	w := send("orders")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "consumer_lag") {
+		t.Fatalf("status = %d, want 429 consumer_lag: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Retry-After"); got != "15" {
+		t.Errorf("Retry-After = %q, want the check interval", got)
+	}
+	if w := send("events"); w.Code != http.StatusAccepted {
+		t.Errorf("other topic: status = %d, want 202", w.Code)
+	}
+
+	snap := newMetricsSnapshot(srv.metrics)
+	if snap.Throttled[scopeConsumerLag] != 1 {
+		t.Errorf("throttled[consumer_lag] = %d, want 1", snap.Throttled[scopeConsumerLag])
+	}
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	mw := httptest.NewRecorder()
+	srv.metricsHandler(mw, req)
+	var metrics MetricsResponse
+	if err := json.NewDecoder(mw.Body).Decode(&metrics); err != nil {
+		t.Fatal(err)
+	}
+	if metrics.ConsumerLag["orders"]["billing"] != 5000 || !slices.Equal(metrics.LaggingTopics, []string{"orders"}) {
+		t.Errorf("consumer_lag = %v, lagging_topics = %v", metrics.ConsumerLag, metrics.LaggingTopics)
+	}
+
+	src.lag = 500
+	monitor.Check(context.Background())
+	if w := send("orders"); w.Code != http.StatusAccepted {
+		t.Errorf("after catching up: status = %d, want 202", w.Code)
+	}
+}
+
+// -------------------------------------------------------------------
+// Audit log — a record per produce attempt
+// -------------------------------------------------------------------
+
+// auditProducer records the values produced to each topic, and fails
+// produces to failTopic. The audit log produces from its own goroutine.
+type auditProducer struct {
+	mockProducer
+	failTopic string
+
+	mu       sync.Mutex
+	produced map[string][][]byte
+}
+
+func (p *auditProducer) Produce(_ context.Context, topic string, _, value []byte, _ map[string]string) error {
+	if topic == p.failTopic {
+		return errors.New("broker: topic authorization failed")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.produced == nil {
+		p.produced = make(map[string][][]byte)
+	}
+	p.produced[topic] = append(p.produced[topic], bytes.Clone(value))
+	return nil
+}
+
+func TestWebhookHandler_AuditLog(t *testing.T) {
+	producer := &auditProducer{mockProducer: mockProducer{isHealthy: true}, failTopic: "payments"}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Audit:    AuditLog{Topic: "kahook.audit"},
+		NewID:    func() string { return "msg-1" },
+		Now:      func() time.Time { return time.Unix(1700000000, 0) },
+	})
+
+	for _, topic := range []string{"orders", "payments"} {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{"id":1}`))
+		req.Header.Set("X-Webhook-Key", "order-1")
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	records := producer.produced["kahook.audit"]
+	if len(records) != 2 {
+		t.Fatalf("produced %d audit records, want 2", len(records))
+	}
+	keyHash := sha256.Sum256([]byte("order-1"))
+	want := []struct{ topic, outcome, err string }{
+		{"orders", auditProduced, ""},
+		{"payments", auditFailed, "broker: topic authorization failed"},
+	}
+	for i, w := range want {
+		var rec AuditRecord
+		if err := json.Unmarshal(records[i], &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Topic != w.topic || rec.Outcome != w.outcome || rec.Error != w.err || rec.Attempts != 1 {
+			t.Errorf("record %d = %+v, want topic %q outcome %q error %q", i, rec, w.topic, w.outcome, w.err)
+		}
+		if rec.MessageID != "msg-1" || rec.RequestID == "" || rec.Size != len(`{"id":1}`) || rec.KeyHash != hex.EncodeToString(keyHash[:]) {
+			t.Errorf("record %d = %+v, want the message's ids, size, and key hash", i, rec)
+		}
+		if !rec.Time.Equal(time.Unix(1700000000, 0)) || rec.LatencyMs != 0 {
+			t.Errorf("record %d time = %v, latency = %vms, want both from the server's clock", i, rec.Time, rec.LatencyMs)
+		}
+	}
+	if got := srv.metrics.AuditRecords.Load(); got != 2 {
+		t.Errorf("audit_records = %d, want 2", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Receipts — a record per delivered message
+// -------------------------------------------------------------------
+
+// offsetProducer reports each message it produces as written to partition
+// 2 at the next offset, as the Kafka producer does.
+type offsetProducer struct {
+	auditProducer
+	next int64
+}
+
+func (p *offsetProducer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	if err := p.auditProducer.Produce(ctx, topic, key, value, headers); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	offset := p.next
+	p.next++
+	p.mu.Unlock()
+	delivery.Record(ctx, delivery.Report{Partition: 2, Offset: offset, Timestamp: time.Unix(1700000000, 0)})
+	return nil
+}
+
+func TestWebhookHandler_Receipts(t *testing.T) {
+	producer := &offsetProducer{auditProducer: auditProducer{mockProducer: mockProducer{isHealthy: true}, failTopic: "payments"}, next: 41}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Receipts: Receipts{Topic: "kahook.receipts"},
+		NewID:    func() string { return "msg-1" },
+	})
+
+	for _, topic := range []string{"orders", "payments"} {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{"id":1}`))
+		req.Header.Set("X-Request-ID", "req-"+topic)
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	receipts := producer.produced["kahook.receipts"]
+	if len(receipts) != 1 {
+		t.Fatalf("produced %d receipts, want 1 for the delivered message only", len(receipts))
+	}
+	var got Receipt
+	if err := json.Unmarshal(receipts[0], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.RequestID != "req-orders" || got.MessageID != "msg-1" || got.Topic != "orders" {
+		t.Errorf("receipt = %+v, want the orders message's ids", got)
+	}
+	if got.Partition == nil || *got.Partition != 2 || got.Offset == nil || *got.Offset != 41 || !got.Timestamp.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("receipt = %+v, want partition 2, offset 41, and the broker timestamp", got)
+	}
+	if n := srv.metrics.ReceiptsProduced.Load(); n != 1 {
+		t.Errorf("receipts_produced = %d, want 1", n)
+	}
+}
+
+// -------------------------------------------------------------------
+// Access log — request records batched to a logging topic
+// -------------------------------------------------------------------
+
+func TestAccessLog(t *testing.T) {
+	producer := &auditProducer{mockProducer: mockProducer{isHealthy: true}}
+	srv := NewServer(ServerConfig{
+		Port:      8080,
+		Producer:  producer,
+		Auth:      auth.NewMultiAuth(nil, nil),
+		Logger:    zap.NewNop(),
+		AccessLog: AccessLog{Topic: "kahook.access", SampleRatio: 0.0001, BatchSize: 2, Replace: true},
+	})
+
+	// Successful requests are all but certainly sampled out; the 405s are
+	// always recorded.
+	for i := 0; i < 3; i++ {
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`)))
+		req := httptest.NewRequest(http.MethodDelete, "/health", nil)
+		req.Header.Set("User-Agent", "probe/1.0")
+		srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if err := srv.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := producer.produced["kahook.access"]
+	if len(messages) != 2 {
+		t.Fatalf("produced %d access log messages, want a batch of 2 and a final 1", len(messages))
+	}
+	var records []AccessRecord
+	for _, m := range messages {
+		for _, line := range strings.Split(strings.TrimSuffix(string(m), "\n"), "\n") {
+			var rec AccessRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, rec)
+		}
+	}
+	if len(records) != 3 {
+		t.Fatalf("got %d access records, want 3", len(records))
+	}
+	for _, rec := range records {
+		if rec.Method != http.MethodDelete || rec.Path != "/health" || rec.Status != http.StatusMethodNotAllowed ||
+			rec.RequestID == "" || rec.UserAgent != "probe/1.0" || rec.ResponseBytes == 0 {
+			t.Errorf("record = %+v, want the rejected DELETE /health", rec)
+		}
+	}
+	if got := srv.metrics.AccessLogRecords.Load(); got != 3 {
+		t.Errorf("access_log_records = %d, want 3", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Reload — credentials and topics swapped while serving
+// -------------------------------------------------------------------
+
+func TestServer_Reload(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:          8080,
+		Producer:      &mockProducer{isHealthy: true},
+		Auth:          auth.NewMultiAuth(map[string]string{"alice": "pw"}, []string{"old-secret"}),
+		Logger:        zap.NewNop(),
+		AllowedTopics: []string{"events"},
+	})
+	post := func(topic string, authorize func(*http.Request)) int {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(`{}`))
+		authorize(req)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+	alice := func(r *http.Request) { r.SetBasicAuth("alice", "pw") }
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+
+	for range 2 {
+		if code := post("events", alice); code != http.StatusAccepted {
+			t.Fatalf("before reload: status = %d, want %d", code, http.StatusAccepted)
+		}
+	}
+	if code := post("orders", bearer("old-secret")); code != http.StatusForbidden {
+		t.Fatalf("before reload: orders status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	srv.Reload(Reloadable{
+		Auth:          auth.NewMultiAuth(map[string]string{"alice": "pw"}, []string{"new-secret"}),
+		AllowedTopics: []string{"events", "orders"},
+	})
+
+	tests := []struct {
+		name      string
+		topic     string
+		authorize func(*http.Request)
+		want      int
+	}{
+		{"removed token", "events", bearer("old-secret"), http.StatusUnauthorized},
+		{"added token and topic", "orders", bearer("new-secret"), http.StatusAccepted},
+		{"kept user", "events", alice, http.StatusAccepted},
+	}
+	for _, tt := range tests {
+		if code := post(tt.topic, tt.authorize); code != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	// Credentials kept across the reload keep their usage.
+	found := false
+	for _, c := range srv.current().credentials.snapshot().Credentials {
+		if c.Principal == "alice" {
+			found = true
+			if c.Requests != 3 {
+				t.Errorf("alice = %+v, want 3 requests", c)
+			}
+		}
+	}
+	if !found {
+		t.Error("alice missing from credential usage after reload")
+	}
+}
+
+// -------------------------------------------------------------------
+// Admin API — inspection and control on a listener of its own
+// -------------------------------------------------------------------
+
+// adminRequest sends a request to srv's admin API with the admin token.
+func adminRequest(srv *Server, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer admin-secret")
+	w := httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(w, req)
+	return w
+}
+
+func newAdminServer(publish *auth.MultiAuth) *Server {
+	return NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     &mockProducer{isHealthy: true},
+		Auth:         publish,
+		Logger:       zap.NewNop(),
+		RoutePaths:   map[string]string{"shop": "orders"},
+		RouteHeaders: map[string]map[string]string{"shop": {"X-Source": "shop"}},
+		Topics:       map[string]TopicOptions{"orders": {Payload: PayloadBase64}},
+		AdminAPI: AdminAPI{
+			Addr:            "127.0.0.1:0",
+			Auth:            auth.NewBearerAuth([]string{"admin-secret"}),
+			ReadOnlyAuth:    auth.NewBearerAuth([]string{"noc-secret"}),
+			EffectiveConfig: func() (any, error) { return map[string]string{"profile": "default"}, nil },
+		},
+	})
+}
+
+func TestAdminAPI_RoutesAndConfig(t *testing.T) {
+	srv := newAdminServer(auth.NewMultiAuth(nil, nil))
+
+	req := httptest.NewRequest(http.MethodGet, "/routes", nil)
+	req.Header.Set("Authorization", "Bearer publish-secret")
+	w := httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status without the admin token = %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	w = adminRequest(srv, http.MethodGet, "/routes", "")
+	var routes AdminRoutesResponse
+	if err := json.NewDecoder(w.Body).Decode(&routes); err != nil {
+		t.Fatal(err)
+	}
+	want := AdminRoutesResponse{
+		Routes: []AdminRoute{{Path: "shop", Topic: "orders", Headers: map[string]string{"X-Source": "shop"}}},
+		Topics: []string{"orders"},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("routes = %+v", routes)
+	}
+
+	w = adminRequest(srv, http.MethodGet, "/config", "")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"profile":"default"`) {
+		t.Errorf("config: status = %d, body = %s", w.Code, w.Body)
+	}
+
+	// The admin API is not served on the webhook listener.
+	w = httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/routes", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("webhook listener status = %d, want %d", w.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestAdminAPI_DisableTopic(t *testing.T) {
+	srv := newAdminServer(auth.NewMultiAuth(nil, nil))
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`)))
+		return w
+	}
+	post()
+
+	if w := adminRequest(srv, http.MethodPost, "/topics/orders/disable", ""); w.Code != http.StatusOK {
+		t.Fatalf("disable: status = %d, body = %s", w.Code, w.Body)
+	}
+	if w := post(); w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "topic_disabled") {
+		t.Errorf("disabled topic: status = %d, body = %s", w.Code, w.Body)
+	}
+
+	var topics map[string]AdminTopic
+	if err := json.NewDecoder(adminRequest(srv, http.MethodGet, "/topics", "").Body).Decode(&topics); err != nil {
+		t.Fatal(err)
+	}
+	if o := topics["orders"]; !o.Disabled || o.DisabledSince == nil || o.MessagesProduced != 1 {
+		t.Errorf("orders = %+v, want disabled after 1 message", o)
+	}
+
+	adminRequest(srv, http.MethodPost, "/topics/orders/enable", "")
+	if w := post(); w.Code != http.StatusAccepted {
+		t.Errorf("enabled topic: status = %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if got := srv.metrics.TopicDisabledRejected.Load(); got != 1 {
+		t.Errorf("topic_disabled_rejected = %d, want 1", got)
+	}
+}
+
+func TestAdminAPI_RotateTokens(t *testing.T) {
+	srv := newAdminServer(auth.NewMultiAuth(nil, []string{"old-token"}))
+	publish := func(token string) int {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	w := adminRequest(srv, http.MethodPost, "/tokens", "")
+	var added AdminTokenResponse
+	if err := json.NewDecoder(w.Body).Decode(&added); err != nil || w.Code != http.StatusCreated {
+		t.Fatalf("add: status = %d, err = %v", w.Code, err)
+	}
+	if added.Token == "" || added.Principal != auth.TokenFingerprint(added.Token) {
+		t.Fatalf("added = %+v, want a generated token", added)
+	}
+	if code := publish(added.Token); code != http.StatusAccepted {
+		t.Errorf("new token: status = %d, want %d", code, http.StatusAccepted)
+	}
+	if w := adminRequest(srv, http.MethodPost, "/tokens", `{"token":"old-token"}`); w.Code != http.StatusConflict {
+		t.Errorf("adding an accepted token: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	if w := adminRequest(srv, http.MethodDelete, "/tokens/"+auth.TokenFingerprint("old-token"), ""); w.Code != http.StatusNoContent {
+		t.Fatalf("remove: status = %d, body = %s", w.Code, w.Body)
+	}
+	if code := publish("old-token"); code != http.StatusUnauthorized {
+		t.Errorf("removed token: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if w := adminRequest(srv, http.MethodDelete, "/tokens/"+auth.TokenFingerprint("old-token"), ""); w.Code != http.StatusNotFound {
+		t.Errorf("removing it again: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+	if w := adminRequest(srv, http.MethodDelete, "/tokens/"+added.Principal, ""); w.Code != http.StatusConflict {
+		t.Errorf("removing the last credential: status = %d, want %d", w.Code, http.StatusConflict)
+	}
+}
+
+func TestAdminAPI_ReadOnlyRole(t *testing.T) {
+	srv := newAdminServer(auth.NewMultiAuth(nil, []string{"publish-secret"}))
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer noc-secret")
+		w := httptest.NewRecorder()
+		srv.AdminHandler().ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/routes", "/topics", "/config"} {
+		if w := request(http.MethodGet, path); w.Code != http.StatusOK {
+			t.Errorf("GET %s: status = %d, want %d", path, w.Code, http.StatusOK)
+		}
+	}
+	for _, op := range []struct{ method, path string }{
+		{http.MethodPost, "/topics/orders/disable"},
+		{http.MethodPost, "/tokens"},
+		{http.MethodDelete, "/tokens/" + auth.TokenFingerprint("publish-secret")},
+	} {
+		w := request(op.method, op.path)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "forbidden") {
+			t.Errorf("%s %s: status = %d, body = %s, want %d", op.method, op.path, w.Code, w.Body, http.StatusForbidden)
+		}
+	}
+	if _, disabled := srv.disabled.since("orders"); disabled {
+		t.Error("a read-only token disabled a topic")
+	}
+	if got := len(srv.current().auth.Credentials()); got != 1 {
+		t.Errorf("publish credentials = %d, want the one configured", got)
+	}
+
+	// Operators keep every permission.
+	if w := adminRequest(srv, http.MethodPost, "/topics/orders/disable", ""); w.Code != http.StatusOK {
+		t.Errorf("operator disable: status = %d, body = %s", w.Code, w.Body)
+	}
+}
+
+// fakeReplay is a spill replay the admin API pauses and resumes.
+type fakeReplay struct {
+	mu     sync.Mutex
+	paused bool
+}
+
+func (f *fakeReplay) Status() ReplayStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	st := ReplayStatus{State: "running", Segments: 3, Replayed: 1, Messages: 42}
+	if f.paused {
+		st.State = "paused"
+	}
+	return st
+}
+
+func (f *fakeReplay) Pause()  { f.mu.Lock(); f.paused = true; f.mu.Unlock() }
+func (f *fakeReplay) Resume() { f.mu.Lock(); f.paused = false; f.mu.Unlock() }
+
+func TestAdminAPI_Replay(t *testing.T) {
+	if w := adminRequest(newAdminServer(auth.NewMultiAuth(nil, nil)), http.MethodGet, "/replay", ""); w.Code != http.StatusNotFound {
+		t.Errorf("without a replay: status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	replay := &fakeReplay{}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Logger:   zap.NewNop(),
+		AdminAPI: AdminAPI{
+			Addr:         "127.0.0.1:0",
+			Auth:         auth.NewBearerAuth([]string{"admin-secret"}),
+			ReadOnlyAuth: auth.NewBearerAuth([]string{"noc-secret"}),
+			Replay:       replay,
+		},
+	})
+	status := func(w *httptest.ResponseRecorder) ReplayStatus {
+		t.Helper()
+		var st ReplayStatus
+		if err := json.NewDecoder(w.Body).Decode(&st); err != nil {
+			t.Fatalf("status %d: %v", w.Code, err)
+		}
+		return st
+	}
+
+	if st := status(adminRequest(srv, http.MethodGet, "/replay", "")); st.State != "running" || st.Messages != 42 {
+		t.Errorf("GET /replay = %+v", st)
+	}
+	if st := status(adminRequest(srv, http.MethodPost, "/replay/pause", "")); st.State != "paused" {
+		t.Errorf("after pause: state = %q, want paused", st.State)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/replay/resume", nil)
+	req.Header.Set("Authorization", "Bearer noc-secret")
+	w := httptest.NewRecorder()
+	srv.AdminHandler().ServeHTTP(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("read-only resume: status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	if st := status(adminRequest(srv, http.MethodPost, "/replay/resume", "")); st.State != "running" {
+		t.Errorf("after resume: state = %q, want running", st.State)
+	}
+}
+
+// -------------------------------------------------------------------
+// Batch ingestion — NDJSON and JSON arrays
+// -------------------------------------------------------------------
+
+// batchProducer records produced messages by value, and is safe for the
+// concurrent produces of a batch. Values containing "broker-down" fail.
+type batchProducer struct {
+	mockProducer
+	mu       sync.Mutex
+	messages map[string]map[string]string // value -> headers
+	keys     map[string]string            // value -> key
+}
+
+func (p *batchProducer) Produce(_ context.Context, _ string, key, value []byte, headers map[string]string) error {
+	if bytes.Contains(value, []byte("broker-down")) {
+		return errors.New("broker: request timed out")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.messages == nil {
+		p.messages = make(map[string]map[string]string)
+		p.keys = make(map[string]string)
+	}
+	p.messages[string(value)] = maps.Clone(headers)
+	p.keys[string(value)] = string(key)
+	return nil
+}
+
+func TestBatchHandler(t *testing.T) {
+	byDevice, _ := keyexpr.Compile("$.device", "")
+	newServer := func(producer KafkaProducer) *Server {
+		return NewServer(ServerConfig{
+			Port:     8080,
+			Producer: producer,
+			Auth:     auth.NewMultiAuth(nil, []string{"tok"}),
+			Logger:   zap.NewNop(),
+			Batch:    BatchIngest{Enabled: true, MaxRecords: 3},
+			Topics:   map[string]TopicOptions{"iot": {Key: byDevice}},
+		})
+	}
+	send := func(srv *Server, path, contentType, body string) (*httptest.ResponseRecorder, BatchResponse) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer tok")
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var resp BatchResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	t.Run("ndjson", func(t *testing.T) {
+		producer := &batchProducer{mockProducer: mockProducer{isHealthy: true}}
+		srv := newServer(producer)
+		w, resp := send(srv, "/batch/iot", "application/x-ndjson", "{\"device\":\"d1\",\"t\":1}\n\n{\"device\":\"d2\",\"t\":2}\n")
+		if w.Code != http.StatusAccepted || resp.Status != "accepted" || resp.Accepted != 2 || resp.Topic != "iot" {
+			t.Fatalf("status = %d, response = %+v, want 2 accepted", w.Code, resp)
+		}
+		headers := producer.messages[`{"device":"d2","t":2}`]
+		if headers[messageIDHeader] != resp.Records[1].MessageID || headers[contentTypeHeader] != "application/json" {
+			t.Errorf("headers = %v, want the record's message ID and JSON content type", headers)
+		}
+		if producer.keys[`{"device":"d1","t":1}`] != "d1" {
+			t.Errorf("keys = %v, want the device extracted per record", producer.keys)
+		}
+		if resp.Records[0].MessageID == resp.Records[1].MessageID {
+			t.Error("records share a message ID")
+		}
+	})
+
+	t.Run("array with failures", func(t *testing.T) {
+		producer := &batchProducer{mockProducer: mockProducer{isHealthy: true}}
+		srv := newServer(producer)
+		w, resp := send(srv, "/batch/iot", "application/json", `[{"device":"d1"}, {"device":"broker-down"}, "not an object"]`)
+		if w.Code != http.StatusMultiStatus || resp.Status != "partial" || resp.Accepted != 2 || resp.Failed != 1 {
+			t.Fatalf("status = %d, response = %+v, want partial with 1 failure", w.Code, resp)
+		}
+		want := []struct{ status, err string }{{"accepted", ""}, {"failed", "produce_error"}, {"accepted", ""}}
+		for i, rec := range resp.Records {
+			if rec.Index != i || rec.Status != want[i].status || rec.Error != want[i].err {
+				t.Errorf("record %d = %+v, want %s %s", i, rec, want[i].status, want[i].err)
+			}
+		}
+		if got := srv.metrics.BatchRecordsFailed.Load(); got != 1 {
+			t.Errorf("batch_records_failed = %d, want 1", got)
+		}
+	})
+
+	t.Run("invalid ndjson line rejected alone", func(t *testing.T) {
+		producer := &batchProducer{mockProducer: mockProducer{isHealthy: true}}
+		w, resp := send(newServer(producer), "/batch/iot", "application/x-ndjson", "{\"device\":\"d1\"}\n{oops\n")
+		if w.Code != http.StatusMultiStatus || resp.Records[1].Status != "rejected" || resp.Records[1].Error != "invalid_json" {
+			t.Errorf("status = %d, response = %+v, want record 1 rejected as invalid_json", w.Code, resp)
+		}
+		if len(producer.messages) != 1 {
+			t.Errorf("produced %d messages, want 1", len(producer.messages))
+		}
+	})
+
+	rejections := []struct {
+		name, path, contentType, body string
+		wantCode                      int
+		wantErr                       string
+	}{
+		{"too many records", "/batch/iot", "application/x-ndjson", "{}\n{}\n{}\n{}\n", http.StatusRequestEntityTooLarge, "too_many_records"},
+		{"not an array", "/batch/iot", "application/json", `{"device":"d1"}`, http.StatusBadRequest, "invalid_batch"},
+		{"empty", "/batch/iot", "application/x-ndjson", "\n\n", http.StatusBadRequest, "empty_body"},
+		{"unsupported type", "/batch/iot", "text/plain", "{}", http.StatusUnsupportedMediaType, "unsupported_media_type"},
+		{"invalid topic", "/batch/bad!topic", "application/json", "[{}]", http.StatusBadRequest, "invalid_topic"},
+	}
+	for _, tt := range rejections {
+		t.Run(tt.name, func(t *testing.T) {
+			producer := &batchProducer{mockProducer: mockProducer{isHealthy: true}}
+			w, _ := send(newServer(producer), tt.path, tt.contentType, tt.body)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantErr) {
+				t.Errorf("status = %d, body = %s, want %d %s", w.Code, w.Body, tt.wantCode, tt.wantErr)
+			}
+			if len(producer.messages) != 0 {
+				t.Errorf("produced %d messages from a rejected batch", len(producer.messages))
+			}
+		})
+	}
+
+	t.Run("requires auth", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/batch/iot", strings.NewReader("[{}]"))
+		w := httptest.NewRecorder()
+		newServer(&batchProducer{}).Handler().ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want 401", w.Code)
+		}
+	})
+}
+
+func TestBatchHandler_Disabled(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+	})
+	req := httptest.NewRequest(http.MethodPost, "/batch/iot", strings.NewReader("[{}]"))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_topic") {
+		t.Errorf("status = %d, body = %s, want the path treated as a topic", w.Code, w.Body)
+	}
+}
+
+// -------------------------------------------------------------------
+// Compression — gzip and deflate bodies decompressed before producing
+// -------------------------------------------------------------------
+
+func gzipped(t *testing.T, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestWebhook_CompressedBody(t *testing.T) {
+	removeCard, err := transform.New([]transform.Step{{Remove: []string{"card"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:                 8080,
+		Producer:             producer,
+		Auth:                 auth.NewMultiAuth(nil, nil),
+		Logger:               zap.NewNop(),
+		MaxDecompressedBytes: 64,
+		Topics: map[string]TopicOptions{
+			"orders":   {Payload: PayloadJSONOnly},
+			"archived": {KeepCompressed: true, Transform: removeCard},
+			"raw":      {KeepCompressed: true},
+		},
+	})
+	post := func(topic, encoding string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+topic, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", encoding)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	// The json_only check sees the decompressed body, and the request's
+	// Content-Encoding is not forwarded with it.
+	if w := post("orders", "gzip", gzipped(t, `{"id":1}`)); w.Code != http.StatusAccepted {
+		t.Fatalf("gzip: status = %d, body = %s", w.Code, w.Body)
+	}
+	if string(producer.value) != `{"id":1}` || producer.headers["Content-Encoding"] != "" {
+		t.Errorf("gzip: produced %q with headers %v, want the decompressed body", producer.value, producer.headers)
+	}
+
+	// Deflate is zlib-wrapped, but raw DEFLATE streams are accepted too.
+	var raw bytes.Buffer
+	fw, _ := flate.NewWriter(&raw, flate.DefaultCompression)
+	fw.Write([]byte(`{"id":2}`))
+	fw.Close()
+	if w := post("orders", "deflate", raw.Bytes()); w.Code != http.StatusAccepted || string(producer.value) != `{"id":2}` {
+		t.Errorf("raw deflate: status = %d, produced %q", w.Code, producer.value)
+	}
+	zlibbed, err := compress(encodingDeflate, []byte(`{"id":3}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := post("orders", "deflate", zlibbed); w.Code != http.StatusAccepted || string(producer.value) != `{"id":3}` {
+		t.Errorf("zlib deflate: status = %d, produced %q", w.Code, producer.value)
+	}
+
+	// Kept payloads are produced as sent when nothing changed them...
+	body := gzipped(t, `{"id":4}`)
+	if w := post("raw", "x-gzip", body); w.Code != http.StatusAccepted {
+		t.Fatalf("keep: status = %d, body = %s", w.Code, w.Body)
+	}
+	if !bytes.Equal(producer.value, body) || producer.headers["Content-Encoding"] != "gzip" {
+		t.Errorf("keep: produced %q with headers %v, want the body as sent", producer.value, producer.headers)
+	}
+	// ...and recompressed after transforms.
+	if w := post("archived", "gzip", gzipped(t, `{"id":5,"card":"4242"}`)); w.Code != http.StatusAccepted {
+		t.Fatalf("keep transformed: status = %d, body = %s", w.Code, w.Body)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(producer.value))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != `{"id":5}` || producer.headers["Content-Encoding"] != "gzip" {
+		t.Errorf("keep transformed: produced %q with headers %v", got, producer.headers)
+	}
+	if got := srv.metrics.BodiesDecompressed.Load(); got != 5 {
+		t.Errorf("bodies_decompressed = %d, want 5", got)
+	}
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+		code     string
+	}{
+		{"bomb", "gzip", gzipped(t, strings.Repeat("a", 65)), http.StatusRequestEntityTooLarge, "body_too_large"},
+		{"corrupt", "gzip", []byte(`{"id":1}`), http.StatusBadRequest, "invalid_encoding"},
+		{"unsupported", "br", []byte(`{"id":1}`), http.StatusUnsupportedMediaType, "unsupported_encoding"},
+		{"stacked", "gzip, deflate", []byte(`{"id":1}`), http.StatusUnsupportedMediaType, "unsupported_encoding"},
+	}
+	for _, tt := range tests {
+		w := post("orders", tt.encoding, tt.body)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.code) {
+			t.Errorf("%s: status = %d, body = %s, want %d %s", tt.name, w.Code, w.Body, tt.status, tt.code)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// Signed responses — detached JWS over webhook response bodies
+// -------------------------------------------------------------------
+
+func TestWebhook_SignedResponses(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := jws.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), "kahook-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := NewServer(ServerConfig{
+		Port:           8080,
+		Producer:       &mockProducer{isHealthy: true},
+		Auth:           auth.NewMultiAuth(nil, []string{"secret"}),
+		Logger:         zap.NewNop(),
+		Batch:          BatchIngest{Enabled: true},
+		Topics:         map[string]TopicOptions{"legacy": {Response: ResponseNone}},
+		ResponseSigner: signer,
+	})
+	send := func(path, accept, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"id":1}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+	verify := func(name string, w *httptest.ResponseRecorder) {
+		t.Helper()
+		h, err := jws.Verify(w.Header().Get(ResponseSignatureHeader), w.Body.Bytes(), signer.Public())
+		if err != nil {
+			t.Errorf("%s: status = %d, Verify() error = %v", name, w.Code, err)
+			return
+		}
+		if h.Algorithm != "EdDSA" || h.KeyID != "kahook-1" || h.IssuedAt == 0 {
+			t.Errorf("%s: header = %+v", name, h)
+		}
+	}
+
+	w := send("/orders", "", "secret")
+	if w.Code != http.StatusAccepted || !strings.Contains(w.Body.String(), w.Header().Get(RequestIDHeader)) {
+		t.Fatalf("status = %d, body = %s, want the request ID acknowledged", w.Code, w.Body)
+	}
+	verify("json", w)
+	verify("text", send("/orders", "text/plain", "secret"))
+	verify("error", send("/orders", "", "wrong"))
+	verify("batch", send("/batch/orders", "", "secret"))
+
+	if w := send("/legacy", "", "secret"); w.Code != http.StatusNoContent || w.Header().Get(ResponseSignatureHeader) != "" {
+		t.Errorf("bodiless response: status = %d, signature = %q, want none", w.Code, w.Header().Get(ResponseSignatureHeader))
+	}
+	if w := send("/orders", "", "secret"); w.Header().Get(ResponseSignatureHeader) == "" {
+		t.Error("signature missing")
+	} else if _, err := jws.Verify(w.Header().Get(ResponseSignatureHeader), []byte(`{"status":"accepted"}`), signer.Public()); err == nil {
+		t.Error("signature verified against another body")
+	}
+}
+
+// -------------------------------------------------------------------
+// JWT authentication — the subject travels as a message header
+// -------------------------------------------------------------------
+
+func TestWebhook_JWTSubjectHeader(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	signer, err := jws.NewSigner(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k, _ := jws.JWK(signer.Public())
+		k["kid"] = "k1"
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{k}})
+	}))
+	defer jwks.Close()
+	claims, _ := json.Marshal(map[string]any{"iss": "https://idp.example.com", "aud": "kahook", "sub": "svc-orders", "exp": time.Now().Add(time.Hour).Unix()})
+	sig, err := signer.Sign(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, signature, _ := strings.Cut(sig, "..")
+	token := header + "." + base64.RawURLEncoding.EncodeToString(claims) + "." + signature
+
+	producer := &mockProducer{isHealthy: true}
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: producer,
+		Auth:     auth.NewMultiAuth(nil, []string{"static"}).WithJWT(auth.NewJWTAuth(auth.JWTConfig{JWKSURL: jwks.URL, Issuer: "https://idp.example.com", Audience: []string{"kahook"}})),
+		Logger:   zap.NewNop(),
+		Batch:    BatchIngest{Enabled: true},
+	})
+	send := func(path, token string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`[{"id":1}]`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(subjectHeader, "spoofed")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for _, path := range []string{"/orders", "/batch/orders"} {
+		if code := send(path, token); code >= 300 {
+			t.Fatalf("%s: status = %d", path, code)
+		}
+		if got := producer.headers[subjectHeader]; got != "svc-orders" {
+			t.Errorf("%s: %s = %q, want the JWT subject", path, subjectHeader, got)
+		}
+	}
+	if code := send("/orders", "static"); code >= 300 {
+		t.Fatalf("opaque token: status = %d", code)
+	}
+	if got, ok := producer.headers[subjectHeader]; ok {
+		t.Errorf("opaque token: %s = %q forwarded, want it removed", subjectHeader, got)
+	}
+	if code := send("/orders", token+"x"); code != http.StatusUnauthorized {
+		t.Errorf("tampered JWT: status = %d, want 401", code)
+	}
+}
+
+// -------------------------------------------------------------------
+// Request-scoped log fields
+// -------------------------------------------------------------------
+
+func TestWebhook_LogsCarryRequestFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	srv := NewServer(ServerConfig{
+		Port:       8080,
+		Producer:   &mockProducer{isHealthy: true},
+		Auth:       auth.NewMultiAuth(map[string]string{"shop": "pw"}, nil),
+		Logger:     zap.New(core),
+		RoutePaths: map[string]string{"shopify": "shop.orders"},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/shopify", strings.NewReader(`{"id":1}`))
+	req.SetBasicAuth("shop", "pw")
+	req.Header.Set(RequestIDHeader, "req-42")
+	w := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body)
+	}
+
+	entries := logs.FilterMessage("webhook received").All()
+	if len(entries) != 1 {
+		t.Fatalf("logged %d 'webhook received' lines, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	want := map[string]string{"request_id": "req-42", "route": "shopify", "topic": "shop.orders", "tenant": "shop"}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s = %v, want %q", k, fields[k], v)
+		}
+	}
+}
+
+// -------------------------------------------------------------------
+// Topic scopes — principals limited to the topics they may publish to
+// -------------------------------------------------------------------
+
+func TestWebhook_TopicScopes(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:     8080,
+		Producer: &mockProducer{isHealthy: true},
+		Auth: auth.NewMultiAuth(map[string]string{"shop": "pw", "ops": "pw"}, nil).
+			WithScopes(map[string][]string{"shop": {"orders", "shop.*"}}, false),
+		Logger: zap.NewNop(),
+		Batch:  BatchIngest{Enabled: true},
+	})
+	send := func(user, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`[{"id":1}]`))
+		req.Header.Set("Content-Type", "application/json")
+		req.SetBasicAuth(user, "pw")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/orders", "/shop.refunds", "/batch/orders"} {
+		if w := send("shop", path); w.Code >= 300 {
+			t.Errorf("shop to %s: status = %d, want it accepted", path, w.Code)
+		}
+	}
+	for _, path := range []string{"/payments", "/batch/payments"} {
+		w := send("shop", path)
+		if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "topic_forbidden") {
+			t.Errorf("shop to %s: status = %d, body = %s, want 403 topic_forbidden", path, w.Code, w.Body)
+		}
+	}
+	if w := send("ops", "/payments"); w.Code != http.StatusAccepted {
+		t.Errorf("unscoped principal: status = %d, want 202", w.Code)
+	}
+	if got := srv.metrics.ScopeRejected.Load(); got != 2 {
+		t.Errorf("ScopeRejected = %d, want 2", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Idempotency — retried deliveries answered from the result cache
+// -------------------------------------------------------------------
+
+func TestWebhook_IdempotentReplay(t *testing.T) {
+	producer := &flakyProducer{mockProducer: mockProducer{isHealthy: true}, failTopic: "orders"}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	srv := NewServer(ServerConfig{
+		Port:        8080,
+		Producer:    producer,
+		Auth:        auth.NewMultiAuth(nil, nil),
+		Logger:      zap.NewNop(),
+		Now:         func() time.Time { return now },
+		Idempotency: Idempotency{Window: time.Hour},
+		Topics: map[string]TopicOptions{
+			"github": {Signature: signature.NewGitHub([]byte("It's a Secret to Everybody"))},
+		},
+	})
+	send := func(path, key, body string) (*httptest.ResponseRecorder, map[string]string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		req.Header.Set("X-Hub-Signature-256", "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var resp map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	_, first := send("/orders", "evt-1", `{"id":1}`)
+	w, replay := send("/orders", "evt-1", `{"id":1}`)
+	if w.Code != http.StatusAccepted || w.Header().Get(replayedHeader) != "true" {
+		t.Errorf("retry: status = %d, %s = %q, want 202 replayed", w.Code, replayedHeader, w.Header().Get(replayedHeader))
+	}
+	if replay["message_id"] != first["message_id"] || replay["request_id"] != first["request_id"] {
+		t.Errorf("retry response = %v, want the original %v", replay, first)
+	}
+	if producer.attempts != 1 {
+		t.Errorf("produced %d times, want the retry not produced", producer.attempts)
+	}
+	if w, _ := send("/orders", "evt-1", `{"id":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another body: status = %d, want 422", w.Code)
+	}
+	if w, _ := send("/payments", "evt-1", `{"id":1}`); w.Header().Get(replayedHeader) != "" {
+		t.Error("a key was replayed across topics")
+	}
+
+	// A failed delivery is not cached, so its retry is produced.
+	producer.failures = producer.attempts + 1
+	if w, _ := send("/orders", "evt-2", `{"id":3}`); w.Code != http.StatusInternalServerError {
+		t.Fatalf("failing produce: status = %d, want 500", w.Code)
+	}
+	if w, _ := send("/orders", "evt-2", `{"id":3}`); w.Code != http.StatusAccepted || w.Header().Get(replayedHeader) != "" {
+		t.Errorf("retry of a failed delivery: status = %d, replayed = %q, want a fresh 202", w.Code, w.Header().Get(replayedHeader))
+	}
+
+	// Signed webhooks without a key are identified by their body.
+	send("/github", "", "Hello, World!")
+	if w, _ := send("/github", "", "Hello, World!"); w.Header().Get(replayedHeader) != "true" {
+		t.Errorf("signed retry without a key: status = %d, want it replayed", w.Code)
+	}
+
+	now = now.Add(time.Hour)
+	if _, again := send("/orders", "evt-1", `{"id":1}`); again["message_id"] == first["message_id"] {
+		t.Error("a response was replayed after the window")
+	}
+	if got := srv.metrics.IdempotentReplays.Load(); got != 2 {
+		t.Errorf("IdempotentReplays = %d, want 2", got)
+	}
+	if got := srv.metrics.IdempotencyConflicts.Load(); got != 1 {
+		t.Errorf("IdempotencyConflicts = %d, want 1", got)
+	}
+}
+
+func TestWebhook_IdempotentInProgress(t *testing.T) {
+	producer := &gatedProducer{gatedTopic: "orders", started: make(chan string, 1), release: make(chan struct{})}
+	srv := NewServer(ServerConfig{
+		Port:        8080,
+		Producer:    producer,
+		Auth:        auth.NewMultiAuth(nil, nil),
+		Logger:      zap.NewNop(),
+		Idempotency: Idempotency{Window: time.Minute, Header: "X-Delivery"},
+	})
+	send := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`))
+		req.Header.Set("X-Delivery", "d-1")
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		return w
+	}
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() { done <- send() }()
+	<-producer.started
+	if w := send(); w.Code != http.StatusConflict || w.Header().Get("Retry-After") == "" {
+		t.Errorf("retry during the original: status = %d, want 409 with Retry-After", w.Code)
+	}
+	close(producer.release)
+	if w := <-done; w.Code != http.StatusAccepted {
+		t.Fatalf("original: status = %d, want 202", w.Code)
+	}
+	if w := send(); w.Header().Get(replayedHeader) != "true" {
+		t.Errorf("retry after the original: status = %d, want it replayed", w.Code)
+	}
+	if got := producer.produced.Load(); got != 1 {
+		t.Errorf("produced %d messages, want 1", got)
+	}
+}
+
+// mapStore is an IdempotencyStore in a map, shared by the servers of a test
+// as Redis would be by replicas. It records the TTL each key was last set
+// with, but never expires them. With fail set, every call fails.
+type mapStore struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	ttls   map[string]time.Duration
+	fail   bool
+}
+
+func (m *mapStore) err() error {
+	if m.fail {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func (m *mapStore) SetNX(_ context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.values[key]; ok || m.fail {
+		return false, m.err()
+	}
+	m.values[key], m.ttls[key] = value, ttl
+	return true, nil
+}
+
+func (m *mapStore) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.values[key]
+	return v, ok, m.err()
+}
+
+func (m *mapStore) SetIfEqual(_ context.Context, key string, old, value []byte, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.values[key]; !ok || !bytes.Equal(v, old) || m.fail {
+		return false, m.err()
+	}
+	m.values[key], m.ttls[key] = value, ttl
+	return true, nil
+}
+
+func (m *mapStore) DelIfEqual(_ context.Context, key string, value []byte) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if v, ok := m.values[key]; !ok || !bytes.Equal(v, value) || m.fail {
+		return false, m.err()
+	}
+	delete(m.values, key)
+	return true, nil
+}
+
+func TestSharedIdempotency_Claims(t *testing.T) {
+	store := &mapStore{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+	b := &sharedIdempotency{kv: store, window: time.Hour, logger: zap.NewNop(), errors: &atomic.Int64{}}
+	body := sha256.Sum256([]byte(`{"id":1}`))
+
+	first, state := b.claim("k", body)
+	if state != idempotentNew {
+		t.Fatalf("claim() = %d, want idempotentNew", state)
+	}
+	if ttl := store.ttls[first.key]; ttl != idempotencyPendingTTL {
+		t.Errorf("pending claim ttl = %v, want %v", ttl, idempotencyPendingTTL)
+	}
+
+	// The first claim expires and another webhook claims the key; the first
+	// must not release the second's claim.
+	delete(store.values, first.key)
+	second, state := b.claim("k", body)
+	if state != idempotentNew {
+		t.Fatalf("claim() after expiry = %d, want idempotentNew", state)
+	}
+	b.release(first)
+	if _, state := b.claim("k", body); state != idempotentPending {
+		t.Errorf("claim() after a stale release = %d, want idempotentPending", state)
+	}
+	// Nor may it store its response over the second's claim.
+	b.store(first, http.StatusAccepted, map[string]string{"status": "accepted"})
+	if _, state := b.claim("k", body); state != idempotentPending {
+		t.Errorf("claim() after a stale store = %d, want idempotentPending", state)
+	}
+
+	b.store(second, http.StatusAccepted, map[string]string{"status": "accepted"})
+	if ttl := store.ttls[second.key]; ttl != time.Hour {
+		t.Errorf("stored response ttl = %v, want the window", ttl)
+	}
+	b.release(second)
+	if _, state := b.claim("k", body); state != idempotentReplay {
+		t.Errorf("claim() after the response was stored = %d, want idempotentReplay", state)
+	}
+}
+
+func TestWebhook_IdempotentSharedStore(t *testing.T) {
+	store := &mapStore{values: map[string][]byte{}, ttls: map[string]time.Duration{}}
+	replica := func() (*Server, *mockProducer) {
+		producer := &mockProducer{isHealthy: true}
+		return NewServer(ServerConfig{
+			Port:     8080,
+			Producer: producer,
+			Auth:     auth.NewMultiAuth(nil, nil),
+			Logger:   zap.NewNop(),
+			Idempotency: Idempotency{
+				Window:          time.Hour,
+				HashBodies:      true,
+				DuplicateStatus: http.StatusOK,
+				Store:           store,
+			},
+		}), producer
+	}
+	a, _ := replica()
+	b, producerB := replica()
+	send := func(srv *Server, body string) (*httptest.ResponseRecorder, map[string]string) {
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var resp map[string]string
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+
+	// Without a key, the body identifies the delivery, and a retry reaching
+	// another replica is answered 200 without producing it again.
+	w, first := send(a, `{"id":1}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("first delivery: status = %d, want 202", w.Code)
+	}
+	w, dup := send(b, `{"id":1}`)
+	if w.Code != http.StatusOK || w.Header().Get(replayedHeader) != "true" {
+		t.Errorf("duplicate on another replica: status = %d, replayed = %q, want 200 replayed", w.Code, w.Header().Get(replayedHeader))
+	}
+	if dup["message_id"] != first["message_id"] {
+		t.Errorf("duplicate response = %v, want the original %v", dup, first)
+	}
+	if producerB.topic != "" {
+		t.Error("the duplicate was produced")
+	}
+
+	// With the store down, webhooks are handled as if they had no key.
+	store.fail = true
+	if w, _ := send(b, `{"id":1}`); w.Code != http.StatusAccepted || w.Header().Get(replayedHeader) != "" {
+		t.Errorf("store down: status = %d, replayed = %q, want a fresh 202", w.Code, w.Header().Get(replayedHeader))
+	}
+	if n := b.metrics.IdempotencyStoreErrors.Load(); n != 1 {
+		t.Errorf("idempotency_store_errors = %d, want 1", n)
+	}
+}
+
+// -------------------------------------------------------------------
+// Verbose health — component checks in /health?verbose=1
+// -------------------------------------------------------------------
+
+func TestHealthHandler_Verbose(t *testing.T) {
+	producer := &mockProducer{isHealthy: true, produceErr: errors.New("broker: leader not available")}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	reloaded := now.Add(-time.Minute)
+	srv := NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     producer,
+		Auth:         auth.NewMultiAuth(nil, []string{"secret"}),
+		Logger:       zap.NewNop(),
+		Now:          func() time.Time { return now },
+		Brokers:      func() (int, bool) { return 3, true },
+		ReloadStatus: func() ReloadStatus { return ReloadStatus{Reloads: 2, LastReload: &reloaded} },
+		Spool: func() (SpoolStats, bool) {
+			return SpoolStats{Segments: 1, Outage: &SpoolOutageStats{Spooling: true}}, true
+		},
+	})
+	health := func(query, token string) (*httptest.ResponseRecorder, HealthReport) {
+		req := httptest.NewRequest(http.MethodGet, "/health"+query, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var report HealthReport
+		_ = json.Unmarshal(w.Body.Bytes(), &report)
+		return w, report
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{"id":1}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	srv.Handler().ServeHTTP(httptest.NewRecorder(), req)
+
+	if w, _ := health("?verbose=1", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("verbose without credentials: status = %d, want 401", w.Code)
+	}
+	if w, report := health("", ""); w.Code != http.StatusOK || report.Status != "healthy" || report.Reload != nil {
+		t.Errorf("plain /health = %d %s, want the static document", w.Code, w.Body)
+	}
+
+	w, report := health("?verbose=true", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if report.Status != "degraded" {
+		t.Errorf("status = %q while spooling, want degraded", report.Status)
+	}
+	p := report.Producer
+	if !p.Connected || p.Brokers == nil || *p.Brokers != 3 {
+		t.Errorf("producer = %+v, want connected with 3 brokers", p)
+	}
+	if e := p.LastError; e == nil || e.Topic != "orders" || !e.Time.Equal(now) || !strings.Contains(e.Error, "leader not available") {
+		t.Errorf("last_error = %+v, want the failed produce to orders", e)
+	}
+	if report.Spool == nil || report.Spool.Segments != 1 {
+		t.Errorf("spool = %+v, want 1 segment", report.Spool)
+	}
+	if r := report.Reload; r == nil || r.Reloads != 2 || r.LastReload == nil || !r.LastReload.Equal(reloaded) {
+		t.Errorf("reload = %+v, want 2 reloads", r)
+	}
+}
+
+// -------------------------------------------------------------------
+// Queue introspection — /admin/queues
+// -------------------------------------------------------------------
+
+func TestQueuesHandler(t *testing.T) {
+	gate := &gatedProducer{gatedTopic: "hot", started: make(chan string, 1), release: make(chan struct{})}
+	srv := NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     gate,
+		Auth:         auth.NewMultiAuth(nil, []string{"secret"}),
+		Logger:       zap.NewNop(),
+		ProduceQueue: ProduceQueue{Depth: 2, Workers: 1},
+		Receipts:     Receipts{Topic: "kahook.receipts", Buffer: 8},
+	})
+	defer srv.dispatcher.close()
+	post := func() <-chan *httptest.ResponseRecorder {
+		out := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/hot", strings.NewReader(`{"a":1}`))
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			out <- w
+		}()
+		return out
+	}
+	queues := func(token string) (*httptest.ResponseRecorder, QueueReport) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/queues", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var report QueueReport
+		_ = json.Unmarshal(w.Body.Bytes(), &report)
+		return w, report
+	}
+
+	// One message occupies the only worker and another waits in the queue.
+	inFlight := post()
+	<-gate.started
+	queued := post()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.dispatcher.depths()["hot"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second message never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if w, _ := queues(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without credentials: status = %d, want 401", w.Code)
+	}
+	w, report := queues("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	hot := report.ProduceQueues["hot"]
+	if hot.Depth != 1 || hot.Capacity != 2 || hot.Workers != 1 || hot.BusyWorkers != 1 || hot.OldestAgeSeconds <= 0 {
+		t.Errorf("produce_queues.hot = %+v, want 1 of 2 queued with its worker busy", hot)
+	}
+	if wk := report.Workers; wk == nil || wk.Total != 1 || wk.Busy != 1 || wk.Utilization != 1 {
+		t.Errorf("workers = %+v, want 1 of 1 busy", wk)
+	}
+	if r, ok := report.Records["receipts"]; !ok || r.Capacity != 8 {
+		t.Errorf("records = %+v, want the receipts backlog", report.Records)
+	}
+	if _, ok := report.Records["audit"]; ok {
+		t.Error("records include the audit log, which is off")
+	}
+
+	close(gate.release)
+	<-gate.started
+	for _, ch := range []<-chan *httptest.ResponseRecorder{inFlight, queued} {
+		if w := <-ch; w.Code != http.StatusAccepted {
+			t.Errorf("hot status = %d, want 202", w.Code)
+		}
+	}
+	if _, report := queues("secret"); report.ProduceQueues["hot"].OldestAgeSeconds != 0 {
+		t.Errorf("oldest_age_seconds = %v once the queue drained, want 0", report.ProduceQueues["hot"].OldestAgeSeconds)
+	}
+}
+
+// -------------------------------------------------------------------
+// Connection tuning — header bytes, HTTP/2, and the connection limit
+// -------------------------------------------------------------------
+
+func TestNewServer_ConnectionOptions(t *testing.T) {
+	srv := NewServer(ServerConfig{
+		Port:               8080,
+		Producer:           &mockProducer{isHealthy: true},
+		Auth:               auth.NewMultiAuth(nil, nil),
+		Logger:             zap.NewNop(),
+		HTTPMaxHeaderBytes: 65536,
+		DisableHTTP2:       true,
+	})
+	if got := srv.httpServer.MaxHeaderBytes; got != 65536 {
+		t.Errorf("MaxHeaderBytes = %d, want 65536", got)
+	}
+	if next := srv.httpServer.TLSNextProto; next == nil || len(next) != 0 {
+		t.Errorf("TLSNextProto = %v, want empty so HTTP/2 is not negotiated", next)
+	}
+
+	srv = NewServer(ServerConfig{Port: 8080, Producer: &mockProducer{}, Auth: auth.NewMultiAuth(nil, nil), Logger: zap.NewNop()})
+	if srv.httpServer.TLSNextProto != nil {
+		t.Error("HTTP/2 disabled by default")
+	}
+}
+
+func TestLimitListener(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var waits atomic.Int64
+	ln := newLimitListener(inner, 1, &waits)
+	defer ln.Close()
+
+	accepted := make(chan net.Conn, 2)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- c
+		}
+	}()
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", inner.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+	}
+
+	first := <-accepted
+	select {
+	case <-accepted:
+		t.Fatal("accepted a second connection while the first was open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	first.Close()
+	first.Close() // a second close must not free another slot
+	select {
+	case c := <-accepted:
+		c.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("second connection not accepted after the first closed")
+	}
+	if got := waits.Load(); got < 1 {
+		t.Errorf("waits = %d, want the second accept counted", got)
+	}
+}
+
+// -------------------------------------------------------------------
+// Load signal — saturation for autoscalers on /admin/load and /metrics
+// -------------------------------------------------------------------
+
+func TestLoadHandler(t *testing.T) {
+	gate := &gatedProducer{gatedTopic: "hot", started: make(chan string, 1), release: make(chan struct{})}
+	srv := NewServer(ServerConfig{
+		Port:         8080,
+		Producer:     gate,
+		Auth:         auth.NewMultiAuth(nil, []string{"secret"}),
+		Logger:       zap.NewNop(),
+		ProduceQueue: ProduceQueue{Depth: 2, Workers: 1},
+		Load:         LoadSignal{TargetInFlight: 4, TargetLatency: time.Hour},
+	})
+	defer srv.dispatcher.close()
+	post := func() <-chan *httptest.ResponseRecorder {
+		out := make(chan *httptest.ResponseRecorder, 1)
+		go func() {
+			req := httptest.NewRequest(http.MethodPost, "/hot", strings.NewReader(`{"a":1}`))
+			req.Header.Set("Authorization", "Bearer secret")
+			w := httptest.NewRecorder()
+			srv.Handler().ServeHTTP(w, req)
+			out <- w
+		}()
+		return out
+	}
+	load := func(token string) (*httptest.ResponseRecorder, LoadReport) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/load", nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		srv.Handler().ServeHTTP(w, req)
+		var report LoadReport
+		_ = json.Unmarshal(w.Body.Bytes(), &report)
+		return w, report
+	}
+
+	// One webhook occupies the only worker and another waits in the queue:
+	// two of four webhooks in flight and one of two queue slots used.
+	first := post()
+	<-gate.started
+	second := post()
+	deadline := time.Now().Add(2 * time.Second)
+	for srv.dispatcher.depths()["hot"] != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("second webhook never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if w, _ := load(""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without credentials: status = %d, want 401", w.Code)
+	}
+	w, report := load("secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if report.Load != 0.5 || report.InFlight != 2 {
+		t.Errorf("load = %v with %d in flight, want 0.5 with 2", report.Load, report.InFlight)
+	}
+	want := map[string]float64{"queue": 0.5, "in_flight": 0.5, "latency": 0}
+	if !reflect.DeepEqual(report.Components, want) {
+		t.Errorf("components = %v, want %v", report.Components, want)
+	}
+
+	close(gate.release)
+	<-gate.started
+	for _, ch := range []<-chan *httptest.ResponseRecorder{first, second} {
+		if w := <-ch; w.Code != http.StatusAccepted {
+			t.Errorf("hot status = %d, want 202", w.Code)
+		}
+	}
+	if _, report := load("secret"); report.InFlight != 0 || report.LatencyMs <= 0 || report.Load >= 0.5 {
+		t.Errorf("once delivered: %+v, want nothing in flight and a produce latency", report)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics?format=prometheus", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	srv.Handler().ServeHTTP(rec, req)
+	for _, line := range []string{"\nkahook_load ", `kahook_load_component{component="in_flight"} 0`} {
+		if !strings.Contains(rec.Body.String(), line) {
+			t.Errorf("/metrics lacks %q", line)
+		}
+	}
+}
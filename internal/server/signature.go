@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+)
+
+// verifySignature checks body against the topic's signature scheme, if
+// any. On failure it writes a 401 and returns false.
+func (s *Server) verifySignature(w http.ResponseWriter, r *http.Request, topic string, body []byte) bool {
+	scheme := s.current().topics[topic].Signature
+	if scheme == nil {
+		return true
+	}
+	if err := scheme.Verify(r.Header, body); err != nil {
+		s.metrics.SignatureRejected.Add(1)
+		s.loggerFor(r.Context()).Info("webhook signature rejected",
+			zap.String("scheme", scheme.Name()),
+			zap.String("remote_addr", r.RemoteAddr),
+			zap.Error(err),
+		)
+		s.writeError(w, http.StatusUnauthorized, "invalid_signature", "webhook signature is missing or invalid")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// sloWindowMinutes is how far back burn rates can look. The tracker keeps one
+// bucket per minute, so the longest window costs 60 small structs.
+const sloWindowMinutes = 60
+
+// LatencySLO is a produce latency objective: Target (e.g. 0.99) of produces
+// must succeed within Threshold. Failed produces count against it.
+type LatencySLO struct {
+	Threshold time.Duration
+	Target    float64
+}
+
+// sloTracker counts good and total produces overall and per minute, for
+// compliance and multi-window burn rates.
+type sloTracker struct {
+	slo LatencySLO
+	now func() time.Time
+
+	mu          sync.Mutex
+	total, good int64
+	buckets     [sloWindowMinutes]sloBucket
+}
+
+type sloBucket struct {
+	minute      int64 // Unix minute the counts belong to
+	total, good int64
+}
+
+func newSLOTracker(slo LatencySLO, now func() time.Time) *sloTracker {
+	return &sloTracker{slo: slo, now: now}
+}
+
+// observe records one produce attempt.
+func (t *sloTracker) observe(latency time.Duration, ok bool) {
+	good := ok && latency <= t.slo.Threshold
+	minute := t.now().Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b := &t.buckets[minute%sloWindowMinutes]
+	if b.minute != minute {
+		*b = sloBucket{minute: minute}
+	}
+	b.total++
+	t.total++
+	if good {
+		b.good++
+		t.good++
+	}
+}
+
+// SLOSnapshot is the /metrics view of the latency SLO. Compliance and
+// ErrorBudgetRemaining cover the process lifetime. A burn rate of 1 spends
+// the error budget exactly as fast as the target allows; above 1 it will run
+// out early, and 14.4 over an hour is the usual page threshold for a 30-day
+// budget.
+type SLOSnapshot struct {
+	ThresholdMs          float64 `json:"threshold_ms"`
+	Target               float64 `json:"target"`
+	Total                int64   `json:"total"`
+	Good                 int64   `json:"good"`
+	Compliance           float64 `json:"compliance"`
+	ErrorBudgetRemaining float64 `json:"error_budget_remaining"`
+	BurnRate5m           float64 `json:"burn_rate_5m"`
+	BurnRate1h           float64 `json:"burn_rate_1h"`
+}
+
+func (t *sloTracker) snapshot() SLOSnapshot {
+	minute := t.now().Unix() / 60
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	s := SLOSnapshot{
+		ThresholdMs: milliseconds(t.slo.Threshold),
+		Target:      t.slo.Target,
+		Total:       t.total,
+		Good:        t.good,
+		Compliance:  1,
+		BurnRate5m:  t.burnRate(minute, 5),
+		BurnRate1h:  t.burnRate(minute, 60),
+	}
+	if t.total > 0 {
+		s.Compliance = float64(t.good) / float64(t.total)
+	}
+	s.ErrorBudgetRemaining = 1 - (1-s.Compliance)/t.budget()
+	return s
+}
+
+// burnRate is the bad-event ratio over the last n minutes (including the
+// current one) divided by the ratio the target allows. Callers hold t.mu.
+func (t *sloTracker) burnRate(now int64, n int) float64 {
+	var total, good int64
+	for _, b := range t.buckets {
+		if b.minute > now-int64(n) && b.minute <= now {
+			total += b.total
+			good += b.good
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return (float64(total-good) / float64(total)) / t.budget()
+}
+
+// budget is the allowed bad-event ratio, 1 - Target.
+func (t *sloTracker) budget() float64 {
+	return 1 - t.slo.Target
+}
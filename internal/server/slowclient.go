@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMinBodyRateGrace is how long a body may take before the minimum
+// rate applies, so TCP slow start and a slow first packet are not penalised.
+const defaultMinBodyRateGrace = 2 * time.Second
+
+// errBodyTooSlow is returned while reading a body whose sender fell below
+// the minimum transfer rate.
+var errBodyTooSlow = errors.New("request body arrived below the minimum transfer rate")
+
+// minRateReader enforces a minimum average transfer rate on a request body
+// by moving the connection's read deadline as bytes arrive: after n bytes,
+// the sender has until start + grace + n/rate for the next ones. The
+// deadline never goes past limit, the request's ReadTimeout, if any.
+type minRateReader struct {
+	body  io.ReadCloser
+	rc    *http.ResponseController
+	rate  float64
+	start time.Time
+	limit time.Time
+	read  int64
+}
+
+// limitBodyRate wraps r.Body so a sender trickling its body is cut off once
+// it falls below bytesPerSecond. Connections whose read deadline cannot be
+// set are left unprotected.
+func (s *Server) limitBodyRate(w http.ResponseWriter, r *http.Request) {
+	if s.minBodyRate <= 0 {
+		return
+	}
+	// Read deadlines are enforced against the real clock, not s.now.
+	now := time.Now()
+	m := &minRateReader{
+		body:  r.Body,
+		rc:    http.NewResponseController(w),
+		rate:  float64(s.minBodyRate),
+		start: now.Add(s.minBodyGrace),
+	}
+	if s.httpServer.ReadTimeout > 0 {
+		m.limit = now.Add(s.httpServer.ReadTimeout)
+	}
+	if m.setDeadline() != nil {
+		return
+	}
+	r.Body = m
+}
+
+func (m *minRateReader) setDeadline() error {
+	deadline := m.start.Add(time.Duration(float64(m.read) / m.rate * float64(time.Second)))
+	if !m.limit.IsZero() && deadline.After(m.limit) {
+		deadline = m.limit
+	}
+	return m.rc.SetReadDeadline(deadline)
+}
+
+func (m *minRateReader) Read(p []byte) (int, error) {
+	n, err := m.body.Read(p)
+	m.read += int64(n)
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return n, errBodyTooSlow
+	}
+	if err == nil {
+		_ = m.setDeadline()
+	}
+	return n, err
+}
+
+func (m *minRateReader) Close() error {
+	return m.body.Close()
+}
+
+type connRequestsKey struct{}
+
+// connRequests stores a per-connection request counter in the context. It
+// is installed as (part of) http.Server.ConnContext.
+func connRequests(ctx context.Context, _ net.Conn) context.Context {
+	return context.WithValue(ctx, connRequestsKey{}, new(atomic.Int64))
+}
+
+// limitConnRequests marks the response to a connection's limit-th request as
+// its last, so one client cannot hold a keep-alive connection, and the
+// backend it is pinned to, indefinitely. The client reconnects for the
+// next request.
+func (s *Server) limitConnRequests(limit int, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n, ok := r.Context().Value(connRequestsKey{}).(*atomic.Int64); ok && n.Add(1) == int64(limit) {
+			w.Header().Set("Connection", "close")
+			s.metrics.ConnectionsCapped.Add(1)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,18 @@
+package server
+
+import "github.com/kahook/internal/auth"
+
+// subjectHeader carries the subject claim of the JWT a message was sent
+// with.
+const subjectHeader = "Kahook-Subject"
+
+// setSubjectHeader sets the subject header for a request authenticated as
+// principal by a JWT, and otherwise removes one the sender forwarded, so
+// the header can be trusted.
+func setSubjectHeader(headers map[string]string, principal string) {
+	if subject, ok := auth.JWTSubject(principal); ok {
+		headers[subjectHeader] = subject
+		return
+	}
+	delete(headers, subjectHeader)
+}
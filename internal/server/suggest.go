@@ -0,0 +1,67 @@
+package server
+
+import "sort"
+
+// maxSuggestions caps how many close matches an unknown-route response lists.
+const maxSuggestions = 3
+
+// suggestTopics returns up to maxSuggestions known topics within a small edit
+// distance of name, closest first. It is only used in the dev profile, where
+// helping a developer spot a typo outweighs revealing the configured routes.
+func suggestTopics(name string, known map[string]bool) []string {
+	type candidate struct {
+		topic string
+		dist  int
+	}
+
+	threshold := len(name) / 3
+	if threshold < 2 {
+		threshold = 2
+	}
+
+	var matches []candidate
+	for topic := range known {
+		if d := levenshtein(name, topic); d <= threshold {
+			matches = append(matches, candidate{topic, d})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].topic < matches[j].topic
+	})
+
+	if len(matches) > maxSuggestions {
+		matches = matches[:maxSuggestions]
+	}
+	out := make([]string, len(matches))
+	for i, m := range matches {
+		out[i] = m.topic
+	}
+	return out
+}
+
+// levenshtein returns the edit distance between a and b, operating on bytes
+// since topic names are restricted to ASCII.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// logSummary logs, once the listener is bound, one line that shows what
+// the server accepts: its listener, each route with its topic and auth, the
+// admin endpoints, and the optional features enabled. Misconfigurations
+// such as a missing route or the wrong auth type are then visible in the
+// first screen of logs rather than at the first request. Topics configured
+// with options that no path can reach are logged as warnings.
+func (s *Server) logSummary(ln net.Listener) {
+	scheme := "http"
+	if s.tlsCertFile != "" {
+		scheme = "https"
+	}
+	s.logger.Info("startup summary",
+		zap.String("listener", scheme+"://"+ln.Addr().String()),
+		zap.Strings("routes", s.routeSummary()),
+		zap.Strings("endpoints", s.endpointSummary()),
+		zap.Strings("features", s.featureSummary()),
+	)
+
+	s.warnUnreachableTopics()
+}
+
+// warnUnreachableTopics logs a warning for each of unreachableTopics.
+func (s *Server) warnUnreachableTopics() {
+	allowed := sortedKeys(s.current().allowedTopics)
+	for _, topic := range s.unreachableTopics() {
+		s.logger.Warn("topic options configured for a topic no path accepts",
+			zap.String("topic", topic),
+			zap.Strings("allowed_topics", allowed),
+		)
+	}
+}
+
+// logReloaded logs the routes the server accepts after a reload, with the
+// same warnings as logSummary.
+func (s *Server) logReloaded() {
+	s.logger.Info("configuration reloaded", zap.Strings("routes", s.routeSummary()))
+	s.warnUnreachableTopics()
+}
+
+// routeSummary lists each webhook path as "/path -> topic (options)",
+// sorted by path. Without an allowlist any topic is accepted, shown as
+// "/{topic}".
+func (s *Server) routeSummary() []string {
+	rt := s.current()
+	routes := make(map[string]string, len(rt.routePaths)+len(rt.allowedTopics))
+	for path, topic := range rt.routePaths {
+		routes[path] = topic
+	}
+	for topic := range rt.allowedTopics {
+		if _, ok := routes[topic]; !ok && !rt.aliasedTopics[topic] {
+			routes[topic] = topic
+		}
+	}
+
+	auth := "none"
+	if rt.auth != nil {
+		if schemes := rt.auth.Schemes(); len(schemes) > 0 {
+			auth = strings.Join(schemes, "|")
+		}
+	}
+
+	rows := make([]string, 0, len(routes)+1)
+	for _, path := range sortedKeys(routes) {
+		topic := routes[path]
+		rows = append(rows, fmt.Sprintf("/%s -> %s (%s)", path, topic,
+			strings.Join(append([]string{"auth=" + auth}, s.topicSummary(topic)...), ", ")))
+	}
+	if len(rt.allowedTopics) == 0 {
+		rows = append(rows, fmt.Sprintf("/{topic} -> {topic} (auth=%s)", auth))
+	}
+	return rows
+}
+
+// topicSummary lists a topic's non-default options as key=value.
+func (s *Server) topicSummary(topic string) []string {
+	opts := s.current().topics[topic]
+	var out []string
+	if opts.Payload != "" && opts.Payload != PayloadRaw {
+		out = append(out, "payload="+string(opts.Payload))
+	}
+	if opts.Response != "" && opts.Response != ResponseJSON {
+		out = append(out, "response="+string(opts.Response))
+	}
+	if opts.Priority != "" && opts.Priority != PriorityNormal {
+		out = append(out, "priority="+string(opts.Priority))
+	}
+	if len(opts.Countries.Allow)+len(opts.Countries.Deny) > 0 {
+		out = append(out, "countries=restricted")
+	}
+	if len(opts.Networks) > 0 {
+		out = append(out, "networks=restricted")
+	}
+	if opts.Upcast != nil {
+		out = append(out, "upcast")
+	}
+	if opts.Schema != nil {
+		out = append(out, "schema")
+	}
+	if opts.Transform != nil {
+		out = append(out, "transforms")
+	}
+	if opts.CloudEvents.Mode != "" {
+		out = append(out, "cloudevents="+string(opts.CloudEvents.Mode))
+	}
+	if opts.KeepCompressed {
+		out = append(out, "compression=keep")
+	}
+	if opts.Key != nil {
+		out = append(out, "key=payload")
+	}
+	if opts.Signature != nil {
+		out = append(out, "signature="+opts.Signature.Name())
+	}
+	if s.rateLimitExempt != nil && s.rateLimitExempt.topics[topic] {
+		out = append(out, "bandwidth=exempt")
+	}
+	return out
+}
+
+// endpointSummary lists the optional endpoints registered.
+func (s *Server) endpointSummary() []string {
+	var out []string
+	if s.batch != nil {
+		out = append(out, "/batch/{topic}")
+	}
+	if s.verifier != nil {
+		out = append(out, "/admin/verify")
+	}
+	if a := s.current().auth; a != nil && a.HasAuth() {
+		out = append(out, "/admin/credentials")
+	}
+	if s.usage != nil {
+		out = append(out, "/admin/usage")
+	}
+	if s.tail != nil {
+		out = append(out, "/admin/tail")
+	}
+	if s.errorBudgets != nil {
+		out = append(out, "/admin/error-budgets")
+	}
+	if s.devProfile {
+		out = append(out, consolePath)
+	}
+	return out
+}
+
+// featureSummary lists the optional request-path features enabled.
+func (s *Server) featureSummary() []string {
+	rt := s.current()
+	features := map[string]bool{
+		"tls":                s.tlsCertFile != "",
+		"hsts":               s.hsts,
+		"proxy_protocol":     s.proxyProtocol != nil,
+		"connection_age":     s.connAger != nil,
+		"min_body_rate":      s.minBodyRate > 0,
+		"metrics_tokens":     s.metricsAuth != nil,
+		"strict_routes":      s.strictRoutes,
+		"request_limits":     rt.requestRate != (RequestRates{}),
+		"bandwidth_limits":   rt.topicBandwidth != nil || rt.principalBandwidth != nil,
+		"dead_letter":        s.deadLetter.Topic != "" || s.deadLetter.Retries > 0,
+		"audit_log":          s.audit != nil,
+		"receipts":           s.receipts != nil,
+		"access_log":         s.accessLog != nil,
+		"otel_spans":         s.spans != nil,
+		"priority_shedding":  s.priority != nil,
+		"error_budgets":      s.errorBudgets != nil,
+		"consumer_lag":       s.consumerLag != nil,
+		"produce_queue":      s.dispatcher != nil,
+		"overload_readiness": s.overload != nil,
+		"latency_slo":        s.metrics.slo != nil,
+		"geoip":              s.geoip != nil,
+		"trusted_proxies":    len(s.clientIP.TrustedProxies) > 0,
+		"clock_checks":       s.clockOffset != nil,
+		"config_drift":       s.configDrift != nil,
+		"probe_auth":         s.probes.Auth,
+		"leader_election":    s.isLeader != nil,
+		"usage_reports":      s.usage != nil,
+		"fixture_recording":  s.recorder != nil,
+		"terse_errors":       s.terseErrors,
+		"quarantine":         s.quarantine.Topic != "",
+		"admin_api":          s.adminServer != nil,
+		"response_signing":   s.responseSigner != nil,
+	}
+	var out []string
+	for name, on := range features {
+		if on {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// unreachableTopics returns topics with options that the allowlist rejects,
+// sorted.
+func (s *Server) unreachableTopics() []string {
+	rt := s.current()
+	if len(rt.allowedTopics) == 0 {
+		return nil
+	}
+	var out []string
+	for topic := range rt.topics {
+		if !rt.allowedTopics[topic] {
+			out = append(out, topic)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,255 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// tailBuffer is how many events a slow tail client may fall behind by before
+// events are dropped for it.
+const tailBuffer = 64
+
+// tailHeartbeat is how often an idle tail stream sends a comment, so proxies
+// do not time it out.
+const tailHeartbeat = 15 * time.Second
+
+// LiveTail enables /admin/tail, a Server-Sent Events stream of the messages
+// being produced, so a new integration can be checked live without consumer
+// access to the cluster. It is enabled when MaxSubscribers is positive.
+type LiveTail struct {
+	// MaxSubscribers bounds the streams open at once.
+	MaxSubscribers int
+	// MaxBodyBytes caps the message bytes a stream may ask to include in
+	// each event; zero sends metadata only.
+	MaxBodyBytes int
+}
+
+// TailEvent describes one produced message on /admin/tail. Body holds the
+// first bytes of the message value when the stream asked for them, with
+// invalid UTF-8 replaced.
+type TailEvent struct {
+	Time          time.Time `json:"time"`
+	Topic         string    `json:"topic"`
+	MessageID     string    `json:"message_id"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Principal     string    `json:"principal,omitempty"`
+	Key           string    `json:"key,omitempty"`
+	ContentType   string    `json:"content_type,omitempty"`
+	Encoding      string    `json:"encoding"`
+	Size          int       `json:"size"`
+	Body          string    `json:"body,omitempty"`
+	BodyTruncated bool      `json:"body_truncated,omitempty"`
+}
+
+var errTooManyTails = errors.New("too many tail streams")
+
+// tailHub fans produced messages out to /admin/tail streams.
+type tailHub struct {
+	cfg    LiveTail
+	active atomic.Int32 // subscriber count, read without the lock
+
+	mu     sync.Mutex
+	subs   map[*tailSubscriber]struct{}
+	closed bool
+}
+
+type tailSubscriber struct {
+	topic   string  // "" for every topic
+	sample  float64 // fraction of matching messages sent
+	body    int     // value bytes included per event
+	events  chan TailEvent
+	dropped atomic.Int64
+}
+
+// newTailHub returns nil when the live tail is disabled.
+func newTailHub(cfg LiveTail) *tailHub {
+	if cfg.MaxSubscribers <= 0 {
+		return nil
+	}
+	return &tailHub{cfg: cfg, subs: make(map[*tailSubscriber]struct{})}
+}
+
+func (h *tailHub) subscribe(topic string, sample float64, body int) (*tailSubscriber, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed || len(h.subs) >= h.cfg.MaxSubscribers {
+		return nil, errTooManyTails
+	}
+	sub := &tailSubscriber{topic: topic, sample: sample, body: body, events: make(chan TailEvent, tailBuffer)}
+	h.subs[sub] = struct{}{}
+	h.active.Add(1)
+	return sub, nil
+}
+
+func (h *tailHub) unsubscribe(sub *tailSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		h.active.Add(-1)
+	}
+}
+
+// publish sends ev, with the first bytes of value each stream asked for, to
+// the streams tailing its topic. It never blocks: a stream that has fallen
+// behind misses the event and is told how many it missed.
+func (h *tailHub) publish(ev TailEvent, value []byte) {
+	if h.active.Load() == 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for sub := range h.subs {
+		if sub.topic != "" && sub.topic != ev.Topic {
+			continue
+		}
+		if sub.sample < 1 && rand.Float64() >= sub.sample {
+			continue
+		}
+		out := ev
+		if sub.body > 0 {
+			n := min(sub.body, len(value))
+			out.Body = strings.ToValidUTF8(string(value[:n]), "�")
+			out.BodyTruncated = n < len(value)
+		}
+		select {
+		case sub.events <- out:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// close ends every stream and refuses new ones, so open streams do not hold
+// up a graceful shutdown.
+func (h *tailHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		close(sub.events)
+		delete(h.subs, sub)
+	}
+	h.active.Store(0)
+}
+
+// tailHandler streams produced messages as Server-Sent Events. Query
+// parameters: topic (default every topic), sample (fraction in (0,1] of
+// messages sent, default 1), and body (value bytes per event, up to
+// MaxBodyBytes, default 0). Like /admin/credentials, it requires publish
+// credentials when auth is enabled. Credentials limited to some topics may
+// only tail one of those, and must name it.
+func (s *Server) tailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
+		return
+	}
+
+	rt := s.current()
+	principal, scope, ok := rt.auth.Authorize(r)
+	if !ok {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	rt.credentials.record(rolePublish, principal)
+	notePrincipal(r, principal)
+
+	q := r.URL.Query()
+	topic := q.Get("topic")
+	if topic != "" && !validTopicName.MatchString(topic) {
+		s.writeError(w, http.StatusBadRequest, "invalid_topic",
+			"topic must match [a-zA-Z0-9._-] and be 1-249 characters")
+		return
+	}
+	if topic == "" && scope.Restricted() {
+		s.metrics.ScopeRejected.Add(1)
+		s.writeError(w, http.StatusForbidden, "topic_forbidden",
+			"these credentials may only tail topics they may publish to; set topic")
+		return
+	}
+	if !scope.Allows(topic) {
+		s.metrics.ScopeRejected.Add(1)
+		s.writeError(w, http.StatusForbidden, "topic_forbidden",
+			fmt.Sprintf("these credentials may not tail topic %q", topic))
+		return
+	}
+	sample := 1.0
+	if v := q.Get("sample"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			s.writeError(w, http.StatusBadRequest, "invalid_sample", "sample must be a fraction in (0, 1]")
+			return
+		}
+		sample = f
+	}
+	body := 0
+	if v := q.Get("body"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > s.tail.cfg.MaxBodyBytes {
+			s.writeError(w, http.StatusBadRequest, "invalid_body",
+				fmt.Sprintf("body must be a byte count from 0 to %d", s.tail.cfg.MaxBodyBytes))
+			return
+		}
+		body = n
+	}
+
+	sub, err := s.tail.subscribe(topic, sample, body)
+	if err != nil {
+		w.Header().Set("Retry-After", "10")
+		s.writeError(w, http.StatusServiceUnavailable, "too_many_tails",
+			fmt.Sprintf("at most %d tail streams may be open at once", s.tail.cfg.MaxSubscribers))
+		return
+	}
+	defer s.tail.unsubscribe(sub)
+
+	// The stream outlives the server's write timeout.
+	rc := http.NewResponseController(w)
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	label := topic
+	if label == "" {
+		label = "all topics"
+	}
+	fmt.Fprintf(w, ": tailing %s\n\n", label)
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(tailHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev, ok := <-sub.events:
+			if !ok {
+				return
+			}
+			if n := sub.dropped.Swap(0); n > 0 {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", n)
+			}
+			data, err := json.Marshal(ev)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// TraceHeaders is how inbound tracing headers (W3C traceparent and
+// tracestate, B3 single and multi-header, and X-Cloud-Trace-Context) are
+// handled.
+type TraceHeaders string
+
+const (
+	// TraceForward forwards tracing headers as message headers like any
+	// other header. This is the default.
+	TraceForward TraceHeaders = "forward"
+	// TraceStrip drops tracing headers, so senders' traces do not leak into
+	// Kafka.
+	TraceStrip TraceHeaders = "strip"
+	// TraceParent continues the sender's trace: kahook handles the webhook
+	// as a span whose parent is the inbound trace context, in whichever
+	// format it arrived, and the message carries a W3C traceparent for
+	// that span in place of the inbound headers. Without an inbound trace
+	// context, the span starts a new trace.
+	TraceParent TraceHeaders = "parent"
+)
+
+// traceparentHeader is the W3C trace context header, in the lowercase form
+// Kafka tracing instrumentations read.
+const traceparentHeader = "traceparent"
+
+// traceHeaderNames are the tracing headers the policy applies to.
+var traceHeaderNames = []string{
+	"Traceparent", "Tracestate",
+	"B3", "X-B3-Traceid", "X-B3-Spanid", "X-B3-Parentspanid", "X-B3-Sampled", "X-B3-Flags",
+	"X-Cloud-Trace-Context",
+}
+
+// traceContext identifies a span: its trace, its own ID, and whether the
+// trace is sampled.
+type traceContext struct {
+	traceID string // 32 lowercase hex digits
+	spanID  string // 16 lowercase hex digits
+	sampled bool
+}
+
+// traceparent formats tc as a W3C traceparent value.
+func (tc traceContext) traceparent() string {
+	flags := "00"
+	if tc.sampled {
+		flags = "01"
+	}
+	return "00-" + tc.traceID + "-" + tc.spanID + "-" + flags
+}
+
+// setTraceHeaders applies the TraceHeaders policy to a message's headers,
+// built from the request headers of r. With TraceParent it returns the span
+// kahook handled the webhook as; otherwise the zero traceContext. When the
+// request's span is recorded the policy is always TraceParent, and the
+// message's traceparent names the producer span, a child of the request's.
+func (s *Server) setTraceHeaders(headers map[string]string, r *http.Request) traceContext {
+	rs := requestSpanFrom(r.Context())
+	if rs == nil && s.traceHeaders != TraceStrip && s.traceHeaders != TraceParent {
+		return traceContext{}
+	}
+	for _, name := range traceHeaderNames {
+		delete(headers, name)
+		delete(headers, strings.ToLower(name))
+	}
+	if rs == nil && s.traceHeaders == TraceStrip {
+		return traceContext{}
+	}
+
+	h := r.Header
+	if _, ok := parseTraceContext(h); ok && h.Get("Traceparent") != "" {
+		if ts := h.Get("Tracestate"); ts != "" {
+			headers["tracestate"] = ts
+		}
+	}
+	if rs != nil {
+		rs.producer = traceContext{traceID: rs.traceID, spanID: randomHex(8), sampled: rs.sampled}
+		headers[traceparentHeader] = rs.producer.traceparent()
+		return rs.traceContext
+	}
+	span, _ := startSpan(h)
+	headers[traceparentHeader] = span.traceparent()
+	return span
+}
+
+// traceFields returns log fields identifying span, if any.
+func traceFields(span traceContext) []zap.Field {
+	if span.traceID == "" {
+		return nil
+	}
+	return []zap.Field{zap.String("trace_id", span.traceID), zap.String("span_id", span.spanID)}
+}
+
+// parseTraceContext reads the inbound trace context from h, preferring
+// traceparent, then B3, then X-Cloud-Trace-Context.
+func parseTraceContext(h http.Header) (traceContext, bool) {
+	if v := h.Get("Traceparent"); v != "" {
+		if tc, ok := parseTraceparent(v); ok {
+			return tc, true
+		}
+	}
+	if v := h.Get("B3"); v != "" {
+		if tc, ok := parseB3(v); ok {
+			return tc, true
+		}
+	}
+	if v := h.Get("X-B3-Traceid"); v != "" {
+		sampled := h.Get("X-B3-Sampled")
+		if h.Get("X-B3-Flags") == "1" {
+			sampled = "d"
+		}
+		if tc, ok := newTraceContext(v, h.Get("X-B3-Spanid"), sampled != "0"); ok {
+			return tc, true
+		}
+	}
+	if v := h.Get("X-Cloud-Trace-Context"); v != "" {
+		if tc, ok := parseCloudTrace(v); ok {
+			return tc, true
+		}
+	}
+	return traceContext{}, false
+}
+
+// parseTraceparent parses "00-<trace-id>-<span-id>-<flags>".
+func parseTraceparent(v string) (traceContext, bool) {
+	parts := strings.Split(v, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return traceContext{}, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return traceContext{}, false
+	}
+	return newTraceContext(parts[1], parts[2], flags&1 == 1)
+}
+
+// parseB3 parses the single-header form "<trace-id>-<span-id>[-<sampled>[-<parent>]]".
+// A bare sampling decision ("0", "1", "d") carries no context.
+func parseB3(v string) (traceContext, bool) {
+	parts := strings.Split(v, "-")
+	if len(parts) < 2 {
+		return traceContext{}, false
+	}
+	sampled := len(parts) < 3 || parts[2] != "0"
+	return newTraceContext(parts[0], parts[1], sampled)
+}
+
+// parseCloudTrace parses "<trace-id>/<decimal span-id>;o=<0|1>".
+func parseCloudTrace(v string) (traceContext, bool) {
+	ids, opts, _ := strings.Cut(v, ";")
+	traceID, spanID, ok := strings.Cut(ids, "/")
+	if !ok {
+		return traceContext{}, false
+	}
+	span, err := strconv.ParseUint(spanID, 10, 64)
+	if err != nil {
+		return traceContext{}, false
+	}
+	return newTraceContext(traceID, strconv.FormatUint(span, 16), opts != "o=0")
+}
+
+// newTraceContext validates hex IDs, left-padding 64-bit trace IDs and
+// short span IDs as B3 and Cloud Trace allow. All-zero IDs are invalid.
+func newTraceContext(traceID, spanID string, sampled bool) (traceContext, bool) {
+	traceID, spanID = strings.ToLower(traceID), strings.ToLower(spanID)
+	if len(traceID) == 16 {
+		traceID = strings.Repeat("0", 16) + traceID
+	}
+	if n := len(spanID); n > 0 && n < 16 {
+		spanID = strings.Repeat("0", 16-n) + spanID
+	}
+	if !validTraceID(traceID, 32) || !validTraceID(spanID, 16) {
+		return traceContext{}, false
+	}
+	return traceContext{traceID: traceID, spanID: spanID, sampled: sampled}, true
+}
+
+func validTraceID(id string, n int) bool {
+	if len(id) != n || strings.Trim(id, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
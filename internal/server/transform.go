@@ -0,0 +1,35 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/kahook/internal/transform"
+)
+
+// transformPayload applies the topic's transforms, if any, to body, a
+// payload received at path with requestID. A payload the transforms cannot
+// apply to is a violation.
+func (s *Server) transformPayload(r *http.Request, topic, path, requestID string, received time.Time, body []byte) ([]byte, *violation) {
+	p := s.current().topics[topic].Transform
+	if p == nil {
+		return body, nil
+	}
+	out, err := p.Apply(body, transform.Meta{
+		ReceivedAt: received,
+		Topic:      topic,
+		Path:       path,
+		RequestID:  requestID,
+		Header:     r.Header,
+	})
+	if err != nil {
+		return nil, &violation{
+			kind:    ViolationTransform,
+			status:  http.StatusBadRequest,
+			code:    "transform_failed",
+			message: "topic transforms payloads but the payload is not a JSON object",
+		}
+	}
+	s.metrics.PayloadsTransformed.Add(1)
+	return out, nil
+}
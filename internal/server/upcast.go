@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/upcast"
+)
+
+// upcastFromHeader records the version a payload was sent in when it was
+// upcast before producing.
+const upcastFromHeader = "Kahook-Upcast-From"
+
+// upcastPayload applies the topic's Upcaster, if any, to body. The result's
+// Body is the body to produce; From and To are empty when no Upcaster is
+// configured. A payload that cannot be upcast is a violation.
+func (s *Server) upcastPayload(r *http.Request, topic string, body []byte) (upcast.Result, *violation) {
+	up := s.current().topics[topic].Upcast
+	if up == nil {
+		return upcast.Result{Body: body}, nil
+	}
+	res, err := up.Apply(r.Header, body)
+	if err != nil {
+		return upcast.Result{}, &violation{
+			kind:    ViolationUpcast,
+			status:  http.StatusBadRequest,
+			code:    "upcast_failed",
+			message: "payload has a version that must be upcast but is not a JSON object",
+		}
+	}
+	if res.Upcast() {
+		s.metrics.PayloadsUpcast.Add(1)
+		s.loggerFor(r.Context()).Debug("payload upcast",
+			zap.String("from", res.From),
+			zap.String("to", res.To),
+		)
+	}
+	return res, nil
+}
+
+// setUpcastHeaders records the version an upcast payload was sent in and,
+// when the topic reads versions from a header that is forwarded, replaces
+// its value with the version the payload now has. A Kahook-Upcast-From sent
+// by the client is removed.
+func (s *Server) setUpcastHeaders(headers map[string]string, topic string, res upcast.Result) {
+	if !res.Upcast() {
+		delete(headers, upcastFromHeader)
+		return
+	}
+	headers[upcastFromHeader] = res.From
+	if h := s.current().topics[topic].Upcast.Header(); h != "" {
+		if _, ok := headers[h]; ok {
+			headers[h] = res.To
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// anonymousTenant is the tenant of webhooks sent without credentials.
+const anonymousTenant = "anonymous"
+
+// defaultTenantHeader is the message header carrying the webhook's tenant
+// when none is configured.
+const defaultTenantHeader = "Kahook-Tenant"
+
+// UsageReports summarizes webhook traffic per tenant and topic every
+// Interval, for chargeback without scraping metrics history. The tenant is
+// the authenticated principal. Reports are served on /admin/usage and, when
+// Topic is set, produced to it as JSON. Zero Interval disables them.
+type UsageReports struct {
+	Interval time.Duration
+	Topic    string
+
+	// Instance identifies this replica in reports, e.g. its hostname.
+	Instance string
+
+	// TenantHeader is the message header each message's tenant is sent as
+	// (default Kahook-Tenant), so consumers can attribute cost per message.
+	TenantHeader string
+}
+
+// UsageRecord is one tenant's traffic to one topic in a report. Requests and
+// Bytes count webhooks whose body was read, Messages those produced.
+type UsageRecord struct {
+	Tenant   string `json:"tenant"`
+	Topic    string `json:"topic"`
+	Requests int64  `json:"requests"`
+	Bytes    int64  `json:"bytes"`
+	Messages int64  `json:"messages"`
+}
+
+// UsageReport is the traffic of one reporting window, sorted by tenant and
+// topic.
+type UsageReport struct {
+	Instance string        `json:"instance,omitempty"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Usage    []UsageRecord `json:"usage"`
+}
+
+// UsageResponse is the body returned by /admin/usage: the window in
+// progress, and the last completed one once a report has been emitted.
+type UsageResponse struct {
+	Current UsageReport  `json:"current"`
+	Last    *UsageReport `json:"last,omitempty"`
+}
+
+type usageKey struct {
+	tenant, topic string
+}
+
+type usageCounts struct {
+	requests, bytes, messages int64
+}
+
+// usageTracker accumulates the current window's usage and emits a report
+// when it closes.
+type usageTracker struct {
+	cfg      UsageReports
+	header   string
+	producer KafkaProducer
+	logger   *zap.Logger
+	now      func() time.Time
+
+	mu     sync.Mutex
+	start  time.Time
+	counts map[usageKey]*usageCounts
+	last   *UsageReport
+}
+
+// newUsageTracker returns nil when usage reports are disabled.
+func newUsageTracker(cfg UsageReports, producer KafkaProducer, logger *zap.Logger, now func() time.Time) *usageTracker {
+	if cfg.Interval <= 0 {
+		return nil
+	}
+	header := cfg.TenantHeader
+	if header == "" {
+		header = defaultTenantHeader
+	}
+	return &usageTracker{
+		cfg:      cfg,
+		header:   http.CanonicalHeaderKey(header),
+		producer: producer,
+		logger:   logger,
+		now:      now,
+		start:    now(),
+		counts:   make(map[usageKey]*usageCounts),
+	}
+}
+
+// tenant names the tenant a principal's traffic is attributed to.
+func tenant(principal string) string {
+	if principal == "" {
+		return anonymousTenant
+	}
+	return principal
+}
+
+// received counts a webhook body of n bytes from principal to topic.
+func (u *usageTracker) received(principal, topic string, n int) {
+	u.mu.Lock()
+	c := u.countsFor(principal, topic)
+	c.requests++
+	c.bytes += int64(n)
+	u.mu.Unlock()
+}
+
+// produced counts a message produced for principal to topic.
+func (u *usageTracker) produced(principal, topic string) {
+	u.mu.Lock()
+	u.countsFor(principal, topic).messages++
+	u.mu.Unlock()
+}
+
+// countsFor returns the window's counts for principal and topic. The caller
+// holds u.mu.
+func (u *usageTracker) countsFor(principal, topic string) *usageCounts {
+	key := usageKey{tenant(principal), topic}
+	c, ok := u.counts[key]
+	if !ok {
+		c = &usageCounts{}
+		u.counts[key] = c
+	}
+	return c
+}
+
+// report builds a report of the window so far. The caller holds u.mu.
+func (u *usageTracker) report(end time.Time) UsageReport {
+	r := UsageReport{
+		Instance: u.cfg.Instance,
+		Start:    u.start.UTC(),
+		End:      end.UTC(),
+		Usage:    make([]UsageRecord, 0, len(u.counts)),
+	}
+	for key, c := range u.counts {
+		r.Usage = append(r.Usage, UsageRecord{
+			Tenant:   key.tenant,
+			Topic:    key.topic,
+			Requests: c.requests,
+			Bytes:    c.bytes,
+			Messages: c.messages,
+		})
+	}
+	sort.Slice(r.Usage, func(i, j int) bool {
+		a, b := r.Usage[i], r.Usage[j]
+		if a.Tenant != b.Tenant {
+			return a.Tenant < b.Tenant
+		}
+		return a.Topic < b.Topic
+	})
+	return r
+}
+
+// snapshot returns the window in progress and the last completed one.
+func (u *usageTracker) snapshot() UsageResponse {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return UsageResponse{Current: u.report(u.now()), Last: u.last}
+}
+
+// flush closes the current window, starts a new one, and emits the closed
+// window's report.
+func (u *usageTracker) flush(ctx context.Context) {
+	u.mu.Lock()
+	now := u.now()
+	r := u.report(now)
+	u.last = &r
+	u.start = now
+	u.counts = make(map[usageKey]*usageCounts)
+	u.mu.Unlock()
+
+	u.emit(ctx, r)
+}
+
+// emit produces r to the usage topic, when one is configured.
+func (u *usageTracker) emit(ctx context.Context, r UsageReport) {
+	if u.cfg.Topic == "" {
+		return
+	}
+	value, err := json.Marshal(r)
+	if err != nil {
+		u.logger.Error("failed to encode usage report", zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, produceTimeout)
+	defer cancel()
+	var key []byte
+	if u.cfg.Instance != "" {
+		key = []byte(u.cfg.Instance)
+	}
+	headers := map[string]string{contentTypeHeader: "application/json"}
+	if err := u.producer.Produce(ctx, u.cfg.Topic, key, value, headers); err != nil {
+		u.logger.Warn("failed to produce usage report",
+			zap.String("topic", u.cfg.Topic),
+			zap.Time("start", r.Start),
+			zap.Error(err),
+		)
+	}
+}
+
+// run flushes every Interval until ctx is done.
+func (u *usageTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			u.flush(ctx)
+		}
+	}
+}
+
+// usageHandler serves the current and last usage reports. Like
+// /admin/credentials, it requires publish credentials when auth is enabled.
+func (s *Server) usageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET is allowed")
+		return
+	}
+
+	rt := s.current()
+	principal, ok := rt.auth.Identify(r)
+	if !ok {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	rt.credentials.record(rolePublish, principal)
+	notePrincipal(r, principal)
+
+	s.writeJSON(w, http.StatusOK, s.usage.snapshot())
+}
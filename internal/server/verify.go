@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Verifier runs an end-to-end check against the backend: it produces a probe
+// message and consumes it back. produce is the time until the broker
+// acknowledged the probe and roundTrip the time until it was read back.
+type Verifier interface {
+	Verify(ctx context.Context) (produce, roundTrip time.Duration, err error)
+}
+
+// VerifyResponse is the body returned by /admin/verify.
+type VerifyResponse struct {
+	Status      string  `json:"status"`
+	ProduceMs   float64 `json:"produce_ms"`
+	RoundTripMs float64 `json:"round_trip_ms"`
+}
+
+// verifyHandler produces and consumes a probe message. Unlike /ready, which
+// only reflects broker connectivity, it fails when the configured principal
+// lacks write or read permission on the verification topic or is throttled
+// past the timeout. It requires authentication because it writes to Kafka.
+func (s *Server) verifyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		s.writeError(w, http.StatusMethodNotAllowed, "method_not_allowed", "only GET and POST are allowed")
+		return
+	}
+
+	rt := s.current()
+	principal, ok := rt.auth.Identify(r)
+	if !ok {
+		s.writeUnauthorized(w, r)
+		return
+	}
+	rt.credentials.record(rolePublish, principal)
+
+	ctx := r.Context()
+	if s.verifyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.verifyTimeout)
+		defer cancel()
+	}
+
+	produce, roundTrip, err := s.verifier.Verify(ctx)
+	if err != nil {
+		s.logger.Warn("end-to-end verification failed", zap.Error(err))
+		// The caller is an authenticated operator, so the broker error is
+		// returned as-is: it is what distinguishes an ACL denial from a quota
+		// or connectivity problem.
+		s.writeError(w, http.StatusServiceUnavailable, "verify_failed", err.Error())
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, VerifyResponse{
+		Status:      "ok",
+		ProduceMs:   milliseconds(produce),
+		RoundTripMs: milliseconds(roundTrip),
+	})
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,300 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultQueueWorkers is the number of produce workers per topic when a
+// queue depth is configured without a worker count.
+const defaultQueueWorkers = 4
+
+// workerIdleTimeout is how long a topic worker waits for a message before
+// exiting, so topics that stop receiving traffic release their goroutines.
+const workerIdleTimeout = time.Minute
+
+// errQueueFull is returned when a topic's produce queue has no free slot.
+var errQueueFull = errors.New("produce queue full")
+
+// ProduceQueue routes produce calls through per-topic worker goroutines fed
+// by bounded queues. A burst on one topic fills only that topic's queue and
+// is rejected early, instead of tying up the producer for every other topic.
+type ProduceQueue struct {
+	// Depth is the number of messages each topic may have queued; zero
+	// disables queuing and handlers call the producer directly.
+	Depth int
+
+	// Workers is the number of goroutines producing each topic's queue;
+	// zero means defaultQueueWorkers.
+	Workers int
+}
+
+// produceJob is one queued produce call. The handler owns key, value, and
+// headers and blocks on done, so the worker may use them without copying.
+type produceJob struct {
+	ctx     context.Context
+	key     []byte
+	value   []byte
+	headers map[string]string
+	done    chan error
+
+	pending *list.Element // in its topicQueue's pending list until taken
+}
+
+// topicQueue is one topic's queue. quit is closed when the topic is retired.
+type topicQueue struct {
+	jobs chan *produceJob
+	quit chan struct{}
+	busy atomic.Int32 // workers producing a job
+
+	mu      sync.Mutex
+	pending *list.List // when each queued job was queued, oldest first
+}
+
+func newTopicQueue(depth int) *topicQueue {
+	return &topicQueue{
+		jobs:    make(chan *produceJob, depth),
+		quit:    make(chan struct{}),
+		pending: list.New(),
+	}
+}
+
+// offer queues job, queued at now, without blocking and reports whether it
+// was.
+func (q *topicQueue) offer(job *produceJob, now time.Time) bool {
+	q.mu.Lock()
+	job.pending = q.pending.PushBack(now)
+	q.mu.Unlock()
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		q.take(job)
+		return false
+	}
+}
+
+// take removes a job that left the queue from the pending list.
+func (q *topicQueue) take(job *produceJob) {
+	q.mu.Lock()
+	q.pending.Remove(job.pending)
+	q.mu.Unlock()
+}
+
+// oldest returns when the longest-queued job was queued, and false if none
+// is.
+func (q *topicQueue) oldest() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if e := q.pending.Front(); e != nil {
+		return e.Value.(time.Time), true
+	}
+	return time.Time{}, false
+}
+
+// produceDispatcher fans produce calls out to per-topic workers. Workers are
+// started on a topic's first message and exit after workerIdleTimeout without
+// one.
+type produceDispatcher struct {
+	producer KafkaProducer
+	depth    int
+	workers  int
+	stop     chan struct{}
+	now      func() time.Time
+
+	mu     sync.RWMutex
+	topics map[string]*topicQueue
+	closed bool
+}
+
+func newProduceDispatcher(producer KafkaProducer, cfg ProduceQueue, now func() time.Time) *produceDispatcher {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultQueueWorkers
+	}
+	return &produceDispatcher{
+		producer: producer,
+		depth:    cfg.Depth,
+		workers:  workers,
+		stop:     make(chan struct{}),
+		now:      now,
+		topics:   make(map[string]*topicQueue),
+	}
+}
+
+// Produce queues the message on topic's queue and waits for a worker to
+// produce it. It returns errQueueFull without waiting if the queue is full
+// or the dispatcher is closed.
+func (d *produceDispatcher) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	job := &produceJob{ctx: ctx, key: key, value: value, headers: headers, done: make(chan error, 1)}
+	if !d.enqueue(topic, job) {
+		return errQueueFull
+	}
+	// Wait even if ctx ends first: the worker uses the job's buffers until it
+	// reports back, and it fails cancelled jobs without producing them.
+	return <-job.done
+}
+
+// enqueue offers job to topic's queue without blocking. Sends happen under
+// the read lock so a worker cannot retire the queue between the lookup and
+// the send.
+func (d *produceDispatcher) enqueue(topic string, job *produceJob) bool {
+	d.mu.RLock()
+	if d.closed {
+		d.mu.RUnlock()
+		return false
+	}
+	q, ok := d.topics[topic]
+	if ok {
+		sent := q.offer(job, d.now())
+		d.mu.RUnlock()
+		return sent
+	}
+	d.mu.RUnlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	q, ok = d.topics[topic]
+	if !ok {
+		q = newTopicQueue(d.depth)
+		d.topics[topic] = q
+		for i := 0; i < d.workers; i++ {
+			go d.work(topic, q)
+		}
+	}
+	return q.offer(job, d.now())
+}
+
+func (d *produceDispatcher) work(topic string, q *topicQueue) {
+	idle := time.NewTimer(workerIdleTimeout)
+	defer idle.Stop()
+	for {
+		select {
+		case job := <-q.jobs:
+			d.run(topic, q, job)
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
+				}
+			}
+			idle.Reset(workerIdleTimeout)
+		case <-idle.C:
+			d.retire(topic, q)
+			idle.Reset(workerIdleTimeout)
+		case <-q.quit:
+			return
+		case <-d.stop:
+			// Nothing can be enqueued any more; finish what is queued so
+			// no handler is left waiting.
+			for {
+				select {
+				case job := <-q.jobs:
+					d.run(topic, q, job)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// run produces job, taken from q, unless its request has already gone
+// away.
+func (d *produceDispatcher) run(topic string, q *topicQueue, job *produceJob) {
+	q.take(job)
+	q.busy.Add(1)
+	defer q.busy.Add(-1)
+	if err := job.ctx.Err(); err != nil {
+		job.done <- err
+		return
+	}
+	job.done <- d.producer.Produce(job.ctx, topic, job.key, job.value, job.headers)
+}
+
+// retire drops topic's queue and stops its workers if nothing is queued.
+// Holding the write lock guarantees no handler is sending to it meanwhile;
+// workers still producing finish their job before seeing quit.
+func (d *produceDispatcher) retire(topic string, q *topicQueue) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(q.jobs) > 0 || d.topics[topic] != q {
+		return
+	}
+	delete(d.topics, topic)
+	close(q.quit)
+}
+
+// depths returns the number of queued messages per active topic.
+func (d *produceDispatcher) depths() map[string]int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	out := make(map[string]int, len(d.topics))
+	for topic, q := range d.topics {
+		out[topic] = len(q.jobs)
+	}
+	return out
+}
+
+// ProduceQueueStats is the state of one topic's produce queue: the
+// messages queued and the most it holds, its workers and how many of them
+// are producing, and how long the oldest queued message has waited.
+type ProduceQueueStats struct {
+	Depth            int     `json:"depth"`
+	Capacity         int     `json:"capacity"`
+	Workers          int     `json:"workers"`
+	BusyWorkers      int     `json:"busy_workers"`
+	OldestAgeSeconds float64 `json:"oldest_age_seconds"`
+}
+
+// stats returns the state of each active topic's queue.
+func (d *produceDispatcher) stats() map[string]ProduceQueueStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	now := d.now()
+	out := make(map[string]ProduceQueueStats, len(d.topics))
+	for topic, q := range d.topics {
+		st := ProduceQueueStats{
+			Depth:       len(q.jobs),
+			Capacity:    cap(q.jobs),
+			Workers:     d.workers,
+			BusyWorkers: int(q.busy.Load()),
+		}
+		if t, ok := q.oldest(); ok {
+			st.OldestAgeSeconds = now.Sub(t).Seconds()
+		}
+		out[topic] = st
+	}
+	return out
+}
+
+// saturation returns the topic whose queue is fullest and the fraction of it
+// in use.
+func (d *produceDispatcher) saturation() (topic string, used float64) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for name, q := range d.topics {
+		if u := float64(len(q.jobs)) / float64(cap(q.jobs)); u > used || topic == "" {
+			topic, used = name, u
+		}
+	}
+	return topic, used
+}
+
+// close rejects further messages and stops every worker once its queue is
+// drained.
+func (d *produceDispatcher) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.closed {
+		d.closed = true
+		close(d.stop)
+	}
+}
@@ -0,0 +1,27 @@
+package signature
+
+import "crypto/sha256"
+
+// BodyDigest memoizes the SHA-256 of a request body so that every stage that
+// needs it, such as deduplication, which both keys deliveries by it and
+// checks a retry's body against it, hashes the body once per request. It
+// is not safe for concurrent use; create one per request.
+type BodyDigest struct {
+	body []byte
+	done bool
+	sum  [sha256.Size]byte
+}
+
+// NewBodyDigest returns a digest of body, computed on first use.
+func NewBodyDigest(body []byte) *BodyDigest {
+	return &BodyDigest{body: body}
+}
+
+// Sum returns the SHA-256 of the body.
+func (d *BodyDigest) Sum() [sha256.Size]byte {
+	if !d.done {
+		d.sum = sha256.Sum256(d.body)
+		d.done = true
+	}
+	return d.sum
+}
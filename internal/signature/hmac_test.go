@@ -0,0 +1,114 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func reference(key []byte, parts ...string) []byte {
+	m := hmac.New(sha256.New, key)
+	for _, p := range parts {
+		m.Write([]byte(p))
+	}
+	return m.Sum(nil)
+}
+
+func TestHMAC_MatchesStdlib(t *testing.T) {
+	key := []byte("It's a Secret to Everybody")
+	body := []byte("Hello, World!")
+	h := NewSHA256(key)
+
+	// GitHub's documented example for X-Hub-Signature-256.
+	const want = "757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if got := hex.EncodeToString(h.Sum(nil, body)); got != want {
+		t.Errorf("Sum() = %s, want %s", got, want)
+	}
+	if !h.VerifyHex(want, body) {
+		t.Error("VerifyHex() rejected a valid signature")
+	}
+	if !h.Verify(reference(key, "1700000000", ".", "{}"), []byte("1700000000"), []byte("."), []byte("{}")) {
+		t.Error("Verify() over parts should equal the MAC of their concatenation")
+	}
+}
+
+func TestHMAC_VerifyHexRejects(t *testing.T) {
+	h := NewSHA256([]byte("k"))
+	body := []byte("payload")
+	valid := hex.EncodeToString(h.Sum(nil, body))
+
+	tests := map[string]string{
+		"empty":       "",
+		"truncated":   valid[:len(valid)-2],
+		"not hex":     strings.Repeat("zz", sha256.Size),
+		"wrong bytes": strings.Repeat("00", sha256.Size),
+		"too long":    valid + "00",
+	}
+	for name, sig := range tests {
+		if h.VerifyHex(sig, body) {
+			t.Errorf("%s: VerifyHex(%q) = true", name, sig)
+		}
+	}
+}
+
+func TestHMAC_VerifyDoesNotAllocate(t *testing.T) {
+	if raceEnabled {
+		t.Skip("the race detector allocates")
+	}
+	h := NewSHA256([]byte("k"))
+	body := []byte(strings.Repeat("x", 4096))
+	sig := hex.EncodeToString(h.Sum(nil, body))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if !h.VerifyHex(sig, body) {
+			t.Fatal("verify failed")
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("VerifyHex allocates %v times per call, want 0", allocs)
+	}
+}
+
+func TestHMAC_SHA512(t *testing.T) {
+	key := []byte("k")
+	h := NewHMAC(sha512.New, key)
+	m := hmac.New(sha512.New, key)
+	m.Write([]byte("x"))
+	if !h.VerifyHex(hex.EncodeToString(m.Sum(nil)), []byte("x")) {
+		t.Error("SHA-512 signature should verify")
+	}
+}
+
+func TestHMAC_Concurrent(t *testing.T) {
+	key := []byte("k")
+	h := NewSHA256(key)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := strings.Repeat("x", i*100)
+			sig := reference(key, body)
+			for j := 0; j < 200; j++ {
+				if !h.Verify(sig, []byte(body)) {
+					t.Error("concurrent Verify() failed")
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestBodyDigest(t *testing.T) {
+	d := NewBodyDigest([]byte("abc"))
+	want := sha256.Sum256([]byte("abc"))
+	if d.Sum() != want || d.Sum() != want {
+		t.Error("Sum() should return the SHA-256 of the body on every call")
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package signature
+
+// raceEnabled reports whether tests run with the race detector, which
+// makes otherwise allocation-free code allocate.
+const raceEnabled = true
@@ -0,0 +1,152 @@
+package signature
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors returned by Scheme.Verify.
+var (
+	ErrMissing  = errors.New("signature header is missing")
+	ErrMismatch = errors.New("signature does not match")
+	ErrExpired  = errors.New("signature timestamp is outside the tolerance")
+)
+
+// DefaultTolerance is how far a Stripe signature's timestamp may be from
+// the local clock when no tolerance is configured; Stripe's libraries use
+// the same.
+const DefaultTolerance = 5 * time.Minute
+
+// Scheme verifies a provider's webhook signature over a request body.
+type Scheme interface {
+	// Name identifies the scheme in logs, e.g. "github".
+	Name() string
+	// Verify returns nil if h carries a valid signature for body, and
+	// ErrMissing, ErrMismatch, ErrExpired, or a parse error otherwise.
+	Verify(h http.Header, body []byte) error
+}
+
+// GitHub verifies X-Hub-Signature-256: "sha256=" and the hex HMAC-SHA256 of
+// the body. Gitea, Forgejo, and other providers that copied GitHub's format
+// are covered too.
+type GitHub struct {
+	mac *HMAC
+}
+
+// NewGitHub returns a GitHub scheme for the webhook secret.
+func NewGitHub(secret []byte) *GitHub {
+	return &GitHub{mac: NewSHA256(secret)}
+}
+
+// Name returns "github".
+func (g *GitHub) Name() string { return "github" }
+
+// Verify checks X-Hub-Signature-256.
+func (g *GitHub) Verify(h http.Header, body []byte) error {
+	v := h.Get("X-Hub-Signature-256")
+	if v == "" {
+		return ErrMissing
+	}
+	sig, ok := strings.CutPrefix(v, "sha256=")
+	if !ok || !g.mac.VerifyHex(sig, body) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// GitLab verifies X-Gitlab-Token, which carries the secret itself rather
+// than a signature.
+type GitLab struct {
+	token []byte
+}
+
+// NewGitLab returns a GitLab scheme for the webhook secret token.
+func NewGitLab(token []byte) *GitLab {
+	return &GitLab{token: append([]byte(nil), token...)}
+}
+
+// Name returns "gitlab".
+func (g *GitLab) Name() string { return "gitlab" }
+
+// Verify compares X-Gitlab-Token with the token in constant time.
+func (g *GitLab) Verify(h http.Header, _ []byte) error {
+	v := h.Get("X-Gitlab-Token")
+	if v == "" {
+		return ErrMissing
+	}
+	if subtle.ConstantTimeCompare([]byte(v), g.token) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// Stripe verifies Stripe-Signature: "t=<unix time>,v1=<hex>[,v1=<hex>...]",
+// where each v1 is a candidate HMAC-SHA256 of "<t>.<body>" (there are
+// several while a secret is being rolled). The timestamp must be within
+// Tolerance of Now, so captured requests cannot be replayed later.
+type Stripe struct {
+	mac       *HMAC
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewStripe returns a Stripe scheme for the endpoint secret ("whsec_...").
+// A zero tolerance means DefaultTolerance; nil now means time.Now.
+func NewStripe(secret []byte, tolerance time.Duration, now func() time.Time) *Stripe {
+	if tolerance <= 0 {
+		tolerance = DefaultTolerance
+	}
+	if now == nil {
+		now = time.Now
+	}
+	return &Stripe{mac: NewSHA256(secret), tolerance: tolerance, now: now}
+}
+
+// Name returns "stripe".
+func (s *Stripe) Name() string { return "stripe" }
+
+// Verify checks Stripe-Signature.
+func (s *Stripe) Verify(h http.Header, body []byte) error {
+	v := h.Get("Stripe-Signature")
+	if v == "" {
+		return ErrMissing
+	}
+	var ts string
+	var sigs []string
+	for _, item := range strings.Split(v, ",") {
+		k, val, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch k {
+		case "t":
+			ts = val
+		case "v1":
+			sigs = append(sigs, val)
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid Stripe-Signature timestamp %q", ts)
+	}
+	if len(sigs) == 0 {
+		return ErrMissing
+	}
+
+	matched := false
+	for _, sig := range sigs {
+		if s.mac.VerifyHex(sig, []byte(ts), []byte{'.'}, body) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return ErrMismatch
+	}
+	if d := s.now().Sub(time.Unix(sec, 0)); d > s.tolerance || d < -s.tolerance {
+		return ErrExpired
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package signature
+
+import (
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGitHub_Verify(t *testing.T) {
+	g := NewGitHub([]byte("It's a Secret to Everybody"))
+	body := []byte("Hello, World!")
+	tests := []struct {
+		header string
+		want   error
+	}{
+		{"sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", nil},
+		{"sha256=" + hex.EncodeToString(make([]byte, 32)), ErrMismatch},
+		{"757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", ErrMismatch},
+		{"", ErrMissing},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set("X-Hub-Signature-256", tt.header)
+		}
+		if err := g.Verify(h, body); !errors.Is(err, tt.want) {
+			t.Errorf("Verify(%q) = %v, want %v", tt.header, err, tt.want)
+		}
+	}
+}
+
+func TestGitLab_Verify(t *testing.T) {
+	g := NewGitLab([]byte("token"))
+	for header, want := range map[string]error{"token": nil, "tokens": ErrMismatch, "": ErrMissing} {
+		h := http.Header{}
+		if header != "" {
+			h.Set("X-Gitlab-Token", header)
+		}
+		if err := g.Verify(h, nil); !errors.Is(err, want) {
+			t.Errorf("Verify(%q) = %v, want %v", header, err, want)
+		}
+	}
+}
+
+func TestStripe_Verify(t *testing.T) {
+	secret := []byte("whsec_test")
+	now := time.Unix(1700000000, 0)
+	s := NewStripe(secret, 0, func() time.Time { return now })
+	body := []byte(`{"id":"evt_1"}`)
+	sign := func(ts string) string {
+		return hex.EncodeToString(reference(secret, ts, ".", string(body)))
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   error
+	}{
+		{"valid", "t=1700000000,v1=" + sign("1700000000"), nil},
+		{"rolled secret", "t=1700000000,v1=" + sign("1") + ",v1=" + sign("1700000000") + ",v0=ignored", nil},
+		{"within tolerance", "t=1699999800,v1=" + sign("1699999800"), nil},
+		{"too old", "t=1699999000,v1=" + sign("1699999000"), ErrExpired},
+		{"timestamp not signed", "t=1700000001,v1=" + sign("1700000000"), ErrMismatch},
+		{"no v1", "t=1700000000,v0=" + sign("1700000000"), ErrMissing},
+		{"missing", "", ErrMissing},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.header != "" {
+			h.Set("Stripe-Signature", tt.header)
+		}
+		if err := s.Verify(h, body); !errors.Is(err, tt.want) {
+			t.Errorf("%s: Verify() = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	h := http.Header{"Stripe-Signature": {"t=soon,v1=" + sign("soon")}}
+	if err := s.Verify(h, body); err == nil {
+		t.Error("Verify() accepted a malformed timestamp")
+	}
+}
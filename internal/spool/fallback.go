@@ -0,0 +1,280 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/filesink"
+	"github.com/kahook/internal/logctx"
+)
+
+// OutagePrefix starts the names of the segments a Fallback writes.
+const OutagePrefix = "kahook-outage-"
+
+const (
+	// defaultFallbackProbe is how often a spooling Fallback checks whether
+	// its producer is back.
+	defaultFallbackProbe = time.Second
+	// fallbackSegmentMessages is how many messages a Fallback writes to a
+	// segment before starting another, so replay frees disk as it goes and
+	// a crash mid-replay repeats at most one segment.
+	fallbackSegmentMessages = 10000
+)
+
+// Upstream is the producer a Fallback stands in for.
+type Upstream interface {
+	Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
+	IsConnected() bool
+	Close()
+}
+
+// FallbackConfig configures a Fallback.
+type FallbackConfig struct {
+	Spool    *Spool
+	Producer Upstream
+	Logger   *zap.Logger
+
+	// Probe is how often the producer is checked while messages are
+	// spooled; zero means every second.
+	Probe time.Duration
+}
+
+// FallbackStats describes a Fallback's spooling since it started.
+type FallbackStats struct {
+	Spooling bool  // messages are going to the spool
+	Pending  int   // segments waiting to be replayed
+	Spooled  int64 // messages written to the spool
+	Replayed int64 // spooled messages produced
+}
+
+// Fallback is a producer that keeps messages in a spool while its
+// producer is down, and produces them in order once it is back. A produce
+// that fails while the producer reports it is not connected, or that fails
+// as unavailable, is written to the spool instead and succeeds; from then
+// on every message is spooled, so none overtakes those before it, until
+// the spool has been replayed. Other errors are returned as they are.
+//
+// A message whose produce timed out may have reached the brokers, and a
+// segment the replay is stopped in is replayed whole next time, so
+// messages can be duplicated but not lost while the spool has room.
+type Fallback struct {
+	cfg      FallbackConfig
+	replayer *Replayer // produces segments through cfg.Producer
+
+	mu       sync.Mutex
+	spooling bool
+	seg      *Segment           // being written; nil until a message needs it
+	w        *filesink.Producer // writes to seg
+	written  int                // messages in seg
+	pending  []string           // written segments awaiting replay, oldest first
+
+	spooled atomic.Int64
+
+	wake chan struct{}
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+// NewFallback returns a Fallback producing through cfg.Producer, and starts
+// the loop that replays the spool. Close stops it.
+func NewFallback(cfg FallbackConfig) *Fallback {
+	if cfg.Probe <= 0 {
+		cfg.Probe = defaultFallbackProbe
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	f := &Fallback{
+		cfg:      cfg,
+		replayer: NewReplayer(ReplayConfig{Spool: cfg.Spool, Producer: cfg.Producer, Logger: cfg.Logger}),
+		wake:     make(chan struct{}, 1),
+		stop:     stop,
+		done:     make(chan struct{}),
+	}
+	go f.run(ctx)
+	return f
+}
+
+// unavailableError is a spooling failure: like a producer that is not
+// connected, the message can be sent again later.
+type unavailableError struct{ error }
+
+func (e unavailableError) Unavailable() bool { return true }
+func (e unavailableError) Unwrap() error     { return e.error }
+
+// Produce sends the message through the producer, or spools it while the
+// producer is down.
+func (f *Fallback) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	if !f.Spooling() {
+		err := f.cfg.Producer.Produce(ctx, topic, key, value, headers)
+		if err == nil || !f.outage(err) {
+			return err
+		}
+		logctx.Logger(ctx, f.cfg.Logger).Warn("producer down; spooling messages to disk",
+			zap.String("dir", f.cfg.Spool.Dir()), zap.Error(err))
+	}
+	return f.spool(topic, key, value, headers)
+}
+
+// outage reports whether err means the producer is down, rather than that
+// it refused this message.
+func (f *Fallback) outage(err error) bool {
+	var u interface{ Unavailable() bool }
+	if errors.As(err, &u) && u.Unavailable() {
+		return true
+	}
+	return !f.cfg.Producer.IsConnected()
+}
+
+// spool appends the message to the segment being written.
+func (f *Fallback) spool(topic string, key, value []byte, headers map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.spooling = true
+	if f.seg == nil {
+		seg, err := f.cfg.Spool.Create(OutagePrefix)
+		if err != nil {
+			return unavailableError{err}
+		}
+		f.seg, f.w, f.written = seg, filesink.NewWriterProducer(seg), 0
+	}
+	if err := f.w.Produce(context.Background(), topic, key, value, headers); err != nil {
+		// The writer stays failed; start a new segment next time.
+		f.rotate()
+		return unavailableError{fmt.Errorf("failed to spool message: %w", err)}
+	}
+	f.written++
+	f.spooled.Add(1)
+	if f.written >= fallbackSegmentMessages {
+		f.rotate()
+	}
+	return nil
+}
+
+// rotate closes the segment being written and queues it for replay.
+// f.mu must be held.
+func (f *Fallback) rotate() {
+	if f.seg == nil {
+		return
+	}
+	if err := f.seg.Close(); err != nil {
+		f.cfg.Logger.Error("failed to close spool segment", zap.String("segment", filepath.Base(f.seg.Name())), zap.Error(err))
+	}
+	if f.written > 0 {
+		f.pending = append(f.pending, f.seg.Name())
+	} else if err := f.cfg.Spool.Remove(f.seg.Name()); err != nil {
+		f.cfg.Logger.Warn("failed to remove empty spool segment", zap.String("segment", filepath.Base(f.seg.Name())), zap.Error(err))
+	}
+	f.seg, f.w, f.written = nil, nil, 0
+	select {
+	case f.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Spooling reports whether messages are going to the spool.
+func (f *Fallback) Spooling() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.spooling
+}
+
+// Stats returns the Fallback's spooling since it started.
+func (f *Fallback) Stats() FallbackStats {
+	f.mu.Lock()
+	st := FallbackStats{Spooling: f.spooling, Pending: len(f.pending)}
+	if f.written > 0 {
+		st.Pending++
+	}
+	f.mu.Unlock()
+	st.Spooled = f.spooled.Load()
+	st.Replayed = f.replayer.Status().Messages
+	return st
+}
+
+// run replays the spool whenever messages are spooled and the producer is
+// connected.
+func (f *Fallback) run(ctx context.Context) {
+	defer close(f.done)
+	probe := time.NewTicker(f.cfg.Probe)
+	defer probe.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-probe.C:
+		case <-f.wake:
+		}
+		if f.Spooling() && f.cfg.Producer.IsConnected() {
+			f.drain(ctx)
+		}
+	}
+}
+
+// drain replays the spooled segments, oldest first, rotating the one being
+// written once the others are done, and stops spooling once all are
+// replayed.
+func (f *Fallback) drain(ctx context.Context) {
+	f.cfg.Logger.Info("producer back; replaying spooled messages", zap.String("dir", f.cfg.Spool.Dir()))
+	for {
+		f.mu.Lock()
+		if len(f.pending) == 0 {
+			if f.seg == nil {
+				f.spooling = false
+				f.mu.Unlock()
+				st := f.Stats()
+				f.cfg.Logger.Info("spooled messages replayed; producing directly",
+					zap.Int64("spooled", st.Spooled), zap.Int64("replayed", st.Replayed))
+				return
+			}
+			f.rotate()
+			if len(f.pending) == 0 {
+				f.mu.Unlock()
+				continue
+			}
+		}
+		path := f.pending[0]
+		f.mu.Unlock()
+
+		n, err := f.replayer.replaySegment(ctx, path)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			f.cfg.Logger.Error("failed to replay spool segment; leaving it in place",
+				zap.String("segment", filepath.Base(path)), zap.Int64("messages", n), zap.Error(err))
+		} else if err := f.cfg.Spool.Remove(path); err != nil {
+			f.cfg.Logger.Warn("failed to remove replayed spool segment", zap.String("segment", filepath.Base(path)), zap.Error(err))
+		}
+
+		f.mu.Lock()
+		f.pending = f.pending[1:]
+		f.mu.Unlock()
+	}
+}
+
+// IsConnected is always true: while the producer is down, messages are
+// spooled.
+func (f *Fallback) IsConnected() bool {
+	return true
+}
+
+// Close stops replaying, closes the segment being written, and closes the
+// producer. Segments not yet replayed stay in the spool.
+func (f *Fallback) Close() {
+	f.stop()
+	<-f.done
+	f.mu.Lock()
+	f.rotate()
+	pending := len(f.pending)
+	f.mu.Unlock()
+	if pending > 0 {
+		f.cfg.Logger.Warn("spooled messages left unreplayed", zap.String("dir", f.cfg.Spool.Dir()), zap.Int("segments", pending))
+	}
+	f.cfg.Producer.Close()
+}
@@ -0,0 +1,173 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// upstream is a producer that can be taken down and brought back.
+type upstream struct {
+	mu       sync.Mutex
+	down     bool
+	reject   bool // fail produces while connected
+	produced []string
+	closed   bool
+}
+
+func (u *upstream) Produce(_ context.Context, topic string, _, value []byte, _ map[string]string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.down {
+		return errors.New("message timed out")
+	}
+	if u.reject {
+		return errors.New("message too large")
+	}
+	u.produced = append(u.produced, string(value))
+	return nil
+}
+
+func (u *upstream) IsConnected() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !u.down
+}
+
+func (u *upstream) Close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closed = true
+}
+
+func (u *upstream) set(down bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.down = down
+}
+
+func (u *upstream) messages() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return append([]string(nil), u.produced...)
+}
+
+// waitFor polls cond until it holds or a second passes.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFallback_SpoolsDuringOutageAndReplaysInOrder(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir(), Key: testKey})
+	up := &upstream{}
+	f := NewFallback(FallbackConfig{Spool: s, Producer: up, Logger: zap.NewNop(), Probe: time.Millisecond})
+	defer f.Close()
+	ctx := context.Background()
+	produce := func(v string) {
+		t.Helper()
+		if err := f.Produce(ctx, "orders", nil, []byte(v), nil); err != nil {
+			t.Fatalf("Produce(%s) error = %v", v, err)
+		}
+	}
+
+	produce("0")
+	up.set(true)
+	for i := 1; i <= 3; i++ {
+		produce(strconv.Itoa(i))
+	}
+	if st := f.Stats(); !st.Spooling || st.Spooled != 3 || st.Pending != 1 {
+		t.Errorf("Stats() during the outage = %+v", st)
+	}
+	if !f.IsConnected() {
+		t.Error("IsConnected() = false during the outage, want true while spooling")
+	}
+
+	up.set(false)
+	produce("4") // still spooled, behind the others
+	waitFor(t, "the replay", func() bool { return !f.Spooling() })
+	produce("5")
+
+	want := []string{"0", "1", "2", "3", "4", "5"}
+	got := up.messages()
+	if len(got) != len(want) {
+		t.Fatalf("produced %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("produced %q, want %q", got, want)
+		}
+	}
+	if st := f.Stats(); st.Spooled != 4 || st.Replayed != 4 || st.Pending != 0 {
+		t.Errorf("Stats() after the replay = %+v", st)
+	}
+	if segs, _ := s.Segments(); len(segs) != 0 {
+		t.Errorf("segments left after the replay: %v", segs)
+	}
+}
+
+func TestFallback_ReturnsErrorsWhileConnected(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir()})
+	up := &upstream{reject: true}
+	f := NewFallback(FallbackConfig{Spool: s, Producer: up, Logger: zap.NewNop()})
+	defer f.Close()
+
+	if err := f.Produce(context.Background(), "orders", nil, []byte("big"), nil); err == nil {
+		t.Error("Produce() error = nil, want the producer's error")
+	}
+	if f.Spooling() || f.Stats().Spooled != 0 {
+		t.Error("a rejected message was spooled while the producer was connected")
+	}
+}
+
+func TestFallback_FullSpoolIsUnavailable(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir(), MaxBytes: 64, OnFull: PolicyFail})
+	up := &upstream{down: true}
+	f := NewFallback(FallbackConfig{Spool: s, Producer: up, Logger: zap.NewNop(), Probe: time.Hour})
+	defer f.Close()
+
+	err := f.Produce(context.Background(), "orders", nil, []byte(strings.Repeat("x", 100)), nil)
+	var u interface{ Unavailable() bool }
+	if !errors.As(err, &u) || !u.Unavailable() || !errors.Is(err, ErrFull) {
+		t.Errorf("Produce() error = %v, want an unavailable ErrFull", err)
+	}
+}
+
+func TestFallback_CloseKeepsUnreplayedSegments(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir()})
+	up := &upstream{down: true}
+	f := NewFallback(FallbackConfig{Spool: s, Producer: up, Logger: zap.NewNop(), Probe: time.Hour})
+	if err := f.Produce(context.Background(), "orders", nil, []byte("kept"), nil); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if !up.closed {
+		t.Error("Close() did not close the producer")
+	}
+	segs, err := s.Segments()
+	if err != nil || len(segs) != 1 {
+		t.Fatalf("Segments() = %v, %v, want the outage segment", segs, err)
+	}
+
+	// A startup replay picks it up.
+	up.set(false)
+	if err := NewReplayer(ReplayConfig{Spool: s, Producer: up, Logger: zap.NewNop()}).Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := up.messages(); len(got) != 1 || got[0] != "kept" {
+		t.Errorf("replayed %q, want the spooled message", got)
+	}
+}
@@ -0,0 +1,284 @@
+package spool
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/filesink"
+)
+
+// Replay states.
+const (
+	ReplayPending = "pending"
+	ReplayRunning = "running"
+	ReplayPaused  = "paused"
+	ReplayDone    = "done"
+)
+
+// Defaults of a Replayer's pacing.
+const (
+	defaultReplayProgress = 10 * time.Second
+	replayRetryMin        = 100 * time.Millisecond
+	replayRetryMax        = 30 * time.Second
+)
+
+// maxReplayLine bounds a segment line: the largest body plus its envelope.
+const maxReplayLine = 128 << 20
+
+// Producer is where a Replayer sends spooled messages.
+type Producer interface {
+	Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error
+}
+
+// ReplayConfig configures a Replayer.
+type ReplayConfig struct {
+	Spool    *Spool
+	Producer Producer
+	Logger   *zap.Logger
+
+	// Progress is how often progress is logged while replaying; zero
+	// means every 10s.
+	Progress time.Duration
+}
+
+// ReplayStatus describes a replay's progress.
+type ReplayStatus struct {
+	State    string `json:"state"`
+	Segments int    `json:"segments"` // found when the replay started
+	Replayed int    `json:"replayed_segments"`
+	Failed   int    `json:"failed_segments"` // unreadable, left in place
+	Messages int64  `json:"messages"`
+	Skipped  int64  `json:"skipped_messages"` // undecodable lines
+	Current  string `json:"current,omitempty"`
+}
+
+// Replayer produces the messages of the segments a spool holds when it
+// starts, such as those left by a crashed instance, oldest segment first
+// and in order within each. A segment is removed once all its messages are
+// produced; one the replay is stopped in is replayed whole next time, so
+// its first messages may be produced twice. Failed produces are retried
+// until they succeed or the replay is stopped.
+type Replayer struct {
+	cfg ReplayConfig
+
+	mu      sync.Mutex
+	status  ReplayStatus
+	paused  bool
+	resumed chan struct{} // closed on Resume
+}
+
+// NewReplayer returns a replayer of cfg.Spool. Nothing is replayed until
+// Run is called.
+func NewReplayer(cfg ReplayConfig) *Replayer {
+	if cfg.Progress <= 0 {
+		cfg.Progress = defaultReplayProgress
+	}
+	return &Replayer{cfg: cfg, status: ReplayStatus{State: ReplayPending}}
+}
+
+// Status returns the replay's progress.
+func (r *Replayer) Status() ReplayStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	st := r.status
+	if r.paused && st.State == ReplayRunning {
+		st.State = ReplayPaused
+	}
+	return st
+}
+
+// Pause stops the replay after the message being produced, until Resume.
+func (r *Replayer) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.paused {
+		r.paused = true
+		r.resumed = make(chan struct{})
+	}
+}
+
+// Resume continues a paused replay.
+func (r *Replayer) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.paused {
+		r.paused = false
+		close(r.resumed)
+	}
+}
+
+// wait blocks while the replay is paused.
+func (r *Replayer) wait(ctx context.Context) error {
+	for {
+		r.mu.Lock()
+		paused, resumed := r.paused, r.resumed
+		r.mu.Unlock()
+		if !paused {
+			return nil
+		}
+		select {
+		case <-resumed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (r *Replayer) update(f func(*ReplayStatus)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f(&r.status)
+}
+
+// Run replays the segments in the spool, returning once they are all
+// replayed or ctx is done.
+func (r *Replayer) Run(ctx context.Context) error {
+	paths, err := r.cfg.Spool.Segments()
+	if err != nil {
+		return fmt.Errorf("failed to list spool segments: %w", err)
+	}
+	r.update(func(st *ReplayStatus) {
+		st.State = ReplayRunning
+		st.Segments = len(paths)
+	})
+	logger := r.cfg.Logger.With(zap.String("dir", r.cfg.Spool.Dir()))
+	if len(paths) == 0 {
+		r.update(func(st *ReplayStatus) { st.State = ReplayDone })
+		return nil
+	}
+	logger.Info("replaying spooled messages", zap.Int("segments", len(paths)))
+
+	progress := time.NewTicker(r.cfg.Progress)
+	defer progress.Stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-progress.C:
+				st := r.Status()
+				logger.Info("spool replay progress",
+					zap.String("state", st.State),
+					zap.Int("segments", st.Segments),
+					zap.Int("replayed_segments", st.Replayed),
+					zap.Int64("messages", st.Messages),
+				)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for _, path := range paths {
+		r.update(func(st *ReplayStatus) { st.Current = filepath.Base(path) })
+		n, err := r.replaySegment(ctx, path)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			logger.Error("failed to replay spool segment; leaving it in place",
+				zap.String("segment", filepath.Base(path)),
+				zap.Int64("messages", n),
+				zap.Error(err),
+			)
+			r.update(func(st *ReplayStatus) { st.Failed++ })
+			continue
+		}
+		if err := r.cfg.Spool.Remove(path); err != nil {
+			logger.Warn("failed to remove replayed spool segment", zap.String("segment", filepath.Base(path)), zap.Error(err))
+		}
+		r.update(func(st *ReplayStatus) { st.Replayed++ })
+		logger.Info("spool segment replayed", zap.String("segment", filepath.Base(path)), zap.Int64("messages", n))
+	}
+
+	r.update(func(st *ReplayStatus) {
+		st.State = ReplayDone
+		st.Current = ""
+	})
+	st := r.Status()
+	logger.Info("spool replay finished",
+		zap.Int("replayed_segments", st.Replayed),
+		zap.Int("failed_segments", st.Failed),
+		zap.Int64("messages", st.Messages),
+		zap.Int64("skipped_messages", st.Skipped),
+	)
+	return nil
+}
+
+// replaySegment produces every message in the segment at path and returns
+// how many it produced.
+func (r *Replayer) replaySegment(ctx context.Context, path string) (int64, error) {
+	f, err := r.cfg.Spool.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var produced int64
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64<<10), maxReplayLine)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var rec filesink.Record
+		err := json.Unmarshal(sc.Bytes(), &rec)
+		var value []byte
+		if err == nil {
+			value, err = rec.Payload()
+		}
+		if err == nil && rec.Topic == "" {
+			err = errors.New("record has no topic")
+		}
+		if err != nil {
+			r.cfg.Logger.Warn("skipping undecodable spooled message",
+				zap.String("segment", filepath.Base(path)), zap.Int("line", line), zap.Error(err))
+			r.update(func(st *ReplayStatus) { st.Skipped++ })
+			continue
+		}
+		var key []byte
+		if rec.Key != "" {
+			key = []byte(rec.Key)
+		}
+		if err := r.produce(ctx, rec.Topic, key, value, rec.Headers); err != nil {
+			return produced, err
+		}
+		produced++
+		r.update(func(st *ReplayStatus) { st.Messages++ })
+	}
+	return produced, sc.Err()
+}
+
+// produce sends one message, retrying with backoff until it is produced or
+// ctx is done. A paused replay waits before each attempt.
+func (r *Replayer) produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	backoff := replayRetryMin
+	for {
+		if err := r.wait(ctx); err != nil {
+			return err
+		}
+		err := r.cfg.Producer.Produce(ctx, topic, key, value, headers)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r.cfg.Logger.Warn("failed to replay spooled message; retrying",
+			zap.String("topic", topic), zap.Duration("backoff", backoff), zap.Error(err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(2*backoff, replayRetryMax)
+	}
+}
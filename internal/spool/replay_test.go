@@ -0,0 +1,164 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/filesink"
+)
+
+// replayProducer records produced messages, failing the first fail calls.
+type replayProducer struct {
+	mu       sync.Mutex
+	fail     int
+	produced []string
+	calls    chan struct{}
+}
+
+func (p *replayProducer) Produce(_ context.Context, topic string, key, value []byte, _ map[string]string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.calls != nil {
+		p.calls <- struct{}{}
+	}
+	if p.fail > 0 {
+		p.fail--
+		return errors.New("broker down")
+	}
+	p.produced = append(p.produced, topic+"/"+string(key)+"="+string(value))
+	return nil
+}
+
+func (p *replayProducer) messages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.produced...)
+}
+
+// spill writes a segment of messages as the drain spill does.
+func spill(t *testing.T, s *Spool, values ...string) string {
+	t.Helper()
+	seg, err := s.Create("kahook-spill-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := filesink.NewWriterProducer(seg)
+	for _, v := range values {
+		if err := w.Produce(context.Background(), "orders", []byte("k"), []byte(v), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := seg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return seg.Name()
+}
+
+func TestReplayer_ReplaysOldestFirstAndRemoves(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir(), Key: testKey})
+	older := spill(t, s, `{"n":1}`, "two")
+	age(t, older, time.Minute)
+	newer := spill(t, s, "\xff")
+	if err := os.WriteFile(s.Dir()+"/notes.txt", []byte("not a segment"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &replayProducer{fail: 2}
+	r := NewReplayer(ReplayConfig{Spool: s, Producer: p, Logger: zap.NewNop()})
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{`orders/k={"n":1}`, "orders/k=two", "orders/k=\xff"}
+	got := p.messages()
+	if len(got) != len(want) {
+		t.Fatalf("produced %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("message %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	for _, path := range []string{older, newer} {
+		if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("replayed segment kept: %v", err)
+		}
+	}
+	st := r.Status()
+	if st.State != ReplayDone || st.Segments != 2 || st.Replayed != 2 || st.Messages != 3 {
+		t.Errorf("Status() = %+v", st)
+	}
+}
+
+func TestReplayer_LeavesUnreadableSegments(t *testing.T) {
+	dir := t.TempDir()
+	enc, _ := New(Config{Dir: dir, Key: testKey})
+	path := spill(t, enc, "secret")
+
+	// Without the key the segment cannot be read, so it is kept for later.
+	s, _ := New(Config{Dir: dir})
+	r := NewReplayer(ReplayConfig{Spool: s, Producer: &replayProducer{}, Logger: zap.NewNop()})
+	if err := r.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("unreadable segment removed: %v", err)
+	}
+	if st := r.Status(); st.Failed != 1 || st.Replayed != 0 {
+		t.Errorf("Status() = %+v, want one failed segment", st)
+	}
+}
+
+func TestReplayer_PauseAndResume(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir()})
+	spill(t, s, "one", "two")
+
+	p := &replayProducer{calls: make(chan struct{}, 10)}
+	r := NewReplayer(ReplayConfig{Spool: s, Producer: p, Logger: zap.NewNop()})
+	r.Pause()
+	done := make(chan error, 1)
+	go func() { done <- r.Run(context.Background()) }()
+
+	select {
+	case <-p.calls:
+		t.Fatal("paused replay produced a message")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if st := r.Status(); st.State != ReplayPaused {
+		t.Errorf("state = %q, want paused", st.State)
+	}
+
+	r.Resume()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := p.messages(); len(got) != 2 {
+		t.Errorf("produced %q after resuming, want both messages", got)
+	}
+}
+
+func TestReplayer_StopsWithContext(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir()})
+	path := spill(t, s, "one")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &replayProducer{fail: 1 << 30, calls: make(chan struct{}, 1)}
+	r := NewReplayer(ReplayConfig{Spool: s, Producer: p, Logger: zap.NewNop()})
+	done := make(chan error, 1)
+	go func() { done <- r.Run(ctx) }()
+	<-p.calls
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v, want context.Canceled", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("segment of a stopped replay removed: %v", err)
+	}
+}
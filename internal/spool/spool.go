@@ -0,0 +1,461 @@
+// Package spool keeps webhook messages on local disk, in segment files of
+// one JSON line per message in the file sink's format. Segments can be
+// encrypted at rest, since they hold the same data as the topics, and the
+// directory is bounded in size and age.
+package spool
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// What a spool does when a write would take it past Config.MaxBytes.
+const (
+	// PolicyEvictOldest deletes the oldest segments to make room.
+	PolicyEvictOldest = "evict_oldest"
+	// PolicyFail refuses the write, keeping what is already spooled.
+	PolicyFail = "fail"
+)
+
+// KeySize is the length of an encryption key: AES-256.
+const KeySize = 32
+
+// Segment file extensions.
+const (
+	plainExt     = ".jsonl"
+	encryptedExt = ".jsonl.enc"
+)
+
+// magic starts every encrypted segment.
+const magic = "KHSPOOL1"
+
+// maxFrame bounds the frames a reader accepts.
+const maxFrame = 64 << 20
+
+// ErrFull is returned by writes that would exceed MaxBytes under
+// PolicyFail, or that no eviction can make room for.
+var ErrFull = errors.New("spool is full")
+
+// Config configures a Spool.
+type Config struct {
+	Dir string
+
+	// Key encrypts segments with AES-256-GCM when set. It must be KeySize
+	// bytes. Segments written without a key stay readable.
+	Key []byte
+
+	// MaxBytes caps the total size of the segments; zero is unbounded.
+	MaxBytes int64
+	// MaxAge is how long a segment is kept after its last write; zero
+	// keeps segments until they are removed.
+	MaxAge time.Duration
+	// OnFull is PolicyEvictOldest (default) or PolicyFail.
+	OnFull string
+
+	// Now is the clock Prune ages segments against; nil means time.Now.
+	Now func() time.Time
+}
+
+// Spool is a directory of segments. It is safe for concurrent use.
+type Spool struct {
+	cfg  Config
+	aead cipher.AEAD // nil without a key
+
+	mu    sync.Mutex
+	open  map[string]bool // segments being written, never evicted
+	bytes int64           // size of the segments at the last scan plus writes since; -1 before one
+}
+
+// New returns a spool in cfg.Dir, creating the directory if needed.
+func New(cfg Config) (*Spool, error) {
+	switch cfg.OnFull {
+	case "":
+		cfg.OnFull = PolicyEvictOldest
+	case PolicyEvictOldest, PolicyFail:
+	default:
+		return nil, fmt.Errorf("unknown spool policy %q", cfg.OnFull)
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	s := &Spool{cfg: cfg, open: make(map[string]bool), bytes: -1}
+	if cfg.Key != nil {
+		aead, err := newAEAD(cfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		s.aead = aead
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+	return s, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("spool encryption key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Dir returns the spool's directory.
+func (s *Spool) Dir() string {
+	return s.cfg.Dir
+}
+
+// Encrypted reports whether new segments are encrypted.
+func (s *Spool) Encrypted() bool {
+	return s.aead != nil
+}
+
+// segmentInfo is a segment found in the directory.
+type segmentInfo struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// segments lists the segments in the directory, oldest first.
+func (s *Spool) segments() ([]segmentInfo, error) {
+	entries, err := os.ReadDir(s.cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var out []segmentInfo
+	for _, e := range entries {
+		if e.IsDir() || !IsSegment(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, segmentInfo{path: filepath.Join(s.cfg.Dir, e.Name()), size: info.Size(), modTime: info.ModTime()})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].modTime.Equal(out[j].modTime) {
+			return out[i].modTime.Before(out[j].modTime)
+		}
+		return out[i].path < out[j].path
+	})
+	return out, nil
+}
+
+// IsSegment reports whether name is a segment file name.
+func IsSegment(name string) bool {
+	return strings.HasSuffix(name, plainExt) || strings.HasSuffix(name, encryptedExt)
+}
+
+// Stats describes what is spooled.
+type Stats struct {
+	Segments int
+	Bytes    int64
+	Oldest   time.Time // last write of the oldest segment; zero when empty
+}
+
+// Stats returns the segments' number, total size, and age.
+func (s *Spool) Stats() (Stats, error) {
+	segs, err := s.segments()
+	if err != nil {
+		return Stats{}, err
+	}
+	st := Stats{Segments: len(segs)}
+	for _, seg := range segs {
+		st.Bytes += seg.size
+	}
+	if len(segs) > 0 {
+		st.Oldest = segs[0].modTime
+	}
+	return st, nil
+}
+
+// Prune removes the segments older than MaxAge, except those being
+// written, and returns how many it removed.
+func (s *Spool) Prune() (int, error) {
+	if s.cfg.MaxAge <= 0 {
+		return 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	segs, err := s.segments()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := s.cfg.Now().Add(-s.cfg.MaxAge)
+	removed := 0
+	for _, seg := range segs {
+		if seg.modTime.After(cutoff) || s.open[seg.path] {
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// Segments returns the paths of the segments not being written, oldest
+// first.
+func (s *Spool) Segments() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	segs, err := s.segments()
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, seg := range segs {
+		if !s.open[seg.path] {
+			out = append(out, seg.path)
+		}
+	}
+	return out, nil
+}
+
+// Remove deletes the segment at path.
+func (s *Spool) Remove(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	s.bytes = -1
+	return nil
+}
+
+// Create starts a new segment named prefix, a random part, and the
+// segment extension. Expired segments are pruned first.
+func (s *Spool) Create(prefix string) (*Segment, error) {
+	if _, err := s.Prune(); err != nil {
+		return nil, fmt.Errorf("failed to prune spool: %w", err)
+	}
+	ext := plainExt
+	if s.aead != nil {
+		ext = encryptedExt
+	}
+	f, err := os.CreateTemp(s.cfg.Dir, prefix+"*"+ext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool segment: %w", err)
+	}
+	seg := &Segment{s: s, f: f}
+	s.mu.Lock()
+	s.open[f.Name()] = true
+	s.mu.Unlock()
+
+	if s.aead != nil {
+		if err := seg.write([]byte(magic)); err != nil {
+			seg.Close()
+			os.Remove(f.Name())
+			return nil, err
+		}
+	}
+	return seg, nil
+}
+
+// Segment is a segment being written. Each Write is stored as one frame
+// when the spool is encrypted, so a writer should hand it whole lines.
+type Segment struct {
+	s      *Spool
+	f      *os.File
+	frames uint64
+}
+
+// Name returns the segment's path.
+func (g *Segment) Name() string {
+	return g.f.Name()
+}
+
+// Write appends p to the segment, encrypted if the spool is. A write that
+// would exceed MaxBytes first evicts the oldest other segments, or fails
+// with ErrFull under PolicyFail.
+func (g *Segment) Write(p []byte) (int, error) {
+	data := p
+	if aead := g.s.aead; aead != nil {
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return 0, err
+		}
+		frame := binary.BigEndian.AppendUint32(nil, uint32(len(nonce)+len(p)+aead.Overhead()))
+		frame = append(frame, nonce...)
+		data = aead.Seal(frame, nonce, p, frameAD(g.frames))
+	}
+	if err := g.write(data); err != nil {
+		return 0, err
+	}
+	g.frames++
+	return len(p), nil
+}
+
+// write appends data after making room for it.
+func (g *Segment) write(data []byte) error {
+	if err := g.s.reserve(g.f.Name(), int64(len(data))); err != nil {
+		return err
+	}
+	if _, err := g.f.Write(data); err != nil {
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+	return nil
+}
+
+// Close syncs and closes the segment.
+func (g *Segment) Close() error {
+	err := g.f.Sync()
+	if cerr := g.f.Close(); err == nil {
+		err = cerr
+	}
+	g.s.mu.Lock()
+	delete(g.s.open, g.f.Name())
+	g.s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	return nil
+}
+
+// reserve makes room for n more bytes in the segment at path. The
+// directory is only scanned when the running total says the spool is full,
+// as segments may have been removed since.
+func (s *Spool) reserve(path string, n int64) error {
+	if s.cfg.MaxBytes <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.bytes >= 0 && s.bytes+n <= s.cfg.MaxBytes {
+		s.bytes += n
+		return nil
+	}
+	segs, err := s.segments()
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, seg := range segs {
+		total += seg.size
+	}
+	defer func() { s.bytes = total }()
+	if total+n <= s.cfg.MaxBytes {
+		total += n
+		return nil
+	}
+	if s.cfg.OnFull == PolicyFail {
+		return ErrFull
+	}
+	for _, seg := range segs {
+		if total+n <= s.cfg.MaxBytes {
+			break
+		}
+		if s.open[seg.path] || seg.path == path {
+			continue
+		}
+		if err := os.Remove(seg.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= seg.size
+	}
+	if total+n > s.cfg.MaxBytes {
+		return ErrFull
+	}
+	total += n
+	return nil
+}
+
+// frameAD binds a frame to its position, so frames cannot be reordered.
+func frameAD(i uint64) []byte {
+	return binary.BigEndian.AppendUint64([]byte(magic), i)
+}
+
+// Open returns the contents of the segment at path, decrypted. Encrypted
+// segments need the spool's key.
+func (s *Spool) Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, encryptedExt) {
+		return f, nil
+	}
+	if s.aead == nil {
+		f.Close()
+		return nil, fmt.Errorf("%s is encrypted and no spool encryption key is set", filepath.Base(path))
+	}
+	r := &frameReader{aead: s.aead, f: f, br: bufio.NewReader(f)}
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(r.br, head); err != nil || string(head) != magic {
+		f.Close()
+		return nil, fmt.Errorf("%s is not an encrypted spool segment", filepath.Base(path))
+	}
+	return r, nil
+}
+
+// frameReader decrypts an encrypted segment frame by frame.
+type frameReader struct {
+	aead   cipher.AEAD
+	f      *os.File
+	br     *bufio.Reader
+	frames uint64
+	buf    []byte // decrypted and not yet read
+}
+
+func (r *frameReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *frameReader) next() error {
+	var size [4]byte
+	if _, err := io.ReadFull(r.br, size[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return errors.New("spool segment truncated")
+		}
+		return err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	ns := r.aead.NonceSize()
+	if n < uint32(ns+r.aead.Overhead()) || n > maxFrame {
+		return fmt.Errorf("invalid spool frame size %d", n)
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r.br, frame); err != nil {
+		return errors.New("spool segment truncated")
+	}
+	plain, err := r.aead.Open(frame[ns:ns], frame[:ns], frame[ns:], frameAD(r.frames))
+	if err != nil {
+		return errors.New("spool frame failed to decrypt; wrong key or corrupted segment")
+	}
+	r.frames++
+	r.buf = plain
+	return nil
+}
+
+func (r *frameReader) Close() error {
+	return r.f.Close()
+}
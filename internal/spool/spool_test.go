@@ -0,0 +1,205 @@
+package spool
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = bytes.Repeat([]byte{7}, KeySize)
+
+func writeSegment(t *testing.T, s *Spool, lines ...string) string {
+	t.Helper()
+	seg, err := s.Create("kahook-spill-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range lines {
+		if _, err := seg.Write([]byte(l + "\n")); err != nil {
+			seg.Close()
+			t.Fatal(err)
+		}
+	}
+	if err := seg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return seg.Name()
+}
+
+func readSegment(t *testing.T, s *Spool, path string) string {
+	t.Helper()
+	r, err := s.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSpool_Encryption(t *testing.T) {
+	dir := t.TempDir()
+	s, err := New(Config{Dir: dir, Key: testKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeSegment(t, s, `{"topic":"orders","value":"secret-1"}`, `{"topic":"orders","value":"secret-2"}`)
+
+	if !strings.HasSuffix(path, ".jsonl.enc") {
+		t.Errorf("segment = %q, want a .jsonl.enc file", path)
+	}
+	raw, _ := os.ReadFile(path)
+	if bytes.Contains(raw, []byte("secret")) {
+		t.Error("encrypted segment contains plaintext")
+	}
+	want := "{\"topic\":\"orders\",\"value\":\"secret-1\"}\n{\"topic\":\"orders\",\"value\":\"secret-2\"}\n"
+	if got := readSegment(t, s, path); got != want {
+		t.Errorf("decrypted = %q, want %q", got, want)
+	}
+
+	plain, _ := New(Config{Dir: dir})
+	if _, err := plain.Open(path); err == nil {
+		t.Error("Open() without a key succeeded on an encrypted segment")
+	}
+	other, _ := New(Config{Dir: dir, Key: bytes.Repeat([]byte{8}, KeySize)})
+	r, err := other.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := io.ReadAll(r); err == nil {
+		t.Error("reading with the wrong key succeeded")
+	}
+
+	// A truncated segment fails to read rather than ending early.
+	if err := os.WriteFile(path, raw[:len(raw)-3], 0o600); err != nil {
+		t.Fatal(err)
+	}
+	r2, _ := s.Open(path)
+	defer r2.Close()
+	if _, err := io.ReadAll(r2); err == nil {
+		t.Error("reading a truncated segment succeeded")
+	}
+}
+
+func TestSpool_PlaintextWithoutKey(t *testing.T) {
+	s, err := New(Config{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeSegment(t, s, "line")
+	if !strings.HasSuffix(path, ".jsonl") {
+		t.Errorf("segment = %q, want a .jsonl file", path)
+	}
+	if got := readSegment(t, s, path); got != "line\n" {
+		t.Errorf("read = %q", got)
+	}
+}
+
+func TestSpool_InvalidKey(t *testing.T) {
+	if _, err := New(Config{Dir: t.TempDir(), Key: []byte("short")}); err == nil {
+		t.Error("New() accepted a short key")
+	}
+}
+
+// age backdates the segment at path by d.
+func age(t *testing.T, path string, d time.Duration) {
+	t.Helper()
+	ts := time.Now().Add(-d)
+	if err := os.Chtimes(path, ts, ts); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpool_MaxBytes(t *testing.T) {
+	line := strings.Repeat("x", 99) // 100 bytes with the newline
+
+	t.Run("evict oldest", func(t *testing.T) {
+		s, _ := New(Config{Dir: t.TempDir(), MaxBytes: 250})
+		oldest := writeSegment(t, s, line)
+		age(t, oldest, 2*time.Minute)
+		older := writeSegment(t, s, line)
+		age(t, older, time.Minute)
+		newest := writeSegment(t, s, line)
+
+		if _, err := os.Stat(oldest); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("oldest segment not evicted: %v", err)
+		}
+		for _, p := range []string{older, newest} {
+			if _, err := os.Stat(p); err != nil {
+				t.Errorf("segment %s: %v", filepath.Base(p), err)
+			}
+		}
+		if st, _ := s.Stats(); st.Segments != 2 || st.Bytes != 200 {
+			t.Errorf("Stats() = %+v, want 2 segments, 200 bytes", st)
+		}
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		s, _ := New(Config{Dir: t.TempDir(), MaxBytes: 250, OnFull: PolicyFail})
+		first := writeSegment(t, s, line, line)
+		seg, err := s.Create("kahook-spill-")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer seg.Close()
+		if _, err := seg.Write([]byte(line + "\n")); !errors.Is(err, ErrFull) {
+			t.Errorf("Write() error = %v, want ErrFull", err)
+		}
+		if _, err := os.Stat(first); err != nil {
+			t.Errorf("existing segment removed: %v", err)
+		}
+	})
+
+	t.Run("larger than the spool", func(t *testing.T) {
+		s, _ := New(Config{Dir: t.TempDir(), MaxBytes: 50})
+		seg, _ := s.Create("kahook-spill-")
+		defer seg.Close()
+		if _, err := seg.Write([]byte(line + "\n")); !errors.Is(err, ErrFull) {
+			t.Errorf("Write() error = %v, want ErrFull", err)
+		}
+	})
+}
+
+func TestSpool_MaxAge(t *testing.T) {
+	s, _ := New(Config{Dir: t.TempDir(), MaxAge: time.Hour})
+	expired := writeSegment(t, s, "old")
+	age(t, expired, 2*time.Hour)
+	kept := writeSegment(t, s, "new")
+
+	if _, err := os.Stat(expired); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired segment kept: %v", err)
+	}
+	st, err := s.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Segments != 1 || st.Oldest.Before(time.Now().Add(-time.Minute)) {
+		t.Errorf("Stats() = %+v, want only %s", st, filepath.Base(kept))
+	}
+}
+
+func TestSpool_MaxAgeClock(t *testing.T) {
+	now := time.Now()
+	s, _ := New(Config{Dir: t.TempDir(), MaxAge: time.Hour, Now: func() time.Time { return now }})
+	path := writeSegment(t, s, "line")
+
+	if n, err := s.Prune(); err != nil || n != 0 {
+		t.Fatalf("Prune() = %d, %v, want nothing removed while fresh", n, err)
+	}
+	now = now.Add(2 * time.Hour)
+	if n, err := s.Prune(); err != nil || n != 1 {
+		t.Fatalf("Prune() = %d, %v, want the segment removed once the clock passes MaxAge", n, err)
+	}
+	if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expired segment kept: %v", err)
+	}
+}
@@ -0,0 +1,329 @@
+// Package transform reshapes webhook payloads before they are produced, so
+// consumers get the fields they need in the layout they expect without a
+// stream processor in between. A Pipeline is an ordered list of steps, each
+// of which adds fields, removes fields, drops fields whose names match a
+// pattern, flattens nested objects, or wraps the payload in an envelope
+// with request metadata.
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Step is one transform. Set exactly one of Add, Remove, Drop, Flatten,
+// and Envelope. Field paths are dot-separated keys into nested JSON objects
+// ("data.object.amount").
+type Step struct {
+	// Add writes string values, creating intermediate objects as needed.
+	// Values may contain placeholders; see Meta.
+	Add map[string]string
+	// Remove deletes paths.
+	Remove []string
+	// Drop deletes every field, at any depth, whose name matches the
+	// regular expression.
+	Drop string
+	// Flatten, the separator, replaces nested objects with top-level fields
+	// named by joining their paths: {"a":{"b":1}} becomes {"a.b":1} with ".".
+	// Arrays are kept as they are.
+	Flatten string
+	// Envelope wraps the payload in a new object under this field, next to
+	// Metadata, whose values may contain placeholders. Metadata defaults to
+	// received_at: {received_at} and source: {path}.
+	Envelope string
+	Metadata map[string]string
+}
+
+// DefaultMetadata is the envelope metadata when a step sets none.
+var DefaultMetadata = map[string]string{"received_at": "{received_at}", "source": "{path}"}
+
+// Meta is the request a payload came with, for placeholders in Add values
+// and envelope metadata: {received_at} (RFC 3339, UTC), {topic}, {path},
+// {request_id}, and {header:Name}.
+type Meta struct {
+	ReceivedAt time.Time
+	Topic      string
+	Path       string
+	RequestID  string
+	Header     http.Header
+}
+
+// Pipeline applies steps in order. It is safe for concurrent use.
+type Pipeline struct {
+	steps []step
+}
+
+type step struct {
+	add      map[string]value
+	remove   [][]string
+	drop     *regexp.Regexp
+	flatten  string
+	envelope string
+	metadata map[string]value
+}
+
+// value is a string with placeholders, split into literal text and the
+// placeholders between it.
+type value []part
+
+type part struct {
+	text        string
+	placeholder string // received_at, topic, path, request_id, or header
+}
+
+// New validates steps and returns a Pipeline.
+func New(steps []Step) (*Pipeline, error) {
+	p := &Pipeline{steps: make([]step, len(steps))}
+	for i, s := range steps {
+		compiled, err := compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("transform: steps[%d]: %w", i, err)
+		}
+		p.steps[i] = compiled
+	}
+	return p, nil
+}
+
+func compile(s Step) (step, error) {
+	set := 0
+	for _, ok := range []bool{len(s.Add) > 0, len(s.Remove) > 0, s.Drop != "", s.Flatten != "", s.Envelope != ""} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return step{}, errors.New("set exactly one of add, remove, drop, flatten, and envelope")
+	}
+	if len(s.Metadata) > 0 && s.Envelope == "" {
+		return step{}, errors.New("metadata requires envelope")
+	}
+
+	var c step
+	var err error
+	switch {
+	case len(s.Add) > 0:
+		c.add = make(map[string]value, len(s.Add))
+		for path, v := range s.Add {
+			if err := checkPath(path); err != nil {
+				return step{}, fmt.Errorf("add: %w", err)
+			}
+			if c.add[path], err = parseValue(v); err != nil {
+				return step{}, fmt.Errorf("add: %s: %w", path, err)
+			}
+		}
+	case len(s.Remove) > 0:
+		for _, path := range s.Remove {
+			if err := checkPath(path); err != nil {
+				return step{}, fmt.Errorf("remove: %w", err)
+			}
+			c.remove = append(c.remove, strings.Split(path, "."))
+		}
+	case s.Drop != "":
+		if c.drop, err = regexp.Compile(s.Drop); err != nil {
+			return step{}, fmt.Errorf("drop: %w", err)
+		}
+	case s.Flatten != "":
+		c.flatten = s.Flatten
+	default:
+		c.envelope = s.Envelope
+		metadata := s.Metadata
+		if len(metadata) == 0 {
+			metadata = DefaultMetadata
+		}
+		c.metadata = make(map[string]value, len(metadata))
+		for field, v := range metadata {
+			if field == s.Envelope {
+				return step{}, fmt.Errorf("metadata: %q is the envelope field", field)
+			}
+			if c.metadata[field], err = parseValue(v); err != nil {
+				return step{}, fmt.Errorf("metadata: %s: %w", field, err)
+			}
+		}
+	}
+	return c, nil
+}
+
+func checkPath(path string) error {
+	for _, key := range strings.Split(path, ".") {
+		if key == "" {
+			return fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return nil
+}
+
+// parseValue splits s into text and placeholders. An unknown placeholder
+// is an error rather than literal text, so a typo does not reach Kafka.
+func parseValue(s string) (value, error) {
+	var v value
+	for s != "" {
+		start := strings.IndexByte(s, '{')
+		if start < 0 {
+			v = append(v, part{text: s})
+			break
+		}
+		end := strings.IndexByte(s[start:], '}')
+		if end < 0 {
+			return nil, errors.New("unterminated {")
+		}
+		name := s[start+1 : start+end]
+		if start > 0 {
+			v = append(v, part{text: s[:start]})
+		}
+		switch {
+		case name == "received_at", name == "topic", name == "path", name == "request_id":
+			v = append(v, part{placeholder: name})
+		case strings.HasPrefix(name, "header:") && len(name) > len("header:"):
+			v = append(v, part{placeholder: "header", text: http.CanonicalHeaderKey(name[len("header:"):])})
+		default:
+			return nil, fmt.Errorf("unknown placeholder {%s}", name)
+		}
+		s = s[start+end+1:]
+	}
+	return v, nil
+}
+
+func (v value) expand(m Meta) string {
+	var b strings.Builder
+	for _, p := range v {
+		switch p.placeholder {
+		case "":
+			b.WriteString(p.text)
+		case "received_at":
+			b.WriteString(m.ReceivedAt.UTC().Format(time.RFC3339Nano))
+		case "topic":
+			b.WriteString(m.Topic)
+		case "path":
+			b.WriteString(m.Path)
+		case "request_id":
+			b.WriteString(m.RequestID)
+		case "header":
+			b.WriteString(m.Header.Get(p.text))
+		}
+	}
+	return b.String()
+}
+
+// Apply runs the steps over body, a JSON payload received with m. An error
+// means body is not a JSON object.
+func (p *Pipeline) Apply(body []byte, m Meta) ([]byte, error) {
+	var doc map[string]any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil || doc == nil {
+		return nil, errors.New("transform: payload is not a JSON object")
+	}
+
+	for _, s := range p.steps {
+		doc = s.apply(doc, m)
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return nil, fmt.Errorf("transform: encoding payload: %w", err)
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (s step) apply(doc map[string]any, m Meta) map[string]any {
+	switch {
+	case s.add != nil:
+		for path, v := range s.add {
+			set(doc, strings.Split(path, "."), v.expand(m))
+		}
+	case s.remove != nil:
+		for _, path := range s.remove {
+			remove(doc, path)
+		}
+	case s.drop != nil:
+		drop(doc, s.drop)
+	case s.flatten != "":
+		flat := make(map[string]any, len(doc))
+		flatten(flat, "", s.flatten, doc)
+		return flat
+	default:
+		wrapped := make(map[string]any, len(s.metadata)+1)
+		for field, v := range s.metadata {
+			wrapped[field] = v.expand(m)
+		}
+		wrapped[s.envelope] = doc
+		return wrapped
+	}
+	return doc
+}
+
+// set writes v at path, replacing non-object values along the way.
+func set(doc map[string]any, path []string, v any) {
+	cur := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := cur[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			cur[key] = next
+		}
+		cur = next
+	}
+	cur[path[len(path)-1]] = v
+}
+
+func remove(doc map[string]any, path []string) {
+	cur := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := cur[key].(map[string]any)
+		if !ok {
+			return
+		}
+		cur = next
+	}
+	delete(cur, path[len(path)-1])
+}
+
+// drop deletes fields whose names match re from v, descending into nested
+// objects and arrays.
+func drop(v any, re *regexp.Regexp) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			if re.MatchString(k) {
+				delete(v, k)
+				continue
+			}
+			drop(child, re)
+		}
+	case []any:
+		for _, child := range v {
+			drop(child, re)
+		}
+	}
+}
+
+// flatten copies obj's leaves into out under their joined paths. Keys are
+// visited in order so that, when two paths flatten to the same name, the
+// result does not depend on map iteration. Empty objects are kept.
+func flatten(out map[string]any, prefix, sep string, obj map[string]any) {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		name := k
+		if prefix != "" {
+			name = prefix + sep + k
+		}
+		if nested, ok := obj[k].(map[string]any); ok && len(nested) > 0 {
+			flatten(out, name, sep, nested)
+			continue
+		}
+		out[name] = obj[k]
+	}
+}
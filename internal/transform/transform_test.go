@@ -0,0 +1,116 @@
+package transform
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApply(t *testing.T) {
+	meta := Meta{
+		ReceivedAt: time.Date(2024, 6, 1, 12, 0, 0, 0, time.FixedZone("CEST", 2*3600)),
+		Topic:      "orders",
+		Path:       "shop",
+		RequestID:  "req-1",
+		Header:     http.Header{"X-Shop-Domain": {"example.com"}},
+	}
+
+	tests := []struct {
+		name  string
+		steps []Step
+		body  string
+		want  string
+	}{
+		{
+			name:  "add with placeholders",
+			steps: []Step{{Add: map[string]string{"meta.topic": "{topic}", "meta.shop": "shop:{header:x-shop-domain}", "id": "{request_id}"}}},
+			body:  `{"id":1,"meta":"old"}`,
+			want:  `{"id":"req-1","meta":{"shop":"shop:example.com","topic":"orders"}}`,
+		},
+		{
+			name:  "remove",
+			steps: []Step{{Remove: []string{"card.number", "missing.path"}}},
+			body:  `{"card":{"number":"4242","brand":"visa"}}`,
+			want:  `{"card":{"brand":"visa"}}`,
+		},
+		{
+			name:  "drop at any depth",
+			steps: []Step{{Drop: `(?i)^(password|ssn)$`}},
+			body:  `{"user":{"Password":"x","name":"a"},"items":[{"ssn":"1","sku":"b"}],"ssn":"2"}`,
+			want:  `{"items":[{"sku":"b"}],"user":{"name":"a"}}`,
+		},
+		{
+			name:  "flatten",
+			steps: []Step{{Flatten: "_"}},
+			body:  `{"a":{"b":{"c":1},"d":[{"e":2}]},"f":{},"g":1.50}`,
+			want:  `{"a_b_c":1,"a_d":[{"e":2}],"f":{},"g":1.50}`,
+		},
+		{
+			name:  "default envelope",
+			steps: []Step{{Envelope: "payload"}},
+			body:  `{"note":"<b>"}`,
+			want:  `{"payload":{"note":"<b>"},"received_at":"2024-06-01T10:00:00Z","source":"shop"}`,
+		},
+		{
+			name: "steps run in order",
+			steps: []Step{
+				{Remove: []string{"secret"}},
+				{Envelope: "data", Metadata: map[string]string{"topic": "{topic}"}},
+				{Flatten: "."},
+			},
+			body: `{"secret":1,"order":{"id":7}}`,
+			want: `{"data.order.id":7,"topic":"orders"}`,
+		},
+	}
+	for _, tt := range tests {
+		p, err := New(tt.steps)
+		if err != nil {
+			t.Errorf("%s: New() error = %v", tt.name, err)
+			continue
+		}
+		got, err := p.Apply([]byte(tt.body), meta)
+		if err != nil {
+			t.Errorf("%s: Apply() error = %v", tt.name, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("%s: Apply() = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApply_NotObject(t *testing.T) {
+	p, err := New([]Step{{Flatten: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`[1]`, `"x"`, `null`, `not json`} {
+		if _, err := p.Apply([]byte(body), Meta{}); err == nil {
+			t.Errorf("Apply(%s) error = nil, want error", body)
+		}
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		step    Step
+		wantErr string
+	}{
+		{"empty", Step{}, "exactly one"},
+		{"two kinds", Step{Drop: "x", Flatten: "."}, "exactly one"},
+		{"bad regex", Step{Drop: "("}, "drop"},
+		{"bad path", Step{Remove: []string{"a..b"}}, "invalid path"},
+		{"unknown placeholder", Step{Add: map[string]string{"a": "{user}"}}, "unknown placeholder"},
+		{"unterminated placeholder", Step{Add: map[string]string{"a": "{topic"}}, "unterminated"},
+		{"metadata without envelope", Step{Flatten: ".", Metadata: map[string]string{"a": "b"}}, "requires envelope"},
+		{"metadata shadows envelope", Step{Envelope: "data", Metadata: map[string]string{"data": "x"}}, "envelope field"},
+	}
+	for _, tt := range tests {
+		_, err := New([]Step{tt.step})
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: New() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package upcast rewrites webhook payloads sent in an old format to the
+// current one before they are produced, so a topic's schema stays clean
+// while a provider migrates senders between API versions. The payload's
+// version is read from a request header or a JSON field, and each version
+// has a step that upcasts it to the next; steps chain until the payload is
+// at a version with no step of its own.
+package upcast
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Step upcasts payloads at version From to version To. Field paths are
+// dot-separated keys into nested JSON objects ("data.object.amount").
+// Rename runs first, then Set, then Remove.
+type Step struct {
+	From, To string
+
+	// Rename moves the value at each old path to its new path.
+	Rename map[string]string
+	// Set writes string values, creating intermediate objects as needed.
+	Set map[string]string
+	// Remove deletes paths.
+	Remove []string
+}
+
+// Config configures an Upcaster. Exactly one of VersionHeader and
+// VersionField names where a payload's version is read from; a field's value
+// is updated as steps are applied.
+type Config struct {
+	VersionHeader string
+	VersionField  string
+	Steps         []Step
+}
+
+// Upcaster applies version steps to payloads. It is safe for concurrent use.
+type Upcaster struct {
+	header string
+	field  []string
+	steps  map[string]Step
+}
+
+// Result describes what Apply did. From and To are equal, and Body is the
+// input, when no step applied.
+type Result struct {
+	Body     []byte
+	From, To string
+}
+
+// Upcast reports whether any step was applied.
+func (r Result) Upcast() bool { return r.From != r.To }
+
+// New validates cfg and returns an Upcaster.
+func New(cfg Config) (*Upcaster, error) {
+	if (cfg.VersionHeader == "") == (cfg.VersionField == "") {
+		return nil, errors.New("upcast: set exactly one of version header and version field")
+	}
+	u := &Upcaster{steps: make(map[string]Step, len(cfg.Steps))}
+	if cfg.VersionHeader != "" {
+		u.header = http.CanonicalHeaderKey(cfg.VersionHeader)
+	} else {
+		u.field = strings.Split(cfg.VersionField, ".")
+	}
+	for i, s := range cfg.Steps {
+		if s.From == "" || s.To == "" {
+			return nil, fmt.Errorf("upcast: steps[%d]: from and to are required", i)
+		}
+		if s.From == s.To {
+			return nil, fmt.Errorf("upcast: steps[%d]: from and to are both %q", i, s.From)
+		}
+		if _, dup := u.steps[s.From]; dup {
+			return nil, fmt.Errorf("upcast: steps[%d]: version %q already has a step", i, s.From)
+		}
+		for from, to := range s.Rename {
+			if from == "" || to == "" {
+				return nil, fmt.Errorf("upcast: steps[%d]: rename paths must not be empty", i)
+			}
+		}
+		u.steps[s.From] = s
+	}
+	for from := range u.steps {
+		seen := map[string]bool{from: true}
+		for v := u.steps[from].To; ; v = u.steps[v].To {
+			if _, ok := u.steps[v]; !ok {
+				break
+			}
+			if seen[v] {
+				return nil, fmt.Errorf("upcast: steps from %q loop back to %q", from, v)
+			}
+			seen[v] = true
+		}
+	}
+	return u, nil
+}
+
+// Header returns the canonical name of the version header, or "" when the
+// version is read from a field.
+func (u *Upcaster) Header() string { return u.header }
+
+// Apply upcasts body, a JSON payload sent with header. Payloads whose
+// version cannot be found, or has no step, are returned unchanged; an error
+// means body had to be upcast but is not a JSON object.
+func (u *Upcaster) Apply(header http.Header, body []byte) (Result, error) {
+	unchanged := Result{Body: body}
+
+	var version string
+	var doc map[string]any
+	if u.header != "" {
+		version = header.Get(u.header)
+		if _, ok := u.steps[version]; version == "" || !ok {
+			unchanged.From, unchanged.To = version, version
+			return unchanged, nil
+		}
+		if err := decode(body, &doc); err != nil {
+			return Result{}, err
+		}
+	} else {
+		// The field version needs the document parsed; a body that is not a
+		// JSON object has no version to upcast.
+		if decode(body, &doc) != nil {
+			return unchanged, nil
+		}
+		v, ok := lookup(doc, u.field)
+		if !ok {
+			return unchanged, nil
+		}
+		version = fieldString(v)
+		if _, ok := u.steps[version]; !ok {
+			unchanged.From, unchanged.To = version, version
+			return unchanged, nil
+		}
+	}
+
+	from := version
+	for {
+		step, ok := u.steps[version]
+		if !ok {
+			break
+		}
+		step.apply(doc)
+		version = step.To
+		if u.field != nil {
+			set(doc, u.field, version)
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(doc); err != nil {
+		return Result{}, fmt.Errorf("upcast: encoding payload: %w", err)
+	}
+	return Result{Body: bytes.TrimSuffix(buf.Bytes(), []byte("\n")), From: from, To: version}, nil
+}
+
+func (s Step) apply(doc map[string]any) {
+	for from, to := range s.Rename {
+		fromPath := strings.Split(from, ".")
+		if v, ok := lookup(doc, fromPath); ok {
+			remove(doc, fromPath)
+			set(doc, strings.Split(to, "."), v)
+		}
+	}
+	for path, v := range s.Set {
+		set(doc, strings.Split(path, "."), v)
+	}
+	for _, path := range s.Remove {
+		remove(doc, strings.Split(path, "."))
+	}
+}
+
+// decode parses body as a JSON object, keeping numbers exact.
+func decode(body []byte, doc *map[string]any) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(doc); err != nil || *doc == nil {
+		return errors.New("upcast: payload is not a JSON object")
+	}
+	return nil
+}
+
+// fieldString formats a version field's value; versions may be sent as
+// numbers.
+func fieldString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+func lookup(doc map[string]any, path []string) (any, bool) {
+	cur := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := cur[key].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur = next
+	}
+	v, ok := cur[path[len(path)-1]]
+	return v, ok
+}
+
+// set writes v at path, replacing non-object values along the way.
+func set(doc map[string]any, path []string, v any) {
+	cur := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := cur[key].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			cur[key] = next
+		}
+		cur = next
+	}
+	cur[path[len(path)-1]] = v
+}
+
+func remove(doc map[string]any, path []string) {
+	cur := doc
+	for _, key := range path[:len(path)-1] {
+		next, ok := cur[key].(map[string]any)
+		if !ok {
+			return
+		}
+		cur = next
+	}
+	delete(cur, path[len(path)-1])
+}
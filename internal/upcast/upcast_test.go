@@ -0,0 +1,121 @@
+package upcast
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestApply_FieldVersion(t *testing.T) {
+	u, err := New(Config{
+		VersionField: "meta.version",
+		Steps: []Step{
+			{From: "1", To: "2", Rename: map[string]string{"amount_cents": "amount.value"}, Set: map[string]string{"amount.currency": "usd"}},
+			{From: "2", To: "3", Remove: []string{"legacy_id"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, body, want string
+		from, to         string
+	}{
+		{
+			name: "chains to current",
+			body: `{"meta":{"version":1},"amount_cents":1999,"legacy_id":"x","note":"<b>"}`,
+			want: `{"amount":{"currency":"usd","value":1999},"meta":{"version":"3"},"note":"<b>"}`,
+			from: "1", to: "3",
+		},
+		{
+			name: "middle version",
+			body: `{"meta":{"version":"2"},"legacy_id":"x"}`,
+			want: `{"meta":{"version":"3"}}`,
+			from: "2", to: "3",
+		},
+		{
+			name: "current version unchanged",
+			body: `{"meta":{"version":"3"}, "amount_cents":1}`,
+			want: `{"meta":{"version":"3"}, "amount_cents":1}`,
+			from: "3", to: "3",
+		},
+		{
+			name: "no version unchanged",
+			body: `{"amount_cents":1}`,
+			want: `{"amount_cents":1}`,
+		},
+		{
+			name: "not an object unchanged",
+			body: `[1,2]`,
+			want: `[1,2]`,
+		},
+	}
+	for _, tt := range tests {
+		res, err := u.Apply(nil, []byte(tt.body))
+		if err != nil {
+			t.Errorf("%s: Apply() error = %v", tt.name, err)
+			continue
+		}
+		if string(res.Body) != tt.want || res.From != tt.from || res.To != tt.to {
+			t.Errorf("%s: Apply() = %s (%q -> %q), want %s (%q -> %q)", tt.name, res.Body, res.From, res.To, tt.want, tt.from, tt.to)
+		}
+	}
+}
+
+func TestApply_HeaderVersion(t *testing.T) {
+	u, err := New(Config{
+		VersionHeader: "stripe-version",
+		Steps:         []Step{{From: "2023-10-16", To: "2024-06-20", Rename: map[string]string{"type": "event_type"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Header() != "Stripe-Version" {
+		t.Errorf("Header() = %q, want Stripe-Version", u.Header())
+	}
+
+	h := http.Header{"Stripe-Version": {"2023-10-16"}}
+	res, err := u.Apply(h, []byte(`{"type":"charge.succeeded"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Body) != `{"event_type":"charge.succeeded"}` || !res.Upcast() || res.To != "2024-06-20" {
+		t.Errorf("Apply() = %s (%q -> %q)", res.Body, res.From, res.To)
+	}
+
+	// A body that must be upcast but cannot be is an error.
+	if _, err := u.Apply(h, []byte(`not json`)); err == nil {
+		t.Error("Apply() on a non-JSON body with an old version succeeded, want an error")
+	}
+
+	// Without the header, or at the current version, nothing is parsed.
+	for _, h := range []http.Header{{}, {"Stripe-Version": {"2024-06-20"}}} {
+		res, err := u.Apply(h, []byte(`not json`))
+		if err != nil || res.Upcast() || string(res.Body) != "not json" {
+			t.Errorf("Apply(%v) = %+v, %v; want the body unchanged", h, res, err)
+		}
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{"no version source", Config{Steps: []Step{{From: "1", To: "2"}}}, "exactly one"},
+		{"both version sources", Config{VersionHeader: "V", VersionField: "v"}, "exactly one"},
+		{"missing to", Config{VersionField: "v", Steps: []Step{{From: "1"}}}, "required"},
+		{"same version", Config{VersionField: "v", Steps: []Step{{From: "1", To: "1"}}}, "both"},
+		{"duplicate", Config{VersionField: "v", Steps: []Step{{From: "1", To: "2"}, {From: "1", To: "3"}}}, "already has a step"},
+		{"cycle", Config{VersionField: "v", Steps: []Step{{From: "1", To: "2"}, {From: "2", To: "1"}}}, "loop"},
+		{"empty rename", Config{VersionField: "v", Steps: []Step{{From: "1", To: "2", Rename: map[string]string{"a": ""}}}}, "rename"},
+	}
+	for _, tt := range tests {
+		_, err := New(tt.cfg)
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: New() error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+// Package testkit provides test doubles for code that embeds kahook.
+//
+// Producer is an in-memory implementation of the server's producer interface
+// that records every message and can be told to fail, so handler behaviour
+// and configuration can be tested without a broker. ReplayFixtures sends
+// webhooks recorded from real traffic (record.dir) through a server, so
+// provider payloads can be regression-tested. Soak sends a server a stream
+// of adversarial webhooks and fails on panics, hangs and server errors.
+package testkit
+
+import (
+	"context"
+	"sync"
+)
+
+// Message is a message captured by Producer.
+type Message struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// Producer records produced messages in memory. It is safe for concurrent
+// use. The zero value is not usable; call NewProducer.
+type Producer struct {
+	mu        sync.Mutex
+	messages  []Message
+	err       error
+	failNext  []error
+	topicErrs map[string]error
+	connected bool
+	closed    bool
+}
+
+// NewProducer returns a connected Producer with no failures configured.
+func NewProducer() *Producer {
+	return &Producer{
+		topicErrs: make(map[string]error),
+		connected: true,
+	}
+}
+
+// Produce records the message, or returns the configured failure. Failed
+// messages are not recorded. Failures are checked in order: queued FailNext
+// errors, then topic errors, then the error set by FailWith.
+func (p *Producer) Produce(ctx context.Context, topic string, key, value []byte, headers map[string]string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.failNext) > 0 {
+		err := p.failNext[0]
+		p.failNext = p.failNext[1:]
+		return err
+	}
+	if err := p.topicErrs[topic]; err != nil {
+		return err
+	}
+	if p.err != nil {
+		return p.err
+	}
+
+	p.messages = append(p.messages, Message{
+		Topic:   topic,
+		Key:     clone(key),
+		Value:   clone(value),
+		Headers: cloneHeaders(headers),
+	})
+	return nil
+}
+
+// IsConnected reports the state set by SetConnected; true by default.
+func (p *Producer) IsConnected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.connected && !p.closed
+}
+
+// Close marks the producer closed. Recorded messages remain available.
+func (p *Producer) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+}
+
+// Closed reports whether Close has been called.
+func (p *Producer) Closed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// Messages returns a copy of every recorded message, in produce order.
+func (p *Producer) Messages() []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]Message(nil), p.messages...)
+}
+
+// MessagesFor returns the recorded messages for topic, in produce order.
+func (p *Producer) MessagesFor(topic string) []Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []Message
+	for _, m := range p.messages {
+		if m.Topic == topic {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Reset discards recorded messages and clears all configured failures.
+func (p *Producer) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = nil
+	p.err = nil
+	p.failNext = nil
+	p.topicErrs = make(map[string]error)
+	p.connected = true
+}
+
+// FailWith makes every subsequent Produce return err. A nil err clears it.
+func (p *Producer) FailWith(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// FailNext makes the next n calls to Produce return err, after which the
+// producer behaves as before.
+func (p *Producer) FailNext(n int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < n; i++ {
+		p.failNext = append(p.failNext, err)
+	}
+}
+
+// FailTopic makes Produce to topic return err. A nil err clears it.
+func (p *Producer) FailTopic(topic string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err == nil {
+		delete(p.topicErrs, topic)
+		return
+	}
+	p.topicErrs[topic] = err
+}
+
+// SetConnected sets the value reported by IsConnected, which drives /ready.
+func (p *Producer) SetConnected(connected bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.connected = connected
+}
+
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func cloneHeaders(h map[string]string) map[string]string {
+	if h == nil {
+		return nil
+	}
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,106 @@
+package testkit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/server"
+)
+
+var _ server.KafkaProducer = (*Producer)(nil)
+
+func newServer(p *Producer) http.Handler {
+	return server.NewServer(server.ServerConfig{
+		Port:     8080,
+		Producer: p,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+	}).Handler()
+}
+
+func post(h http.Handler, topic, body string) int {
+	req := httptest.NewRequest(http.MethodPost, "/"+topic, strings.NewReader(body))
+	req.Header.Set("X-Webhook-Key", "k1")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestProducer_CapturesMessages(t *testing.T) {
+	p := NewProducer()
+	h := newServer(p)
+
+	if code := post(h, "orders", `{"id":1}`); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", code)
+	}
+	post(h, "payments", `{"id":2}`)
+
+	if got := len(p.Messages()); got != 2 {
+		t.Fatalf("Messages() len = %d, want 2", got)
+	}
+	msgs := p.MessagesFor("orders")
+	if len(msgs) != 1 || string(msgs[0].Value) != `{"id":1}` {
+		t.Errorf("MessagesFor(orders) = %+v", msgs)
+	}
+}
+
+func TestProducer_FailureInjection(t *testing.T) {
+	p := NewProducer()
+	h := newServer(p)
+	boom := errors.New("broker down")
+
+	p.FailNext(1, boom)
+	if code := post(h, "orders", `{}`); code != http.StatusInternalServerError {
+		t.Errorf("FailNext: status = %d, want 500", code)
+	}
+	if code := post(h, "orders", `{}`); code != http.StatusAccepted {
+		t.Errorf("after FailNext: status = %d, want 202", code)
+	}
+
+	p.FailTopic("payments", boom)
+	if code := post(h, "payments", `{}`); code != http.StatusInternalServerError {
+		t.Errorf("FailTopic: status = %d, want 500", code)
+	}
+	if code := post(h, "orders", `{}`); code != http.StatusAccepted {
+		t.Errorf("FailTopic leaked to another topic: status = %d", code)
+	}
+
+	p.FailWith(boom)
+	if err := p.Produce(context.Background(), "orders", nil, nil, nil); !errors.Is(err, boom) {
+		t.Errorf("FailWith: err = %v", err)
+	}
+
+	p.Reset()
+	if len(p.Messages()) != 0 {
+		t.Error("Reset should discard messages")
+	}
+	if err := p.Produce(context.Background(), "orders", nil, nil, nil); err != nil {
+		t.Errorf("Reset should clear failures, got %v", err)
+	}
+}
+
+func TestProducer_Connected(t *testing.T) {
+	p := NewProducer()
+	h := newServer(p)
+
+	ready := func() int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+
+	if code := ready(); code != http.StatusOK {
+		t.Errorf("/ready = %d, want 200", code)
+	}
+	p.SetConnected(false)
+	if code := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("/ready = %d, want 503 when disconnected", code)
+	}
+}
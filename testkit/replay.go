@@ -0,0 +1,68 @@
+package testkit
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kahook/internal/fixture"
+)
+
+// Fixture is a webhook request recorded by kahook with record.dir set.
+type Fixture = fixture.Fixture
+
+// LoadFixtures reads the fixtures recorded in dir, in recording order.
+func LoadFixtures(dir string) ([]*Fixture, error) {
+	return fixture.LoadDir(dir)
+}
+
+// ReplayResult is the outcome of replaying one fixture.
+type ReplayResult struct {
+	Fixture *Fixture
+	// Status and Body are the response to the replayed request.
+	Status int
+	Body   []byte
+	// Messages are the messages p recorded while handling the request.
+	Messages []Message
+}
+
+// ReplayFixtures serves h, usually a kahook Handler built with p as its
+// producer, on an httptest server and sends it each fixture in turn. A
+// response status that differs from the recorded one fails t; the messages
+// produced are returned for the caller to check.
+func ReplayFixtures(t testing.TB, h http.Handler, p *Producer, fixtures []*Fixture) []ReplayResult {
+	t.Helper()
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	results := make([]ReplayResult, 0, len(fixtures))
+	for _, f := range fixtures {
+		req, err := f.NewRequest(srv.URL)
+		if err != nil {
+			t.Fatalf("replaying %s %s: %v", f.Method, f.Path, err)
+		}
+		before := len(p.Messages())
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("replaying %s %s: %v", f.Method, f.Path, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("replaying %s %s: reading response: %v", f.Method, f.Path, err)
+		}
+
+		if resp.StatusCode != f.Status {
+			t.Errorf("replaying %s %s recorded at %s: status = %d, recorded %d: %s",
+				f.Method, f.Path, f.RecordedAt.Format("2006-01-02T15:04:05Z"), resp.StatusCode, f.Status, body)
+		}
+		results = append(results, ReplayResult{
+			Fixture:  f,
+			Status:   resp.StatusCode,
+			Body:     body,
+			Messages: p.Messages()[before:],
+		})
+	}
+	return results
+}
@@ -0,0 +1,92 @@
+package testkit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/server"
+)
+
+func TestReplayFixtures(t *testing.T) {
+	// Record two webhooks, one of them rejected.
+	dir := t.TempDir()
+	recording := server.NewServer(server.ServerConfig{
+		Port:      8080,
+		Producer:  NewProducer(),
+		Auth:      auth.NewMultiAuth(nil, nil),
+		Logger:    zap.NewNop(),
+		RecordDir: dir,
+		Topics:    map[string]server.TopicOptions{"stripe": {Payload: server.PayloadJSONOnly}},
+	}).Handler()
+	for _, body := range []string{`{"type":"charge.succeeded"}`, `not json`} {
+		req := httptest.NewRequest(http.MethodPost, "/stripe", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Stripe-Signature", "t=1,v1=abc")
+		recording.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) != 2 {
+		t.Fatalf("LoadFixtures returned %d fixtures, want 2", len(fixtures))
+	}
+
+	p := NewProducer()
+	h := server.NewServer(server.ServerConfig{
+		Port:     8080,
+		Producer: p,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Topics:   map[string]server.TopicOptions{"stripe": {Payload: server.PayloadJSONOnly}},
+	}).Handler()
+
+	results := ReplayFixtures(t, h, p, fixtures)
+	if len(results) != 2 {
+		t.Fatalf("ReplayFixtures returned %d results, want 2", len(results))
+	}
+	if r := results[0]; r.Status != http.StatusAccepted || len(r.Messages) != 1 {
+		t.Fatalf("first replay = %d with %d messages, want 202 with 1", r.Status, len(r.Messages))
+	}
+	m := results[0].Messages[0]
+	if m.Topic != "stripe" || string(m.Value) != `{"type":"charge.succeeded"}` || m.Headers["Stripe-Signature"] != "t=1,v1=abc" {
+		t.Errorf("replayed message = %+v", m)
+	}
+	if r := results[1]; r.Status != http.StatusBadRequest || len(r.Messages) != 0 {
+		t.Errorf("second replay = %d with %d messages, want 400 with none", r.Status, len(r.Messages))
+	}
+}
+
+func TestReplayFixtures_ReportsStatusChange(t *testing.T) {
+	f := &Fixture{Method: http.MethodPost, Path: "/orders", Body: `{}`, Status: http.StatusAccepted}
+	p := NewProducer()
+	p.FailWith(errors.New("broker down"))
+	h := server.NewServer(server.ServerConfig{
+		Port:     8080,
+		Producer: p,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+	}).Handler()
+
+	rec := &recordingTB{TB: t}
+	ReplayFixtures(rec, h, p, []*Fixture{f})
+	if !rec.failed.Load() {
+		t.Error("ReplayFixtures did not report a changed status")
+	}
+}
+
+// recordingTB captures Errorf so a test can assert that a helper failed.
+type recordingTB struct {
+	testing.TB
+	failed atomic.Bool
+}
+
+func (r *recordingTB) Errorf(string, ...any) { r.failed.Store(true) }
@@ -0,0 +1,302 @@
+package testkit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// oversizeBody is just over kahook's 1 MiB webhook body limit.
+const oversizeBody = 1<<20 + 1
+
+// SoakOptions controls a Soak run. The zero value sends 1000 requests from
+// 8 workers to /soak.
+type SoakOptions struct {
+	// Workers is the number of concurrent clients.
+	Workers int
+	// Duration runs the soak for this long. When zero, Requests bounds the
+	// run instead.
+	Duration time.Duration
+	// Requests is the number of requests sent when Duration is zero.
+	Requests int
+	// Timeout is how long one request may take before it counts as a hang.
+	Timeout time.Duration
+	// Paths are the webhook paths requests are sent to, alongside the
+	// adversarial paths Soak generates itself.
+	Paths []string
+	// Seed seeds the request generator, so a failing run can be repeated.
+	Seed int64
+}
+
+// SoakResult summarizes a Soak run.
+type SoakResult struct {
+	Requests int
+	// Statuses counts responses by status code.
+	Statuses map[int]int
+}
+
+// Soak serves h on an httptest server and sends it a stream of valid and
+// adversarial webhooks from concurrent clients: malformed and binary bodies,
+// bodies over the size limit, slowly trickled bodies, pathological headers,
+// odd methods, and paths with traversal, escapes and overlong topic names.
+//
+// A request that panics the handler, hangs past Timeout, or is answered with
+// a 5xx status fails t, so h should be built with a producer that accepts
+// every message, such as NewProducer.
+func Soak(t testing.TB, h http.Handler, opts SoakOptions) SoakResult {
+	t.Helper()
+	if opts.Workers <= 0 {
+		opts.Workers = 8
+	}
+	if opts.Duration <= 0 && opts.Requests <= 0 {
+		opts.Requests = 1000
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if len(opts.Paths) == 0 {
+		opts.Paths = []string{"/soak"}
+	}
+
+	// net/http recovers handler panics and logs them to ErrorLog, so a panic
+	// is only visible there and as a dropped connection.
+	panics := &panicLog{}
+	srv := httptest.NewUnstartedServer(h)
+	srv.Config.ErrorLog = log.New(panics, "", 0)
+	srv.Start()
+	defer srv.Close()
+
+	client := srv.Client()
+	client.Timeout = opts.Timeout
+
+	ctx := context.Background()
+	if opts.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Duration)
+		defer cancel()
+	}
+
+	var (
+		sent     atomic.Int64
+		mu       sync.Mutex
+		statuses = make(map[int]int)
+		wg       sync.WaitGroup
+	)
+	for w := range opts.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			gen := &soakGenerator{rng: rand.New(rand.NewSource(opts.Seed + int64(w))), paths: opts.Paths}
+			for ctx.Err() == nil {
+				n := sent.Add(1)
+				if opts.Duration <= 0 && n > int64(opts.Requests) {
+					return
+				}
+				req, desc := gen.next(srv.URL)
+				status, err := soakRequest(client, req)
+				if err != nil {
+					t.Errorf("soak %s: %v", desc, err)
+					continue
+				}
+				if status >= 500 {
+					t.Errorf("soak %s: status %d", desc, status)
+				}
+				mu.Lock()
+				statuses[status]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if msgs := panics.messages(); len(msgs) > 0 {
+		t.Errorf("handler panicked %d times; first: %s", len(msgs), msgs[0])
+	}
+
+	result := SoakResult{Statuses: statuses}
+	for _, n := range statuses {
+		result.Requests += n
+	}
+	return result
+}
+
+func soakRequest(client *http.Client, req *http.Request) (int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		var timeout interface{ Timeout() bool }
+		if errors.As(err, &timeout) && timeout.Timeout() {
+			return 0, fmt.Errorf("no response: handler hung: %w", err)
+		}
+		return 0, fmt.Errorf("connection dropped: %w", err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, fmt.Errorf("reading response: %w", err)
+	}
+	return resp.StatusCode, nil
+}
+
+// panicLog collects the panics net/http logs while serving.
+type panicLog struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (p *panicLog) Write(b []byte) (int, error) {
+	if bytes.Contains(b, []byte("panic")) {
+		p.mu.Lock()
+		p.msgs = append(p.msgs, string(b))
+		p.mu.Unlock()
+	}
+	return len(b), nil
+}
+
+func (p *panicLog) messages() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.msgs
+}
+
+// soakGenerator builds soak requests. It is used by one worker only.
+type soakGenerator struct {
+	rng   *rand.Rand
+	paths []string
+}
+
+var soakPaths = []string{
+	"/",
+	"//",
+	"/../../etc/passwd",
+	"/%2e%2e/%2e%2e/admin",
+	"/a/b/c",
+	"/topic%00name",
+	"/top%20ic",
+	"/t%C3%B6pic",
+	"/%FF%FE",
+	"/health/../metrics",
+	"/.env",
+	"/" + strings.Repeat("t", 250),
+	"/" + strings.Repeat("a/", 500),
+}
+
+var soakContentTypes = []string{
+	"application/json",
+	"application/json; charset=utf-8",
+	"application/cloudevents+json",
+	"text/plain",
+	"application/octet-stream",
+	"image/png",
+	"application/x-www-form-urlencoded",
+	"multipart/form-data; boundary=",
+	"application/json; charset=\"",
+	";;;",
+	"application/" + strings.Repeat("x", 4096),
+}
+
+// next returns a request and a short description of it for failure messages.
+func (g *soakGenerator) next(baseURL string) (*http.Request, string) {
+	path := g.paths[g.rng.Intn(len(g.paths))]
+	if g.rng.Intn(3) == 0 {
+		path = soakPaths[g.rng.Intn(len(soakPaths))]
+	}
+	method := http.MethodPost
+	if g.rng.Intn(10) == 0 {
+		method = []string{http.MethodGet, http.MethodPut, http.MethodDelete, http.MethodOptions, "PURGE"}[g.rng.Intn(5)]
+	}
+
+	var (
+		body io.Reader
+		kind string
+	)
+	switch g.rng.Intn(7) {
+	case 0:
+		kind = "json"
+		body = strings.NewReader(fmt.Sprintf(`{"id":%d,"event":"soak"}`, g.rng.Int()))
+	case 1:
+		kind = "malformed json"
+		valid := []byte(`{"a":[1,2,{"b":"c"}],"d":"é"}`)
+		body = bytes.NewReader(valid[:g.rng.Intn(len(valid))])
+	case 2:
+		kind = "binary"
+		b := make([]byte, g.rng.Intn(8<<10))
+		g.rng.Read(b)
+		body = bytes.NewReader(b)
+	case 3:
+		kind = "empty"
+		body = http.NoBody
+	case 4:
+		kind = "oversize"
+		body = bytes.NewReader(bytes.Repeat([]byte("x"), oversizeBody))
+	case 5:
+		kind = "trickled"
+		body = &trickleReader{data: []byte(`{"slow":true}`), delay: time.Millisecond}
+	case 6:
+		kind = "deep json"
+		depth := 1 + g.rng.Intn(10000)
+		body = strings.NewReader(strings.Repeat("[", depth) + strings.Repeat("]", depth))
+	}
+
+	req, err := http.NewRequest(method, baseURL+path, body)
+	if err != nil {
+		// Every generated path is a valid URL; fall back rather than fail.
+		req, _ = http.NewRequest(method, baseURL+"/soak", body)
+	}
+	req.Header.Set("Content-Type", soakContentTypes[g.rng.Intn(len(soakContentTypes))])
+	g.pathologicalHeaders(req.Header)
+	return req, fmt.Sprintf("%s %s (%s body)", method, path, kind)
+}
+
+// pathologicalHeaders sometimes adds headers a well-behaved client would
+// not send: hundreds of them, very long values, repeated names, and junk in
+// headers kahook interprets.
+func (g *soakGenerator) pathologicalHeaders(h http.Header) {
+	switch g.rng.Intn(6) {
+	case 0:
+		for i := range 200 {
+			h.Set(fmt.Sprintf("X-Soak-%d", i), "v")
+		}
+	case 1:
+		h.Set("X-Soak-Long", strings.Repeat("v", 32<<10))
+	case 2:
+		for range 100 {
+			h.Add("X-Soak-Repeated", "v")
+		}
+	case 3:
+		h.Set("X-Request-ID", strings.Repeat("r", 1024))
+		h.Set("X-Forwarded-For", "not-an-ip, , 999.1.1.1, ::ffff:")
+		h.Set("Authorization", "Bearer "+strings.Repeat("=", 512))
+	case 4:
+		h.Set("Content-Encoding", "gzip")
+		h.Set("Transfer-Encoding", "identity")
+	}
+}
+
+// trickleReader returns one byte per read, sleeping before each, to hold
+// the handler in a slow body read.
+type trickleReader struct {
+	data  []byte
+	delay time.Duration
+}
+
+func (r *trickleReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	time.Sleep(r.delay)
+	p[0], r.data = r.data[0], r.data[1:]
+	return 1, nil
+}
@@ -0,0 +1,74 @@
+package testkit
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/kahook/internal/auth"
+	"github.com/kahook/internal/server"
+)
+
+// TestSoak_Kahook soaks a kahook server with routes, payload modes and
+// scanner paths configured. It sends a few hundred requests by default; set
+// KAHOOK_SOAK_DURATION (e.g. 5m, or make soak) for a long run.
+func TestSoak_Kahook(t *testing.T) {
+	opts := SoakOptions{
+		Requests: 300,
+		Paths:    []string{"/orders", "/uploads", "/events", "/hooks/github"},
+	}
+	if v := os.Getenv("KAHOOK_SOAK_DURATION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			t.Fatalf("KAHOOK_SOAK_DURATION: %v", err)
+		}
+		opts.Duration = d
+	}
+
+	p := NewProducer()
+	h := server.NewServer(server.ServerConfig{
+		Port:     8080,
+		Producer: p,
+		Auth:     auth.NewMultiAuth(nil, nil),
+		Logger:   zap.NewNop(),
+		Topics: map[string]server.TopicOptions{
+			"orders":  {Payload: server.PayloadJSONOnly},
+			"uploads": {Payload: server.PayloadBase64},
+		},
+		RoutePaths:   map[string]string{"hooks/github": "github"},
+		ScannerPaths: []string{"/.env", "/wp-admin"},
+	}).Handler()
+
+	result := Soak(t, h, opts)
+	if result.Requests == 0 || result.Statuses[http.StatusAccepted] == 0 {
+		t.Errorf("soak statuses = %v, want some accepted webhooks", result.Statuses)
+	}
+	if got := len(p.Messages()); got != result.Statuses[http.StatusAccepted] {
+		t.Errorf("produced %d messages for %d accepted webhooks", got, result.Statuses[http.StatusAccepted])
+	}
+}
+
+func TestSoak_ReportsPanicsAndHangs(t *testing.T) {
+	h := http.NewServeMux()
+	h.HandleFunc("/panic", func(http.ResponseWriter, *http.Request) { panic("boom") })
+	h.HandleFunc("/hang", func(_ http.ResponseWriter, r *http.Request) {
+		// The request context is only canceled once the body has been read.
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	})
+	h.HandleFunc("/fail", func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusInternalServerError) })
+
+	for _, path := range []string{"/panic", "/hang", "/fail"} {
+		t.Run(path, func(t *testing.T) {
+			rec := &recordingTB{TB: t}
+			Soak(rec, h, SoakOptions{Workers: 1, Requests: 3, Timeout: 100 * time.Millisecond, Paths: []string{path}})
+			if !rec.failed.Load() {
+				t.Errorf("Soak did not report %s", path)
+			}
+		})
+	}
+}